@@ -0,0 +1,261 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"unicareos/core/networking"
+)
+
+// Ban administration endpoints. All require a valid X-API-Key.
+//
+//	GET    /admin/bans             active bans
+//	POST   /admin/bans             {"target","duration","reason","actor"} ban an IP, CIDR or node:<hex>
+//	POST   /admin/unban            {"target","reason","actor"} lift a ban early
+//	GET    /admin/allowlist        allowlist entries
+//	POST   /admin/allowlist        {"target","note","actor"} exempt a target from bans
+//	DELETE /admin/allowlist?target=...
+//	GET    /admin/ban_audit?limit= recent ban decisions, newest first
+//
+// Network-wide bans go through validator consensus instead (see networking/banconsensus.go):
+//
+//	GET    /admin/ban_event         pending proposals and their approval progress
+//	POST   /admin/ban_event         {"address","duration"|"expiry","reason","evidence"} propose a ban
+//	POST   /admin/ban_event/approve {"proposal_id"} sign a pending proposal as this validator
+
+// BanAdminRequest is the body for the ban admin endpoints
+type BanAdminRequest struct {
+	Target   string `json:"target"`
+	Duration string `json:"duration,omitempty"` // Go duration, e.g. "24h"
+	Reason   string `json:"reason,omitempty"`
+	Note     string `json:"note,omitempty"`
+	Actor    string `json:"actor,omitempty"`
+}
+
+// BanEventRequest is the body for POST /admin/ban_event
+type BanEventRequest struct {
+	Address  string `json:"address"`
+	Duration string `json:"duration,omitempty"` // Go duration, e.g. "72h"
+	Expiry   string `json:"expiry,omitempty"`   // RFC3339; used when Duration is empty
+	Reason   string `json:"reason"`
+	Evidence string `json:"evidence"`
+}
+
+func (s *Server) registerBanAdmin() {
+	s.handle(nil, "/admin/bans", adminPolicy, s.handleAdminBans)
+	s.handle(nil, "/admin/unban", adminPolicy, s.handleAdminUnban)
+	s.handle(nil, "/admin/allowlist", adminPolicy, s.handleAdminAllowlist)
+	s.handle(nil, "/admin/ban_audit", adminPolicy, s.handleAdminBanAudit)
+}
+
+// banAdminAuth enforces the API key and the presence of a ban manager
+func (s *Server) banAdminAuth(w http.ResponseWriter, r *http.Request) (*networking.BanManager, bool) {
+	if !requireAPIKey(w, r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if s.network == nil || s.network.Bans == nil {
+		http.Error(w, "ban manager unavailable", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return s.network.Bans, true
+}
+
+func decodeBanAdminRequest(w http.ResponseWriter, r *http.Request) (BanAdminRequest, bool) {
+	var req BanAdminRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Target == "" {
+		http.Error(w, "target is required", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Actor == "" {
+		req.Actor = "api"
+	}
+	return req, true
+}
+
+func writeBanJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleAdminBans(w http.ResponseWriter, r *http.Request) {
+	bans, ok := s.banAdminAuth(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeBanJSON(w, bans.List())
+	case http.MethodPost:
+		req, ok := decodeBanAdminRequest(w, r)
+		if !ok {
+			return
+		}
+		dur, err := time.ParseDuration(req.Duration)
+		if err != nil || dur <= 0 {
+			http.Error(w, "duration must be a positive Go duration (e.g. 24h)", http.StatusBadRequest)
+			return
+		}
+		if err := bans.Ban(req.Target, dur, req.Reason, "admin:"+req.Actor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Printf("[BAN] Admin %s banned %s for %s: %s\n", req.Actor, req.Target, dur, req.Reason)
+		writeBanJSON(w, map[string]interface{}{"target": req.Target, "banned": bans.IsBanned(req.Target)})
+	default:
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAdminUnban(w http.ResponseWriter, r *http.Request) {
+	bans, ok := s.banAdminAuth(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := decodeBanAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	if !bans.Unban(req.Target, req.Reason, "admin:"+req.Actor) {
+		http.Error(w, "target is not banned", http.StatusNotFound)
+		return
+	}
+	fmt.Printf("[BAN] Admin %s unbanned %s: %s\n", req.Actor, req.Target, req.Reason)
+	writeBanJSON(w, map[string]interface{}{"target": req.Target, "unbanned": true})
+}
+
+func (s *Server) handleAdminAllowlist(w http.ResponseWriter, r *http.Request) {
+	bans, ok := s.banAdminAuth(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeBanJSON(w, bans.Allowlist())
+	case http.MethodPost:
+		req, ok := decodeBanAdminRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := bans.Allow(req.Target, req.Note, "admin:"+req.Actor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Printf("[BAN] Admin %s allowlisted %s\n", req.Actor, req.Target)
+		writeBanJSON(w, map[string]interface{}{"target": req.Target, "allowed": true})
+	case http.MethodDelete:
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target is required", http.StatusBadRequest)
+			return
+		}
+		actor := r.URL.Query().Get("actor")
+		if actor == "" {
+			actor = "api"
+		}
+		if !bans.Disallow(target, "admin:"+actor) {
+			http.Error(w, "target is not allowlisted", http.StatusNotFound)
+			return
+		}
+		writeBanJSON(w, map[string]interface{}{"target": target, "allowed": false})
+	default:
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAdminBanAudit(w http.ResponseWriter, r *http.Request) {
+	bans, ok := s.banAdminAuth(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	writeBanJSON(w, bans.Audit(limit))
+}
+
+// handleAdminBanEvent proposes a network-wide ban signed by this validator (POST) or lists proposals (GET)
+func (s *Server) handleAdminBanEvent(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.banAdminAuth(w, r); !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeBanJSON(w, s.network.BanProposals())
+	case http.MethodPost:
+		var req BanEventRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		var expiry time.Time
+		if req.Duration != "" {
+			dur, err := time.ParseDuration(req.Duration)
+			if err != nil || dur <= 0 {
+				http.Error(w, "duration must be a positive Go duration (e.g. 72h)", http.StatusBadRequest)
+				return
+			}
+			expiry = time.Now().Add(dur)
+		} else {
+			var err error
+			if expiry, err = time.Parse(time.RFC3339, req.Expiry); err != nil {
+				http.Error(w, "duration or RFC3339 expiry is required", http.StatusBadRequest)
+				return
+			}
+		}
+		evt, err := s.network.ProposeBan(req.Address, expiry, req.Reason, req.Evidence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		writeBanJSON(w, evt)
+	default:
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminBanApprove adds this validator's signature to a pending ban proposal
+func (s *Server) handleAdminBanApprove(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.banAdminAuth(w, r); !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ProposalID string `json:"proposal_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil || req.ProposalID == "" {
+		http.Error(w, "proposal_id is required", http.StatusBadRequest)
+		return
+	}
+	evt, err := s.network.ApproveBan(req.ProposalID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeBanJSON(w, evt)
+}
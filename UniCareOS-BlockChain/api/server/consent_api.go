@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/types"
+)
+
+// Consent enforcement on reads.
+// Provider tokens name the reader with "sub" (provider) and "org" (organization); patient tokens carry
+// the patient's "did". A reader sees a medical record's metadata and payload reference only if it is the
+// record's patient, holds an active on-chain consent grant covering the record type, and the purpose
+// sent in X-Purpose-Of-Use if there is one, or has an open break-glass access (see emergency_api.go).
+// Consent and break-glass events name the patient, their providers and the reason for access, so only
+// the patient sees them in full. Single-record endpoints answer 403 otherwise; listings
+// redact the event. The operator API key names no grantee, so it reads no record metadata.
+
+// purposeHeader declares the reader's purpose of use, matched against ConsentGrant.Purpose
+const purposeHeader = "X-Purpose-Of-Use"
+
+// recordReader is who a request reads records as
+type recordReader struct {
+	PatientDID string          // Set for patient tokens
+	Grantees   []block.Grantee // Provider and organization of provider tokens
+	Purpose    string
+}
+
+// requestReader identifies the reader of r from its bearer token, if any
+func requestReader(r *http.Request) recordReader {
+	rd := recordReader{Purpose: r.Header.Get(purposeHeader)}
+	claims, err := parseJWT(r)
+	if err != nil {
+		return rd
+	}
+	switch role, _ := claims["role"].(string); role {
+	case string(AudiencePatient):
+		rd.PatientDID, _ = claims["did"].(string)
+	case string(AudienceProvider):
+		if sub, _ := claims["sub"].(string); sub != "" {
+			rd.Grantees = append(rd.Grantees, block.Grantee{Type: block.GranteeProvider, ID: sub})
+		}
+		if org, _ := claims["org"].(string); org != "" {
+			rd.Grantees = append(rd.Grantees, block.Grantee{Type: block.GranteeOrganization, ID: org})
+		}
+	}
+	return rd
+}
+
+// recordAccess decides whether rd may read a record of recordType belonging to patientDID, with the
+// reason for a denial
+func (s *Server) recordAccess(rd recordReader, patientDID, recordType string) (bool, string) {
+	if patientDID == "" {
+		return false, "record names no patient DID to check consent against"
+	}
+	if rd.PatientDID != "" && rd.PatientDID == patientDID {
+		return true, ""
+	}
+	if s.store == nil || len(rd.Grantees) == 0 {
+		return false, "no consent: reader is not a provider or organization the patient can grant"
+	}
+	now := time.Now()
+	if blockchain.FindConsent(s.store, patientDID, rd.Grantees, recordType, rd.Purpose, now) != nil {
+		return true, ""
+	}
+	if rec := s.emergencyAccess(rd, patientDID, now); rec != nil {
+		fmt.Printf("[EMERGENCY] Break-glass read of %s's %s record by %s under access %s\n", patientDID, recordType, rec.Access.ProviderID, rec.Access.AccessID)
+		return true, ""
+	}
+	return false, fmt.Sprintf("no active consent from %s covering %s records", patientDID, recordType)
+}
+
+// canRead reports whether rd may see an event in full. medical_record events are consent-gated; consent
+// and break-glass events are the patient's own; review resolutions name no patient and are read through
+// the compliance API.
+func (s *Server) canRead(rd recordReader, eventType, patientDID, recordType string) bool {
+	switch eventType {
+	case "medical_record":
+		ok, _ := s.recordAccess(rd, patientDID, recordType)
+		return ok
+	case block.ConsentGrantType, block.ConsentRevokeType, block.EmergencyAccessType, block.EmergencyReviewType:
+		return patientDID != "" && rd.PatientDID == patientDID
+	}
+	return true
+}
+
+// canReadSubmission reports whether rd may see a pending mempool payload, gated like the event it
+// becomes. Other payloads are not consent-gated.
+func (s *Server) canReadSubmission(rd recordReader, payload []byte) bool {
+	if p, ok := block.ParseConsentPayload(payload); ok {
+		return s.canRead(rd, p.Type, p.PatientDID(), "")
+	}
+	if a, ok := block.ParseEmergencyAccessPayload(payload); ok {
+		return s.canRead(rd, block.EmergencyAccessType, a.PatientDID, "")
+	}
+	if _, ok := block.ParseEmergencyReviewPayload(payload); ok {
+		return s.canRead(rd, block.EmergencyReviewType, "", "")
+	}
+	var submission block.MedicalRecordSubmission
+	if err := json.Unmarshal(payload, &submission); err != nil || submission.Record == nil {
+		return true
+	}
+	return s.canRead(rd, "medical_record", submission.PatientDID(), submission.RecordType())
+}
+
+// redactEvent strips the record metadata, payload reference and hash, and any consent, break-glass or
+// review transaction from an event
+func redactEvent(evt *block.ChainedEvent) {
+	evt.RecordID, evt.PatientID, evt.ProviderID, evt.RecordType, evt.PayloadRef, evt.PayloadHash = "", "", "", "", "", ""
+	evt.RevisionReason, evt.RevisionOf, evt.DocLineage, evt.Memories = "", "", nil, nil
+	if evt.Consent != nil || evt.EmergencyAccess != nil || evt.EmergencyReview != nil {
+		evt.Description, evt.Consent, evt.EmergencyAccess, evt.EmergencyReview = "", nil, nil, nil
+	}
+}
+
+// redactStoredEvent is redactEvent for events read through storage.GetBlockByHeight
+func redactStoredEvent(evt *types.Event) {
+	evt.RecordID, evt.PatientID, evt.ProviderID, evt.RecordType, evt.PayloadRef, evt.PayloadHash = "", "", "", "", "", ""
+	evt.RevisionReason, evt.RevisionOf, evt.DocLineage, evt.Memories = "", "", nil, nil
+	if evt.Consent != nil || evt.EmergencyAccess != nil || evt.EmergencyReview != nil {
+		evt.Description, evt.Consent, evt.EmergencyAccess, evt.EmergencyReview = "", nil, nil, nil
+	}
+}
+
+// redactBlock redacts the events of blk that rd may not see
+func (s *Server) redactBlock(rd recordReader, blk *block.Block) {
+	for i := range blk.Events {
+		if evt := &blk.Events[i]; !s.canRead(rd, evt.EventType, evt.PatientID, evt.RecordType) {
+			redactEvent(evt)
+		}
+	}
+}
+
+// redactStoredBlock is redactBlock for blocks read through storage.GetBlockByHeight
+func (s *Server) redactStoredBlock(rd recordReader, blk *types.Block) {
+	for i := range blk.Events {
+		if evt := &blk.Events[i]; !s.canRead(rd, evt.EventType, evt.PatientID, evt.RecordType) {
+			redactStoredEvent(evt)
+		}
+	}
+}
+
+// SubmitConsentHandler relays a patient-signed ConsentGrant or ConsentRevoke to the mempool. It takes
+// effect once a block includes it.
+func (s *Server) SubmitConsentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var p block.ConsentPayload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&p); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txID, err := s.network.SubmitConsent(&p)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "duplicate") {
+			status = http.StatusConflict
+		}
+		http.Error(w, "Consent rejected: "+err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"txId":      txID,
+		"consentId": p.ConsentID(),
+		"type":      p.Type,
+		"status":    "pending",
+		"message":   "Consent transaction added to mempool; it takes effect once included in a block",
+	})
+}
+
+// ListConsentsHandler returns a patient's grants with their revocation state. Patients list their own.
+func (s *Server) ListConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	patientDID := r.URL.Query().Get("patientDID")
+	if !requireAPIKey(nil, r) {
+		own := requestReader(r).PatientDID
+		if patientDID == "" {
+			patientDID = own
+		}
+		if own == "" || patientDID != own {
+			http.Error(w, "forbidden: patients list only their own consents", http.StatusForbidden)
+			return
+		}
+	}
+	if patientDID == "" {
+		http.Error(w, "Missing patientDID parameter", http.StatusBadRequest)
+		return
+	}
+	consents := blockchain.PatientConsents(s.store, patientDID)
+	if consents == nil {
+		consents = []*blockchain.ConsentRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// RegisterConsentAPI registers the consent endpoints to the mux
+func RegisterConsentAPI(mux *http.ServeMux, server *Server) {
+	server.handle(mux, "/api/v1/submit-consent", RoutePolicy{Audiences: []Audience{AudiencePatient}, Scopes: []string{ScopeConsentWrite}}, server.SubmitConsentHandler)
+	server.handle(mux, "/api/v1/list-consents", RoutePolicy{Audiences: []Audience{AudiencePatient}, Scopes: []string{ScopeConsentRead}}, server.ListConsentsHandler)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/did"
+	"unicareos/core/mempool"
+	"unicareos/core/storage"
+	"unicareos/core/types"
+)
+
+func TestRecordReadsFollowOnChainConsent(t *testing.T) {
+	oldKey, oldSecret := apiKey, jwtSecret
+	apiKey, jwtSecret = "operator-key", "token-secret"
+	t.Cleanup(func() { apiKey, jwtSecret = oldKey, oldSecret })
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := &Server{store: store, routes: &RouteRegistry{}}
+
+	pub, patient, _ := ed25519.GenerateKey(nil)
+	patientDID := did.FromEd25519(pub)
+	now := time.Now().UTC()
+	grant := &block.ConsentGrant{
+		PatientDID: patientDID,
+		Grantee:    block.Grantee{Type: block.GranteeOrganization, ID: "clinic-a"},
+		Scope:      []string{"lab_result"},
+		Purpose:    "treatment",
+		Expiry:     now.Add(time.Hour),
+		Timestamp:  now,
+	}
+	if err := grant.Sign(patient); err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.ApplyConsent(store, &block.ConsentPayload{Type: block.ConsentGrantType, Grant: grant}, "ab12", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := func(claims jwt.MapClaims, purpose string) recordReader {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/get-lineage", nil)
+		if claims != nil {
+			r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", claims))
+		} else {
+			r.Header.Set("X-API-Key", "operator-key")
+		}
+		if purpose != "" {
+			r.Header.Set(purposeHeader, purpose)
+		}
+		return requestReader(r)
+	}
+	clinicA := reader(jwt.MapClaims{"role": "provider", "sub": "dr-1", "org": "clinic-a"}, "treatment")
+	cases := []struct {
+		name       string
+		rd         recordReader
+		recordType string
+		want       bool
+	}{
+		{"granted organization", clinicA, "lab_result", true},
+		{"granted organization, no purpose stated", reader(jwt.MapClaims{"role": "provider", "org": "clinic-a"}, ""), "lab_result", true},
+		{"record type outside scope", clinicA, "imaging", false},
+		{"other purpose", reader(jwt.MapClaims{"role": "provider", "org": "clinic-a"}, "research"), "lab_result", false},
+		{"other organization", reader(jwt.MapClaims{"role": "provider", "sub": "dr-2", "org": "clinic-b"}, "treatment"), "lab_result", false},
+		{"the patient", reader(jwt.MapClaims{"role": "patient", "did": patientDID}, ""), "imaging", true},
+		{"another patient", reader(jwt.MapClaims{"role": "patient", "did": "did:key:z6Mkother"}, ""), "lab_result", false},
+		{"operator API key", reader(nil, "treatment"), "lab_result", false},
+	}
+	for _, tc := range cases {
+		if got, reason := s.recordAccess(tc.rd, patientDID, tc.recordType); got != tc.want {
+			t.Errorf("%s: access %v (%s), want %v", tc.name, got, reason, tc.want)
+		}
+	}
+
+	blk := types.Block{Events: []types.Event{
+		{EventType: "medical_record", PatientID: patientDID, RecordType: "lab_result", PayloadRef: "payload-1", PayloadHash: "hash-1"},
+		{EventType: "medical_record", PatientID: patientDID, RecordType: "imaging", PayloadRef: "payload-2", PayloadHash: "hash-2"},
+		{EventType: "memory", Description: "note"},
+		{EventType: block.ConsentGrantType, PatientID: patientDID, Description: "Consent grant " + grant.ConsentID, Consent: []byte(`{}`)},
+		{EventType: block.EmergencyAccessType, PatientID: patientDID, ProviderID: "dr-9", Description: "Emergency access: overdose", EmergencyAccess: []byte(`{}`)},
+	}}
+	s.redactStoredBlock(clinicA, &blk)
+	if blk.Events[0].PayloadRef != "payload-1" || blk.Events[1].PayloadRef != "" || blk.Events[1].PayloadHash != "" || blk.Events[1].PatientID != "" || blk.Events[2].Description != "note" {
+		t.Errorf("block not redacted to the consented records: %+v", blk.Events)
+	}
+	for _, evt := range blk.Events[3:] {
+		if evt.PatientID != "" || evt.ProviderID != "" || evt.Description != "" || evt.Consent != nil || evt.EmergencyAccess != nil {
+			t.Errorf("%s event shown to a provider: %+v", evt.EventType, evt)
+		}
+	}
+	own := types.Block{Events: []types.Event{{EventType: block.ConsentGrantType, PatientID: patientDID, Consent: []byte(`{}`)}}}
+	s.redactStoredBlock(reader(jwt.MapClaims{"role": "patient", "did": patientDID}, ""), &own)
+	if own.Events[0].Consent == nil {
+		t.Error("consent event redacted for its patient")
+	}
+
+	// Pending consent transactions and expired record submissions are gated like their events
+	consentTx, _ := json.Marshal(&block.ConsentPayload{Type: block.ConsentGrantType, Grant: grant})
+	if s.canReadSubmission(clinicA, consentTx) {
+		t.Error("pending consent grant shown to a provider")
+	}
+	pool := mempool.NewMempool(10)
+	s.gossipEngine = mempool.NewGossipEngine(nil, pool)
+	for i, recordType := range []string{"lab_result", "imaging"} {
+		payload, _ := json.Marshal(block.MedicalRecordSubmission{Record: map[string]interface{}{"patientDID": patientDID, "recordType": recordType}})
+		pool.ExpiredPool.AddExpiredTx(mempool.ExpiredTx{TxID: fmt.Sprintf("expired-%d", i), Payload: payload})
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/expired-medical-records", nil)
+	r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", jwt.MapClaims{"role": "provider", "sub": "dr-1", "org": "clinic-a"}))
+	r.Header.Set(purposeHeader, "treatment")
+	w := httptest.NewRecorder()
+	s.ListExpiredMedicalRecordsHandler(w, r)
+	var expired []mempool.ExpiredTx
+	if err := json.NewDecoder(w.Body).Decode(&expired); err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].TxID != "expired-0" {
+		t.Errorf("expired records not filtered to the consented record: %+v", expired)
+	}
+
+	revoke := &block.ConsentRevoke{ConsentID: grant.ConsentID, PatientDID: patientDID, Timestamp: now}
+	if err := revoke.Sign(patient); err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.ApplyConsent(store, &block.ConsentPayload{Type: block.ConsentRevokeType, Revoke: revoke}, "cd34", 4); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.recordAccess(clinicA, patientDID, "lab_result"); ok {
+		t.Error("revoked consent still grants access")
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 // RegisterDevTxInspectAPI registers the dev-only transaction inspection endpoint.
 func RegisterDevTxInspectAPI(mux *http.ServeMux, s *Server) {
-	mux.HandleFunc("/dev/inspect_tx", s.handleDevInspectTx)
+	s.handle(mux, "/dev/inspect_tx", adminPolicy, s.handleDevInspectTx)
 }
 
 // handleDevInspectTx returns the decoded transaction contents for a given txID (dev only)
@@ -29,10 +29,15 @@ func (s *Server) handleDevInspectTx(w http.ResponseWriter, r *http.Request) {
 	}
 	// Search mempool and blocks for the txID
 	found = false
+	rd := requestReader(r)
 	// 1. Search mempool
 	if s.gossipEngine != nil {
 		tx, ok := s.gossipEngine.Mempool.GetTx(txID)
 		if ok {
+			if !s.canReadSubmission(rd, tx.Payload) {
+				http.Error(w, "forbidden: no consent to read this record", http.StatusForbidden)
+				return
+			}
 			txPayload = tx.Payload
 			found = true
 		}
@@ -47,6 +52,9 @@ func (s *Server) handleDevInspectTx(w http.ResponseWriter, r *http.Request) {
 				// Search blk.Events for event with matching EventID as txID
 				for _, evt := range blk.Events {
 					if strings.EqualFold(evt.EventID.String(), txID) {
+						if !s.canRead(rd, evt.EventType, evt.PatientID, evt.RecordType) {
+							redactStoredEvent(&evt)
+						}
 						txPayload, _ = json.Marshal(evt)
 						found = true
 						break
@@ -72,6 +80,9 @@ func (s *Server) handleDevInspectTx(w http.ResponseWriter, r *http.Request) {
 					for _, evt := range blk.Events {
 						if strings.EqualFold(evt.EventID.String(), txID) {
 							txPayload = []byte{} // clear txPayload
+							if !s.canRead(rd, evt.EventType, evt.PatientID, evt.RecordType) {
+								redactStoredEvent(&evt)
+							}
 							txPayload, _ = json.Marshal(evt)
 							break
 						}
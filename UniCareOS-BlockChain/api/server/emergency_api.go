@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+)
+
+// Break-glass emergency access.
+// A clinician whose provider ID is listed in EMERGENCY_CLINICIANS submits an EmergencyAccess signed with
+// their DID key. Once a block includes it, recordAccess lets that provider read the patient's records
+// until it expires, regardless of consent. Every access opens a review that a compliance officer listed in
+// COMPLIANCE_REVIEWERS closes on chain with a signed resolution posted to /api/v1/emergency-reviews/resolve;
+// overdue reviews are escalated by blockchain.ReviewEscalator.
+
+// emergencyAccess returns the open break-glass access letting rd read the patient's records at t, or nil
+func (s *Server) emergencyAccess(rd recordReader, patientDID string, t time.Time) *blockchain.EmergencyAccessRecord {
+	if s.store == nil {
+		return nil
+	}
+	for _, g := range rd.Grantees {
+		if g.Type != block.GranteeProvider {
+			continue
+		}
+		if rec := blockchain.FindEmergencyAccess(s.store, patientDID, g.ID, t); rec != nil {
+			return rec
+		}
+	}
+	return nil
+}
+
+// SubmitEmergencyAccessHandler relays a clinician-signed break-glass request to the mempool. Providers
+// submit their own; access opens once a block includes it.
+func (s *Server) SubmitEmergencyAccessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var a block.EmergencyAccess
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&a); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !requireAPIKey(nil, r) {
+		own := false
+		for _, g := range requestReader(r).Grantees {
+			own = own || (g.Type == block.GranteeProvider && g.ID == a.ProviderID)
+		}
+		if !own {
+			http.Error(w, "forbidden: clinicians break glass only as themselves", http.StatusForbidden)
+			return
+		}
+	}
+	txID, err := s.network.SubmitEmergencyAccess(&a)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case strings.HasPrefix(err.Error(), "duplicate"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "not authorized"):
+			status = http.StatusForbidden
+		}
+		http.Error(w, "Emergency access rejected: "+err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"txId":     txID,
+		"accessId": a.AccessID,
+		"expiry":   a.Expiry,
+		"status":   "pending",
+		"message":  "Emergency access added to mempool; it opens once included in a block and will be reviewed by compliance",
+	})
+}
+
+// ListEmergencyReviewsHandler returns break-glass accesses with their reviews: pending ones by default,
+// every one with status=all, optionally for one patientDID.
+func (s *Server) ListEmergencyReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var recs []*blockchain.EmergencyAccessRecord
+	switch {
+	case q.Get("patientDID") != "":
+		recs = blockchain.PatientEmergencyAccesses(s.store, q.Get("patientDID"))
+	case q.Get("status") == "all":
+		recs = blockchain.ListEmergencyAccesses(s.store)
+	default:
+		recs = blockchain.PendingEmergencyReviews(s.store)
+	}
+	out := []*blockchain.EmergencyAccessRecord{}
+	for _, rec := range recs {
+		if status := q.Get("status"); status == "" || status == "all" || status == rec.Review.Status {
+			out = append(out, rec)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// ResolveEmergencyReviewHandler relays a compliance officer's signed EmergencyReviewResolution to the
+// mempool; the review closes once a block includes it. Officers resolve reviews only as themselves.
+func (s *Server) ResolveEmergencyReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var res block.EmergencyReviewResolution
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&res); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if claims, err := parseJWT(r); err == nil {
+		if sub, _ := claims["sub"].(string); sub == "" || sub != res.Reviewer {
+			http.Error(w, "forbidden: compliance officers resolve reviews only as themselves", http.StatusForbidden)
+			return
+		}
+	}
+	txID, err := s.network.SubmitEmergencyReview(&res)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, blockchain.ErrEmergencyAccessUnknown):
+			status = http.StatusNotFound
+		case errors.Is(err, blockchain.ErrEmergencyReviewClosed), strings.HasPrefix(err.Error(), "duplicate"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "not authorized"):
+			status = http.StatusForbidden
+		}
+		http.Error(w, "Review rejected: "+err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"txId":     txID,
+		"accessId": res.AccessID,
+		"outcome":  res.Outcome,
+		"status":   "pending",
+		"message":  "Review resolution added to mempool; the review closes once it is included in a block",
+	})
+}
+
+// RegisterEmergencyAPI registers the break-glass and compliance review endpoints to the mux
+func RegisterEmergencyAPI(mux *http.ServeMux, server *Server) {
+	review := RoutePolicy{Audiences: []Audience{AudienceCompliance}, Scopes: []string{ScopeEmergencyReview}}
+	server.handle(mux, "/api/v1/emergency-access", RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeEmergencyAccess}}, server.SubmitEmergencyAccessHandler)
+	server.handle(mux, "/api/v1/emergency-reviews", review, server.ListEmergencyReviewsHandler)
+	server.handle(mux, "/api/v1/emergency-reviews/resolve", review, server.ResolveEmergencyReviewHandler)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/did"
+	"unicareos/core/mempool"
+	"unicareos/core/networking"
+	"unicareos/core/storage"
+)
+
+func TestBreakGlassAccessAndComplianceReview(t *testing.T) {
+	oldKey, oldSecret := apiKey, jwtSecret
+	apiKey, jwtSecret = "operator-key", "token-secret"
+	t.Cleanup(func() { apiKey, jwtSecret = oldKey, oldSecret })
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := &Server{store: store, routes: &RouteRegistry{}}
+
+	_, clinician, _ := ed25519.GenerateKey(nil)
+	now := time.Now().UTC()
+	a := &block.EmergencyAccess{
+		PatientDID:   "did:key:z6Mkpatient",
+		ProviderID:   "dr-1",
+		ClinicianDID: did.FromEd25519(clinician.Public().(ed25519.PublicKey)),
+		Reason:       "anaphylaxis, patient unresponsive",
+		Expiry:       now.Add(time.Hour),
+		Timestamp:    now,
+	}
+	if err := a.Sign(clinician); err != nil {
+		t.Fatal(err)
+	}
+	dr1 := recordReader{Grantees: []block.Grantee{{Type: block.GranteeProvider, ID: "dr-1"}, {Type: block.GranteeOrganization, ID: "er"}}}
+	if ok, _ := s.recordAccess(dr1, a.PatientDID, "lab_result"); ok {
+		t.Fatal("record readable without consent or break-glass access")
+	}
+	if err := blockchain.ApplyEmergencyAccess(store, a, "ab12", 5, now); err != nil {
+		t.Fatal(err)
+	}
+	if ok, reason := s.recordAccess(dr1, a.PatientDID, "lab_result"); !ok {
+		t.Errorf("break-glass access does not open the records: %s", reason)
+	}
+	if ok, _ := s.recordAccess(recordReader{Grantees: []block.Grantee{{Type: block.GranteeOrganization, ID: "dr-1"}}}, a.PatientDID, "lab_result"); ok {
+		t.Error("break-glass access opened to an organization named like the clinician")
+	}
+	if ok, _ := s.recordAccess(dr1, "did:key:z6Mkother", "lab_result"); ok {
+		t.Error("break-glass access opened another patient's records")
+	}
+
+	review := RoutePolicy{Audiences: []Audience{AudienceCompliance}, Scopes: []string{ScopeEmergencyReview}}
+	resolve := func(claims jwt.MapClaims, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/emergency-reviews/resolve", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", claims))
+		rec := httptest.NewRecorder()
+		s.enforce("/api/v1/emergency-reviews/resolve", review, s.ResolveEmergencyReviewHandler)(rec, r)
+		return rec
+	}
+	_, officer, _ := ed25519.GenerateKey(nil)
+	n := networking.NewNetwork("", store, 0, nil, nil, nil, 0)
+	n.Mempool = mempool.NewMempool(10)
+	n.ComplianceReviewers = map[string]string{"officer-1": did.FromEd25519(officer.Public().(ed25519.PublicKey))}
+	s.network = n
+	resolution := func(accessID string) string {
+		r := &block.EmergencyReviewResolution{AccessID: accessID, Outcome: blockchain.ReviewJustified, Notes: "confirmed with ER lead", Reviewer: "officer-1", ReviewerDID: n.ComplianceReviewers["officer-1"], Timestamp: now}
+		if err := r.Sign(officer); err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(r)
+		return string(body)
+	}
+	body := resolution(a.AccessID)
+	if rec := resolve(jwt.MapClaims{"role": "provider", "sub": "dr-1", "scope": ScopeEmergencyReview}, body); rec.Code != http.StatusForbidden {
+		t.Errorf("provider resolved a review: status %d", rec.Code)
+	}
+	officerClaims := jwt.MapClaims{"role": "compliance", "sub": "officer-1", "scope": ScopeEmergencyReview}
+	if rec := resolve(jwt.MapClaims{"role": "compliance", "sub": "officer-2", "scope": ScopeEmergencyReview}, body); rec.Code != http.StatusForbidden {
+		t.Errorf("review relayed for another officer: status %d", rec.Code)
+	}
+	if rec := resolve(officerClaims, resolution("missing")); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown access: status %d", rec.Code)
+	}
+	if rec := resolve(officerClaims, body); rec.Code != http.StatusOK {
+		t.Fatalf("compliance review not relayed: %d %s", rec.Code, rec.Body)
+	}
+	if got, _ := blockchain.GetEmergencyAccess(store, a.AccessID); got.Review.Status != blockchain.ReviewPending {
+		t.Errorf("review closed before a block included it: %+v", got.Review)
+	}
+	if rec := resolve(officerClaims, body); rec.Code != http.StatusConflict {
+		t.Errorf("resolution relayed twice: status %d", rec.Code)
+	}
+}
@@ -2,18 +2,21 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"unicareos/core/blockchain"
+	"unicareos/core/types"
 )
 
 // EpochEventResponse defines the JSON structure for /epochs/{N}
 type EpochEventResponse struct {
-	Epoch      uint64   `json:"epoch"`
-	MerkleRoot string   `json:"merkle_root"`
-	EventCount int      `json:"event_count"`
-	Hashes     []string `json:"hashes,omitempty"`
+	Epoch        uint64                 `json:"epoch"`
+	MerkleRoot   string                 `json:"merkle_root"`
+	EventCount   int                    `json:"event_count"`
+	Hashes       []string               `json:"hashes,omitempty"`
+	Finalization *types.FinalizeEpochTx `json:"finalization,omitempty"` // On-chain quorum finalization, once included in a block
 }
 
 // HandleEpochEvent returns the Merkle root and event info for a given epoch
@@ -30,6 +33,17 @@ func (s *Server) HandleEpochEvent(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid epoch number", http.StatusBadRequest)
 		return
 	}
+	switch {
+	case len(parts) == 5 && parts[3] == "proof" && parts[4] != "":
+		s.handleEpochProof(w, epoch, parts[4]) // /epochs/{N}/proof/{eventID}
+		return
+	case len(parts) == 4 && parts[3] == "anchors":
+		s.handleEpochAnchors(w, epoch) // /epochs/{N}/anchors
+		return
+	case len(parts) > 3:
+		http.NotFound(w, r)
+		return
+	}
 	// Compute Merkle root and event hashes
 	hashes, err := blockchain.GatherFinalizedEventHashesForEpoch(epoch, s.store)
 	if err != nil {
@@ -50,6 +64,39 @@ func (s *Server) HandleEpochEvent(w http.ResponseWriter, r *http.Request) {
 		EventCount: len(hashes),
 		Hashes:     hashes, // Remove if you want to hide hashes from API
 	}
+	if fin, err := blockchain.GetEpochFinalization(s.store, epoch); err == nil {
+		resp.Finalization = fin
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// handleEpochProof returns the Merkle inclusion proof of one finalized event in an epoch
+func (s *Server) handleEpochProof(w http.ResponseWriter, epoch uint64, eventID string) {
+	proof, err := blockchain.BuildEpochProof(s.store, epoch, eventID)
+	if errors.Is(err, blockchain.ErrEventNotInEpoch) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to build proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
+// handleEpochAnchors re-verifies and returns the external timestamps of an epoch's finalized root
+func (s *Server) handleEpochAnchors(w http.ResponseWriter, epoch uint64) {
+	if s.Anchorer == nil {
+		http.Error(w, "External anchoring is not configured on this node", http.StatusNotFound)
+		return
+	}
+	anchors, err := s.Anchorer.Verify(epoch)
+	if err != nil {
+		http.Error(w, "Failed to read anchors: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"epoch": epoch, "providers": s.Anchorer.Providers(), "anchors": anchors})
+}
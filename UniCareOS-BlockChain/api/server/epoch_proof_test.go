@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/storage"
+	"unicareos/core/types"
+	"unicareos/types/ids"
+)
+
+// finalizedEpochStore stores two epoch-0 blocks carrying five finalized events and the epoch's
+// finalization signed by finalizers
+func finalizedEpochStore(t *testing.T, finalizers []ed25519.PrivateKey) (*storage.Storage, []string) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	var eventIDs []string
+	for h, count := range []int{3, 2} {
+		b := block.Block{Height: uint64(h + 1), Timestamp: time.Unix(1700000000, 0).UTC()}
+		for i := 0; i < count; i++ {
+			tx := &block.FinalizeEventTx{
+				TxID:      fmt.Sprintf("finalize-%d-%d", h, i),
+				EventID:   ids.IDFromString(fmt.Sprintf("record-%d-%d", h, i)).String(),
+				Timestamp: time.Unix(int64(1700000000+10*h+i), 0).UTC(),
+				Status:    block.FinalizationStatusFinalized,
+			}
+			evt := block.FinalizationEvent(tx)
+			eventIDs = append(eventIDs, evt.EventID.String())
+			b.Events = append(b.Events, evt)
+		}
+		b.Events = append(b.Events, block.ChainedEvent{EventID: ids.IDFromString(fmt.Sprintf("memory-%d", h)), EventType: "memory"})
+		b.BlockID = b.ComputeID()
+		data, _ := json.Marshal(b)
+		if err := store.SaveBlock(b.BlockID[:], data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := blockchain.ComputeEpochMerkleRoot(0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewFinalizeEpochTx(0, root)
+	for _, f := range finalizers {
+		blockchain.SignEpochFinalization(tx, f)
+	}
+	tx.Status, tx.IncludedIn = string(block.FinalizationStatusFinalized), "ab12"
+	if err := blockchain.SaveEpochFinalization(store, tx); err != nil {
+		t.Fatal(err)
+	}
+	return store, eventIDs
+}
+
+func TestEpochProofLeadsEveryEventToTheSignedRoot(t *testing.T) {
+	var finalizers []ed25519.PrivateKey
+	var keys []string
+	for i := 0; i < 3; i++ {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		finalizers = append(finalizers, priv)
+		keys = append(keys, base64.StdEncoding.EncodeToString(pub))
+	}
+	store, eventIDs := finalizedEpochStore(t, finalizers)
+	s := &Server{store: store, routes: &RouteRegistry{}}
+
+	for _, id := range eventIDs {
+		rec := httptest.NewRecorder()
+		s.HandleEpochEvent(rec, httptest.NewRequest(http.MethodGet, "/epochs/0/proof/"+id, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("proof for %s: status %d: %s", id, rec.Code, rec.Body.String())
+		}
+		var p blockchain.EpochProof
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(p.Event)
+		if hex.EncodeToString(sum[:]) != p.LeafHash || p.EventID != id || p.LeafCount != 5 {
+			t.Errorf("proof for %s: leaf %s, event %s, %d leaves", id, p.LeafHash, p.EventID, p.LeafCount)
+		}
+		if !block.VerifyMerkleProof(p.LeafHash, p.Path, p.Root) {
+			t.Errorf("proof for %s does not reach root %s", id, p.Root)
+		}
+		if p.Finalization == nil || p.Finalization.EpochSummaryHash != p.Root {
+			t.Fatalf("proof for %s lacks the finalization of its root: %+v", id, p.Finalization)
+		}
+		if status, _ := blockchain.VerifyEpochFinalization(store, &types.FinalizeEpochTx{TxID: p.Finalization.TxID, EpochNumber: 0, EpochSummaryHash: p.Root, Signatures: p.Finalization.Signatures}, keys, 3); status != block.FinalizationStatusDuplicate {
+			t.Errorf("finalization in the proof is not the recorded one: %s", status)
+		}
+		if len(blockchain.ValidFinalizerSignatures(p.Finalization, keys)) != 3 {
+			t.Error("proof finalization lost signatures")
+		}
+	}
+
+	for path, want := range map[string]int{
+		"/epochs/0/proof/" + ids.IDFromString("memory-0").String(): http.StatusNotFound,
+		"/epochs/1/proof/" + eventIDs[0]:                           http.StatusNotFound,
+		"/epochs/0/proof/":                                         http.StatusNotFound,
+		"/epochs/0/hashes":                                         http.StatusNotFound,
+		"/epochs/0/anchors":                                        http.StatusNotFound, // Anchoring not configured
+		"/epochs/0":                                                http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		s.HandleEpochEvent(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
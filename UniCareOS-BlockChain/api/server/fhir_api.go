@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/fhir"
+	"unicareos/core/ingest"
+	"unicareos/core/mempool"
+	"unicareos/core/networking"
+	"unicareos/core/storage"
+)
+
+// FHIR R4 ingestion.
+// EHRs POST DiagnosticReport, Observation, ImagingStudy and DocumentReference resources to
+// /fhir/r4/{resourceType}, or a transaction Bundle of them to /fhir/r4. Each resource is mapped onto a
+// medical record, its body moved to the encrypted payload store, and the record signed with the facility
+// wallet and submitted through the mempool. Errors are returned as OperationOutcomes.
+// GET /fhir/r4/Patient/{did}/$everything exports the latest revision of each of the patient's records the
+// reader may see as a Bundle.
+
+const fhirBase = "/fhir/r4"
+
+// fhirEverything is the patient export operation
+const fhirEverything = "$everything"
+
+// maxFHIRBody bounds a posted resource or Bundle
+const maxFHIRBody = 8 << 20
+
+// writeFHIR writes a FHIR resource
+func writeFHIR(w http.ResponseWriter, status int, resource interface{}) {
+	w.Header().Set("Content-Type", fhir.ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// fhirError writes an OperationOutcome with a single error issue
+func fhirError(w http.ResponseWriter, status int, code, diagnostics string) {
+	writeFHIR(w, status, fhir.NewOperationOutcome(fhir.SeverityError, code, diagnostics))
+}
+
+// writeFHIRError writes err as an OperationOutcome: validation failures with their issues, others as
+// status with code
+func writeFHIRError(w http.ResponseWriter, err error, status int, code string) {
+	var ferr *fhir.Error
+	if errors.As(err, &ferr) {
+		writeFHIR(w, http.StatusUnprocessableEntity, ferr.Outcome())
+		return
+	}
+	fhirError(w, status, code, err.Error())
+}
+
+// FHIRHandler serves the FHIR R4 base: transaction Bundles at the base, single resources by type
+func (s *Server) FHIRHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fhirError(w, http.StatusMethodNotAllowed, fhir.IssueNotSupported, r.Method+" is not supported on "+r.URL.Path)
+		return
+	}
+	if s.Facility == nil || s.network == nil {
+		fhirError(w, http.StatusServiceUnavailable, fhir.IssueTransient, "FHIR ingestion is not configured on this node (no facility wallet)")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFHIRBody))
+	if err != nil {
+		fhirError(w, http.StatusRequestEntityTooLarge, fhir.IssueStructure, err.Error())
+		return
+	}
+	resourceType := strings.Trim(strings.TrimPrefix(r.URL.Path, fhirBase), "/")
+	if resourceType == "" {
+		s.ingestFHIRTransaction(w, body)
+		return
+	}
+	if strings.Contains(resourceType, "/") {
+		fhirError(w, http.StatusNotFound, fhir.IssueNotSupported, "unknown FHIR interaction "+r.URL.Path)
+		return
+	}
+	doc, err := fhir.ParseResource(body)
+	if err != nil {
+		writeFHIRError(w, err, http.StatusBadRequest, fhir.IssueStructure)
+		return
+	}
+	if posted := fhirResourceType(doc); posted != resourceType {
+		fhirError(w, http.StatusBadRequest, fhir.IssueInvalid, fmt.Sprintf("resource posted to %s is a %s", r.URL.Path, posted))
+		return
+	}
+	subs, err := s.prepareFHIR([]ingest.Document{doc})
+	if err != nil {
+		writeFHIRError(w, err, http.StatusUnprocessableEntity, fhir.IssueInvalid)
+		return
+	}
+	resp, err := s.submitFHIR(doc, subs[0])
+	if err != nil {
+		status, code := fhirSubmitStatus(err)
+		fhirError(w, status, code, err.Error())
+		return
+	}
+	w.Header().Set("Location", resp.Location)
+	writeFHIR(w, http.StatusCreated, resp.Outcome)
+}
+
+// ingestFHIRTransaction ingests every entry of a transaction Bundle, or none when any is invalid or refused
+func (s *Server) ingestFHIRTransaction(w http.ResponseWriter, body []byte) {
+	docs, err := fhir.ParseTransaction(body)
+	if err != nil {
+		writeFHIRError(w, err, http.StatusBadRequest, fhir.IssueStructure)
+		return
+	}
+	subs, err := s.prepareFHIR(docs)
+	if err != nil {
+		writeFHIRError(w, err, http.StatusUnprocessableEntity, fhir.IssueInvalid)
+		return
+	}
+	recs, failed, err := s.network.SubmitMedicalRecords(subs)
+	if err != nil {
+		// No entry reached the mempool, so none of the stored payloads is referenced
+		discardPayloads(s.store, subs)
+		status, code := fhirSubmitStatus(err)
+		if failed < 0 {
+			fhirError(w, status, code, fmt.Sprintf("Bundle not submitted: %v", err))
+			return
+		}
+		oo := fhir.NewOperationOutcome(fhir.SeverityError, code, fmt.Sprintf("Bundle.entry[%d] refused: %v; no entry was submitted", failed, err))
+		oo.Issue[0].Expression = []string{fmt.Sprintf("Bundle.entry[%d]", failed)}
+		writeFHIR(w, status, oo)
+		return
+	}
+	out := fhir.BundleResource{ResourceType: fhir.Bundle, Type: "transaction-response"}
+	for i, doc := range docs {
+		out.Entry = append(out.Entry, fhir.BundleEntry{Response: fhirEntryResponse(doc, subs[i], recs[i])})
+	}
+	writeFHIR(w, http.StatusOK, out)
+}
+
+// prepareFHIR stores and signs the records of docs, discarding all stored payloads if any fails
+func (s *Server) prepareFHIR(docs []ingest.Document) ([]block.MedicalRecordSubmission, error) {
+	now := time.Now()
+	subs := make([]block.MedicalRecordSubmission, 0, len(docs))
+	for i, doc := range docs {
+		sub, err := ingest.Prepare(s.store, s.Facility, doc, now)
+		if err != nil {
+			discardPayloads(s.store, subs)
+			if len(docs) > 1 {
+				return nil, fmt.Errorf("Bundle.entry[%d]: %w", i, err)
+			}
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// discardPayloads deletes the payloads stored for prepared records that were not submitted
+func discardPayloads(store *storage.Storage, subs []block.MedicalRecordSubmission) {
+	for _, sub := range subs {
+		if err := store.DeletePayload(sub.DocHash()); err != nil {
+			fmt.Printf("[FHIR] Failed to delete the payload of unsubmitted record %s: %v\n", sub.RecordID(), err)
+		}
+	}
+}
+
+// submitFHIR submits a prepared record and describes the result as a Bundle entry response
+func (s *Server) submitFHIR(doc ingest.Document, sub block.MedicalRecordSubmission) (*fhir.BundleEntryResponse, error) {
+	txID, eventID, err := s.network.SubmitMedicalRecord(sub)
+	if err != nil {
+		return nil, err
+	}
+	return fhirEntryResponse(doc, sub, networking.SubmittedRecord{TxID: txID, EventID: eventID}), nil
+}
+
+// fhirEntryResponse describes a submitted record as a Bundle entry response
+func fhirEntryResponse(doc ingest.Document, sub block.MedicalRecordSubmission, rec networking.SubmittedRecord) *fhir.BundleEntryResponse {
+	recordID := sub.RecordID()
+	fmt.Printf("[FHIR] %s ingested as %s record %s (tx %s, event %s)\n", doc.Key, doc.RecordType, recordID, rec.TxID, rec.EventID)
+	msg := fmt.Sprintf("record %s submitted as transaction %s; event %s is pending inclusion in a block", recordID, rec.TxID, rec.EventID)
+	return &fhir.BundleEntryResponse{
+		Status:   "201 Created",
+		Location: fhirResourceType(doc) + "/" + recordID,
+		Outcome:  fhir.NewOperationOutcome(fhir.SeverityInformation, fhir.IssueInformational, msg),
+	}
+}
+
+// fhirResourceType returns the type of the resource a document was mapped from
+func fhirResourceType(doc ingest.Document) string {
+	return strings.SplitN(doc.Key, "/", 2)[0]
+}
+
+// fhirSubmitStatus maps a mempool rejection to an HTTP status and issue code
+func fhirSubmitStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, storage.ErrPayloadNotOwned):
+		return http.StatusForbidden, fhir.IssueForbidden
+	case strings.HasPrefix(err.Error(), "duplicate"):
+		return http.StatusConflict, fhir.IssueDuplicate
+	case strings.HasPrefix(err.Error(), "no mempool"), strings.HasPrefix(err.Error(), string(mempool.ErrorClassRetryable)):
+		return http.StatusServiceUnavailable, fhir.IssueTransient
+	}
+	return http.StatusInternalServerError, fhir.IssueException
+}
+
+// PatientEverythingHandler exports a patient's records: the latest revision of each, with its decrypted
+// payload and a Provenance naming its block and event. Records the reader has no consent for are omitted.
+func (s *Server) PatientEverythingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fhirError(w, http.StatusMethodNotAllowed, fhir.IssueNotSupported, r.Method+" is not supported on "+r.URL.Path)
+		return
+	}
+	did, op, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, fhirBase+"/Patient/"), "/")
+	if did == "" || op != fhirEverything {
+		fhirError(w, http.StatusNotFound, fhir.IssueNotSupported, "unknown FHIR interaction "+r.URL.Path)
+		return
+	}
+	if s.store == nil {
+		fhirError(w, http.StatusServiceUnavailable, fhir.IssueTransient, "storage not available")
+		return
+	}
+	events, err := blockchain.PatientRecordEvents(s.store, did)
+	if err != nil {
+		fhirError(w, http.StatusInternalServerError, fhir.IssueException, "failed to read the patient record index: "+err.Error())
+		return
+	}
+	rd := requestReader(r)
+	var records []fhir.ExportRecord
+	omitted := 0
+	for _, re := range blockchain.LatestRevisions(events) {
+		evt := re.Event
+		if ok, reason := s.recordAccess(rd, did, evt.RecordType); !ok {
+			fmt.Printf("[CONSENT] Omitting %s record %s from the export of %s: %s\n", evt.RecordType, evt.RecordID, did, reason)
+			omitted++
+			continue
+		}
+		rec := fhir.ExportRecord{RecordEvent: re}
+		if evt.PayloadHash != "" && s.store.HasPayload(evt.PayloadHash) {
+			owner := storage.PayloadOwner{PatientDID: evt.PatientID, RecordID: evt.RecordID}
+			if rec.Payload, err = s.store.GetPayload(evt.PayloadHash, owner); err != nil {
+				fmt.Printf("[FHIR] Exporting record %s without its payload: %v\n", evt.RecordID, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	bundle, err := fhir.Everything(did, records, omitted)
+	if err != nil {
+		fhirError(w, http.StatusInternalServerError, fhir.IssueException, err.Error())
+		return
+	}
+	fmt.Printf("[FHIR] Exported %d record(s) of %s (%d omitted)\n", len(records), did, omitted)
+	writeFHIR(w, http.StatusOK, bundle)
+}
+
+// RegisterFHIRAPI registers the FHIR R4 endpoints to the mux
+func RegisterFHIRAPI(mux *http.ServeMux, server *Server) {
+	write := RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsWrite}}
+	server.handle(mux, fhirBase, write, server.FHIRHandler)
+	server.handle(mux, fhirBase+"/", write, server.FHIRHandler)
+	server.handle(mux, fhirBase+"/Patient/", RoutePolicy{Audiences: []Audience{AudienceProvider, AudiencePatient}, Scopes: []string{ScopeRecordsRead}}, server.PatientEverythingHandler)
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"unicareos/core"
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/fhir"
+	"unicareos/core/ingest"
+	"unicareos/core/mempool"
+	"unicareos/core/networking"
+	"unicareos/core/storage"
+	"unicareos/types/ids"
+)
+
+func TestFHIRTransactionIngestion(t *testing.T) {
+	oldSecret := jwtSecret
+	jwtSecret = "token-secret"
+	t.Cleanup(func() { jwtSecret = oldSecret })
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	schema, _ := filepath.Abs("../../core/validation/schemas/medical_record_schema_v1.json")
+	t.Setenv("MEDICAL_SCHEMA_PATH", schema)
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pool := mempool.NewMempool(10)
+	s := &Server{
+		store:    store,
+		network:  &networking.Network{Mempool: pool},
+		routes:   &RouteRegistry{},
+		Facility: &ingest.Facility{ProviderID: "st-mary-lab", Wallet: core.Wallet{Address: "st_mary_wallet", PublicKey: pub, PrivateKey: priv, Algorithm: "Ed25519"}},
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", jwt.MapClaims{"role": "provider", "sub": "st-mary-lab", "scope": ScopeRecordsWrite}))
+		rec := httptest.NewRecorder()
+		s.enforce(fhirBase+"/", RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsWrite}}, s.FHIRHandler)(rec, r)
+		return rec
+	}
+
+	patient := "did:key:z6MkpTHR8VNsBxYAAWHut2Geadd9jSwuBV8xRoAnwWsdvktH"
+	report := `{"resourceType":"DiagnosticReport","id":"hb-1","status":"final","subject":{"reference":"Patient/` + patient + `"},"issued":"2025-03-01T10:00:00Z","conclusion":"Hb 13.2 g/dL"}`
+	study := `{"resourceType":"ImagingStudy","id":"ct-1","status":"available","subject":{"reference":"Patient/` + patient + `"},"started":"2025-03-02T09:30:00Z"}`
+	bundle := `{"resourceType":"Bundle","type":"transaction","entry":[{"resource":` + report + `,"request":{"method":"POST","url":"DiagnosticReport"}},{"resource":` + study + `,"request":{"method":"POST","url":"ImagingStudy"}}]}`
+
+	rec := post(fhirBase, bundle)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != fhir.ContentType {
+		t.Fatalf("transaction not ingested: %d %s", rec.Code, rec.Body)
+	}
+	var resp fhir.BundleResource
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Type != "transaction-response" || len(resp.Entry) != 2 {
+		t.Fatalf("unexpected response: %v %s", err, rec.Body)
+	}
+	if loc := resp.Entry[1].Response.Location; !strings.HasPrefix(loc, "ImagingStudy/") {
+		t.Errorf("entry location %q", loc)
+	}
+	txs := pool.GetAllTxs()
+	if len(txs) != 2 {
+		t.Fatalf("%d transactions in the mempool, want 2", len(txs))
+	}
+	for _, tx := range txs {
+		var sub block.MedicalRecordSubmission
+		if err := json.Unmarshal(tx.Payload, &sub); err != nil {
+			t.Fatal(err)
+		}
+		if sub.WalletAddress != "st_mary_wallet" || sub.PatientDID() != patient || sub.Record["providerId"] != "st-mary-lab" {
+			t.Errorf("submission not made by the facility for the patient: %+v", sub)
+		}
+		data, _ := json.Marshal(sub.Record)
+		if !core.VerifySignature(core.Signature{Algorithm: "Ed25519", Signature: sub.Signature}, pub, data) {
+			t.Error("submission not signed by the facility wallet")
+		}
+		if strings.Contains(string(tx.Payload), "Hb 13.2") {
+			t.Error("PHI body left in the mempool transaction")
+		}
+		body, err := store.GetPayload(sub.DocHash(), storage.PayloadOwner{PatientDID: patient, RecordID: sub.RecordID()})
+		if err != nil {
+			t.Fatalf("payload not in the store: %v", err)
+		}
+		if want := map[string]string{"lab_result": report, "imaging": study}[sub.RecordType()]; string(body) != want {
+			t.Errorf("%s payload is %s", sub.RecordType(), body)
+		}
+	}
+
+	rec = post(fhirBase+"/Observation", `{"resourceType":"Observation","status":"final","category":[{"coding":[{"code":"laboratory"}]}],"subject":{"reference":"Patient/123"},"issued":"2025-03-01T10:00:00Z"}`)
+	var oo fhir.OperationOutcome
+	if err := json.Unmarshal(rec.Body.Bytes(), &oo); rec.Code != http.StatusUnprocessableEntity || err != nil || oo.ResourceType != "OperationOutcome" || oo.Issue[0].Expression[0] != "Observation.subject" {
+		t.Errorf("invalid resource: %d %s", rec.Code, rec.Body)
+	}
+	if rec := post(fhirBase+"/ImagingStudy", report); rec.Code != http.StatusBadRequest {
+		t.Errorf("DiagnosticReport posted as ImagingStudy: %d %s", rec.Code, rec.Body)
+	}
+	if len(pool.GetAllTxs()) != 2 {
+		t.Error("rejected resources reached the mempool")
+	}
+
+	// A Bundle the mempool cannot take whole submits no entry and keeps none of its payloads
+	payloads := func() int {
+		iter := store.DB().NewIterator(util.BytesPrefix([]byte("payload:")), nil)
+		defer iter.Release()
+		n := 0
+		for iter.Next() {
+			n++
+		}
+		return n
+	}
+	stored := payloads()
+	small := mempool.NewMempool(2)
+	s.network = &networking.Network{Mempool: small}
+	second := strings.Replace(report, `"id":"hb-1"`, `"id":"hb-2"`, 1)
+	bundle = `{"resourceType":"Bundle","type":"transaction","entry":[{"resource":` + report + `,"request":{"method":"POST","url":"DiagnosticReport"}},{"resource":` + study + `,"request":{"method":"POST","url":"ImagingStudy"}},{"resource":` + second + `,"request":{"method":"POST","url":"DiagnosticReport"}}]}`
+	if rec := post(fhirBase, bundle); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("oversized transaction: %d %s", rec.Code, rec.Body)
+	}
+	if n := len(small.GetAllTxs()); n != 0 {
+		t.Errorf("%d entries of a refused transaction reached the mempool", n)
+	}
+	if n := payloads(); n != stored {
+		t.Errorf("%d payloads stored after a refused transaction, want %d", n, stored)
+	}
+}
+
+func TestPatientEverythingExport(t *testing.T) {
+	oldSecret := jwtSecret
+	jwtSecret = "token-secret"
+	t.Cleanup(func() { jwtSecret = oldSecret })
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := &Server{store: store, routes: &RouteRegistry{}}
+
+	patient := "did:key:z6MkpTHR8VNsBxYAAWHut2Geadd9jSwuBV8xRoAnwWsdvktH"
+	payload := func(owner storage.PayloadOwner, body string) string {
+		p, err := store.PutPayload([]byte(body), owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.DocHash
+	}
+	record := func(name, recordType, body string) block.ChainedEvent {
+		return block.ChainedEvent{EventID: ids.IDFromString(name), EventType: "medical_record", RecordID: name, PatientID: patient, ProviderID: "st-mary-lab",
+			RecordType: recordType, PayloadHash: payload(storage.PayloadOwner{PatientDID: patient, RecordID: name}, body), Timestamp: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)}
+	}
+	original := record("hb-1", "lab_result", `{"resourceType":"DiagnosticReport","id":"hb","status":"preliminary"}`)
+	revised := record("hb-2", "lab_result", `{"resourceType":"DiagnosticReport","id":"hb","status":"final"}`)
+	revised.RevisionOf, revised.DocLineage = original.EventID.String(), []string{original.EventID.String()}
+	hl7 := record("oru-1", "lab_result", "MSH|^~\\&|LIS|CITYLAB\r")
+	// A record naming another patient's payload by its docHash is exported without it
+	borrowed := record("xray-1", "imaging", `{"resourceType":"ImagingStudy","id":"xray","status":"available"}`)
+	borrowed.PayloadHash = payload(storage.PayloadOwner{PatientDID: "did:example:victim", RecordID: "victim-record"}, `{"resourceType":"DiagnosticReport","id":"victim","status":"final"}`)
+	var blockIDs []string
+	for h, events := range [][]block.ChainedEvent{{original, {EventID: ids.IDFromString("memory"), EventType: "memory"}}, {revised, hl7, borrowed}} {
+		b := block.Block{Height: uint64(h), Timestamp: time.Unix(1740823200, 0).UTC(), Events: events}
+		b.BlockID = b.ComputeID()
+		data, _ := json.Marshal(b)
+		if err := store.SaveBlock(b.BlockID[:], data); err != nil {
+			t.Fatal(err)
+		}
+		blockIDs = append(blockIDs, hex.EncodeToString(b.BlockID[:]))
+	}
+	if n, err := blockchain.CatchUpRecordIndex(store); err != nil || n != 2 {
+		t.Fatalf("indexed %d blocks: %v", n, err)
+	}
+
+	export := func(claims jwt.MapClaims) fhir.BundleResource {
+		r := httptest.NewRequest(http.MethodGet, fhirBase+"/Patient/"+patient+"/$everything", nil)
+		r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", claims))
+		rec := httptest.NewRecorder()
+		s.enforce(fhirBase+"/Patient/", RoutePolicy{Audiences: []Audience{AudienceProvider, AudiencePatient}, Scopes: []string{ScopeRecordsRead}}, s.PatientEverythingHandler)(rec, r)
+		var bundle fhir.BundleResource
+		if err := json.Unmarshal(rec.Body.Bytes(), &bundle); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("export failed: %d %s", rec.Code, rec.Body)
+		}
+		return bundle
+	}
+	bundle := export(jwt.MapClaims{"role": "patient", "did": patient, "scope": ScopeRecordsRead})
+	if bundle.Type != "searchset" || *bundle.Total != 3 || len(bundle.Entry) != 7 {
+		t.Fatalf("unexpected Bundle: %+v", bundle)
+	}
+	resources := map[string]map[string]interface{}{}
+	for _, e := range bundle.Entry {
+		var res map[string]interface{}
+		json.Unmarshal(e.Resource, &res)
+		resources[e.FullURL] = res
+	}
+	if report := resources["DiagnosticReport/hb-2"]; report == nil || report["status"] != "final" || report["id"] != "hb-2" {
+		t.Errorf("latest revision not exported: %v", resources)
+	}
+	if _, ok := resources["DiagnosticReport/hb-1"]; ok {
+		t.Error("superseded revision exported")
+	}
+	doc, _ := json.Marshal(resources["DocumentReference/oru-1"])
+	if !strings.Contains(string(doc), base64.StdEncoding.EncodeToString([]byte("MSH|^~\\&|LIS|CITYLAB\r"))) {
+		t.Errorf("HL7 payload not wrapped in a DocumentReference: %s", doc)
+	}
+	if xray, _ := json.Marshal(resources["DocumentReference/xray-1"]); strings.Contains(string(xray), `"data"`) || !strings.Contains(string(xray), "not available") {
+		t.Errorf("another record's payload exported: %s", xray)
+	}
+	var prov fhir.ProvenanceResource
+	data, _ := json.Marshal(resources["Provenance/"+revised.EventID.String()])
+	json.Unmarshal(data, &prov)
+	if prov.Target[0].Reference != "DiagnosticReport/hb-2" || prov.Entity[0].What.Identifier.Value != blockIDs[1] ||
+		prov.Entity[1].What.Identifier.Value != revised.EventID.String() || prov.Entity[2].Role != "revision" || prov.Entity[2].What.Identifier.Value != original.EventID.String() {
+		t.Errorf("unexpected Provenance %s", data)
+	}
+
+	bundle = export(jwt.MapClaims{"role": "provider", "sub": "other-clinic", "scope": ScopeRecordsRead})
+	if *bundle.Total != 0 || len(bundle.Entry) != 2 || !strings.Contains(string(bundle.Entry[1].Resource), "3 record(s) omitted") {
+		t.Errorf("records exported without consent: %+v", bundle)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"unicareos/core/auth"
 	"unicareos/core/mempool"
 	"unicareos/core/audit"
+	"unicareos/core/storage"
 )
 
 // Helper to convert []interface{} to []block.MemorySubmission
@@ -45,31 +46,6 @@ func getAPISecret() string {
 	return os.Getenv("API_JWT_SECRET") // Set this in Dummy.env
 }
 
-// Middleware for JWT/API key authentication (enforce either JWT or API key)
-func authMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		jwtSecret := getAPISecret()
-		apiKey := os.Getenv("API_KEY")
-		authHeader := r.Header.Get("Authorization")
-		xApiKey := r.Header.Get("X-API-Key")
-
-		jwtValid := false
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			token := strings.TrimPrefix(authHeader, "Bearer ")
-			if token == jwtSecret && token != "" {
-				jwtValid = true
-			}
-		}
-		apiKeyValid := (xApiKey != "" && apiKey != "" && xApiKey == apiKey)
-
-		if !jwtValid && !apiKeyValid {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
 // Handler for submitting medical records
 func (s *Server) SubmitMedicalRecordHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -93,6 +69,13 @@ func (s *Server) SubmitMedicalRecordHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Unauthorized: "+verr.Error(), http.StatusUnauthorized)
 		return
 	}
+	if s.store != nil {
+		owner := storage.PayloadOwner{PatientDID: submission.PatientDID(), RecordID: submission.RecordID()}
+		if err := s.store.CheckPayloadOwner(submission.DocHash(), owner); err != nil {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
 
 
 	// --- DECOUPLED: Ethos Token Verification (independent of wallet logic) ---
@@ -139,6 +122,7 @@ func (s *Server) SubmitMedicalRecordHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Duplicate transaction or mempool full", http.StatusConflict)
 		return
 	}
+	s.gossipEngine.BroadcastTx(tx)
 
 	// --- Revision Audit Logging (additive, non-invasive) ---
 	if submission.RevisionOf != "" || submission.RevisionReason != "" || (submission.DocLineage != nil && len(submission.DocLineage) > 0) {
@@ -153,31 +137,13 @@ func (s *Server) SubmitMedicalRecordHandler(w http.ResponseWriter, r *http.Reque
 		audit.LogMedicalRecordRevision(auditLogger, eventID, revisionOf, revisionReason, entityID, docLineage, result)
 	}
 
-	// --- Finalization logic ---
-	finalizerPubKeyB64 := os.Getenv("FINALIZER_PUBKEY")
-	if finalizerPubKeyB64 != "" && s.Finalizer != nil {
-		finalizeTx := &block.FinalizeEventTx{
-			TxID:                  txID,
-			SubmitMedicalRecordTx: tx.Payload,
-			FinalizerSignature:    "", // Will be set by Finalizer logic
-			EthosToken:            ethosToken,
-			Block: block.BlockReference{
-				BlockHash: txID, // Use txID as a non-empty stand-in for testing
-				Epoch:     0,  // Set as appropriate
-			},
-			Timestamp: time.Now().UTC(),
-			Status:    block.FinalizationStatusPending,
-		}
-		err := s.Finalizer.FinalizeEvent(finalizeTx, finalizerPubKeyB64)
-		if err != nil {
-			// Optionally, handle/log the error elsewhere if needed
-		}
-		// No debug/info output
-	}
+	// --- Finalization: submitted as a FinalizeEventTx once a block includes the record ---
+	eventID, _ := s.network.QueueEventFinalization(serializedPayload)
 
 	// Return a receipt
 	receipt := map[string]interface{}{
 		"txId":    txID,
+		"eventId": eventID,
 		"status":  "pending",
 		"message": "Submission added to mempool",
 	}
@@ -186,55 +152,54 @@ func (s *Server) SubmitMedicalRecordHandler(w http.ResponseWriter, r *http.Reque
 }
 
 // RegisterMedicalRecordAPI registers the endpoint to the mux
-// Handler to list all expired medical record transactions
+// Handler to list the expired medical record transactions the caller has consent to read
 func (s *Server) ListExpiredMedicalRecordsHandler(w http.ResponseWriter, r *http.Request) {
-	// For demo: no auth, but can add
-	expired := s.gossipEngine.Mempool.ExpiredPool.ListExpiredTxs()
+	rd := requestReader(r)
+	expired := []mempool.ExpiredTx{}
+	for _, tx := range s.gossipEngine.Mempool.ExpiredPool.ListExpiredTxs() {
+		if payload, ok := tx.Payload.([]byte); ok && s.canReadSubmission(rd, payload) {
+			expired = append(expired, tx)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(expired)
 }
 
-// Handler to resubmit an expired medical record transaction
+// Handler to resubmit an expired medical record transaction.
+// The resubmission keeps the original TxID as its lineage, so it cannot race a live copy.
 func (s *Server) ResubmitMedicalRecordHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct { TxID string `json:"txId"` }
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TxID == "" {
 		http.Error(w, "Missing or invalid txId", http.StatusBadRequest)
 		return
 	}
-	empTx, ok := s.gossipEngine.Mempool.ExpiredPool.GetExpiredTx(req.TxID)
-	if !ok {
-		http.Error(w, "Transaction not found in expired pool", http.StatusNotFound)
+	if s.ExpiryManager == nil {
+		http.Error(w, "Expiry manager unavailable", http.StatusServiceUnavailable)
 		return
 	}
-	// Type assertion for []byte
-	payloadBytes, ok := empTx.Payload.([]byte)
-	if !ok {
-		http.Error(w, "Expired TX payload is not []byte", http.StatusInternalServerError)
+	if _, ok := s.gossipEngine.Mempool.ExpiredPool.GetExpiredTx(req.TxID); !ok {
+		http.Error(w, "Transaction not found in expired pool", http.StatusNotFound)
 		return
 	}
-	// Re-insert into mempool with new timestamp
-	var submission map[string]interface{}
-	if err := json.Unmarshal(payloadBytes, &submission); err != nil {
-		http.Error(w, "Failed to parse expired TX payload", http.StatusInternalServerError)
+	tx, res, err := s.ExpiryManager.Resubmit(req.TxID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-
-	tx := mempool.Transaction{
-		TxID:      req.TxID + "-resubmitted-" + time.Now().Format("20060102150405"),
-		Payload:   payloadBytes,
-		Timestamp: time.Now().Unix(),
-		Sender:    "resubmitted",
-	}
-	added := s.gossipEngine.Mempool.AddTx(tx)
-	if !added {
-		http.Error(w, "Duplicate or mempool full", http.StatusConflict)
+	if !res.Accepted {
+		status := http.StatusConflict
+		if res.Class == mempool.ErrorClassPermanent {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, "Resubmission rejected: "+res.Reason, status)
 		return
 	}
 	// Audit log print
-	fmt.Printf("[AUDIT] Resubmitted expired TX: %s at %s\n", req.TxID, time.Now().Format(time.RFC3339))
+	fmt.Printf("[AUDIT] Resubmitted expired TX: %s as %s at %s\n", req.TxID, tx.TxID, time.Now().Format(time.RFC3339))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"txId": tx.TxID,
+		"originTxId": tx.OriginTxID,
 		"status": "resubmitted",
 		"message": "Transaction resubmitted to mempool",
 	})
@@ -325,6 +290,7 @@ func (s *Server) GetLineageHandler(w http.ResponseWriter, r *http.Request) {
 				Memories: convertMemories(evt.Memories),
 				PatientID: evt.PatientID,
 				ProviderID: evt.ProviderID,
+				RecordType: evt.RecordType,
 				Epoch: evt.Epoch,
 				PayloadHash: evt.PayloadHash,
 				PayloadRef: evt.PayloadRef,
@@ -344,6 +310,14 @@ func (s *Server) GetLineageHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "eventId not found", http.StatusNotFound)
 		return
 	}
+	if foundEvent.EventType == "medical_record" {
+		if ok, reason := s.recordAccess(requestReader(r), foundEvent.PatientID, foundEvent.RecordType); !ok {
+			fmt.Printf("[CONSENT] Denied lineage of %s to %s: %s\n", eventId, queriedBy, reason)
+			auditLog(queriedBy, eventId, "failure", reason)
+			http.Error(w, "forbidden: "+reason, http.StatusForbidden)
+			return
+		}
+	}
 	// Build full lineage recursively, applying filters
 	lineage := []string{}
 	visited := make(map[string]bool)
@@ -418,8 +392,9 @@ func (s *Server) GetLineageHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RegisterMedicalRecordAPI(mux *http.ServeMux, server *Server) {
-	mux.Handle("/api/v1/submit-medical-record", authMiddleware(http.HandlerFunc(server.SubmitMedicalRecordHandler)))
-	mux.HandleFunc("/api/v1/expired-medical-records", server.ListExpiredMedicalRecordsHandler)
-	mux.HandleFunc("/api/v1/resubmit-medical-record", server.ResubmitMedicalRecordHandler)
-	mux.Handle("/api/v1/get-lineage", authMiddleware(http.HandlerFunc(server.GetLineageHandler)))
+	write := RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsWrite}}
+	server.handle(mux, "/api/v1/submit-medical-record", write, server.SubmitMedicalRecordHandler)
+	server.handle(mux, "/api/v1/expired-medical-records", RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsRead}}, server.ListExpiredMedicalRecordsHandler)
+	server.handle(mux, "/api/v1/resubmit-medical-record", write, server.ResubmitMedicalRecordHandler)
+	server.handle(mux, "/api/v1/get-lineage", RoutePolicy{Audiences: []Audience{AudienceProvider, AudiencePatient}, Scopes: []string{ScopeRecordsRead}}, server.GetLineageHandler)
 }
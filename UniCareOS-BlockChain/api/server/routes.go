@@ -0,0 +1,201 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"unicareos/core/networking"
+)
+
+// Route policies. Every endpoint is registered through Server.handle with the audiences allowed to
+// call it and the scopes a token must carry; the policy is enforced before the handler runs.
+//
+//	public     anyone (read-only chain, epoch and health data)
+//	peer       other nodes over the authenticated P2P transport (mutual TLS with an admitted node key)
+//	admin      node operators presenting X-API-Key
+//	provider   bearer JWT with role "provider" and the route's scopes
+//	patient    bearer JWT with role "patient" and the route's scopes
+//	compliance bearer JWT with role "compliance" and the route's scopes
+//
+// The API key also satisfies provider, patient and compliance routes so operators can act on their behalf.
+// Record metadata is further gated by patient consent or break-glass access (see consent_api.go, emergency_api.go).
+// With ENV=production, Start refuses to run if any route was registered without a policy.
+
+// Audience identifies who may call an endpoint
+type Audience string
+
+const (
+	AudiencePublic     Audience = "public"
+	AudiencePeer       Audience = "peer"
+	AudienceAdmin      Audience = "admin"
+	AudienceProvider   Audience = "provider"
+	AudiencePatient    Audience = "patient"
+	AudienceCompliance Audience = "compliance"
+)
+
+// Scopes carried in the space-separated JWT "scope" claim
+const (
+	ScopeRecordsWrite    = "records:write"    // Submit or resubmit records and memories
+	ScopeRecordsRead     = "records:read"     // Read record lineage and expired submissions
+	ScopeMempoolRead     = "mempool:read"     // List pending transactions
+	ScopeConsentWrite    = "consent:write"    // Submit patient-signed consent grants and revocations
+	ScopeConsentRead     = "consent:read"     // List a patient's consents
+	ScopeEmergencyAccess = "emergency:access" // Submit clinician-signed break-glass requests
+	ScopeEmergencyReview = "emergency:review" // List and resolve break-glass reviews
+)
+
+// RoutePolicy declares who may call a route
+type RoutePolicy struct {
+	Audiences []Audience `json:"audiences"`
+	Scopes    []string   `json:"scopes,omitempty"`
+}
+
+// Route is a registered endpoint and its policy
+type Route struct {
+	Path   string      `json:"path"`
+	Peer   bool        `json:"peer"` // Served on the P2P listener rather than the public API
+	Policy RoutePolicy `json:"policy"`
+}
+
+// Common policies
+var (
+	publicPolicy = RoutePolicy{Audiences: []Audience{AudiencePublic}}
+	peerPolicy   = RoutePolicy{Audiences: []Audience{AudiencePeer}}
+	adminPolicy  = RoutePolicy{Audiences: []Audience{AudienceAdmin}}
+)
+
+// RouteRegistry records every endpoint the server exposes
+type RouteRegistry struct {
+	mu     sync.Mutex
+	routes []Route
+}
+
+func (rr *RouteRegistry) add(rt Route) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.routes = append(rr.routes, rt)
+}
+
+// Routes returns the registered routes sorted by path
+func (rr *RouteRegistry) Routes() []Route {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	out := append([]Route(nil), rr.routes...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// CheckPolicies reports routes with a missing or malformed policy
+func (rr *RouteRegistry) CheckPolicies() error {
+	var bad []string
+	for _, rt := range rr.Routes() {
+		if err := rt.Policy.validate(); err != nil {
+			bad = append(bad, fmt.Sprintf("%s (%v)", rt.Path, err))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%d route(s) without a valid auth policy: %s", len(bad), strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+func (p RoutePolicy) validate() error {
+	if len(p.Audiences) == 0 {
+		return fmt.Errorf("no audience")
+	}
+	for _, a := range p.Audiences {
+		switch a {
+		case AudiencePublic, AudiencePeer, AudienceAdmin, AudienceProvider, AudiencePatient, AudienceCompliance:
+		default:
+			return fmt.Errorf("unknown audience %q", a)
+		}
+		if a == AudiencePublic && (len(p.Audiences) > 1 || len(p.Scopes) > 0) {
+			return fmt.Errorf("public routes take no other audience or scopes")
+		}
+	}
+	return nil
+}
+
+func isProduction() bool {
+	return os.Getenv("ENV") == "production"
+}
+
+// handle registers h on mux (nil means the public API mux) behind policy enforcement
+func (s *Server) handle(mux *http.ServeMux, path string, policy RoutePolicy, h http.HandlerFunc) {
+	peer := mux != nil && s.network != nil && mux == s.network.PeerMux
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	s.routes.add(Route{Path: path, Peer: peer, Policy: policy})
+	mux.Handle(path, s.enforce(path, policy, h))
+}
+
+// enforce wraps h so it only runs for callers the policy admits
+func (s *Server) enforce(path string, policy RoutePolicy, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := policy.validate(); err != nil {
+			if isProduction() {
+				http.Error(w, "forbidden: route has no auth policy", http.StatusForbidden)
+				return
+			}
+			h(w, r) // Development: unpolicied routes stay open (Start already warned)
+			return
+		}
+		if status, reason := s.authorize(r, policy); status != 0 {
+			fmt.Printf("[AUTH] Denied %s %s from %s: %s\n", r.Method, path, r.RemoteAddr, reason)
+			http.Error(w, reason, status)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// authorize returns 0 when the request satisfies one of the policy's audiences, or the HTTP status and
+// reason to reject it with
+func (s *Server) authorize(r *http.Request, policy RoutePolicy) (int, string) {
+	status, reason := http.StatusUnauthorized, "unauthorized"
+	for _, a := range policy.Audiences {
+		switch a {
+		case AudiencePublic:
+			return 0, ""
+		case AudiencePeer:
+			if s.peerAuthenticated(r) {
+				return 0, ""
+			}
+		case AudienceAdmin:
+			if requireAPIKey(nil, r) {
+				return 0, ""
+			}
+		case AudienceProvider, AudiencePatient, AudienceCompliance:
+			if requireAPIKey(nil, r) {
+				return 0, ""
+			}
+			claims, err := parseJWT(r)
+			if err != nil {
+				continue
+			}
+			if role, _ := claims["role"].(string); role != string(a) {
+				status, reason = http.StatusForbidden, "forbidden: role not allowed"
+				continue
+			}
+			if missing := missingScopes(claims, policy.Scopes); len(missing) > 0 {
+				status, reason = http.StatusForbidden, "forbidden: missing scope "+strings.Join(missing, " ")
+				continue
+			}
+			return 0, ""
+		}
+	}
+	return status, reason
+}
+
+// peerAuthenticated reports whether r arrived over mutual TLS from an admitted node key
+func (s *Server) peerAuthenticated(r *http.Request) bool {
+	if r.TLS == nil || s.network == nil || s.network.Transport == nil || s.network.Transport.Keys == nil {
+		return false
+	}
+	return s.network.Transport.Keys.Allowed(networking.PeerKey(*r.TLS))
+}
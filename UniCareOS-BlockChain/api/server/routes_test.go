@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"unicareos/core/networking"
+)
+
+func testToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func serve(s *Server, policy RoutePolicy, r *http.Request) int {
+	rec := httptest.NewRecorder()
+	s.enforce("/test", policy, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })(rec, r)
+	return rec.Code
+}
+
+func TestRoutePolicyEnforcement(t *testing.T) {
+	oldKey, oldSecret := apiKey, jwtSecret
+	apiKey, jwtSecret = "operator-key", "token-secret"
+	t.Cleanup(func() { apiKey, jwtSecret = oldKey, oldSecret })
+	s := &Server{routes: &RouteRegistry{}}
+	write := RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsWrite}}
+
+	cases := []struct {
+		name   string
+		policy RoutePolicy
+		setup  func(r *http.Request)
+		want   int
+	}{
+		{"public needs nothing", publicPolicy, func(r *http.Request) {}, http.StatusOK},
+		{"admin without key", adminPolicy, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"admin wrong key", adminPolicy, func(r *http.Request) { r.Header.Set("X-API-Key", "nope") }, http.StatusUnauthorized},
+		{"admin with key", adminPolicy, func(r *http.Request) { r.Header.Set("X-API-Key", "operator-key") }, http.StatusOK},
+		{"provider with key", write, func(r *http.Request) { r.Header.Set("X-API-Key", "operator-key") }, http.StatusOK},
+		{"provider token with scope", write, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", jwt.MapClaims{"role": "provider", "scope": "records:read records:write"}))
+		}, http.StatusOK},
+		{"provider token missing scope", write, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", jwt.MapClaims{"role": "provider", "scope": "records:read"}))
+		}, http.StatusForbidden},
+		{"patient token on provider route", write, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", jwt.MapClaims{"role": "patient", "scope": "records:write"}))
+		}, http.StatusForbidden},
+		{"token signed with another secret", write, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+testToken(t, "other", jwt.MapClaims{"role": "provider", "scope": "records:write"}))
+		}, http.StatusUnauthorized},
+		{"expired token", write, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+testToken(t, "token-secret", jwt.MapClaims{"role": "provider", "scope": "records:write", "exp": time.Now().Add(-time.Minute).Unix()}))
+		}, http.StatusUnauthorized},
+		{"raw shared secret is not a token", write, func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-secret") }, http.StatusUnauthorized},
+		{"peer route over plain HTTP", peerPolicy, func(r *http.Request) { r.Header.Set("X-API-Key", "operator-key") }, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/test", nil)
+		tc.setup(r)
+		if got := serve(s, tc.policy, r); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPeerRoutesRequireAdmittedNodeKey(t *testing.T) {
+	admitted, _, _ := ed25519.GenerateKey(rand.Reader)
+	stranger, _, _ := ed25519.GenerateKey(rand.Reader)
+	s := &Server{routes: &RouteRegistry{}, network: &networking.Network{Transport: &networking.Transport{Keys: networking.NewPeerKeySet(admitted)}}}
+	for _, tc := range []struct {
+		key  ed25519.PublicKey
+		want int
+	}{{admitted, http.StatusOK}, {stranger, http.StatusUnauthorized}} {
+		r := httptest.NewRequest(http.MethodGet, "/test", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{PublicKey: tc.key}}}
+		if got := serve(s, peerPolicy, r); got != tc.want {
+			t.Errorf("peer key %x: status %d, want %d", tc.key[:4], got, tc.want)
+		}
+	}
+}
+
+func TestCheckPoliciesFlagsUndeclaredRoutes(t *testing.T) {
+	s := &Server{routes: &RouteRegistry{}}
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	s.handle(mux, "/declared", adminPolicy, ok)
+	if err := s.routes.CheckPolicies(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.handle(mux, "/undeclared", RoutePolicy{}, ok)
+	s.handle(mux, "/public-with-scope", RoutePolicy{Audiences: []Audience{AudiencePublic}, Scopes: []string{ScopeRecordsRead}}, ok)
+	if err := s.routes.CheckPolicies(); err == nil {
+		t.Fatal("expected undeclared and malformed policies to be reported")
+	}
+
+	t.Setenv("ENV", "production")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/undeclared", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("undeclared route served in production: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+)
+
+// Schema registry.
+// Operators submit governance-signed SchemaRegistrations (see `UniCareOS schema sign`) to
+// /api/v1/schemas/register; anyone can list the registered schemas and fetch one by hash.
+
+// schemaSummary is a registered schema without its document
+type schemaSummary struct {
+	Version          string `json:"version"`
+	SchemaHash       string `json:"schemaHash"`
+	ActivationHeight uint64 `json:"activationHeight"`
+	TxID             string `json:"txID,omitempty"`
+	IncludedIn       string `json:"includedIn,omitempty"`
+	Height           uint64 `json:"height"`
+}
+
+// SubmitSchemaRegistrationHandler relays a governance-signed schema registration to the mempool
+func (s *Server) SubmitSchemaRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var reg block.SchemaRegistration
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&reg); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txID, err := s.network.SubmitSchemaRegistration(&reg)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "duplicate") || errors.Is(err, blockchain.ErrSchemaDuplicate) {
+			status = http.StatusConflict
+		}
+		http.Error(w, "Schema registration rejected: "+err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"txId":             txID,
+		"version":          reg.Version,
+		"schemaHash":       reg.SchemaHash,
+		"activationHeight": reg.ActivationHeight,
+		"status":           "pending",
+		"message":          "Schema registration added to mempool; it is registered once included in a block",
+	})
+}
+
+// ListSchemasHandler lists the registered schemas, or with ?hash= returns that schema's document
+func (s *Server) ListSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	hash := r.URL.Query().Get("hash")
+	out := []schemaSummary{}
+	for _, rec := range blockchain.ListSchemas(s.store) {
+		if hash != "" {
+			if rec.SchemaHash == hash {
+				w.Header().Set("Content-Type", "application/schema+json")
+				w.Write(rec.Schema)
+				return
+			}
+			continue
+		}
+		out = append(out, schemaSummary{rec.Version, rec.SchemaHash, rec.ActivationHeight, rec.TxID, rec.IncludedIn, rec.Height})
+	}
+	if hash != "" {
+		http.Error(w, "no registered schema has hash "+hash, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// RegisterSchemaAPI registers the schema registry endpoints to the mux
+func RegisterSchemaAPI(mux *http.ServeMux, server *Server) {
+	server.handle(mux, "/api/v1/schemas", publicPolicy, server.ListSchemasHandler)
+	server.handle(mux, "/api/v1/schemas/register", adminPolicy, server.SubmitSchemaRegistrationHandler)
+}
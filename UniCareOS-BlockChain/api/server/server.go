@@ -1,7 +1,9 @@
 package server
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"unicareos/core/anchor"
 	"unicareos/core/chain"
 	"encoding/hex"
 	"fmt"
@@ -10,11 +12,11 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"io"
 
 	block "unicareos/core/block"
+	"unicareos/core/ingest"
 	"unicareos/core/networking"
 	"unicareos/core/storage"
 	"unicareos/types/ids"
@@ -22,7 +24,6 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"unicareos/core/types"
 
-	log "log"
 
 	// DEV: Import dev_tx_inspect for dev-only API
 
@@ -58,46 +59,58 @@ var (
 	envMode        = os.Getenv("ENV")                // Environment (development/production)
 )
 
-// --- Auth Middleware Scaffolding ---
-// These functions currently only log warnings; enable enforcement later.
+// --- Auth Helpers ---
+// Enforced per route by the policy layer in routes.go.
 
-// Checks for API key in X-API-Key header. Logs warning if missing or invalid.
+// requireAPIKey reports whether r carries the configured X-API-Key. An unset API_KEY admits no one.
 func requireAPIKey(w http.ResponseWriter, r *http.Request) bool {
 	key := r.Header.Get("X-API-Key")
-	if key == "" {
-		log.Println("[WARN] No API key provided (TODO: enforce in prod)")
+	if key == "" || apiKey == "" {
 		return false
 	}
-	if key != apiKey {
-		log.Printf("[WARN] Invalid API key: %s (TODO: enforce in prod)\n", key)
-		return false
-	}
-	return true
+	return subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1
 }
 
-// Checks for JWT in Authorization: Bearer header. Logs warning if missing or invalid.
-func requireJWT(w http.ResponseWriter, r *http.Request) bool {
+// parseJWT verifies the HS256 bearer token on r and returns its claims. Tokens must carry an expiry.
+// JWT_SECRET signs tokens; API_JWT_SECRET is used when it is unset.
+func parseJWT(r *http.Request) (jwt.MapClaims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		log.Println("[WARN] No Bearer token provided (TODO: enforce in prod)")
-		return false
+		return nil, fmt.Errorf("no bearer token")
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtSecret), nil
-	})
-	if err != nil || !token.Valid {
-		log.Printf("[WARN] Invalid JWT: %v (TODO: enforce in prod)\n", err)
-		return false
+	secret := jwtSecret
+	if secret == "" {
+		secret = getAPISecret()
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("JWT authentication is not configured")
 	}
-	return true
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
-// --- Endpoint Auth Markers ---
-// TODO: Enforce requireAPIKey on all peer/masternode endpoints (e.g., /request_block, /sync_tip, /broadcast_block, etc.)
-// TODO: Enforce requireJWT on all lightweight node endpoints (e.g., /api/cli/submit_memory, /api/cli/mempool, etc.)
-// TODO: Remove or restrict all admin/dev endpoints before production
-
+// missingScopes returns the required scopes absent from the token's space-separated "scope" claim
+func missingScopes(claims jwt.MapClaims, required []string) []string {
+	granted := map[string]bool{}
+	if scope, ok := claims["scope"].(string); ok {
+		for _, sc := range strings.Fields(scope) {
+			granted[sc] = true
+		}
+	}
+	var missing []string
+	for _, sc := range required {
+		if !granted[sc] {
+			missing = append(missing, sc)
+		}
+	}
+	return missing
+}
 
 type Server struct {
 	store        *storage.Storage
@@ -106,12 +119,12 @@ type Server struct {
 	gossipEngine *mempool.GossipEngine
 	forkChoice   *chain.ForkChoice
 	Finalizer    *block.Finalizer // Added for medical record finalization
+	ExpiryManager *mempool.ExpiryManager // Resubmits expired transactions (manual and automatic)
+	Anchorer      *anchor.Anchorer       // External timestamps of finalized epoch roots (nil if not configured)
+	Facility      *ingest.Facility       // Wallet FHIR-ingested records are signed with (nil disables /fhir/r4)
+	routes       *RouteRegistry         // Every registered endpoint and its auth policy
 }
 
-// --- Ban Event Pool (in-memory, for pending inclusion in next block) ---
-var pendingBanEvents []block.BanEvent
-var pendingBanEventsLock sync.Mutex
-
 
 func NewServer(store *storage.Storage, network *networking.Network, listenAddr string, gossipEngine *mempool.GossipEngine, forkChoice *chain.ForkChoice, finalizer *block.Finalizer) *Server {
 	return &Server{
@@ -121,60 +134,66 @@ func NewServer(store *storage.Storage, network *networking.Network, listenAddr s
 		gossipEngine: gossipEngine,
 		forkChoice:   forkChoice,
 		Finalizer:    finalizer,
+		routes:       &RouteRegistry{},
 	}
 }
 
 func (s *Server) Start() error {
 	// --- Register modular epoch Merkle root endpoint ---
-	http.HandleFunc("/epochs/", s.HandleEpochEvent) // e.g., /epochs/3 returns Merkle root and hashes for epoch 3
-	http.HandleFunc("/gossip_tx", s.handleGossipTx) // Gossip endpoint
-	// Inside Start()
-	http.HandleFunc("/connect_peer", s.handleConnectPeer)
+	s.handle(nil, "/epochs/", publicPolicy, s.HandleEpochEvent) // e.g., /epochs/3 returns Merkle root and hashes for epoch 3; /epochs/3/proof/{eventID} an inclusion proof, /epochs/3/anchors its external timestamps
+	s.handle(nil, "/connect_peer", adminPolicy, s.handleConnectPeer)
 	// Modular health/status endpoints
-	http.HandleFunc("/nodehealth", s.HandleNodeHealth) // For CLI metrics
-	http.HandleFunc("/health/liveness", s.HandleLiveness)
-	http.HandleFunc("/health/readiness", s.HandleReadiness)
-	http.HandleFunc("/status", s.HandleStatus)
+	s.handle(nil, "/nodehealth", publicPolicy, s.HandleNodeHealth) // For CLI metrics
+	s.handle(nil, "/health/liveness", publicPolicy, s.HandleLiveness)
+	s.handle(nil, "/health/readiness", publicPolicy, s.HandleReadiness)
+	s.handle(nil, "/status", publicPolicy, s.HandleStatus)
 	// Epoch endpoints
-	importedEpoch := false
-	if !importedEpoch {
-		importedEpoch = true
-		// import here for codegen, but in real Go this would be at top
-		// "unicareos/api/server/epoch_handler"
-	}
-	http.HandleFunc("/epochs/status", s.HandleEpochStatus)
-	http.HandleFunc("/epochs/latest", s.HandleEpochLatest)
+	s.handle(nil, "/epochs/status", publicPolicy, s.HandleEpochStatus)
+	s.handle(nil, "/epochs/latest", publicPolicy, s.HandleEpochLatest)
 	// Legacy endpoints
-	http.HandleFunc("/chain_height", s.handleChainHeight)
-	http.HandleFunc("/get_block/", s.handleGetBlock) 
-	http.HandleFunc("/list_blocks", s.handleListBlocks)
-	http.HandleFunc("/submit_memory", s.handleSubmitMemory)
-	http.HandleFunc("/get_status", s.handleStatus)
-	http.HandleFunc("/get_chain_tip", s.handleGetChainTip) 
-	http.HandleFunc("/check_peers", s.handleCheckPeers)
+	s.handle(nil, "/chain_height", publicPolicy, s.handleChainHeight)
+	s.handle(nil, "/get_block/", publicPolicy, s.handleGetBlock)
+	s.handle(nil, "/list_blocks", publicPolicy, s.handleListBlocks)
+	s.handle(nil, "/submit_memory", RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsWrite}}, s.handleSubmitMemory)
+	s.handle(nil, "/get_status", publicPolicy, s.handleStatus)
+	s.handle(nil, "/get_chain_tip", publicPolicy, s.handleGetChainTip)
+	s.handle(nil, "/check_peers", adminPolicy, s.handleCheckPeers)
 	// ...
-	http.HandleFunc("/request_block", networking.RequestBlockHandler(s.store))
-	http.HandleFunc("/sync_tip", s.handleSyncTip)
-	http.HandleFunc("/blocks", s.handleBlocksQuery) // New flexible batch/filtered endpoint
+	s.handle(nil, "/blocks", publicPolicy, s.handleBlocksQuery) // New flexible batch/filtered endpoint
 
 	// === Ban Event Admin Endpoint ===
-	http.HandleFunc("/admin/ban_event", s.handleAdminBanEvent)
+	s.handle(nil, "/admin/ban_event", adminPolicy, s.handleAdminBanEvent)
+	s.handle(nil, "/admin/ban_event/approve", adminPolicy, s.handleAdminBanApprove)
+	s.registerBanAdmin() // /admin/bans, /admin/unban, /admin/allowlist, /admin/ban_audit
 
-	// === Live sync: block broadcast endpoint ===
-	http.HandleFunc("/broadcast_block", s.network.HandleBroadcastBlock)
+	// === Peer RPC: served only over the authenticated P2P transport ===
+	s.RegisterPeerRPC(s.network.PeerMux)
 
 	// === CLI-specific JSON endpoints ===
-	http.HandleFunc("/api/cli/status", s.handleCLIStatus)
-	http.HandleFunc("/api/cli/mempool", s.handleCLIMempool)
-	http.HandleFunc("/api/cli/submit_memory", s.handleCLISubmitMemory)
+	s.handle(nil, "/api/cli/status", publicPolicy, s.handleCLIStatus)
+	s.handle(nil, "/api/cli/mempool", RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeMempoolRead}}, s.handleCLIMempool)
+	s.handle(nil, "/api/cli/submit_memory", RoutePolicy{Audiences: []Audience{AudienceProvider}, Scopes: []string{ScopeRecordsWrite}}, s.handleCLISubmitMemory)
 
 	// === Medical Record Submission Endpoint ===
 	RegisterMedicalRecordAPI(http.DefaultServeMux, s)
+	RegisterConsentAPI(http.DefaultServeMux, s)
+	RegisterEmergencyAPI(http.DefaultServeMux, s)
+	RegisterFHIRAPI(http.DefaultServeMux, s)
+	RegisterSchemaAPI(http.DefaultServeMux, s)
 
 	// === DEV ONLY: Transaction Inspection Endpoint ===
 	//Dev delete upon production migration
 	RegisterDevTxInspectAPI(http.DefaultServeMux, s)
 
+	// === Auth self-check: every route must declare its audience ===
+	if err := s.routes.CheckPolicies(); err != nil {
+		if isProduction() {
+			return fmt.Errorf("refusing to start in production: %v", err)
+		}
+		fmt.Printf("[AUTH] WARNING: %v\n", err)
+	}
+	fmt.Printf("[AUTH] %d route(s) registered with auth policies\n", len(s.routes.Routes()))
+
 	fmt.Println("API server listening at", s.ListenAddr)
 
 	enableHTTPS := os.Getenv("ENABLE_HTTPS")
@@ -190,6 +209,31 @@ func (s *Server) Start() error {
 	}
 }
 
+// RegisterPeerRPC mounts the endpoints other nodes call for block, tx and sync traffic.
+// They are not exposed on the public API listener. The simulation harness mounts them on in-process nodes.
+func (s *Server) RegisterPeerRPC(mux *http.ServeMux) {
+	// Sync
+	s.handle(mux, "/chain_height", peerPolicy, s.handleChainHeight)
+	s.handle(mux, "/get_chain_tip", peerPolicy, s.handleGetChainTip)
+	s.handle(mux, "/blocks", peerPolicy, s.handleBlocksQuery)
+	s.handle(mux, "/request_block", peerPolicy, networking.RequestBlockHandler(s.store))
+	s.handle(mux, "/headers", peerPolicy, networking.RequestHeadersHandler(s.store))
+	s.handle(mux, "/sync_tip", peerPolicy, s.handleSyncTip)
+	// Block propagation
+	s.handle(mux, "/broadcast_block", peerPolicy, s.network.HandleBroadcastBlock)
+	s.handle(mux, "/announce_block", peerPolicy, s.network.HandleAnnounceBlock)
+	s.handle(mux, "/ban_proposal", peerPolicy, s.network.HandleBanProposal)                 // Network-wide ban proposals and approvals
+	s.handle(mux, "/epoch_finalization", peerPolicy, s.network.HandleEpochFinalization) // Finalizer signatures over epoch Merkle roots
+	s.handle(mux, "/key_rotation", peerPolicy, s.network.HandleKeyRotation)             // Node key rotations relayed by peers
+	// Tx gossip
+	s.handle(mux, "/gossip_tx", peerPolicy, s.handleGossipTx)                 // Legacy full-body gossip endpoint
+	s.handle(mux, "/gossip/inv", peerPolicy, s.handleGossipInv)             // Peer announces tx IDs
+	s.handle(mux, "/gossip/getdata", peerPolicy, s.handleGossipGetData)     // Peer requests tx bodies
+	s.handle(mux, "/gossip/inventory", peerPolicy, s.handleGossipInventory) // Peer reconciles against our mempool
+	// Peer exchange
+	s.handle(mux, "/pex/addrs", peerPolicy, s.network.HandlePEX)
+}
+
 // handleGossipTx handles incoming gossip messages
 func (s *Server) handleGossipTx(w http.ResponseWriter, r *http.Request) {
     fmt.Println("[GOSSIP] /gossip_tx endpoint hit")
@@ -212,25 +256,77 @@ func (s *Server) handleGossipTx(w http.ResponseWriter, r *http.Request) {
     w.WriteHeader(http.StatusOK)
 }
 
-// handleAdminBanEvent allows an admin to submit a BanEvent (ban or unban) via POST.
-func (s *Server) handleAdminBanEvent(w http.ResponseWriter, r *http.Request) {
+// allowGossipPeer applies ban and rate-limit checks to gossip requests and returns the peer host
+func (s *Server) allowGossipPeer(w http.ResponseWriter, r *http.Request) (string, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if s.network.IsPeerBanned(host) {
+		http.Error(w, "forbidden: banned", http.StatusForbidden)
+		fmt.Printf("[BAN] Blocked gossip from banned peer: %s\n", host)
+		return host, false
+	}
+	if !s.network.AllowPeerRequest(host) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		fmt.Printf("[RATE LIMIT] Blocked gossip from %s\n", host)
+		return host, false
+	}
+	if s.gossipEngine == nil {
+		http.Error(w, "gossip unavailable", http.StatusServiceUnavailable)
+		return host, false
+	}
+	return host, true
+}
+
+// handleGossipInv accepts a tx ID announcement and fetches missing bodies from the announcer in the background
+func (s *Server) handleGossipInv(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
 		return
 	}
-	var banEvent block.BanEvent
-	err := json.NewDecoder(r.Body).Decode(&banEvent)
-	if err != nil {
+	host, ok := s.allowGossipPeer(w, r)
+	if !ok {
+		return
+	}
+	var msg mempool.InvMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
-	// Optionally, add admin authentication here (e.g., API key, session, etc.)
-	banEvent.Timestamp = time.Now().UTC()
-	pendingBanEventsLock.Lock()
-	pendingBanEvents = append(pendingBanEvents, banEvent)
-	pendingBanEventsLock.Unlock()
+	s.gossipEngine.Go(func() { s.gossipEngine.HandleInv(host, msg) })
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("BanEvent queued for inclusion in next block"))
+}
+
+// handleGossipGetData returns the requested tx bodies from our mempool
+func (s *Server) handleGossipGetData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.allowGossipPeer(w, r); !ok {
+		return
+	}
+	var msg mempool.GetDataMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.gossipEngine.HandleGetData(msg))
+}
+
+// handleGossipInventory lists the tx IDs in our mempool
+func (s *Server) handleGossipInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.allowGossipPeer(w, r); !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.gossipEngine.Inventory())
 }
 
 func (s *Server) handleSubmitMemory(w http.ResponseWriter, r *http.Request) {
@@ -267,14 +363,11 @@ func (s *Server) handleSubmitMemory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tx := mempool.Transaction{
-		TxID:      "memory-" + memSub.Author + "-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		TxID:      mempool.PayloadTxID(payloadBytes),
 		Payload:   payloadBytes,
 		Timestamp: time.Now().Unix(),
 		Sender:    memSub.Author,
 	}
-	if s.gossipEngine != nil {
-		s.gossipEngine.BroadcastTx(tx)
-	}
 	if s.network.Mempool != nil {
 		added := s.network.Mempool.AddTx(tx)
 		if !added {
@@ -282,6 +375,9 @@ func (s *Server) handleSubmitMemory(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if s.gossipEngine != nil {
+		s.gossipEngine.BroadcastTx(tx)
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Memory submission accepted into mempool for inclusion in next block."))
 }
@@ -312,7 +408,11 @@ func (s *Server) handleCLIMempool(w http.ResponseWriter, r *http.Request) {
 	var mempoolTxs []interface{}
 	if s.gossipEngine != nil && s.gossipEngine.Mempool != nil {
 		txs := s.gossipEngine.Mempool.GetAllTxs()
+		rd := requestReader(r)
 		for _, tx := range txs {
+			if !s.canReadSubmission(rd, tx.Payload) {
+				continue // Pending record the caller has no consent to read
+			}
 			mempoolTxs = append(mempoolTxs, tx)
 		}
 	} else {
@@ -353,7 +453,7 @@ func (s *Server) handleCLISubmitMemory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tx := mempool.Transaction{
-		TxID:      "memory-" + memSub.Author + "-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		TxID:      mempool.PayloadTxID(payloadBytes),
 		Payload:   payloadBytes,
 		Timestamp: time.Now().Unix(),
 		Sender:    memSub.Author,
@@ -364,6 +464,7 @@ func (s *Server) handleCLISubmitMemory(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"error": "duplicate or mempool full"})
 		return
 	}
+	s.gossipEngine.BroadcastTx(tx)
 	json.NewEncoder(w).Encode(map[string]string{"result": "memory submitted"})
 }
 
@@ -453,6 +554,14 @@ func (s *Server) handleGetBlock(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("block not found: %v", err), http.StatusNotFound)
 		return
 	}
+	// Redact records the caller has no consent to read
+	if decoded, err := block.Deserialize(blk); err == nil {
+		s.redactBlock(requestReader(r), decoded)
+		if blk, err = decoded.Serialize(); err != nil {
+			http.Error(w, "failed to encode block", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(blk)
@@ -606,45 +715,18 @@ func (s *Server) handleConnectPeer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.network.AddrBook.Add(payload.Address, nil, networking.AddrSourceManual)
+	s.network.AddrBook.MarkAttempt(payload.Address)
 	err = s.network.ConnectToPeer(payload.Address)
 	if err != nil {
+		s.network.AddrBook.MarkFailed(payload.Address)
 		http.Error(w, fmt.Sprintf("failed to connect: %v", err), http.StatusInternalServerError)
 		return
 	}
-	// Automatically trigger fork-choice sync from the new peer
+	// Automatically trigger fork-choice sync; the handshake filled in the peer's height and tip
 	go func() {
 		fmt.Printf("[AUTO_SYNC] Triggering fork-choice sync from peer %s\n", payload.Address)
-		// Fetch peer chain height
-		peerHeight := 0
-		peerTip := [32]byte{}
-		resp, err := http.Get("http://" + payload.Address + "/chain_height")
-		if err == nil && resp.StatusCode == 200 {
-			var result struct{ ChainHeight int `json:"chainHeight"` }
-			json.NewDecoder(resp.Body).Decode(&result)
-			peerHeight = result.ChainHeight
-		}
-		if resp != nil { resp.Body.Close() }
-		resp, err = http.Get("http://" + payload.Address + "/get_chain_tip")
-		if err == nil && resp.StatusCode == 200 {
-			var result struct{ LatestBlockID string `json:"latestBlockID"` }
-			json.NewDecoder(resp.Body).Decode(&result)
-			if len(result.LatestBlockID) == 64 {
-				blockIDBytes, _ := hex.DecodeString(result.LatestBlockID)
-				copy(peerTip[:], blockIDBytes)
-			}
-		}
-		if resp != nil { resp.Body.Close() }
-		myHeight, _ := s.store.GetChainHeight()
-		myTip := s.network.GetLatestBlockID()
-		// Always use the peer's API port for fork-choice sync
-		apiHost := payload.Address
-		if colonIdx := strings.LastIndex(apiHost, ":"); colonIdx != -1 {
-			apiHost = apiHost[:colonIdx]
-		}
-		apiAddr := fmt.Sprintf("%s:%d", apiHost, payload.APIPort)
-		peers := []chain.PeerTipInfo{{ Height: peerHeight, BlockID: peerTip, Address: apiAddr }}
-		err = s.forkChoice.CheckAndSync(myHeight, myTip, peers)
-		if err != nil {
+		if err := s.network.HandleForkChoiceReorg(payload.Address, 0, ""); err != nil {
 			fmt.Printf("[AUTO_SYNC] Fork-choice sync error from peer %s: %v\n", payload.Address, err)
 		} else {
 			fmt.Printf("[AUTO_SYNC] Fork-choice sync completed from peer %s\n", payload.Address)
@@ -852,6 +934,32 @@ func (s *Server) handleBlocksQuery(w http.ResponseWriter, r *http.Request) {
         paginatedEnd = end
     }
 
+    // raw=true returns the stored block JSON unmodified (used by headers-first sync, which checks it against validated headers).
+    // Records in it are not consent-redacted, so only peers may ask for it.
+    peer := s.peerAuthenticated(r)
+    if q.Get("raw") == "true" {
+        if !peer {
+            http.Error(w, "forbidden: raw blocks are served to peers only", http.StatusForbidden)
+            return
+        }
+        raw := []json.RawMessage{}
+        for h := paginatedStart; h <= paginatedEnd; h++ {
+            blockID, err := s.store.GetBlockIDByHeight(h)
+            if err != nil {
+                break
+            }
+            data, err := s.store.GetBlock(blockID)
+            if err != nil {
+                break
+            }
+            raw = append(raw, json.RawMessage(data))
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(raw)
+        return
+    }
+
+    rd := requestReader(r)
     var blocks []types.Block
     for h := paginatedStart; h <= paginatedEnd; h++ {
         blk, err := s.store.GetBlockByHeight(h)
@@ -861,6 +969,9 @@ func (s *Server) handleBlocksQuery(w http.ResponseWriter, r *http.Request) {
         if validator != "" && blk.ValidatorDID != validator {
             continue
         }
+        if !peer {
+            s.redactStoredBlock(rd, &blk)
+        }
         blocks = append(blocks, blk)
     }
 
@@ -12,7 +12,10 @@ func (s *Server) HandleStatus(w http.ResponseWriter, r *http.Request) {
 
 	// Derive node health status from metrics
 	status := "healthy"
-	if metrics.BlockHeight == 0 {
+	sync := s.network.SyncStatus()
+	if sync.Active {
+		status = "syncing"
+	} else if metrics.BlockHeight == 0 {
 		status = "initializing"
 	} else if metrics.SyncLagSeconds > 30 {
 		status = "syncing"
@@ -29,6 +32,7 @@ func (s *Server) HandleStatus(w http.ResponseWriter, r *http.Request) {
 		APIVersion:  APIVersion(),
 		LastBlock:   metrics.LastBlockTime,
 		Metrics:     metrics,
+		Sync:        sync,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -1,6 +1,7 @@
 // status_response.go - JSON response structs for status/health endpoints
 package server
 
+import "unicareos/core/networking"
 
 
 // StatusResponse represents the JSON structure for /status endpoint
@@ -13,6 +14,7 @@ package server
 	APIVersion  string      `json:"api_version"`
 	LastBlock   string      `json:"last_block_time"`
 	Metrics     NodeMetrics `json:"metrics"`
+	Sync        networking.SyncProgress `json:"sync"` // Headers-first sync progress
 }
 
 // LivenessResponse for /health/liveness
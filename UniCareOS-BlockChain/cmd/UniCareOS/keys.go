@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"unicareos/core/keystore"
+)
+
+// Key management: `UniCareOS keys new|import|export|rotate`.
+// Keys are kept in encrypted keystore files (see core/keystore). The passphrase comes from
+// --passphrase-file, else KEYSTORE_PASSPHRASE_FILE, else KEYSTORE_PASSPHRASE.
+
+const keysUsage = `usage:
+  UniCareOS keys new    -kind node|finalizer|wallet -out FILE [-label L] [-kdf argon2id|scrypt]
+  UniCareOS keys import -kind node|finalizer|wallet -in KEYFILE -out FILE [-label L] [-algorithm Ed25519|ECDSA] [-kdf argon2id|scrypt]
+  UniCareOS keys export -keystore FILE [-format hex|base64]
+  UniCareOS keys rotate -keystore FILE [-new-passphrase-file F] [-kdf argon2id|scrypt]
+
+All commands accept -passphrase-file; otherwise KEYSTORE_PASSPHRASE_FILE or KEYSTORE_PASSPHRASE is used.`
+
+// runKeys runs a keys subcommand and returns the process exit code
+func runKeys(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "new":
+		err = keysNew(args[1:])
+	case "import":
+		err = keysImport(args[1:])
+	case "export":
+		err = keysExport(args[1:])
+	case "rotate":
+		err = keysRotate(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, keysUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[KEYS] %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// keystorePassphrase reads the passphrase from file, KEYSTORE_PASSPHRASE_FILE or KEYSTORE_PASSPHRASE
+func keystorePassphrase(file string) ([]byte, error) {
+	if file == "" {
+		file = os.Getenv("KEYSTORE_PASSPHRASE_FILE")
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase: %w", err)
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+	}
+	if p := os.Getenv("KEYSTORE_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+	return nil, errors.New("no keystore passphrase (set -passphrase-file, KEYSTORE_PASSPHRASE_FILE or KEYSTORE_PASSPHRASE)")
+}
+
+func kdfByName(name string) (keystore.KDFParams, error) {
+	switch name {
+	case "", keystore.KDFArgon2id:
+		return keystore.DefaultKDF(), nil
+	case keystore.KDFScrypt:
+		return keystore.ScryptKDF(), nil
+	}
+	return keystore.KDFParams{}, fmt.Errorf("unknown kdf %q", name)
+}
+
+// writeNewKeystore refuses to overwrite an existing keystore
+func writeNewKeystore(f *keystore.File, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	return f.Save(path)
+}
+
+func keysNew(args []string) error {
+	fs := flag.NewFlagSet("keys new", flag.ContinueOnError)
+	kind := fs.String("kind", keystore.KindNode, "node, finalizer or wallet")
+	out := fs.String("out", "", "keystore file to create")
+	label := fs.String("label", "", "key label, e.g. a wallet address")
+	kdfName := fs.String("kdf", keystore.KDFArgon2id, "argon2id or scrypt")
+	passFile := fs.String("passphrase-file", "", "file holding the passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+	kdf, err := kdfByName(*kdfName)
+	if err != nil {
+		return err
+	}
+	passphrase, err := keystorePassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	f, err := keystore.EncryptEd25519(*kind, *label, priv, passphrase, kdf)
+	if err != nil {
+		return err
+	}
+	if err := writeNewKeystore(f, *out); err != nil {
+		return err
+	}
+	fmt.Printf("[KEYS] Created %s key %x in %s\n", *kind, []byte(pub), *out)
+	return nil
+}
+
+// decodeKeyMaterial accepts hex or base64 (the formats of node_ed25519.priv and finalizer_private.key)
+func decodeKeyMaterial(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if b, err := hex.DecodeString(text); err == nil {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(text); err == nil {
+		return b, nil
+	}
+	return nil, errors.New("key file is neither hex nor base64")
+}
+
+func keysImport(args []string) error {
+	fs := flag.NewFlagSet("keys import", flag.ContinueOnError)
+	kind := fs.String("kind", keystore.KindNode, "node, finalizer or wallet")
+	in := fs.String("in", "", "plaintext key file (hex or base64)")
+	out := fs.String("out", "", "keystore file to create")
+	label := fs.String("label", "", "key label, e.g. a wallet address")
+	algorithm := fs.String("algorithm", "Ed25519", "Ed25519, or ECDSA (DER) for wallet keys")
+	kdfName := fs.String("kdf", keystore.KDFArgon2id, "argon2id or scrypt")
+	passFile := fs.String("passphrase-file", "", "file holding the passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || *out == "" {
+		return errors.New("-in and -out are required")
+	}
+	kdf, err := kdfByName(*kdfName)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	key, err := decodeKeyMaterial(data)
+	if err != nil {
+		return err
+	}
+	passphrase, err := keystorePassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+	var f *keystore.File
+	switch *algorithm {
+	case "Ed25519":
+		if len(key) == ed25519.SeedSize {
+			key = ed25519.NewKeyFromSeed(key)
+		}
+		f, err = keystore.EncryptEd25519(*kind, *label, key, passphrase, kdf)
+	case "ECDSA":
+		if *kind != keystore.KindWallet {
+			return errors.New("only wallet keys may be ECDSA")
+		}
+		f, err = keystore.Encrypt(*kind, *label, "ECDSA", "", key, passphrase, kdf)
+	default:
+		return fmt.Errorf("unsupported algorithm %q", *algorithm)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeNewKeystore(f, *out); err != nil {
+		return err
+	}
+	fmt.Printf("[KEYS] Imported %s key into %s; delete the plaintext %s\n", *kind, *out, *in)
+	return nil
+}
+
+func keysExport(args []string) error {
+	fs := flag.NewFlagSet("keys export", flag.ContinueOnError)
+	path := fs.String("keystore", "", "keystore file")
+	format := fs.String("format", "hex", "hex or base64")
+	passFile := fs.String("passphrase-file", "", "file holding the passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := keystore.Load(*path)
+	if err != nil {
+		return err
+	}
+	passphrase, err := keystorePassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+	key, err := f.Decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "hex":
+		fmt.Println(hex.EncodeToString(key))
+	case "base64":
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	fmt.Fprintln(os.Stderr, "[KEYS] WARNING: the private key above is unencrypted")
+	return nil
+}
+
+func keysRotate(args []string) error {
+	fs := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	path := fs.String("keystore", "", "keystore file to rotate in place")
+	kdfName := fs.String("kdf", keystore.KDFArgon2id, "argon2id or scrypt")
+	passFile := fs.String("passphrase-file", "", "file holding the current passphrase")
+	newPassFile := fs.String("new-passphrase-file", "", "file holding the new passphrase (defaults to the current one)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := keystore.Load(*path)
+	if err != nil {
+		return err
+	}
+	kdf, err := kdfByName(*kdfName)
+	if err != nil {
+		return err
+	}
+	passphrase, err := keystorePassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+	newPassphrase := passphrase
+	if *newPassFile != "" {
+		if newPassphrase, err = keystorePassphrase(*newPassFile); err != nil {
+			return err
+		}
+	}
+	oldKey, err := f.DecryptEd25519(passphrase)
+	if err != nil {
+		return err
+	}
+	newPub, newKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	next, err := keystore.EncryptEd25519(f.Kind, f.Label, newKey, newPassphrase, kdf)
+	if err != nil {
+		return err
+	}
+
+	// Keep the old keystore: blocks and signatures made with it must stay verifiable
+	retired := fmt.Sprintf("%s.%s.retired", *path, f.PublicKey[:16])
+	if err := f.Save(retired); err != nil {
+		return err
+	}
+	if f.Kind == keystore.KindNode {
+		rot, err := keystore.NewRotation(oldKey, newKey, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := keystore.SaveRotation(keystore.RotationPath(*path), rot); err != nil {
+			return err
+		}
+	}
+	if err := next.Save(*path); err != nil {
+		return err
+	}
+	fmt.Printf("[KEYS] Rotated %s key %s -> %x; old keystore kept as %s\n", f.Kind, f.PublicKey, []byte(newPub), retired)
+	switch f.Kind {
+	case keystore.KindNode:
+		fmt.Printf("[KEYS] The node announces the rotation (%s) to its peers on next start\n", keystore.RotationPath(*path))
+	case keystore.KindFinalizer:
+		fmt.Println("[KEYS] Replace the old key in FINALIZER_KEYS/FINALIZER_PUBKEY on every node")
+	}
+	return nil
+}
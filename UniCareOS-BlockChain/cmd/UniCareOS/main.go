@@ -9,10 +9,12 @@ import (
 	"io"
 	"strconv"
 	"time"
-	"net/http"
 	"encoding/json"	
 	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
     "encoding/base64"	
+	"encoding/hex"
 	"unicareos/api/server"
 	"unicareos/core/genesis"
 	"unicareos/core/networking"
@@ -21,9 +23,17 @@ import (
 	"unicareos/core" // For Ed25519 keys and signing
 	"unicareos/core/mempool"
 	"unicareos/core/chain"
+	"unicareos/core/blockchain"
+	"unicareos/core/anchor"
 	"unicareos/core/auth"
 	"unicareos/core/audit"
 	"unicareos/core/scan"
+	"unicareos/core/signer"
+	"unicareos/core/keystore"
+	"unicareos/core/did"
+	"unicareos/core/hl7"
+	"unicareos/core/ingest"
+	"unicareos/core/validation"
 	"strings"
 )
 // Minimal audit logger for Finalizer
@@ -51,17 +61,13 @@ func init() {
 	}
 }
 
-// isRetryableError returns true if the error is considered transient and worth retrying.
-func isRetryableError(err string) bool {
-	err = strings.ToLower(err)
-	if strings.Contains(err, "timeout") || strings.Contains(err, "network") {
-		return true
-	}
-	// Add more retryable error patterns as needed
-	return false // All others are considered non-retryable
-}
-
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(runKeys(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		os.Exit(runSchema(os.Args[2:]))
+	}
 	// Log to file as well as stdout
 	logFile, err := os.OpenFile("logs/unicareos-node.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -73,9 +79,58 @@ func main() {
 	scripts.ScanChain()
 
 	// === Node Key Management ===
-	pubKey, privKey, err := core.GenerateAndSaveKeypair()
-	if err != nil {
-		log.Fatalf("❌ Failed to load/generate Ed25519 keypair: %v", err)
+	// With PKCS11_MODULE set, the node, finalizer and wallet keys live on a PKCS#11 token (an HSM, or
+	// SoftHSM in development) and never enter process memory. Otherwise they are read from key files.
+	var keyToken *signer.PKCS11Token
+	var nodeSigner signer.Signer
+	var pubKey ed25519.PublicKey
+	var privKey ed25519.PrivateKey
+	if module := os.Getenv("PKCS11_MODULE"); module != "" {
+		pin := os.Getenv("PKCS11_PIN")
+		if pinFile := os.Getenv("PKCS11_PIN_FILE"); pinFile != "" {
+			data, err := os.ReadFile(pinFile)
+			if err != nil {
+				log.Fatalf("❌ Failed to read PKCS11_PIN_FILE: %v", err)
+			}
+			pin = strings.TrimSpace(string(data))
+		}
+		tokenLabel := os.Getenv("PKCS11_TOKEN_LABEL")
+		keyToken, err = signer.OpenPKCS11(signer.PKCS11Config{Module: module, TokenLabel: tokenLabel, PIN: pin})
+		if err != nil {
+			log.Fatalf("❌ Failed to open PKCS#11 token: %v", err)
+		}
+		defer keyToken.Close()
+		core.WalletKeys = keyToken
+		nodeKeyLabel := os.Getenv("NODE_KEY_LABEL")
+		if nodeKeyLabel == "" {
+			nodeKeyLabel = "node"
+		}
+		nodeSigner, err = keyToken.Signer(nodeKeyLabel)
+		if err != nil {
+			log.Fatalf("❌ Failed to load node key from PKCS#11 token: %v", err)
+		}
+		pubKey, _ = signer.PublicKey(nodeSigner)
+		fmt.Printf("[KEY] Node key %q held by PKCS#11 token %q\n", nodeKeyLabel, tokenLabel)
+	} else if path := os.Getenv("NODE_KEYSTORE"); path != "" {
+		// Encrypted keystore created with `UniCareOS keys new|import -kind node`
+		passphrase, err := keystorePassphrase("")
+		if err != nil {
+			log.Fatalf("❌ Node keystore: %v", err)
+		}
+		privKey, err = keystore.LoadEd25519(path, keystore.KindNode, passphrase)
+		if err != nil {
+			log.Fatalf("❌ Failed to unlock node keystore %s: %v", path, err)
+		}
+		pubKey = privKey.Public().(ed25519.PublicKey)
+	} else {
+		if os.Getenv("ENV") == "production" {
+			log.Fatalf("❌ Refusing to start in production: set NODE_KEYSTORE or PKCS11_MODULE; %s holds the node key in plaintext", core.PrivKeyFile)
+		}
+		pubKey, privKey, err = core.GenerateAndSaveKeypair()
+		if err != nil {
+			log.Fatalf("❌ Failed to load/generate Ed25519 keypair: %v", err)
+		}
+		fmt.Printf("[WARN] Node key read from plaintext %s; use NODE_KEYSTORE or PKCS11_MODULE outside development\n", core.PrivKeyFile)
 	}
 
 	// --- Initialize Authorizer for Ethos token verification (wallet verifier untouched) ---
@@ -199,6 +254,13 @@ func() {
 		fmt.Println(" Genesis block already exists.")
 	}
 
+	// === Patient record index: index blocks committed before the index existed ===
+	if n, err := blockchain.CatchUpRecordIndex(store); err != nil {
+		fmt.Printf("[INDEX] Failed to catch up the patient record index: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("[INDEX] Indexed medical records of %d stored block(s)\n", n)
+	}
+
 	// === Load genesis config for epoch settings ===
 	genesisCfg, err := genesis.LoadGenesisConfig("genesis.json")
 	if err != nil {
@@ -206,15 +268,66 @@ func() {
 	}
 	epochBlockCount := genesisCfg.InitialParams.EpochBlockCount
 
+	// === Schema registry: the v1 schema (MEDICAL_SCHEMA_PATH or the bundled one) must match the genesis schema hash ===
+	genesisSchema, err := validation.DefaultSchema(blockchain.GenesisSchemaVersion)
+	if err != nil {
+		log.Fatalf("❌ Failed to read the v1 record schema: %v", err)
+	}
+	if err := blockchain.RegisterGenesisSchema(store, genesisSchema, genesisCfg.InitialSchemaHash); err != nil {
+		log.Fatalf("❌ Record schema does not match genesis: %v", err)
+	}
+
 	// === Network ===
 	// --- Initialize ChainState and load epoch state ---
 	chainState := &state.ChainState{StateDB: store}
 	if err := chainState.LoadEpochState(); err != nil {
 		fmt.Printf("[EPOCH] Failed to load epoch state: %v\n", err)
 	}
+	// Records are validated at the height after the tip the network records in chainState
+	validation.UseSchemaSource(blockchain.NewSchemaRegistry(store, chainState))
+	fmt.Printf("[SCHEMA] %d record schema(s) registered; v1 is %s\n", len(blockchain.ListSchemas(store)), genesisCfg.InitialSchemaHash)
 	network := networking.NewNetwork(networkListenAddr, store, 8080, pubKey, privKey, chainState, epochBlockCount)
 	// Set block production interval for networking
 	network.BlockProductionInterval = blockProductionInterval
+	if nodeSigner != nil {
+		if err := network.UseSigner(nodeSigner); err != nil {
+			log.Fatalf("❌ Node key on the PKCS#11 token is unusable: %v", err)
+		}
+	}
+
+	// === P2P allowlist: only validator/full-node keys may connect ===
+	if network.Transport == nil {
+		log.Fatalf("❌ Node keypair cannot be used for the authenticated P2P transport")
+	}
+	peerKeysPath := os.Getenv("P2P_PEER_KEYS_FILE")
+	if peerKeysPath == "" {
+		peerKeysPath = "producers.json"
+	}
+	peerKeys, err := networking.LoadPeerKeySet(peerKeysPath)
+	if err != nil {
+		fmt.Printf("[P2P] Could not load peer keys from %s: %v\n", peerKeysPath, err)
+		peerKeys = networking.NewPeerKeySet()
+	}
+	for _, v := range genesisCfg.InitialValidators {
+		if k, err := hex.DecodeString(v.PubKey); err == nil && len(k) == ed25519.PublicKeySize {
+			peerKeys.Add(k)
+		} else if k, err := base64.StdEncoding.DecodeString(v.PubKey); err == nil && len(k) == ed25519.PublicKeySize {
+			peerKeys.Add(k)
+		}
+	}
+	peerKeys.Add(pubKey)
+	if os.Getenv("P2P_ALLOW_ANY_PEER") == "true" {
+		if os.Getenv("ENV") == "production" {
+			log.Fatalf("❌ Refusing to start in production: P2P_ALLOW_ANY_PEER=true admits any node key")
+		}
+		fmt.Println("\033[33m[P2P] WARNING: P2P_ALLOW_ANY_PEER=true, admitting any node key (dev only)\033[0m")
+		peerKeys.AllowAny = true
+	}
+	network.Transport.Keys = peerKeys
+	if n := network.LoadKeyRotations(); n > 0 {
+		fmt.Printf("[KEYS] Applied %d stored node key rotation(s)\n", n)
+	}
+	fmt.Printf("[P2P] %d node key(s) admitted for peer connections\n", peerKeys.Len())
 
 
 	// === Set recovered tip in network ===
@@ -244,56 +357,93 @@ func() {
 	mp := mempool.NewMempool(1000) // Main mempool instance
 	network.Mempool = mp
 
-	// === Background expiry worker for archiving expired TXs ===
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
-		defer ticker.Stop()
-		for {
-			<-ticker.C
-			before := len(mp.GetAllTxs())
-			mp.PurgeExpired(15 * time.Minute)
-			after := len(mp.GetAllTxs())
-			archived := before - after
-			if archived > 0 {
-				log.Printf("[MEMPOOL] Archived %d expired transaction(s) to ExpiredTxPool", archived)
-
-				// Auto-resubmit all expired transactions
-				expiredTxs := mp.ExpiredPool.ListExpiredTxs()
-				for _, expiredTx := range expiredTxs {
-					// Only auto-resubmit if this is the original transaction (not a descendant)
-					if strings.Contains(expiredTx.TxID, "-auto-resubmitted-") {
-						continue // skip all resubmitted descendants
-					}
-					if expiredTx.ResubmitCount >= 3 {
-						log.Printf("[MEMPOOL] Skipping auto-resubmission for %s (limit reached)", expiredTx.TxID)
-						continue
-					}
-					// Smarter error handling: only retry if LastError is retryable
-					if expiredTx.LastError != "" && !isRetryableError(expiredTx.LastError) {
-						log.Printf("[MEMPOOL] Not retrying %s due to non-retryable error: %s", expiredTx.TxID, expiredTx.LastError)
-						continue
-					}
-					// Resubmit the original transaction with the original TxID
-					payloadBytes, ok := expiredTx.Payload.([]byte)
-					if !ok {
-						// If the payload is not []byte, try to marshal it
-						payloadBytes, _ = json.Marshal(expiredTx.Payload)
-					}
-					resubmittedTx := mempool.Transaction{
-						TxID:      expiredTx.TxID,
-						Payload:   payloadBytes,
-						Timestamp: time.Now().Unix(),
-					}
-					if mp.AddTx(resubmittedTx) {
-						// Update the expiredTx in the pool and persist the new resubmission count
-						expiredTx.ResubmitCount++
-						mp.ExpiredPool.AddExpiredTx(expiredTx)
-						log.Printf("[MEMPOOL] Auto-resubmitted expired tx %s (attempt %d)", expiredTx.TxID, expiredTx.ResubmitCount)
-					}
-				}
+	// === Background expiry worker for archiving and resubmitting expired TXs ===
+	expiryCfg := mempool.DefaultExpiryConfig()
+	if val := os.Getenv("MEMPOOL_TX_MAX_AGE"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			expiryCfg.MaxAge = d
+		}
+	}
+	if val := os.Getenv("MEMPOOL_MAX_RESUBMITS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			expiryCfg.MaxRetries = n
+		}
+	}
+	if val := os.Getenv("MEMPOOL_RESUBMIT_BACKOFF"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			expiryCfg.BaseBackoff = d
+		}
+	}
+	if val := os.Getenv("MEMPOOL_NOTIFY_RECIPIENT"); val != "" {
+		expiryCfg.NotifyRecipient = val
+	}
+	expiryManager := mempool.NewExpiryManager(mp, expiryCfg)
+	expiryManager.Start()
+
+	// === Break-glass emergency access: EMERGENCY_CLINICIANS lists providerID=did:key pairs, identical on every node ===
+	network.EmergencyClinicians = map[string]string{}
+	for _, entry := range strings.Split(os.Getenv("EMERGENCY_CLINICIANS"), ",") {
+		providerID, clinicianDID, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || providerID == "" || clinicianDID == "" {
+			continue
+		}
+		if _, err := did.Ed25519Key(clinicianDID); err != nil {
+			fmt.Printf("\033[31m[ERROR] EMERGENCY_CLINICIANS entry for %s: %v\033[0m\n", providerID, err)
+			os.Exit(1)
+		}
+		network.EmergencyClinicians[providerID] = clinicianDID
+	}
+	// COMPLIANCE_REVIEWERS lists reviewerID=did:key pairs of officers who close break-glass reviews, identical on every node
+	network.ComplianceReviewers = map[string]string{}
+	for _, entry := range strings.Split(os.Getenv("COMPLIANCE_REVIEWERS"), ",") {
+		reviewerID, reviewerDID, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || reviewerID == "" || reviewerDID == "" {
+			continue
+		}
+		if _, err := did.Ed25519Key(reviewerDID); err != nil {
+			fmt.Printf("\033[31m[ERROR] COMPLIANCE_REVIEWERS entry for %s: %v\033[0m\n", reviewerID, err)
+			os.Exit(1)
+		}
+		network.ComplianceReviewers[reviewerID] = reviewerDID
+	}
+	reviewCfg := blockchain.DefaultReviewEscalationConfig()
+	if val := os.Getenv("EMERGENCY_REVIEW_DEADLINE"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			reviewCfg.Deadline = d
+		}
+	}
+	if val := os.Getenv("EMERGENCY_NOTIFY_RECIPIENT"); val != "" {
+		reviewCfg.NotifyRecipient = val
+	}
+	reviewEscalator := blockchain.NewReviewEscalator(store, reviewCfg)
+	reviewEscalator.Start()
+	fmt.Printf("[EMERGENCY] %d clinician(s) authorized to break glass, %d compliance reviewer(s); unreviewed accesses escalate to %s after %s\n", len(network.EmergencyClinicians), len(network.ComplianceReviewers), reviewCfg.NotifyRecipient, reviewCfg.Deadline)
+
+	// === Versioned P2P handshake: peers must share our chain ID and genesis block ===
+	network.Handshake.ChainID = genesisCfg.ChainID
+	if gb, err := store.GetGenesisBlock(); err == nil {
+		if g, err := block.Deserialize(gb); err == nil {
+			network.Handshake.GenesisID = g.BlockID
+		}
+	}
+	if os.Getenv("BLOCK_PRODUCER") == "1" {
+		network.Handshake.Role = networking.RoleValidator
+	}
+	if val := os.Getenv("P2P_DISABLE_FEATURES"); val != "" {
+		// Comma-separated, e.g. "compact-blocks" to keep full-block broadcast during a rolling upgrade
+		disabled := map[string]bool{}
+		for _, f := range strings.Split(val, ",") {
+			disabled[strings.TrimSpace(f)] = true
+		}
+		features := []string{}
+		for _, f := range network.Handshake.Features {
+			if !disabled[f] {
+				features = append(features, f)
 			}
 		}
-	}()
+		network.Handshake.Features = features
+	}
+	fmt.Printf("[P2P] Chain %s, genesis %x, protocol v%d-v%d, role %s, features %v\n", network.Handshake.ChainID, network.Handshake.GenesisID[:], networking.MinProtocolVersion, networking.ProtocolVersion, network.Handshake.Role, network.Handshake.Features)
 
 	err = network.Start()
 	if err != nil {
@@ -432,37 +582,76 @@ func() {
 		fmt.Println("[INFO] Block production is disabled. This node is running in lightweight mode.")
 	}
 
-	// === Mempool HTTP Endpoint ===
-	go func() {
-		mux := http.NewServeMux()
-		mux.HandleFunc("/mempool", func(w http.ResponseWriter, r *http.Request) {
-			if network.Mempool == nil {
-				w.WriteHeader(http.StatusServiceUnavailable)
-				w.Write([]byte("No mempool attached"))
-				return
-			}
-			txs := network.Mempool.GetAllTxs()
-			ids := make([]string, len(txs))
-			for i, tx := range txs {
-				ids[i] = tx.TxID
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(ids)
-		})
-		// Listen on a different port to avoid collision with main API (e.g., 8090)
-		fmt.Println("[MEMPOOL MONITOR] Serving /mempool on :8090")
-		http.ListenAndServe(":8090", mux)
-	}()
-
 	// === API Server ===
 
-	// === Setup PeerSet for GossipEngine ===
-	peerSet := mempool.NewPeerSet()
-	// Add Node B as a peer (this is Node A, so B is on :8082)
-	peerSet.AddPeer(mempool.Peer{ID: "node-b", Address: "localhost:8082"})
+	// === GossipEngine: peers come from the live P2P peer table ===
 	gossipEngine := mempool.NewGossipEngine([]string{}, mp)
-	gossipEngine.UpdatePeersFromSet(peerSet)
-	fmt.Printf("[GOSSIP DEBUG] Peers at startup: %v\n", gossipEngine.Peers)
+	gossipEngine.PeerSource = network.GossipPeers
+	gossipEngine.ListenPort = network.ListenPort()
+	gossipEngine.Client = network.Transport.HTTPClient()
+	gossipEngine.Scheme = "https"
+	gossipEngine.UsesInv = func(peer string) bool { return network.PeerSupports(peer, networking.FeatureTxInv) }
+	gossipEngine.TxIDOf = networking.TxIDOf
+	network.Gossip = gossipEngine
+
+	// === Peer discovery: seeds + persistent address book + PEX ===
+	for _, seed := range strings.Split(os.Getenv("P2P_SEEDS"), ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			network.AddrBook.Add(seed, nil, networking.AddrSourceSeed)
+		}
+	}
+	peerCfg := networking.DefaultPeerManagerConfig()
+	if val := os.Getenv("P2P_TARGET_OUTBOUND"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			peerCfg.TargetOutbound = n
+		}
+	}
+	if val := os.Getenv("P2P_DIAL_INTERVAL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			peerCfg.Interval = d
+		}
+	}
+	// === Node key rotation left by `keys rotate`: announce it so peers move our identity to the new key ===
+	if path := os.Getenv("NODE_KEYSTORE"); path != "" {
+		if rot, err := keystore.LoadRotation(keystore.RotationPath(path)); err == nil {
+			var addrs []string
+			for _, ka := range network.AddrBook.List() {
+				addrs = append(addrs, ka.Address)
+			}
+			go func() {
+				accepted, err := network.AnnounceKeyRotation(rot, addrs)
+				if err != nil {
+					fmt.Printf("[KEYS] Key rotation not announced: %v\n", err)
+					return
+				}
+				fmt.Printf("[KEYS] Key rotation %s -> %s accepted for inclusion by %d of %d known peer(s)\n", rot.OldKey, rot.NewKey, accepted, len(addrs))
+			}()
+		}
+	}
+	network.StartPeerManager(peerCfg)
+
+	// === Misbehavior scoring thresholds ===
+	if val := os.Getenv("P2P_SCORE_DISCONNECT"); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			network.Scores.Config.DisconnectThreshold = f
+		}
+	}
+	if val := os.Getenv("P2P_SCORE_BAN"); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			network.Scores.Config.BanThreshold = f
+		}
+	}
+	// === Ban audit retention ===
+	if val := os.Getenv("BAN_AUDIT_RETENTION"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			network.Bans.AuditRetention = d
+		}
+	}
+	if val := os.Getenv("BAN_AUDIT_MAX_ENTRIES"); val != "" {
+		if i, err := strconv.Atoi(val); err == nil {
+			network.Bans.MaxAuditEntries = i
+		}
+	}
 	forkChoice := chain.NewForkChoice(store)
 	// --- Finalizer wiring ---
 	finalizerPubKey := os.Getenv("FINALIZER_PUBKEY")
@@ -470,31 +659,218 @@ func() {
 	if finalizerPubKey != "" {
 		authorizedFinalizers = append(authorizedFinalizers, finalizerPubKey)
 	}
-	// Load and decode private key (never log or print)
-	var finalizerPrivKey ed25519.PrivateKey = nil
-	keyPath := os.Getenv("FINALIZER_PRIVATE_KEY_PATH")
-	if keyPath == "" {
-		keyPath = "finalizer_private.key"
+	// Load the finalizer key from the token, or decode it from its key file (never log or print)
+	var finalizerKey signer.Signer
+	if keyToken != nil {
+		finalizerKeyLabel := os.Getenv("FINALIZER_KEY_LABEL")
+		if finalizerKeyLabel == "" {
+			finalizerKeyLabel = "finalizer"
+		}
+		finalizerKey, err = keyToken.Signer(finalizerKeyLabel)
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] Failed to load finalizer key %q from PKCS#11 token: %v\033[0m\n", finalizerKeyLabel, err)
+			os.Exit(1)
+		}
+	} else if path := os.Getenv("FINALIZER_KEYSTORE"); path != "" {
+		passphrase, err := keystorePassphrase("")
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] Finalizer keystore: %v\033[0m\n", err)
+			os.Exit(1)
+		}
+		key, err := keystore.LoadEd25519(path, keystore.KindFinalizer, passphrase)
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] Failed to unlock finalizer keystore %s: %v\033[0m\n", path, err)
+			os.Exit(1)
+		}
+		finalizerKey = key
+	} else {
+		keyPath := os.Getenv("FINALIZER_PRIVATE_KEY_PATH")
+		if keyPath == "" {
+			keyPath = "finalizer_private.key"
+		}
+		privKeyB64, err := os.ReadFile(keyPath)
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] Failed to read finalizer_private.key at %s: %v\033[0m\n", keyPath, err)
+			os.Exit(1)
+		}
+		privKeyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(privKeyB64)))
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] Failed to base64 decode finalizer_private.key: %v\033[0m\n", err)
+			os.Exit(1)
+		}
+		if len(privKeyBytes) != ed25519.PrivateKeySize {
+			fmt.Printf("\033[31m[ERROR] finalizer_private.key is not 64 bytes after base64 decoding (got %d bytes)\033[0m\n", len(privKeyBytes))
+			os.Exit(1)
+		}
+		finalizerKey = ed25519.PrivateKey(privKeyBytes)
 	}
-	privKeyB64, err := os.ReadFile(keyPath)
-	if err != nil {
-		fmt.Printf("\033[31m[ERROR] Failed to read finalizer_private.key at %s: %v\033[0m\n", keyPath, err)
-		os.Exit(1)
+
+	// --- Epoch finalization quorum: FINALIZER_KEYS (comma-separated base64 keys) defaults to FINALIZER_PUBKEY ---
+	network.FinalizerKeys = authorizedFinalizers
+	if val := os.Getenv("FINALIZER_KEYS"); val != "" {
+		network.FinalizerKeys = nil
+		for _, k := range strings.Split(val, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				network.FinalizerKeys = append(network.FinalizerKeys, k)
+			}
+		}
 	}
-	privKeyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(privKeyB64)))
-	if err != nil {
-		fmt.Printf("\033[31m[ERROR] Failed to base64 decode finalizer_private.key: %v\033[0m\n", err)
-		os.Exit(1)
+	if val := os.Getenv("FINALIZER_QUORUM"); val != "" {
+		if q, err := strconv.Atoi(val); err == nil && q > 0 {
+			network.FinalizerQuorum = q
+		}
+	}
+	network.FinalizerKey = finalizerKey
+	quorum := network.FinalizerQuorum
+	if quorum == 0 {
+		quorum = blockchain.FinalizerQuorum(len(network.FinalizerKeys))
 	}
-	if len(privKeyBytes) != ed25519.PrivateKeySize {
-		fmt.Printf("\033[31m[ERROR] finalizer_private.key is not 64 bytes after base64 decoding (got %d bytes)\033[0m\n", len(privKeyBytes))
-		os.Exit(1)
+	if quorum > len(network.FinalizerKeys) {
+		fmt.Printf("\033[33m[EPOCH] WARNING: finalizer quorum %d exceeds the %d configured finalizer key(s); epochs cannot finalize\033[0m\n", quorum, len(network.FinalizerKeys))
 	}
+	fmt.Printf("[EPOCH] %d finalizer key(s), %d signature(s) required per epoch\n", len(network.FinalizerKeys), quorum)
 
-	finalizerPrivKey = privKeyBytes
+	// --- Schema governance: SCHEMA_GOVERNANCE_KEYS (comma-separated base64 keys) defaults to the finalizer keys ---
+	network.GovernanceKeys = network.FinalizerKeys
+	if val := os.Getenv("SCHEMA_GOVERNANCE_KEYS"); val != "" {
+		network.GovernanceKeys = nil
+		for _, k := range strings.Split(val, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				network.GovernanceKeys = append(network.GovernanceKeys, k)
+			}
+		}
+	}
+	if val := os.Getenv("SCHEMA_GOVERNANCE_QUORUM"); val != "" {
+		if q, err := strconv.Atoi(val); err == nil && q > 0 {
+			network.GovernanceQuorum = q
+		}
+	}
+	governanceQuorum := network.GovernanceQuorum
+	if governanceQuorum == 0 {
+		governanceQuorum = blockchain.FinalizerQuorum(len(network.GovernanceKeys))
+	}
+	fmt.Printf("[SCHEMA] %d governance key(s), %d signature(s) required per schema registration\n", len(network.GovernanceKeys), governanceQuorum)
+
+	// --- External anchoring of finalized epoch roots: ANCHOR_TSA_URL (RFC 3161) and/or ANCHOR_NOTARY_DIR ---
+	var anchorProviders []anchor.Provider
+	if val := os.Getenv("ANCHOR_TSA_URL"); val != "" {
+		tsa := &anchor.RFC3161Provider{URL: val}
+		if rootsPath := os.Getenv("ANCHOR_TSA_ROOTS"); rootsPath != "" {
+			pem, err := os.ReadFile(rootsPath)
+			if err != nil {
+				fmt.Printf("\033[31m[ERROR] Failed to read ANCHOR_TSA_ROOTS %s: %v\033[0m\n", rootsPath, err)
+				os.Exit(1)
+			}
+			tsa.Roots = x509.NewCertPool()
+			if !tsa.Roots.AppendCertsFromPEM(pem) {
+				fmt.Printf("\033[31m[ERROR] ANCHOR_TSA_ROOTS %s contains no PEM certificates\033[0m\n", rootsPath)
+				os.Exit(1)
+			}
+		}
+		anchorProviders = append(anchorProviders, tsa)
+	}
+	if val := os.Getenv("ANCHOR_NOTARY_DIR"); val != "" {
+		// Development/test notary; signs with the finalizer key
+		notary, err := anchor.NewFileNotary(val, finalizerKey)
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] File notary: %v\033[0m\n", err)
+			os.Exit(1)
+		}
+		anchorProviders = append(anchorProviders, notary)
+	}
+	var anchorer *anchor.Anchorer
+	if len(anchorProviders) > 0 {
+		anchorCfg := anchor.DefaultConfig()
+		if val := os.Getenv("ANCHOR_INTERVAL"); val != "" {
+			if d, err := time.ParseDuration(val); err == nil {
+				anchorCfg.Interval = d
+			}
+		}
+		anchorer = anchor.NewAnchorer(store, anchorCfg, anchorProviders...)
+		anchorer.Start()
+		fmt.Printf("[ANCHOR] Anchoring finalized epochs every %s with %v\n", anchorCfg.Interval, anchorer.Providers())
+	}
 
-	finalizer := block.NewFinalizer(authorizedFinalizers, &FinalizerAuditLogger{}, finalizerPrivKey)
+	finalizer := block.NewFinalizer(authorizedFinalizers, &FinalizerAuditLogger{}, finalizerKey)
+	network.Finalizer = finalizer // Accepted records are finalized on chain once a block includes them
 	apiServer := server.NewServer(store, network, apiListenAddr, gossipEngine, forkChoice, finalizer)
+	apiServer.ExpiryManager = expiryManager
+	apiServer.Anchorer = anchorer
+
+	// === FHIR ingestion: FACILITY_WALLET (wallet keystore file, or wallet address on the PKCS#11 token) signs ingested records ===
+	if ref := os.Getenv("FACILITY_WALLET"); ref != "" {
+		facility, err := loadFacility(ref, os.Getenv("FACILITY_PROVIDER_ID"))
+		if err != nil {
+			fmt.Printf("\033[31m[ERROR] Facility wallet %s: %v\033[0m\n", ref, err)
+			os.Exit(1)
+		}
+		apiServer.Facility = facility
+		fmt.Printf("[FHIR] Ingesting FHIR R4 records as provider %s, signed by wallet %s\n", facility.ProviderID, facility.Wallet.Address)
+	}
+
+	// === HL7 v2 over MLLP: HL7_SENDERS maps sending facility codes (MSH-4) to their wallets (keystore file or token address),
+	// HL7_SENDER_BINDINGS maps each code to the source CIDRs and/or client certificate ("sha256:<hex>") it must connect with ===
+	if addr := os.Getenv("HL7_MLLP_ADDR"); addr != "" {
+		hl7Cfg := hl7.Config{Addr: addr, Senders: map[string]*ingest.Facility{}, Bindings: map[string]hl7.Binding{}}
+		for _, entry := range strings.Split(os.Getenv("HL7_SENDERS"), ",") {
+			code, ref, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || code == "" || ref == "" {
+				continue
+			}
+			facility, err := loadFacility(ref, code)
+			if err != nil {
+				fmt.Printf("\033[31m[ERROR] HL7 sender %s wallet %s: %v\033[0m\n", code, ref, err)
+				os.Exit(1)
+			}
+			hl7Cfg.Senders[code] = facility
+		}
+		for _, entry := range strings.Split(os.Getenv("HL7_SENDER_BINDINGS"), ",") {
+			code, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || code == "" {
+				continue
+			}
+			binding, err := hl7.ParseBinding(spec)
+			if err != nil {
+				fmt.Printf("\033[31m[ERROR] HL7 sender %s binding: %v\033[0m\n", code, err)
+				os.Exit(1)
+			}
+			hl7Cfg.Bindings[code] = binding
+		}
+		// Client certificates are required over TLS; they are checked against HL7_TLS_CLIENT_CA if set, else only by their binding hash
+		if certPath, keyPath := os.Getenv("HL7_TLS_CERT_PATH"), os.Getenv("HL7_TLS_KEY_PATH"); certPath != "" && keyPath != "" {
+			cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+			if err != nil {
+				fmt.Printf("\033[31m[ERROR] HL7 TLS certificate: %v\033[0m\n", err)
+				os.Exit(1)
+			}
+			hl7Cfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}, ClientAuth: tls.RequireAnyClientCert}
+			if caPath := os.Getenv("HL7_TLS_CLIENT_CA"); caPath != "" {
+				pem, err := os.ReadFile(caPath)
+				if err != nil {
+					fmt.Printf("\033[31m[ERROR] Failed to read HL7_TLS_CLIENT_CA %s: %v\033[0m\n", caPath, err)
+					os.Exit(1)
+				}
+				hl7Cfg.TLS.ClientCAs = x509.NewCertPool()
+				if !hl7Cfg.TLS.ClientCAs.AppendCertsFromPEM(pem) {
+					fmt.Printf("\033[31m[ERROR] HL7_TLS_CLIENT_CA %s contains no PEM certificates\033[0m\n", caPath)
+					os.Exit(1)
+				}
+				hl7Cfg.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		if val := os.Getenv("HL7_TIMEZONE"); val != "" {
+			if hl7Cfg.Location, err = time.LoadLocation(val); err != nil {
+				fmt.Printf("\033[31m[ERROR] HL7_TIMEZONE: %v\033[0m\n", err)
+				os.Exit(1)
+			}
+		}
+		mllp := hl7.NewListener(hl7Cfg, store, network.SubmitMedicalRecord)
+		if err := mllp.Start(); err != nil {
+			log.Fatalf("❌ Failed to start HL7 MLLP listener on %s: %v", addr, err)
+		}
+		defer mllp.Stop()
+		fmt.Printf("[HL7] MLLP listener on %s for %d sending facility code(s)\n", mllp.Addr(), len(hl7Cfg.Senders))
+	}
 
 	err = apiServer.Start()
 	if err != nil {
@@ -504,3 +880,30 @@ func() {
 	// === Keep Alive ===
 	select {}
 }
+
+// loadFacility loads the wallet ingested records are signed with: the wallet address on the PKCS#11
+// token when one is configured, otherwise a wallet keystore file. providerID defaults to the wallet
+// address; FACILITY_RETENTION_POLICY applies to every facility.
+func loadFacility(ref, providerID string) (*ingest.Facility, error) {
+	var w core.Wallet
+	var err error
+	if core.WalletKeys != nil {
+		w, err = core.LoadWalletFromSecretsManager(ref)
+	} else {
+		var passphrase []byte
+		if passphrase, err = keystorePassphrase(""); err == nil {
+			w, err = core.LoadWalletFromKeystore(ref, passphrase)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &ingest.Facility{ProviderID: providerID, Wallet: w, RetentionPolicy: os.Getenv("FACILITY_RETENTION_POLICY")}
+	if f.ProviderID == "" {
+		f.ProviderID = w.Address
+	}
+	if !block.IsAuthorizedWallet(w.Address) {
+		fmt.Printf("\033[33m[INGEST] WARNING: facility wallet %s is not in authorized_wallets.json; its records will be rejected\033[0m\n", w.Address)
+	}
+	return f, nil
+}
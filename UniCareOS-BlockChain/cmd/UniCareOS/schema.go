@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/keystore"
+	"unicareos/core/validation"
+)
+
+// Schema governance: `UniCareOS schema sign`.
+// Governance key holders sign a schema registration in turn; once it carries quorum signatures an
+// operator submits it to /api/v1/schemas/register.
+
+const schemaUsage = `usage:
+  UniCareOS schema sign -schema FILE -version N -activate HEIGHT -keystore FILE -out FILE [-kind finalizer|node]
+  UniCareOS schema sign -in REGISTRATION -keystore FILE -out FILE [-kind finalizer|node]
+
+The first form starts a registration of schema FILE as major version N, active from block HEIGHT; the
+second adds a signature to an existing one. The keystore passphrase is read as for the keys commands.`
+
+// runSchema runs a schema subcommand and returns the process exit code
+func runSchema(args []string) int {
+	if len(args) == 0 || args[0] != "sign" {
+		fmt.Fprintln(os.Stderr, schemaUsage)
+		return 2
+	}
+	if err := schemaSign(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "[SCHEMA] %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func schemaSign(args []string) error {
+	fs := flag.NewFlagSet("schema sign", flag.ContinueOnError)
+	schemaFile := fs.String("schema", "", "JSON Schema document to register")
+	version := fs.String("version", "", "major schema version, e.g. 2")
+	activate := fs.Uint64("activate", 0, "block height the schema activates at")
+	in := fs.String("in", "", "registration to add a signature to")
+	out := fs.String("out", "", "file to write the signed registration to")
+	path := fs.String("keystore", "", "governance key keystore")
+	kind := fs.String("kind", keystore.KindFinalizer, "kind of key in the keystore")
+	passFile := fs.String("passphrase-file", "", "file holding the passphrase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || *path == "" {
+		return errors.New("-out and -keystore are required")
+	}
+	var reg block.SchemaRegistration
+	if *in != "" {
+		data, err := os.ReadFile(*in)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &reg); err != nil {
+			return fmt.Errorf("read registration: %w", err)
+		}
+	} else {
+		if *schemaFile == "" || *version == "" || *activate == 0 {
+			return errors.New("-schema, -version and -activate are required to start a registration")
+		}
+		schema, err := os.ReadFile(*schemaFile)
+		if err != nil {
+			return err
+		}
+		reg = block.SchemaRegistration{Version: *version, SchemaHash: validation.SchemaHash(schema), Schema: schema, ActivationHeight: *activate, Timestamp: time.Now().UTC()}
+	}
+	if err := reg.Verify(); err != nil && len(reg.Signatures) > 0 {
+		return err
+	}
+	passphrase, err := keystorePassphrase(*passFile)
+	if err != nil {
+		return err
+	}
+	key, err := keystore.LoadEd25519(*path, *kind, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := reg.Sign(key); err != nil {
+		return err
+	}
+	if err := reg.Verify(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("[SCHEMA] Signed registration %s of schema v%s %s (activates at height %d); %d signature(s)\n", reg.TxID(), reg.Version, reg.SchemaHash, reg.ActivationHeight, len(reg.Signatures))
+	return nil
+}
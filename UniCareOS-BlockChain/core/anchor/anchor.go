@@ -0,0 +1,241 @@
+// Package anchor timestamps finalized epoch roots with providers outside the consortium.
+//
+// The anchored digest of an epoch is the SHA-256 of its FinalizeEpochTx signing bytes (epoch number and
+// Merkle root), i.e. the raw bytes of the tx's TxID. A provider returns a token binding that digest to a
+// time; tokens are stored per epoch and provider and can be re-verified at any time, so proof that an
+// epoch existed does not depend on trusting the chain's own validators.
+package anchor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"unicareos/core/blockchain"
+	"unicareos/core/storage"
+	"unicareos/core/types"
+	"unicareos/core/worker"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Provider is an external timestamping service
+type Provider interface {
+	// Name identifies the provider in stored records; it must be stable across restarts
+	Name() string
+	// Timestamp obtains a token over a SHA-256 digest
+	Timestamp(digest []byte) ([]byte, error)
+	// Verify checks a token against digest and returns the time it attests
+	Verify(digest, token []byte) (time.Time, error)
+}
+
+// Record is a stored anchor of one epoch with one provider
+type Record struct {
+	Epoch       uint64    `json:"epoch"`
+	TxID        string    `json:"txID"` // FinalizeEpochTx anchored; hex of Digest
+	Root        string    `json:"root"`
+	Provider    string    `json:"provider"`
+	Digest      string    `json:"digest"` // Hex SHA-256 submitted to the provider
+	Token       []byte    `json:"token"`  // Provider token (an RFC 3161 TimeStampToken, DER, for a TSA)
+	AnchoredAt  time.Time `json:"anchoredAt"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// Verification is the result of re-checking a stored anchor
+type Verification struct {
+	Record
+	Valid bool      `json:"valid"`
+	Time  time.Time `json:"time,omitempty"` // Time attested by the token
+	Error string    `json:"error,omitempty"`
+}
+
+// Config controls the anchoring worker
+type Config struct {
+	Interval time.Duration // How often finalized epochs are checked for missing anchors
+}
+
+// DefaultConfig anchors new epochs every ten minutes
+func DefaultConfig() Config {
+	return Config{Interval: 10 * time.Minute}
+}
+
+// Anchorer submits finalized epoch roots to every provider and stores the tokens
+type Anchorer struct {
+	store     *storage.Storage
+	providers []Provider
+	cfg       Config
+	now       func() time.Time
+
+	mu   sync.Mutex // one anchoring pass at a time, so no epoch is submitted twice
+	loop worker.Periodic
+}
+
+// NewAnchorer creates an Anchorer for the node's store
+func NewAnchorer(store *storage.Storage, cfg Config, providers ...Provider) *Anchorer {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig().Interval
+	}
+	return &Anchorer{store: store, providers: providers, cfg: cfg, now: time.Now}
+}
+
+// Providers returns the names of the configured providers
+func (a *Anchorer) Providers() []string {
+	names := make([]string, len(a.providers))
+	for i, p := range a.providers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Start anchors the finalized epochs now, then every Interval until Stop is called
+func (a *Anchorer) Start() {
+	a.loop.Start(a.cfg.Interval, true, func() { a.Tick() })
+}
+
+// Stop ends periodic anchoring; epochs finalized meanwhile are anchored on the next Tick
+func (a *Anchorer) Stop() {
+	a.loop.Stop()
+}
+
+// Tick anchors every finalized epoch that a provider has not timestamped yet and returns the number of
+// new anchors. Failed submissions are retried on the next tick.
+func (a *Anchorer) Tick() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fins, err := blockchain.ListEpochFinalizations(a.store)
+	if err != nil {
+		log.Printf("[ANCHOR] Could not list finalized epochs: %v", err)
+		return 0
+	}
+	anchored := 0
+	for i := range fins {
+		fin := &fins[i]
+		digest, err := EpochDigest(fin)
+		if err != nil {
+			log.Printf("[ANCHOR] Epoch %d: %v", fin.EpochNumber, err)
+			continue
+		}
+		for _, p := range a.providers {
+			if _, err := a.get(fin.EpochNumber, p.Name()); err == nil {
+				continue
+			}
+			rec, err := a.anchor(fin, digest, p)
+			if err != nil {
+				log.Printf("[ANCHOR] Epoch %d with %s failed: %v", fin.EpochNumber, p.Name(), err)
+				continue
+			}
+			anchored++
+			log.Printf("[ANCHOR] Epoch %d root %q anchored with %s at %s", rec.Epoch, rec.Root, rec.Provider, rec.AnchoredAt.Format(time.RFC3339))
+		}
+	}
+	return anchored
+}
+
+func (a *Anchorer) anchor(fin *types.FinalizeEpochTx, digest []byte, p Provider) (*Record, error) {
+	submitted := a.now().UTC()
+	token, err := p.Timestamp(digest)
+	if err != nil {
+		return nil, err
+	}
+	at, err := p.Verify(digest, token)
+	if err != nil {
+		return nil, fmt.Errorf("provider returned a token that does not verify: %v", err)
+	}
+	rec := &Record{
+		Epoch:       fin.EpochNumber,
+		TxID:        fin.TxID,
+		Root:        fin.EpochSummaryHash,
+		Provider:    p.Name(),
+		Digest:      hex.EncodeToString(digest),
+		Token:       token,
+		AnchoredAt:  at.UTC(),
+		SubmittedAt: submitted,
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return rec, a.store.DB().Put(recordKey(rec.Epoch, rec.Provider), data, nil)
+}
+
+// Records returns the stored anchors of an epoch
+func (a *Anchorer) Records(epoch uint64) ([]Record, error) {
+	iter := a.store.DB().NewIterator(util.BytesPrefix([]byte(fmt.Sprintf("%s%d:", recordPrefix, epoch))), nil)
+	defer iter.Release()
+	out := []Record{}
+	for iter.Next() {
+		var rec Record
+		if err := json.Unmarshal(iter.Value(), &rec); err != nil {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, iter.Error()
+}
+
+// Verify re-checks every stored anchor of an epoch against the on-chain finalization and its provider
+func (a *Anchorer) Verify(epoch uint64) ([]Verification, error) {
+	recs, err := a.Records(epoch)
+	if err != nil {
+		return nil, err
+	}
+	fin, finErr := blockchain.GetEpochFinalization(a.store, epoch)
+	out := make([]Verification, 0, len(recs))
+	for _, rec := range recs {
+		v := Verification{Record: rec}
+		switch p := a.provider(rec.Provider); {
+		case finErr != nil:
+			v.Error = "epoch is not finalized on chain"
+		case fin.TxID != rec.TxID:
+			v.Error = fmt.Sprintf("anchored finalization %s differs from on-chain %s", rec.TxID, fin.TxID)
+		case p == nil:
+			v.Error = "provider is not configured on this node"
+		default:
+			digest, _ := EpochDigest(fin)
+			if hex.EncodeToString(digest) != rec.Digest {
+				v.Error = "stored digest does not match the finalization"
+			} else if at, err := p.Verify(digest, rec.Token); err != nil {
+				v.Error = err.Error()
+			} else {
+				v.Valid, v.Time = true, at.UTC()
+			}
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (a *Anchorer) provider(name string) Provider {
+	for _, p := range a.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (a *Anchorer) get(epoch uint64, provider string) (*Record, error) {
+	data, err := a.store.DB().Get(recordKey(epoch, provider), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	return &rec, json.Unmarshal(data, &rec)
+}
+
+// EpochDigest is the digest anchored for a finalization: SHA-256 of its signing bytes
+func EpochDigest(fin *types.FinalizeEpochTx) ([]byte, error) {
+	if fin.TxID != fin.ComputeTxID() {
+		return nil, fmt.Errorf("finalization txID does not match epoch %d and its root", fin.EpochNumber)
+	}
+	return hex.DecodeString(fin.TxID)
+}
+
+const recordPrefix = "epochAnchor:"
+
+func recordKey(epoch uint64, provider string) []byte {
+	return []byte(fmt.Sprintf("%s%d:%s", recordPrefix, epoch, provider))
+}
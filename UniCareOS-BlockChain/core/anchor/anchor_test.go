@@ -0,0 +1,241 @@
+package anchor
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"unicareos/core/blockchain"
+	"unicareos/core/storage"
+	"unicareos/core/types"
+)
+
+// finalizedStore returns a store holding on-chain finalizations of epochs 0 and 1
+func finalizedStore(t *testing.T) *storage.Storage {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	_, key, _ := ed25519.GenerateKey(nil)
+	for epoch, root := range []string{"", strings.Repeat("ab", 32)} {
+		tx := types.NewFinalizeEpochTx(uint64(epoch), root)
+		blockchain.SignEpochFinalization(tx, key)
+		tx.Status = "finalized"
+		if err := blockchain.SaveEpochFinalization(store, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// testTSA is a minimal RFC 3161 authority issuing ECDSA-signed tokens
+type testTSA struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	genTime  time.Time
+	tamper   func(info *tstInfo)
+	requests int
+}
+
+func newTestTSA(t *testing.T) (*testTSA, *x509.CertPool) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "Test TSA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &testTSA{cert: cert, key: key, genTime: time.Now().UTC().Truncate(time.Second)}, roots
+}
+
+func (tsa *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tsa.requests++
+	body, _ := io.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil || r.Header.Get("Content-Type") != "application/timestamp-query" {
+		resp, _ := asn1.Marshal(timeStampResp{Status: pkiStatusInfo{Status: 2, StatusString: []string{"bad request"}}})
+		w.Write(resp)
+		return
+	}
+	info := tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(int64(tsa.requests)),
+		GenTime:        tsa.genTime,
+		Nonce:          req.Nonce,
+	}
+	if tsa.tamper != nil {
+		tsa.tamper(&info)
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	resp, _ := asn1.Marshal(timeStampResp{Status: pkiStatusInfo{Status: 0}, TimeStampToken: asn1.RawValue{FullBytes: tsa.token(info)}})
+	w.Write(resp)
+}
+
+// token builds the CMS SignedData TimeStampToken for info
+func (tsa *testTSA) token(info tstInfo) []byte {
+	content, _ := asn1.Marshal(info)
+	sum := sha256.Sum256(content)
+	ct, _ := asn1.Marshal(oidTSTInfo)
+	md, _ := asn1.Marshal(sum[:])
+	attrs, _ := asn1.MarshalWithParams([]attribute{
+		{Type: oidAttrContentType, Values: []asn1.RawValue{{FullBytes: ct}}},
+		{Type: oidAttrDigest, Values: []asn1.RawValue{{FullBytes: md}}},
+	}, "set")
+	attrSum := sha256.Sum256(attrs)
+	sig, _ := ecdsa.SignASN1(rand.Reader, tsa.key, attrSum[:])
+	implicitAttrs := append([]byte{0xa0}, attrs[1:]...)
+	sid, _ := asn1.Marshal(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: tsa.cert.RawIssuer}, Serial: tsa.cert.SerialNumber})
+	certs, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw})
+	sha := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd, _ := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: content},
+		Certificates:     asn1.RawValue{FullBytes: certs},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha,
+			SignedAttrs:        asn1.RawValue{FullBytes: implicitAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          sig,
+		}},
+	})
+	token, _ := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	return token
+}
+
+func TestAnchorerTimestampsEveryFinalizedEpochOnce(t *testing.T) {
+	store := finalizedStore(t)
+	tsa, roots := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+	_, notaryKey, _ := ed25519.GenerateKey(nil)
+	notary, err := NewFileNotary(t.TempDir(), notaryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAnchorer(store, Config{}, &RFC3161Provider{URL: srv.URL, Roots: roots}, notary)
+
+	if n := a.Tick(); n != 4 {
+		t.Fatalf("anchored %d, want 2 epochs x 2 providers", n)
+	}
+	if n := a.Tick(); n != 0 || tsa.requests != 2 {
+		t.Fatalf("second tick anchored %d (TSA saw %d requests); anchors must not repeat", n, tsa.requests)
+	}
+	for epoch := uint64(0); epoch < 2; epoch++ {
+		vs, err := a.Verify(epoch)
+		if err != nil || len(vs) != 2 {
+			t.Fatalf("epoch %d: %d verifications, err %v", epoch, len(vs), err)
+		}
+		for _, v := range vs {
+			if !v.Valid || v.Time.IsZero() {
+				t.Errorf("epoch %d with %s: %s", epoch, v.Provider, v.Error)
+			}
+			if v.Provider == a.Providers()[0] && !v.Time.Equal(tsa.genTime) {
+				t.Errorf("TSA anchor attests %s, want %s", v.Time, tsa.genTime)
+			}
+		}
+	}
+
+	// A different node that does not trust the TSA root cannot validate the token
+	other := NewAnchorer(store, Config{}, &RFC3161Provider{URL: srv.URL, Roots: x509.NewCertPool()})
+	vs, _ := other.Verify(1)
+	for _, v := range vs {
+		if v.Valid {
+			t.Errorf("%s verified without the right trust anchor", v.Provider)
+		}
+	}
+}
+
+func TestRFC3161RejectsBadTokens(t *testing.T) {
+	tsa, roots := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+	p := &RFC3161Provider{URL: srv.URL, Roots: roots}
+	digest := sha256.Sum256([]byte("epoch"))
+
+	token, err := p.Timestamp(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := sha256.Sum256([]byte("other epoch"))
+	if _, err := p.Verify(other[:], token); err == nil {
+		t.Error("token verified for a different digest")
+	}
+	forged := append([]byte{}, token...)
+	forged[len(forged)-10] ^= 0xff // inside the signature
+	if _, err := p.Verify(digest[:], forged); err == nil {
+		t.Error("token with a corrupted signature verified")
+	}
+	if _, err := p.Verify(digest[:], []byte("not a token")); err == nil {
+		t.Error("garbage verified")
+	}
+
+	tsa.tamper = func(info *tstInfo) { info.Nonce = big.NewInt(7) }
+	if _, err := p.Timestamp(digest[:]); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("replayed response accepted: %v", err)
+	}
+	tsa.tamper = func(info *tstInfo) { info.MessageImprint.HashedMessage = other[:] }
+	if _, err := p.Timestamp(digest[:]); err == nil {
+		t.Error("token over another digest accepted")
+	}
+}
+
+func TestFileNotaryLedger(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	n, err := NewFileNotary(t.TempDir(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	n.Now = func() time.Time { return at }
+	digest := sha256.Sum256([]byte("epoch"))
+	token, err := n.Timestamp(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := n.Verify(digest[:], token); err != nil || !got.Equal(at) {
+		t.Fatalf("verify: %s, %v", got, err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	impostor := &FileNotary{Dir: n.Dir, Key: otherKey}
+	if _, err := impostor.Verify(digest[:], token); err == nil {
+		t.Error("token verified under another notary key")
+	}
+	at = at.Add(time.Hour) // Re-notarizing replaces the ledger entry
+	if _, err := n.Timestamp(digest[:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Verify(digest[:], token); err == nil {
+		t.Error("token no longer in the ledger still verified")
+	}
+}
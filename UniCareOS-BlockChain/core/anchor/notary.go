@@ -0,0 +1,114 @@
+package anchor
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"unicareos/core/signer"
+)
+
+// FileNotary is a local stand-in for a timestamping authority, for tests and development. It signs
+// (digest, time) with its own Ed25519 key and keeps every token it issues as a file in Dir; a token
+// verifies only if it is correctly signed and still present in that ledger.
+type FileNotary struct {
+	Dir string
+	Key signer.Signer
+	Now func() time.Time // Defaults to time.Now
+}
+
+type notaryStatement struct {
+	Digest string    `json:"digest"`
+	Time   time.Time `json:"time"`
+	Notary []byte    `json:"notary"` // Ed25519 public key
+}
+
+type notaryToken struct {
+	Statement json.RawMessage `json:"statement"`
+	Signature []byte          `json:"signature"`
+}
+
+// NewFileNotary creates a notary keeping its ledger in dir
+func NewFileNotary(dir string, key signer.Signer) (*FileNotary, error) {
+	if !signer.Usable(key) {
+		return nil, errors.New("file notary needs an Ed25519 signing key")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileNotary{Dir: dir, Key: key}, nil
+}
+
+// Name implements Provider
+func (n *FileNotary) Name() string {
+	return "file-notary"
+}
+
+// Timestamp implements Provider
+func (n *FileNotary) Timestamp(digest []byte) ([]byte, error) {
+	pub, ok := signer.PublicKey(n.Key)
+	if !ok {
+		return nil, signer.ErrNoKey
+	}
+	now := time.Now
+	if n.Now != nil {
+		now = n.Now
+	}
+	stmt, err := json.Marshal(notaryStatement{
+		Digest: hex.EncodeToString(digest),
+		Time:   now().UTC(),
+		Notary: pub,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.Sign(n.Key, stmt)
+	if err != nil {
+		return nil, err
+	}
+	token, err := json.Marshal(notaryToken{Statement: stmt, Signature: sig})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(n.ledgerPath(digest), token, 0600); err != nil {
+		return nil, fmt.Errorf("file notary ledger: %v", err)
+	}
+	return token, nil
+}
+
+// Verify implements Provider
+func (n *FileNotary) Verify(digest, token []byte) (time.Time, error) {
+	var tok notaryToken
+	if err := json.Unmarshal(token, &tok); err != nil {
+		return time.Time{}, fmt.Errorf("malformed notary token: %v", err)
+	}
+	pub, ok := signer.PublicKey(n.Key)
+	if !ok {
+		return time.Time{}, signer.ErrNoKey
+	}
+	if !ed25519.Verify(pub, tok.Statement, tok.Signature) {
+		return time.Time{}, errors.New("notary signature does not verify")
+	}
+	var stmt notaryStatement
+	if err := json.Unmarshal(tok.Statement, &stmt); err != nil {
+		return time.Time{}, fmt.Errorf("malformed notary statement: %v", err)
+	}
+	if stmt.Digest != hex.EncodeToString(digest) {
+		return time.Time{}, errors.New("token is for a different digest")
+	}
+	ledger, err := os.ReadFile(n.ledgerPath(digest))
+	if err != nil || !bytes.Equal(ledger, token) {
+		return time.Time{}, errors.New("token is not in the notary ledger")
+	}
+	return stmt.Time, nil
+}
+
+func (n *FileNotary) ledgerPath(digest []byte) string {
+	return filepath.Join(n.Dir, hex.EncodeToString(digest)+".json")
+}
@@ -0,0 +1,330 @@
+package anchor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// RFC 3161 (Time-Stamp Protocol) client. Requests carry a SHA-256 message imprint, a nonce and certReq, so
+// the returned TimeStampToken (a CMS SignedData over a TSTInfo) embeds the TSA certificate and can be
+// checked later with nothing but the TSA's root certificate (or with `openssl ts -verify`).
+
+var (
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrDigest      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// RFC3161Provider timestamps digests with an RFC 3161 Time Stamping Authority over HTTP
+type RFC3161Provider struct {
+	URL    string
+	Roots  *x509.CertPool // Trusted TSA roots; nil uses the system pool
+	Client *http.Client   // Defaults to a client with a 30s timeout
+}
+
+// Name implements Provider
+func (p *RFC3161Provider) Name() string {
+	return "rfc3161:" + p.URL
+}
+
+// Timestamp implements Provider: it requests a token over digest and checks it answers our request
+func (p *RFC3161Provider) Timestamp(digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}, HashedMessage: digest},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Post(p.URL, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA returned HTTP %d", resp.StatusCode)
+	}
+	var tsr timeStampResp
+	if rest, err := asn1.Unmarshal(body, &tsr); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed TimeStampResp: %v", err)
+	}
+	if tsr.Status.Status != 0 && tsr.Status.Status != 1 { // granted, grantedWithMods
+		return nil, fmt.Errorf("TSA rejected the request (status %d): %v", tsr.Status.Status, tsr.Status.StatusString)
+	}
+	token := tsr.TimeStampToken.FullBytes
+	info, err := p.parseToken(digest, token)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("TSA token does not carry our nonce")
+	}
+	return token, nil
+}
+
+// Verify implements Provider: the token must be signed by a TSA certificate chaining to Roots, with the
+// timestamping key usage, over a TSTInfo whose message imprint is digest
+func (p *RFC3161Provider) Verify(digest, token []byte) (time.Time, error) {
+	info, err := p.parseToken(digest, token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.GenTime, nil
+}
+
+func (p *RFC3161Provider) parseToken(digest, token []byte) (*tstInfo, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed TimeStampToken: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("TimeStampToken is not CMS SignedData")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("malformed SignedData: %v", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("SignedData does not carry a TSTInfo")
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("malformed TSTInfo: %v", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("token timestamps a different digest")
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected one signer, got %d", len(sd.SignerInfos))
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil || len(certs) == 0 {
+		return nil, errors.New("token carries no TSA certificate (was certReq honoured?)")
+	}
+	si := sd.SignerInfos[0]
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignerInfo(si, sd.EncapContentInfo.EContent, signer); err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		if c != signer {
+			intermediates.AddCert(c)
+		}
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         p.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("TSA certificate: %v", err)
+	}
+	return &info, nil
+}
+
+// findSigner picks the certificate named by a SignerIdentifier
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 { // subjectKeyIdentifier
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("no certificate matches the signer key identifier")
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("malformed signer identifier: %v", err)
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.Serial) == 0 {
+			return c, nil
+		}
+	}
+	return nil, errors.New("no certificate matches the signer issuer and serial")
+}
+
+// checkSignerInfo verifies the CMS signature over the TSTInfo (through the signed attributes, if any)
+func checkSignerInfo(si signerInfo, content []byte, cert *x509.Certificate) error {
+	hash, err := hashFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	signed := content
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		var attrs []attribute
+		if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &attrs, "set,tag:0"); err != nil {
+			return fmt.Errorf("malformed signed attributes: %v", err)
+		}
+		h := hash.New()
+		h.Write(content)
+		var digestOK, typeOK bool
+		for _, a := range attrs {
+			if len(a.Values) != 1 {
+				continue
+			}
+			switch {
+			case a.Type.Equal(oidAttrDigest):
+				var md []byte
+				if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &md); err == nil {
+					digestOK = bytes.Equal(md, h.Sum(nil))
+				}
+			case a.Type.Equal(oidAttrContentType):
+				var ct asn1.ObjectIdentifier
+				if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &ct); err == nil {
+					typeOK = ct.Equal(oidTSTInfo)
+				}
+			}
+		}
+		if !digestOK || !typeOK {
+			return errors.New("signed attributes do not match the TSTInfo")
+		}
+		// The signature covers the attributes as a SET OF, not the [0] IMPLICIT encoding
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+	var algo x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algo = map[crypto.Hash]x509.SignatureAlgorithm{crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA}[hash]
+	case *ecdsa.PublicKey:
+		algo = map[crypto.Hash]x509.SignatureAlgorithm{crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512}[hash]
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	}
+	if algo == x509.UnknownSignatureAlgorithm {
+		return errors.New("unsupported TSA key or digest algorithm")
+	}
+	if err := cert.CheckSignature(algo, signed, si.Signature); err != nil {
+		return fmt.Errorf("TSA signature does not verify: %v", err)
+	}
+	return nil
+}
+
+func hashFor(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
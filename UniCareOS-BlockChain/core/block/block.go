@@ -1,19 +1,33 @@
 package block
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"time"
+	"unicareos/core/keystore"
+	"unicareos/core/types"
 	"unicareos/types/ids"
 )
 
 // BanEvent now lives in types/blocktypes.go
+// A BanEvent is a network-wide ban proposal. It is applied by every node only once a quorum of
+// validators has signed its ProposalID (see networking.VerifyBanEvent).
 type BanEvent struct {
-	Address   string    `json:"address"`   // Banned peer IP or identifier
-	Expiry    string    `json:"expiry"`    // RFC3339 expiry time
-	Reason    string    `json:"reason"`    // Optional reason/evidence
-	Origin    string    `json:"origin"`    // Node ID or validator
-	BanCount  int       `json:"ban_count"` // Number of bans for this address
-	Timestamp time.Time `json:"timestamp"` // When the ban was issued
+	Address    string        `json:"address"`               // Banned peer IP, CIDR or node:<hex pubkey>
+	Expiry     string        `json:"expiry"`                // RFC3339 expiry time
+	Reason     string        `json:"reason"`                // Why the target is banned
+	Evidence   string        `json:"evidence,omitempty"`    // Evidence reference (log excerpt, block ID, incident ticket)
+	Origin     string        `json:"origin"`                // Proposing validator DID (ed25519:<hex>)
+	BanCount   int           `json:"ban_count"`             // Number of bans for this address
+	Timestamp  time.Time     `json:"timestamp"`             // When the ban was proposed
+	ProposalID string        `json:"proposal_id,omitempty"` // Hex hash of SigningBytes
+	Approvals  []BanApproval `json:"approvals,omitempty"`   // Validator signatures over ProposalID
+}
+
+// BanApproval is one validator's signature over a BanEvent's ProposalID
+type BanApproval struct {
+	Validator string `json:"validator"` // ed25519:<hex>
+	Signature []byte `json:"signature"`
 }
 
 // ExpiryTime parses the Expiry string and returns it as time.Time
@@ -21,6 +35,64 @@ func (b BanEvent) ExpiryTime() (time.Time, error) {
 	return time.Parse(time.RFC3339, b.Expiry)
 }
 
+// SigningBytes returns the canonical encoding of the proposal (approvals and ProposalID excluded)
+func (b BanEvent) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Address   string
+		Expiry    string
+		Reason    string
+		Evidence  string
+		Origin    string
+		Timestamp time.Time
+	}{b.Address, b.Expiry, b.Reason, b.Evidence, b.Origin, b.Timestamp.UTC()})
+	return data
+}
+
+// ComputeProposalID returns the hex hash that validators sign
+func (b BanEvent) ComputeProposalID() string {
+	id := ids.NewID(b.SigningBytes())
+	return hex.EncodeToString(id[:])
+}
+
+// BanEventsRoot commits a block to its ban events ("" when there are none, so existing block IDs are unchanged)
+func BanEventsRoot(events []BanEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+	var buf []byte
+	for _, e := range events {
+		buf = append(buf, e.ComputeProposalID()...)
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
+
+// EpochFinalizationsRoot commits a block to its epoch finalizations ("" when there are none)
+func EpochFinalizationsRoot(txs []types.FinalizeEpochTx) string {
+	if len(txs) == 0 {
+		return ""
+	}
+	var buf []byte
+	for _, tx := range txs {
+		buf = append(buf, tx.TxID...)
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
+
+// KeyRotationsRoot commits a block to its key rotations ("" when there are none)
+func KeyRotationsRoot(rotations []keystore.Rotation) string {
+	if len(rotations) == 0 {
+		return ""
+	}
+	var buf []byte
+	for _, r := range rotations {
+		data, _ := json.Marshal(r)
+		buf = append(buf, ids.NewID(data).String()...)
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
 
 type Block struct {
 	BlockID         ids.ID         `json:"block_id,omitempty"`      // Computed or cached block hash
@@ -35,6 +107,15 @@ type Block struct {
 	Events          []ChainedEvent `json:"events"`           // Block events/transactions
 	AuditLog        []AuditLogEntry `json:"auditLog,omitempty"` // Medical record submission audit log
 	BanEvents       []BanEvent     `json:"banEvents,omitempty"` // ✅ Ban events included in block
+	BanRoot         string         `json:"banRoot,omitempty"`   // BanEventsRoot(BanEvents); covered by BlockID
+	EpochFinalizations []types.FinalizeEpochTx `json:"epochFinalizations,omitempty"` // Quorum-signed epoch finalizations
+	FinalizationRoot string        `json:"finalizationRoot,omitempty"` // EpochFinalizationsRoot(EpochFinalizations); covered by BlockID
+	EventFinalizationRoot string   `json:"eventFinalizationRoot,omitempty"` // EventFinalizationsRoot(Events); covered by BlockID
+	ConsentRoot     string         `json:"consentRoot,omitempty"`   // ConsentRoot(Events); covered by BlockID
+	EmergencyAccessRoot string     `json:"emergencyAccessRoot,omitempty"` // EmergencyAccessRoot(Events); covered by BlockID
+	SchemaRoot      string         `json:"schemaRoot,omitempty"`    // SchemaRoot(Events); covered by BlockID
+	KeyRotations    []keystore.Rotation `json:"keyRotations,omitempty"` // Node key rotations taking effect with this block
+	KeyRotationRoot string         `json:"keyRotationRoot,omitempty"` // KeyRotationsRoot(KeyRotations); covered by BlockID
 	ExtraData       []byte         `json:"extraData,omitempty"`     // Reserved for future protocol flags (32 bytes)
 	ParentGasUsed   uint64         `json:"parentGasUsed,omitempty"` // For gas metrics (future)
 	StateRoot       string         `json:"stateRoot,omitempty"`     // Global state snapshot (future)
@@ -58,10 +139,18 @@ func (b *Block) ComputeID() ids.ID {
 		ParentGasUsed   uint64
 		StateRoot       string
 		Epoch           uint64
+		BanRoot         string `json:",omitempty"` // Omitted when empty so blocks without bans keep their IDs
+		FinalizationRoot string `json:",omitempty"`
+		EventFinalizationRoot string `json:",omitempty"`
+		ConsentRoot     string `json:",omitempty"`
+		EmergencyAccessRoot string `json:",omitempty"`
+		SchemaRoot      string `json:",omitempty"`
+		KeyRotationRoot string `json:",omitempty"`
 	}{
 		b.Version, b.ProtocolVersion, b.Height, b.PrevHash, b.MerkleRoot,
 		b.Timestamp, b.ValidatorDID, b.OpUnitsUsed, b.ExtraData, b.ParentGasUsed, b.StateRoot,
-		b.Epoch,
+		b.Epoch, b.BanRoot, b.FinalizationRoot, b.EventFinalizationRoot, b.ConsentRoot,
+		b.EmergencyAccessRoot, b.SchemaRoot, b.KeyRotationRoot,
 	}
 	data, _ := json.Marshal(header)
 	return ids.NewID(data)
@@ -0,0 +1,273 @@
+package block
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"unicareos/core/did"
+	"unicareos/core/signer"
+	"unicareos/types/ids"
+)
+
+// Consent transaction types: the EventType of the block event carrying one, and the type of its mempool payload
+const (
+	ConsentGrantType  = "consent_grant"
+	ConsentRevokeType = "consent_revoke"
+)
+
+// Grantee kinds
+const (
+	GranteeOrganization = "organization"
+	GranteeProvider     = "provider"
+)
+
+// ScopeAllRecords in a grant's scope covers every record type
+const ScopeAllRecords = "*"
+
+// Grantee is the organization or provider a patient lets read their records
+type Grantee struct {
+	Type string `json:"type"` // GranteeOrganization or GranteeProvider
+	ID   string `json:"id"`   // Organization or provider identifier, as carried in reader tokens
+}
+
+// ConsentGrant is a patient's signed permission for a grantee to read records of the listed types for
+// a purpose until Expiry. The patient signs SigningBytes with the key their DID resolves to.
+type ConsentGrant struct {
+	ConsentID  string    `json:"consentId"`  // Hex hash of SigningBytes
+	PatientDID string    `json:"patientDID"` // did:key of the patient
+	Grantee    Grantee   `json:"grantee"`
+	Scope      []string  `json:"scope"`   // Record types, or ScopeAllRecords
+	Purpose    string    `json:"purpose"` // Purpose of use, e.g. "treatment"
+	Expiry     time.Time `json:"expiry"`
+	Timestamp  time.Time `json:"timestamp"`
+	Signature  []byte    `json:"signature"` // Patient's Ed25519 signature over SigningBytes
+}
+
+// SigningBytes returns the canonical encoding the patient signs (ConsentID and Signature excluded)
+func (g *ConsentGrant) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type       string
+		PatientDID string
+		Grantee    Grantee
+		Scope      []string
+		Purpose    string
+		Expiry     time.Time
+		Timestamp  time.Time
+	}{ConsentGrantType, g.PatientDID, g.Grantee, g.Scope, g.Purpose, g.Expiry.UTC(), g.Timestamp.UTC()})
+	return data
+}
+
+// ComputeConsentID returns the hex hash identifying the grant
+func (g *ConsentGrant) ComputeConsentID() string {
+	id := ids.NewID(g.SigningBytes())
+	return hex.EncodeToString(id[:])
+}
+
+// Sign sets ConsentID and signs the grant with the patient's key
+func (g *ConsentGrant) Sign(key signer.Signer) error {
+	g.ConsentID = g.ComputeConsentID()
+	sig, err := signer.Sign(key, g.SigningBytes())
+	if err != nil {
+		return err
+	}
+	g.Signature = sig
+	return nil
+}
+
+// Verify checks the grant's fields and the patient's signature
+func (g *ConsentGrant) Verify() error {
+	switch g.Grantee.Type {
+	case GranteeOrganization, GranteeProvider:
+	default:
+		return fmt.Errorf("consent grantee type %q is not %s or %s", g.Grantee.Type, GranteeOrganization, GranteeProvider)
+	}
+	if g.Grantee.ID == "" {
+		return errors.New("consent grant names no grantee")
+	}
+	if len(g.Scope) == 0 {
+		return errors.New("consent grant has an empty scope")
+	}
+	if g.Purpose == "" {
+		return errors.New("consent grant states no purpose")
+	}
+	if g.Timestamp.IsZero() || !g.Expiry.After(g.Timestamp) {
+		return errors.New("consent grant must expire after it is issued")
+	}
+	if g.ConsentID != g.ComputeConsentID() {
+		return errors.New("consent ID does not match the grant")
+	}
+	if err := did.Verify(g.PatientDID, g.SigningBytes(), g.Signature); err != nil {
+		return fmt.Errorf("consent grant not signed by the patient: %v", err)
+	}
+	return nil
+}
+
+// Covers reports whether the grant's scope and purpose include reading a record of recordType.
+// An empty purpose matches any purpose.
+func (g *ConsentGrant) Covers(recordType, purpose string) bool {
+	if purpose != "" && purpose != g.Purpose {
+		return false
+	}
+	for _, s := range g.Scope {
+		if s == ScopeAllRecords || s == recordType {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsentRevoke withdraws a grant. Only the patient who granted it can revoke it.
+type ConsentRevoke struct {
+	ConsentID  string    `json:"consentId"`  // Grant being revoked
+	PatientDID string    `json:"patientDID"` // Must match the grant
+	Reason     string    `json:"reason,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Signature  []byte    `json:"signature"` // Patient's Ed25519 signature over SigningBytes
+}
+
+// SigningBytes returns the canonical encoding the patient signs (Signature excluded)
+func (r *ConsentRevoke) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type       string
+		ConsentID  string
+		PatientDID string
+		Reason     string
+		Timestamp  time.Time
+	}{ConsentRevokeType, r.ConsentID, r.PatientDID, r.Reason, r.Timestamp.UTC()})
+	return data
+}
+
+// Sign signs the revocation with the patient's key
+func (r *ConsentRevoke) Sign(key signer.Signer) error {
+	sig, err := signer.Sign(key, r.SigningBytes())
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// Verify checks the revocation's fields and the patient's signature
+func (r *ConsentRevoke) Verify() error {
+	if r.ConsentID == "" {
+		return errors.New("consent revocation names no grant")
+	}
+	if r.Timestamp.IsZero() {
+		return errors.New("consent revocation has no timestamp")
+	}
+	if err := did.Verify(r.PatientDID, r.SigningBytes(), r.Signature); err != nil {
+		return fmt.Errorf("consent revocation not signed by the patient: %v", err)
+	}
+	return nil
+}
+
+// ConsentPayload is the mempool payload of a consent transaction, and what a consent event carries
+type ConsentPayload struct {
+	Type   string         `json:"type"` // ConsentGrantType or ConsentRevokeType
+	Grant  *ConsentGrant  `json:"grant,omitempty"`
+	Revoke *ConsentRevoke `json:"revoke,omitempty"`
+}
+
+// ParseConsentPayload returns the consent transaction in a mempool payload, if it is one
+func ParseConsentPayload(payload []byte) (*ConsentPayload, bool) {
+	var p ConsentPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, false
+	}
+	if !p.wellFormed() {
+		return nil, false
+	}
+	return &p, true
+}
+
+// wellFormed reports whether p carries exactly the transaction its Type names
+func (p *ConsentPayload) wellFormed() bool {
+	return (p.Type == ConsentGrantType && p.Grant != nil && p.Revoke == nil) ||
+		(p.Type == ConsentRevokeType && p.Revoke != nil && p.Grant == nil)
+}
+
+// Verify checks the transaction's signature
+func (p *ConsentPayload) Verify() error {
+	if !p.wellFormed() {
+		return errors.New("not a consent_grant or consent_revoke transaction")
+	}
+	if p.Grant != nil {
+		return p.Grant.Verify()
+	}
+	return p.Revoke.Verify()
+}
+
+// ConsentID returns the grant the transaction creates or revokes
+func (p *ConsentPayload) ConsentID() string {
+	if p.Grant != nil {
+		return p.Grant.ConsentID
+	}
+	if p.Revoke != nil {
+		return p.Revoke.ConsentID
+	}
+	return ""
+}
+
+// TxID is the hex hash of the signed transaction, its mempool TxID and event ID source
+func (p *ConsentPayload) TxID() string {
+	var id ids.ID
+	switch {
+	case p.Grant != nil:
+		id = ids.NewID(append(p.Grant.SigningBytes(), p.Grant.Signature...))
+	case p.Revoke != nil:
+		id = ids.NewID(append(p.Revoke.SigningBytes(), p.Revoke.Signature...))
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// PatientDID returns the patient the transaction belongs to
+func (p *ConsentPayload) PatientDID() string {
+	if p.Grant != nil {
+		return p.Grant.PatientDID
+	}
+	if p.Revoke != nil {
+		return p.Revoke.PatientDID
+	}
+	return ""
+}
+
+// ConsentEvent is the block event recording a consent transaction
+func ConsentEvent(p *ConsentPayload) ChainedEvent {
+	evt := ChainedEvent{
+		EventID:   ids.NewID([]byte(p.TxID())),
+		EventType: p.Type,
+		PatientID: p.PatientDID(),
+		Consent:   p,
+	}
+	if p.Grant != nil {
+		evt.Description = "Consent grant " + p.Grant.ConsentID
+		evt.Timestamp = p.Grant.Timestamp
+	} else {
+		evt.Description = "Consent revocation of " + p.Revoke.ConsentID
+		evt.Timestamp = p.Revoke.Timestamp
+	}
+	return evt
+}
+
+// IsConsentEvent reports whether evt records a consent transaction
+func IsConsentEvent(evt ChainedEvent) bool {
+	return evt.EventType == ConsentGrantType || evt.EventType == ConsentRevokeType
+}
+
+// ConsentRoot commits a block to its consent events ("" when there are none)
+func ConsentRoot(events []ChainedEvent) string {
+	var buf []byte
+	for _, evt := range events {
+		if IsConsentEvent(evt) && evt.Consent != nil {
+			buf = append(buf, evt.Consent.TxID()...)
+		}
+	}
+	if len(buf) == 0 {
+		return ""
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,250 @@
+package block
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"unicareos/core/did"
+	"unicareos/core/signer"
+	"unicareos/types/ids"
+)
+
+// EmergencyAccessType is the EventType of a break-glass event and the type of its mempool payload
+const EmergencyAccessType = "emergency_access"
+
+// PriorityHigh marks events that need attention (break-glass access)
+const PriorityHigh = "high"
+
+// MaxEmergencyAccessWindow bounds how long a single break-glass access may last
+const MaxEmergencyAccessWindow = 24 * time.Hour
+
+// EmergencyAccess is a clinician's signed break-glass request: it lets the clinician read the patient's
+// records until Expiry regardless of consent, and is reviewed by compliance afterwards.
+type EmergencyAccess struct {
+	AccessID     string    `json:"accessId"`     // Hex hash of SigningBytes
+	PatientDID   string    `json:"patientDID"`   // Patient whose records are opened
+	ProviderID   string    `json:"providerId"`   // Clinician as named by the "sub" of their provider token
+	ClinicianDID string    `json:"clinicianDID"` // did:key the clinician signs with
+	Reason       string    `json:"reason"`       // Mandatory clinical justification
+	Expiry       time.Time `json:"expiry"`
+	Timestamp    time.Time `json:"timestamp"`
+	Signature    []byte    `json:"signature"` // Clinician's Ed25519 signature over SigningBytes
+}
+
+// SigningBytes returns the canonical encoding the clinician signs (AccessID and Signature excluded)
+func (a *EmergencyAccess) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type         string
+		PatientDID   string
+		ProviderID   string
+		ClinicianDID string
+		Reason       string
+		Expiry       time.Time
+		Timestamp    time.Time
+	}{EmergencyAccessType, a.PatientDID, a.ProviderID, a.ClinicianDID, a.Reason, a.Expiry.UTC(), a.Timestamp.UTC()})
+	return data
+}
+
+// ComputeAccessID returns the hex hash identifying the access
+func (a *EmergencyAccess) ComputeAccessID() string {
+	id := ids.NewID(a.SigningBytes())
+	return hex.EncodeToString(id[:])
+}
+
+// Sign sets AccessID and signs the access with the clinician's key
+func (a *EmergencyAccess) Sign(key signer.Signer) error {
+	a.AccessID = a.ComputeAccessID()
+	sig, err := signer.Sign(key, a.SigningBytes())
+	if err != nil {
+		return err
+	}
+	a.Signature = sig
+	return nil
+}
+
+// Verify checks the access's fields, its time box and the clinician's signature. Whether the clinician
+// is authorized to break glass is checked against the chain's configuration by blockchain.VerifyEmergencyAccess.
+func (a *EmergencyAccess) Verify() error {
+	if a.PatientDID == "" {
+		return errors.New("emergency access names no patient DID")
+	}
+	if a.ProviderID == "" {
+		return errors.New("emergency access names no provider")
+	}
+	if strings.TrimSpace(a.Reason) == "" {
+		return errors.New("emergency access requires a reason")
+	}
+	if a.Timestamp.IsZero() || !a.Expiry.After(a.Timestamp) {
+		return errors.New("emergency access must expire after it is requested")
+	}
+	if a.Expiry.Sub(a.Timestamp) > MaxEmergencyAccessWindow {
+		return fmt.Errorf("emergency access may last at most %s", MaxEmergencyAccessWindow)
+	}
+	if a.AccessID != a.ComputeAccessID() {
+		return errors.New("access ID does not match the request")
+	}
+	if err := did.Verify(a.ClinicianDID, a.SigningBytes(), a.Signature); err != nil {
+		return fmt.Errorf("emergency access not signed by the clinician: %v", err)
+	}
+	return nil
+}
+
+// TxID is the hex hash of the signed access, its mempool TxID and event ID source
+func (a *EmergencyAccess) TxID() string {
+	id := ids.NewID(append(a.SigningBytes(), a.Signature...))
+	return hex.EncodeToString(id[:])
+}
+
+// EmergencyAccessPayload is the mempool payload of a break-glass request
+type EmergencyAccessPayload struct {
+	Type            string           `json:"type"` // EmergencyAccessType
+	EmergencyAccess *EmergencyAccess `json:"emergencyAccess"`
+}
+
+// ParseEmergencyAccessPayload returns the break-glass request in a mempool payload, if it is one
+func ParseEmergencyAccessPayload(payload []byte) (*EmergencyAccess, bool) {
+	var p EmergencyAccessPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, false
+	}
+	if p.Type != EmergencyAccessType || p.EmergencyAccess == nil {
+		return nil, false
+	}
+	return p.EmergencyAccess, true
+}
+
+// EmergencyAccessEvent is the high-priority block event recording a break-glass access
+func EmergencyAccessEvent(a *EmergencyAccess) ChainedEvent {
+	return ChainedEvent{
+		EventID:         ids.NewID([]byte(a.TxID())),
+		EventType:       EmergencyAccessType,
+		Description:     "Emergency access: " + a.Reason,
+		Timestamp:       a.Timestamp,
+		PatientID:       a.PatientDID,
+		ProviderID:      a.ProviderID,
+		Priority:        PriorityHigh,
+		EmergencyAccess: a,
+	}
+}
+
+// EmergencyReviewType is the EventType of a review resolution event and the type of its mempool payload
+const EmergencyReviewType = "emergency_review"
+
+// Review outcomes
+const (
+	ReviewJustified   = "justified"   // The access was appropriate
+	ReviewUnjustified = "unjustified" // The access was not warranted and needs follow-up
+)
+
+// EmergencyReviewResolution is a compliance officer's signed outcome of the review of a break-glass access
+type EmergencyReviewResolution struct {
+	AccessID    string    `json:"accessId"` // Access under review
+	Outcome     string    `json:"outcome"`  // ReviewJustified or ReviewUnjustified
+	Notes       string    `json:"notes,omitempty"`
+	Reviewer    string    `json:"reviewer"`    // Compliance officer as named by the "sub" of their token
+	ReviewerDID string    `json:"reviewerDID"` // did:key the officer signs with
+	Timestamp   time.Time `json:"timestamp"`
+	Signature   []byte    `json:"signature"` // Officer's Ed25519 signature over SigningBytes
+}
+
+// SigningBytes returns the canonical encoding the officer signs (Signature excluded)
+func (r *EmergencyReviewResolution) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type        string
+		AccessID    string
+		Outcome     string
+		Notes       string
+		Reviewer    string
+		ReviewerDID string
+		Timestamp   time.Time
+	}{EmergencyReviewType, r.AccessID, r.Outcome, r.Notes, r.Reviewer, r.ReviewerDID, r.Timestamp.UTC()})
+	return data
+}
+
+// Sign signs the resolution with the officer's key
+func (r *EmergencyReviewResolution) Sign(key signer.Signer) error {
+	sig, err := signer.Sign(key, r.SigningBytes())
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// Verify checks the resolution's fields and the officer's signature. Whether the officer may resolve
+// reviews, and whether the review is still open, is checked by blockchain.VerifyEmergencyReview.
+func (r *EmergencyReviewResolution) Verify() error {
+	if r.AccessID == "" {
+		return errors.New("review resolution names no emergency access")
+	}
+	if r.Outcome != ReviewJustified && r.Outcome != ReviewUnjustified {
+		return fmt.Errorf("review outcome must be %s or %s", ReviewJustified, ReviewUnjustified)
+	}
+	if r.Reviewer == "" {
+		return errors.New("review names no reviewer")
+	}
+	if r.Timestamp.IsZero() {
+		return errors.New("review resolution has no timestamp")
+	}
+	if err := did.Verify(r.ReviewerDID, r.SigningBytes(), r.Signature); err != nil {
+		return fmt.Errorf("review resolution not signed by the reviewer: %v", err)
+	}
+	return nil
+}
+
+// TxID is the hex hash of the signed resolution, its mempool TxID and event ID source
+func (r *EmergencyReviewResolution) TxID() string {
+	id := ids.NewID(append(r.SigningBytes(), r.Signature...))
+	return hex.EncodeToString(id[:])
+}
+
+// EmergencyReviewPayload is the mempool payload of a review resolution
+type EmergencyReviewPayload struct {
+	Type       string                     `json:"type"` // EmergencyReviewType
+	Resolution *EmergencyReviewResolution `json:"resolution"`
+}
+
+// ParseEmergencyReviewPayload returns the review resolution in a mempool payload, if it is one
+func ParseEmergencyReviewPayload(payload []byte) (*EmergencyReviewResolution, bool) {
+	var p EmergencyReviewPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, false
+	}
+	if p.Type != EmergencyReviewType || p.Resolution == nil {
+		return nil, false
+	}
+	return p.Resolution, true
+}
+
+// EmergencyReviewEvent is the block event closing the review of a break-glass access
+func EmergencyReviewEvent(r *EmergencyReviewResolution) ChainedEvent {
+	return ChainedEvent{
+		EventID:         ids.NewID([]byte(r.TxID())),
+		EventType:       EmergencyReviewType,
+		Description:     "Emergency access " + r.AccessID + " reviewed as " + r.Outcome,
+		Timestamp:       r.Timestamp,
+		EmergencyReview: r,
+	}
+}
+
+// EmergencyAccessRoot commits a block to its break-glass and review events ("" when there are none)
+func EmergencyAccessRoot(events []ChainedEvent) string {
+	var buf []byte
+	for _, evt := range events {
+		switch {
+		case evt.EventType == EmergencyAccessType && evt.EmergencyAccess != nil:
+			buf = append(buf, evt.EmergencyAccess.TxID()...)
+		case evt.EventType == EmergencyReviewType && evt.EmergencyReview != nil:
+			buf = append(buf, evt.EmergencyReview.TxID()...)
+		}
+	}
+	if len(buf) == 0 {
+		return ""
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
@@ -17,16 +17,34 @@ type ChainedEvent struct {
 	Memories        []MemorySubmission `json:"memories,omitempty"`
 	PatientID       string             `json:"patientId,omitempty"`
 	ProviderID      string             `json:"providerId,omitempty"`
+	RecordType      string             `json:"recordType,omitempty"` // Record type of medical_record events, checked against consent scopes
+	Priority        string             `json:"priority,omitempty"`   // PriorityHigh on break-glass events
 	Epoch           uint64             `json:"epoch,omitempty"`
 	Finalized       bool               `json:"finalized,omitempty"`
     // HIPAA-compliant finalized event embedding
     PayloadHash string `json:"payloadHash,omitempty"` // Hash of encrypted payload (for Merkle root)
     PayloadRef  string `json:"payloadRef,omitempty"`  // URI or pointer to encrypted payload (off-chain)
+    SubmissionHash string `json:"submissionHash,omitempty"` // SubmissionHash of a medical_record event's submission; finalizations commit to it
 
     // Revision tracking fields
     RevisionReason string   `json:"revisionReason,omitempty"`
     RevisionOf     string   `json:"revisionOf,omitempty"`
     DocLineage     []string `json:"docLineage,omitempty"`
+
+    // Set on finalize_event events: the finalizer-signed transaction finalizing a medical_record event
+    FinalizeTx *FinalizeEventTx `json:"finalizeTx,omitempty"`
+
+    // Set on consent_grant and consent_revoke events: the patient-signed consent transaction
+    Consent *ConsentPayload `json:"consent,omitempty"`
+
+    // Set on emergency_access events: the clinician-signed break-glass request
+    EmergencyAccess *EmergencyAccess `json:"emergencyAccess,omitempty"`
+
+    // Set on emergency_review events: the compliance-signed resolution of a break-glass review
+    EmergencyReview *EmergencyReviewResolution `json:"emergencyReview,omitempty"`
+
+    // Set on schema_register events: the governance-signed schema registration
+    SchemaRegistration *SchemaRegistration `json:"schemaRegistration,omitempty"`
 }
 
 // ✅ Keep ONLY THIS here
@@ -8,6 +8,7 @@ import (
     "encoding/base64"
     "crypto/ed25519"
 
+	"unicareos/core/signer"
 	"unicareos/core/validation"
 )
 
@@ -15,7 +16,7 @@ import (
 type Finalizer struct {
 	authorizedFinalizers map[string]bool // Map of authorized finalizer public keys
 	auditLog            AuditLogger
-	privateKey          ed25519.PrivateKey // In-memory finalizer private key (never log)
+	key                 signer.Signer // Finalizer key, in memory or on a PKCS#11 token (never log)
 }
 
 // AuditLogger defines the interface for audit logging finalization events
@@ -24,7 +25,7 @@ type AuditLogger interface {
 }
 
 // NewFinalizer creates a new Finalizer with the given authorized finalizers
-func NewFinalizer(authorizedFinalizers []string, auditLog AuditLogger, privateKey ed25519.PrivateKey) *Finalizer {
+func NewFinalizer(authorizedFinalizers []string, auditLog AuditLogger, key signer.Signer) *Finalizer {
 	finalizers := make(map[string]bool)
 	for _, f := range authorizedFinalizers {
 		finalizers[f] = true
@@ -32,7 +33,7 @@ func NewFinalizer(authorizedFinalizers []string, auditLog AuditLogger, privateKe
 	return &Finalizer{
 		authorizedFinalizers: finalizers,
 		auditLog:            auditLog,
-		privateKey:          privateKey,
+		key:                 key,
 	}
 }
 
@@ -74,13 +75,13 @@ func (f *Finalizer) FinalizeEvent(
 	}
 
 	// 3. Stage signature if needed (NO STATE MUTATION)
-	if f.privateKey == nil {
-	
-	}
-	if f.privateKey != nil && tx.FinalizerSignature == "" && tx.TxID != "" && tx.Block.BlockHash != "" {
+	if signer.Usable(f.key) && tx.FinalizerSignature == "" && tx.TxID != "" && tx.Block.BlockHash != "" {
 		msg := append([]byte(tx.TxID), []byte(tx.Block.BlockHash)...)
 	
-		sig := ed25519.Sign(f.privateKey, msg)
+		sig, err := signer.Sign(f.key, msg)
+		if err != nil {
+			return fmt.Errorf("sign finalization: %w", err)
+		}
 	
 		commitSignature = base64.StdEncoding.EncodeToString(sig)
 	}
@@ -106,7 +107,8 @@ func (f *Finalizer) FinalizeEvent(
 	}
 	recordPayload := envelope["record"]
 
-	if err := validation.ValidateMedicalPayload(recordPayload); err != nil {
+	// Against the schema active where the record was included, not the one a newer block would use
+	if err := validation.ValidateMedicalPayloadAt(recordPayload, tx.Block.Height); err != nil {
 	
 		return err
 	}
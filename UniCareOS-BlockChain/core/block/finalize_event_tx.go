@@ -7,7 +7,10 @@ import (
 	"encoding/json"
 	"crypto/ed25519"
 	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/google/uuid"
+	"unicareos/types/ids"
 )
 
 
@@ -36,6 +39,7 @@ type FinalizeEventTx struct {
 	Timestamp          time.Time             `json:"timestamp"`
 	Status             FinalizationStatus    `json:"status"`
 	AuditLogID         string                `json:"auditLogId,omitempty"`
+	EventID            string                `json:"eventID,omitempty"` // Hex ID of the medical_record event in Block
 }
 
 // MarshalCanonical serializes FinalizeEventTx to canonical JSON (deterministic field order, no extra whitespace)
@@ -49,6 +53,7 @@ func (tx *FinalizeEventTx) MarshalCanonical() ([]byte, error) {
 		Timestamp           string         `json:"timestamp"`
 		Status              FinalizationStatus `json:"status"`
 		AuditLogID          string         `json:"auditLogId,omitempty"`
+		EventID             string         `json:"eventID,omitempty"`
 	}
 	c := canonicalFinalizeEventTx{
 		TxID: tx.TxID,
@@ -59,6 +64,7 @@ func (tx *FinalizeEventTx) MarshalCanonical() ([]byte, error) {
 		Timestamp: tx.Timestamp.UTC().Format(time.RFC3339Nano),
 		Status: tx.Status,
 		AuditLogID: tx.AuditLogID,
+		EventID: tx.EventID,
 	}
 	return json.Marshal(c)
 }
@@ -68,6 +74,7 @@ func (tx *FinalizeEventTx) MarshalCanonical() ([]byte, error) {
 type BlockReference struct {
 	BlockHash string `json:"blockHash"`
 	Epoch     uint64 `json:"epoch"`
+	Height    uint64 `json:"height"` // Height of the block; the record is validated against the schema active there
 }
 
 
@@ -148,3 +155,78 @@ func (tx *FinalizeEventTx) MarkFailed(reason string) {
 		tx.AuditLogID = "failed:" + reason
 	}
 }
+
+// FinalizeEventType is the EventType of a block event carrying a FinalizeEventTx, and the type of its mempool payload
+const FinalizeEventType = "finalize_event"
+
+// FinalizeEventTxID derives the TxID finalizing eventID in the block blockHash. The finalizer signs
+// TxID||BlockHash, so the signature also binds the event.
+func FinalizeEventTxID(eventID, blockHash string) string {
+	h := sha256.Sum256([]byte(FinalizeEventType + ":" + eventID + ":" + blockHash))
+	return hex.EncodeToString(h[:])
+}
+
+// FinalizeEventPayload is the mempool payload of a FinalizeEventTx. Medical record submissions carry no type.
+type FinalizeEventPayload struct {
+	Type          string           `json:"type"` // FinalizeEventType
+	FinalizeEvent *FinalizeEventTx `json:"finalizeEvent"`
+}
+
+// ParseFinalizeEventPayload returns the FinalizeEventTx in a mempool payload, if it is one
+func ParseFinalizeEventPayload(payload []byte) (*FinalizeEventTx, bool) {
+	var p FinalizeEventPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.Type != FinalizeEventType || p.FinalizeEvent == nil {
+		return nil, false
+	}
+	return p.FinalizeEvent, true
+}
+
+// SubmissionDigest replaces a submission in a FinalizeEventTx going on chain: the record itself stays
+// off chain, only its SubmissionHash is kept, matching the submissionHash of the medical_record event.
+func SubmissionDigest(payload []byte) json.RawMessage {
+	var submission MedicalRecordSubmission
+	if err := json.Unmarshal(payload, &submission); err != nil {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]string{"submissionHash": SubmissionHash(submission)})
+	return data
+}
+
+// SubmissionDigestHash returns the SubmissionHash a digest carries ("" if it is not a digest)
+func SubmissionDigestHash(digest json.RawMessage) string {
+	var d struct {
+		SubmissionHash string `json:"submissionHash"`
+	}
+	if err := json.Unmarshal(digest, &d); err != nil {
+		return ""
+	}
+	return d.SubmissionHash
+}
+
+// FinalizationEvent is the block event recording tx
+func FinalizationEvent(tx *FinalizeEventTx) ChainedEvent {
+	return ChainedEvent{
+		EventID:     ids.NewID([]byte(tx.TxID)),
+		EventType:   FinalizeEventType,
+		Description: "Finalization of medical record event " + tx.EventID,
+		Timestamp:   tx.Timestamp,
+		Finalized:   true,
+		PayloadHash: HashFinalizeEventTx(tx),
+		FinalizeTx:  tx,
+	}
+}
+
+// EventFinalizationsRoot commits a block to its finalize_event events ("" when there are none)
+func EventFinalizationsRoot(events []ChainedEvent) string {
+	var buf []byte
+	for _, evt := range events {
+		if evt.EventType == FinalizeEventType && evt.FinalizeTx != nil {
+			buf = append(buf, HashFinalizeEventTx(evt.FinalizeTx)...)
+		}
+	}
+	if len(buf) == 0 {
+		return ""
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
@@ -144,8 +144,8 @@ func SubmitRecordToBlock(submission MedicalRecordSubmission, block *Block) (Tran
 		return receipt, fmt.Errorf("unauthorized wallet: %s", submission.WalletAddress)
 	}
 
-	// 1. Validate the record (schema, required fields, etc.)
-	if err := validation.ValidateRecord(submission.Record); err != nil {
+	// 1. Validate the record (schema active at this height, required fields, etc.)
+	if err := validation.ValidateRecordAt(submission.Record, block.Height); err != nil {
 		receipt := TransactionReceipt{
 			TxID:        "", // Could generate a failed tx id if desired
 			BlockHash:   "",
@@ -153,6 +153,13 @@ func SubmitRecordToBlock(submission MedicalRecordSubmission, block *Block) (Tran
 			Status:      "failed",
 			Errors:      []string{"validation_failed: " + err.Error()},
 		}
+		if fieldErrs := validation.FieldErrors(err); fieldErrs != nil {
+			// One receipt error per offending field
+			receipt.Errors = receipt.Errors[:0]
+			for _, fe := range fieldErrs {
+				receipt.Errors = append(receipt.Errors, "validation_failed: "+fe.String())
+			}
+		}
 		LogSubmissionTrace(block, "", submission.WalletAddress, "failed", "Validation failed: "+err.Error(), submission.SubmissionTimestamp)
 		return receipt, err
 	}
@@ -253,6 +260,11 @@ func SubmitRecordToBlock(submission MedicalRecordSubmission, block *Block) (Tran
 		RevisionReason:  submission.RevisionReason,
 		RevisionOf:      submission.RevisionOf,
 		DocLineage:      docLineage,
+		PatientID:       submission.PatientDID(), // Consent is checked against the patient's DID
+		ProviderID:      recordString(submission.Record, "providerID", "providerId"),
+		RecordType:      submission.RecordType(),
+		PayloadHash:     recordString(submission.Record, "docHash"), // Locates the encrypted body in the payload store
+		SubmissionHash:  SubmissionHash(submission),
 		Finalized:       false, // New events are not finalized by default
 		// Add more fields as needed
 	}
@@ -285,6 +297,50 @@ func SubmitRecordToBlock(submission MedicalRecordSubmission, block *Block) (Tran
 	return receipt, nil // TODO: handle errors and status
 }
 
+// PatientDID returns the DID of the patient the submitted record belongs to
+func (s MedicalRecordSubmission) PatientDID() string {
+	return recordString(s.Record, "patientDID")
+}
+
+// RecordID returns the submitted record's recordId
+func (s MedicalRecordSubmission) RecordID() string {
+	return recordString(s.Record, "recordId")
+}
+
+// DocHash returns the docHash locating the submitted record's payload
+func (s MedicalRecordSubmission) DocHash() string {
+	return recordString(s.Record, "docHash")
+}
+
+// RecordType returns the submitted record's type
+func (s MedicalRecordSubmission) RecordType() string {
+	return recordString(s.Record, "recordType")
+}
+
+// recordString returns the first of keys present in record as a string
+func recordString(record map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := record[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// SubmissionHash is the hex SHA-256 of a submission as its author signed and sent it. DocLineage is left
+// out: the producer derives it from the chain.
+func SubmissionHash(submission MedicalRecordSubmission) string {
+	submission.DocLineage = nil
+	data, _ := json.Marshal(submission)
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// SubmissionEventID returns the ID of the medical_record event a submission becomes once included
+func SubmissionEventID(submission MedicalRecordSubmission) ids.ID {
+	return generateEventID(submission)
+}
+
 // generateEventID creates a unique event ID for a submission (stub).
 func generateEventID(submission MedicalRecordSubmission) ids.ID {
 	// TODO: Use a real hash of submission data for uniqueness
@@ -3,6 +3,7 @@ package block
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 )
 
 // MerkleRoot computes the Merkle root of a list of hashes (as hex strings).
@@ -34,9 +35,78 @@ func MerkleRoot(hashes []string) string {
 	return hashes[0]
 }
 
+// EventsRoot is the Merkle root of a block's events, each leaf the SHA-256 (hex) of the event's JSON.
+// It returns "" when there are no events.
+func EventsRoot(events []ChainedEvent) string {
+	hashes := make([]string, 0, len(events))
+	for _, evt := range events {
+		data, _ := json.Marshal(evt)
+		h := sha256.Sum256(data)
+		hashes = append(hashes, hex.EncodeToString(h[:]))
+	}
+	return MerkleRoot(hashes)
+}
+
 // HashFinalizeEventTx returns the SHA-256 hash (hex) of the canonical JSON of the FinalizeEventTx
 func HashFinalizeEventTx(tx *FinalizeEventTx) string {
 	data, _ := tx.MarshalCanonical()
 	h := sha256.Sum256(data)
 	return hex.EncodeToString(h[:])
 }
+
+// MerkleStep is one sibling on the path from a leaf to the Merkle root
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // Sibling is hashed before (left of) the running hash
+}
+
+// MerkleProof returns the sibling path for hashes[index], following MerkleRoot's pairing rules
+// (an odd last node is hashed with itself). It returns nil if index is out of range.
+func MerkleProof(hashes []string, index int) []MerkleStep {
+	if index < 0 || index >= len(hashes) {
+		return nil
+	}
+	path := []MerkleStep{}
+	level := hashes
+	for len(level) > 1 {
+		switch {
+		case index%2 == 1:
+			path = append(path, MerkleStep{Hash: level[index-1], Left: true})
+		case index+1 < len(level):
+			path = append(path, MerkleStep{Hash: level[index+1]})
+		default:
+			path = append(path, MerkleStep{Hash: level[index]})
+		}
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, hashPair(level[i], right))
+		}
+		level = next
+		index /= 2
+	}
+	return path
+}
+
+// VerifyMerkleProof reports whether leaf and path hash up to root
+func VerifyMerkleProof(leaf string, path []MerkleStep, root string) bool {
+	h := leaf
+	for _, s := range path {
+		if s.Left {
+			h = hashPair(s.Hash, h)
+		} else {
+			h = hashPair(h, s.Hash)
+		}
+	}
+	return h != "" && h == root
+}
+
+func hashPair(left, right string) string {
+	h := sha256.New()
+	h.Write([]byte(left))
+	h.Write([]byte(right))
+	return hex.EncodeToString(h.Sum(nil))
+}
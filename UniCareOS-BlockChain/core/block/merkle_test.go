@@ -0,0 +1,31 @@
+package block
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProofVerifiesEveryLeaf(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var hashes []string
+		for i := 0; i < n; i++ {
+			hashes = append(hashes, HashFinalizeEventTx(&FinalizeEventTx{TxID: fmt.Sprintf("tx-%d-%d", n, i)}))
+		}
+		root := MerkleRoot(hashes)
+		for i := range hashes {
+			path := MerkleProof(hashes, i)
+			if !VerifyMerkleProof(hashes[i], path, root) {
+				t.Fatalf("%d leaves: proof for leaf %d does not reach the root", n, i)
+			}
+			if n > 1 && VerifyMerkleProof(hashes[(i+1)%n], path, root) && hashes[(i+1)%n] != hashes[i] {
+				t.Errorf("%d leaves: proof for leaf %d also verifies leaf %d", n, i, (i+1)%n)
+			}
+		}
+	}
+	if MerkleProof([]string{"a"}, 1) != nil || MerkleProof(nil, 0) != nil {
+		t.Error("out-of-range index returned a proof")
+	}
+	if VerifyMerkleProof("", nil, "") {
+		t.Error("empty leaf verified against the empty root")
+	}
+}
@@ -0,0 +1,131 @@
+package block
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"unicareos/core/signer"
+	"unicareos/core/types"
+	"unicareos/core/validation"
+	"unicareos/types/ids"
+)
+
+// SchemaRegisterType is the EventType of a schema registration event and the type of its mempool payload
+const SchemaRegisterType = "schema_register"
+
+var schemaVersionPattern = regexp.MustCompile(`^[1-9][0-9]*$`)
+
+// SchemaRegistration is a governance transaction registering a medical record schema: from
+// ActivationHeight on, records whose schemaVersion has major Version are validated against Schema.
+// A quorum of governance keys signs SigningBytes.
+type SchemaRegistration struct {
+	Version          string                     `json:"version"`    // Major version, e.g. "2"
+	SchemaHash       string                     `json:"schemaHash"` // validation.SchemaHash(Schema)
+	Schema           []byte                     `json:"schema"`     // JSON Schema document
+	ActivationHeight uint64                     `json:"activationHeight"`
+	Timestamp        time.Time                  `json:"timestamp"`
+	Signatures       []types.FinalizerSignature `json:"signatures"` // Governance key signatures over SigningBytes
+}
+
+// SigningBytes returns the canonical encoding governance keys sign; the schema is covered by its hash
+func (r *SchemaRegistration) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type             string
+		Version          string
+		SchemaHash       string
+		ActivationHeight uint64
+		Timestamp        time.Time
+	}{SchemaRegisterType, r.Version, r.SchemaHash, r.ActivationHeight, r.Timestamp.UTC()})
+	return data
+}
+
+// TxID is the hex hash of SigningBytes, so signatures over the same registration merge under one ID
+func (r *SchemaRegistration) TxID() string {
+	id := ids.NewID(r.SigningBytes())
+	return hex.EncodeToString(id[:])
+}
+
+// Sign adds key's signature to the registration
+func (r *SchemaRegistration) Sign(key signer.Signer) error {
+	pub, ok := signer.PublicKey(key)
+	if !ok {
+		return errors.New("governance key is not an Ed25519 key")
+	}
+	sig, err := signer.Sign(key, r.SigningBytes())
+	if err != nil {
+		return err
+	}
+	r.Signatures = append(r.Signatures, types.FinalizerSignature{PubKey: base64.StdEncoding.EncodeToString(pub), Signature: base64.StdEncoding.EncodeToString(sig)})
+	return nil
+}
+
+// Verify checks the registration's fields and that Schema is a JSON Schema matching SchemaHash. The
+// signatures are checked against the governance keys by blockchain.VerifySchemaRegistration.
+func (r *SchemaRegistration) Verify() error {
+	if !schemaVersionPattern.MatchString(r.Version) {
+		return fmt.Errorf("schema version %q is not a major version number", r.Version)
+	}
+	if r.Timestamp.IsZero() {
+		return errors.New("schema registration has no timestamp")
+	}
+	if validation.SchemaHash(r.Schema) != r.SchemaHash {
+		return errors.New("schema does not match its hash")
+	}
+	if err := validation.CheckSchema(r.Schema); err != nil {
+		return err
+	}
+	if len(r.Signatures) == 0 {
+		return errors.New("schema registration carries no governance signature")
+	}
+	return nil
+}
+
+// SchemaRegisterPayload is the mempool payload of a schema registration
+type SchemaRegisterPayload struct {
+	Type         string              `json:"type"` // SchemaRegisterType
+	Registration *SchemaRegistration `json:"registration"`
+}
+
+// ParseSchemaRegisterPayload returns the schema registration in a mempool payload, if it is one
+func ParseSchemaRegisterPayload(payload []byte) (*SchemaRegistration, bool) {
+	var p SchemaRegisterPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, false
+	}
+	if p.Type != SchemaRegisterType || p.Registration == nil {
+		return nil, false
+	}
+	return p.Registration, true
+}
+
+// SchemaRegisterEvent is the block event recording a schema registration
+func SchemaRegisterEvent(r *SchemaRegistration) ChainedEvent {
+	return ChainedEvent{
+		EventID:            ids.NewID([]byte(r.TxID())),
+		EventType:          SchemaRegisterType,
+		Description:        fmt.Sprintf("Schema v%s %s registered, active from height %d", r.Version, r.SchemaHash, r.ActivationHeight),
+		Timestamp:          r.Timestamp,
+		SchemaRegistration: r,
+	}
+}
+
+// SchemaRoot commits a block to its schema registrations, signatures included ("" when there are none)
+func SchemaRoot(events []ChainedEvent) string {
+	var buf []byte
+	for _, evt := range events {
+		if evt.EventType == SchemaRegisterType && evt.SchemaRegistration != nil {
+			data, _ := json.Marshal(evt.SchemaRegistration)
+			buf = append(buf, data...)
+		}
+	}
+	if len(buf) == 0 {
+		return ""
+	}
+	id := ids.NewID(buf)
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/storage"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Consent state.
+// Patients grant and revoke read access with signed consent transactions. Every node applies them when
+// the block carrying them is committed, so the state is the same everywhere and changes only from the
+// block that includes a transaction: a revocation waiting in the mempool does not yet take effect.
+
+// Errors returned by VerifyConsent that do not make a transaction permanently invalid
+var (
+	ErrConsentDuplicate = errors.New("consent transaction already applied")
+	ErrConsentUnknown   = errors.New("consent grant not on chain")
+)
+
+const (
+	consentPrefix        = "consent:"
+	patientConsentPrefix = "consentByPatient:"
+)
+
+// ConsentRecord is a grant as committed on chain, with its revocation if any
+type ConsentRecord struct {
+	Grant        *block.ConsentGrant `json:"grant"`
+	IncludedIn   string              `json:"includedIn"` // Block carrying the grant
+	Height       uint64              `json:"height"`
+	Revoked      bool                `json:"revoked,omitempty"`
+	RevokedIn    string              `json:"revokedIn,omitempty"` // Block carrying the revocation
+	RevokedAt    time.Time           `json:"revokedAt,omitempty"`
+	RevokeReason string              `json:"revokeReason,omitempty"`
+}
+
+// Active reports whether the grant is unrevoked and unexpired at t
+func (c *ConsentRecord) Active(t time.Time) bool {
+	return !c.Revoked && t.Before(c.Grant.Expiry)
+}
+
+// VerifyConsent checks a consent transaction for inclusion in a block timestamped at: the patient's
+// signature, that a grant is new and unexpired, and that a revocation withdraws an unrevoked grant of
+// the same patient. ErrConsentUnknown means the grant may simply not be on chain yet.
+func VerifyConsent(store *storage.Storage, p *block.ConsentPayload, at time.Time) error {
+	if err := p.Verify(); err != nil {
+		return err
+	}
+	if p.Grant != nil {
+		if _, err := GetConsent(store, p.Grant.ConsentID); err == nil {
+			return fmt.Errorf("%w: grant %s", ErrConsentDuplicate, p.Grant.ConsentID)
+		}
+		if !at.Before(p.Grant.Expiry) {
+			return fmt.Errorf("consent grant %s expired at %s", p.Grant.ConsentID, p.Grant.Expiry.Format(time.RFC3339))
+		}
+		return nil
+	}
+	rec, err := GetConsent(store, p.Revoke.ConsentID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrConsentUnknown, p.Revoke.ConsentID)
+	}
+	if rec.Grant.PatientDID != p.Revoke.PatientDID {
+		return fmt.Errorf("consent %s belongs to another patient", p.Revoke.ConsentID)
+	}
+	if rec.Revoked {
+		return fmt.Errorf("%w: %s was revoked in block %s", ErrConsentDuplicate, p.Revoke.ConsentID, rec.RevokedIn)
+	}
+	return nil
+}
+
+// ApplyConsent records a verified consent transaction included in blockID at height
+func ApplyConsent(store *storage.Storage, p *block.ConsentPayload, blockID string, height uint64) error {
+	if p.Grant != nil {
+		rec := &ConsentRecord{Grant: p.Grant, IncludedIn: blockID, Height: height}
+		if err := saveConsent(store, rec); err != nil {
+			return err
+		}
+		return store.DB().Put([]byte(patientConsentPrefix+p.Grant.PatientDID+":"+p.Grant.ConsentID), nil, nil)
+	}
+	rec, err := GetConsent(store, p.Revoke.ConsentID)
+	if err != nil {
+		return err
+	}
+	rec.Revoked, rec.RevokedIn, rec.RevokedAt, rec.RevokeReason = true, blockID, p.Revoke.Timestamp, p.Revoke.Reason
+	return saveConsent(store, rec)
+}
+
+// RevertConsent undoes ApplyConsent of p by blockID when that block is rolled back: a grant it carried
+// is removed, a revocation it carried is lifted. State written by other blocks is left alone.
+func RevertConsent(store *storage.Storage, p *block.ConsentPayload, blockID string) error {
+	if p.Grant != nil {
+		rec, err := GetConsent(store, p.Grant.ConsentID)
+		if err != nil || rec.IncludedIn != blockID {
+			return nil
+		}
+		if err := store.DB().Delete([]byte(consentPrefix+p.Grant.ConsentID), nil); err != nil {
+			return err
+		}
+		return store.DB().Delete([]byte(patientConsentPrefix+p.Grant.PatientDID+":"+p.Grant.ConsentID), nil)
+	}
+	rec, err := GetConsent(store, p.Revoke.ConsentID)
+	if err != nil || !rec.Revoked || rec.RevokedIn != blockID {
+		return nil
+	}
+	rec.Revoked, rec.RevokedIn, rec.RevokedAt, rec.RevokeReason = false, "", time.Time{}, ""
+	return saveConsent(store, rec)
+}
+
+func saveConsent(store *storage.Storage, rec *ConsentRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return store.DB().Put([]byte(consentPrefix+rec.Grant.ConsentID), data, nil)
+}
+
+// GetConsent returns the on-chain grant consentID
+func GetConsent(store *storage.Storage, consentID string) (*ConsentRecord, error) {
+	data, err := store.DB().Get([]byte(consentPrefix+consentID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec ConsentRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// PatientConsents returns every grant a patient made, oldest first, including revoked and expired ones
+func PatientConsents(store *storage.Storage, patientDID string) []*ConsentRecord {
+	prefix := []byte(patientConsentPrefix + patientDID + ":")
+	iter := store.DB().NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	var out []*ConsentRecord
+	for iter.Next() {
+		if rec, err := GetConsent(store, string(iter.Key()[len(prefix):])); err == nil {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Height < out[j].Height })
+	return out
+}
+
+// FindConsent returns an active grant letting one of grantees read the patient's records of recordType
+// for purpose at t, or nil
+func FindConsent(store *storage.Storage, patientDID string, grantees []block.Grantee, recordType, purpose string, t time.Time) *ConsentRecord {
+	if patientDID == "" || len(grantees) == 0 {
+		return nil
+	}
+	for _, rec := range PatientConsents(store, patientDID) {
+		if !rec.Active(t) || !rec.Grant.Covers(recordType, purpose) {
+			continue
+		}
+		for _, g := range grantees {
+			if g == rec.Grant.Grantee {
+				return rec
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/storage"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Break-glass emergency access.
+// An authorized clinician's signed EmergencyAccess opens a patient's records to them until its expiry,
+// regardless of consent, from the block that includes it. Applying it also opens a review item; a
+// compliance officer closes it with a signed EmergencyReviewResolution that is applied once a block
+// includes it, and ReviewEscalator notifies while it stays open.
+
+// Emergency access errors
+var (
+	ErrEmergencyAccessDuplicate = errors.New("emergency access already applied") // VerifyEmergencyAccess: already on chain
+	ErrEmergencyAccessUnknown   = errors.New("emergency access not on chain")
+	ErrEmergencyReviewClosed    = errors.New("emergency access already reviewed")
+)
+
+// Review outcomes
+const (
+	ReviewPending     = "pending"
+	ReviewJustified   = block.ReviewJustified
+	ReviewUnjustified = block.ReviewUnjustified
+)
+
+// reviewMu serialises updates of emergency access records, so an escalation cannot overwrite a resolution
+var reviewMu sync.Mutex
+
+const (
+	emergencyPrefix        = "emergency:"
+	patientEmergencyPrefix = "emergencyByPatient:"
+	pendingReviewPrefix    = "emergencyReviewPending:"
+)
+
+// EmergencyReview is the compliance review of one break-glass access
+type EmergencyReview struct {
+	Status          string    `json:"status"` // ReviewPending, ReviewJustified or ReviewUnjustified
+	Reviewer        string    `json:"reviewer,omitempty"`
+	Notes           string    `json:"notes,omitempty"`
+	ReviewedAt      time.Time `json:"reviewedAt,omitempty"`
+	ResolvedIn      string    `json:"resolvedIn,omitempty"`  // Block carrying the resolution
+	Escalations     int       `json:"escalations,omitempty"` // Notifications sent while pending
+	LastEscalatedAt time.Time `json:"lastEscalatedAt,omitempty"`
+}
+
+// EmergencyAccessRecord is a break-glass access as committed on chain, with its review
+type EmergencyAccessRecord struct {
+	Access     *block.EmergencyAccess `json:"access"`
+	IncludedIn string                 `json:"includedIn"` // Block carrying the access
+	Height     uint64                 `json:"height"`
+	AppliedAt  time.Time              `json:"appliedAt"` // Timestamp of that block
+	Review     EmergencyReview        `json:"review"`
+}
+
+// Active reports whether the access is open at t
+func (r *EmergencyAccessRecord) Active(t time.Time) bool {
+	return t.Before(r.Access.Expiry)
+}
+
+// VerifyEmergencyAccess checks a break-glass request for inclusion in a block timestamped at: the
+// clinician's signature, that clinicians maps its ProviderID to the signing DID, and that it is new and
+// unexpired. clinicians must be configured identically on every node.
+func VerifyEmergencyAccess(store *storage.Storage, a *block.EmergencyAccess, clinicians map[string]string, at time.Time) error {
+	if err := a.Verify(); err != nil {
+		return err
+	}
+	if did, ok := clinicians[a.ProviderID]; !ok || did != a.ClinicianDID {
+		return fmt.Errorf("%s (%s) is not authorized for emergency access", a.ProviderID, a.ClinicianDID)
+	}
+	if _, err := GetEmergencyAccess(store, a.AccessID); err == nil {
+		return fmt.Errorf("%w: %s", ErrEmergencyAccessDuplicate, a.AccessID)
+	}
+	if !at.Before(a.Expiry) {
+		return fmt.Errorf("emergency access %s expired at %s", a.AccessID, a.Expiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ApplyEmergencyAccess records a verified access included in blockID and opens its review
+func ApplyEmergencyAccess(store *storage.Storage, a *block.EmergencyAccess, blockID string, height uint64, at time.Time) error {
+	rec := &EmergencyAccessRecord{Access: a, IncludedIn: blockID, Height: height, AppliedAt: at, Review: EmergencyReview{Status: ReviewPending}}
+	if err := saveEmergencyAccess(store, rec); err != nil {
+		return err
+	}
+	if err := store.DB().Put([]byte(patientEmergencyPrefix+a.PatientDID+":"+a.AccessID), nil, nil); err != nil {
+		return err
+	}
+	return store.DB().Put([]byte(pendingReviewPrefix+a.AccessID), nil, nil)
+}
+
+// RevertEmergencyAccess removes an access recorded by blockID, with its review, when that block is
+// rolled back
+func RevertEmergencyAccess(store *storage.Storage, a *block.EmergencyAccess, blockID string) error {
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+	rec, err := GetEmergencyAccess(store, a.AccessID)
+	if err != nil || rec.IncludedIn != blockID {
+		return nil
+	}
+	for _, key := range []string{emergencyPrefix + a.AccessID, patientEmergencyPrefix + a.PatientDID + ":" + a.AccessID, pendingReviewPrefix + a.AccessID} {
+		if err := store.DB().Delete([]byte(key), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveEmergencyAccess(store *storage.Storage, rec *EmergencyAccessRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return store.DB().Put([]byte(emergencyPrefix+rec.Access.AccessID), data, nil)
+}
+
+// GetEmergencyAccess returns the on-chain access accessID with its review
+func GetEmergencyAccess(store *storage.Storage, accessID string) (*EmergencyAccessRecord, error) {
+	data, err := store.DB().Get([]byte(emergencyPrefix+accessID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec EmergencyAccessRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// PatientEmergencyAccesses returns every break-glass access to a patient's records, oldest first
+func PatientEmergencyAccesses(store *storage.Storage, patientDID string) []*EmergencyAccessRecord {
+	return emergencyAccessesUnder(store, []byte(patientEmergencyPrefix+patientDID+":"))
+}
+
+// PendingEmergencyReviews returns the accesses compliance has not reviewed yet, oldest first
+func PendingEmergencyReviews(store *storage.Storage) []*EmergencyAccessRecord {
+	return emergencyAccessesUnder(store, []byte(pendingReviewPrefix))
+}
+
+// ListEmergencyAccesses returns every break-glass access on chain, oldest first
+func ListEmergencyAccesses(store *storage.Storage) []*EmergencyAccessRecord {
+	iter := store.DB().NewIterator(util.BytesPrefix([]byte(emergencyPrefix)), nil)
+	defer iter.Release()
+	var out []*EmergencyAccessRecord
+	for iter.Next() {
+		var rec EmergencyAccessRecord
+		if err := json.Unmarshal(iter.Value(), &rec); err == nil {
+			out = append(out, &rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Height < out[j].Height })
+	return out
+}
+
+// emergencyAccessesUnder loads the accesses whose IDs end the keys under prefix
+func emergencyAccessesUnder(store *storage.Storage, prefix []byte) []*EmergencyAccessRecord {
+	iter := store.DB().NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	var out []*EmergencyAccessRecord
+	for iter.Next() {
+		if rec, err := GetEmergencyAccess(store, string(iter.Key()[len(prefix):])); err == nil {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Height < out[j].Height })
+	return out
+}
+
+// FindEmergencyAccess returns an access open at t letting providerID read the patient's records, or nil
+func FindEmergencyAccess(store *storage.Storage, patientDID, providerID string, t time.Time) *EmergencyAccessRecord {
+	if patientDID == "" || providerID == "" {
+		return nil
+	}
+	for _, rec := range PatientEmergencyAccesses(store, patientDID) {
+		if rec.Access.ProviderID == providerID && rec.Active(t) {
+			return rec
+		}
+	}
+	return nil
+}
+
+// VerifyEmergencyReview checks a review resolution for inclusion in a block: the officer's signature,
+// that reviewers maps its Reviewer to the signing DID, and that the review is still open. reviewers must
+// be configured identically on every node.
+func VerifyEmergencyReview(store *storage.Storage, r *block.EmergencyReviewResolution, reviewers map[string]string) error {
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	if did, ok := reviewers[r.Reviewer]; !ok || did != r.ReviewerDID {
+		return fmt.Errorf("%s (%s) is not authorized to review emergency access", r.Reviewer, r.ReviewerDID)
+	}
+	rec, err := GetEmergencyAccess(store, r.AccessID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrEmergencyAccessUnknown, r.AccessID)
+	}
+	if rec.Review.Status != ReviewPending {
+		return fmt.Errorf("%w: %s was found %s by %s", ErrEmergencyReviewClosed, r.AccessID, rec.Review.Status, rec.Review.Reviewer)
+	}
+	return nil
+}
+
+// ResolveEmergencyReview closes the pending review of a verified resolution included in blockID
+func ResolveEmergencyReview(store *storage.Storage, r *block.EmergencyReviewResolution, blockID string) (*EmergencyAccessRecord, error) {
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+	rec, err := GetEmergencyAccess(store, r.AccessID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEmergencyAccessUnknown, r.AccessID)
+	}
+	if rec.Review.Status != ReviewPending {
+		return nil, fmt.Errorf("%w: %s was found %s by %s", ErrEmergencyReviewClosed, r.AccessID, rec.Review.Status, rec.Review.Reviewer)
+	}
+	rec.Review.Status, rec.Review.Reviewer, rec.Review.Notes = r.Outcome, r.Reviewer, r.Notes
+	rec.Review.ReviewedAt, rec.Review.ResolvedIn = r.Timestamp.UTC(), blockID
+	if err := saveEmergencyAccess(store, rec); err != nil {
+		return nil, err
+	}
+	if err := store.DB().Delete([]byte(pendingReviewPrefix+r.AccessID), nil); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ReopenEmergencyReview undoes ResolveEmergencyReview of r by blockID when that block is rolled back.
+// Escalations sent meanwhile are kept.
+func ReopenEmergencyReview(store *storage.Storage, r *block.EmergencyReviewResolution, blockID string) error {
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+	rec, err := GetEmergencyAccess(store, r.AccessID)
+	if err != nil || rec.Review.ResolvedIn != blockID {
+		return nil
+	}
+	rec.Review.Status, rec.Review.Reviewer, rec.Review.Notes = ReviewPending, "", ""
+	rec.Review.ReviewedAt, rec.Review.ResolvedIn = time.Time{}, ""
+	if err := saveEmergencyAccess(store, rec); err != nil {
+		return err
+	}
+	return store.DB().Put([]byte(pendingReviewPrefix+r.AccessID), nil, nil)
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"unicareos/core/notify"
+	"unicareos/core/storage"
+	"unicareos/core/worker"
+)
+
+// ReviewEscalationConfig controls when unreviewed break-glass accesses are escalated
+type ReviewEscalationConfig struct {
+	Deadline        time.Duration // Time after inclusion before an unreviewed access is escalated, and between escalations
+	CheckInterval   time.Duration // How often the worker runs
+	NotifyRecipient string        // Who is told about overdue reviews
+}
+
+// DefaultReviewEscalationConfig escalates accesses left unreviewed for a day
+func DefaultReviewEscalationConfig() ReviewEscalationConfig {
+	return ReviewEscalationConfig{
+		Deadline:        24 * time.Hour,
+		CheckInterval:   10 * time.Minute,
+		NotifyRecipient: "compliance",
+	}
+}
+
+// ReviewEscalator notifies about break-glass accesses whose review is overdue, repeating every Deadline
+// until they are resolved
+type ReviewEscalator struct {
+	store *storage.Storage
+	cfg   ReviewEscalationConfig
+
+	now    func() time.Time
+	notify func(notify.Notification)
+
+	loop worker.Periodic
+}
+
+// NewReviewEscalator creates a ReviewEscalator for the node's store
+func NewReviewEscalator(store *storage.Storage, cfg ReviewEscalationConfig) *ReviewEscalator {
+	def := DefaultReviewEscalationConfig()
+	if cfg.Deadline <= 0 {
+		cfg.Deadline = def.Deadline
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = def.CheckInterval
+	}
+	return &ReviewEscalator{store: store, cfg: cfg, now: time.Now, notify: notify.Notify}
+}
+
+// Config returns the escalator's configuration
+func (e *ReviewEscalator) Config() ReviewEscalationConfig {
+	return e.cfg
+}
+
+// Start looks for overdue reviews every CheckInterval until Stop is called
+func (e *ReviewEscalator) Start() {
+	e.loop.Start(e.cfg.CheckInterval, false, func() { e.Tick() })
+}
+
+// Stop ends escalation; reviews still overdue are escalated on the next Tick
+func (e *ReviewEscalator) Stop() {
+	e.loop.Stop()
+}
+
+// Tick escalates every pending review that is overdue and returns how many it escalated
+func (e *ReviewEscalator) Tick() int {
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+	now := e.now()
+	escalated := 0
+	for _, rec := range PendingEmergencyReviews(e.store) {
+		since := rec.AppliedAt
+		if !rec.Review.LastEscalatedAt.IsZero() {
+			since = rec.Review.LastEscalatedAt
+		}
+		if now.Sub(since) < e.cfg.Deadline {
+			continue
+		}
+		rec.Review.Escalations++
+		rec.Review.LastEscalatedAt = now.UTC()
+		if err := saveEmergencyAccess(e.store, rec); err != nil {
+			log.Printf("[EMERGENCY] Could not record escalation of %s: %v", rec.Access.AccessID, err)
+			continue
+		}
+		a := rec.Access
+		log.Printf("[EMERGENCY] Review of emergency access %s overdue (escalation %d)", a.AccessID, rec.Review.Escalations)
+		if e.notify != nil {
+			e.notify(notify.Notification{
+				TxID:      a.AccessID,
+				Reason:    fmt.Sprintf("unreviewed emergency access by %s to %s's records since block %d: %s", a.ProviderID, a.PatientDID, rec.Height, a.Reason),
+				Attempt:   rec.Review.Escalations,
+				Type:      notify.NotifyAdmin,
+				Recipient: e.cfg.NotifyRecipient,
+			})
+		}
+		escalated++
+	}
+	return escalated
+}
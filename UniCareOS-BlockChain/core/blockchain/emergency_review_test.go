@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/did"
+	"unicareos/core/notify"
+	"unicareos/core/storage"
+)
+
+func TestUnreviewedEmergencyAccessEscalatedUntilResolved(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	_, clinician, _ := ed25519.GenerateKey(nil)
+	applied := time.Unix(1700000000, 0).UTC()
+	a := &block.EmergencyAccess{
+		PatientDID:   "did:key:z6Mkpatient",
+		ProviderID:   "dr-1",
+		ClinicianDID: did.FromEd25519(clinician.Public().(ed25519.PublicKey)),
+		Reason:       "cardiac arrest",
+		Expiry:       applied.Add(time.Hour),
+		Timestamp:    applied,
+	}
+	if err := a.Sign(clinician); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyEmergencyAccess(store, a, "ab12", 7, applied); err != nil {
+		t.Fatal(err)
+	}
+
+	now := applied
+	var sent []notify.Notification
+	e := NewReviewEscalator(store, ReviewEscalationConfig{Deadline: time.Hour, NotifyRecipient: "compliance@clinic"})
+	e.now = func() time.Time { return now }
+	e.notify = func(n notify.Notification) { sent = append(sent, n) }
+
+	now = applied.Add(59 * time.Minute)
+	if e.Tick() != 0 {
+		t.Fatal("escalated before the deadline")
+	}
+	now = applied.Add(time.Hour)
+	if e.Tick() != 1 || len(sent) != 1 || sent[0].TxID != a.AccessID || sent[0].Recipient != "compliance@clinic" {
+		t.Fatalf("overdue review not escalated: %+v", sent)
+	}
+	now = applied.Add(90 * time.Minute)
+	if e.Tick() != 0 {
+		t.Error("escalated again before another deadline passed")
+	}
+	now = applied.Add(2 * time.Hour)
+	if e.Tick() != 1 || sent[1].Attempt != 2 {
+		t.Fatalf("still-unreviewed access not escalated again: %+v", sent)
+	}
+
+	_, officer, _ := ed25519.GenerateKey(nil)
+	reviewers := map[string]string{"officer-1": did.FromEd25519(officer.Public().(ed25519.PublicKey))}
+	resolution := func(outcome string) *block.EmergencyReviewResolution {
+		r := &block.EmergencyReviewResolution{AccessID: a.AccessID, Outcome: outcome, Notes: "documented in chart", Reviewer: "officer-1", ReviewerDID: reviewers["officer-1"], Timestamp: now}
+		if err := r.Sign(officer); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if err := VerifyEmergencyReview(store, resolution("fine"), reviewers); err == nil {
+		t.Error("review closed with an unknown outcome")
+	}
+	if err := VerifyEmergencyReview(store, resolution(ReviewJustified), map[string]string{}); err == nil {
+		t.Error("review closed by an unlisted officer")
+	}
+	r := resolution(ReviewJustified)
+	if err := VerifyEmergencyReview(store, r, reviewers); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := ResolveEmergencyReview(store, r, "cd34")
+	if err != nil || rec.Review.Status != ReviewJustified || rec.Review.Reviewer != "officer-1" || rec.Review.ResolvedIn != "cd34" || rec.Review.Escalations != 2 {
+		t.Fatalf("review not resolved: %+v, %v", rec, err)
+	}
+	if err := VerifyEmergencyReview(store, resolution(ReviewUnjustified), reviewers); err == nil {
+		t.Error("review resolved twice")
+	}
+	now = applied.Add(10 * time.Hour)
+	if e.Tick() != 0 || len(PendingEmergencyReviews(store)) != 0 {
+		t.Error("resolved review still escalated")
+	}
+}
+
+func TestEscalationDoesNotOverwriteResolution(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	_, clinician, _ := ed25519.GenerateKey(nil)
+	_, officer, _ := ed25519.GenerateKey(nil)
+	applied := time.Unix(1700000000, 0).UTC()
+	e := NewReviewEscalator(store, ReviewEscalationConfig{Deadline: time.Nanosecond})
+	e.notify = nil
+	for i := 0; i < 20; i++ {
+		a := &block.EmergencyAccess{
+			PatientDID:   "did:key:z6Mkpatient",
+			ProviderID:   "dr-1",
+			ClinicianDID: did.FromEd25519(clinician.Public().(ed25519.PublicKey)),
+			Reason:       fmt.Sprintf("trauma bay %d", i),
+			Expiry:       applied.Add(time.Hour),
+			Timestamp:    applied,
+		}
+		if err := a.Sign(clinician); err != nil {
+			t.Fatal(err)
+		}
+		if err := ApplyEmergencyAccess(store, a, "ab12", uint64(i), applied); err != nil {
+			t.Fatal(err)
+		}
+		r := &block.EmergencyReviewResolution{AccessID: a.AccessID, Outcome: ReviewJustified, Reviewer: "officer-1", ReviewerDID: did.FromEd25519(officer.Public().(ed25519.PublicKey)), Timestamp: applied}
+		if err := r.Sign(officer); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); e.Tick() }()
+		go func() {
+			defer wg.Done()
+			if _, err := ResolveEmergencyReview(store, r, "cd34"); err != nil {
+				t.Error(err)
+			}
+		}()
+		wg.Wait()
+		if rec, _ := GetEmergencyAccess(store, a.AccessID); rec.Review.Status != ReviewJustified {
+			t.Fatalf("escalation overwrote the resolution of %s: %+v", a.AccessID, rec.Review)
+		}
+	}
+}
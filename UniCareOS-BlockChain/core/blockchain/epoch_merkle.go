@@ -1,6 +1,8 @@
 package blockchain
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"sort"
 	"unicareos/core/block"
@@ -11,31 +13,55 @@ import (
 type EventHashEntry struct {
 	BlockHeight int
 	EventIndex  int
+	EventID     string // Hex ChainedEvent.EventID
+	Finalizes   string // Hex ID of the medical_record event it finalizes ("" for older events)
 	Hash        string
+	Canonical   []byte // Canonical FinalizeEventTx JSON; Hash is its SHA-256
 }
 
 // GatherFinalizedEventHashesForEpoch returns a deterministically ordered list of finalized event hashes for a given epoch.
 func GatherFinalizedEventHashesForEpoch(epoch uint64, store *storage.Storage) ([]string, error) {
+	entries, err := GatherFinalizedEventsForEpoch(epoch, store)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(entries))
+	for i, entry := range entries {
+		hashes[i] = entry.Hash
+	}
+	return hashes, nil
+}
+
+// GatherFinalizedEventsForEpoch returns the finalized events of an epoch in Merkle leaf order.
+func GatherFinalizedEventsForEpoch(epoch uint64, store *storage.Storage) ([]EventHashEntry, error) {
 	var entries []EventHashEntry
 	blockIDs, err := store.ListBlockIDs()
 	if err != nil {
 		return nil, err
 	}
-	for _, blockID := range blockIDs {
+	for _, idHex := range blockIDs {
+		// ListBlockIDs returns hex IDs; GetBlock takes raw ones
+		blockID, err := hex.DecodeString(string(idHex))
+		if err != nil { continue }
 		blockBytes, err := store.GetBlock(blockID)
 		if err != nil { continue }
 		var blk block.Block
 		if err := json.Unmarshal(blockBytes, &blk); err != nil { continue }
 		if blk.Epoch != epoch { continue }
+		// Skip blocks a fork replaced at their height, so every node gathers the same events
+		if canonical, err := store.GetBlockIDByHeight(int(blk.Height)); err == nil && !bytes.Equal(canonical, blockID) { continue }
 		for idx, evt := range blk.Events {
-			if evt.EventType == "finalize_event" {
-				// Convert evt to FinalizeEventTx if needed (assumes evt is compatible)
+			if evt.EventType == block.FinalizeEventType {
 				tx := block.FinalizeEventTx{}
-				// If evt is already a FinalizeEventTx, use directly; else, map fields as needed
-				b, _ := json.Marshal(evt)
-				if err := json.Unmarshal(b, &tx); err != nil { continue }
+				if evt.FinalizeTx != nil {
+					tx = *evt.FinalizeTx
+				} else {
+					// Events written before finalizations went through the mempool share only their timestamp
+					tx.Timestamp = evt.Timestamp
+				}
+				canonical, _ := tx.MarshalCanonical()
 				hash := block.HashFinalizeEventTx(&tx)
-				entries = append(entries, EventHashEntry{int(blk.Height), idx, hash})
+				entries = append(entries, EventHashEntry{int(blk.Height), idx, evt.EventID.String(), tx.EventID, hash, canonical})
 			}
 		}
 	}
@@ -46,11 +72,7 @@ func GatherFinalizedEventHashesForEpoch(epoch uint64, store *storage.Storage) ([
 		}
 		return entries[i].EventIndex < entries[j].EventIndex
 	})
-	hashes := make([]string, len(entries))
-	for i, entry := range entries {
-		hashes[i] = entry.Hash
-	}
-	return hashes, nil
+	return entries, nil
 }
 
 // ComputeEpochMerkleRoot returns the Merkle root for all finalized events in the given epoch.
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"unicareos/core/block"
+	"unicareos/core/storage"
+	"unicareos/core/types"
+)
+
+// ErrEventNotInEpoch is returned when an event is not among an epoch's finalized events
+var ErrEventNotInEpoch = errors.New("event is not a finalized event of this epoch")
+
+// EpochProof shows that one finalized event is a leaf of an epoch's Merkle root. Together with the
+// quorum-signed FinalizeEpochTx for that root it can be checked offline (see unicare-cli verify-proof).
+type EpochProof struct {
+	Epoch        uint64                 `json:"epoch"`
+	EventID      string                 `json:"eventId"`
+	BlockHeight  int                    `json:"blockHeight"`
+	Event        json.RawMessage        `json:"event"`    // Canonical FinalizeEventTx JSON
+	LeafHash     string                 `json:"leafHash"` // SHA-256 of Event
+	LeafIndex    int                    `json:"leafIndex"`
+	LeafCount    int                    `json:"leafCount"`
+	Path         []block.MerkleStep     `json:"path"`
+	Root         string                 `json:"root"`
+	Finalization *types.FinalizeEpochTx `json:"finalization,omitempty"` // On-chain finalization of Root, once included
+}
+
+// BuildEpochProof returns the Merkle path from a finalized event to its epoch root. eventID is the hex ID
+// of the finalize_event or of the medical_record event it finalized.
+func BuildEpochProof(store *storage.Storage, epoch uint64, eventID string) (*EpochProof, error) {
+	entries, err := GatherFinalizedEventsForEpoch(epoch, store)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	hashes := make([]string, len(entries))
+	for i, e := range entries {
+		hashes[i] = e.Hash
+		if index < 0 && (strings.EqualFold(e.EventID, eventID) || (e.Finalizes != "" && strings.EqualFold(e.Finalizes, eventID))) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, ErrEventNotInEpoch
+	}
+	proof := &EpochProof{
+		Epoch:       epoch,
+		EventID:     entries[index].EventID,
+		BlockHeight: entries[index].BlockHeight,
+		Event:       entries[index].Canonical,
+		LeafHash:    entries[index].Hash,
+		LeafIndex:   index,
+		LeafCount:   len(hashes),
+		Path:        block.MerkleProof(hashes, index),
+		Root:        block.MerkleRoot(hashes),
+	}
+	if fin, err := GetEpochFinalization(store, epoch); err == nil {
+		proof.Finalization = fin
+	}
+	return proof, nil
+}
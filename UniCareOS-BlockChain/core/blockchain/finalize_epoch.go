@@ -1,23 +1,46 @@
 package blockchain
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
-	"unicareos/core/storage"
+	"unicareos/core/block"
+	"unicareos/core/signer"
 	"unicareos/core/state"
+	"unicareos/core/storage"
 	"unicareos/core/types"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
-// FinalizeEpoch seals an epoch, computes its Merkle root, and creates a FinalizeEpochTx.
+// FinalizerQuorum is the number of finalizer signatures needed out of finalizers (more than two thirds)
+func FinalizerQuorum(finalizers int) int {
+	return finalizers*2/3 + 1
+}
+
+// FinalizeEpoch seals an epoch, computes its Merkle root, and creates a FinalizeEpochTx signed by key.
+// The tx is pending until a quorum of finalizers has signed it and a block has carried it on chain.
 func FinalizeEpoch(
 	store *storage.Storage,
 	chainState *state.ChainState,
 	epochNumber uint64,
-	finalizerSignature string,
+	key signer.Signer,
 	auditLogID string,
 ) (*types.FinalizeEpochTx, *types.EpochFinalizationReceipt, error) {
-	// Check if the epoch is already finalized (TODO: implement actual check if needed)
-	// For now, assume single finalization per epoch
+	if existing, err := GetEpochFinalization(store, epochNumber); err == nil {
+		receipt := &types.EpochFinalizationReceipt{
+			TxID:        existing.TxID,
+			Status:      string(block.FinalizationStatusDuplicate),
+			EpochNumber: epochNumber,
+			Timestamp:   time.Now().UTC(),
+			Errors:      []string{fmt.Sprintf("epoch %d is already finalized", epochNumber)},
+		}
+		return existing, receipt, fmt.Errorf("epoch %d is already finalized", epochNumber)
+	}
 
 	// Gather finalized event hashes and compute Merkle root
 	_, err := GatherFinalizedEventHashesForEpoch(epochNumber, store)
@@ -29,12 +52,13 @@ func FinalizeEpoch(
 		return nil, nil, fmt.Errorf("failed to compute epoch Merkle root: %w", err)
 	}
 
-	tx := types.NewFinalizeEpochTx(epochNumber, finalizerSignature, root)
+	tx := types.NewFinalizeEpochTx(epochNumber, root)
 	tx.AuditLogID = auditLogID
-	tx.Timestamp = time.Now().UTC()
-
-	if err := tx.Validate(); err != nil {
-		tx.Status = "failed"
+	if err := SignEpochFinalization(tx, key); err == nil {
+		err = tx.Validate()
+	}
+	if err != nil {
+		tx.Status = string(block.FinalizationStatusFailed)
 		receipt := &types.EpochFinalizationReceipt{
 			TxID:        tx.TxID,
 			Status:      tx.Status,
@@ -45,17 +69,149 @@ func FinalizeEpoch(
 		return tx, receipt, err
 	}
 
-	// Mark epoch as finalized in chain state if needed (TODO: implement marking logic)
-	// chainState.MarkEpochFinalized(epochNumber) // example placeholder
-
-	tx.Status = "finalized"
 	receipt := &types.EpochFinalizationReceipt{
 		TxID:        tx.TxID,
 		Status:      tx.Status,
 		EpochNumber: epochNumber,
 		Timestamp:   tx.Timestamp,
 	}
-	// TODO: Persist FinalizeEpochTx to storage or chain if required
-
 	return tx, receipt, nil
 }
+
+// SignEpochFinalization adds key's signature to tx (once per key)
+func SignEpochFinalization(tx *types.FinalizeEpochTx, key signer.Signer) error {
+	pubKey, ok := signer.PublicKey(key)
+	if !ok {
+		return errors.New("no finalizer key loaded")
+	}
+	pub := base64.StdEncoding.EncodeToString(pubKey)
+	for _, s := range tx.Signatures {
+		if s.PubKey == pub {
+			return nil
+		}
+	}
+	sig, err := signer.Sign(key, tx.SigningBytes())
+	if err != nil {
+		return err
+	}
+	tx.Signatures = append(tx.Signatures, types.FinalizerSignature{PubKey: pub, Signature: base64.StdEncoding.EncodeToString(sig)})
+	return nil
+}
+
+// ValidFinalizerSignatures returns the distinct, correctly signed signatures from keys in finalizers
+func ValidFinalizerSignatures(tx *types.FinalizeEpochTx, finalizers []string) []types.FinalizerSignature {
+	return ValidSignatures(tx.SigningBytes(), tx.Signatures, finalizers)
+}
+
+// ValidSignatures returns the signatures over msg made by distinct keys among allowed (base64 Ed25519)
+func ValidSignatures(msg []byte, sigs []types.FinalizerSignature, keys []string) []types.FinalizerSignature {
+	allowed := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		allowed[k] = true
+	}
+	seen := make(map[string]bool)
+	var out []types.FinalizerSignature
+	for _, s := range sigs {
+		if !allowed[s.PubKey] || seen[s.PubKey] {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(s.PubKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Signature)
+		if err != nil || !ed25519.Verify(pub, msg, sig) {
+			continue
+		}
+		seen[s.PubKey] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+// VerifyEpochFinalization checks a FinalizeEpochTx against the local chain: the epoch must not already be
+// finalized (FinalizationStatusDuplicate, whether the earlier root matches or conflicts), the Merkle root
+// must match the one computed from our own blocks, and quorum finalizers must have signed it.
+func VerifyEpochFinalization(store *storage.Storage, tx *types.FinalizeEpochTx, finalizers []string, quorum int) (block.FinalizationStatus, error) {
+	if err := tx.Validate(); err != nil {
+		return block.FinalizationStatusFailed, err
+	}
+	if existing, err := GetEpochFinalization(store, tx.EpochNumber); err == nil {
+		if existing.TxID != tx.TxID {
+			return block.FinalizationStatusDuplicate, fmt.Errorf("epoch %d was already finalized with root %q; conflicting root %q", tx.EpochNumber, existing.EpochSummaryHash, tx.EpochSummaryHash)
+		}
+		return block.FinalizationStatusDuplicate, fmt.Errorf("epoch %d is already finalized (tx %s in block %s)", tx.EpochNumber, existing.TxID, existing.IncludedIn)
+	}
+	if len(finalizers) == 0 {
+		return block.FinalizationStatusFailed, errors.New("no finalizer set to check epoch signatures against")
+	}
+	root, err := ComputeEpochMerkleRoot(tx.EpochNumber, store)
+	if err != nil {
+		return block.FinalizationStatusFailed, fmt.Errorf("failed to compute epoch Merkle root: %w", err)
+	}
+	if root != tx.EpochSummaryHash {
+		return block.FinalizationStatusFailed, fmt.Errorf("epoch %d root %q does not match local root %q", tx.EpochNumber, tx.EpochSummaryHash, root)
+	}
+	valid := ValidFinalizerSignatures(tx, finalizers)
+	if len(valid) != len(tx.Signatures) {
+		return block.FinalizationStatusFailed, fmt.Errorf("epoch %d carries %d invalid or unauthorized signatures", tx.EpochNumber, len(tx.Signatures)-len(valid))
+	}
+	if len(valid) < quorum {
+		return block.FinalizationStatusFailed, fmt.Errorf("epoch %d has %d of %d required finalizer signatures", tx.EpochNumber, len(valid), quorum)
+	}
+	return block.FinalizationStatusFinalized, nil
+}
+
+const epochFinalizationPrefix = "epochFinalized:"
+
+func epochFinalizationKey(epoch uint64) []byte {
+	return []byte(fmt.Sprintf("%s%d", epochFinalizationPrefix, epoch))
+}
+
+// SaveEpochFinalization records an on-chain epoch finalization
+func SaveEpochFinalization(store *storage.Storage, tx *types.FinalizeEpochTx) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	return store.DB().Put(epochFinalizationKey(tx.EpochNumber), data, nil)
+}
+
+// DeleteEpochFinalization removes the finalization of epoch recorded by blockID when that block is
+// rolled back
+func DeleteEpochFinalization(store *storage.Storage, epoch uint64, blockID string) error {
+	tx, err := GetEpochFinalization(store, epoch)
+	if err != nil || tx.IncludedIn != blockID {
+		return nil
+	}
+	return store.DB().Delete(epochFinalizationKey(epoch), nil)
+}
+
+// GetEpochFinalization returns the on-chain finalization of epoch, if any
+func GetEpochFinalization(store *storage.Storage, epoch uint64) (*types.FinalizeEpochTx, error) {
+	data, err := store.DB().Get(epochFinalizationKey(epoch), nil)
+	if err != nil {
+		return nil, err
+	}
+	var tx types.FinalizeEpochTx
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// ListEpochFinalizations returns every on-chain epoch finalization, by epoch
+func ListEpochFinalizations(store *storage.Storage) ([]types.FinalizeEpochTx, error) {
+	iter := store.DB().NewIterator(util.BytesPrefix([]byte(epochFinalizationPrefix)), nil)
+	defer iter.Release()
+	var out []types.FinalizeEpochTx
+	for iter.Next() {
+		var tx types.FinalizeEpochTx
+		if err := json.Unmarshal(iter.Value(), &tx); err != nil {
+			continue
+		}
+		out = append(out, tx)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].EpochNumber < out[j].EpochNumber })
+	return out, iter.Error()
+}
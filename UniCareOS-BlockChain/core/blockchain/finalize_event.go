@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"unicareos/core/block"
+	"unicareos/core/storage"
+)
+
+// EventFinalization marks a medical_record event as finalized on chain
+type EventFinalization struct {
+	EventID    string `json:"eventID"`    // Hex ID of the finalized medical_record event
+	TxID       string `json:"txID"`       // FinalizeEventTx that finalized it
+	BlockHash  string `json:"blockHash"`  // Block holding the medical_record event
+	IncludedIn string `json:"includedIn"` // Block carrying the finalize_event
+	Epoch      uint64 `json:"epoch"`      // Epoch of IncludedIn, whose Merkle root covers the finalization
+	Finalizer  string `json:"finalizer"`  // Base64 Ed25519 key that signed it
+}
+
+// VerifyEventFinalization checks a FinalizeEventTx against the local chain. The TxID must bind the event
+// and block, an authorized finalizer must have signed it, the referenced block must be on our main chain
+// in the stated epoch and hold the medical_record event, the submission digest must match that event's
+// submissionHash, and the event must not already be finalized
+// (FinalizationStatusDuplicate). An unknown block yields FinalizationStatusPending, since we may simply
+// be behind. It returns the signing finalizer key.
+func VerifyEventFinalization(store *storage.Storage, tx *block.FinalizeEventTx, finalizers []string) (string, block.FinalizationStatus, error) {
+	if tx.EventID == "" {
+		return "", block.FinalizationStatusFailed, errors.New("finalization does not name an event")
+	}
+	if tx.TxID != block.FinalizeEventTxID(tx.EventID, tx.Block.BlockHash) {
+		return "", block.FinalizationStatusFailed, fmt.Errorf("txID does not match event %s in block %s", tx.EventID, tx.Block.BlockHash)
+	}
+	signer := ""
+	var lastErr error = errors.New("no finalizer set to check signatures against")
+	for _, k := range finalizers {
+		pub, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		if lastErr = tx.Validate(pub); lastErr == nil {
+			signer = k
+			break
+		}
+	}
+	if signer == "" {
+		return "", block.FinalizationStatusFailed, fmt.Errorf("not signed by an authorized finalizer: %v", lastErr)
+	}
+	if existing, err := GetEventFinalization(store, tx.EventID); err == nil {
+		return signer, block.FinalizationStatusDuplicate, fmt.Errorf("event %s is already finalized (tx %s in block %s)", tx.EventID, existing.TxID, existing.IncludedIn)
+	}
+
+	blockID, err := hex.DecodeString(tx.Block.BlockHash)
+	if err != nil {
+		return signer, block.FinalizationStatusFailed, fmt.Errorf("malformed block hash %q", tx.Block.BlockHash)
+	}
+	data, err := store.GetBlock(blockID)
+	if err != nil {
+		return signer, block.FinalizationStatusPending, fmt.Errorf("block %s is not known", tx.Block.BlockHash)
+	}
+	blk, err := block.Deserialize(data)
+	if err != nil {
+		return signer, block.FinalizationStatusFailed, fmt.Errorf("block %s: %v", tx.Block.BlockHash, err)
+	}
+	if canonical, err := store.GetBlockIDByHeight(int(blk.Height)); err != nil || !bytes.Equal(canonical, blockID) {
+		return signer, block.FinalizationStatusFailed, fmt.Errorf("block %s is not on the main chain", tx.Block.BlockHash)
+	}
+	if blk.Epoch != tx.Block.Epoch {
+		return signer, block.FinalizationStatusFailed, fmt.Errorf("block %s is in epoch %d, not %d", tx.Block.BlockHash, blk.Epoch, tx.Block.Epoch)
+	}
+	if blk.Height != tx.Block.Height {
+		return signer, block.FinalizationStatusFailed, fmt.Errorf("block %s is at height %d, not %d", tx.Block.BlockHash, blk.Height, tx.Block.Height)
+	}
+	for _, evt := range blk.Events {
+		if evt.EventType != "medical_record" || evt.EventID.String() != tx.EventID {
+			continue
+		}
+		if digest := block.SubmissionDigestHash(tx.SubmitMedicalRecordTx); evt.SubmissionHash == "" || digest != evt.SubmissionHash {
+			return signer, block.FinalizationStatusFailed, fmt.Errorf("submission digest %q does not match event %s", digest, tx.EventID)
+		}
+		return signer, block.FinalizationStatusFinalized, nil
+	}
+	return signer, block.FinalizationStatusFailed, fmt.Errorf("block %s holds no medical record event %s", tx.Block.BlockHash, tx.EventID)
+}
+
+const eventFinalizationPrefix = "eventFinalized:"
+
+// SaveEventFinalization records that an event was finalized on chain
+func SaveEventFinalization(store *storage.Storage, rec *EventFinalization) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return store.DB().Put([]byte(eventFinalizationPrefix+rec.EventID), data, nil)
+}
+
+// DeleteEventFinalization removes the finalization of eventID recorded by blockID when that block is
+// rolled back
+func DeleteEventFinalization(store *storage.Storage, eventID, blockID string) error {
+	rec, err := GetEventFinalization(store, eventID)
+	if err != nil || rec.IncludedIn != blockID {
+		return nil
+	}
+	return store.DB().Delete([]byte(eventFinalizationPrefix+eventID), nil)
+}
+
+// GetEventFinalization returns the on-chain finalization of a medical_record event, if any
+func GetEventFinalization(store *storage.Storage, eventID string) (*EventFinalization, error) {
+	data, err := store.DB().Get([]byte(eventFinalizationPrefix+eventID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec EventFinalization
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"unicareos/core/block"
+	"unicareos/core/storage"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Patient record index.
+// Every committed medical_record event is indexed under its patient's DID and block height. Lookups
+// resolve the height through the canonical height index and check the event is still there, so entries
+// left behind by a rolled-back block are skipped.
+
+const (
+	patientRecordPrefix = "patientRecord:"
+	recordIndexHeight   = "patientRecordIndexedHeight" // Highest height indexed so far
+)
+
+// RecordEvent is a medical_record event located in the canonical chain
+type RecordEvent struct {
+	Event   block.ChainedEvent
+	BlockID string // Hex hash of the block carrying the event
+	Height  uint64
+}
+
+// IndexRecordEvents indexes the medical_record events of a committed block
+func IndexRecordEvents(store *storage.Storage, blk block.Block) error {
+	for _, evt := range blk.Events {
+		if evt.EventType != "medical_record" || evt.PatientID == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s%s:%020d:%s", patientRecordPrefix, evt.PatientID, blk.Height, evt.EventID.String())
+		if err := store.DB().Put([]byte(key), nil, nil); err != nil {
+			return err
+		}
+	}
+	if indexed, ok := recordIndexedHeight(store); !ok || blk.Height > indexed {
+		return store.DB().Put([]byte(recordIndexHeight), []byte(strconv.FormatUint(blk.Height, 10)), nil)
+	}
+	return nil
+}
+
+// UnindexRecordEvents removes the entries of a rolled-back block, the chain tip, from the index
+func UnindexRecordEvents(store *storage.Storage, blk block.Block) error {
+	for _, evt := range blk.Events {
+		if evt.EventType != "medical_record" || evt.PatientID == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s%s:%020d:%s", patientRecordPrefix, evt.PatientID, blk.Height, evt.EventID.String())
+		if err := store.DB().Delete([]byte(key), nil); err != nil {
+			return err
+		}
+	}
+	if indexed, ok := recordIndexedHeight(store); ok && indexed >= blk.Height && blk.Height > 0 {
+		return store.DB().Put([]byte(recordIndexHeight), []byte(strconv.FormatUint(blk.Height-1, 10)), nil)
+	}
+	return nil
+}
+
+func recordIndexedHeight(store *storage.Storage) (uint64, bool) {
+	data, err := store.DB().Get([]byte(recordIndexHeight), nil)
+	if err != nil {
+		return 0, false
+	}
+	h, err := strconv.ParseUint(string(data), 10, 64)
+	return h, err == nil
+}
+
+// CatchUpRecordIndex indexes the stored blocks above the highest indexed height, e.g. blocks committed
+// before the index existed. It returns how many blocks it indexed.
+func CatchUpRecordIndex(store *storage.Storage) (int, error) {
+	var h uint64
+	if indexed, ok := recordIndexedHeight(store); ok {
+		h = indexed + 1
+	}
+	n := 0
+	for ; ; h++ {
+		blk, err := canonicalBlock(store, h)
+		if err != nil {
+			return n, nil // Past the tip
+		}
+		if err := IndexRecordEvents(store, *blk); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func canonicalBlock(store *storage.Storage, height uint64) (*block.Block, error) {
+	id, err := store.GetBlockIDByHeight(int(height))
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.GetBlock(id)
+	if err != nil {
+		return nil, err
+	}
+	return block.Deserialize(data)
+}
+
+// PatientRecordEvents returns the patient's medical_record events in the canonical chain, oldest first
+func PatientRecordEvents(store *storage.Storage, patientDID string) ([]RecordEvent, error) {
+	prefix := patientRecordPrefix + patientDID + ":"
+	iter := store.DB().NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	blocks := make(map[uint64]*block.Block)
+	var out []RecordEvent
+	for iter.Next() {
+		heightStr, eventID, ok := strings.Cut(string(iter.Key()[len(prefix):]), ":")
+		if !ok {
+			continue
+		}
+		height, err := strconv.ParseUint(heightStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		blk, cached := blocks[height]
+		if !cached {
+			blk, _ = canonicalBlock(store, height)
+			blocks[height] = blk
+		}
+		if blk == nil {
+			continue
+		}
+		for _, evt := range blk.Events {
+			if evt.EventID.String() == eventID && evt.PatientID == patientDID {
+				out = append(out, RecordEvent{Event: evt, BlockID: hex.EncodeToString(blk.BlockID[:]), Height: height})
+				break
+			}
+		}
+	}
+	return out, iter.Error()
+}
+
+// LatestRevisions drops the records that a later revision in records supersedes, following RevisionOf
+// and DocLineage
+func LatestRevisions(records []RecordEvent) []RecordEvent {
+	superseded := make(map[string]bool)
+	for _, r := range records {
+		if r.Event.RevisionOf != "" {
+			superseded[r.Event.RevisionOf] = true
+		}
+		for _, id := range r.Event.DocLineage {
+			superseded[id] = true
+		}
+	}
+	var out []RecordEvent
+	for _, r := range records {
+		if !superseded[r.Event.EventID.String()] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
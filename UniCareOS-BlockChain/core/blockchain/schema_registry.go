@@ -0,0 +1,197 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"unicareos/core/block"
+	"unicareos/core/state"
+	"unicareos/core/storage"
+	"unicareos/core/validation"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Schema registry.
+// Medical record schemas are registered by hash through governance-signed SchemaRegistrations and take
+// effect at their activation height. A record is validated against the schema its major version had
+// active at the height of the block including it, so replaying the chain validates every record the way
+// it was validated when first included. The v1 schema is active from genesis, pinned by
+// GenesisConfig.InitialSchemaHash.
+
+// Schema registry errors
+var (
+	ErrSchemaDuplicate = errors.New("schema registration already applied")
+	ErrSchemaUnknown   = errors.New("no schema active")
+)
+
+// GenesisSchemaVersion is the major version active from height 0
+const GenesisSchemaVersion = "1"
+
+const schemaPrefix = "schema:" // schema:<version>:<%020d activation height>
+
+// SchemaRecord is a registered schema
+type SchemaRecord struct {
+	Version          string `json:"version"`
+	SchemaHash       string `json:"schemaHash"`
+	Schema           []byte `json:"schema"`
+	ActivationHeight uint64 `json:"activationHeight"`
+	TxID             string `json:"txID,omitempty"`       // Registration transaction; empty for the genesis schema
+	IncludedIn       string `json:"includedIn,omitempty"` // Block carrying the registration
+	Height           uint64 `json:"height"`
+}
+
+func schemaKey(version string, activation uint64) []byte {
+	return []byte(fmt.Sprintf("%s%s:%020d", schemaPrefix, version, activation))
+}
+
+func getSchema(store *storage.Storage, version string, activation uint64) (*SchemaRecord, error) {
+	data, err := store.DB().Get(schemaKey(version, activation), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec SchemaRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func saveSchema(store *storage.Storage, rec *SchemaRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return store.DB().Put(schemaKey(rec.Version, rec.ActivationHeight), data, nil)
+}
+
+// RegisterGenesisSchema makes schema the v1 schema from height 0. It must hash to genesisHash, the
+// chain's InitialSchemaHash.
+func RegisterGenesisSchema(store *storage.Storage, schema []byte, genesisHash string) error {
+	hash := validation.SchemaHash(schema)
+	if hash != genesisHash {
+		return fmt.Errorf("v%s schema hash %s does not match the genesis schema hash %s", GenesisSchemaVersion, hash, genesisHash)
+	}
+	if rec, err := getSchema(store, GenesisSchemaVersion, 0); err == nil {
+		if rec.SchemaHash != hash {
+			return fmt.Errorf("a different v%s genesis schema (%s) is already registered", GenesisSchemaVersion, rec.SchemaHash)
+		}
+		return nil
+	}
+	if err := validation.CheckSchema(schema); err != nil {
+		return err
+	}
+	return saveSchema(store, &SchemaRecord{Version: GenesisSchemaVersion, SchemaHash: hash, Schema: schema})
+}
+
+// VerifySchemaRegistration checks a registration for inclusion in the block at height: its schema and
+// hash, quorum signatures from governanceKeys, an activation height above the block, and that no other
+// schema of its version activates at the same height. governanceKeys must be configured identically on
+// every node.
+func VerifySchemaRegistration(store *storage.Storage, r *block.SchemaRegistration, governanceKeys []string, quorum int, height uint64) error {
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	if rec, err := getSchema(store, r.Version, r.ActivationHeight); err == nil {
+		if rec.TxID == r.TxID() {
+			return fmt.Errorf("%w: %s", ErrSchemaDuplicate, r.TxID())
+		}
+		return fmt.Errorf("schema v%s %s already activates at height %d", r.Version, rec.SchemaHash, r.ActivationHeight)
+	}
+	if r.ActivationHeight <= height {
+		return fmt.Errorf("schema v%s must activate after block %d, not at %d", r.Version, height, r.ActivationHeight)
+	}
+	if signed := len(ValidSignatures(r.SigningBytes(), r.Signatures, governanceKeys)); signed < quorum {
+		return fmt.Errorf("schema v%s registration has %d of %d required governance signatures", r.Version, signed, quorum)
+	}
+	return nil
+}
+
+// ApplySchemaRegistration records a verified registration included in blockID at height
+func ApplySchemaRegistration(store *storage.Storage, r *block.SchemaRegistration, blockID string, height uint64) error {
+	return saveSchema(store, &SchemaRecord{
+		Version:          r.Version,
+		SchemaHash:       r.SchemaHash,
+		Schema:           r.Schema,
+		ActivationHeight: r.ActivationHeight,
+		TxID:             r.TxID(),
+		IncludedIn:       blockID,
+		Height:           height,
+	})
+}
+
+// RevertSchemaRegistration removes a registration recorded by blockID when that block is rolled back
+func RevertSchemaRegistration(store *storage.Storage, r *block.SchemaRegistration, blockID string) error {
+	rec, err := getSchema(store, r.Version, r.ActivationHeight)
+	if err != nil || rec.IncludedIn != blockID {
+		return nil
+	}
+	return store.DB().Delete(schemaKey(r.Version, r.ActivationHeight), nil)
+}
+
+// ActiveSchema returns the schema of a major version active at height: the one with the highest
+// activation height not above it
+func ActiveSchema(store *storage.Storage, version string, height uint64) (*SchemaRecord, error) {
+	var active *SchemaRecord
+	for _, rec := range schemasUnder(store, []byte(schemaPrefix+version+":")) {
+		if rec.ActivationHeight <= height {
+			active = rec
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("%w: v%s at height %d", ErrSchemaUnknown, version, height)
+	}
+	return active, nil
+}
+
+// ListSchemas returns every registered schema by version, then activation height
+func ListSchemas(store *storage.Storage) []*SchemaRecord {
+	out := schemasUnder(store, []byte(schemaPrefix))
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
+
+// schemasUnder loads the schemas under prefix in key order (activation height within a version)
+func schemasUnder(store *storage.Storage, prefix []byte) []*SchemaRecord {
+	iter := store.DB().NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	var out []*SchemaRecord
+	for iter.Next() {
+		var rec SchemaRecord
+		if err := json.Unmarshal(iter.Value(), &rec); err == nil {
+			out = append(out, &rec)
+		}
+	}
+	return out
+}
+
+// SchemaRegistry serves the registered schemas to record validation (validation.SchemaSource)
+type SchemaRegistry struct {
+	store *storage.Storage
+	chain *state.ChainState // Tip height, kept current as blocks commit
+}
+
+// NewSchemaRegistry returns the registry kept in store, validating at the height after chain's tip
+func NewSchemaRegistry(store *storage.Storage, chain *state.ChainState) *SchemaRegistry {
+	return &SchemaRegistry{store: store, chain: chain}
+}
+
+// SchemaAt returns the schema of a major version active at height
+func (r *SchemaRegistry) SchemaAt(version string, height uint64) ([]byte, error) {
+	rec, err := ActiveSchema(r.store, version, height)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Schema, nil
+}
+
+// NextHeight returns the height of the block that would extend the chain's tip
+func (r *SchemaRegistry) NextHeight() uint64 {
+	head, height := r.chain.Head()
+	if head == "" {
+		return 0
+	}
+	return height + 1
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/state"
+	"unicareos/core/storage"
+	"unicareos/core/validation"
+)
+
+func TestSchemaRegistryActivatesQuorumSignedSchemas(t *testing.T) {
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	v1 := []byte(`{"type":"object","required":["recordId"]}`)
+	if err := RegisterGenesisSchema(store, v1, "0000"); err == nil {
+		t.Fatal("genesis schema registered under the wrong hash")
+	}
+	if err := RegisterGenesisSchema(store, v1, validation.SchemaHash(v1)); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	var privs []ed25519.PrivateKey
+	for i := 0; i < 3; i++ {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		keys = append(keys, base64.StdEncoding.EncodeToString(pub))
+		privs = append(privs, priv)
+	}
+	const quorum = 2
+	v1b := []byte(`{"type":"object","required":["recordId","patientId"]}`)
+	r := &block.SchemaRegistration{Version: "1", SchemaHash: validation.SchemaHash(v1b), Schema: v1b, ActivationHeight: 10, Timestamp: time.Unix(1700000000, 0).UTC()}
+	if err := r.Sign(privs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySchemaRegistration(store, r, keys, quorum, 5); err == nil {
+		t.Fatal("registration accepted with 1 of 2 required governance signatures")
+	}
+	if err := r.Sign(privs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySchemaRegistration(store, r, keys, quorum, 10); err == nil {
+		t.Fatal("registration accepted activating at its own block")
+	}
+	if err := VerifySchemaRegistration(store, r, keys, quorum, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplySchemaRegistration(store, r, "ab12", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySchemaRegistration(store, r, keys, quorum, 6); !errors.Is(err, ErrSchemaDuplicate) {
+		t.Errorf("re-submitted registration: got %v, want ErrSchemaDuplicate", err)
+	}
+	conflict := *r
+	conflict.Timestamp = r.Timestamp.Add(time.Second)
+	conflict.Signatures = nil
+	conflict.Sign(privs[1])
+	conflict.Sign(privs[2])
+	if err := VerifySchemaRegistration(store, &conflict, keys, quorum, 6); err == nil || errors.Is(err, ErrSchemaDuplicate) {
+		t.Errorf("second v1 schema activating at height 10: got %v", err)
+	}
+
+	chain := &state.ChainState{}
+	registry := NewSchemaRegistry(store, chain)
+	if h := registry.NextHeight(); h != 0 {
+		t.Errorf("next height without a tip = %d, want 0", h)
+	}
+	chain.SetHead("tip", 41)
+	if h := registry.NextHeight(); h != 42 {
+		t.Errorf("next height after the tip at 41 = %d, want 42", h)
+	}
+	for height, want := range map[uint64][]byte{0: v1, 9: v1, 10: v1b, 100: v1b} {
+		got, err := registry.SchemaAt("1", height)
+		if err != nil || string(got) != string(want) {
+			t.Errorf("schema v1 at height %d = %s, %v; want %s", height, got, err, want)
+		}
+	}
+	if _, err := registry.SchemaAt("2", 100); !errors.Is(err, ErrSchemaUnknown) {
+		t.Errorf("unregistered v2: got %v, want ErrSchemaUnknown", err)
+	}
+	if got := ListSchemas(store); len(got) != 2 || got[1].TxID != r.TxID() {
+		t.Errorf("ListSchemas = %+v", got)
+	}
+}
@@ -12,6 +12,13 @@ import (
 // Call CheckAndSync on a schedule or after receiving new peer info.
 type ForkChoice struct {
 	Store *storage.Storage
+	// Fetch retrieves raw block bytes from a peer. The networking layer sets it to its
+	// authenticated transport; if nil, FetchBlockFromPeerPOST is used.
+	Fetch func(peerAddr string, blockID [32]byte) ([]byte, error)
+	// Switch replaces our blocks above forkPoint with branch, the peer's blocks in height order, raw being
+	// their bytes as served. It must leave the chain as it was if any block of the branch is rejected. If
+	// nil the store is rolled back and the blocks saved as is.
+	Switch func(forkPoint [32]byte, branch []*block.Block, raw [][]byte) error
 }
 
 // NewForkChoice returns a new ForkChoice instance
@@ -60,8 +67,9 @@ func (fc *ForkChoice) CheckAndSync(myHeight int, myTip [32]byte, peers []PeerTip
 		copy(current[:], prev)
 	}
 
-	// 2. Walk back peer's chain to find fork point and collect blocks to apply
-	peerBlocks := make([][32]byte, 0, bestPeer.Height-myHeight)
+	// 2. Walk back peer's chain to find fork point, fetching the blocks of its branch
+	var branch []*block.Block
+	var raw [][]byte
 	peerTip := bestPeer.BlockID
 	forkPoint := [32]byte{}
 	curHeight := bestPeer.Height
@@ -70,8 +78,7 @@ func (fc *ForkChoice) CheckAndSync(myHeight int, myTip [32]byte, peers []PeerTip
 			forkPoint = peerTip
 			break
 		}
-		peerBlocks = append([][32]byte{peerTip}, peerBlocks...)
-		blkBytes, err := FetchBlockFromPeerPOST(bestPeer.Address, fmt.Sprintf("%x", peerTip[:]))
+		blkBytes, err := fc.fetchBlock(bestPeer.Address, peerTip)
 		if err != nil {
 			return fmt.Errorf("[FORKCHOICE] Failed to fetch block from peer: %v", err)
 		}
@@ -79,6 +86,11 @@ func (fc *ForkChoice) CheckAndSync(myHeight int, myTip [32]byte, peers []PeerTip
 		if err != nil {
 			return fmt.Errorf("[FORKCHOICE] Failed to deserialize peer block: %v", err)
 		}
+		if blk.BlockID != peerTip {
+			return fmt.Errorf("[FORKCHOICE] Peer served block %x for %x", blk.BlockID[:], peerTip[:])
+		}
+		branch = append([]*block.Block{blk}, branch...)
+		raw = append([][]byte{blkBytes}, raw...)
 		if blk.PrevHash == "" || blk.PrevHash == strings.Repeat("0", len(blk.PrevHash)) { break }
 		prev, err := hex.DecodeString(blk.PrevHash)
 		if err != nil || len(prev) != 32 { break }
@@ -91,29 +103,47 @@ func (fc *ForkChoice) CheckAndSync(myHeight int, myTip [32]byte, peers []PeerTip
 	}
 	fmt.Printf("[FORKCHOICE] Fork point found at %x\n", forkPoint[:])
 
-	// 3. Roll back to fork point
-	err := fc.Store.RollbackToBlock(forkPoint)
-	if err != nil {
-		return fmt.Errorf("[FORKCHOICE] Rollback failed: %v", err)
+	// 3. The branch must extend the fork point block by block and end above our tip, whatever height the
+	// peer advertised
+	prev, height := forkPoint, myAncestors[forkPoint]
+	for _, blk := range branch {
+		if blk.PrevHash != fmt.Sprintf("%x", prev[:]) || int(blk.Height) != height+1 {
+			return fmt.Errorf("[FORKCHOICE] Peer branch does not extend the fork point at height %d", blk.Height)
+		}
+		prev, height = blk.BlockID, int(blk.Height)
+	}
+	if height <= myHeight {
+		return fmt.Errorf("[FORKCHOICE] Peer branch ends at height %d, not above ours (%d)", height, myHeight)
 	}
-	fmt.Printf("[FORKCHOICE] Rolled back to fork point %x\n", forkPoint[:])
 
-	// 4. Apply new blocks from fork point to peer tip
-	for _, id := range peerBlocks {
-		blkBytes, err := FetchBlockFromPeerPOST(bestPeer.Address, fmt.Sprintf("%x", id[:]))
-		if err != nil {
-			return fmt.Errorf("[FORKCHOICE] Failed to fetch block from peer: %v", err)
+	// 4. Replace our blocks above the fork point with the branch
+	if fc.Switch != nil {
+		if err := fc.Switch(forkPoint, branch, raw); err != nil {
+			return fmt.Errorf("[FORKCHOICE] Failed to switch to the peer branch: %v", err)
 		}
-		err = fc.Store.SaveBlock(id[:], blkBytes)
-		if err != nil {
-			return fmt.Errorf("[FORKCHOICE] Failed to save block: %v", err)
+	} else {
+		if err := fc.Store.RollbackToBlock(forkPoint); err != nil {
+			return fmt.Errorf("[FORKCHOICE] Rollback failed: %v", err)
+		}
+		fmt.Printf("[FORKCHOICE] Rolled back to fork point %x\n", forkPoint[:])
+		for i, blk := range branch {
+			if err := fc.Store.SaveBlock(blk.BlockID[:], raw[i]); err != nil {
+				return fmt.Errorf("[FORKCHOICE] Failed to apply block %x: %v", blk.BlockID[:], err)
+			}
+			fmt.Printf("[FORKCHOICE] Applied block %x\n", blk.BlockID[:])
 		}
-		fmt.Printf("[FORKCHOICE] Applied block %x\n", id[:])
 	}
-	fmt.Println("[FORKCHOICE] Reorg complete. Now at height", longest)
+	fmt.Println("[FORKCHOICE] Reorg complete. Now at height", height)
 	return nil
 }
 
+func (fc *ForkChoice) fetchBlock(peerAddr string, id [32]byte) ([]byte, error) {
+	if fc.Fetch != nil {
+		return fc.Fetch(peerAddr, id)
+	}
+	return FetchBlockFromPeerPOST(peerAddr, fmt.Sprintf("%x", id[:]))
+}
+
 func isZero(id [32]byte) bool {
 	for _, b := range id { if b != 0 { return false } }
 	return true
@@ -4,8 +4,10 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 const (
@@ -14,26 +16,28 @@ const (
 )
 
 // GenerateAndSaveKeypair generates an Ed25519 keypair and saves to disk if not present.
+// The key is written in plaintext, so it is for development only; the node refuses it under ENV=production.
 func GenerateAndSaveKeypair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
 	if _, err := os.Stat(PrivKeyFile); err == nil {
 		// Load existing keys
-		privHex, _ := ioutil.ReadFile(PrivKeyFile)
-		pubHex, _ := ioutil.ReadFile(PubKeyFile)
-		priv, _ := hex.DecodeString(string(privHex))
-		pub, _ := hex.DecodeString(string(pubHex))
-		return ed25519.PublicKey(pub), ed25519.PrivateKey(priv), nil
+		return LoadKeypair()
 	}
 	// Generate new keypair
 	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, nil, err
 	}
-	ioutil.WriteFile(PrivKeyFile, []byte(hex.EncodeToString(priv)), 0600)
-	ioutil.WriteFile(PubKeyFile, []byte(hex.EncodeToString(pub)), 0644)
+	if err := ioutil.WriteFile(PrivKeyFile, []byte(hex.EncodeToString(priv)), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(PubKeyFile, []byte(hex.EncodeToString(pub)), 0644); err != nil {
+		return nil, nil, err
+	}
 	return pub, priv, nil
 }
 
 // LoadKeypair loads the Ed25519 keypair from disk.
+// The plaintext key files are for development; production nodes use an encrypted keystore (NODE_KEYSTORE).
 func LoadKeypair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
 	privHex, err := ioutil.ReadFile(PrivKeyFile)
 	if err != nil {
@@ -43,8 +47,17 @@ func LoadKeypair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	priv, _ := hex.DecodeString(string(privHex))
-	pub, _ := hex.DecodeString(string(pubHex))
+	priv, err := hex.DecodeString(strings.TrimSpace(string(privHex)))
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return nil, nil, fmt.Errorf("%s does not hold a hex Ed25519 private key", PrivKeyFile)
+	}
+	pub, err := hex.DecodeString(strings.TrimSpace(string(pubHex)))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("%s does not hold a hex Ed25519 public key", PubKeyFile)
+	}
+	if !ed25519.PrivateKey(priv).Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(pub)) {
+		return nil, nil, fmt.Errorf("%s does not match %s", PubKeyFile, PrivKeyFile)
+	}
 	return ed25519.PublicKey(pub), ed25519.PrivateKey(priv), nil
 }
 
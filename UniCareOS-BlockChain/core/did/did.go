@@ -0,0 +1,95 @@
+// Package did resolves the decentralized identifiers that patients and clinicians sign with.
+// Only did:key identifiers of Ed25519 keys are resolvable: the identifier encodes the public key itself
+// (multicodec ed25519-pub, base58btc multibase), so a signature can be checked without a registry.
+package did
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const keyPrefix = "did:key:z"
+
+// multicodec ed25519-pub (0xed) as an unsigned varint
+var ed25519Codec = []byte{0xed, 0x01}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// FromEd25519 returns the did:key identifier of pub
+func FromEd25519(pub ed25519.PublicKey) string {
+	return keyPrefix + base58Encode(append(append([]byte(nil), ed25519Codec...), pub...))
+}
+
+// Ed25519Key resolves a did:key identifier to its Ed25519 public key
+func Ed25519Key(id string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(id, keyPrefix) {
+		return nil, fmt.Errorf("cannot resolve %q: only did:key identifiers are supported", id)
+	}
+	raw, err := base58Decode(strings.TrimPrefix(id, keyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("malformed did:key %q: %v", id, err)
+	}
+	if len(raw) != len(ed25519Codec)+ed25519.PublicKeySize || raw[0] != ed25519Codec[0] || raw[1] != ed25519Codec[1] {
+		return nil, fmt.Errorf("did:key %q is not an Ed25519 key", id)
+	}
+	return ed25519.PublicKey(raw[len(ed25519Codec):]), nil
+}
+
+// Verify checks that sig over msg was made by the key id resolves to
+func Verify(id string, msg, sig []byte) error {
+	pub, err := Ed25519Key(id)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		return fmt.Errorf("signature does not verify against %s", id)
+	}
+	return nil
+}
+
+func base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	base, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty base58 string")
+	}
+	x := new(big.Int)
+	base := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		x.Mul(x, base)
+		x.Add(x, big.NewInt(int64(i)))
+	}
+	out := x.Bytes()
+	for _, c := range s {
+		if c != rune(base58Alphabet[0]) {
+			break
+		}
+		out = append([]byte{0}, out...)
+	}
+	return out, nil
+}
@@ -0,0 +1,41 @@
+package did
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+func TestDIDKeyRoundTrip(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	id := FromEd25519(pub)
+	if !strings.HasPrefix(id, "did:key:z6Mk") {
+		t.Fatalf("Ed25519 did:key should start with z6Mk, got %s", id)
+	}
+	got, err := Ed25519Key(id)
+	if err != nil || !got.Equal(pub) {
+		t.Fatalf("resolved %x, %v; want %x", got, err, pub)
+	}
+	msg := []byte("consent")
+	if err := Verify(id, msg, ed25519.Sign(priv, msg)); err != nil {
+		t.Fatal(err)
+	}
+	_, other, _ := ed25519.GenerateKey(nil)
+	if Verify(id, msg, ed25519.Sign(other, msg)) == nil {
+		t.Fatal("signature by another key verified")
+	}
+
+	for _, bad := range []string{"did:example:123", "did:key:z", "did:key:z0OIl", id[:len(id)-2]} {
+		if _, err := Ed25519Key(bad); err == nil {
+			t.Errorf("%q resolved", bad)
+		}
+	}
+}
+
+func TestBase58LeadingZeros(t *testing.T) {
+	in := []byte{0, 0, 1, 2, 3}
+	out, err := base58Decode(base58Encode(in))
+	if err != nil || string(out) != string(in) {
+		t.Fatalf("round trip gave %x, %v", out, err)
+	}
+}
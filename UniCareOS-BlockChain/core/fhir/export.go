@@ -0,0 +1,166 @@
+package fhir
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"unicareos/core/blockchain"
+)
+
+// FHIR R4 export.
+// Everything renders a patient's chain records as a searchset Bundle: the Patient, each record's
+// decrypted payload as a resource, and a Provenance per record naming the block and event that carry it.
+// Ingested FHIR payloads are returned as posted, with the record ID as their id; other payloads (HL7 v2
+// messages) are wrapped in a DocumentReference attachment.
+
+// Resource types the export emits besides the ingested ones
+const (
+	Patient    = "Patient"
+	Provenance = "Provenance"
+)
+
+// Identifier systems linking exported resources to the chain
+const (
+	SystemDID   = "urn:ietf:rfc:3986"
+	SystemBlock = "urn:unicareos:block" // Hex hash of the block carrying a record
+	SystemEvent = "urn:unicareos:event" // ID of a record's medical_record event
+)
+
+// hl7ContentType is the media type of HL7 v2 messages in ER7 encoding
+const hl7ContentType = "x-application/hl7-v2+er7"
+
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	Data        string `json:"data,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+type PatientResource struct {
+	ResourceType string       `json:"resourceType"`
+	Identifier   []Identifier `json:"identifier"`
+}
+
+// DocumentReferenceResource is the DocumentReference wrapping a payload that is not a FHIR resource
+type DocumentReferenceResource struct {
+	ResourceType string                     `json:"resourceType"`
+	ID           string                     `json:"id"`
+	Status       string                     `json:"status"`
+	Type         CodeableConcept            `json:"type"`
+	Subject      Reference                  `json:"subject"`
+	Date         string                     `json:"date,omitempty"`
+	Description  string                     `json:"description,omitempty"`
+	Content      []DocumentReferenceContent `json:"content"`
+}
+
+type DocumentReferenceContent struct {
+	Attachment Attachment `json:"attachment"`
+}
+
+type ProvenanceAgent struct {
+	Who Reference `json:"who"`
+}
+
+type ProvenanceEntity struct {
+	Role string    `json:"role"` // "source", or "revision" for the records the target revises
+	What Reference `json:"what"`
+}
+
+type ProvenanceResource struct {
+	ResourceType string             `json:"resourceType"`
+	ID           string             `json:"id"`
+	Target       []Reference        `json:"target"`
+	Recorded     string             `json:"recorded"`
+	Agent        []ProvenanceAgent  `json:"agent"`
+	Entity       []ProvenanceEntity `json:"entity"`
+}
+
+// ExportRecord is a record to export with its decrypted payload, nil when this node cannot provide it
+type ExportRecord struct {
+	blockchain.RecordEvent
+	Payload []byte
+}
+
+// Everything returns the searchset Bundle of patientDID's records. omitted records the reader may not
+// see are reported in an OperationOutcome entry.
+func Everything(patientDID string, records []ExportRecord, omitted int) (BundleResource, error) {
+	out := BundleResource{ResourceType: Bundle, Type: "searchset"}
+	add := func(fullURL string, resource interface{}) error {
+		data, err := json.Marshal(resource)
+		if err != nil {
+			return err
+		}
+		out.Entry = append(out.Entry, BundleEntry{FullURL: fullURL, Resource: data})
+		return nil
+	}
+	if err := add("", PatientResource{ResourceType: Patient, Identifier: []Identifier{{System: SystemDID, Value: patientDID}}}); err != nil {
+		return out, err
+	}
+	for _, rec := range records {
+		resourceType, resource := exportResource(patientDID, rec)
+		ref := resourceType + "/" + rec.Event.RecordID
+		if err := add(ref, resource); err != nil {
+			return out, err
+		}
+		if err := add(Provenance+"/"+rec.Event.EventID.String(), provenance(ref, rec)); err != nil {
+			return out, err
+		}
+	}
+	total := len(records)
+	out.Total = &total
+	if omitted > 0 {
+		msg := fmt.Sprintf("%d record(s) omitted: no consent covers their record type", omitted)
+		if err := add("", NewOperationOutcome(SeverityWarning, IssueSuppressed, msg)); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// exportResource returns the resource carrying a record's payload and its type
+func exportResource(patientDID string, rec ExportRecord) (string, interface{}) {
+	evt := rec.Event
+	var resource map[string]interface{}
+	if rec.Payload != nil && json.Unmarshal(rec.Payload, &resource) == nil {
+		if resourceType, _ := resource["resourceType"].(string); resourceType != "" {
+			resource["id"] = evt.RecordID
+			return resourceType, resource
+		}
+	}
+	doc := DocumentReferenceResource{
+		ResourceType: DocumentReference,
+		ID:           evt.RecordID,
+		Status:       "current",
+		Type:         CodeableConcept{Text: evt.RecordType},
+		Subject:      Reference{Identifier: &Identifier{System: SystemDID, Value: patientDID}},
+		Date:         evt.Timestamp.UTC().Format(time.RFC3339Nano),
+	}
+	if rec.Payload == nil {
+		doc.Description = "payload is not available on this node"
+		doc.Content = []DocumentReferenceContent{{Attachment: Attachment{Title: evt.PayloadHash}}}
+	} else {
+		doc.Content = []DocumentReferenceContent{{Attachment: Attachment{ContentType: hl7ContentType, Data: base64.StdEncoding.EncodeToString(rec.Payload)}}}
+	}
+	return DocumentReference, doc
+}
+
+// provenance links the resource at ref to the block and event carrying its record
+func provenance(ref string, rec ExportRecord) ProvenanceResource {
+	evt := rec.Event
+	p := ProvenanceResource{
+		ResourceType: Provenance,
+		ID:           evt.EventID.String(),
+		Target:       []Reference{{Reference: ref}},
+		Recorded:     evt.Timestamp.UTC().Format(time.RFC3339Nano),
+		Agent:        []ProvenanceAgent{{Who: Reference{Identifier: &Identifier{Value: evt.ProviderID}}}},
+		Entity: []ProvenanceEntity{
+			{Role: "source", What: Reference{Identifier: &Identifier{System: SystemBlock, Value: rec.BlockID}}},
+			{Role: "source", What: Reference{Identifier: &Identifier{System: SystemEvent, Value: evt.EventID.String()}}},
+		},
+	}
+	for _, id := range evt.DocLineage {
+		p.Entity = append(p.Entity, ProvenanceEntity{Role: "revision", What: Reference{Identifier: &Identifier{System: SystemEvent, Value: id}}})
+	}
+	return p
+}
@@ -0,0 +1,152 @@
+package fhir
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Minimal FHIR R4 data types: only the elements UniCareOS reads or writes.
+
+// Resource types UniCareOS ingests
+const (
+	DiagnosticReport  = "DiagnosticReport"
+	Observation       = "Observation"
+	ImagingStudy      = "ImagingStudy"
+	DocumentReference = "DocumentReference"
+	Bundle            = "Bundle"
+)
+
+// ContentType is the FHIR JSON media type
+const ContentType = "application/fhir+json"
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// HasCode reports whether any coding carries code
+func (c CodeableConcept) HasCode(code string) bool {
+	for _, cd := range c.Coding {
+		if strings.EqualFold(cd.Code, code) {
+			return true
+		}
+	}
+	return false
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+// BundleEntryRequest is the action a transaction Bundle entry asks for
+type BundleEntryRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// BundleEntryResponse reports the outcome of one transaction Bundle entry
+type BundleEntryResponse struct {
+	Status   string            `json:"status"`
+	Location string            `json:"location,omitempty"`
+	Outcome  *OperationOutcome `json:"outcome,omitempty"`
+}
+
+type BundleEntry struct {
+	FullURL  string               `json:"fullUrl,omitempty"`
+	Resource json.RawMessage      `json:"resource,omitempty"`
+	Request  *BundleEntryRequest  `json:"request,omitempty"`
+	Response *BundleEntryResponse `json:"response,omitempty"`
+}
+
+type BundleResource struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id,omitempty"`
+	Type         string        `json:"type"`
+	Total        *int          `json:"total,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+// Issue severities and the issue-type codes UniCareOS reports
+const (
+	SeverityFatal       = "fatal"
+	SeverityError       = "error"
+	SeverityWarning     = "warning"
+	SeverityInformation = "information"
+
+	IssueStructure     = "structure"
+	IssueRequired      = "required"
+	IssueValue         = "value"
+	IssueInvalid       = "invalid"
+	IssueNotSupported  = "not-supported"
+	IssueDuplicate     = "duplicate"
+	IssueForbidden     = "forbidden"
+	IssueNotFound      = "not-found"
+	IssueSuppressed    = "suppressed"
+	IssueTransient     = "transient"
+	IssueException     = "exception"
+	IssueInformational = "informational"
+)
+
+type Issue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+// NewOperationOutcome returns an OperationOutcome with one issue
+func NewOperationOutcome(severity, code, diagnostics string, expression ...string) *OperationOutcome {
+	return &OperationOutcome{ResourceType: "OperationOutcome", Issue: []Issue{{Severity: severity, Code: code, Diagnostics: diagnostics, Expression: expression}}}
+}
+
+// Error is a resource that failed validation, with one issue per problem found
+type Error struct {
+	Issues []Issue
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Issues))
+	for _, is := range e.Issues {
+		msg := is.Diagnostics
+		if len(is.Expression) > 0 {
+			msg = strings.Join(is.Expression, ",") + ": " + msg
+		}
+		msgs = append(msgs, msg)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Outcome returns the OperationOutcome reporting the error
+func (e *Error) Outcome() *OperationOutcome {
+	return &OperationOutcome{ResourceType: "OperationOutcome", Issue: e.Issues}
+}
+
+func (e *Error) add(code, expression, diagnostics string) {
+	e.Issues = append(e.Issues, Issue{Severity: SeverityError, Code: code, Diagnostics: diagnostics, Expression: []string{expression}})
+}
+
+// errOrNil returns e, or nil when it holds no issues
+func (e *Error) errOrNil() error {
+	if len(e.Issues) == 0 {
+		return nil
+	}
+	return e
+}
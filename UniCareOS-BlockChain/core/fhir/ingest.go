@@ -0,0 +1,215 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"unicareos/core/ingest"
+)
+
+// FHIR R4 ingestion.
+// DiagnosticReport, Observation, ImagingStudy and DocumentReference resources, alone or as entries of a
+// transaction Bundle, are validated and mapped onto ingest.Documents. The subject must name the patient
+// by DID, either as subject.identifier.value or as a "Patient/<did>" reference. The whole resource becomes
+// the record's encrypted payload.
+
+// LOINC code of discharge summaries
+const loincDischargeSummary = "18842-5"
+
+var didPattern = regexp.MustCompile(`^did:[a-z0-9]+:[a-zA-Z0-9.-]+$`)
+
+// ingestedResource holds the elements ingestion reads from any supported resource
+type ingestedResource struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	Subject           *Reference        `json:"subject"`
+	Category          []CodeableConcept `json:"category"`
+	Type              *CodeableConcept  `json:"type"`
+	Issued            string            `json:"issued"`
+	EffectiveDateTime string            `json:"effectiveDateTime"`
+	Started           string            `json:"started"`
+	Date              string            `json:"date"`
+}
+
+// ParseResource validates a single resource and maps it onto a Document
+func ParseResource(data []byte) (ingest.Document, error) {
+	e := &Error{}
+	var head struct {
+		ResourceType string `json:"resourceType"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		e.add(IssueStructure, "Resource", "invalid JSON: "+err.Error())
+		return ingest.Document{}, e
+	}
+	path := head.ResourceType
+	if path == "" {
+		path = "Resource"
+	}
+	doc, _ := mapResource(data, path, e)
+	return doc, e.errOrNil()
+}
+
+// ParseTransaction validates a transaction Bundle and maps each of its entries onto a Document. Every
+// entry must be valid for any to be returned.
+func ParseTransaction(data []byte) ([]ingest.Document, error) {
+	e := &Error{}
+	var b BundleResource
+	if err := json.Unmarshal(data, &b); err != nil {
+		e.add(IssueStructure, Bundle, "invalid JSON: "+err.Error())
+		return nil, e
+	}
+	if b.ResourceType != Bundle {
+		e.add(IssueInvalid, "resourceType", fmt.Sprintf("expected a Bundle, got %q", b.ResourceType))
+		return nil, e
+	}
+	if b.Type != "transaction" {
+		e.add(IssueNotSupported, "Bundle.type", fmt.Sprintf("only transaction Bundles are accepted, got %q", b.Type))
+		return nil, e
+	}
+	if len(b.Entry) == 0 {
+		e.add(IssueRequired, "Bundle.entry", "transaction Bundle has no entries")
+		return nil, e
+	}
+	docs := make([]ingest.Document, 0, len(b.Entry))
+	for i, entry := range b.Entry {
+		path := fmt.Sprintf("Bundle.entry[%d]", i)
+		if entry.Request == nil || (entry.Request.Method != "POST" && entry.Request.Method != "PUT") {
+			e.add(IssueNotSupported, path+".request.method", "entries must create or update a resource (POST or PUT)")
+			continue
+		}
+		if len(entry.Resource) == 0 {
+			e.add(IssueRequired, path+".resource", "entry carries no resource")
+			continue
+		}
+		if doc, ok := mapResource(entry.Resource, path+".resource", e); ok {
+			docs = append(docs, doc)
+		}
+	}
+	if err := e.errOrNil(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// mapResource validates one resource, adding its problems to e under path. path is the resource type
+// for a bare resource.
+func mapResource(data []byte, path string, e *Error) (ingest.Document, bool) {
+	var r ingestedResource
+	if err := json.Unmarshal(data, &r); err != nil {
+		e.add(IssueStructure, path, "invalid resource: "+err.Error())
+		return ingest.Document{}, false
+	}
+	before := len(e.Issues)
+	doc := ingest.Document{Body: data}
+
+	switch r.ResourceType {
+	case DiagnosticReport:
+		doc.RecordType = "lab_result"
+		for _, c := range r.Category {
+			if c.HasCode("RAD") { // v2-0074 radiology section
+				doc.RecordType = "imaging"
+			}
+		}
+	case Observation:
+		for _, c := range r.Category {
+			switch {
+			case c.HasCode("laboratory"):
+				doc.RecordType = "lab_result"
+			case c.HasCode("imaging"):
+				doc.RecordType = "imaging"
+			}
+		}
+		if doc.RecordType == "" {
+			e.add(IssueNotSupported, path+".category", "only laboratory and imaging Observations are accepted")
+		}
+	case ImagingStudy:
+		doc.RecordType = "imaging"
+	case DocumentReference:
+		if r.Type == nil || !r.Type.HasCode(loincDischargeSummary) {
+			e.add(IssueNotSupported, path+".type", "only discharge summaries (LOINC "+loincDischargeSummary+") are accepted")
+		}
+		doc.RecordType = "discharge_summary"
+	case "":
+		e.add(IssueRequired, path+".resourceType", "resourceType is missing")
+		return ingest.Document{}, false
+	default:
+		e.add(IssueNotSupported, path+".resourceType", fmt.Sprintf("%s resources are not accepted", r.ResourceType))
+		return ingest.Document{}, false
+	}
+
+	switch r.Status {
+	case "":
+		e.add(IssueRequired, path+".status", "status is missing")
+	case "entered-in-error":
+		e.add(IssueValue, path+".status", "resources entered in error are not ingested")
+	}
+
+	doc.PatientDID, doc.PatientRef = subjectDID(r.Subject)
+	if r.Subject == nil {
+		e.add(IssueRequired, path+".subject", "subject is missing")
+	} else if !didPattern.MatchString(doc.PatientDID) {
+		e.add(IssueValue, path+".subject", "subject must name the patient by DID (subject.identifier.value or Patient/<did>)")
+	}
+
+	dateField, dateValue := issuedDate(r)
+	if dateValue == "" {
+		e.add(IssueRequired, path+"."+dateField, dateField+" is missing")
+	} else if t, err := parseDateTime(dateValue); err != nil {
+		e.add(IssueValue, path+"."+dateField, err.Error())
+	} else {
+		doc.IssuedAt = t
+	}
+
+	doc.Key = r.ResourceType
+	if r.ID != "" {
+		doc.Key += "/" + r.ID
+	}
+	doc.Provenance = "fhir-r4:" + doc.Key
+	return doc, len(e.Issues) == before
+}
+
+// subjectDID returns the patient DID a subject names and the source reference kept with the record
+func subjectDID(s *Reference) (string, string) {
+	if s == nil {
+		return "", ""
+	}
+	ref := s.Reference
+	if s.Identifier != nil && strings.HasPrefix(s.Identifier.Value, "did:") {
+		if ref == "" {
+			ref = s.Identifier.Value
+		}
+		return s.Identifier.Value, ref
+	}
+	if did, ok := strings.CutPrefix(s.Reference, "Patient/"); ok && strings.HasPrefix(did, "did:") {
+		return did, ref
+	}
+	return "", ref
+}
+
+// issuedDate returns the element a resource's issue time is read from and its value
+func issuedDate(r ingestedResource) (string, string) {
+	switch r.ResourceType {
+	case ImagingStudy:
+		return "started", r.Started
+	case DocumentReference:
+		return "date", r.Date
+	}
+	if r.Issued != "" {
+		return "issued", r.Issued
+	}
+	return "issued", r.EffectiveDateTime
+}
+
+// parseDateTime parses a FHIR instant, or a dateTime with at least day precision
+func parseDateTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a FHIR dateTime with a time zone or a full date", s)
+}
@@ -0,0 +1,88 @@
+package fhir
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const patientDID = "did:key:z6MkpTHR8VNsBxYAAWHut2Geadd9jSwuBV8xRoAnwWsdvktH"
+
+func TestParseResourceMapsRecordFields(t *testing.T) {
+	cases := []struct {
+		name, resource, recordType, issuedAt string
+	}{
+		{"lab report", `{"resourceType":"DiagnosticReport","id":"r1","status":"final","subject":{"identifier":{"system":"urn:ietf:rfc:3986","value":"` + patientDID + `"}},"issued":"2025-03-01T10:00:00+02:00"}`, "lab_result", "2025-03-01T08:00:00Z"},
+		{"radiology report", `{"resourceType":"DiagnosticReport","id":"r2","status":"final","category":[{"coding":[{"code":"RAD"}]}],"subject":{"reference":"Patient/` + patientDID + `"},"effectiveDateTime":"2025-03-01"}`, "imaging", "2025-03-01T00:00:00Z"},
+		{"lab observation", `{"resourceType":"Observation","status":"final","category":[{"coding":[{"code":"laboratory"}]}],"subject":{"reference":"Patient/` + patientDID + `"},"issued":"2025-03-01T10:00:00Z"}`, "lab_result", "2025-03-01T10:00:00Z"},
+		{"imaging study", `{"resourceType":"ImagingStudy","status":"available","subject":{"reference":"Patient/` + patientDID + `"},"started":"2025-03-01T10:00:00Z"}`, "imaging", "2025-03-01T10:00:00Z"},
+		{"discharge summary", `{"resourceType":"DocumentReference","status":"current","type":{"coding":[{"system":"http://loinc.org","code":"18842-5"}]},"subject":{"reference":"Patient/` + patientDID + `"},"date":"2025-03-01T10:00:00Z"}`, "discharge_summary", "2025-03-01T10:00:00Z"},
+	}
+	for _, c := range cases {
+		doc, err := ParseResource([]byte(c.resource))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if doc.RecordType != c.recordType || doc.PatientDID != patientDID || doc.IssuedAt.Format(time.RFC3339) != c.issuedAt {
+			t.Errorf("%s: mapped to %s for %s issued %s", c.name, doc.RecordType, doc.PatientDID, doc.IssuedAt.Format(time.RFC3339))
+		}
+		if string(doc.Body) != c.resource {
+			t.Errorf("%s: body is not the original resource", c.name)
+		}
+	}
+}
+
+func TestParseResourceRejectsInvalid(t *testing.T) {
+	cases := []struct {
+		name, resource, code, expression string
+	}{
+		{"unsupported type", `{"resourceType":"Patient","id":"p1"}`, IssueNotSupported, "Patient.resourceType"},
+		{"subject without DID", `{"resourceType":"DiagnosticReport","status":"final","subject":{"reference":"Patient/123"},"issued":"2025-03-01T10:00:00Z"}`, IssueValue, "DiagnosticReport.subject"},
+		{"missing status", `{"resourceType":"ImagingStudy","subject":{"reference":"Patient/` + patientDID + `"},"started":"2025-03-01T10:00:00Z"}`, IssueRequired, "ImagingStudy.status"},
+		{"vital signs", `{"resourceType":"Observation","status":"final","category":[{"coding":[{"code":"vital-signs"}]}],"subject":{"reference":"Patient/` + patientDID + `"},"issued":"2025-03-01T10:00:00Z"}`, IssueNotSupported, "Observation.category"},
+		{"other document", `{"resourceType":"DocumentReference","status":"current","type":{"coding":[{"code":"11488-4"}]},"subject":{"reference":"Patient/` + patientDID + `"},"date":"2025-03-01T10:00:00Z"}`, IssueNotSupported, "DocumentReference.type"},
+		{"local time", `{"resourceType":"DiagnosticReport","status":"final","subject":{"reference":"Patient/` + patientDID + `"},"issued":"2025-03-01T10:00:00"}`, IssueValue, "DiagnosticReport.issued"},
+	}
+	for _, c := range cases {
+		_, err := ParseResource([]byte(c.resource))
+		var ferr *Error
+		if !errors.As(err, &ferr) {
+			t.Errorf("%s: accepted (%v)", c.name, err)
+			continue
+		}
+		if is := ferr.Issues[0]; is.Code != c.code || is.Expression[0] != c.expression {
+			t.Errorf("%s: issue %s at %v, want %s at %s", c.name, is.Code, is.Expression, c.code, c.expression)
+		}
+	}
+}
+
+func TestParseTransactionReportsEveryInvalidEntry(t *testing.T) {
+	good := `{"resourceType":"ImagingStudy","status":"available","subject":{"reference":"Patient/` + patientDID + `"},"started":"2025-03-01T10:00:00Z"}`
+	bundle := `{"resourceType":"Bundle","type":"transaction","entry":[
+		{"resource":` + good + `,"request":{"method":"POST","url":"ImagingStudy"}},
+		{"resource":{"resourceType":"Observation","status":"final"},"request":{"method":"POST","url":"Observation"}},
+		{"resource":` + good + `,"request":{"method":"DELETE","url":"ImagingStudy/1"}}]}`
+	docs, err := ParseTransaction([]byte(bundle))
+	if err == nil || docs != nil {
+		t.Fatal("transaction with invalid entries accepted")
+	}
+	msg := err.Error()
+	for _, want := range []string{"Bundle.entry[1].resource.subject", "Bundle.entry[1].resource.category", "Bundle.entry[2].request.method"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("no issue at %s in %q", want, msg)
+		}
+	}
+	if strings.Contains(msg, "Bundle.entry[0]") {
+		t.Errorf("valid entry reported: %q", msg)
+	}
+
+	if _, err := ParseTransaction([]byte(`{"resourceType":"Bundle","type":"batch","entry":[]}`)); err == nil {
+		t.Error("batch Bundle accepted")
+	}
+	docs, err = ParseTransaction([]byte(`{"resourceType":"Bundle","type":"transaction","entry":[{"resource":` + good + `,"request":{"method":"POST","url":"ImagingStudy"}}]}`))
+	if err != nil || len(docs) != 1 || docs[0].RecordType != "imaging" {
+		t.Fatalf("valid transaction: %v %+v", err, docs)
+	}
+}
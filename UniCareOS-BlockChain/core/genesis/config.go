@@ -26,5 +26,5 @@ type GenesisConfig struct {
 	GenesisTime      time.Time         `json:"genesisTime"`
 	InitialValidators []ValidatorConfig `json:"initialValidators"`
 	InitialParams    InitialParams     `json:"initialParams"`
-	InitialSchemaHash string           `json:"initialSchemaHash,omitempty"`
+	InitialSchemaHash string           `json:"initialSchemaHash,omitempty"` // Hex SHA-256 of the v1 medical record schema
 }
@@ -94,7 +94,7 @@ func CreateGenesisBlockFromConfig(cfg *GenesisConfig) block.Block {
         ProtocolVersion: cfg.InitialParams.ProtocolVersion,
         Height:          0,
         PrevHash:        "",
-        MerkleRoot:      cfg.InitialSchemaHash, // Placeholder for now
+        MerkleRoot:      cfg.InitialSchemaHash, // Pins the v1 record schema (see blockchain.RegisterGenesisSchema)
         Timestamp:       genesisTime,
         ValidatorDID:    validatorDID,
         OpUnitsUsed:     0,
@@ -0,0 +1,59 @@
+package hl7
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Acknowledgment codes (MSA-1, original acknowledgment mode)
+const (
+	AckAccept = "AA" // Accepted and submitted
+	AckError  = "AE" // The message content is in error; correct it before resending
+	AckReject = "AR" // The message was rejected (unsupported type, unknown sender, node unavailable)
+)
+
+// BuildACK returns the ACK answering m (nil if it could not be parsed), with an ERR segment per issue.
+// The ACK uses m's delimiters.
+func BuildACK(m *Message, code, text string, issues []Issue, now time.Time) []byte {
+	d := DefaultDelimiters
+	var msh Segment
+	if m != nil {
+		d = m.Delimiters
+		msh, _ = m.Segment("MSH")
+	}
+	field := func(n int, def string) string {
+		if v := msh.Field(n); v != "" {
+			return v
+		}
+		return def
+	}
+	enc := string([]byte{d.Component, d.Repetition, d.Escape, d.Subcomponent})
+	comp := string(d.Component)
+	trigger := ""
+	if m != nil {
+		trigger = m.Get(msh, 9, 2)
+	}
+	segments := [][]string{
+		{"MSH" + string(d.Field) + enc, field(5, "UniCareOS"), field(6, ""), field(3, ""), field(4, ""),
+			now.UTC().Format("20060102150405") + "+0000", "", "ACK" + comp + trigger + comp + "ACK",
+			strconv.FormatInt(now.UnixNano(), 10), field(11, "P"), field(12, "2.5.1")},
+		{"MSA", code, field(10, ""), d.Encode(text)},
+	}
+	for _, is := range issues {
+		location := ""
+		if is.Segment != "" {
+			location = is.Segment + comp + "1"
+			if is.Field > 0 {
+				location += comp + strconv.Itoa(is.Field)
+			}
+		}
+		segments = append(segments, []string{"ERR", "", location,
+			is.Code + comp + d.Encode(errorText[is.Code]) + comp + "HL70357", "E", "", "", d.Encode(is.Message)})
+	}
+	lines := make([]string, len(segments))
+	for i, seg := range segments {
+		lines[i] = strings.Join(seg, string(d.Field))
+	}
+	return []byte(strings.Join(lines, "\r") + "\r")
+}
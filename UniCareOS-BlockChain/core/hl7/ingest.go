@@ -0,0 +1,175 @@
+package hl7
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"unicareos/core/ingest"
+)
+
+// HL7 v2 ingestion.
+// ORU^R01 results and MDM^T02 documents are mapped onto ingest.Documents: the patient DID comes from a
+// PID-3 identifier (one whose ID is a DID, or whose identifier type is "DID"), the record type from
+// OBR-24 or TXA-2, and the issue time from OBR-22/OBR-7, TXA-4 or MSH-7. The original message is the
+// record's encrypted payload.
+
+// Error condition codes (HL7 table 0357) reported in ERR-3
+const (
+	ErrSegmentSequence        = "100"
+	ErrRequiredField          = "101"
+	ErrDataType               = "102"
+	ErrTableValue             = "103"
+	ErrUnsupportedMessageType = "200"
+	ErrUnsupportedEvent       = "201"
+	ErrDuplicateKey           = "205"
+	ErrInternal               = "207"
+)
+
+var errorText = map[string]string{
+	ErrSegmentSequence:        "Segment sequence error",
+	ErrRequiredField:          "Required field missing",
+	ErrDataType:               "Data type error",
+	ErrTableValue:             "Table value not found",
+	ErrUnsupportedMessageType: "Unsupported message type",
+	ErrUnsupportedEvent:       "Unsupported event code",
+	ErrDuplicateKey:           "Duplicate key identifier",
+	ErrInternal:               "Application internal error",
+}
+
+var didPattern = regexp.MustCompile(`^did:[a-z0-9]+:[a-zA-Z0-9.-]+$`)
+
+// Issue is one problem with a message, reported to the sender in an ERR segment
+type Issue struct {
+	Segment string // Segment the problem is in, e.g. "PID"
+	Field   int    // Field number, 0 for the whole segment
+	Code    string // HL7 table 0357 code
+	Message string
+}
+
+func (is Issue) String() string {
+	loc := is.Segment
+	if is.Field > 0 {
+		loc = fmt.Sprintf("%s-%d", is.Segment, is.Field)
+	}
+	return loc + ": " + is.Message
+}
+
+// MessageType returns MSH-9 as "ORU^R01"
+func (m *Message) MessageType() string {
+	msh, _ := m.Segment("MSH")
+	return m.Get(msh, 9, 1) + "^" + m.Get(msh, 9, 2)
+}
+
+// SendingFacility returns the namespace ID of MSH-4
+func (m *Message) SendingFacility() string {
+	msh, _ := m.Segment("MSH")
+	return m.Get(msh, 4, 1)
+}
+
+// ControlID returns MSH-10
+func (m *Message) ControlID() string {
+	msh, _ := m.Segment("MSH")
+	return m.Get(msh, 10, 1)
+}
+
+// ToDocument validates an ORU^R01 or MDM^T02 message and maps it onto a Document. Timestamps without an
+// offset are read in loc.
+func ToDocument(m *Message, raw []byte, loc *time.Location) (ingest.Document, []Issue) {
+	var issues []Issue
+	add := func(seg string, field int, code, format string, args ...interface{}) {
+		issues = append(issues, Issue{Segment: seg, Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	msh, _ := m.Segment("MSH")
+	doc := ingest.Document{Body: raw}
+
+	// timestamp reads the first of the given fields that is present
+	timestamp := func(seg Segment, fields ...int) {
+		for _, f := range fields {
+			v := m.Get(seg, f, 1)
+			if v == "" {
+				continue
+			}
+			t, err := ParseTS(v, loc)
+			if err != nil {
+				add(seg.Name, f, ErrDataType, "%v", err)
+				return
+			}
+			doc.IssuedAt = t
+			return
+		}
+		if v := m.Get(msh, 7, 1); v != "" {
+			t, err := ParseTS(v, loc)
+			if err != nil {
+				add("MSH", 7, ErrDataType, "%v", err)
+				return
+			}
+			doc.IssuedAt = t
+			return
+		}
+		add(seg.Name, fields[0], ErrRequiredField, "no issue time in %s or MSH-7", seg.Name)
+	}
+
+	msgType := m.Get(msh, 9, 1)
+	switch trigger := m.Get(msh, 9, 2); {
+	case msgType == "ORU" && trigger == "R01":
+		obr, ok := m.Segment("OBR")
+		if !ok {
+			add("OBR", 0, ErrSegmentSequence, "ORU^R01 carries no OBR segment")
+			break
+		}
+		doc.RecordType = "lab_result"
+		if m.Get(obr, 24, 1) == "RAD" { // Diagnostic service section: radiology
+			doc.RecordType = "imaging"
+		}
+		timestamp(obr, 22, 7)
+		if len(m.All("OBX")) == 0 {
+			add("OBX", 0, ErrSegmentSequence, "ORU^R01 carries no OBX results")
+		}
+	case msgType == "MDM" && trigger == "T02":
+		txa, ok := m.Segment("TXA")
+		if !ok {
+			add("TXA", 0, ErrSegmentSequence, "MDM^T02 carries no TXA segment")
+			break
+		}
+		if docType := m.Get(txa, 2, 1); docType != "DS" { // HL7 table 0270: discharge summary
+			add("TXA", 2, ErrTableValue, "document type %q is not accepted; only discharge summaries (DS) are", docType)
+		}
+		doc.RecordType = "discharge_summary"
+		timestamp(txa, 4, 6)
+		if len(m.All("OBX")) == 0 {
+			add("OBX", 0, ErrSegmentSequence, "MDM^T02 carries no OBX document content")
+		}
+	case msgType == "ORU" || msgType == "MDM":
+		add("MSH", 9, ErrUnsupportedEvent, "%s^%s is not accepted", msgType, trigger)
+		return doc, issues
+	default:
+		add("MSH", 9, ErrUnsupportedMessageType, "%s messages are not accepted", msgType)
+		return doc, issues
+	}
+
+	pid, ok := m.Segment("PID")
+	if !ok {
+		add("PID", 0, ErrSegmentSequence, "message carries no PID segment")
+	} else {
+		for i, rep := range m.Repetitions(pid, 3) {
+			id := m.Component(rep, 1)
+			if i == 0 {
+				doc.PatientRef = id
+			}
+			if strings.HasPrefix(id, "did:") || m.Component(rep, 5) == "DID" {
+				doc.PatientDID = id
+			}
+		}
+		if doc.PatientDID == "" {
+			add("PID", 3, ErrRequiredField, "no patient identifier is a DID")
+		} else if !didPattern.MatchString(doc.PatientDID) {
+			add("PID", 3, ErrDataType, "%q is not a DID", doc.PatientDID)
+		}
+	}
+
+	doc.Key = fmt.Sprintf("%s/%s/%s", m.MessageType(), m.SendingFacility(), m.ControlID())
+	doc.Provenance = "hl7v2:" + doc.Key
+	return doc, issues
+}
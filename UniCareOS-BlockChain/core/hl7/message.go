@@ -0,0 +1,187 @@
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Minimal HL7 v2 ER7 ("pipe and hat") parsing: segments, fields, repetitions and components, with
+// the delimiters a message declares in its MSH segment.
+
+// Delimiters are the separators a message declares in MSH-1 and MSH-2
+type Delimiters struct {
+	Field, Component, Repetition, Escape, Subcomponent byte
+}
+
+// DefaultDelimiters are the conventional |^~\& delimiters, used for messages UniCareOS writes
+var DefaultDelimiters = Delimiters{'|', '^', '~', '\\', '&'}
+
+// Segment is one segment of a message. Fields are numbered as in the HL7 standard, so for MSH
+// Field(1) is the field separator and Field(2) the encoding characters.
+type Segment struct {
+	Name   string
+	fields []string // fields[0] is the segment name
+}
+
+// Field returns the raw (still escaped) value of field n, or "" if absent
+func (s Segment) Field(n int) string {
+	if n <= 0 || n >= len(s.fields) {
+		return ""
+	}
+	return s.fields[n]
+}
+
+// Message is a parsed HL7 v2 message
+type Message struct {
+	Delimiters Delimiters
+	Segments   []Segment
+}
+
+// Parse parses an ER7-encoded message. Segments may end in CR, LF or CRLF.
+func Parse(data []byte) (*Message, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\r")
+	text = strings.ReplaceAll(text, "\n", "\r")
+	if !strings.HasPrefix(text, "MSH") || len(text) < 8 {
+		return nil, errors.New("message does not start with an MSH segment")
+	}
+	enc := text[4:]
+	if i := strings.IndexAny(enc, string(text[3])+"\r"); i >= 0 {
+		enc = enc[:i]
+	}
+	if len(enc) < 4 {
+		return nil, fmt.Errorf("MSH-2 encoding characters %q are incomplete", enc)
+	}
+	d := Delimiters{Field: text[3], Component: enc[0], Repetition: enc[1], Escape: enc[2], Subcomponent: enc[3]}
+	m := &Message{Delimiters: d}
+	for _, line := range strings.Split(text, "\r") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, string(d.Field))
+		if len(parts[0]) != 3 {
+			return nil, fmt.Errorf("invalid segment name %q", parts[0])
+		}
+		seg := Segment{Name: parts[0]}
+		if seg.Name == "MSH" {
+			// MSH-1 is the field separator itself
+			seg.fields = append([]string{"MSH", string(d.Field)}, parts[1:]...)
+		} else {
+			seg.fields = parts
+		}
+		m.Segments = append(m.Segments, seg)
+	}
+	return m, nil
+}
+
+// Segment returns the first segment named name
+func (m *Message) Segment(name string) (Segment, bool) {
+	for _, s := range m.Segments {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Segment{}, false
+}
+
+// All returns every segment named name, in order
+func (m *Message) All(name string) []Segment {
+	var out []Segment
+	for _, s := range m.Segments {
+		if s.Name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Repetitions returns the raw repetitions of a field
+func (m *Message) Repetitions(s Segment, field int) []string {
+	v := s.Field(field)
+	if v == "" {
+		return nil
+	}
+	if s.Name == "MSH" && field <= 2 {
+		return []string{v}
+	}
+	return strings.Split(v, string(m.Delimiters.Repetition))
+}
+
+// Component returns component comp (1-based) of a raw field value, unescaped
+func (m *Message) Component(value string, comp int) string {
+	parts := strings.Split(value, string(m.Delimiters.Component))
+	if comp <= 0 || comp > len(parts) {
+		return ""
+	}
+	return m.Unescape(parts[comp-1])
+}
+
+// Get returns component comp of the first repetition of a field, unescaped
+func (m *Message) Get(s Segment, field, comp int) string {
+	reps := m.Repetitions(s, field)
+	if len(reps) == 0 {
+		return ""
+	}
+	return m.Component(reps[0], comp)
+}
+
+// Unescape resolves the delimiter escape sequences (\F\ \S\ \R\ \T\ \E\) in a value
+func (m *Message) Unescape(v string) string {
+	e := string(m.Delimiters.Escape)
+	if !strings.Contains(v, e) {
+		return v
+	}
+	return strings.NewReplacer(
+		e+"F"+e, string(m.Delimiters.Field),
+		e+"S"+e, string(m.Delimiters.Component),
+		e+"R"+e, string(m.Delimiters.Repetition),
+		e+"T"+e, string(m.Delimiters.Subcomponent),
+		e+"E"+e, e,
+	).Replace(v)
+}
+
+// Encode escapes the delimiters in a value written with d
+func (d Delimiters) Encode(v string) string {
+	e := string(d.Escape)
+	return strings.NewReplacer(
+		e, e+"E"+e,
+		string(d.Field), e+"F"+e,
+		string(d.Component), e+"S"+e,
+		string(d.Repetition), e+"R"+e,
+		string(d.Subcomponent), e+"T"+e,
+		"\r", " ",
+		"\n", " ",
+	).Replace(v)
+}
+
+// ParseTS parses an HL7 TS/DTM value (YYYYMMDD[HH[MM[SS[.S...]]]][+/-ZZZZ]). Values without an offset are
+// read in loc.
+func ParseTS(v string, loc *time.Location) (time.Time, error) {
+	value, offset := v, ""
+	if i := strings.LastIndexAny(v, "+-"); i >= 8 {
+		value, offset = v[:i], v[i:]
+	}
+	frac := ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		value, frac = value[:i], value[i:]
+	}
+	layouts := map[int]string{8: "20060102", 10: "2006010215", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(value)]
+	if !ok || (frac != "" && len(value) != 14) {
+		return time.Time{}, fmt.Errorf("%q is not an HL7 timestamp", v)
+	}
+	if frac != "" {
+		layout += "." + strings.Repeat("0", len(frac)-1)
+		value += frac
+	}
+	if offset != "" {
+		layout += "-0700"
+		value += offset
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an HL7 timestamp", v)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,378 @@
+package hl7
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/ingest"
+	"unicareos/core/storage"
+)
+
+// MLLP framing: <VT> message <FS><CR>
+const (
+	startBlock     = 0x0b
+	endBlock       = 0x1c
+	carriageReturn = 0x0d
+)
+
+// ErrFrameTooLarge is returned for MLLP frames above Config.MaxMessageSize
+var ErrFrameTooLarge = errors.New("MLLP frame too large")
+
+// Config configures the MLLP listener
+type Config struct {
+	Addr           string                      // TCP listen address, e.g. ":2575"
+	TLS            *tls.Config                 // Serves MLLP over TLS when set; set ClientAuth so senders present certificates
+	Senders        map[string]*ingest.Facility // Sending facility (MSH-4) → facility whose wallet signs its records
+	Bindings       map[string]Binding          // Sending facility (MSH-4) → connections it may send from; required for every sender
+	Location       *time.Location              // Zone of timestamps sent without an offset (UTC when nil)
+	MaxMessageSize int                         // Largest accepted message in bytes (1 MiB when 0)
+	IdleTimeout    time.Duration               // Connections idle this long are closed (5 minutes when 0)
+	AcceptedTTL    time.Duration               // How long accepted control IDs are remembered (24 hours when 0)
+}
+
+// Binding ties a sending facility to the connections it may send from. Each constraint set must hold, and at
+// least one must be set.
+type Binding struct {
+	CertSHA256 string       // Hex SHA-256 of the DER client certificate the facility presents over TLS
+	Networks   []*net.IPNet // Source networks the facility connects from
+}
+
+// ParseBinding parses a binding written as ";"-separated source CIDRs and "sha256:<hex>" certificate hashes
+func ParseBinding(spec string) (Binding, error) {
+	var b Binding
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if hash, ok := strings.CutPrefix(item, "sha256:"); ok {
+			if raw, err := hex.DecodeString(hash); err != nil || len(raw) != sha256.Size {
+				return Binding{}, fmt.Errorf("certificate hash %q is not a hex SHA-256", hash)
+			}
+			if b.CertSHA256 != "" {
+				return Binding{}, errors.New("more than one certificate hash")
+			}
+			b.CertSHA256 = strings.ToLower(hash)
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return Binding{}, err
+		}
+		b.Networks = append(b.Networks, ipnet)
+	}
+	if b.CertSHA256 == "" && len(b.Networks) == 0 {
+		return Binding{}, errors.New("binding names no certificate or source network")
+	}
+	return b, nil
+}
+
+// allows reports why a message from o may not claim the bound facility, or nil if it may
+func (b Binding) allows(o Origin) error {
+	if b.CertSHA256 == "" && len(b.Networks) == 0 {
+		return errors.New("no certificate or source network is bound to it")
+	}
+	if b.CertSHA256 != "" && !strings.EqualFold(o.CertSHA256, b.CertSHA256) {
+		return errors.New("the connection did not present its client certificate")
+	}
+	if len(b.Networks) == 0 {
+		return nil
+	}
+	for _, ipnet := range b.Networks {
+		if o.IP != nil && ipnet.Contains(o.IP) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not one of its source networks", o.IP)
+}
+
+// Origin is the connection a message arrived on
+type Origin struct {
+	IP         net.IP
+	CertSHA256 string // Hex SHA-256 of the client certificate presented over TLS ("" without one)
+}
+
+// originOf identifies conn, completing its TLS handshake first
+func originOf(conn net.Conn) (Origin, error) {
+	var o Origin
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		o.IP = addr.IP
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return o, err
+		}
+		if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+			sum := sha256.Sum256(certs[0].Raw)
+			o.CertSHA256 = hex.EncodeToString(sum[:])
+		}
+	}
+	return o, nil
+}
+
+// SubmitFunc submits a prepared record and returns its TxID and event ID
+type SubmitFunc func(block.MedicalRecordSubmission) (string, string, error)
+
+// accepted is a message already submitted, remembered so a retransmission (e.g. after a lost ACK) is
+// acknowledged again instead of creating a second record
+type accepted struct {
+	bodyHash [32]byte
+	recordID string
+	txID     string
+	at       time.Time
+}
+
+// Listener is the HL7 v2 MLLP server. Each message from a configured sender is mapped onto a medical
+// record, its original stored encrypted, and the record signed with the sender's facility wallet and
+// submitted; the sender gets an ACK, or a NAK with ERR segments.
+type Listener struct {
+	cfg    Config
+	store  *storage.Storage
+	submit SubmitFunc
+	now    func() time.Time
+
+	mu       sync.Mutex
+	ln       net.Listener
+	conns    map[net.Conn]struct{}
+	accepted map[string]accepted // sending facility|control ID
+	wg       sync.WaitGroup
+}
+
+// NewListener creates an MLLP listener storing payloads in store and submitting records through submit
+func NewListener(cfg Config, store *storage.Storage, submit SubmitFunc) *Listener {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = 1 << 20
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 5 * time.Minute
+	}
+	if cfg.AcceptedTTL <= 0 {
+		cfg.AcceptedTTL = 24 * time.Hour
+	}
+	return &Listener{cfg: cfg, store: store, submit: submit, now: time.Now, conns: make(map[net.Conn]struct{}), accepted: make(map[string]accepted)}
+}
+
+// Start listens on cfg.Addr, over TLS if cfg.TLS is set, and serves connections until Stop is called.
+// It refuses to start while a sender has no binding.
+func (l *Listener) Start() error {
+	for code := range l.cfg.Senders {
+		if b := l.cfg.Bindings[code]; b.CertSHA256 == "" && len(b.Networks) == 0 {
+			return fmt.Errorf("sending facility %q is not bound to a client certificate or source network", code)
+		}
+	}
+	var ln net.Listener
+	var err error
+	if l.cfg.TLS != nil {
+		ln, err = tls.Listen("tcp", l.cfg.Addr, l.cfg.TLS)
+	} else {
+		ln, err = net.Listen("tcp", l.cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.ln = ln
+	l.mu.Unlock()
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			l.mu.Lock()
+			l.conns[conn] = struct{}{}
+			l.mu.Unlock()
+			l.wg.Add(1)
+			go l.serve(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the listener is bound to, or nil before Start
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Addr()
+}
+
+// Stop closes the listener and its connections and waits for them to finish
+func (l *Listener) Stop() {
+	l.mu.Lock()
+	if l.ln != nil {
+		l.ln.Close()
+		l.ln = nil
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+}
+
+func (l *Listener) serve(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+	conn.SetReadDeadline(time.Now().Add(l.cfg.IdleTimeout))
+	origin, err := originOf(conn)
+	if err != nil {
+		fmt.Printf("[HL7] Closing connection from %s: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(l.cfg.IdleTimeout))
+		msg, err := ReadFrame(r, l.cfg.MaxMessageSize)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fmt.Printf("[HL7] Closing connection from %s: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if _, err := conn.Write(Frame(l.Handle(origin, msg))); err != nil {
+			return
+		}
+	}
+}
+
+// ReadFrame reads one MLLP-framed message, skipping bytes before the start block
+func ReadFrame(r *bufio.Reader, max int) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+	var msg []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == endBlock {
+			if next, err := r.ReadByte(); err != nil || next != carriageReturn {
+				return nil, errors.New("MLLP end block not followed by CR")
+			}
+			return msg, nil
+		}
+		if len(msg) >= max {
+			return nil, ErrFrameTooLarge
+		}
+		msg = append(msg, b)
+	}
+}
+
+// Frame wraps a message in MLLP framing
+func Frame(msg []byte) []byte {
+	out := make([]byte, 0, len(msg)+3)
+	out = append(out, startBlock)
+	out = append(out, msg...)
+	return append(out, endBlock, carriageReturn)
+}
+
+// Handle processes one message received on from and returns the ACK or NAK to send back
+func (l *Listener) Handle(from Origin, raw []byte) []byte {
+	now := l.now()
+	m, err := Parse(raw)
+	if err != nil {
+		fmt.Printf("[HL7] Rejected unparseable message: %v\n", err)
+		return BuildACK(nil, AckReject, "message could not be parsed", []Issue{{Segment: "MSH", Code: ErrSegmentSequence, Message: err.Error()}}, now)
+	}
+	sender, controlID, msgType := m.SendingFacility(), m.ControlID(), m.MessageType()
+	nak := func(code string, issues []Issue) []byte {
+		msgs := make([]string, len(issues))
+		for i, is := range issues {
+			msgs[i] = is.String()
+		}
+		fmt.Printf("[HL7] %s %s %s from %s: %s\n", code, msgType, controlID, sender, strings.Join(msgs, "; "))
+		return BuildACK(m, code, issues[0].Message, issues, now)
+	}
+
+	facility := l.cfg.Senders[sender]
+	if facility == nil {
+		return nak(AckReject, []Issue{{Segment: "MSH", Field: 4, Code: ErrTableValue, Message: fmt.Sprintf("sending facility %q is not configured on this node", sender)}})
+	}
+	if err := l.cfg.Bindings[sender].allows(from); err != nil {
+		return nak(AckReject, []Issue{{Segment: "MSH", Field: 4, Code: ErrTableValue, Message: fmt.Sprintf("sending facility %q may not send from this connection: %v", sender, err)}})
+	}
+	if controlID == "" {
+		return nak(AckError, []Issue{{Segment: "MSH", Field: 10, Code: ErrRequiredField, Message: "message control ID is missing"}})
+	}
+	key, bodyHash := sender+"|"+controlID, sha256.Sum256(raw)
+	l.mu.Lock()
+	prev, seen := l.accepted[key]
+	l.mu.Unlock()
+	if seen && now.Sub(prev.at) < l.cfg.AcceptedTTL {
+		if prev.bodyHash != bodyHash {
+			return nak(AckError, []Issue{{Segment: "MSH", Field: 10, Code: ErrDuplicateKey, Message: fmt.Sprintf("control ID %s was already used for a different message", controlID)}})
+		}
+		return BuildACK(m, AckAccept, fmt.Sprintf("already accepted as record %s (transaction %s)", prev.recordID, prev.txID), nil, now)
+	}
+
+	doc, issues := ToDocument(m, raw, l.cfg.Location)
+	if len(issues) > 0 {
+		code := AckError
+		if issues[0].Code == ErrUnsupportedMessageType || issues[0].Code == ErrUnsupportedEvent {
+			code = AckReject
+		}
+		return nak(code, issues)
+	}
+	sub, err := ingest.Prepare(l.store, facility, doc, now)
+	if err != nil {
+		return nak(AckError, []Issue{{Code: ErrInternal, Message: "record could not be built: " + err.Error()}})
+	}
+	txID, eventID, err := l.submit(sub)
+	if err != nil {
+		docHash, _ := sub.Record["docHash"].(string)
+		l.store.DeletePayload(docHash)
+		if strings.HasPrefix(err.Error(), "duplicate") {
+			return nak(AckError, []Issue{{Code: ErrDuplicateKey, Message: err.Error()}})
+		}
+		return nak(AckReject, []Issue{{Code: ErrInternal, Message: "record not submitted: " + err.Error()}})
+	}
+	recordID, _ := sub.Record["recordId"].(string)
+	l.remember(key, accepted{bodyHash: bodyHash, recordID: recordID, txID: txID, at: now})
+	fmt.Printf("[HL7] %s %s from %s ingested as %s record %s (tx %s, event %s)\n", msgType, controlID, sender, doc.RecordType, recordID, txID, eventID)
+	return BuildACK(m, AckAccept, fmt.Sprintf("record %s submitted as transaction %s", recordID, txID), nil, now)
+}
+
+// remember records an accepted message, forgetting those older than AcceptedTTL
+func (l *Listener) remember(key string, a accepted) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, prev := range l.accepted {
+		if a.at.Sub(prev.at) >= l.cfg.AcceptedTTL {
+			delete(l.accepted, k)
+		}
+	}
+	l.accepted[key] = a
+}
@@ -0,0 +1,231 @@
+package hl7
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"unicareos/core"
+	"unicareos/core/block"
+	"unicareos/core/ingest"
+	"unicareos/core/storage"
+)
+
+const patientDID = "did:key:z6MkpTHR8VNsBxYAAWHut2Geadd9jSwuBV8xRoAnwWsdvktH"
+
+func oru(controlID string) string {
+	return strings.Join([]string{
+		`MSH|^~\&|LIS|CITYLAB|UniCareOS|HOSP|20250301101500+0100||ORU^R01^ORU_R01|` + controlID + `|P|2.5.1`,
+		`PID|1||MRN-4471^^^CITYLAB^MR~` + patientDID + `^^^UNICARE^DID||Doe^Jane`,
+		`OBR|1||LAB-9|718-7^Hemoglobin^LN|||20250301083000+0100|||||||||||||||20250301100000+0100|||F`,
+		`OBX|1|NM|718-7^Hemoglobin^LN||13.2|g/dL|12.0-16.0|N|||F`,
+	}, "\r") + "\r"
+}
+
+func ackSegments(t *testing.T, ack []byte) map[string][]string {
+	t.Helper()
+	m, err := Parse(ack)
+	if err != nil {
+		t.Fatalf("unparseable ACK %q: %v", ack, err)
+	}
+	out := map[string][]string{}
+	for _, s := range m.Segments {
+		switch s.Name {
+		case "MSA":
+			out["MSA"] = []string{m.Get(s, 1, 1), m.Get(s, 2, 1), m.Get(s, 3, 1)}
+		case "ERR":
+			out["ERR"] = append(out["ERR"], m.Get(s, 2, 1)+"-"+m.Get(s, 2, 3)+":"+m.Get(s, 3, 1))
+		}
+	}
+	return out
+}
+
+func TestMLLPListenerIngestsAndAcknowledges(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	schema, _ := filepath.Abs("../validation/schemas/medical_record_schema_v1.json")
+	t.Setenv("MEDICAL_SCHEMA_PATH", schema)
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	var submitted []block.MedicalRecordSubmission
+	l := NewListener(Config{
+		Addr:     "127.0.0.1:0",
+		Senders:  map[string]*ingest.Facility{"CITYLAB": {ProviderID: "citylab", Wallet: core.Wallet{Address: "citylab_wallet", PublicKey: pub, PrivateKey: priv, Algorithm: "Ed25519"}}},
+		Bindings: map[string]Binding{"CITYLAB": mustBinding(t, "127.0.0.0/8")},
+	}, store, func(sub block.MedicalRecordSubmission) (string, string, error) {
+		submitted = append(submitted, sub)
+		return "tx-" + sub.Record["recordId"].(string), "evt", nil
+	})
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Stop)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	send := func(msg string) map[string][]string {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(Frame([]byte(msg))); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := ReadFrame(r, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ackSegments(t, ack)
+	}
+
+	if ack := send(oru("MSG0001")); ack["MSA"][0] != AckAccept || ack["MSA"][1] != "MSG0001" {
+		t.Fatalf("ORU^R01 not accepted: %v", ack)
+	}
+	if len(submitted) != 1 {
+		t.Fatalf("%d submissions, want 1", len(submitted))
+	}
+	sub := submitted[0]
+	if sub.PatientDID() != patientDID || sub.RecordType() != "lab_result" || sub.WalletAddress != "citylab_wallet" || sub.Record["providerId"] != "citylab" {
+		t.Errorf("unexpected submission %+v", sub.Record)
+	}
+	if sub.Record["issuedAt"] != "2025-03-01T09:00:00Z" {
+		t.Errorf("issuedAt %v, want OBR-22 in UTC", sub.Record["issuedAt"])
+	}
+	if body, err := store.GetPayload(sub.DocHash(), storage.PayloadOwner{PatientDID: patientDID, RecordID: sub.RecordID()}); err != nil || string(body) != oru("MSG0001") {
+		t.Errorf("original message not stored encrypted: %v", err)
+	}
+
+	if ack := send(oru("MSG0001")); ack["MSA"][0] != AckAccept || len(submitted) != 1 {
+		t.Errorf("retransmission resubmitted or not acknowledged: %v, %d submissions", ack, len(submitted))
+	}
+	if ack := send(strings.Replace(oru("MSG0001"), "13.2", "14.0", 1)); ack["MSA"][0] != AckError || ack["ERR"][0] != "MSH-10:205" {
+		t.Errorf("reused control ID: %v", ack)
+	}
+
+	noDID := strings.Replace(oru("MSG0002"), "~"+patientDID+"^^^UNICARE^DID", "", 1)
+	if ack := send(noDID); ack["MSA"][0] != AckError || ack["ERR"][0] != "PID-3:101" {
+		t.Errorf("message without patient DID: %v", ack)
+	}
+	mdm := strings.Join([]string{
+		`MSH|^~\&|EHR|CITYLAB|UniCareOS|HOSP|20250301101500||MDM^T02|MSG0003|P|2.5.1`,
+		`PID|1||` + patientDID,
+		`TXA|1|CN|TX|20250301090000`,
+		`OBX|1|TX|||Consult note`,
+	}, "\r")
+	if ack := send(mdm); ack["MSA"][0] != AckError || ack["ERR"][0] != "TXA-2:103" {
+		t.Errorf("MDM^T02 that is not a discharge summary: %v", ack)
+	}
+	if ack := send(strings.Replace(mdm, "|CN|", "|DS|", 1)); ack["MSA"][0] != AckAccept || submitted[len(submitted)-1].RecordType() != "discharge_summary" {
+		t.Errorf("discharge summary not accepted: %v", ack)
+	}
+	if ack := send(strings.Replace(oru("MSG0004"), "ORU^R01", "ADT^A01", 1)); ack["MSA"][0] != AckReject || ack["ERR"][0] != "MSH-9:200" {
+		t.Errorf("ADT^A01: %v", ack)
+	}
+	if ack := send(strings.Replace(oru("MSG0005"), "|CITYLAB|UniCareOS", "|OTHERLAB|UniCareOS", 1)); ack["MSA"][0] != AckReject || ack["ERR"][0] != "MSH-4:103" {
+		t.Errorf("unknown sender: %v", ack)
+	}
+	if len(submitted) != 2 {
+		t.Errorf("%d submissions, want 2", len(submitted))
+	}
+}
+
+func mustBinding(t *testing.T, spec string) Binding {
+	t.Helper()
+	b, err := ParseBinding(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSendingFacilityBinding(t *testing.T) {
+	certHash := strings.Repeat("ab", 32)
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	facility := &ingest.Facility{ProviderID: "citylab", Wallet: core.Wallet{Address: "citylab_wallet", PublicKey: pub, PrivateKey: priv, Algorithm: "Ed25519"}}
+	submit := func(block.MedicalRecordSubmission) (string, string, error) {
+		t.Fatal("message from an unbound connection submitted")
+		return "", "", nil
+	}
+
+	// Every sender needs a binding before the listener starts
+	unbound := NewListener(Config{Addr: "127.0.0.1:0", Senders: map[string]*ingest.Facility{"CITYLAB": facility}}, nil, submit)
+	if err := unbound.Start(); err == nil {
+		unbound.Stop()
+		t.Fatal("listener started with an unbound sending facility")
+	}
+
+	l := NewListener(Config{
+		Senders:  map[string]*ingest.Facility{"CITYLAB": facility},
+		Bindings: map[string]Binding{"CITYLAB": mustBinding(t, "10.1.0.0/16; sha256:"+strings.ToUpper(certHash))},
+	}, nil, submit)
+	for name, from := range map[string]Origin{
+		"foreign network":   {IP: net.ParseIP("192.168.7.7"), CertSHA256: certHash},
+		"no certificate":    {IP: net.ParseIP("10.1.2.3")},
+		"other certificate": {IP: net.ParseIP("10.1.2.3"), CertSHA256: strings.Repeat("cd", 32)},
+	} {
+		if ack := ackSegments(t, l.Handle(from, []byte(oru("MSG0001")))); ack["MSA"][0] != AckReject || ack["ERR"][0] != "MSH-4:103" {
+			t.Errorf("%s: %v", name, ack)
+		}
+	}
+
+	for _, spec := range []string{"", "sha256:abcd", "10.1.0.0", "sha256:" + certHash + ";sha256:" + certHash} {
+		if _, err := ParseBinding(spec); err == nil {
+			t.Errorf("binding %q accepted", spec)
+		}
+	}
+}
+
+func TestOriginOfTLSConnection(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+	client, server := net.Pipe()
+	defer client.Close()
+	go tls.Client(client, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}}).Handshake()
+
+	origin, err := originOf(tls.Server(server, &tls.Config{Certificates: []tls.Certificate{cert}, ClientAuth: tls.RequireAnyClientCert}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+	if origin.CertSHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("client certificate hash %q, want %x", origin.CertSHA256, sum)
+	}
+}
+
+func TestParseTS(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	cases := map[string]string{
+		"20250301":               "2025-02-28T23:00:00Z",
+		"202503011015":           "2025-03-01T09:15:00Z",
+		"20250301101530.25-0500": "2025-03-01T15:15:30.25Z",
+		"20250301101530+0000":    "2025-03-01T10:15:30Z",
+	}
+	for in, want := range cases {
+		got, err := ParseTS(in, berlin)
+		if err != nil || got.Format(time.RFC3339Nano) != want {
+			t.Errorf("ParseTS(%q) = %v, %v; want %s", in, got.Format(time.RFC3339Nano), err, want)
+		}
+	}
+	if _, err := ParseTS("2025-03-01", berlin); err == nil {
+		t.Error("ISO date accepted as an HL7 timestamp")
+	}
+}
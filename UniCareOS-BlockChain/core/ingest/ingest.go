@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"unicareos/core"
+	"unicareos/core/block"
+	"unicareos/core/storage"
+	"unicareos/core/validation"
+)
+
+// Ingestion of clinical documents from external formats (FHIR, HL7 v2).
+// An adapter maps a document onto a Document; Prepare moves its body to the encrypted payload store and
+// returns a MedicalRecordSubmission signed with the facility wallet, ready for the mempool.
+
+// SchemaVersion is the record schema ingested records are written against
+const SchemaVersion = "1.0"
+
+// ConsentStatus is written on ingested records: consent is enforced from on-chain grants when records are read
+const ConsentStatus = "pending"
+
+// recordNamespace derives deterministic record IDs, so a re-sent document keeps its recordId
+var recordNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("urn:unicareos:ingest"))
+
+// Facility is the provider identity and wallet a facility's records are signed and submitted under
+type Facility struct {
+	ProviderID      string      // providerId on the record and its event
+	Wallet          core.Wallet // Must be listed in authorized_wallets.json
+	RetentionPolicy string      // "standard" when empty
+}
+
+// Document is a clinical document mapped from an external format
+type Document struct {
+	Key        string    // Identifies the source document (e.g. "DiagnosticReport/123"); the recordId derives from it
+	RecordType string    // One of the schema's recordTypes
+	PatientDID string    // Subject of the record
+	PatientRef string    // Source patient identifier; kept only encrypted in the record's patientId
+	IssuedAt   time.Time // When the source system issued the document
+	Provenance string    // dataProvenance, e.g. "fhir-r4:DiagnosticReport/123"
+	Body       []byte    // Original document; PHI, stored encrypted off chain
+}
+
+// RecordID returns the recordId the document is submitted under
+func (d Document) RecordID() string {
+	return uuid.NewSHA1(recordNamespace, append([]byte(d.Key+"|"), d.Body...)).String()
+}
+
+// Prepare stores the document's body encrypted and returns its signed, schema-valid submission.
+// The stored payload is removed again if the record cannot be built.
+func Prepare(store *storage.Storage, f *Facility, d Document, now time.Time) (block.MedicalRecordSubmission, error) {
+	if store == nil {
+		return block.MedicalRecordSubmission{}, errors.New("no payload store")
+	}
+	if f == nil || f.Wallet.Address == "" {
+		return block.MedicalRecordSubmission{}, errors.New("no facility wallet configured")
+	}
+	payload, err := store.PutPayload(d.Body, storage.PayloadOwner{PatientDID: d.PatientDID, RecordID: d.RecordID()})
+	if err != nil {
+		return block.MedicalRecordSubmission{}, fmt.Errorf("store payload: %w", err)
+	}
+	sub, err := buildSubmission(f, d, payload, now)
+	if err != nil {
+		store.DeletePayload(payload.DocHash)
+		return block.MedicalRecordSubmission{}, err
+	}
+	return sub, nil
+}
+
+func buildSubmission(f *Facility, d Document, payload *storage.EncryptedPayload, now time.Time) (block.MedicalRecordSubmission, error) {
+	patientRef := d.PatientRef
+	if patientRef == "" {
+		patientRef = d.PatientDID
+	}
+	encryptedRef, err := storage.Encrypt([]byte(patientRef))
+	if err != nil {
+		return block.MedicalRecordSubmission{}, err
+	}
+	retention := f.RetentionPolicy
+	if retention == "" {
+		retention = "standard"
+	}
+	record := map[string]interface{}{
+		"recordId":        d.RecordID(),
+		"patientId":       base64.StdEncoding.EncodeToString(encryptedRef),
+		"patientDID":      d.PatientDID,
+		"providerId":      f.ProviderID,
+		"schemaVersion":   SchemaVersion,
+		"recordType":      d.RecordType,
+		"docHash":         payload.DocHash,
+		"issuedAt":        d.IssuedAt.UTC().Format(time.RFC3339),
+		"signedBy":        f.Wallet.Address,
+		"consentStatus":   ConsentStatus,
+		"dataProvenance":  d.Provenance,
+		"retentionPolicy": retention,
+		"encryptionContext": map[string]interface{}{
+			"algorithm": payload.Algorithm,
+			"iv":        payload.IV,
+			"tag":       payload.Tag,
+		},
+	}
+	// payloadSignature covers the record without it; the submission signature covers the whole record
+	payloadSig, err := sign(f.Wallet, record)
+	if err != nil {
+		return block.MedicalRecordSubmission{}, err
+	}
+	record["payloadSignature"] = payloadSig
+	if err := validation.ValidateRecord(record); err != nil {
+		return block.MedicalRecordSubmission{}, err
+	}
+	sig, err := sign(f.Wallet, record)
+	if err != nil {
+		return block.MedicalRecordSubmission{}, err
+	}
+	return block.MedicalRecordSubmission{
+		Record:              record,
+		Signature:           sig,
+		WalletAddress:       f.Wallet.Address,
+		SubmissionTimestamp: now.UTC(),
+	}, nil
+}
+
+func sign(w core.Wallet, record map[string]interface{}) (string, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sig, err := core.SignTransaction(w, data)
+	if err != nil {
+		return "", fmt.Errorf("sign record with wallet %s: %w", w.Address, err)
+	}
+	return sig.Signature, nil
+}
@@ -0,0 +1,259 @@
+// Package keystore stores node, finalizer and wallet private keys encrypted under a passphrase.
+// A keystore file is a JSON envelope: the key is sealed with AES-256-GCM under a key derived from the
+// passphrase with argon2id (default) or scrypt, and the envelope header (kind, algorithm, public key) is
+// authenticated as GCM additional data, so it cannot be altered without the passphrase.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version is the envelope format written by Encrypt
+const Version = 1
+
+// Key kinds
+const (
+	KindNode      = "node"
+	KindFinalizer = "finalizer"
+	KindWallet    = "wallet"
+)
+
+// Key derivation functions
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+const cipherAESGCM = "aes-256-gcm"
+
+// ErrDecrypt is returned for a wrong passphrase or a tampered keystore
+var ErrDecrypt = errors.New("keystore: wrong passphrase or corrupted key file")
+
+// KDFParams selects and tunes the passphrase key derivation. Unused fields are zero.
+type KDFParams struct {
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time,omitempty"`    // argon2id passes
+	Memory  uint32 `json:"memory,omitempty"`  // argon2id memory in KiB
+	Threads uint8  `json:"threads,omitempty"` // argon2id lanes
+	N       int    `json:"n,omitempty"`       // scrypt cost
+	R       int    `json:"r,omitempty"`       // scrypt block size
+	P       int    `json:"p,omitempty"`       // scrypt parallelism
+}
+
+// DefaultKDF is argon2id with the RFC 9106 second recommended parameters (64 MiB, 3 passes)
+func DefaultKDF() KDFParams {
+	return KDFParams{KDF: KDFArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+// ScryptKDF is scrypt with N=2^17, r=8, p=1
+func ScryptKDF() KDFParams {
+	return KDFParams{KDF: KDFScrypt, N: 1 << 17, R: 8, P: 1}
+}
+
+// derive returns the 32-byte AES key for passphrase
+func (p KDFParams) derive(passphrase []byte) ([]byte, error) {
+	if len(p.Salt) < 16 {
+		return nil, errors.New("keystore: salt too short")
+	}
+	switch p.KDF {
+	case KDFArgon2id:
+		if p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+			return nil, errors.New("keystore: incomplete argon2id parameters")
+		}
+		return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, 32), nil
+	case KDFScrypt:
+		return scrypt.Key(passphrase, p.Salt, p.N, p.R, p.P, 32)
+	}
+	return nil, fmt.Errorf("keystore: unsupported kdf %q", p.KDF)
+}
+
+// CipherParams holds the AES-GCM ciphertext of the private key
+type CipherParams struct {
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// File is a keystore envelope
+type File struct {
+	Version   int          `json:"version"`
+	Kind      string       `json:"kind"`            // node, finalizer or wallet
+	Label     string       `json:"label,omitempty"` // Free-form name, e.g. a wallet address
+	Algorithm string       `json:"algorithm"`       // "Ed25519", or "ECDSA" for imported wallet keys
+	PublicKey string       `json:"publicKey"`       // Hex Ed25519 public key (empty for ECDSA)
+	Created   time.Time    `json:"created"`
+	KDF       KDFParams    `json:"kdfparams"`
+	Crypto    CipherParams `json:"crypto"`
+}
+
+// header is the authenticated part of the envelope
+func (f *File) header() []byte {
+	h, _ := json.Marshal(struct {
+		Version   int    `json:"version"`
+		Kind      string `json:"kind"`
+		Label     string `json:"label"`
+		Algorithm string `json:"algorithm"`
+		PublicKey string `json:"publicKey"`
+	}{f.Version, f.Kind, f.Label, f.Algorithm, f.PublicKey})
+	return h
+}
+
+// EncryptEd25519 seals an Ed25519 private key
+func EncryptEd25519(kind, label string, priv ed25519.PrivateKey, passphrase []byte, kdf KDFParams) (*File, error) {
+	if len(priv) != ed25519.PrivateKeySize || !ed25519.NewKeyFromSeed(priv.Seed()).Equal(priv) {
+		return nil, errors.New("keystore: invalid Ed25519 private key")
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+	return Encrypt(kind, label, "Ed25519", hex.EncodeToString(pub), priv, passphrase, kdf)
+}
+
+// Encrypt seals raw private key bytes of the given algorithm. kdf.Salt is generated if empty.
+func Encrypt(kind, label, algorithm, publicKey string, key, passphrase []byte, kdf KDFParams) (*File, error) {
+	switch kind {
+	case KindNode, KindFinalizer, KindWallet:
+	default:
+		return nil, fmt.Errorf("keystore: unknown key kind %q", kind)
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("keystore: empty passphrase")
+	}
+	if len(kdf.Salt) == 0 {
+		kdf.Salt = make([]byte, 32)
+		if _, err := rand.Read(kdf.Salt); err != nil {
+			return nil, err
+		}
+	}
+	f := &File{
+		Version:   Version,
+		Kind:      kind,
+		Label:     label,
+		Algorithm: algorithm,
+		PublicKey: publicKey,
+		Created:   time.Now().UTC(),
+		KDF:       kdf,
+	}
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	f.Crypto = CipherParams{Cipher: cipherAESGCM, Nonce: nonce, Ciphertext: aead.Seal(nil, nonce, key, f.header())}
+	return f, nil
+}
+
+func (f *File) aead(passphrase []byte) (cipher.AEAD, error) {
+	dk, err := f.KDF.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypt returns the raw private key
+func (f *File) Decrypt(passphrase []byte) ([]byte, error) {
+	if f.Version != Version {
+		return nil, fmt.Errorf("keystore: unsupported version %d", f.Version)
+	}
+	if f.Crypto.Cipher != cipherAESGCM {
+		return nil, fmt.Errorf("keystore: unsupported cipher %q", f.Crypto.Cipher)
+	}
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Crypto.Nonce) != aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	key, err := aead.Open(nil, f.Crypto.Nonce, f.Crypto.Ciphertext, f.header())
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return key, nil
+}
+
+// DecryptEd25519 returns the Ed25519 private key, checking it against the recorded public key
+func (f *File) DecryptEd25519(passphrase []byte) (ed25519.PrivateKey, error) {
+	if f.Algorithm != "Ed25519" {
+		return nil, fmt.Errorf("keystore: %s key is not Ed25519", f.Algorithm)
+	}
+	key, err := f.Decrypt(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	priv := ed25519.PrivateKey(key)
+	if len(priv) != ed25519.PrivateKeySize || hex.EncodeToString(priv.Public().(ed25519.PublicKey)) != f.PublicKey {
+		return nil, errors.New("keystore: private key does not match the recorded public key")
+	}
+	return priv, nil
+}
+
+// Load reads a keystore file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("keystore %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Save writes f to path (mode 0600), replacing any existing file atomically
+func (f *File) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadEd25519 reads and decrypts an Ed25519 keystore of the given kind
+func LoadEd25519(path, kind string, passphrase []byte) (ed25519.PrivateKey, error) {
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if f.Kind != kind {
+		return nil, fmt.Errorf("keystore %s holds a %s key, not a %s key", path, f.Kind, kind)
+	}
+	return f.DecryptEd25519(passphrase)
+}
@@ -0,0 +1,102 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Light KDF parameters keep the tests fast
+var (
+	testArgon2 = KDFParams{KDF: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+	testScrypt = KDFParams{KDF: KDFScrypt, N: 16, R: 8, P: 1}
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	for _, kdf := range []KDFParams{testArgon2, testScrypt} {
+		f, err := EncryptEd25519(KindNode, "", priv, []byte("secret"), kdf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "node.key")
+		if err := f.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadEd25519(path, KindNode, []byte("secret"))
+		if err != nil || !got.Equal(priv) {
+			t.Fatalf("%s: key does not round-trip: %v", kdf.KDF, err)
+		}
+		if _, err := LoadEd25519(path, KindNode, []byte("guess")); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: wrong passphrase gave %v", kdf.KDF, err)
+		}
+		if _, err := LoadEd25519(path, KindFinalizer, []byte("secret")); err == nil {
+			t.Errorf("%s: node key loaded as a finalizer key", kdf.KDF)
+		}
+	}
+}
+
+func TestKeystoreHeaderIsAuthenticated(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	f, err := EncryptEd25519(KindWallet, "wallet-1", priv, []byte("secret"), testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tamper := range map[string]func(f *File){
+		"kind":       func(f *File) { f.Kind = KindNode },
+		"label":      func(f *File) { f.Label = "wallet-2" },
+		"public key": func(f *File) { f.PublicKey = "00" + f.PublicKey[2:] },
+		"ciphertext": func(f *File) { f.Crypto.Ciphertext[0] ^= 1 },
+	} {
+		c := *f
+		c.Crypto.Ciphertext = append([]byte(nil), f.Crypto.Ciphertext...)
+		tamper(&c)
+		if _, err := c.Decrypt([]byte("secret")); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("tampered %s: %v", name, err)
+		}
+	}
+	if _, err := EncryptEd25519(KindNode, "", priv, nil, testArgon2); err == nil {
+		t.Error("empty passphrase accepted")
+	}
+	mismatched := append(append(ed25519.PrivateKey{}, priv.Seed()...), make([]byte, 32)...)
+	if _, err := EncryptEd25519(KindNode, "", mismatched, []byte("secret"), testArgon2); err == nil {
+		t.Error("private key with a foreign public half accepted")
+	}
+}
+
+func TestRotationSignedByBothKeys(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(nil)
+	_, newKey, _ := ed25519.GenerateKey(nil)
+	r, err := NewRotation(oldKey, newKey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "rotation.json")
+	if err := SaveRotation(path, r); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRotation(path)
+	if err != nil || loaded.Verify() != nil {
+		t.Fatalf("rotation does not survive a round trip: %v", err)
+	}
+
+	_, thief, _ := ed25519.GenerateKey(nil)
+	hijack, _ := NewRotation(thief, newKey, time.Now())
+	hijack.OldKey = r.OldKey // Claims someone else's identity
+	if hijack.Verify() == nil {
+		t.Error("rotation not signed by the old key verified")
+	}
+	redirected := *r
+	redirected.NewKey = hijack.NewKey[:62] + "00"
+	if redirected.Verify() == nil {
+		t.Error("rotation to a different new key verified")
+	}
+	if _, err := NewRotation(oldKey, oldKey, time.Now()); err == nil {
+		t.Error("rotation to the same key accepted")
+	}
+}
@@ -0,0 +1,111 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"unicareos/core/signer"
+)
+
+// Rotation announces that a node replaced its Ed25519 key. It is signed by the old key, which vouches for
+// the successor, and by the new key, which proves possession. Peers that verify it move the node's
+// identity (allowlist entry, producer slot) to the new key and retire the old one.
+type Rotation struct {
+	OldKey       string    `json:"oldKey"`    // Hex Ed25519 public key being retired
+	NewKey       string    `json:"newKey"`    // Hex Ed25519 public key taking over
+	Timestamp    time.Time `json:"timestamp"` // Blocks sealed by OldKey must be older than this
+	OldSignature []byte    `json:"oldSignature"`
+	NewSignature []byte    `json:"newSignature"`
+}
+
+// SigningBytes is the message both keys sign
+func (r *Rotation) SigningBytes() []byte {
+	return []byte(fmt.Sprintf("unicare-key-rotation:%s:%s:%d", r.OldKey, r.NewKey, r.Timestamp.UTC().UnixNano()))
+}
+
+// NewRotation signs the rotation from oldKey to newKey at time at
+func NewRotation(oldKey, newKey signer.Signer, at time.Time) (*Rotation, error) {
+	oldPub, ok := signer.PublicKey(oldKey)
+	if !ok {
+		return nil, errors.New("rotation: invalid old key")
+	}
+	newPub, ok := signer.PublicKey(newKey)
+	if !ok {
+		return nil, errors.New("rotation: invalid new key")
+	}
+	if oldPub.Equal(newPub) {
+		return nil, errors.New("rotation: new key equals old key")
+	}
+	r := &Rotation{OldKey: hex.EncodeToString(oldPub), NewKey: hex.EncodeToString(newPub), Timestamp: at.UTC()}
+	var err error
+	if r.OldSignature, err = signer.Sign(oldKey, r.SigningBytes()); err != nil {
+		return nil, err
+	}
+	if r.NewSignature, err = signer.Sign(newKey, r.SigningBytes()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Keys returns the decoded old and new public keys
+func (r *Rotation) Keys() (ed25519.PublicKey, ed25519.PublicKey, error) {
+	oldPub, err := hex.DecodeString(r.OldKey)
+	if err != nil || len(oldPub) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("rotation: invalid old key %q", r.OldKey)
+	}
+	newPub, err := hex.DecodeString(r.NewKey)
+	if err != nil || len(newPub) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("rotation: invalid new key %q", r.NewKey)
+	}
+	return oldPub, newPub, nil
+}
+
+// Verify checks both signatures
+func (r *Rotation) Verify() error {
+	oldPub, newPub, err := r.Keys()
+	if err != nil {
+		return err
+	}
+	if r.OldKey == r.NewKey {
+		return errors.New("rotation: new key equals old key")
+	}
+	if !ed25519.Verify(oldPub, r.SigningBytes(), r.OldSignature) {
+		return errors.New("rotation: not signed by the old key")
+	}
+	if !ed25519.Verify(newPub, r.SigningBytes(), r.NewSignature) {
+		return errors.New("rotation: not signed by the new key")
+	}
+	return nil
+}
+
+// RotationPath is where `keys rotate` leaves the rotation of the node keystore at path
+func RotationPath(path string) string {
+	return path + ".rotation.json"
+}
+
+// SaveRotation writes r as JSON
+func SaveRotation(path string, r *Rotation) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// LoadRotation reads a rotation written by SaveRotation
+func LoadRotation(path string) (*Rotation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Rotation
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("rotation %s: %w", path, err)
+	}
+	return &r, nil
+}
@@ -5,15 +5,32 @@ import (
 	"time"
 )
 
+// ExpiredStatus tracks where an expired transaction is in the resubmission lifecycle.
+type ExpiredStatus string
+
+const (
+	// ExpiredStatusPending means the transaction is waiting for its next resubmission attempt
+	ExpiredStatusPending ExpiredStatus = "expired"
+	// ExpiredStatusResubmitted means a resubmission is currently live in the mempool
+	ExpiredStatusResubmitted ExpiredStatus = "resubmitted"
+	// ExpiredStatusAbandoned means no further automatic resubmissions will be made
+	ExpiredStatusAbandoned ExpiredStatus = "abandoned"
+)
+
 // ExpiredTx represents a transaction that has expired from the mempool.
+// It is keyed by the lineage (original) TxID so that retries accumulate on one entry.
 type ExpiredTx struct {
-	TxID         string
-	Payload      interface{} // The original transaction payload (can be MedicalRecordSubmission or similar)
-	ExpiredAt    time.Time
-	Reason       string      // e.g., "timeout"
-	ResubmitCount int
+	TxID              string
+	Payload           interface{} // The original transaction payload (can be MedicalRecordSubmission or similar)
+	Sender            string
+	ExpiredAt         time.Time
+	Reason            string // e.g., "timeout", "evicted"
+	ResubmitCount     int
 	ResubmissionTxIDs []string
-	LastError   string // Last failure reason for smarter error handling
+	LastError         string     // Last failure reason for smarter error handling
+	ErrorClass        ErrorClass // Classification of LastError
+	Status            ExpiredStatus
+	NextRetryAt       time.Time // Earliest time the expiry manager may resubmit again
 }
 
 // ExpiredTxPool is a thread-safe in-memory storage for expired transactions.
@@ -43,6 +60,13 @@ func (e *ExpiredTxPool) GetExpiredTx(txID string) (ExpiredTx, bool) {
 	return tx, ok
 }
 
+// RemoveExpiredTx drops an entry once its lineage has been included in a block.
+func (e *ExpiredTxPool) RemoveExpiredTx(txID string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.pool, txID)
+}
+
 // ListExpiredTxs returns all expired transactions.
 func (e *ExpiredTxPool) ListExpiredTxs() []ExpiredTx {
 	e.lock.RLock()
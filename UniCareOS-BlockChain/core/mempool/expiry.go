@@ -0,0 +1,208 @@
+package mempool
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"unicareos/core/notify"
+	"unicareos/core/worker"
+)
+
+// ExpiryConfig controls how long transactions may stay pending and how expired
+// transactions are retried.
+type ExpiryConfig struct {
+	MaxAge            time.Duration // Pending transactions older than this are archived
+	CheckInterval     time.Duration // How often the worker runs
+	MaxRetries        int           // Automatic resubmissions before a lineage is abandoned
+	BaseBackoff       time.Duration // Delay before the first resubmission
+	MaxBackoff        time.Duration // Upper bound for the exponential backoff
+	BackoffMultiplier float64       // Growth factor applied per attempt
+	NotifyRecipient   string        // Who is told when a submission is abandoned
+}
+
+// DefaultExpiryConfig returns the settings the node used before they were configurable.
+func DefaultExpiryConfig() ExpiryConfig {
+	return ExpiryConfig{
+		MaxAge:            15 * time.Minute,
+		CheckInterval:     1 * time.Minute,
+		MaxRetries:        3,
+		BaseBackoff:       30 * time.Second,
+		MaxBackoff:        10 * time.Minute,
+		BackoffMultiplier: 2,
+		NotifyRecipient:   "admin",
+	}
+}
+
+// Backoff returns the delay before resubmission attempt number attempt (0-based).
+func (c ExpiryConfig) Backoff(attempt int) time.Duration {
+	d := c.BaseBackoff
+	for i := 0; i < attempt; i++ {
+		d = time.Duration(float64(d) * c.BackoffMultiplier)
+		if c.MaxBackoff > 0 && d >= c.MaxBackoff {
+			return c.MaxBackoff
+		}
+	}
+	if c.MaxBackoff > 0 && d > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return d
+}
+
+// ResubmissionTxID derives the TxID for the given resubmission attempt of a lineage.
+// IDs are deterministic so every node and every retry agrees on them.
+func ResubmissionTxID(originTxID string, attempt int) string {
+	return fmt.Sprintf("%s-resubmit-%d", originTxID, attempt)
+}
+
+// ExpiryManager archives stale transactions and resubmits them with exponential
+// backoff until they are included, fail permanently, or run out of retries.
+type ExpiryManager struct {
+	mempool *Mempool
+	cfg     ExpiryConfig
+
+	now    func() time.Time
+	notify func(notify.Notification)
+
+	mu   sync.Mutex // serialises Tick and manual Resubmit
+	loop worker.Periodic
+}
+
+// NewExpiryManager creates an ExpiryManager for the given mempool.
+func NewExpiryManager(mp *Mempool, cfg ExpiryConfig) *ExpiryManager {
+	return &ExpiryManager{
+		mempool: mp,
+		cfg:     cfg,
+		now:     time.Now,
+		notify:  notify.Notify,
+	}
+}
+
+// Config returns the manager's configuration.
+func (em *ExpiryManager) Config() ExpiryConfig {
+	return em.cfg
+}
+
+// Start archives and resubmits expired transactions every CheckInterval until Stop is called
+func (em *ExpiryManager) Start() {
+	em.loop.Start(em.cfg.CheckInterval, false, em.Tick)
+}
+
+// Stop ends automatic expiry; Tick and Resubmit can still be called directly
+func (em *ExpiryManager) Stop() {
+	em.loop.Stop()
+}
+
+// Tick archives expired transactions and processes every pending entry in the
+// ExpiredPool once. It is exported so tests and operators can drive it directly.
+func (em *ExpiryManager) Tick() {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	if archived := em.mempool.PurgeExpired(em.cfg.MaxAge); archived > 0 {
+		log.Printf("[MEMPOOL] Archived %d expired transaction(s) to ExpiredTxPool", archived)
+	}
+
+	now := em.now()
+	for _, entry := range em.mempool.ExpiredPool.ListExpiredTxs() {
+		if entry.Status != ExpiredStatusPending {
+			continue
+		}
+		if entry.NextRetryAt.IsZero() {
+			// First time we see this expiry: schedule according to the attempt count
+			entry.NextRetryAt = entry.ExpiredAt.Add(em.cfg.Backoff(entry.ResubmitCount))
+			em.mempool.ExpiredPool.AddExpiredTx(entry)
+		}
+		if entry.ErrorClass == ErrorClassPermanent {
+			em.abandon(entry, "non-retryable error: "+entry.LastError)
+			continue
+		}
+		if entry.ResubmitCount >= em.cfg.MaxRetries {
+			em.abandon(entry, fmt.Sprintf("retry limit reached (%d)", em.cfg.MaxRetries))
+			continue
+		}
+		if now.Before(entry.NextRetryAt) {
+			continue
+		}
+		em.resubmit(entry)
+	}
+}
+
+// Resubmit immediately resubmits an expired transaction on operator request.
+// Backoff and the retry limit are ignored, but the lineage is preserved so the
+// resubmission still dedups against any live copy.
+func (em *ExpiryManager) Resubmit(txID string) (Transaction, AdmissionResult, error) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	entry, ok := em.mempool.ExpiredPool.GetExpiredTx(txID)
+	if !ok {
+		return Transaction{}, AdmissionResult{}, fmt.Errorf("transaction %s not found in expired pool", txID)
+	}
+	tx, res := em.resubmit(entry)
+	return tx, res, nil
+}
+
+// resubmit offers the next attempt of entry to the mempool and updates its bookkeeping.
+// Caller must hold em.mu.
+func (em *ExpiryManager) resubmit(entry ExpiredTx) (Transaction, AdmissionResult) {
+	payload, ok := entry.Payload.([]byte)
+	if !ok {
+		entry.LastError = "expired payload is not []byte"
+		entry.ErrorClass = ErrorClassPermanent
+		em.abandon(entry, entry.LastError)
+		return Transaction{}, Rejected(ErrorClassPermanent, entry.LastError)
+	}
+
+	now := em.now()
+	attempt := entry.ResubmitCount + 1
+	tx := Transaction{
+		TxID:       ResubmissionTxID(entry.TxID, attempt),
+		Payload:    payload,
+		Timestamp:  now.Unix(),
+		Sender:     entry.Sender,
+		OriginTxID: entry.TxID,
+	}
+	res := em.mempool.Admit(tx)
+	switch {
+	case res.Accepted:
+		entry.ResubmitCount = attempt
+		entry.ResubmissionTxIDs = append(entry.ResubmissionTxIDs, tx.TxID)
+		entry.Status = ExpiredStatusResubmitted
+		entry.NextRetryAt = time.Time{}
+		log.Printf("[MEMPOOL] Resubmitted expired tx %s as %s (attempt %d)", entry.TxID, tx.TxID, attempt)
+	case res.Class == ErrorClassDuplicate:
+		// Some copy of this lineage is already pending; nothing to do until it expires again
+		entry.Status = ExpiredStatusResubmitted
+	case res.Class == ErrorClassPermanent:
+		entry.LastError = res.Reason
+		entry.ErrorClass = res.Class
+		em.abandon(entry, "non-retryable error: "+res.Reason)
+		return tx, res
+	default:
+		entry.ResubmitCount = attempt
+		entry.LastError = res.Reason
+		entry.ErrorClass = res.Class
+		entry.NextRetryAt = now.Add(em.cfg.Backoff(attempt))
+	}
+	em.mempool.ExpiredPool.AddExpiredTx(entry)
+	return tx, res
+}
+
+// abandon marks entry as abandoned and notifies the configured recipient.
+func (em *ExpiryManager) abandon(entry ExpiredTx, reason string) {
+	entry.Status = ExpiredStatusAbandoned
+	entry.NextRetryAt = time.Time{}
+	em.mempool.ExpiredPool.AddExpiredTx(entry)
+	log.Printf("[MEMPOOL] Abandoned expired tx %s after %d resubmission(s): %s", entry.TxID, entry.ResubmitCount, reason)
+	if em.notify != nil {
+		em.notify(notify.Notification{
+			TxID:      entry.TxID,
+			Reason:    reason,
+			Attempt:   entry.ResubmitCount,
+			Type:      notify.NotifyAdmin,
+			Recipient: em.cfg.NotifyRecipient,
+		})
+	}
+}
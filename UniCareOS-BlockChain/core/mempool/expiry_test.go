@@ -0,0 +1,120 @@
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"unicareos/core/notify"
+)
+
+func newTestExpiryManager(mp *Mempool, cfg ExpiryConfig) (*ExpiryManager, *[]notify.Notification, *time.Time) {
+	em := NewExpiryManager(mp, cfg)
+	clock := time.Now()
+	em.now = func() time.Time { return clock }
+	sent := []notify.Notification{}
+	em.notify = func(n notify.Notification) { sent = append(sent, n) }
+	return em, &sent, &clock
+}
+
+func TestExpiryBackoff(t *testing.T) {
+	cfg := ExpiryConfig{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second, BackoffMultiplier: 2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, w := range want {
+		if got := cfg.Backoff(attempt); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, w)
+		}
+	}
+}
+
+func TestExpiryResubmitKeepsLineage(t *testing.T) {
+	mp := NewMempool(10)
+	cfg := DefaultExpiryConfig()
+	cfg.BaseBackoff = 0
+	em, _, clock := newTestExpiryManager(mp, cfg)
+	*clock = clock.Add(time.Second)
+
+	stale := time.Now().Add(-time.Hour).Unix()
+	mp.AddTx(Transaction{TxID: "orig", Payload: []byte(`{}`), Timestamp: stale, Sender: "wallet"})
+	em.Tick()
+
+	resubID := ResubmissionTxID("orig", 1)
+	tx, ok := mp.GetTx(resubID)
+	if !ok {
+		t.Fatalf("expected %s in mempool", resubID)
+	}
+	if tx.LineageID() != "orig" || tx.Sender != "wallet" {
+		t.Errorf("resubmission lost lineage or sender: %+v", tx)
+	}
+	entry, _ := mp.ExpiredPool.GetExpiredTx("orig")
+	if entry.Status != ExpiredStatusResubmitted || entry.ResubmitCount != 1 {
+		t.Errorf("unexpected expired entry: %+v", entry)
+	}
+
+	// A manual resubmit while the lineage is live must dedup
+	_, res, err := em.Resubmit("orig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Accepted || res.Class != ErrorClassDuplicate {
+		t.Errorf("expected duplicate admission, got %+v", res)
+	}
+
+	// Inclusion of the resubmission resolves the expired entry
+	mp.RemoveTx(resubID)
+	if _, ok := mp.ExpiredPool.GetExpiredTx("orig"); ok {
+		t.Error("expired entry should be removed once its lineage is included")
+	}
+}
+
+func TestExpiryAbandonsPermanentFailures(t *testing.T) {
+	mp := NewMempool(10)
+	em, sent, _ := newTestExpiryManager(mp, DefaultExpiryConfig())
+
+	mp.AddTx(Transaction{TxID: "bad", Payload: []byte(`{}`), Timestamp: time.Now().Add(-time.Hour).Unix()})
+	mp.RecordRejection("bad", Rejected(ErrorClassPermanent, "invalid_signature: bad sig"))
+	em.Tick()
+
+	entry, _ := mp.ExpiredPool.GetExpiredTx("bad")
+	if entry.Status != ExpiredStatusAbandoned || entry.LastError != "invalid_signature: bad sig" {
+		t.Errorf("expected abandoned entry with LastError set, got %+v", entry)
+	}
+	if len(*sent) != 1 || (*sent)[0].TxID != "bad" {
+		t.Errorf("expected one abandonment notification, got %+v", *sent)
+	}
+}
+
+func TestExpiryAbandonsAfterMaxRetries(t *testing.T) {
+	mp := NewMempool(10)
+	cfg := DefaultExpiryConfig()
+	cfg.MaxRetries = 1
+	cfg.BaseBackoff = time.Minute
+	em, sent, clock := newTestExpiryManager(mp, cfg)
+
+	mp.AddTx(Transaction{TxID: "slow", Payload: []byte(`{}`), Timestamp: time.Now().Add(-time.Hour).Unix()})
+	em.Tick()
+	if _, ok := mp.GetTx(ResubmissionTxID("slow", 1)); ok {
+		t.Fatal("resubmission should wait for backoff")
+	}
+
+	*clock = clock.Add(2 * time.Minute)
+	em.Tick()
+	resub, ok := mp.GetTx(ResubmissionTxID("slow", 1))
+	if !ok {
+		t.Fatal("expected resubmission after backoff elapsed")
+	}
+
+	// Let the resubmission expire too; the retry budget is now spent
+	mp.RemoveTx(resub.TxID)
+	resub.Timestamp = time.Now().Add(-time.Hour).Unix()
+	mp.ExpiredPool.AddExpiredTx(ExpiredTx{TxID: "slow", Payload: []byte(`{}`), ResubmitCount: 1, Status: ExpiredStatusResubmitted})
+	mp.AddTx(resub)
+	em.Tick()
+
+	entry, _ := mp.ExpiredPool.GetExpiredTx("slow")
+	if entry.Status != ExpiredStatusAbandoned {
+		t.Errorf("expected abandoned after retry limit, got %+v", entry)
+	}
+	if len(*sent) != 1 {
+		t.Errorf("expected one notification, got %d", len(*sent))
+	}
+}
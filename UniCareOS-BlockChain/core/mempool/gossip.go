@@ -2,28 +2,138 @@ package mempool
 
 import (
 	"sync"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"bytes"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// GossipEngine manages tx gossip (broadcast/receive)
-// Usage: Call UpdatePeersFromSet to sync peers from your PeerSet.
+// GossipConfig tunes inventory-based transaction gossip.
+type GossipConfig struct {
+	Fanout         int           // Peers each announcement is sent to (0 = all peers)
+	SeenTTL        time.Duration // How long a TxID stays in the seen cache
+	MaxSeen        int           // Upper bound on seen cache entries; oldest are dropped first
+	RequestTimeout time.Duration // Timeout for INV/GETDATA/inventory requests
+	MaxGetData     int           // Most TxIDs asked for (and served) per GETDATA; larger sets are fetched in batches
+}
+
+// DefaultGossipConfig returns the gossip settings used by the node.
+// SeenTTL outlives the default mempool MaxAge so an expired tx is not re-fetched from a lagging peer.
+func DefaultGossipConfig() GossipConfig {
+	return GossipConfig{
+		Fanout:         8,
+		SeenTTL:        30 * time.Minute,
+		MaxSeen:        50000,
+		RequestTimeout: 5 * time.Second,
+		MaxGetData:     500,
+	}
+}
+
+// GossipEngine manages tx gossip using INV/GETDATA:
+// new TxIDs are announced to a random subset of peers, and peers fetch the bodies they are missing.
+// Usage: set PeerSource to feed peers from the P2P layer (or call UpdatePeersFromSet for a static PeerSet).
 type GossipEngine struct {
-	Peers   []string // Peer addresses (host:port)
-	SeenTxs map[string]struct{} // Deduplication: TxID -> seen
-	Mu      sync.Mutex
-	Mempool *Mempool
+	Peers      []string             // Static peer addresses (host:port), used when PeerSource is nil
+	PeerSource func() []string      // Live peer addresses, e.g. Network.GossipPeers
+	SeenTxs    map[string]time.Time // Deduplication: TxID -> first seen, bounded by Config.SeenTTL/MaxSeen
+	Mu         sync.Mutex
+	Mempool    *Mempool
+	Config     GossipConfig
+	ListenPort int // Port we serve gossip on, advertised in INV messages so peers know where to send GETDATA
+	// UsesInv reports whether a peer negotiated INV/GETDATA gossip. Peers for which it returns false get
+	// full tx bodies on the legacy /gossip_tx endpoint. Nil means every peer speaks INV.
+	UsesInv func(peer string) bool
+	// TxIDOf derives the TxID a payload must be announced under; bodies whose TxID does not match are
+	// dropped. Nil means PayloadTxID.
+	TxIDOf func(payload []byte) string
+
+	// Client and Scheme reach peers. In the node they are the authenticated P2P
+	// transport's client and "https"; the defaults are plain HTTP for tests.
+	Client *http.Client
+	Scheme string
+
+	now   func() time.Time
+	spawn func(func())
 }
 
 // NewGossipEngine creates a new gossip engine
 func NewGossipEngine(peers []string, mempool *Mempool) *GossipEngine {
+	cfg := DefaultGossipConfig()
 	return &GossipEngine{
 		Peers:   peers,
-		SeenTxs: make(map[string]struct{}),
+		SeenTxs: make(map[string]time.Time),
 		Mempool: mempool,
+		Config:  cfg,
+		Client:  &http.Client{Timeout: cfg.RequestTimeout},
+		Scheme:  "http",
+		now:     time.Now,
+	}
+}
+
+// PayloadTxID is the TxID of a payload whose type has no TxID of its own: the hex SHA-256 of the payload
+func PayloadTxID(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyTxID checks a received tx carries the TxID derived from its payload. A resubmission carries the
+// derived TxID as its OriginTxID and a ResubmissionTxID of it.
+func (ge *GossipEngine) verifyTxID(tx Transaction) error {
+	txIDOf := ge.TxIDOf
+	if txIDOf == nil {
+		txIDOf = PayloadTxID
+	}
+	want := txIDOf(tx.Payload)
+	if tx.OriginTxID == "" {
+		if tx.TxID != want {
+			return fmt.Errorf("tx %s does not match its payload (%s)", tx.TxID, want)
+		}
+		return nil
+	}
+	if tx.OriginTxID != want {
+		return fmt.Errorf("resubmitted tx %s: origin %s does not match its payload (%s)", tx.TxID, tx.OriginTxID, want)
+	}
+	attempt, ok := strings.CutPrefix(tx.TxID, want+"-resubmit-")
+	if n, err := strconv.Atoi(attempt); !ok || err != nil || n < 1 {
+		return errors.New("tx " + tx.TxID + " is not a resubmission of " + want)
 	}
+	return nil
+}
+
+// SetClock replaces the clock used for the seen cache (the simulation harness runs nodes on a simulated clock).
+func (ge *GossipEngine) SetClock(now func() time.Time) {
+	ge.Mu.Lock()
+	ge.now = now
+	ge.Mu.Unlock()
+}
+
+// SetSpawner replaces how announcements to peers are started in the background (the simulation
+// harness counts them to tell when the network is quiet).
+func (ge *GossipEngine) SetSpawner(spawn func(func())) {
+	ge.Mu.Lock()
+	ge.spawn = spawn
+	ge.Mu.Unlock()
+}
+
+// Go runs fn in the background through the engine's spawner
+func (ge *GossipEngine) Go(fn func()) {
+	ge.Mu.Lock()
+	spawn := ge.spawn
+	ge.Mu.Unlock()
+	if spawn != nil {
+		spawn(fn)
+		return
+	}
+	go fn()
 }
 
 // UpdatePeersFromSet updates the GossipEngine's peer list from a PeerSet.
@@ -33,57 +143,304 @@ func (ge *GossipEngine) UpdatePeersFromSet(ps *PeerSet) {
 	for _, p := range peers {
 		peerAddresses = append(peerAddresses, p.Address)
 	}
+	ge.Mu.Lock()
 	ge.Peers = peerAddresses
+	ge.Mu.Unlock()
 }
 
-// BroadcastTx gossips a transaction to all peers
-func (ge *GossipEngine) BroadcastTx(tx Transaction) {
-	fmt.Printf("[GOSSIP] Broadcasting tx %s to peers: %v\n", tx.TxID, ge.Peers)
+// currentPeers returns the peers to gossip with, preferring the live PeerSource.
+func (ge *GossipEngine) currentPeers() []string {
+	if ge.PeerSource != nil {
+		return ge.PeerSource()
+	}
 	ge.Mu.Lock()
-	if _, seen := ge.SeenTxs[tx.TxID]; seen {
-		ge.Mu.Unlock()
+	defer ge.Mu.Unlock()
+	return append([]string(nil), ge.Peers...)
+}
+
+// selectPeers returns up to Config.Fanout random peers, never including exclude.
+func (ge *GossipEngine) selectPeers(exclude string) []string {
+	candidates := []string{}
+	for _, p := range ge.currentPeers() {
+		if p != exclude {
+			candidates = append(candidates, p)
+		}
+	}
+	if ge.Config.Fanout <= 0 || len(candidates) <= ge.Config.Fanout {
+		return candidates
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	return candidates[:ge.Config.Fanout]
+}
+
+// markSeen records txID in the seen cache. It returns false if it was already there.
+func (ge *GossipEngine) markSeen(txID string) bool {
+	ge.Mu.Lock()
+	defer ge.Mu.Unlock()
+	now := ge.now()
+	if seenAt, seen := ge.SeenTxs[txID]; seen && now.Sub(seenAt) < ge.Config.SeenTTL {
+		return false
+	}
+	ge.SeenTxs[txID] = now
+	ge.pruneSeenLocked(now)
+	return true
+}
+
+// hasSeen reports whether txID is in the seen cache and not yet expired.
+func (ge *GossipEngine) hasSeen(txID string) bool {
+	ge.Mu.Lock()
+	defer ge.Mu.Unlock()
+	seenAt, seen := ge.SeenTxs[txID]
+	return seen && ge.now().Sub(seenAt) < ge.Config.SeenTTL
+}
+
+// pruneSeenLocked drops expired entries and, if the cache is still over MaxSeen,
+// the oldest entries. Caller must hold ge.Mu.
+func (ge *GossipEngine) pruneSeenLocked(now time.Time) {
+	if ge.Config.MaxSeen <= 0 || len(ge.SeenTxs) <= ge.Config.MaxSeen {
+		return
+	}
+	for id, seenAt := range ge.SeenTxs {
+		if now.Sub(seenAt) >= ge.Config.SeenTTL {
+			delete(ge.SeenTxs, id)
+		}
+	}
+	if len(ge.SeenTxs) <= ge.Config.MaxSeen {
+		return
+	}
+	// Still full: drop the oldest 10% so we don't sort on every insert
+	type seenEntry struct {
+		id string
+		at time.Time
+	}
+	entries := make([]seenEntry, 0, len(ge.SeenTxs))
+	for id, at := range ge.SeenTxs {
+		entries = append(entries, seenEntry{id, at})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].at.Before(entries[j].at) })
+	target := ge.Config.MaxSeen - ge.Config.MaxSeen/10
+	for i := 0; i < len(entries)-target; i++ {
+		delete(ge.SeenTxs, entries[i].id)
+	}
+}
+
+// BroadcastTx adds a locally submitted transaction to the mempool and announces it to peers
+func (ge *GossipEngine) BroadcastTx(tx Transaction) {
+	if !ge.markSeen(tx.TxID) {
 		return // Already seen
 	}
-	ge.SeenTxs[tx.TxID] = struct{}{}
-	ge.Mu.Unlock()
-	msg := GossipMessage{Tx: tx}
-	data, _ := json.Marshal(msg)
-	fmt.Printf("[GOSSIP] Broadcasting tx %s to peers: %v\n", tx.TxID, ge.Peers)
-	for _, peer := range ge.Peers {
-		url := fmt.Sprintf("http://%s/gossip_tx", peer)
-		fmt.Printf("[GOSSIP] Attempting POST to %s\n", url)
-		resp, err := http.Post(url, "application/json", bytes.NewReader(data))
-		if err != nil {
-			fmt.Printf("[GOSSIP] Failed to send tx %s to peer %s: %v\n", tx.TxID, peer, err)
+	ge.Mempool.AddTx(tx)
+	ge.announce([]string{tx.TxID}, "")
+}
+
+// announce sends an INV for txIDs to a random subset of peers (excluding the peer we got them from)
+func (ge *GossipEngine) announce(txIDs []string, exclude string) {
+	if len(txIDs) == 0 {
+		return
+	}
+	peers := ge.selectPeers(exclude)
+	fmt.Printf("[GOSSIP] Announcing %d tx(s) to peers: %v\n", len(txIDs), peers)
+	msg := InvMessage{TxIDs: txIDs, Port: ge.ListenPort}
+	for _, peer := range peers {
+		if ge.UsesInv != nil && !ge.UsesInv(peer) {
+			ge.Go(func() { ge.pushLegacy(peer, txIDs) })
 			continue
 		}
-		resp.Body.Close()
-		fmt.Printf("[GOSSIP] Sent tx %s to peer %s\n", tx.TxID, peer)
+		ge.Go(func() {
+			if err := ge.postJSON(peer, "/gossip/inv", msg, nil); err != nil {
+				fmt.Printf("[GOSSIP] Failed to send INV to peer %s: %v\n", peer, err)
+			}
+		})
+	}
+}
+
+// pushLegacy sends full tx bodies to a peer that does not speak INV/GETDATA
+func (ge *GossipEngine) pushLegacy(peer string, txIDs []string) {
+	for _, id := range txIDs {
+		tx, ok := ge.Mempool.GetTx(id)
+		if !ok {
+			continue
+		}
+		if err := ge.postJSON(peer, "/gossip_tx", GossipMessage{Tx: tx}, nil); err != nil {
+			fmt.Printf("[GOSSIP] Failed to push tx %s to legacy peer %s: %v\n", id, peer, err)
+		}
 	}
-	ge.Mempool.AddTx(tx)
 }
 
-// ReceiveGossip handles an incoming gossip message
+// missing filters txIDs down to those we have neither seen nor hold in the mempool
+func (ge *GossipEngine) missing(txIDs []string) []string {
+	want := []string{}
+	for _, id := range txIDs {
+		if ge.hasSeen(id) {
+			continue
+		}
+		if _, ok := ge.Mempool.GetTx(id); ok {
+			continue
+		}
+		want = append(want, id)
+	}
+	return want
+}
+
+// HandleInv processes an INV from a peer at fromHost and fetches any bodies we are missing.
+func (ge *GossipEngine) HandleInv(fromHost string, msg InvMessage) {
+	want := ge.missing(msg.TxIDs)
+	if len(want) == 0 || msg.Port <= 0 {
+		return
+	}
+	peer := net.JoinHostPort(fromHost, strconv.Itoa(msg.Port))
+	txs, err := ge.fetch(peer, want)
+	if err != nil {
+		fmt.Printf("[GOSSIP] GETDATA to %s failed: %v\n", peer, err)
+		return
+	}
+	ge.acceptTxs(txs, want, peer)
+}
+
+// HandleGetData returns the mempool transactions a peer asked for.
+func (ge *GossipEngine) HandleGetData(msg GetDataMessage) TxBatchMessage {
+	batch := TxBatchMessage{Txs: []Transaction{}}
+	ids := msg.TxIDs
+	if max := ge.Config.MaxGetData; max > 0 && len(ids) > max {
+		ids = ids[:max]
+	}
+	for _, id := range ids {
+		if tx, ok := ge.Mempool.GetTx(id); ok {
+			batch.Txs = append(batch.Txs, tx)
+		}
+	}
+	return batch
+}
+
+// Inventory returns the TxIDs currently in our mempool, for peer reconciliation.
+func (ge *GossipEngine) Inventory() InvMessage {
+	txs := ge.Mempool.GetAllTxs()
+	ids := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		ids = append(ids, tx.TxID)
+	}
+	return InvMessage{TxIDs: ids, Port: ge.ListenPort}
+}
+
+// ReconcileWithPeer pulls the peer's mempool inventory and fetches every transaction we lack.
+// It is called when a peer connects so both mempools converge without waiting for new announcements.
+func (ge *GossipEngine) ReconcileWithPeer(peer string) {
+	var inv InvMessage
+	if err := ge.getJSON(peer, "/gossip/inventory", &inv); err != nil {
+		fmt.Printf("[GOSSIP] Inventory request to %s failed: %v\n", peer, err)
+		return
+	}
+	want := ge.missing(inv.TxIDs)
+	if len(want) == 0 {
+		return
+	}
+	txs, err := ge.fetch(peer, want)
+	if err != nil {
+		fmt.Printf("[GOSSIP] GETDATA to %s failed: %v\n", peer, err)
+		return
+	}
+	added := ge.acceptTxs(txs, want, peer)
+	fmt.Printf("[GOSSIP] Reconciled with %s: %d missing, %d added\n", peer, len(want), added)
+}
+
+// fetch sends GETDATAs for txIDs to peer, at most Config.MaxGetData IDs each, and returns the bodies it
+// sent back
+func (ge *GossipEngine) fetch(peer string, txIDs []string) ([]Transaction, error) {
+	var txs []Transaction
+	for len(txIDs) > 0 {
+		n := len(txIDs)
+		if max := ge.Config.MaxGetData; max > 0 && n > max {
+			n = max
+		}
+		var batch TxBatchMessage
+		if err := ge.postJSON(peer, "/gossip/getdata", GetDataMessage{TxIDs: txIDs[:n]}, &batch); err != nil {
+			return txs, err
+		}
+		txs = append(txs, batch.Txs...)
+		txIDs = txIDs[n:]
+	}
+	return txs, nil
+}
+
+// acceptTxs admits fetched transactions we actually requested, then relays the accepted ones.
+func (ge *GossipEngine) acceptTxs(txs []Transaction, requested []string, from string) int {
+	wanted := make(map[string]struct{}, len(requested))
+	for _, id := range requested {
+		wanted[id] = struct{}{}
+	}
+	relay := []string{}
+	for _, tx := range txs {
+		if _, ok := wanted[tx.TxID]; !ok {
+			fmt.Printf("[GOSSIP] Ignored unrequested tx %s from %s\n", tx.TxID, from)
+			continue
+		}
+		if err := ge.verifyTxID(tx); err != nil {
+			fmt.Printf("[GOSSIP] Rejected tx from %s: %v\n", from, err)
+			continue
+		}
+		if !ge.markSeen(tx.TxID) {
+			continue
+		}
+		if res := ge.Mempool.Admit(tx); res.Accepted {
+			relay = append(relay, tx.TxID)
+		} else {
+			fmt.Printf("[GOSSIP] Tx %s was not added: %s\n", tx.TxID, res.Reason)
+		}
+	}
+	ge.announce(relay, from)
+	return len(relay)
+}
+
+// ReceiveGossip handles a legacy full-body gossip message (POST /gossip_tx)
 func (ge *GossipEngine) ReceiveGossip(data []byte) {
-	fmt.Println("[GOSSIP] ReceiveGossip called")
 	var msg GossipMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
 		fmt.Println("[GOSSIP] Received invalid gossip message (unmarshal failed)")
 		return // Invalid message
 	}
-	ge.Mu.Lock()
-	if _, seen := ge.SeenTxs[msg.Tx.TxID]; seen {
-		ge.Mu.Unlock()
+	if err := ge.verifyTxID(msg.Tx); err != nil {
+		fmt.Printf("[GOSSIP] Rejected gossiped tx: %v\n", err)
+		return
+	}
+	if !ge.markSeen(msg.Tx.TxID) {
 		fmt.Printf("[GOSSIP] Ignored duplicate tx %s\n", msg.Tx.TxID)
 		return // Already seen
 	}
-	ge.SeenTxs[msg.Tx.TxID] = struct{}{}
-	ge.Mu.Unlock()
-	added := ge.Mempool.AddTx(msg.Tx)
-	if added {
+	if res := ge.Mempool.Admit(msg.Tx); res.Accepted {
 		fmt.Printf("[GOSSIP] Added tx %s to mempool\n", msg.Tx.TxID)
+		ge.announce([]string{msg.Tx.TxID}, "")
 	} else {
-		fmt.Printf("[GOSSIP] Tx %s was not added (duplicate or mempool full)\n", msg.Tx.TxID)
+		fmt.Printf("[GOSSIP] Tx %s was not added: %s\n", msg.Tx.TxID, res.Reason)
+	}
+}
+
+func (ge *GossipEngine) postJSON(peer, path string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := ge.Client.Post(fmt.Sprintf("%s://%s%s", ge.Scheme, peer, path), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (ge *GossipEngine) getJSON(peer, path string, out interface{}) error {
+	resp, err := ge.Client.Get(fmt.Sprintf("%s://%s%s", ge.Scheme, peer, path))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
 	}
-	// Optionally: re-broadcast to peers
+	return json.NewDecoder(resp.Body).Decode(out)
 }
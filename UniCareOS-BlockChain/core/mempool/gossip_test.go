@@ -2,6 +2,11 @@ package mempool
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -72,3 +77,143 @@ func TestPeerSet(t *testing.T) {
 		t.Error("peerA should have been removed")
 	}
 }
+
+// serveGossip exposes ge's gossip endpoints the same way the API server does.
+func serveGossip(t *testing.T, ge *GossipEngine) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gossip/inv", func(w http.ResponseWriter, r *http.Request) {
+		var msg InvMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		ge.HandleInv(host, msg)
+	})
+	mux.HandleFunc("/gossip/getdata", func(w http.ResponseWriter, r *http.Request) {
+		var msg GetDataMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		json.NewEncoder(w).Encode(ge.HandleGetData(msg))
+	})
+	mux.HandleFunc("/gossip/inventory", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ge.Inventory())
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	ge.ListenPort, _ = strconv.Atoi(port)
+	return addr
+}
+
+func waitForTx(mp *Mempool, txID string) bool {
+	for i := 0; i < 100; i++ {
+		if _, ok := mp.GetTx(txID); ok {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestGossipInvGetData(t *testing.T) {
+	a := NewGossipEngine(nil, NewMempool(10))
+	b := NewGossipEngine(nil, NewMempool(10))
+	addrA := serveGossip(t, a)
+	addrB := serveGossip(t, b)
+	a.PeerSource = func() []string { return []string{addrB} }
+	b.PeerSource = func() []string { return []string{addrA} }
+
+	tx := Transaction{TxID: PayloadTxID([]byte("body")), Payload: []byte("body"), Timestamp: time.Now().Unix()}
+	a.BroadcastTx(tx)
+	if !waitForTx(b.Mempool, tx.TxID) {
+		t.Fatal("peer should have fetched the announced tx via GETDATA")
+	}
+	got, _ := b.Mempool.GetTx(tx.TxID)
+	if string(got.Payload) != "body" {
+		t.Errorf("unexpected payload %q", got.Payload)
+	}
+	if !b.hasSeen(tx.TxID) {
+		t.Error("fetched tx should be marked as seen")
+	}
+}
+
+func TestGossipReconcileWithPeer(t *testing.T) {
+	a := NewGossipEngine(nil, NewMempool(10))
+	b := NewGossipEngine(nil, NewMempool(10))
+	b.Config.MaxGetData = 1 // One GETDATA per missing tx
+	addrA := serveGossip(t, a)
+	var txs []Transaction
+	for i := 0; i < 3; i++ {
+		payload := []byte(fmt.Sprintf("pending-%d", i))
+		txs = append(txs, Transaction{TxID: PayloadTxID(payload), Payload: payload, Timestamp: time.Now().Unix()})
+		a.Mempool.AddTx(txs[i])
+	}
+	b.Mempool.AddTx(txs[0])
+
+	b.ReconcileWithPeer(addrA)
+	if len(b.Mempool.GetAllTxs()) != 3 {
+		t.Errorf("expected 3 txs after reconciliation, got %d", len(b.Mempool.GetAllTxs()))
+	}
+}
+
+func TestGossipRejectsMislabelledTx(t *testing.T) {
+	a := NewGossipEngine(nil, NewMempool(10))
+	b := NewGossipEngine(nil, NewMempool(10))
+	addrA := serveGossip(t, a)
+	// A peer serving a different body under a TxID it does not hash to
+	relabelled := PayloadTxID([]byte("genuine"))
+	a.Mempool.AddTx(Transaction{TxID: relabelled, Payload: []byte("forged"), Timestamp: time.Now().Unix()})
+	resubmitted := []byte("resubmitted")
+	resubmission := Transaction{TxID: ResubmissionTxID(PayloadTxID(resubmitted), 1), OriginTxID: PayloadTxID(resubmitted), Payload: resubmitted, Timestamp: time.Now().Unix()}
+	a.Mempool.AddTx(resubmission)
+
+	b.ReconcileWithPeer(addrA)
+	if _, ok := b.Mempool.GetTx(relabelled); ok {
+		t.Error("tx whose body does not hash to its TxID was accepted")
+	}
+	if _, ok := b.Mempool.GetTx(resubmission.TxID); !ok {
+		t.Error("resubmission of a matching origin was rejected")
+	}
+}
+
+func TestGossipSeenCacheBounded(t *testing.T) {
+	ge := NewGossipEngine(nil, NewMempool(10))
+	ge.Config.MaxSeen = 10
+	ge.Config.SeenTTL = time.Minute
+	clock := time.Now()
+	ge.now = func() time.Time { return clock }
+
+	for i := 0; i < 50; i++ {
+		clock = clock.Add(time.Millisecond)
+		ge.markSeen(fmt.Sprintf("tx-%d", i))
+	}
+	if len(ge.SeenTxs) > 10 {
+		t.Errorf("seen cache exceeded MaxSeen: %d entries", len(ge.SeenTxs))
+	}
+	if !ge.hasSeen("tx-49") {
+		t.Error("newest entry should be retained")
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if ge.hasSeen("tx-49") {
+		t.Error("entry should expire after SeenTTL")
+	}
+	if !ge.markSeen("tx-49") {
+		t.Error("expired entry should be treated as unseen")
+	}
+}
+
+func TestGossipFanout(t *testing.T) {
+	ge := NewGossipEngine(nil, NewMempool(10))
+	ge.Config.Fanout = 3
+	ge.PeerSource = func() []string { return []string{"p1", "p2", "p3", "p4", "p5", "p6"} }
+	for i := 0; i < 20; i++ {
+		peers := ge.selectPeers("p1")
+		if len(peers) != 3 {
+			t.Fatalf("expected 3 peers, got %d", len(peers))
+		}
+		for _, p := range peers {
+			if p == "p1" {
+				t.Fatal("excluded peer was selected")
+			}
+		}
+	}
+}
@@ -11,6 +11,8 @@ type Mempool struct {
 	txs   map[string]Transaction // TxID -> Transaction
 	order []string              // FIFO order for eviction
 	maxTxs int                  // Max transactions in pool
+	lineages   map[string]string          // Lineage (original) TxID -> live TxID, for resubmission dedup
+	rejections map[string]AdmissionResult // TxID -> last inclusion failure reported by the block producer
 	ExpiredPool *ExpiredTxPool  // Archive for expired transactions
 }
 
@@ -20,40 +22,104 @@ func NewMempool(maxTxs int) *Mempool {
 		txs:    make(map[string]Transaction),
 		order:  make([]string, 0),
 		maxTxs: maxTxs,
+		lineages:   make(map[string]string),
+		rejections: make(map[string]AdmissionResult),
 		ExpiredPool: NewExpiredTxPool(),
 	}
 } 
 
 // AddTx adds a transaction to the pool (returns false if duplicate or at capacity)
 func (mp *Mempool) AddTx(tx Transaction) bool {
+	return mp.Admit(tx).Accepted
+}
+
+// Admit offers a transaction to the pool and reports why it was or was not accepted.
+// A transaction is a duplicate if its TxID or its lineage is already pending.
+// When the pool is full the oldest transaction is evicted to the ExpiredPool.
+func (mp *Mempool) Admit(tx Transaction) AdmissionResult {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 	if _, exists := mp.txs[tx.TxID]; exists {
-		return false // duplicate
+		return Rejected(ErrorClassDuplicate, "transaction already in mempool")
+	}
+	if live, exists := mp.lineages[tx.LineageID()]; exists {
+		return Rejected(ErrorClassDuplicate, "lineage already pending as "+live)
+	}
+	mp.insertLocked(tx)
+	return AdmissionResult{Accepted: true}
+}
+
+// AdmitAll admits txs together or not at all. If any would be rejected, as a duplicate of a pending
+// transaction or of another in txs, none is admitted and the index of the first is returned with its
+// result; otherwise the index is -1.
+func (mp *Mempool) AdmitAll(txs []Transaction) (int, AdmissionResult) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if len(txs) > mp.maxTxs {
+		return 0, Rejected(ErrorClassRetryable, "more transactions than the mempool holds")
 	}
+	batch := make(map[string]bool, 2*len(txs))
+	for i, tx := range txs {
+		if _, exists := mp.txs[tx.TxID]; exists {
+			return i, Rejected(ErrorClassDuplicate, "transaction already in mempool")
+		}
+		if live, exists := mp.lineages[tx.LineageID()]; exists {
+			return i, Rejected(ErrorClassDuplicate, "lineage already pending as "+live)
+		}
+		if batch[tx.TxID] || batch[tx.LineageID()] {
+			return i, Rejected(ErrorClassDuplicate, "transaction repeated in the batch")
+		}
+		batch[tx.TxID], batch[tx.LineageID()] = true, true
+	}
+	for _, tx := range txs {
+		mp.insertLocked(tx)
+	}
+	return -1, AdmissionResult{Accepted: true}
+}
+
+// insertLocked adds an admitted tx, evicting the oldest one to the ExpiredPool when the pool is full.
+// Caller must hold mp.mu.
+func (mp *Mempool) insertLocked(tx Transaction) {
 	if len(mp.txs) >= mp.maxTxs {
 		// Evict oldest
 		oldest := mp.order[0]
-		delete(mp.txs, oldest)
+		mp.archiveLocked(mp.txs[oldest], "evicted")
+		mp.deleteLocked(oldest)
 		mp.order = mp.order[1:]
 	}
 	mp.txs[tx.TxID] = tx
+	mp.lineages[tx.LineageID()] = tx.TxID
 	mp.order = append(mp.order, tx.TxID)
-	return true
+}
+
+// RecordRejection notes that a pending transaction could not be included in a block.
+// The result is carried into the ExpiredPool when the transaction expires, so the
+// expiry manager can decide whether a resubmission is worthwhile.
+func (mp *Mempool) RecordRejection(txID string, result AdmissionResult) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if _, exists := mp.txs[txID]; !exists {
+		return
+	}
+	mp.rejections[txID] = result
 }
 
 // RemoveTx removes a transaction by TxID
 func (mp *Mempool) RemoveTx(txID string) {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
-	if _, exists := mp.txs[txID]; exists {
-		delete(mp.txs, txID)
+	if tx, exists := mp.txs[txID]; exists {
+		mp.deleteLocked(txID)
 		for i, id := range mp.order {
 			if id == txID {
 				mp.order = append(mp.order[:i], mp.order[i+1:]...)
 				break
 			}
 		}
+		// The lineage made it out of the pool; it no longer needs resubmitting
+		if mp.ExpiredPool != nil {
+			mp.ExpiredPool.RemoveExpiredTx(tx.LineageID())
+		}
 	}
 }
 
@@ -77,36 +143,63 @@ func (mp *Mempool) GetAllTxs() []Transaction {
 }
 
 // PurgeExpired moves transactions older than a given duration to the ExpiredTxPool
-func (mp *Mempool) PurgeExpired(maxAge time.Duration) {
+func (mp *Mempool) PurgeExpired(maxAge time.Duration) int {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 	now := time.Now().Unix()
+	archived := 0
 	newOrder := make([]string, 0, len(mp.order))
 	for _, id := range mp.order {
 		tx := mp.txs[id]
 		if now-tx.Timestamp > int64(maxAge.Seconds()) {
-			// Archive the expired transaction
-			if mp.ExpiredPool != nil {
-				existing, ok := mp.ExpiredPool.GetExpiredTx(id)
-				if ok {
-					// Only update ExpiredAt and Reason, preserve ResubmitCount and LastError
-					existing.ExpiredAt = time.Now()
-					existing.Reason = "timeout"
-					mp.ExpiredPool.AddExpiredTx(existing)
-				} else {
-					empTx := ExpiredTx{
-						TxID: id,
-						Payload: tx.Payload,
-						ExpiredAt: time.Now(),
-						Reason: "timeout",
-					}
-					mp.ExpiredPool.AddExpiredTx(empTx)
-				}
-			}
-			delete(mp.txs, id)
+			mp.archiveLocked(tx, "timeout")
+			mp.deleteLocked(id)
+			archived++
 		} else {
 			newOrder = append(newOrder, id)
 		}
 	}
 	mp.order = newOrder
+	return archived
+}
+
+// archiveLocked records tx in the ExpiredPool under its lineage ID.
+// Retry bookkeeping (ResubmitCount, ResubmissionTxIDs) from earlier expiries is preserved.
+// Caller must hold mp.mu.
+func (mp *Mempool) archiveLocked(tx Transaction, reason string) {
+	if mp.ExpiredPool == nil {
+		return
+	}
+	lineageID := tx.LineageID()
+	entry, ok := mp.ExpiredPool.GetExpiredTx(lineageID)
+	if !ok {
+		entry = ExpiredTx{
+			TxID:    lineageID,
+			Payload: tx.Payload,
+			Sender:  tx.Sender,
+		}
+	}
+	entry.ExpiredAt = time.Now()
+	entry.Reason = reason
+	entry.Status = ExpiredStatusPending
+	if rej, ok := mp.rejections[tx.TxID]; ok {
+		entry.LastError = rej.Reason
+		entry.ErrorClass = rej.Class
+	} else if reason == "timeout" || reason == "evicted" {
+		entry.LastError = reason
+		entry.ErrorClass = ErrorClassRetryable
+	}
+	mp.ExpiredPool.AddExpiredTx(entry)
+}
+
+// deleteLocked drops a transaction and its lineage/rejection bookkeeping (not the order slice).
+// Caller must hold mp.mu.
+func (mp *Mempool) deleteLocked(txID string) {
+	if tx, ok := mp.txs[txID]; ok {
+		if mp.lineages[tx.LineageID()] == txID {
+			delete(mp.lineages, tx.LineageID())
+		}
+	}
+	delete(mp.txs, txID)
+	delete(mp.rejections, txID)
 }
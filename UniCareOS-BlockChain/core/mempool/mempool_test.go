@@ -0,0 +1,33 @@
+package mempool
+
+import "testing"
+
+func TestAdmitAllAdmitsNoneWhenOneIsRefused(t *testing.T) {
+	mp := NewMempool(10)
+	mp.AddTx(Transaction{TxID: "pending"})
+
+	for name, batch := range map[string][]Transaction{
+		"already pending":  {{TxID: "a"}, {TxID: "pending"}},
+		"pending lineage":  {{TxID: "a"}, {TxID: "retry", OriginTxID: "pending"}},
+		"repeated":         {{TxID: "a"}, {TxID: "a"}},
+		"repeated lineage": {{TxID: "a"}, {TxID: "retry", OriginTxID: "a"}},
+	} {
+		i, res := mp.AdmitAll(batch)
+		if res.Accepted || res.Class != ErrorClassDuplicate || i != 1 {
+			t.Errorf("%s: entry %d %+v, want entry 1 refused as a duplicate", name, i, res)
+		}
+		if _, ok := mp.GetTx("a"); ok {
+			t.Fatalf("%s: entry before the refused one admitted", name)
+		}
+	}
+	if i, res := mp.AdmitAll(make([]Transaction, 11)); res.Accepted || i != 0 {
+		t.Errorf("batch larger than the pool admitted: %d %+v", i, res)
+	}
+
+	if i, res := mp.AdmitAll([]Transaction{{TxID: "a"}, {TxID: "b"}}); !res.Accepted || i != -1 {
+		t.Fatalf("batch refused: %d %+v", i, res)
+	}
+	if len(mp.GetAllTxs()) != 3 {
+		t.Errorf("%d transactions pending, want 3", len(mp.GetAllTxs()))
+	}
+}
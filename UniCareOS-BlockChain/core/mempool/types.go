@@ -2,10 +2,20 @@ package mempool
 
 // Transaction represents a mempool transaction (simplified for illustration)
 type Transaction struct {
-	TxID      string // Unique transaction hash
-	Payload   []byte // Serialized transaction payload
-	Timestamp int64  // Unix timestamp
-	Sender    string // (optional) sender address or pubkey
+	TxID       string // Unique transaction hash
+	Payload    []byte // Serialized transaction payload
+	Timestamp  int64  // Unix timestamp
+	Sender     string // (optional) sender address or pubkey
+	OriginTxID string // TxID of the original submission when this is a resubmission (empty otherwise)
+}
+
+// LineageID returns the TxID of the original submission this transaction descends from.
+// Resubmissions share the lineage ID of their original, so dedup and the expired pool key on it.
+func (tx Transaction) LineageID() string {
+	if tx.OriginTxID != "" {
+		return tx.OriginTxID
+	}
+	return tx.TxID
 }
 
 // GossipMessage represents a transaction gossip message
@@ -13,3 +23,46 @@ type GossipMessage struct {
 	Tx Transaction
 	// Optionally, add fields for protocol version, signature, etc.
 }
+
+// InvMessage announces transaction IDs (POST /gossip/inv) or lists a mempool's inventory (GET /gossip/inventory)
+type InvMessage struct {
+	TxIDs []string `json:"txIds"`
+	Port  int      `json:"port"` // Port the sender serves gossip on, where GETDATA should be sent
+}
+
+// GetDataMessage requests the full bodies of the listed transactions (POST /gossip/getdata)
+type GetDataMessage struct {
+	TxIDs []string `json:"txIds"`
+}
+
+// TxBatchMessage carries transaction bodies in response to a GetDataMessage
+type TxBatchMessage struct {
+	Txs []Transaction `json:"txs"`
+}
+
+// ErrorClass classifies why a transaction was not admitted or included.
+type ErrorClass string
+
+const (
+	// ErrorClassNone indicates no error has been recorded
+	ErrorClassNone ErrorClass = ""
+	// ErrorClassRetryable indicates a transient failure worth resubmitting
+	ErrorClassRetryable ErrorClass = "retryable"
+	// ErrorClassPermanent indicates the transaction will never be accepted as-is
+	ErrorClassPermanent ErrorClass = "permanent"
+	// ErrorClassDuplicate indicates the transaction (or its lineage) is already pending
+	ErrorClassDuplicate ErrorClass = "duplicate"
+)
+
+// AdmissionResult describes the outcome of offering a transaction to the mempool,
+// or of a later attempt to include it in a block.
+type AdmissionResult struct {
+	Accepted bool
+	Class    ErrorClass
+	Reason   string
+}
+
+// Rejected builds a non-accepted AdmissionResult with the given class and reason.
+func Rejected(class ErrorClass, reason string) AdmissionResult {
+	return AdmissionResult{Accepted: false, Class: class, Reason: reason}
+}
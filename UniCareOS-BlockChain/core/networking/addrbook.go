@@ -0,0 +1,246 @@
+package networking
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Persistent address book for peer discovery.
+// Entries live in LevelDB under "addr:<host:port>" so a node can find the network again after a restart.
+const addrBookPrefix = "addr:"
+
+// Address sources
+const (
+	AddrSourceSeed    = "seed"
+	AddrSourceManual  = "manual"  // /connect_peer
+	AddrSourceInbound = "inbound" // Peer connected to us and advertised its listen port
+	AddrSourcePEX     = "pex"     // Learned from another peer
+)
+
+// KnownAddress is an address book entry
+type KnownAddress struct {
+	Address     string    `json:"address"` // P2P address (host:port)
+	PubKey      []byte    `json:"pubKey,omitempty"`
+	Source      string    `json:"source"`
+	LastSeen    time.Time `json:"lastSeen"`    // Last time we heard of or from this address
+	LastAttempt time.Time `json:"lastAttempt"` // Last outbound dial
+	LastSuccess time.Time `json:"lastSuccess"` // Last successful handshake or RPC
+	Successes   int       `json:"successes"`
+	Failures    int       `json:"failures"` // Consecutive failures since the last success
+}
+
+// Score ranks addresses for dialing: proven, recently successful peers first
+func (ka KnownAddress) Score(now time.Time) float64 {
+	score := float64(ka.Successes)
+	if !ka.LastSuccess.IsZero() {
+		hours := now.Sub(ka.LastSuccess).Hours()
+		score += 10 / (1 + hours)
+	}
+	score -= 2 * float64(ka.Failures)
+	if ka.Source == AddrSourceSeed || ka.Source == AddrSourceManual {
+		score += 1
+	}
+	return score
+}
+
+// NextAttempt returns when the address may be dialed again after its consecutive failures
+func (ka KnownAddress) NextAttempt(base, max time.Duration) time.Time {
+	if ka.Failures == 0 || ka.LastAttempt.IsZero() {
+		return ka.LastAttempt
+	}
+	backoff := base
+	for i := 1; i < ka.Failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return ka.LastAttempt.Add(backoff)
+}
+
+// AddressBook tracks known peer addresses and persists them to LevelDB (memory-only if db is nil)
+type AddressBook struct {
+	mu    sync.Mutex
+	db    *leveldb.DB
+	addrs map[string]*KnownAddress
+	now   func() time.Time
+}
+
+// NewAddressBook creates an address book and loads any persisted entries
+func NewAddressBook(db *leveldb.DB) *AddressBook {
+	ab := &AddressBook{db: db, addrs: make(map[string]*KnownAddress), now: time.Now}
+	if db == nil {
+		return ab
+	}
+	iter := db.NewIterator(util.BytesPrefix([]byte(addrBookPrefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var ka KnownAddress
+		if err := json.Unmarshal(iter.Value(), &ka); err != nil || ka.Address == "" {
+			fmt.Printf("[ADDRBOOK] Skipping corrupt entry %s\n", iter.Key())
+			continue
+		}
+		ab.addrs[ka.Address] = &ka
+	}
+	fmt.Printf("[ADDRBOOK] Loaded %d known address(es)\n", len(ab.addrs))
+	return ab
+}
+
+// persistLocked writes one entry. Caller must hold ab.mu.
+func (ab *AddressBook) persistLocked(ka *KnownAddress) {
+	if ab.db == nil {
+		return
+	}
+	data, err := json.Marshal(ka)
+	if err != nil {
+		return
+	}
+	if err := ab.db.Put([]byte(addrBookPrefix+ka.Address), data, nil); err != nil {
+		fmt.Printf("[ADDRBOOK] Failed to persist %s: %v\n", ka.Address, err)
+	}
+}
+
+// entryLocked returns the entry for address, creating it if needed. Caller must hold ab.mu.
+func (ab *AddressBook) entryLocked(address, source string) *KnownAddress {
+	ka, ok := ab.addrs[address]
+	if !ok {
+		ka = &KnownAddress{Address: address, Source: source}
+		ab.addrs[address] = ka
+	}
+	return ka
+}
+
+// Add records an address. Existing entries keep their history; a known key is never overwritten by a different one.
+func (ab *AddressBook) Add(address string, pubKey []byte, source string) {
+	if address == "" {
+		return
+	}
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ka := ab.entryLocked(address, source)
+	if len(ka.PubKey) == 0 && len(pubKey) > 0 {
+		ka.PubKey = append([]byte(nil), pubKey...)
+	}
+	ka.LastSeen = ab.now()
+	ab.persistLocked(ka)
+}
+
+// MarkAttempt records an outbound dial
+func (ab *AddressBook) MarkAttempt(address string) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ka := ab.entryLocked(address, AddrSourceManual)
+	ka.LastAttempt = ab.now()
+	ab.persistLocked(ka)
+}
+
+// MarkGood records a successful handshake or RPC with the peer
+func (ab *AddressBook) MarkGood(address string, pubKey []byte) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ka := ab.entryLocked(address, AddrSourceManual)
+	now := ab.now()
+	ka.LastSeen = now
+	ka.LastSuccess = now
+	ka.Successes++
+	ka.Failures = 0
+	if len(pubKey) > 0 {
+		ka.PubKey = append([]byte(nil), pubKey...)
+	}
+	ab.persistLocked(ka)
+}
+
+// MarkFailed records a failed dial or RPC and returns the consecutive failure count
+func (ab *AddressBook) MarkFailed(address string) int {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ka, ok := ab.addrs[address]
+	if !ok {
+		return 0
+	}
+	ka.Failures++
+	ab.persistLocked(ka)
+	return ka.Failures
+}
+
+// Remove deletes an address
+func (ab *AddressBook) Remove(address string) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	delete(ab.addrs, address)
+	if ab.db != nil {
+		ab.db.Delete([]byte(addrBookPrefix+address), nil)
+	}
+}
+
+// Get returns a copy of the entry for address
+func (ab *AddressBook) Get(address string) (KnownAddress, bool) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ka, ok := ab.addrs[address]
+	if !ok {
+		return KnownAddress{}, false
+	}
+	return *ka, true
+}
+
+// List returns all entries, best score first
+func (ab *AddressBook) List() []KnownAddress {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	now := ab.now()
+	out := make([]KnownAddress, 0, len(ab.addrs))
+	for _, ka := range ab.addrs {
+		out = append(out, *ka)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Score(now) > out[j].Score(now) })
+	return out
+}
+
+// DialCandidates returns up to n addresses that are out of backoff and not in exclude, best score first
+func (ab *AddressBook) DialCandidates(n int, exclude map[string]bool, baseBackoff, maxBackoff time.Duration) []KnownAddress {
+	now := ab.now()
+	out := []KnownAddress{}
+	for _, ka := range ab.List() {
+		if len(out) >= n {
+			break
+		}
+		if exclude[ka.Address] || now.Before(ka.NextAttempt(baseBackoff, maxBackoff)) {
+			continue
+		}
+		out = append(out, ka)
+	}
+	return out
+}
+
+// Prune removes addresses that keep failing and have not succeeded within maxAge. Seeds are kept.
+func (ab *AddressBook) Prune(maxFailures int, maxAge time.Duration) int {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	now := ab.now()
+	removed := 0
+	for addr, ka := range ab.addrs {
+		if ka.Source == AddrSourceSeed || ka.Failures < maxFailures {
+			continue
+		}
+		last := ka.LastSuccess
+		if last.IsZero() {
+			last = ka.LastSeen
+		}
+		if now.Sub(last) < maxAge {
+			continue
+		}
+		delete(ab.addrs, addr)
+		if ab.db != nil {
+			ab.db.Delete([]byte(addrBookPrefix+addr), nil)
+		}
+		removed++
+	}
+	return removed
+}
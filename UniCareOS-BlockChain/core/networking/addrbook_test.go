@@ -0,0 +1,101 @@
+package networking
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestAddressBookPersists(t *testing.T) {
+	dir := t.TempDir()
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab := NewAddressBook(db)
+	ab.Add("10.0.0.1:3000", []byte("k1"), AddrSourceSeed)
+	ab.MarkGood("10.0.0.1:3000", nil)
+	ab.Add("10.0.0.2:3000", nil, AddrSourcePEX)
+	ab.MarkFailed("10.0.0.2:3000")
+	db.Close()
+
+	db, err = leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	reloaded := NewAddressBook(db)
+	ka, ok := reloaded.Get("10.0.0.1:3000")
+	if !ok || ka.Successes != 1 || ka.Source != AddrSourceSeed || string(ka.PubKey) != "k1" {
+		t.Errorf("unexpected reloaded entry: %+v", ka)
+	}
+	if ka, _ := reloaded.Get("10.0.0.2:3000"); ka.Failures != 1 {
+		t.Errorf("failure count not persisted: %+v", ka)
+	}
+	if list := reloaded.List(); len(list) != 2 || list[0].Address != "10.0.0.1:3000" {
+		t.Errorf("expected proven peer ranked first, got %+v", list)
+	}
+}
+
+func TestAddressBookBackoffAndPrune(t *testing.T) {
+	ab := NewAddressBook(nil)
+	clock := time.Now()
+	ab.now = func() time.Time { return clock }
+
+	ab.Add("a:1", nil, AddrSourcePEX)
+	ab.MarkAttempt("a:1")
+	ab.MarkFailed("a:1")
+	ab.MarkFailed("a:1") // backoff is now 2 * base
+
+	base, max := time.Minute, 10*time.Minute
+	if got := ab.DialCandidates(5, nil, base, max); len(got) != 0 {
+		t.Fatalf("address in backoff should not be a candidate: %+v", got)
+	}
+	clock = clock.Add(2*time.Minute + time.Second)
+	if got := ab.DialCandidates(5, nil, base, max); len(got) != 1 {
+		t.Fatalf("address should be dialable after backoff, got %+v", got)
+	}
+	if got := ab.DialCandidates(5, map[string]bool{"a:1": true}, base, max); len(got) != 0 {
+		t.Fatal("excluded address returned")
+	}
+
+	ab.Add("seed:1", nil, AddrSourceSeed)
+	for i := 0; i < 5; i++ {
+		ab.MarkFailed("seed:1")
+	}
+	ab.MarkFailed("a:1")
+	clock = clock.Add(48 * time.Hour)
+	if removed := ab.Prune(3, 24*time.Hour); removed != 1 {
+		t.Errorf("expected 1 pruned address, got %d", removed)
+	}
+	if _, ok := ab.Get("seed:1"); !ok {
+		t.Error("seeds must never be pruned")
+	}
+}
+
+func TestPEXSharesOnlyKnownGoodAllowedPeers(t *testing.T) {
+	server := newTestTransport(t, nil)
+	client := newTestTransport(t, NewPeerKeySet(server.PubKey))
+	server.Keys.Add(client.PubKey)
+	validator := newTestTransport(t, nil)
+	server.Keys.Add(validator.PubKey)
+	stranger := newTestTransport(t, nil)
+
+	n := &Network{Transport: server, PeerMux: http.NewServeMux(), AddrBook: NewAddressBook(nil), PeerConfig: DefaultPeerManagerConfig()}
+	n.PeerMux.HandleFunc("/pex/addrs", n.HandlePEX)
+	n.AddrBook.MarkGood("10.0.0.5:3000", validator.PubKey)
+	n.AddrBook.MarkGood("10.0.0.6:3000", stranger.PubKey)            // not in the node set
+	n.AddrBook.Add("10.0.0.7:3000", validator.PubKey, AddrSourcePEX) // never reached
+	addr := serveTransport(t, n)
+
+	c := &Network{Transport: client}
+	addrs, err := c.requestPEX(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].Address != "10.0.0.5:3000" {
+		t.Errorf("expected only the reachable validator address, got %+v", addrs)
+	}
+}
@@ -0,0 +1,473 @@
+package networking
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/signer"
+)
+
+// Consensus-applied bans.
+// A validator proposes a ban (target, expiry, reason, evidence) and signs its ProposalID. The proposal is
+// gossiped over /ban_proposal; other validators' operators approve it through the admin API, which adds
+// their signature and gossips it again. The validators are the producers that sealed the last
+// ValidatorWindow blocks up to the block's parent, so every node derives the same set from its chain
+// whatever peers it is connected to. Once BanQuorum validators have signed,
+// the next block producer includes the event in BanEvents (committed to by Block.BanRoot) and every node
+// applies it when the block is committed. Unapproved, tampered or already applied ban events make the
+// block invalid; applied ProposalIDs are persisted under banapplied:<id>.
+
+const (
+	maxBanProposalBytes = 64 << 10
+	banAppliedPrefix    = "banapplied:"
+
+	DefaultValidatorWindow = 128
+)
+
+// BanQuorum is the number of validator approvals needed out of validators (more than two thirds)
+func BanQuorum(validators int) int {
+	return validators*2/3 + 1
+}
+
+// banPool holds proposals waiting for quorum, keyed by ProposalID
+type banPool struct {
+	mu        sync.Mutex
+	proposals map[string]*block.BanEvent
+	included  map[string]struct{} // Applied from a block; later gossip of the same proposal is ignored
+
+	validatorsAt string              // Parent block hash the cached validator set was derived at
+	validators   map[string]struct{} // Cached validator set at validatorsAt
+}
+
+// BanProposalStatus is a pending proposal with its approval progress
+type BanProposalStatus struct {
+	block.BanEvent
+	Approved int  `json:"approved"`
+	Required int  `json:"required"`
+	Ready    bool `json:"ready"` // Will be included in the next block this node produces
+}
+
+// validatorSet returns the validator keys (hex) at the current tip and the approvals required
+func (n *Network) validatorSet() (map[string]struct{}, int) {
+	tip := n.GetLatestBlockID()
+	return n.validatorSetAt(fmt.Sprintf("%x", tip[:]))
+}
+
+// validatorSetAt returns the keys (hex) of the producers that sealed the ValidatorWindow blocks ending at
+// parentHash, and the approvals required of them
+func (n *Network) validatorSetAt(parentHash string) (map[string]struct{}, int) {
+	n.banPool.mu.Lock()
+	if n.banPool.validatorsAt == parentHash && n.banPool.validators != nil {
+		set := n.banPool.validators
+		n.banPool.mu.Unlock()
+		return set, BanQuorum(len(set))
+	}
+	n.banPool.mu.Unlock()
+
+	window := n.ValidatorWindow
+	if window <= 0 {
+		window = DefaultValidatorWindow
+	}
+	set := make(map[string]struct{})
+	complete := false // Walked the whole window (or back to genesis); a partial walk is not cached
+	id, err := hex.DecodeString(parentHash)
+	for i := 0; err == nil && n.store != nil; i++ {
+		if i == window {
+			complete = true
+			break
+		}
+		raw, gerr := n.store.GetBlock(id)
+		if gerr != nil {
+			break
+		}
+		blk, derr := block.Deserialize(raw)
+		if derr != nil {
+			break
+		}
+		if pub, perr := producerKey(blk.ValidatorDID); perr == nil {
+			set[hex.EncodeToString(pub)] = struct{}{}
+		}
+		if blk.Height == 0 {
+			complete = true
+			break
+		}
+		id, err = hex.DecodeString(blk.PrevHash)
+	}
+
+	if complete {
+		n.banPool.mu.Lock()
+		n.banPool.validatorsAt, n.banPool.validators = parentHash, set
+		n.banPool.mu.Unlock()
+	}
+	return set, BanQuorum(len(set))
+}
+
+// checkBanProposal validates everything about a proposal except its approvals
+func (n *Network) checkBanProposal(e block.BanEvent, validators map[string]struct{}) error {
+	if kind, _ := ClassifyBanTarget(e.Address); kind == BanKindAddr {
+		return fmt.Errorf("ban target must be an IP, CIDR or node:<hex pubkey>, got %q", e.Address)
+	}
+	if e.Reason == "" || e.Evidence == "" {
+		return errors.New("ban proposal needs a reason and evidence")
+	}
+	expiry, err := e.ExpiryTime()
+	if err != nil {
+		return fmt.Errorf("invalid ban expiry: %v", err)
+	}
+	if !expiry.After(e.Timestamp) {
+		return errors.New("ban expiry must be after the proposal time")
+	}
+	if e.ProposalID != e.ComputeProposalID() {
+		return errors.New("ban proposal ID does not match its contents")
+	}
+	origin, err := producerKey(e.Origin)
+	if err != nil {
+		return fmt.Errorf("ban origin: %v", err)
+	}
+	if _, ok := validators[fmt.Sprintf("%x", []byte(origin))]; !ok {
+		return fmt.Errorf("ban origin %s is not a validator", e.Origin)
+	}
+	return nil
+}
+
+// validApprovals returns the distinct, correctly signed approvals from validators
+func validApprovals(e block.BanEvent, validators map[string]struct{}) []block.BanApproval {
+	seen := make(map[string]struct{})
+	var out []block.BanApproval
+	for _, a := range e.Approvals {
+		pub, err := producerKey(a.Validator)
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%x", []byte(pub))
+		if _, ok := validators[key]; !ok {
+			continue
+		}
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		if !ed25519.Verify(pub, []byte(e.ProposalID), a.Signature) {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, a)
+	}
+	return out
+}
+
+// VerifyBanEvent checks that a ban event is well formed and quorum-approved by the validators at the tip
+func (n *Network) VerifyBanEvent(e block.BanEvent) error {
+	tip := n.GetLatestBlockID()
+	return n.verifyBanEventAt(e, fmt.Sprintf("%x", tip[:]))
+}
+
+// verifyBanEventAt checks a ban event against the validator set at parentHash
+func (n *Network) verifyBanEventAt(e block.BanEvent, parentHash string) error {
+	validators, required := n.validatorSetAt(parentHash)
+	if len(validators) == 0 {
+		return errors.New("no validator set to check ban approvals against")
+	}
+	if err := n.checkBanProposal(e, validators); err != nil {
+		return err
+	}
+	approvals := validApprovals(e, validators)
+	if len(approvals) != len(e.Approvals) {
+		return fmt.Errorf("ban %s carries %d invalid approvals", e.ProposalID, len(e.Approvals)-len(approvals))
+	}
+	if len(approvals) < required {
+		return fmt.Errorf("ban %s has %d of %d required approvals", e.ProposalID, len(approvals), required)
+	}
+	originApproved := false
+	for _, a := range approvals {
+		if a.Validator == e.Origin {
+			originApproved = true
+		}
+	}
+	if !originApproved {
+		return fmt.Errorf("ban %s is not signed by its origin", e.ProposalID)
+	}
+	return nil
+}
+
+// banApplied reports whether proposalID was applied from a committed block
+func (n *Network) banApplied(proposalID string) bool {
+	n.banPool.mu.Lock()
+	_, done := n.banPool.included[proposalID]
+	n.banPool.mu.Unlock()
+	if done || n.store == nil {
+		return done
+	}
+	ok, err := n.store.DB().Has([]byte(banAppliedPrefix+proposalID), nil)
+	return err == nil && ok
+}
+
+// signBanApproval adds this node's approval to e
+func (n *Network) signBanApproval(e *block.BanEvent) error {
+	if !signer.Usable(n.nodeSigner()) {
+		return errors.New("no validator key loaded")
+	}
+	did := fmt.Sprintf("ed25519:%x", n.PubKey)
+	for _, a := range e.Approvals {
+		if a.Validator == did {
+			return nil
+		}
+	}
+	sig, err := signer.Sign(n.nodeSigner(), []byte(e.ProposalID))
+	if err != nil {
+		return err
+	}
+	e.Approvals = append(e.Approvals, block.BanApproval{Validator: did, Signature: sig})
+	return nil
+}
+
+// ProposeBan creates a ban proposal signed by this validator and gossips it to peers
+func (n *Network) ProposeBan(target string, expiry time.Time, reason, evidence string) (block.BanEvent, error) {
+	_, target = ClassifyBanTarget(target)
+	e := block.BanEvent{
+		Address:   target,
+		Expiry:    expiry.UTC().Format(time.RFC3339),
+		Reason:    reason,
+		Evidence:  evidence,
+		Origin:    fmt.Sprintf("ed25519:%x", n.PubKey),
+		Timestamp: n.Now().UTC().Truncate(time.Second),
+	}
+	if n.Bans != nil {
+		e.BanCount = n.Bans.Count(target) + 1
+	}
+	e.ProposalID = e.ComputeProposalID()
+	validators, _ := n.validatorSet()
+	if err := n.checkBanProposal(e, validators); err != nil {
+		return e, err
+	}
+	if err := n.signBanApproval(&e); err != nil {
+		return e, err
+	}
+	if _, err := n.AddBanProposal(e); err != nil {
+		return e, err
+	}
+	fmt.Printf("[BAN CONSENSUS] Proposed ban %s of %s until %s: %s\n", e.ProposalID, e.Address, e.Expiry, e.Reason)
+	n.relayBanProposal(e)
+	return e, nil
+}
+
+// ApproveBan signs a pending proposal with this validator's key and gossips the approval
+func (n *Network) ApproveBan(proposalID string) (block.BanEvent, error) {
+	n.banPool.mu.Lock()
+	p, ok := n.banPool.proposals[proposalID]
+	var e block.BanEvent
+	if ok {
+		e = *p
+		e.Approvals = append([]block.BanApproval(nil), p.Approvals...)
+	}
+	n.banPool.mu.Unlock()
+	if !ok {
+		return e, fmt.Errorf("unknown ban proposal %s", proposalID)
+	}
+	validators, _ := n.validatorSet()
+	if _, ok := validators[fmt.Sprintf("%x", n.PubKey)]; !ok {
+		return e, errors.New("this node is not a validator")
+	}
+	if err := n.signBanApproval(&e); err != nil {
+		return e, err
+	}
+	if _, err := n.AddBanProposal(e); err != nil {
+		return e, err
+	}
+	fmt.Printf("[BAN CONSENSUS] Approved ban %s of %s\n", e.ProposalID, e.Address)
+	n.relayBanProposal(e)
+	return e, nil
+}
+
+// AddBanProposal merges a proposal and its valid approvals into the pool.
+// It returns true if the pool learned something new (the proposal or an approval) and should relay it.
+func (n *Network) AddBanProposal(e block.BanEvent) (bool, error) {
+	validators, _ := n.validatorSet()
+	if err := n.checkBanProposal(e, validators); err != nil {
+		return false, err
+	}
+	if n.banApplied(e.ProposalID) {
+		return false, nil
+	}
+	approvals := validApprovals(e, validators)
+	n.banPool.mu.Lock()
+	defer n.banPool.mu.Unlock()
+	if n.banPool.proposals == nil {
+		n.banPool.proposals = make(map[string]*block.BanEvent)
+	}
+	p, ok := n.banPool.proposals[e.ProposalID]
+	if !ok {
+		e.Approvals = approvals
+		n.banPool.proposals[e.ProposalID] = &e
+		return true, nil
+	}
+	changed := false
+	for _, a := range approvals {
+		known := false
+		for _, have := range p.Approvals {
+			if have.Validator == a.Validator {
+				known = true
+				break
+			}
+		}
+		if !known {
+			p.Approvals = append(p.Approvals, a)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// BanProposals lists pending proposals with their approval progress
+func (n *Network) BanProposals() []BanProposalStatus {
+	validators, required := n.validatorSet()
+	n.banPool.mu.Lock()
+	defer n.banPool.mu.Unlock()
+	out := []BanProposalStatus{}
+	for _, p := range n.banPool.proposals {
+		approved := len(validApprovals(*p, validators))
+		out = append(out, BanProposalStatus{BanEvent: *p, Approved: approved, Required: required, Ready: approved >= required})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
+
+// readyBanEvents returns quorum-approved, unexpired proposals for the next block.
+// Caller must not hold n.lock.
+func (n *Network) readyBanEvents() []block.BanEvent {
+	var out []block.BanEvent
+	now := n.Now()
+	for _, p := range n.BanProposals() {
+		if !p.Ready {
+			continue
+		}
+		if expiry, err := p.ExpiryTime(); err != nil || !expiry.After(now) {
+			continue
+		}
+		if n.VerifyBanEvent(p.BanEvent) == nil {
+			out = append(out, p.BanEvent)
+		}
+	}
+	return out
+}
+
+// verifyBanEvents checks a block's ban events against its BanRoot and their quorum approvals
+func (n *Network) verifyBanEvents(blk block.Block) error {
+	if root := block.BanEventsRoot(blk.BanEvents); root != blk.BanRoot {
+		return fmt.Errorf("block %d: ban events do not match BanRoot", blk.Height)
+	}
+	seen := make(map[string]struct{})
+	for _, e := range blk.BanEvents {
+		if _, dup := seen[e.ProposalID]; dup || n.banApplied(e.ProposalID) {
+			return fmt.Errorf("block %d: ban %s was already applied", blk.Height, e.ProposalID)
+		}
+		seen[e.ProposalID] = struct{}{}
+		if err := n.verifyBanEventAt(e, blk.PrevHash); err != nil {
+			return fmt.Errorf("block %d: %v", blk.Height, err)
+		}
+	}
+	return nil
+}
+
+// recordBanEvents applies the ban events of a committed block to the local ban list.
+// Caller must not hold n.lock.
+func (n *Network) recordBanEvents(blk block.Block) {
+	for _, e := range blk.BanEvents {
+		expiry, _ := e.ExpiryTime()
+		if n.Bans != nil {
+			n.Bans.BanUntil(e.Address, expiry, e.Reason+" (evidence: "+e.Evidence+")", "consensus:"+e.ProposalID)
+		}
+		n.banPool.mu.Lock()
+		if n.banPool.included == nil {
+			n.banPool.included = make(map[string]struct{})
+		}
+		n.banPool.included[e.ProposalID] = struct{}{}
+		delete(n.banPool.proposals, e.ProposalID)
+		n.banPool.mu.Unlock()
+		if n.store != nil {
+			if err := n.store.DB().Put([]byte(banAppliedPrefix+e.ProposalID), blk.BlockID[:], nil); err != nil {
+				fmt.Printf("[BAN CONSENSUS] Failed to persist applied ban %s: %v\n", e.ProposalID, err)
+			}
+		}
+		fmt.Printf("[BAN CONSENSUS] Applied ban %s of %s until %s (block %d)\n", e.ProposalID, e.Address, e.Expiry, blk.Height)
+	}
+}
+
+// revertBanEvents undoes recordBanEvents for a rolled-back block: the bans it imposed are lifted and its
+// proposals can be included again. Caller must not hold n.lock.
+func (n *Network) revertBanEvents(blk block.Block) {
+	for i := len(blk.BanEvents) - 1; i >= 0; i-- {
+		e := blk.BanEvents[i]
+		if n.Bans != nil {
+			n.Bans.UnbanSource(e.Address, "consensus:"+e.ProposalID, fmt.Sprintf("block %d rolled back", blk.Height))
+		}
+		n.banPool.mu.Lock()
+		delete(n.banPool.included, e.ProposalID)
+		if n.banPool.proposals == nil {
+			n.banPool.proposals = make(map[string]*block.BanEvent)
+		}
+		n.banPool.proposals[e.ProposalID] = &e
+		n.banPool.mu.Unlock()
+		if n.store != nil {
+			if err := n.store.DB().Delete([]byte(banAppliedPrefix+e.ProposalID), nil); err != nil {
+				fmt.Printf("[BAN CONSENSUS] Failed to forget applied ban %s: %v\n", e.ProposalID, err)
+			}
+		}
+		fmt.Printf("[BAN CONSENSUS] Rolled back ban %s of %s (block %d)\n", e.ProposalID, e.Address, blk.Height)
+	}
+}
+
+// relayBanProposal gossips a proposal (with every approval we know of) to peers
+func (n *Network) relayBanProposal(e block.BanEvent) {
+	n.banPool.mu.Lock()
+	if p, ok := n.banPool.proposals[e.ProposalID]; ok {
+		e = *p
+	}
+	n.banPool.mu.Unlock()
+	data, _ := json.Marshal(e)
+	for _, peer := range n.Peers() {
+		p := peer
+		n.goAsync(func() {
+			url := PeerURL(p.Address, "/ban_proposal")
+			resp, err := n.peerHTTP().Post(url, "application/json", bytes.NewReader(data))
+			if err != nil {
+				fmt.Printf("[BAN CONSENSUS] Error sending ban proposal to %s: %v\n", url, err)
+				return
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+// HandleBanProposal receives a gossiped ban proposal or approval from a peer
+func (n *Network) HandleBanProposal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	address, pub := n.requestIdentity(r)
+	var e block.BanEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBanProposalBytes)).Decode(&e); err != nil {
+		n.PenalizePeer(address, pub, decodeOffense(err), "ban proposal: "+err.Error())
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	changed, err := n.AddBanProposal(e)
+	if err != nil {
+		n.PenalizePeer(address, pub, OffenseMalformedMessage, "ban proposal: "+err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if changed {
+		n.goAsync(func() { n.relayBanProposal(e) })
+	}
+	w.WriteHeader(http.StatusOK)
+}
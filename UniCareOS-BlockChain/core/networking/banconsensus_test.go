@@ -0,0 +1,214 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+)
+
+// newValidatorSet returns count validator nodes sharing a chain in which each of them sealed a block
+func newValidatorSet(t *testing.T, count int) ([]*Network, []block.Block) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	genesis := block.Block{Version: "1.0", Timestamp: time.Unix(1700000000, 0).UTC(), ValidatorDID: "did:unicare:genesis"}
+	genesis.BlockID = genesis.ComputeID()
+	chain := []block.Block{genesis}
+	var nodes []*Network
+	for i := 0; i < count; i++ {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		nodes = append(nodes, &Network{PubKey: pub, PrivKey: priv, Bans: NewBanManager(nil)})
+		parent := chain[len(chain)-1]
+		b := block.Block{
+			Version:      "1.0",
+			Height:       parent.Height + 1,
+			PrevHash:     fmt.Sprintf("%x", parent.BlockID[:]),
+			Timestamp:    parent.Timestamp.Add(time.Second),
+			ValidatorDID: fmt.Sprintf("ed25519:%x", []byte(pub)),
+		}
+		b.BlockID = b.ComputeID()
+		b.Signature = ed25519.Sign(priv, b.BlockID[:])
+		chain = append(chain, b)
+	}
+	for _, n := range nodes {
+		n.store = newTestStore(t, chain)
+		n.SetLatestBlockID(chain[len(chain)-1].BlockID)
+	}
+	return nodes, chain
+}
+
+func TestBanEventAppliedOnlyWithQuorum(t *testing.T) {
+	v, chain := newValidatorSet(t, 3)
+	tip := fmt.Sprintf("%x", chain[len(chain)-1].BlockID[:])
+	target := "node:" + strings.Repeat("cd", 32)
+	prop, err := v[0].ProposeBan(target, time.Now().Add(72*time.Hour), "forged blocks", "blocks 1200-1204")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v[0].VerifyBanEvent(prop); err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("single-signer ban should lack quorum, got %v", err)
+	}
+	blk := block.Block{Height: 7, PrevHash: tip, BanEvents: []block.BanEvent{prop}, BanRoot: block.BanEventsRoot([]block.BanEvent{prop})}
+	if err := v[0].verifyBanEvents(blk); err == nil {
+		t.Fatal("unapproved ban accepted")
+	}
+
+	// The proposal is gossiped; the other validators approve it and gossip their signatures back
+	for _, n := range v[1:] {
+		if _, err := n.AddBanProposal(prop); err != nil {
+			t.Fatal(err)
+		}
+		approved, err := n.ApproveBan(prop.ProposalID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed, _ := v[0].AddBanProposal(approved); !changed {
+			t.Error("new approval not merged")
+		}
+	}
+	ready := v[0].readyBanEvents()
+	if len(ready) != 1 || len(ready[0].Approvals) != 3 {
+		t.Fatalf("expected one quorum-approved ban, got %+v", ready)
+	}
+
+	tampered := ready[0]
+	tampered.Expiry = time.Now().Add(24 * 365 * time.Hour).UTC().Format(time.RFC3339)
+	bad := block.Block{Height: 8, PrevHash: tip, BanEvents: []block.BanEvent{tampered}, BanRoot: block.BanEventsRoot([]block.BanEvent{tampered})}
+	if err := v[1].verifyBanEvents(bad); err == nil {
+		t.Error("tampered ban accepted")
+	}
+	stripped := block.Block{Height: 8, PrevHash: tip, BanRoot: block.BanEventsRoot(ready)}
+	if err := v[1].verifyBanEvents(stripped); err == nil {
+		t.Error("block whose ban events were stripped accepted")
+	}
+
+	good := block.Block{Height: 8, PrevHash: tip, BanEvents: ready, BanRoot: block.BanEventsRoot(ready)}
+	for _, n := range v {
+		if err := n.verifyBanEvents(good); err != nil {
+			t.Fatal(err)
+		}
+		if n.IsPeerBanned(target) {
+			t.Error("ban applied before its block was committed")
+		}
+		n.recordBanEvents(good)
+		if !n.IsPeerBanned(target) {
+			t.Error("approved ban not applied")
+		}
+		if len(n.BanProposals()) != 0 {
+			t.Error("included proposal still pending")
+		}
+	}
+	if changed, _ := v[2].AddBanProposal(ready[0]); changed {
+		t.Error("included proposal re-entered the pool")
+	}
+}
+
+func TestBanProposalRejectsOutsiders(t *testing.T) {
+	v, chain := newValidatorSet(t, 2)
+	others, _ := newValidatorSet(t, 1)
+	outsider := others[0]
+	outsider.store = newTestStore(t, chain)
+	outsider.SetLatestBlockID(chain[len(chain)-1].BlockID)
+	if _, err := outsider.ProposeBan("10.0.0.5", time.Now().Add(time.Hour), "spam", "log excerpt"); err == nil {
+		t.Error("non-validator proposed a ban")
+	}
+	if _, err := v[0].ProposeBan("10.0.0.5", time.Now().Add(time.Hour), "spam", ""); err == nil {
+		t.Error("ban without evidence accepted")
+	}
+	prop, err := v[0].ProposeBan("10.0.0.0/24", time.Now().Add(time.Hour), "spam", "log excerpt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsider.signBanApproval(&prop)
+	if err := v[0].VerifyBanEvent(prop); err == nil {
+		t.Error("approval from a non-validator counted")
+	}
+}
+
+func TestBanAppliedOnlyWhenBlockCommitted(t *testing.T) {
+	v, chain := newValidatorSet(t, 3)
+	target := "node:" + strings.Repeat("ef", 32)
+	prop, err := v[0].ProposeBan(target, time.Now().Add(72*time.Hour), "equivocation", "blocks 88 and 88'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range v[1:] {
+		n.AddBanProposal(prop)
+		approved, err := n.ApproveBan(prop.ProposalID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v[0].AddBanProposal(approved)
+	}
+	ready := v[0].readyBanEvents()
+	if len(ready) != 1 {
+		t.Fatalf("expected one quorum-approved ban, got %d", len(ready))
+	}
+
+	n := v[0]
+	child := func(parent block.Block, salt int64, bans []block.BanEvent) block.Block {
+		b := block.Block{
+			Height:    parent.Height + 1,
+			PrevHash:  fmt.Sprintf("%x", parent.BlockID[:]),
+			Timestamp: parent.Timestamp.Add(time.Duration(salt) * time.Second),
+			BanEvents: bans,
+			BanRoot:   block.BanEventsRoot(bans),
+		}
+		b.BlockID = b.ComputeID()
+		return b
+	}
+	parent := chain[len(chain)-1]
+	empty := child(parent, 1, nil)
+	if err := n.SaveNewBlock(empty); err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid sibling of the tip is not committed, so its ban is not applied
+	if err := n.SaveNewBlock(child(parent, 2, ready)); err != nil {
+		t.Fatal(err)
+	}
+	if n.IsPeerBanned(target) || len(n.BanProposals()) != 1 {
+		t.Fatal("ban applied from a block that was not committed")
+	}
+
+	committed := child(empty, 1, ready)
+	if err := n.SaveNewBlock(committed); err != nil {
+		t.Fatal(err)
+	}
+	if !n.IsPeerBanned(target) || len(n.BanProposals()) != 0 {
+		t.Error("ban not applied from the committed block")
+	}
+
+	// The applied ProposalID is persisted: a later block replaying the ban is rejected, also after a restart
+	restarted := &Network{PubKey: n.PubKey, PrivKey: n.PrivKey, Bans: NewBanManager(nil), store: n.store}
+	restarted.SetLatestBlockID(committed.BlockID)
+	if err := restarted.verifyBanEvents(child(committed, 1, ready)); err == nil || !strings.Contains(err.Error(), "already applied") {
+		t.Errorf("replayed ban accepted: %v", err)
+	}
+	if changed, _ := restarted.AddBanProposal(ready[0]); changed {
+		t.Error("applied proposal re-entered the pool after a restart")
+	}
+}
+
+func TestBanValidatorSetFollowsChainNotPeers(t *testing.T) {
+	v, chain := newValidatorSet(t, 3)
+	n := v[0]
+	// The producer table (connected peers) plays no part in the validator set
+	n.ProducersDynamic = map[string]struct{}{fmt.Sprintf("%x", []byte(n.PubKey)): {}}
+	set, required := n.validatorSet()
+	if len(set) != 3 || required != 3 {
+		t.Fatalf("validator set at the tip: %d keys, %d required", len(set), required)
+	}
+	// At an earlier parent only the producers sealed up to it count
+	if set, _ := n.validatorSetAt(fmt.Sprintf("%x", chain[1].BlockID[:])); len(set) != 1 {
+		t.Errorf("validator set at block 1 has %d keys, want 1", len(set))
+	}
+	n.ValidatorWindow = 2
+	n.banPool.validators = nil
+	if set, _ := n.validatorSet(); len(set) != 2 {
+		t.Errorf("validator set over a 2-block window has %d keys, want 2", len(set))
+	}
+}
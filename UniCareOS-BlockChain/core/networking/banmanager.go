@@ -0,0 +1,494 @@
+package networking
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// BanManager owns all peer bans. It is safe for concurrent use.
+// Targets are an IP ("10.1.2.3"), a CIDR range ("10.1.0.0/16") or a node identity ("node:<hex pubkey>").
+// Allowlisted targets are never treated as banned, which lets operators exempt a partner hospital's range.
+// Every decision (ban, unban, expiry, allowlist change, ban skipped because of the allowlist) is audited.
+//
+// LevelDB layout:
+//
+//	ban:<target>       JSON BanEntry (older nodes wrote an RFC3339 expiry, which is still read)
+//	banCount:<target>  8-byte big-endian violation count for progressive bans
+//	banallow:<target>  JSON AllowEntry
+//	banaudit:<nanos>-<seq> JSON BanAuditEntry
+//
+// Audit entries older than AuditRetention, and the oldest beyond MaxAuditEntries, are pruned as new ones are written.
+const (
+	banPrefix      = "ban:"
+	banCountPrefix = "banCount:"
+	banAllowPrefix = "banallow:"
+	banAuditPrefix = "banaudit:"
+
+	maxBanAuditInMemory = 1000
+
+	DefaultBanAuditRetention  = 365 * 24 * time.Hour
+	DefaultMaxBanAuditEntries = 100000
+)
+
+// Ban target kinds
+const (
+	BanKindIP   = "ip"
+	BanKindCIDR = "cidr"
+	BanKindNode = "node"
+	BanKindAddr = "addr" // Anything else (legacy entries, host:port strings); matched exactly
+)
+
+// Ban audit actions
+const (
+	BanActionBan        = "ban"
+	BanActionUnban      = "unban"
+	BanActionExpire     = "expire"
+	BanActionAllow      = "allow"
+	BanActionDisallow   = "disallow"
+	BanActionBanSkipped = "ban_skipped" // Ban requested for an allowlisted target
+)
+
+// BanEntry is an active ban
+type BanEntry struct {
+	Target    string    `json:"target"`
+	Kind      string    `json:"kind"`
+	Expiry    time.Time `json:"expiry"`
+	Reason    string    `json:"reason,omitempty"`
+	Source    string    `json:"source,omitempty"` // Who decided: ratelimit, score, admin:<actor>, block:<origin>
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AllowEntry exempts a target from bans
+type AllowEntry struct {
+	Target    string    `json:"target"`
+	Kind      string    `json:"kind"`
+	Note      string    `json:"note,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BanAuditEntry records one ban decision
+type BanAuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Kind   string    `json:"kind"`
+	Reason string    `json:"reason,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+// BanManager tracks bans, progressive ban counts and the allowlist
+type BanManager struct {
+	mu     sync.Mutex
+	db     *leveldb.DB
+	bans   map[string]BanEntry
+	counts map[string]int
+	allow  map[string]AllowEntry
+	audit  []BanAuditEntry
+	stored int    // Audit entries persisted in the database
+	seq    uint64 // Disambiguates audit keys written in the same nanosecond
+	now    func() time.Time
+
+	AuditRetention  time.Duration // Audit entries older than this are pruned (0 keeps them regardless of age)
+	MaxAuditEntries int           // At most this many audit entries are kept (0 means no limit)
+}
+
+// NewBanManager creates a manager and loads persisted state (memory-only if db is nil)
+func NewBanManager(db *leveldb.DB) *BanManager {
+	m := &BanManager{
+		db:     db,
+		bans:   make(map[string]BanEntry),
+		counts: make(map[string]int),
+		allow:  make(map[string]AllowEntry),
+		now:    time.Now,
+
+		AuditRetention:  DefaultBanAuditRetention,
+		MaxAuditEntries: DefaultMaxBanAuditEntries,
+	}
+	if db == nil {
+		return m
+	}
+	m.load()
+	return m
+}
+
+func (m *BanManager) load() {
+	m.scan(banCountPrefix, func(target string, val []byte) {
+		if len(val) == 8 {
+			m.counts[target] = int(binary.BigEndian.Uint64(val))
+		}
+	})
+	m.scan(banPrefix, func(target string, val []byte) {
+		var e BanEntry
+		if err := json.Unmarshal(val, &e); err != nil {
+			// Legacy format: RFC3339 expiry only
+			expiry, perr := time.Parse(time.RFC3339, string(val))
+			if perr != nil {
+				return
+			}
+			kind, _ := ClassifyBanTarget(target)
+			e = BanEntry{Target: target, Kind: kind, Expiry: expiry, Source: "legacy"}
+		}
+		m.bans[target] = e
+	})
+	m.scan(banAllowPrefix, func(_ string, val []byte) {
+		var a AllowEntry
+		if json.Unmarshal(val, &a) == nil {
+			m.allow[a.Target] = a
+		}
+	})
+	m.scan(banAuditPrefix, func(_ string, val []byte) {
+		m.stored++
+		var a BanAuditEntry
+		if json.Unmarshal(val, &a) == nil {
+			m.audit = append(m.audit, a)
+		}
+	})
+	if len(m.audit) > maxBanAuditInMemory {
+		m.audit = m.audit[len(m.audit)-maxBanAuditInMemory:]
+	}
+	m.pruneAuditLocked(m.now())
+	fmt.Printf("[BAN LOAD] Imported %d persistent bans and %d allowlist entries from DB\n", len(m.bans), len(m.allow))
+}
+
+// scan calls fn for every key under prefix ("ban:" does not match "banCount:", "banallow:" or "banaudit:")
+func (m *BanManager) scan(prefix string, fn func(suffix string, val []byte)) {
+	iter := m.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		fn(string(iter.Key()[len(prefix):]), iter.Value())
+	}
+}
+
+// ClassifyBanTarget normalizes a target and returns its kind
+func ClassifyBanTarget(target string) (string, string) {
+	target = strings.TrimSpace(target)
+	if strings.HasPrefix(target, "node:") {
+		if k, err := hex.DecodeString(target[len("node:"):]); err == nil && len(k) == 32 {
+			return BanKindNode, "node:" + hex.EncodeToString(k)
+		}
+		return BanKindAddr, target
+	}
+	if strings.Contains(target, "/") {
+		if _, ipnet, err := net.ParseCIDR(target); err == nil {
+			return BanKindCIDR, ipnet.String()
+		}
+		return BanKindAddr, target
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return BanKindIP, ip.String()
+	}
+	return BanKindAddr, target
+}
+
+// put/del persist one key; caller must hold m.mu
+func (m *BanManager) put(key string, v interface{}) {
+	if m.db == nil {
+		return
+	}
+	var data []byte
+	switch val := v.(type) {
+	case []byte:
+		data = val
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return
+		}
+	}
+	if err := m.db.Put([]byte(key), data, nil); err != nil {
+		fmt.Printf("[ERROR] Failed to persist %s: %v\n", key, err)
+	}
+}
+
+func (m *BanManager) del(key string) {
+	if m.db == nil {
+		return
+	}
+	if err := m.db.Delete([]byte(key), nil); err != nil {
+		fmt.Printf("[ERROR] Failed to delete %s: %v\n", key, err)
+	}
+}
+
+// recordLocked appends an audit entry. Caller must hold m.mu.
+func (m *BanManager) recordLocked(e BanAuditEntry) {
+	e.Time = m.now().UTC()
+	m.audit = append(m.audit, e)
+	if len(m.audit) > maxBanAuditInMemory {
+		m.audit = m.audit[len(m.audit)-maxBanAuditInMemory:]
+	}
+	m.seq++
+	m.put(fmt.Sprintf("%s%020d-%06d", banAuditPrefix, e.Time.UnixNano(), m.seq%1000000), e)
+	if m.db != nil {
+		m.stored++
+	}
+	m.pruneAuditLocked(e.Time)
+	fmt.Printf("[BAN AUDIT] %s %s (%s) source=%s reason=%q\n", e.Action, e.Target, e.Kind, e.Source, e.Reason)
+}
+
+// pruneAuditLocked drops audit entries past AuditRetention or beyond MaxAuditEntries, oldest first.
+// Audit keys sort by time, so only the entries being dropped are visited. Caller must hold m.mu.
+func (m *BanManager) pruneAuditLocked(now time.Time) {
+	var cutoff int64
+	if m.AuditRetention > 0 {
+		cutoff = now.Add(-m.AuditRetention).UnixNano()
+	}
+	expired := func(t time.Time) bool { return cutoff > 0 && t.UnixNano() < cutoff }
+	drop := 0
+	for drop < len(m.audit) && expired(m.audit[drop].Time) {
+		drop++
+	}
+	if m.MaxAuditEntries > 0 && len(m.audit)-drop > m.MaxAuditEntries {
+		drop = len(m.audit) - m.MaxAuditEntries
+	}
+	m.audit = m.audit[drop:]
+
+	excess := func() bool { return m.MaxAuditEntries > 0 && m.stored > m.MaxAuditEntries }
+	if m.db == nil || (cutoff == 0 && !excess()) {
+		return
+	}
+	iter := m.db.NewIterator(util.BytesPrefix([]byte(banAuditPrefix)), nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		var nanos int64
+		fmt.Sscanf(string(iter.Key()[len(banAuditPrefix):]), "%d-", &nanos)
+		if !excess() && (cutoff == 0 || nanos >= cutoff) {
+			break
+		}
+		batch.Delete(append([]byte(nil), iter.Key()...))
+		m.stored--
+	}
+	if batch.Len() == 0 {
+		return
+	}
+	if err := m.db.Write(batch, nil); err != nil {
+		fmt.Printf("[ERROR] Failed to prune ban audit: %v\n", err)
+	}
+}
+
+// allowedLocked reports whether target (already normalized) is allowlisted. Caller must hold m.mu.
+func (m *BanManager) allowedLocked(kind, target string) bool {
+	if _, ok := m.allow[target]; ok {
+		return true
+	}
+	if kind != BanKindIP {
+		return false
+	}
+	ip := net.ParseIP(target)
+	for t, a := range m.allow {
+		if a.Kind != BanKindCIDR {
+			continue
+		}
+		if _, ipnet, err := net.ParseCIDR(t); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// BanUntil bans target until expiry. Allowlisted targets are not banned (the decision is still audited).
+func (m *BanManager) BanUntil(target string, expiry time.Time, reason, source string) error {
+	kind, target := ClassifyBanTarget(target)
+	if target == "" {
+		return errors.New("empty ban target")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.allowedLocked(kind, target) {
+		m.recordLocked(BanAuditEntry{Action: BanActionBanSkipped, Target: target, Kind: kind, Reason: reason, Source: source, Expiry: expiry})
+		return nil
+	}
+	e := BanEntry{Target: target, Kind: kind, Expiry: expiry, Reason: reason, Source: source, CreatedAt: m.now().UTC()}
+	m.bans[target] = e
+	m.put(banPrefix+target, e)
+	m.recordLocked(BanAuditEntry{Action: BanActionBan, Target: target, Kind: kind, Reason: reason, Source: source, Expiry: expiry})
+	return nil
+}
+
+// Ban bans target for duration
+func (m *BanManager) Ban(target string, duration time.Duration, reason, source string) error {
+	return m.BanUntil(target, m.now().Add(duration), reason, source)
+}
+
+// BanProgressive bans target for the next duration in banDurations (permanently after that) and returns it
+func (m *BanManager) BanProgressive(target, reason, source string) (time.Duration, int) {
+	_, key := ClassifyBanTarget(target)
+	m.mu.Lock()
+	m.counts[key]++
+	count := m.counts[key]
+	countBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(countBytes, uint64(count))
+	m.put(banCountPrefix+key, countBytes)
+	m.mu.Unlock()
+
+	dur := permabanDuration
+	if count <= len(banDurations) {
+		dur = banDurations[count-1]
+	}
+	m.Ban(target, dur, fmt.Sprintf("%s (violation #%d)", reason, count), source)
+	return dur, count
+}
+
+// Unban lifts a ban early. It returns false if target was not banned.
+func (m *BanManager) Unban(target, reason, actor string) bool {
+	kind, target := ClassifyBanTarget(target)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.bans[target]; !ok {
+		return false
+	}
+	delete(m.bans, target)
+	m.del(banPrefix + target)
+	m.recordLocked(BanAuditEntry{Action: BanActionUnban, Target: target, Kind: kind, Reason: reason, Source: actor})
+	return true
+}
+
+// UnbanSource lifts target's ban if it was imposed by source, e.g. a consensus ban whose block is rolled
+// back. A later ban from elsewhere is kept. It returns false if no such ban exists.
+func (m *BanManager) UnbanSource(target, source, reason string) bool {
+	kind, target := ClassifyBanTarget(target)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.bans[target]; !ok || e.Source != source {
+		return false
+	}
+	delete(m.bans, target)
+	m.del(banPrefix + target)
+	m.recordLocked(BanAuditEntry{Action: BanActionUnban, Target: target, Kind: kind, Reason: reason, Source: source})
+	return true
+}
+
+// activeLocked returns the ban for target if it exists and has not expired, expiring it otherwise. Caller must hold m.mu.
+func (m *BanManager) activeLocked(target string, now time.Time) (BanEntry, bool) {
+	e, ok := m.bans[target]
+	if !ok {
+		return BanEntry{}, false
+	}
+	if now.After(e.Expiry) {
+		delete(m.bans, target)
+		m.del(banPrefix + target)
+		m.recordLocked(BanAuditEntry{Action: BanActionExpire, Target: target, Kind: e.Kind, Reason: e.Reason, Source: e.Source, Expiry: e.Expiry})
+		return BanEntry{}, false
+	}
+	return e, true
+}
+
+// IsBanned reports whether target (IP, node identity or other address) is banned, directly or through a CIDR ban
+func (m *BanManager) IsBanned(target string) bool {
+	kind, target := ClassifyBanTarget(target)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.allowedLocked(kind, target) {
+		return false
+	}
+	now := m.now()
+	if _, ok := m.activeLocked(target, now); ok {
+		return true
+	}
+	if kind != BanKindIP {
+		return false
+	}
+	ip := net.ParseIP(target)
+	for t, e := range m.bans {
+		if e.Kind != BanKindCIDR {
+			continue
+		}
+		if _, ipnet, err := net.ParseCIDR(t); err == nil && ipnet.Contains(ip) {
+			if _, ok := m.activeLocked(t, now); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Allow adds target to the allowlist
+func (m *BanManager) Allow(target, note, actor string) error {
+	kind, target := ClassifyBanTarget(target)
+	if kind == BanKindAddr {
+		return fmt.Errorf("allowlist entries must be an IP, CIDR or node:<hex pubkey>, got %q", target)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := AllowEntry{Target: target, Kind: kind, Note: note, Actor: actor, CreatedAt: m.now().UTC()}
+	m.allow[target] = a
+	m.put(banAllowPrefix+target, a)
+	m.recordLocked(BanAuditEntry{Action: BanActionAllow, Target: target, Kind: kind, Reason: note, Source: actor})
+	return nil
+}
+
+// Disallow removes target from the allowlist. It returns false if it was not there.
+func (m *BanManager) Disallow(target, actor string) bool {
+	kind, target := ClassifyBanTarget(target)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.allow[target]; !ok {
+		return false
+	}
+	delete(m.allow, target)
+	m.del(banAllowPrefix + target)
+	m.recordLocked(BanAuditEntry{Action: BanActionDisallow, Target: target, Kind: kind, Source: actor})
+	return true
+}
+
+// List returns active bans, soonest expiry first
+func (m *BanManager) List() []BanEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	out := []BanEntry{}
+	for t := range m.bans {
+		if e, ok := m.activeLocked(t, now); ok {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Expiry.Before(out[j].Expiry) })
+	return out
+}
+
+// Allowlist returns all allowlist entries
+func (m *BanManager) Allowlist() []AllowEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]AllowEntry, 0, len(m.allow))
+	for _, a := range m.allow {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+// Audit returns up to limit of the most recent decisions, newest first (limit <= 0 returns all in memory)
+func (m *BanManager) Audit(limit int) []BanAuditEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []BanAuditEntry{}
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		out = append(out, m.audit[i])
+	}
+	return out
+}
+
+// Count returns the progressive violation count for target
+func (m *BanManager) Count(target string) int {
+	_, key := ClassifyBanTarget(target)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[key]
+}
@@ -0,0 +1,131 @@
+package networking
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestBanManagerCIDRAllowlistAndUnban(t *testing.T) {
+	m := NewBanManager(nil)
+	clock := time.Now()
+	m.now = func() time.Time { return clock }
+
+	m.Ban("10.1.0.0/16", time.Hour, "scanner", "admin:ops")
+	if !m.IsBanned("10.1.2.3") || m.IsBanned("10.2.0.1") {
+		t.Fatal("CIDR ban not applied to the right range")
+	}
+	// A partner range inside the banned block is exempt
+	if err := m.Allow("10.1.5.0/24", "partner hospital", "admin:ops"); err != nil {
+		t.Fatal(err)
+	}
+	if m.IsBanned("10.1.5.7") {
+		t.Error("allowlist did not override the CIDR ban")
+	}
+	m.Ban("10.1.5.8", time.Hour, "rate limit", "ratelimit")
+	if m.IsBanned("10.1.5.8") {
+		t.Error("allowlisted IP was banned")
+	}
+	if err := m.Allow("peer.example:3000", "", "admin:ops"); err == nil {
+		t.Error("allowlist accepted a host:port target")
+	}
+
+	if !m.Unban("10.1.0.0/16", "false positive", "admin:ops") || m.IsBanned("10.1.2.3") {
+		t.Error("unban did not lift the CIDR ban")
+	}
+	if m.Unban("10.1.0.0/16", "", "admin:ops") {
+		t.Error("second unban should report nothing to lift")
+	}
+
+	m.Ban("node:"+strings.Repeat("ab", 32), time.Minute, "bad signature", "score")
+	clock = clock.Add(2 * time.Minute)
+	if m.IsBanned("node:" + strings.Repeat("AB", 32)) {
+		t.Error("expired node ban still active")
+	}
+
+	var actions []string
+	for _, e := range m.Audit(0) {
+		actions = append([]string{e.Action}, actions...)
+	}
+	want := []string{BanActionBan, BanActionAllow, BanActionBanSkipped, BanActionUnban, BanActionBan, BanActionExpire}
+	if strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Errorf("audit trail = %v, want %v", actions, want)
+	}
+}
+
+func TestBanManagerPersistsAndIsConcurrencySafe(t *testing.T) {
+	dir := t.TempDir()
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewBanManager(db)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m.IsBanned("192.168.1.1")
+				m.List()
+			}
+		}()
+	}
+	if dur, count := m.BanProgressive("192.168.1.1", "rate limit exceeded", "ratelimit"); dur != banDurations[0] || count != 1 {
+		t.Errorf("unexpected first progressive ban: %s #%d", dur, count)
+	}
+	m.Allow("172.16.0.0/12", "partner", "admin:ops")
+	// Bans written by older nodes stored only an RFC3339 expiry
+	db.Put([]byte(banPrefix+"10.9.9.9"), []byte(time.Now().Add(time.Hour).UTC().Format(time.RFC3339)), nil)
+	wg.Wait()
+	db.Close()
+
+	db, err = leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m = NewBanManager(db)
+	if !m.IsBanned("192.168.1.1") || !m.IsBanned("10.9.9.9") || m.Count("192.168.1.1") != 1 {
+		t.Error("bans or counts not restored from the database")
+	}
+	if len(m.Allowlist()) != 1 || len(m.Audit(0)) != 2 {
+		t.Errorf("allowlist or audit not restored: %d entries, %d audit", len(m.Allowlist()), len(m.Audit(0)))
+	}
+}
+
+func TestBanManagerPrunesAudit(t *testing.T) {
+	dir := t.TempDir()
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := NewBanManager(db)
+	clock := time.Now()
+	m.now = func() time.Time { return clock }
+	m.AuditRetention = 24 * time.Hour
+	m.MaxAuditEntries = 3
+
+	m.Allow("10.0.0.1", "old", "admin:ops")
+	clock = clock.Add(48 * time.Hour)
+	m.Allow("10.0.0.2", "", "admin:ops")
+	if got := m.Audit(0); len(got) != 1 || got[0].Target != "10.0.0.2" {
+		t.Fatalf("entry past retention not pruned: %+v", got)
+	}
+	for _, target := range []string{"10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		m.Allow(target, "", "admin:ops")
+	}
+	if got := m.Audit(0); len(got) != 3 || got[2].Target != "10.0.0.3" {
+		t.Fatalf("audit not capped at MaxAuditEntries: %+v", got)
+	}
+
+	persisted := 0
+	m.scan(banAuditPrefix, func(string, []byte) { persisted++ })
+	if persisted != 3 {
+		t.Errorf("%d audit entries persisted, want 3", persisted)
+	}
+}
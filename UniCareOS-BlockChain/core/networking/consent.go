@@ -0,0 +1,128 @@
+package networking
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/types/ids"
+)
+
+// Patient consent.
+// A patient-signed ConsentGrant or ConsentRevoke enters the mempool through SubmitConsent. The producer
+// writes it as a consent_grant or consent_revoke event (committed to by Block.ConsentRoot) once
+// blockchain.VerifyConsent accepts it; every node verifies the events again before accepting the block
+// and applies them to the consent state when the block is committed. Reads check that state.
+
+// SubmitConsent verifies a consent transaction's signature, adds it to the mempool and gossips it
+func (n *Network) SubmitConsent(p *block.ConsentPayload) (string, error) {
+	if n.Mempool == nil {
+		return "", fmt.Errorf("no mempool")
+	}
+	if err := p.Verify(); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	tx := mempool.Transaction{TxID: p.TxID(), Payload: payload, Timestamp: n.Now().Unix(), Sender: p.PatientDID()}
+	if res := n.Mempool.Admit(tx); !res.Accepted {
+		return "", fmt.Errorf("%s: %s", res.Class, res.Reason)
+	}
+	if n.Gossip != nil {
+		n.Gossip.BroadcastTx(tx)
+	}
+	fmt.Printf("[CONSENT] Submitted %s %s for patient %s\n", p.Type, tx.TxID, p.PatientDID())
+	return tx.TxID, nil
+}
+
+// consentKey identifies the grant a consent transaction creates or revokes, so a block touches it once
+func consentKey(p *block.ConsentPayload) string {
+	return p.Type + ":" + p.ConsentID()
+}
+
+// consentResult classifies a consent transaction that could not be included: one already applied is
+// dropped, a revocation of a grant not yet on chain may be retried.
+func consentResult(err error) mempool.AdmissionResult {
+	switch {
+	case errors.Is(err, blockchain.ErrConsentDuplicate):
+		return mempool.Rejected(mempool.ErrorClassDuplicate, err.Error())
+	case errors.Is(err, blockchain.ErrConsentUnknown):
+		return mempool.Rejected(mempool.ErrorClassRetryable, err.Error())
+	}
+	return mempool.Rejected(mempool.ErrorClassPermanent, err.Error())
+}
+
+// verifyConsentEvents checks a block's consent events before it is accepted
+func (n *Network) verifyConsentEvents(blk block.Block) error {
+	if root := block.ConsentRoot(blk.Events); root != blk.ConsentRoot {
+		return fmt.Errorf("block %d: consent events do not match ConsentRoot", blk.Height)
+	}
+	seen := make(map[string]bool)
+	for _, evt := range blk.Events {
+		if !block.IsConsentEvent(evt) {
+			continue
+		}
+		p := evt.Consent
+		if p == nil || p.Type != evt.EventType {
+			return fmt.Errorf("block %d: consent event %s carries no %s transaction", blk.Height, evt.EventID, evt.EventType)
+		}
+		if evt.EventID != ids.NewID([]byte(p.TxID())) {
+			return fmt.Errorf("block %d: consent event %s does not match its transaction", blk.Height, evt.EventID)
+		}
+		key := consentKey(p)
+		if seen[key] {
+			return fmt.Errorf("block %d: repeated %s", blk.Height, key)
+		}
+		seen[key] = true
+		if err := blockchain.VerifyConsent(n.store, p, blk.Timestamp); err != nil {
+			return fmt.Errorf("block %d: %s: %v", blk.Height, p.Type, err)
+		}
+	}
+	return nil
+}
+
+// recordConsentEvents applies the consent transactions of a committed block
+func (n *Network) recordConsentEvents(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for _, evt := range blk.Events {
+		p := evt.Consent
+		if !block.IsConsentEvent(evt) || p == nil {
+			continue
+		}
+		if n.Mempool != nil {
+			n.Mempool.RemoveTx(p.TxID())
+		}
+		if err := blockchain.VerifyConsent(n.store, p, blk.Timestamp); err != nil {
+			fmt.Printf("[CONSENT] Not applying %s from block %d: %v\n", p.Type, blk.Height, err)
+			continue
+		}
+		if err := blockchain.ApplyConsent(n.store, p, blockID, blk.Height); err != nil {
+			fmt.Printf("[CONSENT] Failed to apply %s from block %d: %v\n", p.Type, blk.Height, err)
+			continue
+		}
+		fmt.Printf("[CONSENT] Applied %s for patient %s in block %d\n", p.Type, p.PatientDID(), blk.Height)
+	}
+}
+
+// revertConsentEvents undoes recordConsentEvents for a rolled-back block and returns its consent
+// transactions to the mempool
+func (n *Network) revertConsentEvents(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for i := len(blk.Events) - 1; i >= 0; i-- {
+		p := blk.Events[i].Consent
+		if !block.IsConsentEvent(blk.Events[i]) || p == nil {
+			continue
+		}
+		if err := blockchain.RevertConsent(n.store, p, blockID); err != nil {
+			fmt.Printf("[CONSENT] Failed to roll back %s from block %d: %v\n", p.Type, blk.Height, err)
+			continue
+		}
+		n.returnToMempool(p.TxID(), p, p.PatientDID())
+		fmt.Printf("[CONSENT] Rolled back %s for patient %s from block %d\n", p.Type, p.PatientDID(), blk.Height)
+	}
+}
@@ -0,0 +1,147 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/did"
+	"unicareos/core/mempool"
+	"unicareos/core/state"
+)
+
+// signedGrant returns a grant by the holder of patient letting org read labs for treatment
+func signedGrant(t *testing.T, patient ed25519.PrivateKey, org string) *block.ConsentPayload {
+	now := time.Now().UTC()
+	g := &block.ConsentGrant{
+		PatientDID: did.FromEd25519(patient.Public().(ed25519.PublicKey)),
+		Grantee:    block.Grantee{Type: block.GranteeOrganization, ID: org},
+		Scope:      []string{"lab_result"},
+		Purpose:    "treatment",
+		Expiry:     now.Add(time.Hour),
+		Timestamp:  now,
+	}
+	if err := g.Sign(patient); err != nil {
+		t.Fatal(err)
+	}
+	return &block.ConsentPayload{Type: block.ConsentGrantType, Grant: g}
+}
+
+func TestConsentTakesEffectFromTheBlockIncludingIt(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	pub, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 2, producer)
+	p := newFinalizerSet(t, 1, chain)[0]
+	p.PubKey, p.PrivKey = pub, producer
+	p.ProducersDynamic = map[string]struct{}{fmt.Sprintf("%x", pub): {}}
+	p.recentBlocks = make(map[string]struct{})
+	p.Mempool = mempool.NewMempool(10)
+	p.ChainState = &state.ChainState{StateDB: p.store}
+	if err := p.SetLatestBlockID(chain[1].BlockID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, patient, _ := ed25519.GenerateKey(nil)
+	grant := signedGrant(t, patient, "clinic-a")
+	patientDID := grant.PatientDID()
+	clinic := []block.Grantee{{Type: block.GranteeOrganization, ID: "clinic-a"}}
+	readable := func() bool {
+		return blockchain.FindConsent(p.store, patientDID, clinic, "lab_result", "treatment", time.Now()) != nil
+	}
+
+	if _, err := p.SubmitConsent(grant); err != nil {
+		t.Fatal(err)
+	}
+	if readable() {
+		t.Fatal("grant effective before a block included it")
+	}
+	if err := p.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if !readable() {
+		t.Fatal("grant not effective once included")
+	}
+	if blockchain.FindConsent(p.store, patientDID, clinic, "imaging", "treatment", time.Now()) != nil {
+		t.Error("grant covers a record type outside its scope")
+	}
+	if blockchain.FindConsent(p.store, patientDID, []block.Grantee{{Type: block.GranteeOrganization, ID: "clinic-b"}}, "lab_result", "", time.Now()) != nil {
+		t.Error("grant covers another organization")
+	}
+
+	revoke := &block.ConsentRevoke{ConsentID: grant.ConsentID(), PatientDID: patientDID, Timestamp: time.Now().UTC()}
+	if err := revoke.Sign(patient); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SubmitConsent(&block.ConsentPayload{Type: block.ConsentRevokeType, Revoke: revoke}); err != nil {
+		t.Fatal(err)
+	}
+	if !readable() {
+		t.Fatal("pending revocation already effective")
+	}
+	if err := p.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if readable() {
+		t.Fatal("grant still effective after the block including its revocation")
+	}
+	if rec, err := blockchain.GetConsent(p.store, grant.ConsentID()); err != nil || !rec.Revoked {
+		t.Fatalf("revocation not recorded: %+v, %v", rec, err)
+	}
+}
+
+func TestConsentEventsRejectedUnlessSignedByThePatient(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 2, producer)
+	n := newFinalizerSet(t, 1, chain)[0]
+	n.Mempool = mempool.NewMempool(10)
+
+	_, patient, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+	forged := signedGrant(t, patient, "clinic-a")
+	forged.Grant.Signature = ed25519.Sign(other, forged.Grant.SigningBytes())
+	if _, err := n.SubmitConsent(forged); err == nil {
+		t.Error("grant not signed by the patient admitted")
+	}
+	if err := n.verifyConsentEvents(consentBlock(chain[1], forged)); err == nil {
+		t.Error("block carrying a forged grant accepted")
+	}
+
+	grant := signedGrant(t, patient, "clinic-a")
+	stripped := eventBlock(chain[1])
+	stripped.ConsentRoot = block.ConsentRoot([]block.ChainedEvent{block.ConsentEvent(grant)})
+	if err := n.verifyConsentEvents(stripped); err == nil {
+		t.Error("block whose consent events were stripped accepted")
+	}
+
+	revoke := &block.ConsentRevoke{ConsentID: grant.ConsentID(), PatientDID: grant.PatientDID(), Timestamp: time.Now().UTC()}
+	revoke.Sign(patient)
+	if err := n.verifyConsentEvents(consentBlock(chain[1], &block.ConsentPayload{Type: block.ConsentRevokeType, Revoke: revoke})); err == nil {
+		t.Error("revocation of a grant not on chain accepted")
+	}
+
+	good := consentBlock(chain[1], grant)
+	if err := n.verifyConsentEvents(good); err != nil {
+		t.Fatal(err)
+	}
+	n.recordConsentEvents(good)
+	if err := n.verifyConsentEvents(consentBlock(good, grant)); err == nil {
+		t.Error("grant applied twice")
+	}
+}
+
+// consentBlock builds the child of parent carrying the consent transactions
+func consentBlock(parent block.Block, txs ...*block.ConsentPayload) block.Block {
+	var events []block.ChainedEvent
+	for _, p := range txs {
+		events = append(events, block.ConsentEvent(p))
+	}
+	b := eventBlock(parent, events...)
+	b.ConsentRoot = block.ConsentRoot(events)
+	b.BlockID = b.ComputeID()
+	return b
+}
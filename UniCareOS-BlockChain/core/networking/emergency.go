@@ -0,0 +1,224 @@
+package networking
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/types/ids"
+)
+
+// Break-glass emergency access.
+// A clinician-signed EmergencyAccess enters the mempool through SubmitEmergencyAccess. Producers include
+// it ahead of other transactions as a high-priority emergency_access event (committed to by
+// Block.EmergencyAccessRoot) once blockchain.VerifyEmergencyAccess accepts it against
+// EmergencyClinicians; every node verifies it again before accepting the block and, when the block is
+// committed, opens the access and its compliance review. A compliance officer listed in
+// ComplianceReviewers closes the review with a signed resolution submitted through SubmitEmergencyReview;
+// it is written as an emergency_review event, also committed to by EmergencyAccessRoot, and applied the
+// same way.
+
+// SubmitEmergencyAccess verifies a break-glass request, adds it to the mempool and gossips it
+func (n *Network) SubmitEmergencyAccess(a *block.EmergencyAccess) (string, error) {
+	if n.Mempool == nil {
+		return "", fmt.Errorf("no mempool")
+	}
+	if err := a.Verify(); err != nil {
+		return "", err
+	}
+	if did, ok := n.EmergencyClinicians[a.ProviderID]; !ok || did != a.ClinicianDID {
+		return "", fmt.Errorf("%s (%s) is not authorized for emergency access", a.ProviderID, a.ClinicianDID)
+	}
+	payload, err := json.Marshal(block.EmergencyAccessPayload{Type: block.EmergencyAccessType, EmergencyAccess: a})
+	if err != nil {
+		return "", err
+	}
+	tx := mempool.Transaction{TxID: a.TxID(), Payload: payload, Timestamp: n.Now().Unix(), Sender: a.ProviderID}
+	if res := n.Mempool.Admit(tx); !res.Accepted {
+		return "", fmt.Errorf("%s: %s", res.Class, res.Reason)
+	}
+	if n.Gossip != nil {
+		n.Gossip.BroadcastTx(tx)
+	}
+	fmt.Printf("\033[1;31m[EMERGENCY] Break-glass access %s by %s to %s's records submitted: %s\033[0m\n", a.AccessID, a.ProviderID, a.PatientDID, a.Reason)
+	return tx.TxID, nil
+}
+
+// SubmitEmergencyReview verifies a review resolution, adds it to the mempool and gossips it
+func (n *Network) SubmitEmergencyReview(r *block.EmergencyReviewResolution) (string, error) {
+	if n.Mempool == nil {
+		return "", fmt.Errorf("no mempool")
+	}
+	if err := blockchain.VerifyEmergencyReview(n.store, r, n.ComplianceReviewers); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(block.EmergencyReviewPayload{Type: block.EmergencyReviewType, Resolution: r})
+	if err != nil {
+		return "", err
+	}
+	tx := mempool.Transaction{TxID: r.TxID(), Payload: payload, Timestamp: n.Now().Unix(), Sender: r.Reviewer}
+	if res := n.Mempool.Admit(tx); !res.Accepted {
+		return "", fmt.Errorf("%s: %s", res.Class, res.Reason)
+	}
+	if n.Gossip != nil {
+		n.Gossip.BroadcastTx(tx)
+	}
+	fmt.Printf("[EMERGENCY] Review of emergency access %s as %s by %s submitted\n", r.AccessID, r.Outcome, r.Reviewer)
+	return tx.TxID, nil
+}
+
+// emergencyFirst orders break-glass requests ahead of the other pending transactions
+func emergencyFirst(txs []mempool.Transaction) []mempool.Transaction {
+	sort.SliceStable(txs, func(i, j int) bool {
+		_, ei := block.ParseEmergencyAccessPayload(txs[i].Payload)
+		_, ej := block.ParseEmergencyAccessPayload(txs[j].Payload)
+		return ei && !ej
+	})
+	return txs
+}
+
+// emergencyAccessResult classifies a break-glass request or review resolution that could not be included.
+// A resolution whose access is not on chain yet may be retried.
+func emergencyAccessResult(err error) mempool.AdmissionResult {
+	switch {
+	case errors.Is(err, blockchain.ErrEmergencyAccessDuplicate), errors.Is(err, blockchain.ErrEmergencyReviewClosed):
+		return mempool.Rejected(mempool.ErrorClassDuplicate, err.Error())
+	case errors.Is(err, blockchain.ErrEmergencyAccessUnknown):
+		return mempool.Rejected(mempool.ErrorClassRetryable, err.Error())
+	}
+	return mempool.Rejected(mempool.ErrorClassPermanent, err.Error())
+}
+
+// verifyEmergencyAccessEvents checks a block's emergency_access and emergency_review events before it is
+// accepted
+func (n *Network) verifyEmergencyAccessEvents(blk block.Block) error {
+	if root := block.EmergencyAccessRoot(blk.Events); root != blk.EmergencyAccessRoot {
+		return fmt.Errorf("block %d: emergency access events do not match EmergencyAccessRoot", blk.Height)
+	}
+	seen := make(map[string]bool)
+	reviewed := make(map[string]bool)
+	for _, evt := range blk.Events {
+		if evt.EventType == block.EmergencyReviewType {
+			if err := n.verifyEmergencyReviewEvent(blk, evt, reviewed); err != nil {
+				return err
+			}
+			continue
+		}
+		if evt.EventType != block.EmergencyAccessType {
+			continue
+		}
+		a := evt.EmergencyAccess
+		if a == nil {
+			return fmt.Errorf("block %d: emergency access event %s carries no request", blk.Height, evt.EventID)
+		}
+		if evt.EventID != ids.NewID([]byte(a.TxID())) {
+			return fmt.Errorf("block %d: emergency access event %s does not match its request", blk.Height, evt.EventID)
+		}
+		if seen[a.AccessID] {
+			return fmt.Errorf("block %d: repeated emergency access %s", blk.Height, a.AccessID)
+		}
+		seen[a.AccessID] = true
+		if err := blockchain.VerifyEmergencyAccess(n.store, a, n.EmergencyClinicians, blk.Timestamp); err != nil {
+			return fmt.Errorf("block %d: %v", blk.Height, err)
+		}
+	}
+	return nil
+}
+
+// verifyEmergencyReviewEvent checks one emergency_review event of blk; reviewed holds the accesses whose
+// reviews blk already closed
+func (n *Network) verifyEmergencyReviewEvent(blk block.Block, evt block.ChainedEvent, reviewed map[string]bool) error {
+	r := evt.EmergencyReview
+	if r == nil {
+		return fmt.Errorf("block %d: emergency review event %s carries no resolution", blk.Height, evt.EventID)
+	}
+	if evt.EventID != ids.NewID([]byte(r.TxID())) {
+		return fmt.Errorf("block %d: emergency review event %s does not match its resolution", blk.Height, evt.EventID)
+	}
+	if reviewed[r.AccessID] {
+		return fmt.Errorf("block %d: repeated review of emergency access %s", blk.Height, r.AccessID)
+	}
+	reviewed[r.AccessID] = true
+	if err := blockchain.VerifyEmergencyReview(n.store, r, n.ComplianceReviewers); err != nil {
+		return fmt.Errorf("block %d: %v", blk.Height, err)
+	}
+	return nil
+}
+
+// recordEmergencyAccessEvents opens the break-glass accesses of a committed block and their reviews, and
+// closes the reviews it resolves
+func (n *Network) recordEmergencyAccessEvents(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for _, evt := range blk.Events {
+		if r := evt.EmergencyReview; evt.EventType == block.EmergencyReviewType && r != nil {
+			n.recordEmergencyReview(blk, r)
+			continue
+		}
+		a := evt.EmergencyAccess
+		if evt.EventType != block.EmergencyAccessType || a == nil {
+			continue
+		}
+		if n.Mempool != nil {
+			n.Mempool.RemoveTx(a.TxID())
+		}
+		if err := blockchain.VerifyEmergencyAccess(n.store, a, n.EmergencyClinicians, blk.Timestamp); err != nil {
+			fmt.Printf("[EMERGENCY] Not applying emergency access %s from block %d: %v\n", a.AccessID, blk.Height, err)
+			continue
+		}
+		if err := blockchain.ApplyEmergencyAccess(n.store, a, blockID, blk.Height, blk.Timestamp); err != nil {
+			fmt.Printf("[EMERGENCY] Failed to apply emergency access %s from block %d: %v\n", a.AccessID, blk.Height, err)
+			continue
+		}
+		fmt.Printf("\033[1;31m[EMERGENCY] Break-glass access %s by %s to %s's records open until %s (block %d); review pending\033[0m\n",
+			a.AccessID, a.ProviderID, a.PatientDID, a.Expiry.Format("2006-01-02T15:04:05Z07:00"), blk.Height)
+	}
+}
+
+// recordEmergencyReview closes the review resolved by r in the committed block blk
+func (n *Network) recordEmergencyReview(blk block.Block, r *block.EmergencyReviewResolution) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	if n.Mempool != nil {
+		n.Mempool.RemoveTx(r.TxID())
+	}
+	if err := blockchain.VerifyEmergencyReview(n.store, r, n.ComplianceReviewers); err != nil {
+		fmt.Printf("[EMERGENCY] Not applying review of emergency access %s from block %d: %v\n", r.AccessID, blk.Height, err)
+		return
+	}
+	if _, err := blockchain.ResolveEmergencyReview(n.store, r, blockID); err != nil {
+		fmt.Printf("[EMERGENCY] Failed to apply review of emergency access %s from block %d: %v\n", r.AccessID, blk.Height, err)
+		return
+	}
+	fmt.Printf("[EMERGENCY] Review of emergency access %s closed as %s by %s in block %d\n", r.AccessID, r.Outcome, r.Reviewer, blk.Height)
+}
+
+// revertEmergencyAccessEvents undoes recordEmergencyAccessEvents for a rolled-back block and returns its
+// transactions to the mempool
+func (n *Network) revertEmergencyAccessEvents(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for i := len(blk.Events) - 1; i >= 0; i-- {
+		evt := blk.Events[i]
+		if r := evt.EmergencyReview; evt.EventType == block.EmergencyReviewType && r != nil {
+			if err := blockchain.ReopenEmergencyReview(n.store, r, blockID); err != nil {
+				fmt.Printf("[EMERGENCY] Failed to reopen review of emergency access %s from block %d: %v\n", r.AccessID, blk.Height, err)
+				continue
+			}
+			n.returnToMempool(r.TxID(), block.EmergencyReviewPayload{Type: block.EmergencyReviewType, Resolution: r}, r.Reviewer)
+			fmt.Printf("[EMERGENCY] Review of emergency access %s reopened; block %d rolled back\n", r.AccessID, blk.Height)
+			continue
+		}
+		a := evt.EmergencyAccess
+		if evt.EventType != block.EmergencyAccessType || a == nil {
+			continue
+		}
+		if err := blockchain.RevertEmergencyAccess(n.store, a, blockID); err != nil {
+			fmt.Printf("[EMERGENCY] Failed to roll back emergency access %s from block %d: %v\n", a.AccessID, blk.Height, err)
+			continue
+		}
+		n.returnToMempool(a.TxID(), block.EmergencyAccessPayload{Type: block.EmergencyAccessType, EmergencyAccess: a}, a.ProviderID)
+		fmt.Printf("[EMERGENCY] Emergency access %s rolled back with block %d\n", a.AccessID, blk.Height)
+	}
+}
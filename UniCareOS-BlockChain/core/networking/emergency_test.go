@@ -0,0 +1,219 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/did"
+	"unicareos/core/mempool"
+	"unicareos/core/state"
+)
+
+// signedEmergencyAccess returns a one-hour break-glass request by providerID signed with clinician
+func signedEmergencyAccess(t *testing.T, clinician ed25519.PrivateKey, providerID, patientDID string) *block.EmergencyAccess {
+	now := time.Now().UTC()
+	a := &block.EmergencyAccess{
+		PatientDID:   patientDID,
+		ProviderID:   providerID,
+		ClinicianDID: did.FromEd25519(clinician.Public().(ed25519.PublicKey)),
+		Reason:       "unconscious patient in ER",
+		Expiry:       now.Add(time.Hour),
+		Timestamp:    now,
+	}
+	if err := a.Sign(clinician); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// signedReview returns reviewer's resolution of the review of accessID signed with officer
+func signedReview(t *testing.T, officer ed25519.PrivateKey, reviewer, accessID, outcome string) *block.EmergencyReviewResolution {
+	r := &block.EmergencyReviewResolution{
+		AccessID:    accessID,
+		Outcome:     outcome,
+		Reviewer:    reviewer,
+		ReviewerDID: did.FromEd25519(officer.Public().(ed25519.PublicKey)),
+		Timestamp:   time.Now().UTC(),
+	}
+	if err := r.Sign(officer); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestEmergencyAccessIncludedFirstAndOpensReview(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	pub, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 2, producer)
+	p := newFinalizerSet(t, 1, chain)[0]
+	p.PubKey, p.PrivKey = pub, producer
+	p.ProducersDynamic = map[string]struct{}{fmt.Sprintf("%x", pub): {}}
+	p.recentBlocks = make(map[string]struct{})
+	p.Mempool = mempool.NewMempool(10)
+	p.ChainState = &state.ChainState{StateDB: p.store}
+	if err := p.SetLatestBlockID(chain[1].BlockID); err != nil {
+		t.Fatal(err)
+	}
+	_, clinician, _ := ed25519.GenerateKey(nil)
+	_, patient, _ := ed25519.GenerateKey(nil)
+	patientDID := did.FromEd25519(patient.Public().(ed25519.PublicKey))
+	p.EmergencyClinicians = map[string]string{"dr-1": did.FromEd25519(clinician.Public().(ed25519.PublicKey))}
+
+	if _, err := p.SubmitConsent(signedGrant(t, patient, "clinic-a")); err != nil {
+		t.Fatal(err)
+	}
+	_, impostor, _ := ed25519.GenerateKey(nil)
+	if _, err := p.SubmitEmergencyAccess(signedEmergencyAccess(t, impostor, "dr-1", patientDID)); err == nil {
+		t.Error("break-glass request signed by another key admitted")
+	}
+	if _, err := p.SubmitEmergencyAccess(signedEmergencyAccess(t, clinician, "dr-2", patientDID)); err == nil {
+		t.Error("break-glass request by an unlisted provider admitted")
+	}
+	a := signedEmergencyAccess(t, clinician, "dr-1", patientDID)
+	if _, err := p.SubmitEmergencyAccess(a); err != nil {
+		t.Fatal(err)
+	}
+	if blockchain.FindEmergencyAccess(p.store, patientDID, "dr-1", time.Now()) != nil {
+		t.Fatal("access open before a block included it")
+	}
+	if err := p.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	tip := p.GetLatestBlockID()
+	raw, err := p.store.GetBlock(tip[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	produced, _ := block.Deserialize(raw)
+	if len(produced.Events) != 2 || produced.Events[0].EventType != block.EmergencyAccessType || produced.Events[0].Priority != block.PriorityHigh {
+		t.Fatalf("break-glass event not included first with high priority: %+v", produced.Events)
+	}
+	if produced.EmergencyAccessRoot == "" || produced.ComputeID() != produced.BlockID {
+		t.Fatal("emergency access events are not committed to by the block ID")
+	}
+	rec := blockchain.FindEmergencyAccess(p.store, patientDID, "dr-1", time.Now())
+	if rec == nil || rec.Review.Status != blockchain.ReviewPending {
+		t.Fatalf("access not open with a pending review: %+v", rec)
+	}
+	if blockchain.FindEmergencyAccess(p.store, patientDID, "dr-1", a.Expiry) != nil {
+		t.Error("access still open at its expiry")
+	}
+	if pending := blockchain.PendingEmergencyReviews(p.store); len(pending) != 1 || pending[0].Access.AccessID != a.AccessID {
+		t.Fatalf("review item not created: %+v", pending)
+	}
+	if _, ok := p.Mempool.GetTx(a.TxID()); ok {
+		t.Error("included request still in the mempool")
+	}
+
+	// The review is closed by a compliance-signed resolution once a block includes it
+	_, officer, _ := ed25519.GenerateKey(nil)
+	p.ComplianceReviewers = map[string]string{"officer-1": did.FromEd25519(officer.Public().(ed25519.PublicKey))}
+	if _, err := p.SubmitEmergencyReview(signedReview(t, officer, "officer-2", a.AccessID, blockchain.ReviewJustified)); err == nil {
+		t.Error("review by an unlisted officer admitted")
+	}
+	if _, err := p.SubmitEmergencyReview(signedReview(t, clinician, "officer-1", a.AccessID, blockchain.ReviewJustified)); err == nil {
+		t.Error("review signed by another key admitted")
+	}
+	r := signedReview(t, officer, "officer-1", a.AccessID, blockchain.ReviewUnjustified)
+	if _, err := p.SubmitEmergencyReview(r); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := blockchain.GetEmergencyAccess(p.store, a.AccessID); rec.Review.Status != blockchain.ReviewPending {
+		t.Fatal("review closed before a block included the resolution")
+	}
+	if err := p.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+	reviewTip := p.GetLatestBlockID()
+	rec, _ = blockchain.GetEmergencyAccess(p.store, a.AccessID)
+	if rec.Review.Status != blockchain.ReviewUnjustified || rec.Review.Reviewer != "officer-1" || rec.Review.ResolvedIn != fmt.Sprintf("%x", reviewTip[:]) {
+		t.Fatalf("review not closed on chain: %+v", rec.Review)
+	}
+	if len(blockchain.PendingEmergencyReviews(p.store)) != 0 {
+		t.Error("resolved review still pending")
+	}
+	if _, err := p.SubmitEmergencyReview(signedReview(t, officer, "officer-1", a.AccessID, blockchain.ReviewJustified)); err == nil {
+		t.Error("closed review resolved again")
+	}
+}
+
+func TestEmergencyAccessEventsRejectedUnlessAuthorized(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 2, producer)
+	n := newFinalizerSet(t, 1, chain)[0]
+	_, clinician, _ := ed25519.GenerateKey(nil)
+	n.EmergencyClinicians = map[string]string{"dr-1": did.FromEd25519(clinician.Public().(ed25519.PublicKey))}
+	emergencyBlock := func(parent block.Block, as ...*block.EmergencyAccess) block.Block {
+		var events []block.ChainedEvent
+		for _, a := range as {
+			events = append(events, block.EmergencyAccessEvent(a))
+		}
+		b := eventBlock(parent, events...)
+		b.EmergencyAccessRoot = block.EmergencyAccessRoot(events)
+		b.BlockID = b.ComputeID()
+		return b
+	}
+
+	_, other, _ := ed25519.GenerateKey(nil)
+	if err := n.verifyEmergencyAccessEvents(emergencyBlock(chain[1], signedEmergencyAccess(t, other, "dr-1", "did:key:z6Mkpatient"))); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("access by an unauthorized key accepted: %v", err)
+	}
+	noReason := signedEmergencyAccess(t, clinician, "dr-1", "did:key:z6Mkpatient")
+	noReason.Reason = " "
+	noReason.Sign(clinician)
+	if err := n.verifyEmergencyAccessEvents(emergencyBlock(chain[1], noReason)); err == nil {
+		t.Error("access without a reason accepted")
+	}
+	long := signedEmergencyAccess(t, clinician, "dr-1", "did:key:z6Mkpatient")
+	long.Expiry = long.Timestamp.Add(block.MaxEmergencyAccessWindow + time.Minute)
+	long.Sign(clinician)
+	if err := n.verifyEmergencyAccessEvents(emergencyBlock(chain[1], long)); err == nil {
+		t.Error("access beyond the maximum window accepted")
+	}
+
+	a := signedEmergencyAccess(t, clinician, "dr-1", "did:key:z6Mkpatient")
+	stripped := eventBlock(chain[1])
+	stripped.EmergencyAccessRoot = block.EmergencyAccessRoot([]block.ChainedEvent{block.EmergencyAccessEvent(a)})
+	if err := n.verifyEmergencyAccessEvents(stripped); err == nil {
+		t.Error("block whose emergency access events were stripped accepted")
+	}
+	good := emergencyBlock(chain[1], a)
+	if err := n.verifyEmergencyAccessEvents(good); err != nil {
+		t.Fatal(err)
+	}
+	n.recordEmergencyAccessEvents(good)
+	if err := n.verifyEmergencyAccessEvents(emergencyBlock(good, a)); err == nil {
+		t.Error("access applied twice")
+	}
+
+	_, officer, _ := ed25519.GenerateKey(nil)
+	n.ComplianceReviewers = map[string]string{"officer-1": did.FromEd25519(officer.Public().(ed25519.PublicKey))}
+	reviewBlock := func(rs ...*block.EmergencyReviewResolution) block.Block {
+		var events []block.ChainedEvent
+		for _, r := range rs {
+			events = append(events, block.EmergencyReviewEvent(r))
+		}
+		b := eventBlock(good, events...)
+		b.EmergencyAccessRoot = block.EmergencyAccessRoot(events)
+		b.BlockID = b.ComputeID()
+		return b
+	}
+	if err := n.verifyEmergencyAccessEvents(reviewBlock(signedReview(t, other, "officer-1", a.AccessID, blockchain.ReviewJustified))); err == nil {
+		t.Error("review by an unauthorized key accepted")
+	}
+	justified := signedReview(t, officer, "officer-1", a.AccessID, blockchain.ReviewJustified)
+	if err := n.verifyEmergencyAccessEvents(reviewBlock(justified, signedReview(t, officer, "officer-1", a.AccessID, blockchain.ReviewUnjustified))); err == nil {
+		t.Error("block resolving one review twice accepted")
+	}
+	if err := n.verifyEmergencyAccessEvents(reviewBlock(justified)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,318 @@
+package networking
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/signer"
+	"unicareos/core/types"
+)
+
+// On-chain epoch finalization.
+// When a block closes an epoch, every node holding a key from FinalizerKeys computes the epoch Merkle
+// root from its own blocks, signs it and gossips the FinalizeEpochTx over /epoch_finalization.
+// Signatures for the same epoch and root share a TxID and merge in the pool. Once FinalizerQuorum keys
+// have signed, the next block producer includes the tx in EpochFinalizations (committed to by
+// Block.FinalizationRoot). Every node re-verifies the root and signatures before recording the epoch as
+// final. A second finalization of the same epoch, matching or conflicting, is rejected as
+// block.FinalizationStatusDuplicate and invalidates the block carrying it.
+
+const maxEpochFinalizationBytes = 64 << 10
+
+// epochPool holds finalizations waiting for quorum, keyed by TxID
+type epochPool struct {
+	mu      sync.Mutex
+	pending map[string]*types.FinalizeEpochTx
+}
+
+// EpochFinalizationStatus is a pending finalization with its signature progress
+type EpochFinalizationStatus struct {
+	types.FinalizeEpochTx
+	Signed   int  `json:"signed"`
+	Required int  `json:"required"`
+	Ready    bool `json:"ready"`
+}
+
+// finalizerQuorum returns the signatures required per epoch
+func (n *Network) finalizerQuorum() int {
+	if n.FinalizerQuorum > 0 {
+		return n.FinalizerQuorum
+	}
+	return blockchain.FinalizerQuorum(len(n.FinalizerKeys))
+}
+
+// isFinalizer reports whether this node holds one of the authorized finalizer keys
+func (n *Network) isFinalizer() bool {
+	pub, ok := signer.PublicKey(n.FinalizerKey)
+	if !ok {
+		return false
+	}
+	own := base64.StdEncoding.EncodeToString(pub)
+	for _, k := range n.FinalizerKeys {
+		if k == own {
+			return true
+		}
+	}
+	return false
+}
+
+// closeEpoch signs the finalization of a just-completed epoch (finalizers only) and gossips it
+func (n *Network) closeEpoch(epoch uint64) {
+	if !n.isFinalizer() {
+		return
+	}
+	tx, _, err := blockchain.FinalizeEpoch(n.store, n.ChainState, epoch, n.FinalizerKey, "")
+	if err != nil {
+		fmt.Printf("[EPOCH] Not signing epoch %d: %v\n", epoch, err)
+		return
+	}
+	if _, err := n.AddEpochFinalization(*tx); err != nil {
+		fmt.Printf("[EPOCH] Own finalization of epoch %d rejected: %v\n", epoch, err)
+		return
+	}
+	fmt.Printf("[EPOCH] Signed finalization of epoch %d (root %q)\n", epoch, tx.EpochSummaryHash)
+	n.relayEpochFinalization(tx.TxID)
+}
+
+// AddEpochFinalization merges a finalization and its valid signatures into the pool.
+// It returns true if the pool learned something new and should relay it.
+func (n *Network) AddEpochFinalization(tx types.FinalizeEpochTx) (bool, error) {
+	if err := tx.Validate(); err != nil {
+		return false, err
+	}
+	if existing, err := blockchain.GetEpochFinalization(n.store, tx.EpochNumber); err == nil {
+		if existing.TxID != tx.TxID {
+			return false, fmt.Errorf("%s: epoch %d was already finalized with a different root", block.FinalizationStatusDuplicate, tx.EpochNumber)
+		}
+		return false, nil // Already on chain; late gossip
+	}
+	valid := blockchain.ValidFinalizerSignatures(&tx, n.FinalizerKeys)
+	if len(valid) == 0 {
+		return false, fmt.Errorf("epoch %d finalization has no valid finalizer signature", tx.EpochNumber)
+	}
+	n.epochPool.mu.Lock()
+	defer n.epochPool.mu.Unlock()
+	if n.epochPool.pending == nil {
+		n.epochPool.pending = make(map[string]*types.FinalizeEpochTx)
+	}
+	p, ok := n.epochPool.pending[tx.TxID]
+	if !ok {
+		tx.Signatures = valid
+		tx.Status = string(block.FinalizationStatusPending)
+		n.epochPool.pending[tx.TxID] = &tx
+		return true, nil
+	}
+	changed := false
+	for _, s := range valid {
+		known := false
+		for _, have := range p.Signatures {
+			if have.PubKey == s.PubKey {
+				known = true
+				break
+			}
+		}
+		if !known {
+			p.Signatures = append(p.Signatures, s)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// EpochFinalizations lists pending finalizations with their signature progress
+func (n *Network) EpochFinalizations() []EpochFinalizationStatus {
+	required := n.finalizerQuorum()
+	n.epochPool.mu.Lock()
+	defer n.epochPool.mu.Unlock()
+	out := []EpochFinalizationStatus{}
+	for _, p := range n.epochPool.pending {
+		signed := len(blockchain.ValidFinalizerSignatures(p, n.FinalizerKeys))
+		out = append(out, EpochFinalizationStatus{FinalizeEpochTx: *p, Signed: signed, Required: required, Ready: signed >= required})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].EpochNumber != out[j].EpochNumber {
+			return out[i].EpochNumber < out[j].EpochNumber
+		}
+		return out[i].TxID < out[j].TxID
+	})
+	return out
+}
+
+// readyEpochFinalizations returns quorum-signed finalizations of epochs before epoch, at most one per epoch
+func (n *Network) readyEpochFinalizations(epoch uint64) []types.FinalizeEpochTx {
+	var out []types.FinalizeEpochTx
+	seen := make(map[uint64]bool)
+	for _, p := range n.EpochFinalizations() {
+		if !p.Ready || p.EpochNumber >= epoch || seen[p.EpochNumber] {
+			continue
+		}
+		tx := p.FinalizeEpochTx
+		tx.Signatures = blockchain.ValidFinalizerSignatures(&tx, n.FinalizerKeys)
+		if status, _ := blockchain.VerifyEpochFinalization(n.store, &tx, n.FinalizerKeys, n.finalizerQuorum()); status != block.FinalizationStatusFinalized {
+			continue
+		}
+		seen[tx.EpochNumber] = true
+		out = append(out, tx)
+	}
+	return out
+}
+
+// verifyEpochFinalizations checks a block's epoch finalizations before it is accepted
+func (n *Network) verifyEpochFinalizations(blk block.Block) error {
+	if root := block.EpochFinalizationsRoot(blk.EpochFinalizations); root != blk.FinalizationRoot {
+		return fmt.Errorf("block %d: epoch finalizations do not match FinalizationRoot", blk.Height)
+	}
+	seen := make(map[uint64]bool)
+	for i := range blk.EpochFinalizations {
+		tx := &blk.EpochFinalizations[i]
+		if seen[tx.EpochNumber] {
+			return fmt.Errorf("block %d: %s finalization of epoch %d", blk.Height, block.FinalizationStatusDuplicate, tx.EpochNumber)
+		}
+		seen[tx.EpochNumber] = true
+		if tx.EpochNumber >= blk.Epoch {
+			return fmt.Errorf("block %d: epoch %d is not complete", blk.Height, tx.EpochNumber)
+		}
+		if status, err := blockchain.VerifyEpochFinalization(n.store, tx, n.FinalizerKeys, n.finalizerQuorum()); status != block.FinalizationStatusFinalized {
+			return fmt.Errorf("block %d: %s: %v", blk.Height, status, err)
+		}
+	}
+	return nil
+}
+
+// recordEpochFinalizations marks the epochs finalized by an accepted block
+func (n *Network) recordEpochFinalizations(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for _, tx := range blk.EpochFinalizations {
+		tx.Status = string(block.FinalizationStatusFinalized)
+		tx.IncludedIn = blockID
+		if err := blockchain.SaveEpochFinalization(n.store, &tx); err != nil {
+			fmt.Printf("[EPOCH] Failed to record finalization of epoch %d: %v\n", tx.EpochNumber, err)
+			continue
+		}
+		n.epochPool.mu.Lock()
+		for id, p := range n.epochPool.pending {
+			if p.EpochNumber == tx.EpochNumber {
+				delete(n.epochPool.pending, id)
+			}
+		}
+		n.epochPool.mu.Unlock()
+		fmt.Printf("\033[33m[EPOCH FINALIZED] Epoch %d finalized on chain in block %d with %d finalizer signature(s)\033[0m\n", tx.EpochNumber, blk.Height, len(tx.Signatures))
+	}
+}
+
+// revertEpochFinalizations undoes recordEpochFinalizations for a rolled-back block; its finalizations
+// return to the pool for inclusion in another block
+func (n *Network) revertEpochFinalizations(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for i := len(blk.EpochFinalizations) - 1; i >= 0; i-- {
+		tx := blk.EpochFinalizations[i]
+		if err := blockchain.DeleteEpochFinalization(n.store, tx.EpochNumber, blockID); err != nil {
+			fmt.Printf("[EPOCH] Failed to roll back finalization of epoch %d: %v\n", tx.EpochNumber, err)
+			continue
+		}
+		if _, err := n.AddEpochFinalization(tx); err != nil {
+			fmt.Printf("[EPOCH] Finalization of epoch %d not returned to the pool: %v\n", tx.EpochNumber, err)
+		}
+		fmt.Printf("[EPOCH] Finalization of epoch %d rolled back with block %d\n", tx.EpochNumber, blk.Height)
+	}
+}
+
+// epochCommitted runs after a block is committed: it counts the block towards the epoch and, if the
+// block closes an epoch, signs that epoch. Caller must not hold n.lock.
+func (n *Network) epochCommitted(blk block.Block) {
+	n.countEpochBlock()
+	if n.EpochBlockCount > 0 && blk.Height > 0 && blk.Height%uint64(n.EpochBlockCount) == 0 {
+		n.closeEpoch((blk.Height - 1) / uint64(n.EpochBlockCount))
+	}
+}
+
+// countEpochBlock advances the persisted epoch counters by one committed block
+func (n *Network) countEpochBlock() {
+	if n.ChainState == nil {
+		return
+	}
+	n.ChainState.BlocksInEpoch++
+	if n.ChainState.BlocksInEpoch >= uint64(n.EpochBlockCount) { // epoch boundary
+		n.ChainState.Epoch++
+		n.ChainState.BlocksInEpoch = 0
+	}
+	if err := n.ChainState.SaveEpochState(); err != nil {
+		fmt.Printf("[EPOCH] Failed to persist epoch state: %v\n", err)
+	}
+}
+
+// uncountEpochBlock undoes countEpochBlock for a rolled-back block. Pending signatures over an epoch the
+// block closed stay pooled: readyEpochFinalizations only includes one whose root the new chain reproduces.
+func (n *Network) uncountEpochBlock() {
+	if n.ChainState == nil {
+		return
+	}
+	if n.ChainState.BlocksInEpoch == 0 && n.ChainState.Epoch > 0 { // back across the epoch boundary
+		n.ChainState.Epoch--
+		n.ChainState.BlocksInEpoch = uint64(n.EpochBlockCount)
+	}
+	if n.ChainState.BlocksInEpoch > 0 {
+		n.ChainState.BlocksInEpoch--
+	}
+	if err := n.ChainState.SaveEpochState(); err != nil {
+		fmt.Printf("[EPOCH] Failed to persist epoch state: %v\n", err)
+	}
+}
+
+// relayEpochFinalization gossips a pending finalization (with every signature we hold) to peers
+func (n *Network) relayEpochFinalization(txID string) {
+	n.epochPool.mu.Lock()
+	p, ok := n.epochPool.pending[txID]
+	var data []byte
+	if ok {
+		data, _ = json.Marshal(p)
+	}
+	n.epochPool.mu.Unlock()
+	if !ok {
+		return
+	}
+	for _, peer := range n.Peers() {
+		p := peer
+		n.goAsync(func() {
+			url := PeerURL(p.Address, "/epoch_finalization")
+			resp, err := n.peerHTTP().Post(url, "application/json", bytes.NewReader(data))
+			if err != nil {
+				fmt.Printf("[EPOCH] Error sending epoch finalization to %s: %v\n", url, err)
+				return
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+// HandleEpochFinalization receives a gossiped epoch finalization from a peer
+func (n *Network) HandleEpochFinalization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	address, pub := n.requestIdentity(r)
+	var tx types.FinalizeEpochTx
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEpochFinalizationBytes)).Decode(&tx); err != nil {
+		n.PenalizePeer(address, pub, decodeOffense(err), "epoch finalization: "+err.Error())
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	changed, err := n.AddEpochFinalization(tx)
+	if err != nil {
+		n.PenalizePeer(address, pub, OffenseMalformedMessage, "epoch finalization: "+err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if changed {
+		n.goAsync(func() { n.relayEpochFinalization(tx.TxID) })
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,145 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/types"
+)
+
+// newFinalizerSet returns count finalizer nodes, each with its own copy of chain and a shared key set
+func newFinalizerSet(t *testing.T, count int, chain []block.Block) []*Network {
+	var keys []string
+	var privs []ed25519.PrivateKey
+	for i := 0; i < count; i++ {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		keys = append(keys, base64.StdEncoding.EncodeToString(pub))
+		privs = append(privs, priv)
+	}
+	var nodes []*Network
+	for _, priv := range privs {
+		nodes = append(nodes, &Network{store: newTestStore(t, chain), FinalizerKeys: keys, FinalizerKey: priv, EpochBlockCount: len(chain) - 1})
+	}
+	return nodes
+}
+
+func finalizationBlock(height, epoch uint64, txs []types.FinalizeEpochTx) block.Block {
+	b := block.Block{Height: height, Epoch: epoch, EpochFinalizations: txs, FinalizationRoot: block.EpochFinalizationsRoot(txs)}
+	b.BlockID = b.ComputeID()
+	return b
+}
+
+func TestEpochFinalizedOnChainOnlyWithQuorum(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	f := newFinalizerSet(t, 3, buildTestChain(t, 5, producer)) // Heights 1-4 close epoch 0
+
+	f[0].closeEpoch(0)
+	pending := f[0].EpochFinalizations()
+	if len(pending) != 1 || pending[0].Signed != 1 || pending[0].Required != 3 || pending[0].Ready {
+		t.Fatalf("expected one pending finalization with 1 of 3 signatures, got %+v", pending)
+	}
+	if ready := f[0].readyEpochFinalizations(1); len(ready) != 0 {
+		t.Fatalf("finalization without quorum is ready: %+v", ready)
+	}
+	underSigned := finalizationBlock(5, 1, []types.FinalizeEpochTx{pending[0].FinalizeEpochTx})
+	if err := f[1].verifyEpochFinalizations(underSigned); err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("under-signed finalization accepted: %v", err)
+	}
+
+	// The other finalizers close the same epoch and gossip their signatures to f[0]
+	for _, n := range f[1:] {
+		n.closeEpoch(0)
+		if changed, err := f[0].AddEpochFinalization(n.EpochFinalizations()[0].FinalizeEpochTx); err != nil || !changed {
+			t.Fatalf("signature not merged: changed=%v err=%v", changed, err)
+		}
+	}
+	if ready := f[0].readyEpochFinalizations(0); len(ready) != 0 {
+		t.Fatal("finalization of an incomplete epoch is ready")
+	}
+	ready := f[0].readyEpochFinalizations(1)
+	if len(ready) != 1 || len(ready[0].Signatures) != 3 {
+		t.Fatalf("expected one finalization with 3 signatures, got %+v", ready)
+	}
+
+	stripped := finalizationBlock(5, 1, nil)
+	stripped.FinalizationRoot = block.EpochFinalizationsRoot(ready)
+	if err := f[1].verifyEpochFinalizations(stripped); err == nil {
+		t.Error("block whose finalizations were stripped accepted")
+	}
+	early := finalizationBlock(4, 0, ready)
+	if err := f[1].verifyEpochFinalizations(early); err == nil {
+		t.Error("finalization included inside the epoch it finalizes")
+	}
+
+	good := finalizationBlock(5, 1, ready)
+	for _, n := range f {
+		if err := n.verifyEpochFinalizations(good); err != nil {
+			t.Fatal(err)
+		}
+		n.recordEpochFinalizations(good)
+		rec, err := blockchain.GetEpochFinalization(n.store, 0)
+		if err != nil || rec.Status != string(block.FinalizationStatusFinalized) || rec.TxID != ready[0].TxID {
+			t.Fatalf("epoch 0 not recorded as finalized: %+v, %v", rec, err)
+		}
+		if len(n.EpochFinalizations()) != 0 {
+			t.Error("finalized epoch still pending")
+		}
+	}
+
+	again := finalizationBlock(6, 1, ready)
+	if err := f[1].verifyEpochFinalizations(again); err == nil || !strings.Contains(err.Error(), string(block.FinalizationStatusDuplicate)) {
+		t.Errorf("duplicate finalization not rejected as duplicate: %v", err)
+	}
+	conflicting := types.NewFinalizeEpochTx(0, strings.Repeat("ab", 32))
+	for _, n := range f {
+		blockchain.SignEpochFinalization(conflicting, n.FinalizerKey)
+	}
+	status, err := blockchain.VerifyEpochFinalization(f[1].store, conflicting, f[1].FinalizerKeys, 3)
+	if status != block.FinalizationStatusDuplicate || err == nil {
+		t.Errorf("conflicting finalization: status %s, err %v", status, err)
+	}
+	if _, err := f[2].AddEpochFinalization(*conflicting); err == nil {
+		t.Error("conflicting finalization accepted into the pool")
+	}
+}
+
+func TestEpochFinalizationRejectsForeignAndTamperedSignatures(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	f := newFinalizerSet(t, 3, buildTestChain(t, 5, producer))
+	root, err := blockchain.ComputeEpochMerkleRoot(0, f[0].store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, outsider, _ := ed25519.GenerateKey(nil)
+	tx := types.NewFinalizeEpochTx(0, root)
+	blockchain.SignEpochFinalization(tx, outsider)
+	if _, err := f[0].AddEpochFinalization(*tx); err == nil {
+		t.Error("finalization signed only by an outsider accepted into the pool")
+	}
+	for _, n := range f {
+		blockchain.SignEpochFinalization(tx, n.FinalizerKey)
+	}
+	if status, err := blockchain.VerifyEpochFinalization(f[0].store, tx, f[0].FinalizerKeys, 3); status != block.FinalizationStatusFailed || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("finalization carrying an outsider signature: status %s, err %v", status, err)
+	}
+
+	tampered := types.NewFinalizeEpochTx(0, root)
+	for _, n := range f {
+		blockchain.SignEpochFinalization(tampered, n.FinalizerKey)
+	}
+	tampered.EpochSummaryHash = strings.Repeat("cd", 32)
+	if status, _ := blockchain.VerifyEpochFinalization(f[0].store, tampered, f[0].FinalizerKeys, 3); status != block.FinalizationStatusFailed {
+		t.Errorf("tampered root: status %s", status)
+	}
+	tampered.TxID = tampered.ComputeTxID()
+	if status, err := blockchain.VerifyEpochFinalization(f[0].store, tampered, f[0].FinalizerKeys, 1); status != block.FinalizationStatusFailed || err == nil {
+		t.Errorf("root that does not match the local chain: status %s, err %v", status, err)
+	}
+}
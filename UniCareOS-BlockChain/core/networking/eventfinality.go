@@ -0,0 +1,260 @@
+package networking
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/core/signer"
+	"unicareos/types/ids"
+)
+
+// Per-event finalization.
+// The node that accepts a medical record over its API queues it here; every other node holds it in its
+// mempool once gossip delivers it. Once a committed block includes the record, each node holding a
+// finalizer key looks up the submission matching the event's submissionHash, validates it with its
+// block.Finalizer, signs a FinalizeEventTx over the real block hash and epoch, and submits it to the
+// mempool with the record replaced by its digest. The next producer writes it as a finalize_event event (committed to by
+// Block.EventFinalizationRoot); every node verifies it with blockchain.VerifyEventFinalization before
+// indexing the original event as finalized. Finalizing an event twice invalidates the block.
+
+// maxQueuedFinalizationAge bounds how long a submission waits for its block before it is forgotten
+const maxQueuedFinalizationAge = 24 * time.Hour
+
+// finalizationQueue holds accepted submissions awaiting inclusion, keyed by their future event ID
+type finalizationQueue struct {
+	mu      sync.Mutex
+	pending map[string]queuedFinalization
+}
+
+type queuedFinalization struct {
+	payload []byte
+	queued  time.Time
+}
+
+// QueueEventFinalization registers an accepted submission payload for finalization once a block includes
+// it, and returns the ID its medical_record event will have.
+func (n *Network) QueueEventFinalization(payload []byte) (string, error) {
+	var submission block.MedicalRecordSubmission
+	if err := json.Unmarshal(payload, &submission); err != nil {
+		return "", err
+	}
+	eventID := block.SubmissionEventID(submission).String()
+	if n.Finalizer == nil {
+		return eventID, nil
+	}
+	n.finalizations.mu.Lock()
+	defer n.finalizations.mu.Unlock()
+	if n.finalizations.pending == nil {
+		n.finalizations.pending = make(map[string]queuedFinalization)
+	}
+	n.finalizations.pending[eventID] = queuedFinalization{payload: payload, queued: n.Now()}
+	return eventID, nil
+}
+
+// submitEventFinalizations signs and submits finalizations for the records included in blk
+func (n *Network) submitEventFinalizations(blk block.Block) {
+	var records []block.ChainedEvent
+	payloads := make(map[string][]byte) // SubmissionHash -> submission payload
+	n.finalizations.mu.Lock()
+	for _, evt := range blk.Events {
+		if evt.EventType != "medical_record" {
+			continue
+		}
+		records = append(records, evt)
+		id := evt.EventID.String()
+		if q, ok := n.finalizations.pending[id]; ok {
+			payloads[submissionHash(q.payload)] = q.payload
+			delete(n.finalizations.pending, id)
+		}
+	}
+	for id, q := range n.finalizations.pending {
+		if n.Now().Sub(q.queued) > maxQueuedFinalizationAge {
+			delete(n.finalizations.pending, id)
+		}
+	}
+	n.finalizations.mu.Unlock()
+	if len(records) == 0 || n.Finalizer == nil || !n.isFinalizer() {
+		return
+	}
+	// Records submitted through other nodes reached us by gossip
+	if len(payloads) < len(records) && n.Mempool != nil {
+		for _, tx := range n.Mempool.GetAllTxs() {
+			if h := submissionHash(tx.Payload); h != "" {
+				if _, ok := payloads[h]; !ok {
+					payloads[h] = tx.Payload
+				}
+			}
+		}
+	}
+	pub, _ := signer.PublicKey(n.FinalizerKey)
+	own := base64.StdEncoding.EncodeToString(pub)
+	blockHash := fmt.Sprintf("%x", blk.BlockID[:])
+	for _, evt := range records {
+		eventID := evt.EventID.String()
+		payload, ok := payloads[evt.SubmissionHash]
+		if evt.SubmissionHash == "" || !ok {
+			fmt.Printf("[FINALIZE] Not finalizing event %s: submission not known\n", eventID)
+			continue
+		}
+		tx := &block.FinalizeEventTx{
+			TxID:                  block.FinalizeEventTxID(eventID, blockHash),
+			EventID:               eventID,
+			SubmitMedicalRecordTx: payload,
+			Block:                 block.BlockReference{BlockHash: blockHash, Epoch: blk.Epoch, Height: blk.Height},
+			Timestamp:             n.Now().UTC(),
+			Status:                block.FinalizationStatusPending,
+		}
+		if err := n.Finalizer.FinalizeEvent(tx, own); err != nil {
+			fmt.Printf("[FINALIZE] Not finalizing event %s: %v\n", eventID, err)
+			continue
+		}
+		tx.SubmitMedicalRecordTx = block.SubmissionDigest(payload)
+		if err := n.SubmitEventFinalization(tx); err != nil {
+			fmt.Printf("[FINALIZE] Finalization of event %s not submitted: %v\n", eventID, err)
+		}
+	}
+}
+
+// submissionHash returns the SubmissionHash of a medical record submission payload ("" for other payloads)
+func submissionHash(payload []byte) string {
+	var submission block.MedicalRecordSubmission
+	if err := json.Unmarshal(payload, &submission); err != nil || submission.Record == nil {
+		return ""
+	}
+	return block.SubmissionHash(submission)
+}
+
+// SubmitEventFinalization adds a signed FinalizeEventTx to the mempool and gossips it. The mempool TxID
+// is the hash of the whole tx, so a forged copy sharing its TxID cannot crowd out the genuine one.
+func (n *Network) SubmitEventFinalization(tx *block.FinalizeEventTx) error {
+	if n.Mempool == nil {
+		return fmt.Errorf("no mempool")
+	}
+	payload, err := json.Marshal(block.FinalizeEventPayload{Type: block.FinalizeEventType, FinalizeEvent: tx})
+	if err != nil {
+		return err
+	}
+	mtx := mempool.Transaction{TxID: block.HashFinalizeEventTx(tx), Payload: payload, Timestamp: n.Now().Unix()}
+	if res := n.Mempool.Admit(mtx); !res.Accepted {
+		return fmt.Errorf("%s: %s", res.Class, res.Reason)
+	}
+	if n.Gossip != nil {
+		n.Gossip.BroadcastTx(mtx)
+	}
+	fmt.Printf("[FINALIZE] Submitted finalization %s of event %s in block %s\n", tx.TxID, tx.EventID, tx.Block.BlockHash)
+	return nil
+}
+
+// eventFinalizationResult classifies a finalization that could not be included: one already on chain is
+// dropped, one whose block we have not seen may be retried.
+func eventFinalizationResult(status block.FinalizationStatus, err error) mempool.AdmissionResult {
+	switch status {
+	case block.FinalizationStatusDuplicate:
+		return mempool.Rejected(mempool.ErrorClassDuplicate, err.Error())
+	case block.FinalizationStatusPending:
+		return mempool.Rejected(mempool.ErrorClassRetryable, err.Error())
+	}
+	return mempool.Rejected(mempool.ErrorClassPermanent, err.Error())
+}
+
+// verifyEventFinalizations checks a block's finalize_event events before it is accepted
+func (n *Network) verifyEventFinalizations(blk block.Block) error {
+	if root := block.EventFinalizationsRoot(blk.Events); root != blk.EventFinalizationRoot {
+		return fmt.Errorf("block %d: finalize events do not match EventFinalizationRoot", blk.Height)
+	}
+	seen := make(map[string]bool)
+	for _, evt := range blk.Events {
+		if evt.EventType != block.FinalizeEventType {
+			continue
+		}
+		tx := evt.FinalizeTx
+		if tx == nil {
+			return fmt.Errorf("block %d: finalize event %s carries no transaction", blk.Height, evt.EventID)
+		}
+		if evt.EventID != ids.NewID([]byte(tx.TxID)) {
+			return fmt.Errorf("block %d: finalize event %s does not match its transaction", blk.Height, evt.EventID)
+		}
+		if seen[tx.EventID] {
+			return fmt.Errorf("block %d: %s finalization of event %s", blk.Height, block.FinalizationStatusDuplicate, tx.EventID)
+		}
+		seen[tx.EventID] = true
+		if _, status, err := blockchain.VerifyEventFinalization(n.store, tx, n.FinalizerKeys); status != block.FinalizationStatusFinalized {
+			return fmt.Errorf("block %d: %s: %v", blk.Height, status, err)
+		}
+	}
+	return nil
+}
+
+// recordEventFinalizations indexes the events finalized by an accepted block
+func (n *Network) recordEventFinalizations(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for _, evt := range blk.Events {
+		tx := evt.FinalizeTx
+		if evt.EventType != block.FinalizeEventType || tx == nil {
+			continue
+		}
+		if n.Mempool != nil {
+			n.Mempool.RemoveTx(block.HashFinalizeEventTx(tx))
+		}
+		signer, _, _ := blockchain.VerifyEventFinalization(n.store, tx, n.FinalizerKeys)
+		rec := &blockchain.EventFinalization{
+			EventID:    tx.EventID,
+			TxID:       tx.TxID,
+			BlockHash:  tx.Block.BlockHash,
+			IncludedIn: blockID,
+			Epoch:      blk.Epoch,
+			Finalizer:  signer,
+		}
+		if err := blockchain.SaveEventFinalization(n.store, rec); err != nil {
+			fmt.Printf("[FINALIZE] Failed to record finalization of event %s: %v\n", tx.EventID, err)
+			continue
+		}
+		n.ChainState.MarkEventFinalized(tx.EventID, tx.TxID)
+		fmt.Printf("\033[1;34m[FINALIZED] Event %s finalized on chain in block %d\033[0m\n", tx.EventID, blk.Height)
+	}
+}
+
+// revertEventFinalizations undoes recordEventFinalizations for a rolled-back block and returns its
+// finalizations to the mempool
+func (n *Network) revertEventFinalizations(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for i := len(blk.Events) - 1; i >= 0; i-- {
+		tx := blk.Events[i].FinalizeTx
+		if blk.Events[i].EventType != block.FinalizeEventType || tx == nil {
+			continue
+		}
+		if err := blockchain.DeleteEventFinalization(n.store, tx.EventID, blockID); err != nil {
+			fmt.Printf("[FINALIZE] Failed to roll back finalization of event %s: %v\n", tx.EventID, err)
+			continue
+		}
+		n.ChainState.UnmarkEventFinalized(tx.EventID)
+		n.returnToMempool(block.HashFinalizeEventTx(tx), block.FinalizeEventPayload{Type: block.FinalizeEventType, FinalizeEvent: tx}, "")
+		fmt.Printf("[FINALIZE] Finalization of event %s rolled back with block %d\n", tx.EventID, blk.Height)
+	}
+}
+
+// blockCommitted runs after a block is committed: it applies the block's sections (blockSections), then
+// advances the epoch and submits finalizations of the records the block included.
+// Caller must not hold n.lock.
+func (n *Network) blockCommitted(blk block.Block) {
+	for _, sec := range blockSections {
+		sec.commit(n, blk)
+	}
+	n.epochCommitted(blk)
+	n.submitEventFinalizations(blk)
+}
+
+// blockUncommitted undoes blockCommitted for the tip when a reorg rolls it back: the epoch counters, then
+// the sections in reverse order. Caller must hold commitMu and not n.lock.
+func (n *Network) blockUncommitted(blk block.Block) {
+	n.uncountEpochBlock()
+	for i := len(blockSections) - 1; i >= 0; i-- {
+		blockSections[i].undo(n, blk)
+	}
+}
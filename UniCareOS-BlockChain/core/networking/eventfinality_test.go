@@ -0,0 +1,304 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/core/signer"
+	"unicareos/core/state"
+	"unicareos/core/validation"
+	"unicareos/types/ids"
+)
+
+// testSubmission is the submission behind the medical record of recordChain
+func testSubmission() block.MedicalRecordSubmission {
+	var record map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"recordId": "123e4567-e89b-12d3-a456-426614174000", "patientId": "SE9TUDEyMzQ1", "patientDID": "did:example:123456abcdef",
+		"providerId": "PROV123", "schemaVersion": "1.0", "recordType": "lab_result",
+		"docHash": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "issuedAt": "2025-05-22T18:00:00Z",
+		"signedBy": "PROV123", "consentStatus": "granted", "dataProvenance": "hospital-system", "retentionPolicy": "7 years",
+		"encryptionContext": {"algorithm": "AES-GCM", "iv": "YWJjZGVmZ2hpamtsbW5vcA==", "tag": "YWJjZGVmZ2hpamtsbW5vcA=="},
+		"payloadSignature": "YWJjZGVmZ2hpamtsbW5vcA=="}`), &record)
+	return block.MedicalRecordSubmission{Record: record, WalletAddress: "0xprovider", SubmissionTimestamp: time.Unix(1700000050, 0).UTC()}
+}
+
+// recordEvent is the medical_record event a block writes for submission
+func recordEvent(submission block.MedicalRecordSubmission) block.ChainedEvent {
+	return block.ChainedEvent{
+		EventID:        block.SubmissionEventID(submission),
+		EventType:      "medical_record",
+		Timestamp:      submission.SubmissionTimestamp,
+		SubmissionHash: block.SubmissionHash(submission),
+	}
+}
+
+// recordChain returns a chain whose block at height 2 (epoch 0 of 2-block epochs) includes a medical record
+func recordChain(t *testing.T, producer ed25519.PrivateKey) ([]block.Block, string) {
+	chain := buildTestChain(t, 2, producer)
+	evt := recordEvent(testSubmission())
+	return append(chain, eventBlock(chain[1], evt)), evt.EventID.String()
+}
+
+// eventBlock builds the child of parent carrying events
+func eventBlock(parent block.Block, events ...block.ChainedEvent) block.Block {
+	b := block.Block{
+		Version:   "1.0",
+		Height:    parent.Height + 1,
+		PrevHash:  fmt.Sprintf("%x", parent.BlockID[:]),
+		Timestamp: parent.Timestamp.Add(time.Second),
+		Epoch:     parent.Height / 2,
+		Events:    events,
+	}
+	b.EventFinalizationRoot = block.EventFinalizationsRoot(events)
+	b.BlockID = b.ComputeID()
+	return b
+}
+
+// signedEventFinalization finalizes eventID in blk with key
+func signedEventFinalization(key signer.Signer, eventID string, blk block.Block) *block.FinalizeEventTx {
+	hash := fmt.Sprintf("%x", blk.BlockID[:])
+	tx := &block.FinalizeEventTx{
+		TxID:                  block.FinalizeEventTxID(eventID, hash),
+		EventID:               eventID,
+		SubmitMedicalRecordTx: submissionDigest(testSubmission()),
+		Block:                 block.BlockReference{BlockHash: hash, Epoch: blk.Epoch, Height: blk.Height},
+		Timestamp:             time.Unix(1700000100, 0).UTC(),
+		Status:                block.FinalizationStatusFinalized,
+	}
+	sig, _ := signer.Sign(key, []byte(tx.TxID+hash))
+	tx.FinalizerSignature = base64.StdEncoding.EncodeToString(sig)
+	return tx
+}
+
+func submissionDigest(submission block.MedicalRecordSubmission) json.RawMessage {
+	payload, _ := json.Marshal(submission)
+	return block.SubmissionDigest(payload)
+}
+
+func TestEventFinalizationIncludedByProducerAndIndexed(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	pub, producer, _ := ed25519.GenerateKey(nil)
+	chain, eventID := recordChain(t, producer)
+	f := newFinalizerSet(t, 3, chain)
+	p := f[0]
+	p.PubKey, p.PrivKey = pub, producer
+	p.ProducersDynamic = map[string]struct{}{fmt.Sprintf("%x", pub): {}}
+	p.recentBlocks = make(map[string]struct{})
+	p.Mempool = mempool.NewMempool(10)
+	p.ChainState = &state.ChainState{StateDB: p.store}
+	for _, n := range f[:2] {
+		if err := n.SetLatestBlockID(chain[2].BlockID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, outsider, _ := ed25519.GenerateKey(nil)
+	forged := signedEventFinalization(outsider, eventID, chain[2]) // Same TxID, foreign signature
+	if err := p.SubmitEventFinalization(forged); err != nil {
+		t.Fatal(err)
+	}
+	tx := signedEventFinalization(p.FinalizerKey, eventID, chain[2])
+	if err := p.SubmitEventFinalization(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SubmitEventFinalization(tx); err == nil {
+		t.Error("same finalization admitted twice")
+	}
+	if err := p.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	tip := p.GetLatestBlockID()
+	raw, err := p.store.GetBlock(tip[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	produced, _ := block.Deserialize(raw)
+	if len(produced.Events) != 1 || produced.Events[0].FinalizeTx == nil || produced.Events[0].FinalizeTx.TxID != tx.TxID {
+		t.Fatalf("produced block does not carry exactly the authorized finalization: %+v", produced.Events)
+	}
+	if produced.EventFinalizationRoot == "" || produced.ComputeID() != produced.BlockID {
+		t.Fatal("finalize events are not committed to by the block ID")
+	}
+	if _, ok := p.Mempool.GetTx(block.HashFinalizeEventTx(tx)); ok {
+		t.Error("included finalization still in the mempool")
+	}
+	if _, ok := p.Mempool.GetTx(block.HashFinalizeEventTx(forged)); !ok {
+		t.Error("forged finalization should stay pending, recorded as rejected")
+	}
+	if p.ChainState.Indexes.Finalized[eventID] != tx.TxID {
+		t.Error("event not marked finalized in the state index")
+	}
+
+	// Another node accepts the block and indexes the same finalization
+	if err := f[1].SaveNewBlock(*produced); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range f[:2] {
+		rec, err := blockchain.GetEventFinalization(n.store, eventID)
+		if err != nil || rec.TxID != tx.TxID || rec.IncludedIn != fmt.Sprintf("%x", tip[:]) || rec.Finalizer != n.FinalizerKeys[0] {
+			t.Fatalf("finalization not indexed: %+v, %v", rec, err)
+		}
+	}
+
+	// The finalization is a leaf of the epoch of the block that carried it, provable by the record's event ID
+	proof, err := blockchain.BuildEpochProof(f[1].store, produced.Epoch, eventID)
+	if err != nil || proof.LeafCount != 1 || !strings.Contains(string(proof.Event), eventID) {
+		t.Fatalf("no epoch proof for the finalized record: %+v, %v", proof, err)
+	}
+}
+
+func TestEventFinalizationRejectedUnlessValid(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain, eventID := recordChain(t, producer)
+	n := newFinalizerSet(t, 3, chain)[1]
+	parent := chain[2]
+	finalize := func(tx *block.FinalizeEventTx) block.ChainedEvent { return block.FinalizationEvent(tx) }
+
+	_, outsider, _ := ed25519.GenerateKey(nil)
+	if err := n.verifyEventFinalizations(eventBlock(parent, finalize(signedEventFinalization(outsider, eventID, chain[2])))); err == nil || !strings.Contains(err.Error(), "authorized finalizer") {
+		t.Errorf("finalization by an outsider accepted: %v", err)
+	}
+	if err := n.verifyEventFinalizations(eventBlock(parent, finalize(signedEventFinalization(n.FinalizerKey, eventID, chain[1])))); err == nil {
+		t.Error("finalization pointing at a block without the event accepted")
+	}
+	retargeted := signedEventFinalization(n.FinalizerKey, eventID, chain[2])
+	retargeted.EventID = ids.NewID([]byte("other record")).String()
+	if err := n.verifyEventFinalizations(eventBlock(parent, finalize(retargeted))); err == nil {
+		t.Error("signature reused for another event")
+	}
+	other := testSubmission()
+	other.Record["recordType"] = "prescription"
+	swapped := signedEventFinalization(n.FinalizerKey, eventID, chain[2])
+	swapped.SubmitMedicalRecordTx = submissionDigest(other)
+	if err := n.verifyEventFinalizations(eventBlock(parent, finalize(swapped))); err == nil || !strings.Contains(err.Error(), "does not match event") {
+		t.Errorf("finalization carrying another submission's digest accepted: %v", err)
+	}
+	misplaced := signedEventFinalization(n.FinalizerKey, eventID, chain[2])
+	misplaced.Block.Height++
+	if err := n.verifyEventFinalizations(eventBlock(parent, finalize(misplaced))); err == nil {
+		t.Error("finalization naming the wrong height of its block accepted")
+	}
+	unknown := eventBlock(parent)
+	if _, status, _ := blockchain.VerifyEventFinalization(n.store, signedEventFinalization(n.FinalizerKey, eventID, unknown), n.FinalizerKeys); status != block.FinalizationStatusPending {
+		t.Errorf("finalization of an unknown block: status %s, want pending", status)
+	}
+
+	tx := signedEventFinalization(n.FinalizerKey, eventID, chain[2])
+	stripped := eventBlock(parent)
+	stripped.EventFinalizationRoot = block.EventFinalizationsRoot([]block.ChainedEvent{finalize(tx)})
+	if err := n.verifyEventFinalizations(stripped); err == nil {
+		t.Error("block whose finalize events were stripped accepted")
+	}
+	twice := eventBlock(parent, finalize(tx), finalize(tx))
+	if err := n.verifyEventFinalizations(twice); err == nil || !strings.Contains(err.Error(), string(block.FinalizationStatusDuplicate)) {
+		t.Errorf("event finalized twice in one block: %v", err)
+	}
+
+	good := eventBlock(parent, finalize(tx))
+	if err := n.verifyEventFinalizations(good); err != nil {
+		t.Fatal(err)
+	}
+	n.recordEventFinalizations(good)
+	again := eventBlock(good, finalize(tx))
+	if err := n.verifyEventFinalizations(again); err == nil || !strings.Contains(err.Error(), string(block.FinalizationStatusDuplicate)) {
+		t.Errorf("finalized event finalized again: %v", err)
+	}
+}
+
+func TestEveryFinalizerFinalizesGossipedRecords(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain, eventID := recordChain(t, producer)
+	n := newFinalizerSet(t, 3, chain)[1] // Not the node the record was submitted to: nothing is queued
+	n.Finalizer = block.NewFinalizer(n.FinalizerKeys, nil, n.FinalizerKey)
+	n.Mempool = mempool.NewMempool(10)
+
+	// A submission sharing the event ID but not the content is never finalized in its place
+	forged := testSubmission()
+	forged.Record["recordType"] = "prescription"
+	for _, s := range []block.MedicalRecordSubmission{forged, testSubmission()} {
+		payload, _ := json.Marshal(s)
+		n.Mempool.Admit(mempool.Transaction{TxID: mempool.PayloadTxID(payload), Payload: payload})
+	}
+
+	n.submitEventFinalizations(chain[2])
+	var submitted []*block.FinalizeEventTx
+	for _, tx := range n.Mempool.GetAllTxs() {
+		if fin, ok := block.ParseFinalizeEventPayload(tx.Payload); ok {
+			submitted = append(submitted, fin)
+		}
+	}
+	if len(submitted) != 1 || submitted[0].EventID != eventID {
+		t.Fatalf("expected one finalization of %s, got %+v", eventID, submitted)
+	}
+	if _, status, err := blockchain.VerifyEventFinalization(n.store, submitted[0], n.FinalizerKeys); status != block.FinalizationStatusFinalized {
+		t.Errorf("submitted finalization does not verify: %s: %v", status, err)
+	}
+}
+
+// laterSchemas serves the bundled v1 schema up to height 2, where recordChain includes its record, and
+// a schema no record satisfies from height 3 on
+type laterSchemas struct{}
+
+func (laterSchemas) SchemaAt(version string, height uint64) ([]byte, error) {
+	if height <= 2 {
+		return validation.DefaultSchema(version)
+	}
+	return []byte(`{"not":{}}`), nil
+}
+
+func (laterSchemas) NextHeight() uint64 { return 10 }
+
+func TestFinalizationValidatesAgainstSchemaOfRecordBlock(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	validation.UseSchemaSource(laterSchemas{})
+	defer validation.UseSchemaSource(nil)
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain, eventID := recordChain(t, producer)
+	n := newFinalizerSet(t, 3, chain)[1]
+	n.Finalizer = block.NewFinalizer(n.FinalizerKeys, nil, n.FinalizerKey)
+	n.Mempool = mempool.NewMempool(10)
+	payload, _ := json.Marshal(testSubmission())
+	n.Mempool.Admit(mempool.Transaction{TxID: mempool.PayloadTxID(payload), Payload: payload})
+
+	// A schema activating after the record's block does not keep it from being finalized
+	n.submitEventFinalizations(chain[2])
+	for _, tx := range n.Mempool.GetAllTxs() {
+		if fin, ok := block.ParseFinalizeEventPayload(tx.Payload); ok && fin.EventID == eventID {
+			return
+		}
+	}
+	t.Fatal("record valid at its block not finalized once a later schema activated")
+}
+
+func TestSyncRejectsBlockWithInvalidFinalization(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain, eventID := recordChain(t, producer)
+	n := newFinalizerSet(t, 3, chain)[1]
+	n.SetLatestBlockID(chain[2].BlockID)
+
+	_, outsider, _ := ed25519.GenerateKey(nil)
+	forged := eventBlock(chain[2], block.FinalizationEvent(signedEventFinalization(outsider, eventID, chain[2])))
+	raw, _ := json.Marshal(forged)
+	if err := n.commitSyncedBlocks(bodyBatch{headers: []block.Block{forged}, blocks: [][]byte{raw}}); err == nil {
+		t.Fatal("synced block with an unauthorized finalization accepted")
+	}
+	if n.GetLatestBlockID() != chain[2].BlockID {
+		t.Error("tip moved to the rejected block")
+	}
+	if _, err := blockchain.GetEventFinalization(n.store, eventID); err == nil {
+		t.Error("finalization from a rejected block recorded")
+	}
+}
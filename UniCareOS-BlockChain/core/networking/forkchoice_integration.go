@@ -1,10 +1,13 @@
 package networking
 
 import (
-	"fmt"
 	"encoding/hex"
-	"unicareos/core/chain"
+	"encoding/json"
+	"fmt"
 
+	"unicareos/core/block"
+	"unicareos/core/chain"
+	"unicareos/core/mempool"
 )
 
 // HandleForkChoiceReorg performs fork-choice reorg using the chain/forkchoice logic
@@ -32,7 +35,110 @@ func (n *Network) HandleForkChoiceReorg(_ string, _ int, _ string) error {
 	}
 
 	fc := chain.NewForkChoice(n.store)
+	fc.Fetch = func(peerAddr string, blockID [32]byte) ([]byte, error) {
+		return n.RequestBlockFromPeer(peerAddr, blockID)
+	}
+	fc.Switch = n.switchBranch
 	return fc.CheckAndSync(myHeight, myTip, peerInfo)
 }
 
-// Optionally: You can call this from SaveNewBlock or orphan handling logic when a fork is detected.
+// switchBranch replaces our blocks above forkPoint with branch. Every block of the branch is checked for
+// its seal and events root before the tip moves; the blocks we abandon are then rolled back, their
+// sections' state reverted tip first, and the branch committed through the same checks as any block. If
+// a block of the branch is rejected the branch is rolled back in turn and our blocks restored.
+func (n *Network) switchBranch(forkPoint [32]byte, branch []*block.Block, raw [][]byte) error {
+	for _, blk := range branch {
+		if err := n.VerifyBlockSeal(*blk); err != nil {
+			return err
+		}
+		if err := verifyEventsRoot(*blk); err != nil {
+			return err
+		}
+	}
+
+	n.commitMu.Lock()
+	defer n.commitMu.Unlock()
+	abandoned, abandonedRaw, err := n.blocksAbove(forkPoint)
+	if err != nil {
+		return err
+	}
+	if err := n.unwindTo(forkPoint, abandoned); err != nil {
+		return fmt.Errorf("could not roll back to fork point %x: %v", forkPoint[:], err)
+	}
+	fmt.Printf("[REORG] Rolled back %d block(s) to fork point %x\n", len(abandoned), forkPoint[:])
+	for i, blk := range branch {
+		if _, err := n.commitLocked(*blk, raw[i]); err != nil {
+			n.restoreBranch(forkPoint, branch[:i], abandoned, abandonedRaw)
+			return fmt.Errorf("block %d of the new branch rejected: %v", blk.Height, err)
+		}
+	}
+	return nil
+}
+
+// blocksAbove returns our blocks above forkPoint up to the tip, in height order. Caller must hold commitMu.
+func (n *Network) blocksAbove(forkPoint [32]byte) ([]block.Block, [][]byte, error) {
+	var blocks []block.Block
+	var raw [][]byte
+	for id := n.GetLatestBlockID(); id != forkPoint; {
+		data, err := n.store.GetBlock(id[:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("fork point %x is not an ancestor of the tip: %v", forkPoint[:], err)
+		}
+		blk, err := block.Deserialize(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks = append([]block.Block{*blk}, blocks...)
+		raw = append([][]byte{data}, raw...)
+		prev, err := hex.DecodeString(blk.PrevHash)
+		if err != nil || len(prev) != 32 {
+			return nil, nil, fmt.Errorf("fork point %x is not an ancestor of the tip", forkPoint[:])
+		}
+		copy(id[:], prev)
+	}
+	return blocks, raw, nil
+}
+
+// unwindTo reverts the state of blocks, the chain above forkPoint in height order, tip first, then drops
+// them and moves the tip to forkPoint. Caller must hold commitMu.
+func (n *Network) unwindTo(forkPoint [32]byte, blocks []block.Block) error {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		n.blockUncommitted(blocks[i])
+	}
+	if err := n.store.RollbackToBlock(forkPoint); err != nil {
+		return err
+	}
+	return n.SetLatestBlockID(forkPoint)
+}
+
+// restoreBranch puts our blocks back after the new branch was rejected partway; applied is the part of
+// it already committed. Caller must hold commitMu.
+func (n *Network) restoreBranch(forkPoint [32]byte, applied []*block.Block, blocks []block.Block, raw [][]byte) {
+	undo := make([]block.Block, len(applied))
+	for i, blk := range applied {
+		undo[i] = *blk
+	}
+	if err := n.unwindTo(forkPoint, undo); err != nil {
+		fmt.Printf("[REORG] Could not roll back the rejected branch: %v\n", err)
+		return
+	}
+	for i, blk := range blocks {
+		if _, err := n.commitLocked(blk, raw[i]); err != nil {
+			fmt.Printf("[REORG] Could not restore block %d: %v\n", blk.Height, err)
+			return
+		}
+	}
+	fmt.Printf("[REORG] Restored %d block(s) above fork point %x\n", len(blocks), forkPoint[:])
+}
+
+// returnToMempool re-admits a transaction of a rolled-back block, so it can be included in the new branch
+func (n *Network) returnToMempool(txID string, payload interface{}, sender string) {
+	if n.Mempool == nil {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	n.Mempool.Admit(mempool.Transaction{TxID: txID, Payload: data, Timestamp: n.Now().Unix(), Sender: sender})
+}
@@ -0,0 +1,79 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/core/state"
+)
+
+// childBlock builds a block of events on parent sealed by priv
+func childBlock(parent block.Block, priv ed25519.PrivateKey, events ...block.ChainedEvent) block.Block {
+	b := block.Block{
+		Version:      "1.0",
+		Height:       parent.Height + 1,
+		PrevHash:     fmt.Sprintf("%x", parent.BlockID[:]),
+		Timestamp:    time.Now().UTC(),
+		ValidatorDID: fmt.Sprintf("ed25519:%x", []byte(priv.Public().(ed25519.PublicKey))),
+		Events:       events,
+		MerkleRoot:   block.EventsRoot(events),
+		ConsentRoot:  block.ConsentRoot(events),
+	}
+	b.BlockID = b.ComputeID()
+	b.Signature = ed25519.Sign(priv, b.BlockID[:])
+	return b
+}
+
+func TestSwitchBranchRestoresOurBlocksWhenTheBranchIsRejected(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 1, producer)
+	store := newTestStore(t, chain)
+	n := &Network{store: store, Mempool: mempool.NewMempool(10), EpochBlockCount: 10, ChainState: &state.ChainState{StateDB: store}}
+	if err := n.SetLatestBlockID(chain[0].BlockID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our block 1 carries a grant
+	_, patient, _ := ed25519.GenerateKey(nil)
+	grant := signedGrant(t, patient, "clinic-a")
+	ours := childBlock(chain[0], producer, block.ConsentEvent(grant))
+	if err := n.SaveNewBlock(ours); err != nil {
+		t.Fatal(err)
+	}
+	oursHex := fmt.Sprintf("%x", ours.BlockID[:])
+
+	// The longer branch revokes that grant without carrying it, so its second block is rejected once
+	// our block is rolled back
+	revoke := &block.ConsentRevoke{ConsentID: grant.ConsentID(), PatientDID: grant.PatientDID(), Timestamp: time.Now().UTC()}
+	if err := revoke.Sign(patient); err != nil {
+		t.Fatal(err)
+	}
+	b1 := childBlock(chain[0], producer)
+	b2 := childBlock(b1, producer, block.ConsentEvent(&block.ConsentPayload{Type: block.ConsentRevokeType, Revoke: revoke}))
+	raw1, _ := b1.Serialize()
+	raw2, _ := b2.Serialize()
+	if err := n.switchBranch(chain[0].BlockID, []*block.Block{&b1, &b2}, [][]byte{raw1, raw2}); err == nil {
+		t.Fatal("branch with a dangling revocation accepted")
+	}
+
+	if tip := n.GetLatestBlockID(); tip != ours.BlockID {
+		t.Fatalf("tip %x after the rejected switch, want our block %s", tip[:], oursHex)
+	}
+	if _, err := store.GetBlock(b1.BlockID[:]); err == nil {
+		t.Error("block of the rejected branch left in the store")
+	}
+	rec, err := blockchain.GetConsent(store, grant.ConsentID())
+	if err != nil || rec.IncludedIn != oursHex || rec.Revoked {
+		t.Fatalf("grant not restored as our block applied it: %+v, %v", rec, err)
+	}
+	if n.ChainState.Epoch != 0 || n.ChainState.BlocksInEpoch != 1 {
+		t.Errorf("epoch %d with %d blocks after the rejected switch, want 0 with 1", n.ChainState.Epoch, n.ChainState.BlocksInEpoch)
+	}
+}
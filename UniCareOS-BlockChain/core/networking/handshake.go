@@ -0,0 +1,147 @@
+package networking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Versioned P2P handshake.
+// Both sides exchange a HelloMessage over the ALPNHandshake connection. A peer is admitted only if it is
+// on the same chain (chain ID and genesis block ID) and the protocol version ranges overlap. The features
+// both sides advertise decide which message encodings are used with that peer, so nodes can be upgraded
+// one hospital at a time.
+const (
+	// ProtocolVersion is the newest P2P protocol this node speaks; MinProtocolVersion the oldest it accepts.
+	// Version 1 is the first versioned handshake. Pre-versioning nodes send no version and are rejected.
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Node roles advertised in the hello
+const (
+	RoleValidator = "validator" // Produces blocks
+	RoleFullNode  = "full"      // Stores and relays the full chain
+)
+
+// Features a node may advertise. A feature is used with a peer only if both sides advertise it;
+// otherwise the legacy encoding is used.
+const (
+	FeatureHeadersSync   = "headers-sync"   // /headers + /blocks?raw=true (otherwise the peer is not used for sync)
+	FeatureTxInv         = "tx-inv"         // INV/GETDATA tx gossip (otherwise full-body /gossip_tx)
+	FeatureCompactBlocks = "compact-blocks" // Block announcements only (otherwise full /broadcast_block)
+	FeaturePEX           = "pex"            // /pex/addrs peer exchange
+)
+
+// SupportedFeatures lists every feature this release implements
+func SupportedFeatures() []string {
+	return []string{FeatureHeadersSync, FeatureTxInv, FeatureCompactBlocks, FeaturePEX}
+}
+
+// HandshakeConfig identifies the chain and what this node offers. Set it before Network.Start.
+type HandshakeConfig struct {
+	ChainID   string   // genesis.json chainId
+	GenesisID [32]byte // BlockID of the genesis block
+	Role      string
+	Features  []string
+}
+
+// DefaultHandshakeConfig returns a full-node config with all features; ChainID and GenesisID must still be set
+func DefaultHandshakeConfig() HandshakeConfig {
+	return HandshakeConfig{Role: RoleFullNode, Features: SupportedFeatures()}
+}
+
+// HelloMessage is the first line each side sends on a handshake connection.
+// Peer fields (address, ports, height, tip, key) are inlined for compatibility with the old hello.
+type HelloMessage struct {
+	Peer
+	ChainID     string   `json:"chainId"`
+	GenesisID   string   `json:"genesisId"`
+	MinProtocol int      `json:"minProtocol"`
+	MaxProtocol int      `json:"maxProtocol"`
+	Role        string   `json:"role"`
+	Features    []string `json:"features"`
+	Reject      string   `json:"reject,omitempty"` // Set instead of the above when the receiver refuses the peer
+}
+
+// localHello builds our hello around the peer info we advertise
+func (n *Network) localHello(self Peer) HelloMessage {
+	cfg := n.Handshake
+	return HelloMessage{
+		Peer:        self,
+		ChainID:     cfg.ChainID,
+		GenesisID:   fmt.Sprintf("%x", cfg.GenesisID[:]),
+		MinProtocol: MinProtocolVersion,
+		MaxProtocol: ProtocolVersion,
+		Role:        cfg.Role,
+		Features:    cfg.Features,
+	}
+}
+
+// NegotiateHello checks a remote hello against ours. On success it returns the remote Peer with the
+// negotiated protocol version, role and common feature set filled in.
+func NegotiateHello(local, remote HelloMessage) (Peer, error) {
+	if remote.Reject != "" {
+		return Peer{}, fmt.Errorf("peer rejected handshake: %s", remote.Reject)
+	}
+	if remote.MaxProtocol == 0 {
+		return Peer{}, fmt.Errorf("peer sent an unversioned hello (pre-%d release)", MinProtocolVersion)
+	}
+	if remote.ChainID != local.ChainID {
+		return Peer{}, fmt.Errorf("chain ID mismatch: ours %q, peer %q", local.ChainID, remote.ChainID)
+	}
+	if remote.GenesisID != local.GenesisID {
+		return Peer{}, fmt.Errorf("genesis mismatch: ours %s, peer %s", local.GenesisID, remote.GenesisID)
+	}
+	version := local.MaxProtocol
+	if remote.MaxProtocol < version {
+		version = remote.MaxProtocol
+	}
+	if version < local.MinProtocol || version < remote.MinProtocol {
+		return Peer{}, fmt.Errorf("no common protocol version: ours %d-%d, peer %d-%d",
+			local.MinProtocol, local.MaxProtocol, remote.MinProtocol, remote.MaxProtocol)
+	}
+	if remote.Role != RoleValidator && remote.Role != RoleFullNode {
+		return Peer{}, fmt.Errorf("unknown node role %q", remote.Role)
+	}
+	p := remote.Peer
+	p.ProtocolVersion = version
+	p.Role = remote.Role
+	p.Features = commonFeatures(local.Features, remote.Features)
+	return p, nil
+}
+
+func commonFeatures(a, b []string) []string {
+	have := map[string]bool{}
+	for _, f := range a {
+		have[f] = true
+	}
+	out := []string{}
+	for _, f := range b {
+		if have[f] {
+			out = append(out, f)
+			delete(have, f) // dedupe
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Supports reports whether feature was negotiated with the peer
+func (p Peer) Supports(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerSupports reports whether feature was negotiated with the connected peer at address
+func (n *Network) PeerSupports(address, feature string) bool {
+	for _, p := range n.Peers() {
+		if p.Address == address {
+			return p.Supports(feature)
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package networking
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testHello(chainID string, min, max int, features ...string) HelloMessage {
+	return HelloMessage{ChainID: chainID, GenesisID: "00", MinProtocol: min, MaxProtocol: max, Role: RoleFullNode, Features: features}
+}
+
+func TestNegotiateHello(t *testing.T) {
+	local := testHello("unicare-devnet", 1, 3, FeatureTxInv, FeatureCompactBlocks, FeaturePEX)
+
+	p, err := NegotiateHello(local, testHello("unicare-devnet", 2, 5, FeaturePEX, FeatureTxInv, "future-thing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ProtocolVersion != 3 || !p.Supports(FeatureTxInv) || !p.Supports(FeaturePEX) || p.Supports(FeatureCompactBlocks) || p.Supports("future-thing") {
+		t.Errorf("unexpected negotiation result: v%d %v", p.ProtocolVersion, p.Features)
+	}
+
+	cases := map[string]HelloMessage{
+		"chain ID mismatch":  testHello("other-net", 1, 3),
+		"genesis mismatch":   {ChainID: "unicare-devnet", GenesisID: "ff", MinProtocol: 1, MaxProtocol: 1, Role: RoleFullNode},
+		"no common protocol": testHello("unicare-devnet", 4, 6),
+		"unversioned hello":  {Peer: Peer{Address: "10.0.0.1:3000"}},
+		"unknown node role":  {ChainID: "unicare-devnet", GenesisID: "00", MinProtocol: 1, MaxProtocol: 1, Role: "oracle"},
+		"rejected handshake": {Reject: "chain ID mismatch"},
+	}
+	for want, remote := range cases {
+		if _, err := NegotiateHello(local, remote); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q, got %v", want, err)
+		}
+	}
+}
+
+func newHandshakeNode(t *testing.T, chainID string) *Network {
+	n := &Network{
+		Transport:        newTestTransport(t, nil),
+		PeerMux:          http.NewServeMux(),
+		AddrBook:         NewAddressBook(nil),
+		Bans:             NewBanManager(nil),
+		ProducersDynamic: make(map[string]struct{}),
+		MissedTurns:      make(map[string]int),
+		recentBlocks:     make(map[string]struct{}),
+		Handshake:        DefaultHandshakeConfig(),
+		listenAddr:       "127.0.0.1:0",
+	}
+	n.PubKey = n.Transport.PubKey
+	n.Handshake.ChainID = chainID
+	return n
+}
+
+func TestHandshakeRejectsOtherChainWithReason(t *testing.T) {
+	server := newHandshakeNode(t, "unicare-devnet")
+	same := newHandshakeNode(t, "unicare-devnet")
+	same.Handshake.Features = []string{FeaturePEX}
+	other := newHandshakeNode(t, "unicare-testnet")
+	for _, c := range []*Network{same, other} {
+		server.Transport.Keys.Add(c.Transport.PubKey)
+		c.Transport.Keys.Add(server.Transport.PubKey)
+	}
+	addr := serveTransport(t, server)
+
+	if err := same.ConnectToPeer(addr); err != nil {
+		t.Fatalf("handshake on the same chain failed: %v", err)
+	}
+	peers := same.Peers()
+	if len(peers) != 1 || peers[0].ProtocolVersion != ProtocolVersion || peers[0].Role != RoleFullNode {
+		t.Fatalf("unexpected peer table: %+v", peers)
+	}
+	if !peers[0].Supports(FeaturePEX) || peers[0].Supports(FeatureTxInv) {
+		t.Errorf("features should be the intersection, got %v", peers[0].Features)
+	}
+
+	err := other.ConnectToPeer(addr)
+	if err == nil || !strings.Contains(err.Error(), "peer rejected handshake: chain ID mismatch") {
+		t.Fatalf("expected chain ID rejection, got %v", err)
+	}
+	if len(other.Peers()) != 0 {
+		t.Error("rejected peer was added to the peer table")
+	}
+}
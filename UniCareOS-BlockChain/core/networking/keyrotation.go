@@ -0,0 +1,373 @@
+package networking
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/keystore"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Node key rotation.
+// `keys rotate` replaces a node's keystore and leaves a keystore.Rotation signed by the old and the new
+// key. On startup with the new key the node announces it to the peers it knows over ALPNKeyRotation,
+// the only protocol on which a key outside the allowlist may connect: the peer accepts a rotation to
+// exactly the key the connection authenticated, vouched for by a key it currently allows and that is
+// not banned. Peers hold accepted rotations as pending and relay them to their own peers over peer RPC
+// (/key_rotation); the next producer writes them into its block (Block.KeyRotations, committed to by
+// KeyRotationRoot). Only when that block is committed does a rotation take effect: it admits the new
+// key, retires the old one (it can no longer connect, and only seals blocks timestamped before the
+// rotation) and hands the old key's producer slot and missed turns to the new key. Committed rotations
+// are stored under "keyRotation:" and re-applied at startup.
+
+const (
+	keyRotationPrefix   = "keyRotation:"
+	maxKeyRotationBytes = 4 << 10
+	keyRotationReplyOK  = "ok"
+	keyRotationTimeout  = 10 * time.Second
+)
+
+// keyRotationPool holds verified rotations awaiting inclusion in a block, keyed by old key
+type keyRotationPool struct {
+	mu      sync.Mutex
+	pending map[string]*keystore.Rotation
+}
+
+// AcceptKeyRotation verifies r, whose old key must be in the node set, and holds it until a block commits
+// it. It reports whether the rotation was new; re-delivering a pending or committed rotation is not an error.
+func (n *Network) AcceptKeyRotation(r *keystore.Rotation) (bool, error) {
+	return n.acceptKeyRotation(r, true)
+}
+
+func (n *Network) acceptKeyRotation(r *keystore.Rotation, requireKnown bool) (bool, error) {
+	if prev, err := n.getKeyRotation(r.OldKey); err == nil && prev.NewKey == r.NewKey {
+		return false, nil
+	}
+	if err := n.verifyKeyRotation(r, requireKnown); err != nil {
+		return false, err
+	}
+	n.keyRotations.mu.Lock()
+	defer n.keyRotations.mu.Unlock()
+	if prev, ok := n.keyRotations.pending[r.OldKey]; ok {
+		if prev.NewKey == r.NewKey {
+			return false, nil
+		}
+		return false, fmt.Errorf("a rotation of key %s to %s is already pending", r.OldKey, prev.NewKey)
+	}
+	if n.keyRotations.pending == nil {
+		n.keyRotations.pending = make(map[string]*keystore.Rotation)
+	}
+	n.keyRotations.pending[r.OldKey] = r
+	fmt.Printf("[KEYS] Rotation of node key %s to %s pending inclusion\n", r.OldKey, r.NewKey)
+	return true, nil
+}
+
+// verifyKeyRotation checks the signatures of r and that neither key is banned and the old key was not
+// rotated before. requireKnown also demands that the old key is in the node set.
+func (n *Network) verifyKeyRotation(r *keystore.Rotation, requireKnown bool) error {
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	if prev, err := n.getKeyRotation(r.OldKey); err == nil {
+		return fmt.Errorf("key %s was already rotated to %s", r.OldKey, prev.NewKey)
+	}
+	for _, k := range []string{r.OldKey, r.NewKey} {
+		if n.IsPeerBanned("node:" + k) {
+			return fmt.Errorf("key %s is banned", k)
+		}
+	}
+	oldPub, _, _ := r.Keys()
+	if requireKnown && n.Transport != nil && !n.Transport.Keys.Allowed(oldPub) {
+		return fmt.Errorf("rotated key %s is not in the node set", r.OldKey)
+	}
+	return nil
+}
+
+// pendingKeyRotations returns the pending rotations that still verify, oldest first, for the next block
+func (n *Network) pendingKeyRotations() []keystore.Rotation {
+	n.keyRotations.mu.Lock()
+	var out []keystore.Rotation
+	for _, r := range n.keyRotations.pending {
+		out = append(out, *r)
+	}
+	n.keyRotations.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	valid := out[:0]
+	for _, r := range out {
+		if n.verifyKeyRotation(&r, true) == nil {
+			valid = append(valid, r)
+		}
+	}
+	return valid
+}
+
+// verifyKeyRotations checks a block's key rotations against its KeyRotationRoot before it is accepted
+func (n *Network) verifyKeyRotations(blk block.Block) error {
+	if root := block.KeyRotationsRoot(blk.KeyRotations); root != blk.KeyRotationRoot {
+		return fmt.Errorf("block %d: key rotations do not match KeyRotationRoot", blk.Height)
+	}
+	seen := make(map[string]bool)
+	for i := range blk.KeyRotations {
+		r := &blk.KeyRotations[i]
+		if seen[r.OldKey] {
+			return fmt.Errorf("block %d: key %s rotated twice", blk.Height, r.OldKey)
+		}
+		seen[r.OldKey] = true
+		if err := n.verifyKeyRotation(r, true); err != nil {
+			return fmt.Errorf("block %d: %v", blk.Height, err)
+		}
+	}
+	return nil
+}
+
+// recordKeyRotations stores and applies the key rotations of a committed block
+func (n *Network) recordKeyRotations(blk block.Block) {
+	for i := range blk.KeyRotations {
+		r := &blk.KeyRotations[i]
+		if n.store != nil && n.store.DB() != nil {
+			data, _ := json.Marshal(r)
+			if err := n.store.DB().Put([]byte(keyRotationPrefix+r.OldKey), data, nil); err != nil {
+				fmt.Printf("[KEYS] Failed to store rotation of key %s: %v\n", r.OldKey, err)
+			}
+		}
+		n.keyRotations.mu.Lock()
+		delete(n.keyRotations.pending, r.OldKey)
+		n.keyRotations.mu.Unlock()
+		n.applyKeyRotation(r)
+		fmt.Printf("[KEYS] Node key %s rotated to %s (block %d)\n", r.OldKey, r.NewKey, blk.Height)
+	}
+}
+
+// applyKeyRotation updates the allowlist and producer table for a verified rotation
+func (n *Network) applyKeyRotation(r *keystore.Rotation) {
+	oldPub, newPub, _ := r.Keys()
+	if n.Transport != nil {
+		n.Transport.Keys.Add(newPub)
+		n.Transport.Keys.Retire(oldPub, r.Timestamp)
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.ProducersDynamic == nil {
+		return
+	}
+	if _, ok := n.ProducersDynamic[r.OldKey]; ok {
+		delete(n.ProducersDynamic, r.OldKey)
+		n.ProducersDynamic[r.NewKey] = struct{}{}
+	}
+	if missed, ok := n.MissedTurns[r.OldKey]; ok {
+		delete(n.MissedTurns, r.OldKey)
+		n.MissedTurns[r.NewKey] = missed
+	}
+}
+
+// revertKeyRotations undoes recordKeyRotations for a rolled-back block; its rotations are pending again
+func (n *Network) revertKeyRotations(blk block.Block) {
+	for i := len(blk.KeyRotations) - 1; i >= 0; i-- {
+		r := blk.KeyRotations[i]
+		if n.store != nil && n.store.DB() != nil {
+			if err := n.store.DB().Delete([]byte(keyRotationPrefix+r.OldKey), nil); err != nil {
+				fmt.Printf("[KEYS] Failed to forget rotation of key %s: %v\n", r.OldKey, err)
+			}
+		}
+		n.revertKeyRotation(&r)
+		n.keyRotations.mu.Lock()
+		if n.keyRotations.pending == nil {
+			n.keyRotations.pending = make(map[string]*keystore.Rotation)
+		}
+		n.keyRotations.pending[r.OldKey] = &r
+		n.keyRotations.mu.Unlock()
+		fmt.Printf("[KEYS] Rotation of node key %s to %s rolled back (block %d)\n", r.OldKey, r.NewKey, blk.Height)
+	}
+}
+
+// revertKeyRotation undoes applyKeyRotation
+func (n *Network) revertKeyRotation(r *keystore.Rotation) {
+	oldPub, newPub, _ := r.Keys()
+	if n.Transport != nil {
+		n.Transport.Keys.Remove(newPub)
+		n.Transport.Keys.Reinstate(oldPub)
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.ProducersDynamic == nil {
+		return
+	}
+	if _, ok := n.ProducersDynamic[r.NewKey]; ok {
+		delete(n.ProducersDynamic, r.NewKey)
+		n.ProducersDynamic[r.OldKey] = struct{}{}
+	}
+	if missed, ok := n.MissedTurns[r.NewKey]; ok {
+		delete(n.MissedTurns, r.NewKey)
+		n.MissedTurns[r.OldKey] = missed
+	}
+}
+
+func (n *Network) getKeyRotation(oldKey string) (*keystore.Rotation, error) {
+	if n.store == nil || n.store.DB() == nil {
+		return nil, errors.New("no store")
+	}
+	data, err := n.store.DB().Get([]byte(keyRotationPrefix+oldKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	var r keystore.Rotation
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// LoadKeyRotations re-applies stored rotations, oldest first, after the allowlist is configured
+func (n *Network) LoadKeyRotations() int {
+	if n.store == nil || n.store.DB() == nil {
+		return 0
+	}
+	var rotations []*keystore.Rotation
+	iter := n.store.DB().NewIterator(util.BytesPrefix([]byte(keyRotationPrefix)), nil)
+	for iter.Next() {
+		var r keystore.Rotation
+		if err := json.Unmarshal(iter.Value(), &r); err == nil && r.Verify() == nil {
+			rotations = append(rotations, &r)
+		}
+	}
+	iter.Release()
+	sort.Slice(rotations, func(i, j int) bool { return rotations[i].Timestamp.Before(rotations[j].Timestamp) })
+	for _, r := range rotations {
+		n.applyKeyRotation(r)
+	}
+	return len(rotations)
+}
+
+// AnnounceKeyRotation holds our own rotation for inclusion and delivers it to each address over ALPNKeyRotation,
+// authenticating with the new key. It returns the number of peers that accepted it.
+func (n *Network) AnnounceKeyRotation(r *keystore.Rotation, addresses []string) (int, error) {
+	if n.Transport == nil {
+		return 0, errors.New("no transport")
+	}
+	if !strings.EqualFold(r.NewKey, fmt.Sprintf("%x", n.PubKey)) {
+		return 0, fmt.Errorf("rotation is to key %s, not this node's key", r.NewKey)
+	}
+	if _, err := n.acceptKeyRotation(r, false); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return 0, err
+	}
+	accepted := 0
+	for _, addr := range addresses {
+		if err := n.sendKeyRotation(addr, data); err != nil {
+			fmt.Printf("[KEYS] Rotation not delivered to %s: %v\n", addr, err)
+			continue
+		}
+		accepted++
+	}
+	return accepted, nil
+}
+
+// sendKeyRotation delivers an encoded rotation to one peer and waits for its verdict
+func (n *Network) sendKeyRotation(address string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), keyRotationTimeout)
+	defer cancel()
+	conn, err := n.Transport.DialContext(ctx, address, ALPNKeyRotation)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(keyRotationTimeout))
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if reply = strings.TrimSpace(reply); reply != keyRotationReplyOK {
+		return errors.New(reply)
+	}
+	return nil
+}
+
+// handleKeyRotationConn serves one rotation delivered by the rotated node itself
+func (n *Network) handleKeyRotationConn(conn *tls.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	reply := keyRotationReplyOK
+	line, err := bufio.NewReader(io.LimitReader(conn, maxKeyRotationBytes)).ReadBytes('\n')
+	var r keystore.Rotation
+	if err == nil {
+		err = json.Unmarshal(line, &r)
+	}
+	if err == nil && !strings.EqualFold(r.NewKey, fmt.Sprintf("%x", PeerKey(conn.ConnectionState()))) {
+		err = errors.New("rotation is not to the key this connection authenticated")
+	}
+	var changed bool
+	if err == nil {
+		changed, err = n.AcceptKeyRotation(&r)
+	}
+	if err != nil {
+		fmt.Printf("[KEYS] Rejected key rotation from %s: %v\n", conn.RemoteAddr(), err)
+		reply = err.Error()
+	}
+	conn.Write([]byte(strings.ReplaceAll(reply, "\n", " ") + "\n"))
+	if changed {
+		n.goAsync(func() { n.relayKeyRotation(&r) })
+	}
+}
+
+// HandleKeyRotation receives a rotation relayed by an authenticated peer
+func (n *Network) HandleKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	address, pub := n.requestIdentity(r)
+	var rot keystore.Rotation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxKeyRotationBytes)).Decode(&rot); err != nil {
+		n.PenalizePeer(address, pub, decodeOffense(err), "key rotation: "+err.Error())
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	changed, err := n.AcceptKeyRotation(&rot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if changed {
+		n.goAsync(func() { n.relayKeyRotation(&rot) })
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// relayKeyRotation gossips an accepted rotation to our peers
+func (n *Network) relayKeyRotation(r *keystore.Rotation) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	for _, peer := range n.Peers() {
+		p := peer
+		n.goAsync(func() {
+			url := PeerURL(p.Address, "/key_rotation")
+			resp, err := n.peerHTTP().Post(url, "application/json", bytes.NewReader(data))
+			if err != nil {
+				fmt.Printf("[KEYS] Error relaying key rotation to %s: %v\n", url, err)
+				return
+			}
+			resp.Body.Close()
+		})
+	}
+}
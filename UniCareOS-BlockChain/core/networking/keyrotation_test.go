@@ -0,0 +1,111 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/keystore"
+)
+
+func TestKeyRotationCarriesIdentityToNewKey(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, oldKey, _ := ed25519.GenerateKey(nil)
+	newPub, newKey, _ := ed25519.GenerateKey(nil)
+	oldPub := oldKey.Public().(ed25519.PublicKey)
+	oldHex, newHex := hex.EncodeToString(oldPub), hex.EncodeToString(newPub)
+
+	// The peer knows the node by its old key, which holds a producer slot
+	peer := &Network{
+		Transport:        newTestTransport(t, NewPeerKeySet(oldPub)),
+		PeerMux:          http.NewServeMux(),
+		store:            newTestStore(t, nil),
+		ProducersDynamic: map[string]struct{}{oldHex: {}},
+		MissedTurns:      map[string]int{oldHex: 2},
+	}
+	peer.PeerMux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	addr := serveTransport(t, peer)
+
+	// The node restarts with its new key, which the peer does not admit yet
+	node := &Network{ProducersDynamic: map[string]struct{}{}, store: newTestStore(t, nil)}
+	if err := node.UseSigner(newKey); err != nil {
+		t.Fatal(err)
+	}
+	node.Transport.Keys.Add(peer.Transport.PubKey)
+	if resp, err := node.Transport.HTTPClient().Get(PeerURL(addr, "/ping")); err == nil {
+		resp.Body.Close()
+		t.Fatal("new key admitted before the rotation")
+	}
+
+	// A valid rotation to some other key cannot be delivered over this connection
+	_, thief, _ := ed25519.GenerateKey(nil)
+	at := time.Now().UTC()
+	stolen, _ := keystore.NewRotation(oldKey, thief, at)
+	data, _ := json.Marshal(stolen)
+	if err := node.sendKeyRotation(addr, data); err == nil || !strings.Contains(err.Error(), "authenticated") {
+		t.Fatalf("rotation to a key the sender does not hold: %v", err)
+	}
+
+	rot, _ := keystore.NewRotation(oldKey, newKey, at)
+	if accepted, err := node.AnnounceKeyRotation(rot, []string{addr}); err != nil || accepted != 1 {
+		t.Fatalf("announcement accepted by %d peer(s): %v", accepted, err)
+	}
+	keys := peer.Transport.Keys
+	pending := peer.pendingKeyRotations()
+	if len(pending) != 1 || pending[0].NewKey != newHex {
+		t.Fatalf("rotation not pending on the peer: %+v", pending)
+	}
+	if keys.Allowed(newPub) || !keys.Allowed(oldPub) || len(peer.MissedTurns) != 1 || peer.MissedTurns[oldHex] != 2 {
+		t.Fatal("rotation took effect before a block committed it")
+	}
+
+	// The rotation takes effect once a block carrying it is committed
+	blk := block.Block{Timestamp: at, KeyRotations: pending, KeyRotationRoot: block.KeyRotationsRoot(pending)}
+	blk.BlockID = blk.ComputeID()
+	if err := peer.SaveNewBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+	if len(peer.pendingKeyRotations()) != 0 {
+		t.Error("committed rotation still pending")
+	}
+	if !keys.Allowed(newPub) || keys.Allowed(oldPub) {
+		t.Error("allowlist not moved to the new key")
+	}
+	if _, ok := peer.ProducersDynamic[newHex]; !ok || len(peer.ProducersDynamic) != 1 || peer.MissedTurns[newHex] != 2 {
+		t.Errorf("producer slot not carried over: %v %v", peer.ProducersDynamic, peer.MissedTurns)
+	}
+	if !keys.SealAllowed(oldPub, at.Add(-time.Minute)) || keys.SealAllowed(oldPub, at.Add(time.Minute)) {
+		t.Error("old key must seal only blocks from before the rotation")
+	}
+	resp, err := node.Transport.HTTPClient().Get(PeerURL(addr, "/ping"))
+	if err != nil {
+		t.Fatalf("new key not admitted after the rotation: %v", err)
+	}
+	resp.Body.Close()
+	data, _ = json.Marshal(rot)
+	if err := node.sendKeyRotation(addr, data); err != nil {
+		t.Errorf("re-announcement rejected: %v", err)
+	}
+
+	// A peer that banned the old key refuses the rotation, and any block carrying it
+	banned := &Network{Transport: newTestTransport(t, NewPeerKeySet(oldPub)), Bans: NewBanManager(nil), store: newTestStore(t, nil)}
+	banned.Bans.BanUntil("node:"+oldHex, time.Now().Add(time.Hour), "equivocation", "consensus:test")
+	if _, err := banned.AcceptKeyRotation(rot); err == nil || !strings.Contains(err.Error(), "banned") {
+		t.Errorf("rotation of a banned key accepted: %v", err)
+	}
+	if err := banned.verifyKeyRotations(blk); err == nil {
+		t.Error("block rotating a banned key accepted")
+	}
+
+	// A restarted peer re-applies the stored rotation over its configured allowlist
+	restarted := &Network{Transport: newTestTransport(t, NewPeerKeySet(oldPub)), store: peer.store}
+	if n := restarted.LoadKeyRotations(); n != 1 || !restarted.Transport.Keys.Allowed(newPub) || restarted.Transport.Keys.Allowed(oldPub) {
+		t.Errorf("stored rotation not re-applied (%d loaded)", n)
+	}
+}
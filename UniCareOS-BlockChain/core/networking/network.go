@@ -2,11 +2,15 @@ package networking
 
 import (
 	"bufio"
+	"crypto/ed25519"
+	"crypto/tls"
 	"unicareos/core/state"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 
+	"math"
 	"sort"
 	"io"
 	"runtime/debug"
@@ -15,15 +19,15 @@ import (
 	"sync"
 	"time"
 	"strings"
+	"strconv"
 	"encoding/hex"
-	"encoding/binary"
 
 	"unicareos/core/block"
+	"unicareos/core/blockchain"
 	"unicareos/core/storage"
-	"unicareos/core"
 	"unicareos/core/mempool"
 	"unicareos/core/chain"
-	"unicareos/core/blockchain"
+	"unicareos/core/signer"
 	
 	)
 
@@ -36,6 +40,12 @@ type Peer struct {
 	LastSeen    time.Time
 	HostOnly    string    // host only, for broadcast URL
 	PubKey      []byte    // Ed25519 public key (added for producer table)
+	Outbound    bool      `json:"-"` // We dialed this peer (counts toward PeerManagerConfig.TargetOutbound)
+
+	// Negotiated in the versioned handshake (see HelloMessage)
+	ProtocolVersion int      `json:"-"`
+	Role            string   `json:"-"`
+	Features        []string `json:"-"`
 }
 
 
@@ -45,6 +55,7 @@ type Network struct {
 	BlockProductionInterval time.Duration
 	// Dynamic set of block producers (pubkey hex → present)
 	ProducersDynamic map[string]struct{}
+	ValidatorWindow  int // Blocks up to a parent whose producers form the ban validator set (0 means DefaultValidatorWindow)
 	// Missed turn counters (pubkey hex → count)
 	MissedTurns map[string]int
 	// Orphan block buffer: BlockID hex → block.Block
@@ -59,19 +70,52 @@ type Network struct {
 	peers         []Peer
 	store         *storage.Storage
 	lock          sync.Mutex
+	commitMu      sync.Mutex // Held from a block's tip check until its sections are applied; taken before lock
 	latestBlockID [32]byte
 
 	EpochBlockCount int // Number of blocks per epoch, from genesis config
 
 	recentBlocks      map[string]struct{} // BlockID hex → exists (for deduplication)
-	bannedPeers       map[string]time.Time
 	peerRequestCounts map[string][]time.Time
-	banCounts         map[string]int // Tracks number of bans per IP for progressive banning
 
-	PrivKey []byte // Ed25519 private key
-	PubKey  []byte // Ed25519 public key
+	PrivKey []byte        // Ed25519 private key (nil when the node key is on a token)
+	PubKey  []byte        // Ed25519 public key
+	Signer  signer.Signer // Node key on a PKCS#11 token, set with UseSigner; PrivKey is used when nil
 
 	Mempool *mempool.Mempool // Reference to the mempool for block production
+	Gossip  *mempool.GossipEngine // Tx gossip; mempools are reconciled through it when peers connect
+
+	Transport *Transport     // Authenticated TLS transport bound to the node key (nil if the keypair is unusable)
+	PeerMux   *http.ServeMux // Peer RPC endpoints, served only over authenticated P2P connections
+	// PeerClient, if set, replaces the transport's client for peer RPC (an in-process transport such as
+	// test/simnet routes requests straight to the other node's PeerMux)
+	PeerClient *http.Client
+
+	AddrBook   *AddressBook      // Known peer addresses, persisted under "addr:"
+	PeerConfig PeerManagerConfig // Discovery and reconnection settings
+
+	SyncConfig SyncConfig      // Headers-first sync settings
+	Handshake  HandshakeConfig // Chain identity, role and features advertised in the hello
+
+	Scores *PeerScoreManager // Misbehavior scores; bans are keyed on NodeIdentity
+	Bans   *BanManager       // IP, CIDR and node-identity bans with allowlist and audit trail
+	syncer     syncState
+	banPool    banPool // Network-wide ban proposals awaiting validator quorum
+	keyRotations keyRotationPool // Verified node key rotations awaiting inclusion
+
+	FinalizerKeys   []string           // Authorized epoch finalizer keys (base64 Ed25519)
+	FinalizerQuorum int                // Finalizer signatures needed per epoch (0 means more than two thirds)
+	FinalizerKey    signer.Signer      // This node's finalizer key (nil if it does not finalize epochs)
+	epochPool       epochPool          // Epoch finalizations collecting signatures
+	Finalizer       *block.Finalizer   // Validates and signs per-event finalizations (nil if this node does not finalize events)
+	finalizations   finalizationQueue  // Accepted submissions awaiting inclusion before they are finalized
+
+	EmergencyClinicians map[string]string // Provider ID -> did:key of clinicians authorized to break glass; identical on every node
+	ComplianceReviewers map[string]string // Reviewer ID -> did:key of compliance officers authorized to resolve break-glass reviews; identical on every node
+	GovernanceKeys      []string          // Keys authorized to sign schema registrations (base64 Ed25519); identical on every node
+	GovernanceQuorum    int               // Governance signatures needed per registration (0 means more than two thirds)
+	now        func() time.Time // Clock for block timestamps, rate limits and ban timing; see SetClock
+	spawn      func(func())     // Starts background peer work; see SetSpawner
 }
 
 func NewNetwork(listenAddr string, store *storage.Storage, apiPort int, pubKey, privKey []byte, chainState *state.ChainState, epochBlockCount int) *Network {
@@ -95,14 +139,30 @@ func NewNetwork(listenAddr string, store *storage.Storage, apiPort int, pubKey,
 		store:         store,
 		latestBlockID: [32]byte{},
 		recentBlocks:  make(map[string]struct{}),
-		bannedPeers:   make(map[string]time.Time),
 		peerRequestCounts: make(map[string][]time.Time),
-		banCounts:     make(map[string]int),
 		PrivKey:       privKey,
 		PubKey:        pubKey,
 
 		ProducersDynamic: make(map[string]struct{}),
 		MissedTurns:      make(map[string]int),
+		PeerMux:          http.NewServeMux(),
+		PeerConfig:       DefaultPeerManagerConfig(),
+		SyncConfig:       DefaultSyncConfig(),
+		Handshake:        DefaultHandshakeConfig(),
+		Scores:           NewPeerScoreManager(DefaultScoreConfig()),
+	}
+	if store != nil && store.DB() != nil {
+		n.AddrBook = NewAddressBook(store.DB())
+	} else {
+		n.AddrBook = NewAddressBook(nil)
+	}
+	if privKey != nil { // Otherwise the node key is on a token and UseSigner builds the transport
+		transport, err := NewTransport(pubKey, privKey, nil)
+		if err != nil {
+			fmt.Printf("[P2P] Authenticated transport unavailable: %v\n", err)
+		} else {
+			n.Transport = transport
+		}
 	}
 	cleanupProducerTable(n.ProducersDynamic)
 	// Always ensure own pubkey is present
@@ -114,37 +174,40 @@ func NewNetwork(listenAddr string, store *storage.Storage, apiPort int, pubKey,
 	// n.BanPeer("127.0.0.1", 10*time.Minute)
 	// n.BanPeer("127.0.0.2", 10*time.Minute)
 	if n.store != nil && n.store.DB() != nil {
-		n.LoadBanState()
+		n.Bans = NewBanManager(n.store.DB())
+	} else {
+		n.Bans = NewBanManager(nil)
 	}
 	return n
 }
 
-// LoadBanState loads persistent bans and ban counts from LevelDB
-func (n *Network) LoadBanState() {
-	imported := 0
-	iter := n.store.DB().NewIterator(nil, nil)
-	for iter.Next() {
-		key := iter.Key()
-		if len(key) > 4 && string(key[:4]) == "ban:" {
-			address := string(key[4:])
-			expiryStr := string(iter.Value())
-			expiry, err := time.Parse(time.RFC3339, expiryStr)
-			if err == nil {
-				n.bannedPeers[address] = expiry
-				imported++
-			}
-		}
-		if len(key) > 9 && string(key[:9]) == "banCount:" {
-			address := string(key[9:])
-			if len(iter.Value()) == 8 {
-				n.banCounts[address] = int(binary.BigEndian.Uint64(iter.Value()))
-			}
-		}
+// UseSigner makes key, typically held by a PKCS#11 token, the node key: it signs blocks and ban approvals
+// and authenticates the P2P transport. The private key is never read into memory.
+func (n *Network) UseSigner(key signer.Signer) error {
+	pub, ok := signer.PublicKey(key)
+	if !ok {
+		return signer.ErrNoKey
+	}
+	var keys *PeerKeySet
+	if n.Transport != nil {
+		keys = n.Transport.Keys
+	}
+	transport, err := NewSignerTransport(key, keys)
+	if err != nil {
+		return err
 	}
-	iter.Release()
-	fmt.Printf("[BAN LOAD] Imported %d persistent bans from DB\n", imported)
+	n.Signer, n.PrivKey, n.PubKey, n.Transport = key, nil, pub, transport
+	n.AddProducer(pub)
+	return nil
 }
 
+// nodeSigner returns the node key
+func (n *Network) nodeSigner() signer.Signer {
+	if n.Signer != nil {
+		return n.Signer
+	}
+	return ed25519.PrivateKey(n.PrivKey)
+}
 
 // RecoverTipFromStorage scans all blocks and sets the tip to the block at the end of the main chain
 func (n *Network) RecoverTipFromStorage() {
@@ -207,6 +270,7 @@ func (n *Network) RecoverTipFromStorage() {
 			n.lock.Lock()
 			n.latestBlockID = tipIDArr
 			n.lock.Unlock()
+			n.setHead(tipIDArr, blockMap[tipID].Height)
 			// Persist recovered tip to LevelDB
 			err = n.store.DB().Put([]byte("latestBlockID"), tipIDArr[:], nil)
 			if err != nil {
@@ -239,12 +303,39 @@ func (n *Network) SetLatestBlockID(id [32]byte) error {
         if err := n.store.DB().Put([]byte("latestBlockID"), id[:], nil); err != nil {
             return err
         }
+        if data, err := n.store.GetBlock(id[:]); err == nil {
+            if blk, err := block.Deserialize(data); err == nil {
+                n.setHead(id, blk.Height)
+            }
+        }
     }
     return nil
 }
 
+// setHead records the tip in ChainState, whose height schema validation reads
+func (n *Network) setHead(id [32]byte, height uint64) {
+	if n.ChainState != nil {
+		n.ChainState.SetHead(fmt.Sprintf("%x", id[:]), height)
+	}
+}
+
 // --- P2P TCP Communication ---
 
+// classifyInclusionFailure maps a failed SubmitRecordToBlock receipt onto a mempool error class.
+// Validation, signature and allowlist failures will never succeed on resubmission; anything
+// else (a same-block recordId clash, a revision whose target is not yet on chain) is worth retrying.
+func classifyInclusionFailure(receipt block.TransactionReceipt, err error) mempool.AdmissionResult {
+	for _, code := range receipt.Errors {
+		switch {
+		case strings.HasPrefix(code, "unauthorized_wallet"),
+			strings.HasPrefix(code, "validation_failed"),
+			strings.HasPrefix(code, "invalid_signature"):
+			return mempool.Rejected(mempool.ErrorClassPermanent, code)
+		}
+	}
+	return mempool.Rejected(mempool.ErrorClassRetryable, err.Error())
+}
+
 // ProduceBlock creates and broadcasts a new block with the current tip as parent, using the dynamic producer table.
 func (n *Network) ProduceBlock() error {
 	// RED DEBUG PRINT: Confirm block producer code is running
@@ -276,6 +367,31 @@ func (n *Network) ProduceBlock() error {
 	}
 
 
+	// Quorum-approved ban proposals (gathered before taking n.lock; the check reads the tip)
+	banEvents := n.readyBanEvents()
+	keyRotations := n.pendingKeyRotations()
+	// Quorum-signed epoch finalizations; filtered to completed epochs once the block's epoch is known
+	epochFinalizations := n.readyEpochFinalizations(math.MaxUint64)
+
+	// No other block commits while this one is built on the tip and applied; released before broadcasting,
+	// which may deliver blocks back to this node
+	n.commitMu.Lock()
+	committing := true
+	releaseCommit := func() {
+		if committing {
+			committing = false
+			n.commitMu.Unlock()
+		}
+	}
+	defer releaseCommit()
+
+	// Post-commit work reads the peer table under n.lock, so it runs after the deferred unlock below
+	var afterCommit func()
+	defer func() {
+		if afterCommit != nil {
+			afterCommit()
+		}
+	}()
 	n.lock.Lock()
 	defer n.lock.Unlock()
 
@@ -310,20 +426,128 @@ func (n *Network) ProduceBlock() error {
 		Height:          nextHeight,
 		PrevHash:        parentHash,
 		MerkleRoot:      "",
-		Timestamp:       time.Now(),
+		Timestamp:       n.Now(),
 		Events:          nil, // Will fill after processing
-		BanEvents:       nil, // TODO: gather pending ban events
+		BanEvents:       banEvents,
+		BanRoot:         block.BanEventsRoot(banEvents),
+		KeyRotations:    keyRotations,
+		KeyRotationRoot: block.KeyRotationsRoot(keyRotations),
 		ExtraData:       nil,
 		ValidatorDID:    fmt.Sprintf("ed25519:%x", n.PubKey), // Store public key as DID
 	}
 	if n.Mempool != nil {
-		txs := n.Mempool.GetAllTxs()
+		txs := emergencyFirst(n.Mempool.GetAllTxs()) // Break-glass requests are high priority
+		finalizing := make(map[string]bool) // Events finalized in this block
+		consenting := make(map[string]bool) // Grants created or revoked in this block
+		breaking := make(map[string]bool)   // Emergency accesses opened in this block
+		reviewing := make(map[string]bool)  // Emergency reviews closed in this block
+		registering := make(map[string]bool) // Schema activations registered in this block
 		for _, tx := range txs {
+			// Governance-signed schema registrations are written as schema_register events
+			if r, ok := block.ParseSchemaRegisterPayload(tx.Payload); ok {
+				if registering[schemaKey(r)] {
+					continue
+				}
+				if err := blockchain.VerifySchemaRegistration(n.store, r, n.GovernanceKeys, n.governanceQuorum(), newBlock.Height); err != nil {
+					if errors.Is(err, blockchain.ErrSchemaDuplicate) {
+						n.Mempool.RemoveTx(tx.TxID)
+					} else {
+						n.Mempool.RecordRejection(tx.TxID, schemaRegistrationResult(err))
+					}
+					continue
+				}
+				registering[schemaKey(r)] = true
+				evt := block.SchemaRegisterEvent(r)
+				newBlock.Events = append(newBlock.Events, evt)
+				events = append(events, evt)
+				includedTxIDs = append(includedTxIDs, tx.TxID)
+				continue
+			}
+			// Clinician break-glass requests are written as emergency_access events
+			if a, ok := block.ParseEmergencyAccessPayload(tx.Payload); ok {
+				if breaking[a.AccessID] {
+					continue
+				}
+				if err := blockchain.VerifyEmergencyAccess(n.store, a, n.EmergencyClinicians, newBlock.Timestamp); err != nil {
+					if errors.Is(err, blockchain.ErrEmergencyAccessDuplicate) {
+						n.Mempool.RemoveTx(tx.TxID)
+					} else {
+						n.Mempool.RecordRejection(tx.TxID, emergencyAccessResult(err))
+					}
+					continue
+				}
+				breaking[a.AccessID] = true
+				evt := block.EmergencyAccessEvent(a)
+				newBlock.Events = append(newBlock.Events, evt)
+				events = append(events, evt)
+				includedTxIDs = append(includedTxIDs, tx.TxID)
+				continue
+			}
+			// Compliance review resolutions are written as emergency_review events
+			if r, ok := block.ParseEmergencyReviewPayload(tx.Payload); ok {
+				if reviewing[r.AccessID] {
+					continue
+				}
+				if err := blockchain.VerifyEmergencyReview(n.store, r, n.ComplianceReviewers); err != nil {
+					if errors.Is(err, blockchain.ErrEmergencyReviewClosed) {
+						n.Mempool.RemoveTx(tx.TxID)
+					} else {
+						n.Mempool.RecordRejection(tx.TxID, emergencyAccessResult(err))
+					}
+					continue
+				}
+				reviewing[r.AccessID] = true
+				evt := block.EmergencyReviewEvent(r)
+				newBlock.Events = append(newBlock.Events, evt)
+				events = append(events, evt)
+				includedTxIDs = append(includedTxIDs, tx.TxID)
+				continue
+			}
+			// Patient consent grants and revocations are written as consent events
+			if c, ok := block.ParseConsentPayload(tx.Payload); ok {
+				if consenting[consentKey(c)] {
+					continue
+				}
+				if err := blockchain.VerifyConsent(n.store, c, newBlock.Timestamp); err != nil {
+					if errors.Is(err, blockchain.ErrConsentDuplicate) {
+						n.Mempool.RemoveTx(tx.TxID)
+					} else {
+						n.Mempool.RecordRejection(tx.TxID, consentResult(err))
+					}
+					continue
+				}
+				consenting[consentKey(c)] = true
+				evt := block.ConsentEvent(c)
+				newBlock.Events = append(newBlock.Events, evt)
+				events = append(events, evt)
+				includedTxIDs = append(includedTxIDs, tx.TxID)
+				continue
+			}
+			// Finalizations of already included records are written as finalize_event events
+			if fin, ok := block.ParseFinalizeEventPayload(tx.Payload); ok {
+				if finalizing[fin.EventID] {
+					continue
+				}
+				if _, status, err := blockchain.VerifyEventFinalization(n.store, fin, n.FinalizerKeys); status != block.FinalizationStatusFinalized {
+					if status == block.FinalizationStatusDuplicate {
+						n.Mempool.RemoveTx(tx.TxID)
+					} else {
+						n.Mempool.RecordRejection(tx.TxID, eventFinalizationResult(status, err))
+					}
+					continue
+				}
+				finalizing[fin.EventID] = true
+				evt := block.FinalizationEvent(fin)
+				newBlock.Events = append(newBlock.Events, evt)
+				events = append(events, evt)
+				includedTxIDs = append(includedTxIDs, tx.TxID)
+				continue
+			}
 			// Attempt to interpret each transaction as a medical record submission
 			var submission block.MedicalRecordSubmission
 			err := json.Unmarshal(tx.Payload, &submission)
 			if err != nil {
-
+				n.Mempool.RecordRejection(tx.TxID, mempool.Rejected(mempool.ErrorClassPermanent, "malformed payload: "+err.Error()))
 				continue // Skip invalid submissions
 			}
 			// Call SubmitRecordToBlock to process, validate, and append event
@@ -396,9 +620,9 @@ currentHeight--
 				}
 				//fmt.Printf("[LINEAGE] Final lineage for event: %v\n", docLineage)
 				submission.DocLineage = docLineage
-				_, err = block.SubmitRecordToBlock(submission, &newBlock)
+				receipt, err := block.SubmitRecordToBlock(submission, &newBlock)
 			if err != nil {
-
+				n.Mempool.RecordRejection(tx.TxID, classifyInclusionFailure(receipt, err))
 				continue // Skip failed submissions
 			}
 			// Find the event just appended (last in newBlock.Events)
@@ -428,18 +652,31 @@ currentHeight--
 		fmt.Printf("[EPOCH] Setting block epoch to 0 for genesis block\n")
 	}
 
+	for _, f := range epochFinalizations {
+		if f.EpochNumber < newBlock.Epoch {
+			newBlock.EpochFinalizations = append(newBlock.EpochFinalizations, f)
+		}
+	}
+	newBlock.FinalizationRoot = block.EpochFinalizationsRoot(newBlock.EpochFinalizations)
+	newBlock.EventFinalizationRoot = block.EventFinalizationsRoot(newBlock.Events)
+	newBlock.ConsentRoot = block.ConsentRoot(newBlock.Events)
+	newBlock.EmergencyAccessRoot = block.EmergencyAccessRoot(newBlock.Events)
+	newBlock.SchemaRoot = block.SchemaRoot(newBlock.Events)
+	newBlock.MerkleRoot = block.EventsRoot(newBlock.Events)
+
 	if len(includedTxIDs) > 0 {
 
 	}
 
 	// Compute BlockID first (for header hash)
 	newBlock.BlockID = newBlock.ComputeID()
-	// Sign the block header with Ed25519
-	if len(n.PrivKey) == 64 {
-		newBlock.Signature = core.Sign(n.PrivKey, newBlock.BlockID[:])
-	} else {
-		fmt.Println("[WARN] No valid Ed25519 private key loaded; block will not be signed!")
+	// Sign the block header with Ed25519; an unsigned block would be rejected by every peer, so nothing is
+	// stored and the transactions stay in the mempool
+	sig, err := signer.Sign(n.nodeSigner(), newBlock.BlockID[:])
+	if err != nil {
+		return fmt.Errorf("could not sign block %d: %v", newBlock.Height, err)
 	}
+	newBlock.Signature = sig
 
 	//fmt.Printf("[DEBUG] About to compute BlockID for Height %d, PrevHash %s\n", newBlock.Height, newBlock.PrevHash)
 	//fmt.Printf("[DEBUG] Computed BlockID: %x\n", newBlock.BlockID[:])
@@ -462,6 +699,7 @@ if len(newBlock.Signature) > 0 {
 		return fmt.Errorf("could not update latestBlockID: %v", err)
 	}
 	n.latestBlockID = newBlock.BlockID
+	n.setHead(newBlock.BlockID, newBlock.Height)
 
 	// Remove included transactions from the mempool
 	if n.Mempool != nil && len(includedTxIDs) > 0 {
@@ -472,47 +710,19 @@ if len(newBlock.Signature) > 0 {
 	}
 	fmt.Printf("[CHAIN] Block produced at height %d (BlockID: %x)\n", newBlock.Height, newBlock.BlockID[:])
 
-	// --- Epoch Finalization Enhancement for Local Block Production ---
-	if n.ChainState != nil {
-		n.ChainState.BlocksInEpoch++
-		if n.ChainState.BlocksInEpoch >= uint64(n.EpochBlockCount) {
-			epochNumber := n.ChainState.Epoch
-			// Compute Merkle root for the epoch
-			epochSummaryHash, err := blockchain.ComputeEpochMerkleRoot(epochNumber, n.store)
-			if err != nil {
-				fmt.Println("[EPOCH] Failed to compute epoch Merkle root:", err)
-			} else {
-				// Sign the epoch summary hash with the block producer's key
-				finalizerSignature := ""
-				if len(n.PrivKey) == 64 {
-					sigBytes := core.Sign(n.PrivKey, []byte(epochSummaryHash))
-					finalizerSignature = hex.EncodeToString(sigBytes)
-				}
-				auditLogID := "" // TODO: wire in real audit log ID
-				_, receipt, err := blockchain.FinalizeEpoch(n.store, n.ChainState, epochNumber, finalizerSignature, auditLogID)
-				if err != nil {
-					fmt.Println("[EPOCH] FinalizeEpoch failed:", err)
-				} else {
-					fmt.Printf("\033[33m[EPOCH FINALIZED] Epoch %d finalized. Receipt: %+v\033[0m\n", epochNumber, receipt)
-				}
-				n.ChainState.Epoch++
-				n.ChainState.BlocksInEpoch = 0
-			}
-		}
-		err := n.ChainState.SaveEpochState()
-		if err != nil {
-			fmt.Printf("[EPOCH] Failed to persist epoch state: %v\n", err)
-		}
-	}
-
 	blkIDHex := fmt.Sprintf("%x", newBlock.BlockID[:])
-	// --- Compact propagation: announce block header first ---
-	n.BroadcastBlockAnnouncement(blkIDHex, newBlock.Height, newBlock.PrevHash, newBlock.Timestamp.Unix())
-	// --- Optionally: short delay to let peers request block (not required) ---
-	// time.Sleep(100 * time.Millisecond)
+	afterCommit = func() {
+		n.blockCommitted(newBlock)
+		releaseCommit()
+
+		// --- Compact propagation: announce block header first ---
+		n.BroadcastBlockAnnouncement(blkIDHex, newBlock.Height, newBlock.PrevHash, newBlock.Timestamp.Unix())
+		// --- Optionally: short delay to let peers request block (not required) ---
+		// time.Sleep(100 * time.Millisecond)
 
-	// --- Fallback: still broadcast full block for backward compatibility ---
-	n.BroadcastNewBlock(blkBytes, blkIDHex)
+		// --- Fallback: still broadcast full block for backward compatibility ---
+		n.BroadcastNewBlock(blkBytes, blkIDHex)
+	}
 
 
 	return nil
@@ -522,17 +732,27 @@ if len(newBlock.Signature) > 0 {
 
 
 func (n *Network) Start() error {
+	if n.Transport == nil {
+		return fmt.Errorf("cannot start P2P listener without an authenticated transport")
+	}
 	ln, err := net.Listen("tcp", n.listenAddr)
 	if err != nil {
 		return err
 	}
+	rpc := newRPCListener(ln.Addr())
+	go func() {
+		srv := &http.Server{Handler: n.PeerMux, ReadHeaderTimeout: handshakeTimeout}
+		if err := srv.Serve(rpc); err != nil {
+			fmt.Printf("[P2P] Peer RPC server stopped: %v\n", err)
+		}
+	}()
 	go func() {
 		for {
 			conn, err := ln.Accept()
 			if err != nil {
 				continue
 			}
-			go n.handleConnection(conn)
+			go n.acceptConnection(conn, rpc)
 		}
 	}()
 
@@ -540,15 +760,8 @@ func (n *Network) Start() error {
 	return nil
 }
 
-// handleConnection handles an incoming connection from a peer
-func (n *Network) handleConnection(conn net.Conn) {
-	defer func() {
-		// On connection close, clean up disconnected producers
-		n.RemoveDisconnectedProducers()
-		conn.Close()
-	}()
-	defer conn.Close()
-
+// acceptConnection authenticates an incoming connection and dispatches it by ALPN protocol
+func (n *Network) acceptConnection(conn net.Conn, rpc *rpcListener) {
 	// --- Ban enforcement for incoming P2P connections (by IP only) ---
 	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
 	if err != nil {
@@ -556,9 +769,46 @@ func (n *Network) handleConnection(conn net.Conn) {
 	}
 	if n.IsPeerBanned(host) {
 		fmt.Printf("[BAN] Rejected incoming P2P connection from banned peer: %s\n", host)
+		conn.Close()
+		return
+	}
+
+	tlsConn := tls.Server(conn, n.Transport.ServerTLSConfig())
+	tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		fmt.Printf("[P2P] Rejected connection from %s: %v\n", host, err)
+		tlsConn.Close()
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+	if n.IsNodeBanned(PeerKey(tlsConn.ConnectionState())) {
+		fmt.Printf("[BAN] Rejected connection from banned node %x (%s)\n", PeerKey(tlsConn.ConnectionState()), host)
+		tlsConn.Close()
 		return
 	}
 
+	switch tlsConn.ConnectionState().NegotiatedProtocol {
+	case ALPNPeerRPC:
+		rpc.deliver(tlsConn)
+	case ALPNHandshake:
+		n.handleConnection(tlsConn)
+	case ALPNKeyRotation:
+		n.handleKeyRotationConn(tlsConn)
+	default:
+		fmt.Printf("[P2P] Rejected connection from %s: no supported protocol\n", host)
+		tlsConn.Close()
+	}
+}
+
+// handleConnection runs the hello handshake on an authenticated incoming connection
+func (n *Network) handleConnection(conn *tls.Conn) {
+	defer func() {
+		// On connection close, clean up disconnected producers
+		n.RemoveDisconnectedProducers()
+		conn.Close()
+	}()
+	defer conn.Close()
+
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 	reader := bufio.NewReader(conn)
 
@@ -568,12 +818,28 @@ func (n *Network) handleConnection(conn net.Conn) {
 		return
 	}
 
-	var peerHello Peer
-	err = json.Unmarshal(line, &peerHello)
+	var remoteHello HelloMessage
+	err = json.Unmarshal(line, &remoteHello)
 	if err != nil {
 		fmt.Println(" Peer hello parse error:", err)
 		return
 	}
+	// The hello's key must be the one the peer proved possession of during the TLS handshake
+	peerKey := PeerKey(conn.ConnectionState())
+	if !bytes.Equal(remoteHello.PubKey, peerKey) {
+		fmt.Printf("[P2P] Rejected hello from %s: claimed key does not match authenticated key\n", conn.RemoteAddr())
+		return
+	}
+	// Same chain and a common protocol version, or the peer is told why and disconnected
+	peerHello, err := NegotiateHello(n.localHello(Peer{}), remoteHello)
+	if err != nil {
+		fmt.Printf("[HANDSHAKE] Rejected peer %s: %v\n", conn.RemoteAddr(), err)
+		if reject, merr := json.Marshal(HelloMessage{Reject: err.Error()}); merr == nil {
+			conn.Write(append(reject, '\n'))
+		}
+		return
+	}
+	fmt.Printf("[HANDSHAKE] Peer %s: protocol v%d, role %s, features %v\n", conn.RemoteAddr(), peerHello.ProtocolVersion, peerHello.Role, peerHello.Features)
 	// Patch HostOnly if missing (for backward compatibility)
 	if peerHello.HostOnly == "" {
 		host, _, _ := net.SplitHostPort(peerHello.Address)
@@ -597,7 +863,11 @@ func (n *Network) handleConnection(conn net.Conn) {
 // Print raw incoming address for debug
 fmt.Printf("[DEBUG] Raw incoming peerHello.Address: '%s'\n", peerHello.Address)
 // Always use the remote address's host part, ignore what the peer sent!
+// The port is the peer's advertised P2P listen port, so the address can be dialed for RPC.
 remoteHost, remotePort, _ := net.SplitHostPort(conn.RemoteAddr().String())
+if _, listenPort, err := net.SplitHostPort(peerHello.Address); err == nil && listenPort != "" {
+	remotePort = listenPort
+}
 address := net.JoinHostPort(remoteHost, remotePort) // Use P2P port!
 fmt.Printf("[DEBUG] handleConnection: Forced peer address: '%s' (P2P), API Port: %d\n", address, peerHello.APIPort)
 peerHello.Address = address // Always set to canonical host:port
@@ -609,6 +879,9 @@ for i, p := range n.peers {
 		n.peers[i].ChainHeight = peerHello.ChainHeight
 		n.peers[i].TipBlockID = peerHello.TipBlockID
 		n.peers[i].LastSeen = peerHello.LastSeen
+		n.peers[i].ProtocolVersion = peerHello.ProtocolVersion
+		n.peers[i].Role = peerHello.Role
+		n.peers[i].Features = peerHello.Features
 		found = true
 		break
 	}
@@ -620,8 +893,14 @@ if !found {
 		ChainHeight: peerHello.ChainHeight,
 		TipBlockID:  peerHello.TipBlockID,
 		LastSeen:    peerHello.LastSeen,
+		HostOnly:    remoteHost,
+		PubKey:      peerKey,
+		ProtocolVersion: peerHello.ProtocolVersion,
+		Role:            peerHello.Role,
+		Features:        peerHello.Features,
 	})
 }
+n.AddrBook.Add(address, peerKey, AddrSourceInbound)
 fmt.Printf("[DEBUG] Peer table after update:\n")
 for _, p := range n.peers {
 	fmt.Printf("    - P2P Address: '%s', API Port: %d, Height: %d, Tip: %s\n", p.Address, p.APIPort, p.ChainHeight, p.TipBlockID)
@@ -640,19 +919,20 @@ n.lock.Unlock();
 
 	// --- Always trigger sync logic, let it decide ---
 	fmt.Printf("[SYNC DECISION] Triggering sync logic for peer %s\n", address)
-	go n.SyncFullChainFromPeer(address)
+	n.goAsync(func() { n.SyncFullChainFromPeer(address) })
+	n.reconcileMempoolWith(address)
 
 
 	// --- Send our own hello back for two-way handshake ---
 	myTipID := n.GetLatestBlockID()
-	myHello := Peer{
+	myHello := n.localHello(Peer{
 		Address:     n.listenAddr,
 		APIPort:     n.apiPort,
 		ChainHeight: n.getChainHeight(),
 		TipBlockID:  fmt.Sprintf("%x", myTipID[:]),
 		LastSeen:    time.Now().UTC(),
 		PubKey:      n.PubKey, // include our public key in handshake
-	}
+	})
 	fmt.Println("[HANDSHAKE] After sending hello, dynamic producer table:")
 	PrintProducerTable(n.ProducersDynamic)
 	myHelloBytes, err := json.Marshal(myHello)
@@ -670,17 +950,23 @@ func (n *Network) ConnectToPeer(address string) error {
 		// After connection attempt, clean up disconnected producers
 		n.RemoveDisconnectedProducers()
 	}()
-	conn, err := net.Dial("tcp", address)
+	if n.Transport == nil {
+		return fmt.Errorf("no authenticated transport configured")
+	}
+	conn, err := n.Transport.Dial(address)
 	if err != nil {
-		return fmt.Errorf("tcp dial failed: %w", err)
+		return fmt.Errorf("authenticated dial failed: %w", err)
 	}
 	defer conn.Close()
+	if n.IsNodeBanned(PeerKey(conn.ConnectionState())) {
+		return fmt.Errorf("node %x is banned", PeerKey(conn.ConnectionState()))
+	}
 
 	tipID := n.GetLatestBlockID()
 
 	// Step 1: Send JSON hello over TCP
 	host, _, _ := net.SplitHostPort(n.listenAddr)
-	hello := Peer{
+	hello := n.localHello(Peer{
 		Address:     n.listenAddr,
 		APIPort:     n.apiPort, // <--- ensure this is correct
 		ChainHeight: n.getChainHeight(),
@@ -688,7 +974,7 @@ func (n *Network) ConnectToPeer(address string) error {
 		LastSeen:    time.Now().UTC(),
 		HostOnly:    host,
 		PubKey:      n.PubKey, // include our public key in handshake
-	}
+	})
 	fmt.Printf("[DEBUG] Sending hello: Addr=%s, APIPort=%d\n", hello.Address, hello.APIPort)
 
 	helloBytes, err := json.Marshal(hello)
@@ -707,12 +993,21 @@ func (n *Network) ConnectToPeer(address string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read peer hello: %w", err)
 	}
-	var peerHello Peer
-	err = json.Unmarshal(peerHelloLine, &peerHello)
+	var remoteHello HelloMessage
+	err = json.Unmarshal(peerHelloLine, &remoteHello)
 	if err != nil {
 		return fmt.Errorf("failed to parse peer hello: %w", err)
 	}
-	fmt.Printf("[DEBUG] Received peerHello from connect: Addr=%s, APIPort=%d, ChainHeight=%d\n", peerHello.Address, peerHello.APIPort, peerHello.ChainHeight)
+	fmt.Printf("[DEBUG] Received peerHello from connect: Addr=%s, APIPort=%d, ChainHeight=%d\n", remoteHello.Address, remoteHello.APIPort, remoteHello.ChainHeight)
+	peerHello, err := NegotiateHello(hello, remoteHello)
+	if err != nil {
+		fmt.Printf("[HANDSHAKE] Rejected peer %s: %v\n", address, err)
+		return err
+	}
+	if !bytes.Equal(peerHello.PubKey, PeerKey(conn.ConnectionState())) {
+		return fmt.Errorf("peer hello key does not match authenticated key")
+	}
+	fmt.Printf("[HANDSHAKE] Peer %s: protocol v%d, role %s, features %v\n", address, peerHello.ProtocolVersion, peerHello.Role, peerHello.Features)
 
 	// === DYNAMIC PRODUCER TABLE: Add peer (if pubkey available) ===
 	// TODO: Extract and use peer's public key when available
@@ -729,6 +1024,8 @@ func (n *Network) ConnectToPeer(address string) error {
     remoteHost, remotePort, _ := net.SplitHostPort(conn.RemoteAddr().String())
     canonicalAddr := net.JoinHostPort(remoteHost, remotePort) // Use P2P port!
     peerHello.Address = canonicalAddr
+    peerHello.HostOnly = remoteHost
+    peerHello.Outbound = true
 
     n.lock.Lock()
     found := false
@@ -743,70 +1040,11 @@ func (n *Network) ConnectToPeer(address string) error {
         n.peers = append(n.peers, peerHello)
     }
     n.lock.Unlock()
+    n.AddrBook.MarkGood(canonicalAddr, peerHello.PubKey)
+    n.reconcileMempoolWith(canonicalAddr)
 
-	// Step 2: Launch async sync check (via HTTP)
-	go func(peerAddr string) {
-		// Always use peer's API port for chain tip and block requests
-		fmt.Println("[DEBUG] Peer table before getPeerAPIPort in ConnectToPeer chain tip call:")
-		printPeerTable(n.peers)
-		fmt.Printf("[DEBUG] Looking up API port for: %s\n", peerAddr)
-		apiPort := n.getPeerAPIPort(peerAddr)
-		fmt.Printf("[DEBUG] Got API port: %d\n", apiPort)
-		host, _, err := net.SplitHostPort(peerAddr)
-		if err != nil {
-			host = peerAddr
-		}
-		// Chain tip URL (if needed)
-		tipURL := fmt.Sprintf("http://%s:%d/get_chain_tip", host, apiPort)
-		fmt.Printf("[DEBUG] get_chain_tip URL: %s\n", tipURL)
-		// Request block URL
-		requestBlockURL := fmt.Sprintf("http://%s:%d/request_block", host, apiPort)
-		fmt.Printf("[DEBUG] request_block URL: %s\n", requestBlockURL)
-
-		// Example: fetch block (replace with actual logic as needed)
-		payload := map[string]string{
-			"blockID": fmt.Sprintf("%x", tipID[:]),
-		}
-		body, _ := json.Marshal(payload)
-		resp, err := http.Post(requestBlockURL, "application/json", bytes.NewReader(body))
-		if err != nil {
-			fmt.Printf("Could not fetch chain tip from %s: %v\n", peerAddr, err)
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("Could not fetch chain tip from %s: %s\n", peerAddr, resp.Status)
-			return
-		}
-		blockBytes, _ := io.ReadAll(resp.Body)
-		fmt.Printf("[SYNC_BLOCK] Block as string: %s\n", string(blockBytes))
-
-		blkPtr, err := block.Deserialize(blockBytes)
-		if err != nil {
-			fmt.Printf("❌ Failed to deserialize peer block from %s: %v\n", peerAddr, err)
-			return
-		}
-		blk := *blkPtr
-
-		// Save block
-		err = n.store.SaveBlock(blk.BlockID[:], blockBytes)
-		if err != nil {
-			fmt.Printf("❌ Failed to save block from %s: %v\n", peerAddr, err)
-			return
-		}
-
-		// Update tip
-		n.lock.Lock()
-n.latestBlockID = blk.BlockID
-n.lock.Unlock()
-if n.store != nil && n.store.DB() != nil {
-    err := n.store.DB().Put([]byte("latestBlockID"), blk.BlockID[:], nil)
-    if err != nil {
-        fmt.Printf("[ERROR] Failed to persist latest block ID: %v\n", err)
-    }
-}
-		fmt.Printf("✅ Synced block %x from %s\n", blk.BlockID[:], peerAddr)
-	}(address)
+	// Step 2: Sync over the authenticated channel, same as for incoming peers
+	n.goAsync(func() { n.SyncFullChainFromPeer(canonicalAddr) })
 
 	return nil
 }
@@ -853,11 +1091,11 @@ func (n *Network) getPeerHeightFromTable(address string) int {
 	return 0
 }
 
-// SyncFullChainFromPeer fetches all missing blocks from a peer until fully synced, with rate limiting and only if peer is ahead
+// SyncFullChainFromPeer catches up with the network when address is ahead of us, using headers-first sync.
+// address is asked for headers first; bodies are fetched in parallel from every peer that is ahead.
 func (n *Network) SyncFullChainFromPeer(address string) error {
 	myHeight := n.getChainHeight()
 	peerHeight := n.getPeerHeightFromTable(address)
-	fmt.Printf("[DEBUG] After getPeerHeightFromTable: peerHeight=%d\n", peerHeight)
 	fmt.Printf("[SYNC] My height: %d, Peer height: %d\n", myHeight, peerHeight)
 	// Only sync if peer is ahead
 	if peerHeight <= myHeight {
@@ -869,51 +1107,11 @@ func (n *Network) SyncFullChainFromPeer(address string) error {
 		fmt.Println("[SYNC] Rate limit: skipping sync for peer.")
 		return nil
 	}
-	for h := myHeight; h < peerHeight; h++ {
-		blockID, err := n.getPeerBlockIDByHeight(address, h)
-		if err != nil {
-			fmt.Printf("❌ [SYNC ERROR] Failed to get blockID for height %d: %v\n", h, err)
-			return fmt.Errorf("sync aborted: failed to get blockID for height %d: %v", h, err)
-		}
-		blockBytes, err := n.RequestBlockFromPeer(address, blockID)
-		if err != nil {
-			fmt.Printf("❌ [SYNC ERROR] Failed to fetch block at height %d: %v\n", h, err)
-			return fmt.Errorf("sync aborted: failed to fetch block at height %d: %v", h, err)
-		}
-		blkPtr, err := block.Deserialize(blockBytes)
-		if err != nil {
-			fmt.Printf("❌ [SYNC ERROR] Failed to deserialize block at height %d: %v\n", h, err)
-			return fmt.Errorf("sync aborted: failed to deserialize block at height %d: %v", h, err)
-		}
-		err = n.store.SaveBlock(blkPtr.BlockID[:], blockBytes)
-		if err != nil {
-			fmt.Printf("❌ [SYNC ERROR] Failed to save block at height %d: %v\n", h, err)
-			return fmt.Errorf("sync aborted: failed to save block at height %d: %v", h, err)
-		}
-		n.lock.Lock()
-n.latestBlockID = blkPtr.BlockID
-n.lock.Unlock()
-if n.store != nil && n.store.DB() != nil {
-    err := n.store.DB().Put([]byte("latestBlockID"), blkPtr.BlockID[:], nil)
-    if err != nil {
-        fmt.Printf("[ERROR] Failed to persist latest block ID: %v\n", err)
-    }
-}
-		fmt.Printf("✅ Synced block %x at height %d from peer\n", blkPtr.BlockID[:], h)
-	}
-
-	// After sync, compare tips
-	myTip := n.GetLatestBlockID()
-	peerTip, err := n.getPeerBlockIDByHeight(address, peerHeight-1)
-	if err != nil {
-		fmt.Printf("[SYNC WARNING] Could not fetch peer tip blockID for comparison: %v\n", err)
-	} else {
-		if myTip != peerTip {
-			fmt.Printf("[SYNC WARNING] After sync, tip mismatch! Local tip: %x, Peer tip: %x\n", myTip[:], peerTip[:])
-		} else {
-			fmt.Printf("[SYNC] After sync, tips match: %x\n", myTip[:])
-		}
+	if err := n.HeadersFirstSync(address, n.SyncConfig); err != nil {
+		fmt.Printf("❌ [SYNC ERROR] %v\n", err)
+		return fmt.Errorf("sync aborted: %v", err)
 	}
+	fmt.Printf("[SYNC] Local tip is now %x at height %d\n", n.GetLatestBlockID(), n.getChainHeight())
 	return nil
 }
 
@@ -929,9 +1127,9 @@ if err != nil {
     host = address
 }
 fmt.Printf("[DEBUG] getPeerChainHeight: host=%s, apiPort=%d\n", host, apiPort)
-url := fmt.Sprintf("http://%s:%d/chain_height", host, apiPort)
+url := PeerURL(address, "/chain_height")
 fmt.Printf("[DEBUG] getPeerChainHeight URL: %s\n", url)
-	resp, err := http.Get(url)
+	resp, err := n.peerHTTP().Get(url)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get peer chain height: %v", err)
 	}
@@ -951,9 +1149,9 @@ host, _, err := net.SplitHostPort(address)
 if err != nil {
     host = address
 }
-url := fmt.Sprintf("http://%s:%d/blocks?start=%d&end=%d", host, apiPort, height, height)
-fmt.Printf("[DEBUG] getPeerBlockIDByHeight URL: %s\n", url)
-	resp, err := http.Get(url)
+url := PeerURL(address, fmt.Sprintf("/blocks?start=%d&end=%d", height, height))
+fmt.Printf("[DEBUG] getPeerBlockIDByHeight URL: %s (host=%s, apiPort=%d)\n", url, host, apiPort)
+	resp, err := n.peerHTTP().Get(url)
 	if err != nil {
 		return [32]byte{}, fmt.Errorf("failed to get peer block by height: %v", err)
 	}
@@ -1022,76 +1220,158 @@ func (n *Network) reclaimAndDiscardOrphanBlock(blk block.Block) {
 func (n *Network) SaveNewBlock(blk block.Block) error {
 	fmt.Println("[DEBUG] Entered SaveNewBlock for block height:", blk.Height, "blockID:", blk.BlockID)
 
-	// --- Epoch tracking ---
-	if n.ChainState != nil {
-		// Increment BlocksInEpoch
-		n.ChainState.BlocksInEpoch++
-		fmt.Println("[DEBUG] Checking for epoch boundary: BlocksInEpoch=", n.ChainState.BlocksInEpoch, "EpochBlockCount=", n.EpochBlockCount)
-		// Get EpochBlockCount (assume field for now)
-		if n.ChainState.BlocksInEpoch >= uint64(n.EpochBlockCount) { // epoch boundary
-			// Epoch-end logic: finalize the epoch
-			finalizerSignature := "" // TODO: wire in real signature
-			auditLogID := "" // TODO: wire in real audit log ID
-			epochNumber := n.ChainState.Epoch
-			_, receipt, err := blockchain.FinalizeEpoch(n.store, n.ChainState, epochNumber, finalizerSignature, auditLogID)
-			if err != nil {
-				fmt.Println("[EPOCH] FinalizeEpoch failed:", err)
-			} else {
-				fmt.Printf("\033[33m[EPOCH FINALIZED] Epoch %d finalized. Receipt: %+v\033[0m\n", epochNumber, receipt)
-			}
-			// Advance epoch
-			n.ChainState.Epoch++
-			n.ChainState.BlocksInEpoch = 0
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[PANIC] SaveNewBlock panicked: %v\n", r)
+			debug.PrintStack()
 		}
-		// Persist epoch state
-		err := n.ChainState.SaveEpochState()
-		if err != nil {
-			fmt.Printf("[EPOCH] Failed to persist epoch state: %v\n", err)
+	}()
+
+	committed, err := n.commitBlock(blk, nil)
+	if errors.Is(err, errNotOnTip) {
+		fmt.Printf("[ORPHAN] Block %x is an orphan (%v). Discarding and reclaiming transactions.\n", blk.BlockID[:], err)
+		n.reclaimAndDiscardOrphanBlock(blk)
+		n.goAsync(func() { n.HandleForkChoiceReorg("", 0, "") }) // non-blocking fork-choice reorg
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !committed {
+		fmt.Printf("Block %x is already committed. Skipping save.\n", blk.BlockID[:])
+		return nil
+	}
+	fmt.Printf("[CHAIN] Block accepted at height %d (BlockID: %x)\n", blk.Height, blk.BlockID[:])
+	chain.ConsecutiveFallbacks = 0
+	fmt.Println("[FALLBACK] Reset fallback counter after accepting new block")
+	return nil
+}
+
+// errNotOnTip is returned by commitBlock for a block that does not extend the current tip
+var errNotOnTip = errors.New("block does not extend the tip")
+
+// commitBlock verifies blk and commits it as the new tip; raw is its stored form (nil to serialize blk).
+// Gossiped, synced and fork-choice blocks all commit through it. Under commitMu the tip it is checked
+// against cannot move before its sections are applied, and a block already committed (committed false,
+// no error) is never applied twice. A block not extending the tip returns errNotOnTip.
+func (n *Network) commitBlock(blk block.Block, raw []byte) (committed bool, err error) {
+	n.commitMu.Lock()
+	defer n.commitMu.Unlock()
+	return n.commitLocked(blk, raw)
+}
+
+// commitLocked is commitBlock for a caller holding commitMu
+func (n *Network) commitLocked(blk block.Block, raw []byte) (committed bool, err error) {
+	if n.alreadyCommitted(blk) {
+		return false, nil
+	}
+	tip := n.GetLatestBlockID()
+	isGenesis := blk.PrevHash == "" || blk.PrevHash == strings.Repeat("0", len(blk.PrevHash))
+	if blk.PrevHash != fmt.Sprintf("%x", tip[:]) && !(isGenesis && tip == [32]byte{}) {
+		return false, fmt.Errorf("%w: PrevHash %s, tip %x", errNotOnTip, blk.PrevHash, tip[:])
+	}
+	if err := n.verifyBlock(blk); err != nil {
+		return false, err
+	}
+	if raw == nil {
+		if raw, err = blk.Serialize(); err != nil {
+			return false, fmt.Errorf("could not serialize block %d: %v", blk.Height, err)
 		}
 	}
+	if err := n.store.SaveBlock(blk.BlockID[:], raw); err != nil {
+		return false, fmt.Errorf("could not save block %d: %v", blk.Height, err)
+	}
+	n.lock.Lock()
+	err = n.store.DB().Put([]byte("latestBlockID"), blk.BlockID[:], nil)
+	if err == nil {
+		n.latestBlockID = blk.BlockID
+		n.setHead(blk.BlockID, blk.Height)
+	}
+	n.lock.Unlock()
+	if err != nil {
+		return false, fmt.Errorf("could not update latestBlockID: %v", err)
+	}
+	n.blockCommitted(blk)
+	return true, nil
+}
 
-    defer func() {
-        if r := recover(); r != nil {
-            fmt.Printf("[PANIC] SaveNewBlock panicked: %v\n", r)
-            debug.PrintStack()
-        }
-    }()
+// blockSection is one kind of transaction a block carries. verify checks the block's transactions of that
+// kind against chain state before the block is stored; commit applies them once it is committed. Neither
+// sees a block twice: commitBlock drops blocks already committed before verifying them. undo reverts what
+// commit applied when a reorg rolls the block back off the tip.
+type blockSection struct {
+	tag    string // Log tag of rejections
+	verify func(n *Network, blk block.Block) error
+	commit func(n *Network, blk block.Block)
+	undo   func(n *Network, blk block.Block)
+}
 
-    // --- Apply all BanEvents in this block to the local ban list ---
-    n.lock.Lock()
-    for _, ban := range blk.BanEvents {
-        expiry, err := ban.ExpiryTime()
-        if err == nil {
-            n.bannedPeers[ban.Address] = expiry
-        }
-    }
-    n.lock.Unlock()
+// blockSections lists the sections in the order they are verified and applied
+var blockSections = []blockSection{
+	// Quorum-approved BanEvents; a block carrying unapproved or tampered bans is rejected
+	{"[BAN CONSENSUS]", (*Network).verifyBanEvents, (*Network).recordBanEvents, (*Network).revertBanEvents},
+	// Node key rotations; a forged, repeated or banned-key rotation rejects the block
+	{"[KEYS]", (*Network).verifyKeyRotations, (*Network).recordKeyRotations, (*Network).revertKeyRotations},
+	// Patient consent; a forged, repeated or dangling grant or revocation rejects the block
+	{"[CONSENT]", (*Network).verifyConsentEvents, (*Network).recordConsentEvents, (*Network).revertConsentEvents},
+	// Break-glass access and its review; an unauthorized, expired or repeated one rejects the block
+	{"[EMERGENCY]", (*Network).verifyEmergencyAccessEvents, (*Network).recordEmergencyAccessEvents, (*Network).revertEmergencyAccessEvents},
+	// Schema registrations; an under-signed, retroactive or conflicting one rejects the block
+	{"[SCHEMA]", (*Network).verifySchemaRegistrations, (*Network).recordSchemaRegistrations, (*Network).revertSchemaRegistrations},
+	// Medical records, checked against MerkleRoot by verifyBlock and indexed for lookups
+	{"[INDEX]", nil, (*Network).indexRecordEvents, (*Network).unindexRecordEvents},
+	// Per-event finalizations; an unauthorized, misdirected or repeated one rejects the block
+	{"[FINALIZE]", (*Network).verifyEventFinalizations, (*Network).recordEventFinalizations, (*Network).revertEventFinalizations},
+	// Quorum-signed epoch finalizations; a duplicate, conflicting or under-signed one rejects the block
+	{"[EPOCH]", (*Network).verifyEpochFinalizations, (*Network).recordEpochFinalizations, (*Network).revertEpochFinalizations},
+}
 
-    // Strict tip check and update under a single lock
-    n.lock.Lock()
-    defer n.lock.Unlock()
+// verifyBlock runs every consensus check a block must pass before it is stored, whether it arrives as a new
+// block or through sync
+func (n *Network) verifyBlock(blk block.Block) error {
+	// --- The block's events must match its MerkleRoot (the genesis root pins the record schema instead) ---
+	if err := verifyEventsRoot(blk); err != nil {
+		fmt.Printf("[CHAIN] Rejecting block: %v\n", err)
+		return err
+	}
+	for _, sec := range blockSections {
+		if sec.verify == nil {
+			continue
+		}
+		if err := sec.verify(n, blk); err != nil {
+			fmt.Printf("%s Rejecting block: %v\n", sec.tag, err)
+			return err
+		}
+	}
+	return nil
+}
 
-    currentTipHex := fmt.Sprintf("%x", n.latestBlockID[:])
-    isGenesis := blk.PrevHash == "" || blk.PrevHash == strings.Repeat("0", len(blk.PrevHash))
-    fmt.Printf("[DEBUG] Before block acceptance: currentTip=%s, incoming.PrevHash=%s, incoming.BlockID=%s\n", currentTipHex, blk.PrevHash, blk.BlockID)
+// indexRecordEvents indexes the medical records of a committed block
+func (n *Network) indexRecordEvents(blk block.Block) {
+	if err := blockchain.IndexRecordEvents(n.store, blk); err != nil {
+		fmt.Printf("[INDEX] Failed to index medical records of block %d: %v\n", blk.Height, err)
+	}
+}
 
-    if blk.BlockID == n.latestBlockID {
-        fmt.Printf("Block %x is already the tip. Skipping save.\n", blk.BlockID[:])
-        return nil
-    }
+// unindexRecordEvents removes the medical records of a rolled-back block from the index
+func (n *Network) unindexRecordEvents(blk block.Block) {
+	if err := blockchain.UnindexRecordEvents(n.store, blk); err != nil {
+		fmt.Printf("[INDEX] Failed to unindex medical records of block %d: %v\n", blk.Height, err)
+	}
+}
 
-    if !isGenesis && blk.PrevHash != currentTipHex {
-		fmt.Printf("[CHAIN] Block accepted at height %d (BlockID: %x)\n", blk.Height, blk.BlockID[:])
-        chain.ConsecutiveFallbacks = 0
-        fmt.Println("[FALLBACK] Reset fallback counter after accepting new block")
-    } else {
-        fmt.Printf("[ORPHAN] Block %x is an orphan (PrevHash %s does not match current tip %s). Discarding and reclaiming transactions.\n", blk.BlockID[:], blk.PrevHash, currentTipHex)
-        n.reclaimAndDiscardOrphanBlock(blk)
-        fmt.Println("[DEBUG] After orphan discard, before fork-choice reorg")
-        go n.HandleForkChoiceReorg("", 0, "") // non-blocking fork-choice reorg
-        return nil
-    }
-    return nil
+// alreadyCommitted reports whether blk is the tip or a stored block that does not extend the tip.
+// Caller must not hold n.lock.
+func (n *Network) alreadyCommitted(blk block.Block) bool {
+	tip := n.GetLatestBlockID()
+	if blk.BlockID == tip {
+		return true
+	}
+	if n.store == nil || blk.PrevHash == fmt.Sprintf("%x", tip[:]) {
+		return false
+	}
+	existing, err := n.store.GetBlock(blk.BlockID[:])
+	return err == nil && existing != nil
 }
 
 // RefreshPeerHeights actively queries all peers for their latest chain heights
@@ -1149,14 +1429,21 @@ func (n *Network) CheckPeerTips() []map[string]interface{} {
 			status = "tip mismatch"
 		}
 
-		report = append(report, map[string]interface{}{
+		entry := map[string]interface{}{
 			"peerAddress":  peer.Address,
 			"peerHeight":   peer.ChainHeight,
 			"peerTipBlock": peer.TipBlockID,
 			"myHeight":     myHeight,
 			"myTipBlock":   myTip,
 			"status":       status,
-		})
+		}
+		if n.Scores != nil {
+			score := n.Scores.Get(peerIdentity(peer.Address, peer.PubKey))
+			entry["identity"] = score.Identity
+			entry["score"] = score.Score
+			entry["offenses"] = score.Offenses
+		}
+		report = append(report, entry)
 	}
 
 	return report
@@ -1187,10 +1474,10 @@ host, _, err := net.SplitHostPort(address)
 if err != nil {
     host = address // fallback if no port
 }
-url := fmt.Sprintf("http://%s:%d/request_block?block_id=%x", host, apiPort, blockID[:])
-fmt.Printf("[DEBUG][FETCH] RequestBlockFromPeer URL: %s\n", url)
+url := PeerURL(address, fmt.Sprintf("/request_block?block_id=%x", blockID[:]))
+fmt.Printf("[DEBUG][FETCH] RequestBlockFromPeer URL: %s (host=%s, apiPort=%d)\n", url, host, apiPort)
 
-	resp, err := http.Get(url)
+	resp, err := n.peerHTTP().Get(url)
 	if err != nil {
 		fmt.Printf("[DEBUG][FETCH] HTTP request to %s failed: %v\n", url, err)
 		return nil, fmt.Errorf("request failed: %v", err)
@@ -1226,25 +1513,16 @@ func (n *Network) SyncFromPeer(address string, knownTipID [32]byte) error {
 	}
 	blk := *blkPtr
 
-	err = n.store.SaveBlock(blk.BlockID[:], blockBytes)
+	committed, err := n.commitBlock(blk, blockBytes)
+	if errors.Is(err, errNotOnTip) {
+		fmt.Printf("⚠️ Block %x from peer is an orphan (%v). Tip not updated.\n", blk.BlockID[:], err)
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("❌ Failed to save block: %v", err)
+		return fmt.Errorf("❌ Rejected peer block: %v", err)
 	}
-
-	n.lock.Lock()
-	defer n.lock.Unlock()
-	currentTip := n.latestBlockID
-	currentTipHex := fmt.Sprintf("%x", currentTip[:])
-	isGenesis := blk.PrevHash == "" || blk.PrevHash == strings.Repeat("0", len(blk.PrevHash))
-	if isGenesis || blk.PrevHash == currentTipHex {
-		err = n.store.DB().Put([]byte("latestBlockID"), blk.BlockID[:], nil)
-		if err != nil {
-			return fmt.Errorf("❌ Failed to update latestBlockID: %v", err)
-		}
-		n.latestBlockID = blk.BlockID
+	if committed {
 		fmt.Printf("✅ Synced block %x from peer (tip updated)\n", blk.BlockID[:])
-	} else {
-		fmt.Printf("⚠️ Block %x from peer is an orphan (PrevHash %s does not match current tip %s). Tip not updated.\n", blk.BlockID[:], blk.PrevHash, currentTipHex)
 	}
 	return nil
 }
@@ -1257,40 +1535,45 @@ func (n *Network) BroadcastBlockAnnouncement(blockIDHex string, height uint64, p
 		Timestamp: timestamp,
 	}
 	data, _ := json.Marshal(msg)
-	for _, peer := range n.peers {
-		go func(p Peer) {
-			host := p.HostOnly
-			if host == "" {
-				host, _, _ = net.SplitHostPort(p.Address)
-			}
-			url := fmt.Sprintf("http://%s:%d/announce_block", host, p.APIPort)
-			_, err := http.Post(url, "application/json", bytes.NewReader(data))
+	n.lock.Lock()
+	n.recentBlocks[blockIDHex] = struct{}{} // Don't fetch our own block back when peers relay the announcement
+	n.lock.Unlock()
+	for _, peer := range n.Peers() {
+		p := peer
+		n.goAsync(func() {
+			url := PeerURL(p.Address, "/announce_block")
+			resp, err := n.peerHTTP().Post(url, "application/json", bytes.NewReader(data))
 			if err != nil {
 				fmt.Printf("[ANNOUNCE] Error sending block announce to %s: %v\n", url, err)
+				return
 			}
-		}(peer)
+			resp.Body.Close()
+		})
 	}
 }
 
-// BroadcastNewBlock sends a new block to all peers via HTTP POST
+// BroadcastNewBlock sends a new block via HTTP POST to peers that did not negotiate compact blocks
+// (compact peers fetch the body after BroadcastBlockAnnouncement)
 func (n *Network) BroadcastNewBlock(blockBytes []byte, blockIDHex string) {
 	msg := BlockBroadcastMessage{
 		BlockBytes: blockBytes,
 		BlockID:    blockIDHex,
 	}
 	data, _ := json.Marshal(msg)
-	for _, peer := range n.peers {
-		go func(p Peer) {
-			host := p.HostOnly
-			if host == "" {
-				host, _, _ = net.SplitHostPort(p.Address)
-			}
-			url := fmt.Sprintf("http://%s:%d/broadcast_block", host, p.APIPort)
-			_, err := http.Post(url, "application/json", bytes.NewReader(data))
+	for _, peer := range n.Peers() {
+		if peer.Supports(FeatureCompactBlocks) {
+			continue
+		}
+		p := peer
+		n.goAsync(func() {
+			url := PeerURL(p.Address, "/broadcast_block")
+			resp, err := n.peerHTTP().Post(url, "application/json", bytes.NewReader(data))
 			if err != nil {
 				fmt.Printf("[BROADCAST] Error sending block to %s: %v\n", url, err)
+				return
 			}
-		}(peer)
+			resp.Body.Close()
+		})
 	}
 }
 
@@ -1311,7 +1594,9 @@ func (n *Network) HandleAnnounceBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var msg BlockAnnounceMessage
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnounceBytes)).Decode(&msg); err != nil {
+		address, pub := n.requestIdentity(r)
+		n.PenalizePeer(address, pub, decodeOffense(err), "announce: "+err.Error())
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
@@ -1322,9 +1607,10 @@ func (n *Network) HandleAnnounceBlock(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	n.recentBlocks[msg.BlockID] = struct{}{} // Later announcements of the same block are ignored
 	n.lock.Unlock()
 	// Otherwise, request the full block from the announcing peer
-	go func() {
+	n.goAsync(func() {
 		blockIDBytes, err := hex.DecodeString(msg.BlockID)
 		if err != nil || len(blockIDBytes) != 32 {
 			fmt.Printf("[ANNOUNCE] Invalid block ID in announce: %s\n", msg.BlockID)
@@ -1333,15 +1619,28 @@ func (n *Network) HandleAnnounceBlock(w http.ResponseWriter, r *http.Request) {
 		var blockID [32]byte
 		copy(blockID[:], blockIDBytes)
 		// Try to fetch full block from announcer
-		peerAddr := host
+		peerAddr := n.peerAddressFor(r)
 		blockBytes, err := n.RequestBlockFromPeer(peerAddr, blockID)
 		if err != nil {
 			fmt.Printf("[ANNOUNCE] Failed to fetch announced block %s from %s: %v\n", msg.BlockID, peerAddr, err)
+			n.lock.Lock()
+			delete(n.recentBlocks, msg.BlockID) // Let another announcer deliver it
+			n.lock.Unlock()
 			return
 		}
 		blkPtr, err := block.Deserialize(blockBytes)
 		if err != nil {
 			fmt.Printf("[ANNOUNCE] Failed to deserialize announced block %s: %v\n", msg.BlockID, err)
+			n.PenalizePeer(peerAddr, nil, OffenseMalformedMessage, "announced block: "+err.Error())
+			return
+		}
+		if blkPtr.BlockID != blockID {
+			n.PenalizePeer(peerAddr, nil, OffenseInvalidBlock, fmt.Sprintf("served %x for announced block %s", blkPtr.BlockID[:], msg.BlockID))
+			return
+		}
+		if err := n.VerifyBlockSeal(*blkPtr); err != nil {
+			fmt.Printf("[ANNOUNCE] Rejected announced block %s: %v\n", msg.BlockID, err)
+			n.PenalizePeer(peerAddr, nil, sealOffense(err), err.Error())
 			return
 		}
 		err = n.SaveNewBlock(*blkPtr)
@@ -1350,8 +1649,10 @@ func (n *Network) HandleAnnounceBlock(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		fmt.Printf("[ANNOUNCE] Successfully fetched and saved announced block %s\n", msg.BlockID)
+		// Relay: compact peers only hear of the block through announcements
+		n.BroadcastBlockAnnouncement(msg.BlockID, blkPtr.Height, blkPtr.PrevHash, blkPtr.Timestamp.Unix())
 fmt.Printf("[LOG] Current tip after announce: %x\n", n.GetLatestBlockID())
-	}()
+	})
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -1374,8 +1675,10 @@ func (n *Network) HandleBroadcastBlock(w http.ResponseWriter, r *http.Request) {
 	}
 	// NOTE: For best practice, apply this logic to all peer-facing handlers.
 
+	address, pub := n.requestIdentity(r)
 	var msg BlockBroadcastMessage
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBlockMessageBytes)).Decode(&msg); err != nil {
+		n.PenalizePeer(address, pub, decodeOffense(err), "broadcast_block: "+err.Error())
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
@@ -1391,17 +1694,25 @@ func (n *Network) HandleBroadcastBlock(w http.ResponseWriter, r *http.Request) {
 	// Deserialize and validate block
 	blkPtr, err := block.Deserialize(msg.BlockBytes)
 	if err != nil {
+		n.PenalizePeer(address, pub, OffenseMalformedMessage, "broadcast_block: "+err.Error())
 		http.Error(w, "invalid block", http.StatusBadRequest)
 		return
 	}
 	blk := *blkPtr
+	if err := n.VerifyBlockSeal(blk); err != nil {
+		n.PenalizePeer(address, pub, sealOffense(err), err.Error())
+		http.Error(w, "invalid block: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 	// === Save Block
 	err = n.SaveNewBlock(blk)
 	if err != nil {
+		n.PenalizePeer(address, pub, OffenseInvalidBlock, err.Error())
 		http.Error(w, fmt.Sprintf("could not save block: %v", err), http.StatusBadRequest)
 		return
 	}
-	// Relay: rebroadcast to other peers
+	// Relay: announce to compact-block peers, rebroadcast the body to the others
+	n.BroadcastBlockAnnouncement(msg.BlockID, blk.Height, blk.PrevHash, blk.Timestamp.Unix())
 	n.BroadcastNewBlock(msg.BlockBytes, msg.BlockID)
 	w.WriteHeader(http.StatusOK)
 }
@@ -1430,7 +1741,7 @@ func (n *Network) RemoveDisconnectedProducers() {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	present := make(map[string]struct{})
-	now := time.Now()
+	now := n.Now()
 	for _, p := range n.peers {
 		// Only keep peers seen within 2 block intervals
 		if now.Sub(p.LastSeen) < 2*n.BlockProductionInterval && len(p.PubKey) == 32 {
@@ -1450,6 +1761,59 @@ func (n *Network) RemoveDisconnectedProducers() {
 	PrintProducerTable(n.ProducersDynamic)
 }
 
+// AddPeer adds or refreshes a peer table entry without a handshake. In-process transports use it to
+// wire nodes together; real connections go through ConnectToPeer and the inbound handshake.
+func (n *Network) AddPeer(p Peer) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for i := range n.peers {
+		if n.peers[i].Address == p.Address {
+			n.peers[i] = p
+			return
+		}
+	}
+	n.peers = append(n.peers, p)
+}
+
+// SetClock replaces the node's clock (block timestamps, rate limits, peer scores, bans).
+// The simulation harness uses it to run many nodes on one simulated clock.
+func (n *Network) SetClock(now func() time.Time) {
+	n.now = now
+	if n.Scores != nil {
+		n.Scores.mu.Lock()
+		n.Scores.now = now
+		n.Scores.mu.Unlock()
+	}
+	if n.Bans != nil {
+		n.Bans.mu.Lock()
+		n.Bans.now = now
+		n.Bans.mu.Unlock()
+	}
+}
+
+// SetSpawner replaces how the node starts the background work that talks to peers (relays, broadcasts,
+// block fetches, syncs). The simulation harness counts that work to tell when the network is quiet.
+func (n *Network) SetSpawner(spawn func(func())) {
+	n.spawn = spawn
+}
+
+// goAsync runs fn in the background through the node's spawner
+func (n *Network) goAsync(fn func()) {
+	if n.spawn != nil {
+		n.spawn(fn)
+		return
+	}
+	go fn()
+}
+
+// Now returns the current time on the node's clock
+func (n *Network) Now() time.Time {
+	if n.now == nil {
+		return time.Now()
+	}
+	return n.now()
+}
+
 // GetSortedDynamicProducers returns a sorted slice of pubkey hex strings from the dynamic producer table
 func (n *Network) GetSortedDynamicProducers() []string {
 	n.lock.Lock()
@@ -1500,6 +1864,67 @@ func (n *Network) Peers() []Peer {
     return peersCopy
 }
 
+// ListenPort returns the port of this node's P2P listener
+func (n *Network) ListenPort() int {
+	_, port, err := net.SplitHostPort(n.listenAddr)
+	if err != nil {
+		return 0
+	}
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// GossipPeers returns the P2P addresses of connected, unbanned peers for tx gossip
+func (n *Network) GossipPeers() []string {
+	addrs := []string{}
+	for _, p := range n.Peers() {
+		host, _, err := net.SplitHostPort(p.Address)
+		if err != nil || n.IsPeerBanned(host) {
+			continue
+		}
+		addrs = append(addrs, p.Address)
+	}
+	return addrs
+}
+
+// peerHTTP returns the client for peer RPC over the authenticated transport
+func (n *Network) peerHTTP() *http.Client {
+	if n.PeerClient != nil {
+		return n.PeerClient
+	}
+	if n.Transport == nil {
+		// Peers present self-signed node certificates, so this fails closed
+		return http.DefaultClient
+	}
+	return n.Transport.HTTPClient()
+}
+
+// peerAddressFor returns the P2P address of the peer that sent r, matched by its authenticated key
+func (n *Network) peerAddressFor(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if r.TLS == nil {
+		return host
+	}
+	key := PeerKey(*r.TLS)
+	for _, p := range n.Peers() {
+		if len(key) > 0 && bytes.Equal(p.PubKey, key) {
+			return p.Address
+		}
+	}
+	return host
+}
+
+// reconcileMempoolWith pulls any transactions a newly connected peer has that we lack
+func (n *Network) reconcileMempoolWith(address string) {
+	if n.Gossip == nil {
+		return
+	}
+	n.goAsync(func() { n.Gossip.ReconcileWithPeer(address) })
+}
+
 // TriggerSyncIfBehind checks if any peer is ahead and triggers a sync if needed (rate-limited).
 func (n *Network) TriggerSyncIfBehind() {
     // Actively refresh peer heights before checking
@@ -0,0 +1,136 @@
+package networking
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/core/state"
+)
+
+func TestSaveNewBlockAcceptance(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, priv, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 3, priv)
+	n := &Network{Bans: NewBanManager(nil), ChainState: &state.ChainState{}, EpochBlockCount: 10}
+	n.store = newTestStore(t, chain)
+	n.SetLatestBlockID(chain[2].BlockID)
+	reorgs := 0
+	n.SetSpawner(func(func()) { reorgs++ })
+
+	child := func(parent block.Block, salt int64, events ...block.ChainedEvent) block.Block {
+		b := block.Block{
+			Version:   "1.0",
+			Height:    parent.Height + 1,
+			PrevHash:  fmt.Sprintf("%x", parent.BlockID[:]),
+			Timestamp: parent.Timestamp.Add(time.Duration(salt) * time.Second),
+			Events:    events,
+		}
+		if len(events) > 0 {
+			b.MerkleRoot, b.ConsentRoot = block.EventsRoot(events), block.ConsentRoot(events)
+		}
+		b.BlockID = b.ComputeID()
+		b.Signature = ed25519.Sign(priv, b.BlockID[:])
+		return b
+	}
+
+	// A block extending the tip is stored, becomes the tip, is counted once and has its sections applied
+	_, patient, _ := ed25519.GenerateKey(nil)
+	grant := signedGrant(t, patient, "clinic-a")
+	next := child(chain[2], 1, block.ConsentEvent(grant))
+	if err := n.SaveNewBlock(next); err != nil {
+		t.Fatal(err)
+	}
+	if n.GetLatestBlockID() != next.BlockID || n.ChainState.BlocksInEpoch != 1 {
+		t.Fatalf("block not committed: tip %x, blocks in epoch %d", n.GetLatestBlockID(), n.ChainState.BlocksInEpoch)
+	}
+	if _, err := blockchain.GetConsent(n.store, grant.ConsentID()); err != nil {
+		t.Fatalf("consent grant of the committed block not applied: %v", err)
+	}
+
+	// Re-delivering the tip or an older block changes nothing; its sections are not verified again
+	for _, b := range []block.Block{next, chain[1]} {
+		if err := n.SaveNewBlock(b); err != nil {
+			t.Fatalf("re-delivery of height %d rejected: %v", b.Height, err)
+		}
+	}
+	if n.GetLatestBlockID() != next.BlockID || n.ChainState.BlocksInEpoch != 1 || reorgs != 0 {
+		t.Fatalf("re-delivery changed state: blocks in epoch %d, reorgs %d", n.ChainState.BlocksInEpoch, reorgs)
+	}
+
+	// A sibling of the tip is not adopted or stored; fork choice decides between the branches
+	sibling := child(chain[2], 2)
+	if err := n.SaveNewBlock(sibling); err != nil {
+		t.Fatal(err)
+	}
+	if n.GetLatestBlockID() != next.BlockID || n.ChainState.BlocksInEpoch != 1 {
+		t.Error("sibling block adopted")
+	}
+	if stored, err := n.store.GetBlock(sibling.BlockID[:]); err == nil && stored != nil {
+		t.Error("sibling block kept in storage")
+	}
+	if reorgs != 1 {
+		t.Errorf("expected one fork-choice run for the sibling, got %d", reorgs)
+	}
+
+	// A block whose events do not match its MerkleRoot is rejected
+	bad := child(next, 1)
+	bad.Events = []block.ChainedEvent{{EventType: "medical_record"}}
+	bad.MerkleRoot = "00"
+	bad.BlockID = bad.ComputeID()
+	if err := n.SaveNewBlock(bad); err == nil {
+		t.Error("block with a wrong MerkleRoot accepted")
+	}
+	if n.GetLatestBlockID() != next.BlockID {
+		t.Error("rejected block became the tip")
+	}
+}
+
+// failingSigner is a token key that can no longer sign, e.g. an HSM that was unplugged
+type failingSigner struct{ pub ed25519.PublicKey }
+
+func (s failingSigner) Public() crypto.PublicKey { return s.pub }
+
+func (s failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("token removed")
+}
+
+func TestProduceBlockStoresNothingWhenSigningFails(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	pub, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 2, producer)
+	n := &Network{PubKey: pub, PrivKey: producer, Signer: failingSigner{pub}, Mempool: mempool.NewMempool(10), EpochBlockCount: 10}
+	n.store = newTestStore(t, chain)
+	n.ChainState = &state.ChainState{StateDB: n.store}
+	n.ProducersDynamic = map[string]struct{}{fmt.Sprintf("%x", pub): {}}
+	n.recentBlocks = make(map[string]struct{})
+	if err := n.SetLatestBlockID(chain[1].BlockID); err != nil {
+		t.Fatal(err)
+	}
+	_, patient, _ := ed25519.GenerateKey(nil)
+	txID, err := n.SubmitConsent(signedGrant(t, patient, "clinic-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.ProduceBlock(); err == nil {
+		t.Fatal("block produced without a signature")
+	}
+	if tip := n.GetLatestBlockID(); tip != chain[1].BlockID {
+		t.Errorf("tip moved to %x", tip[:])
+	}
+	if ids, _ := n.store.ListBlockIDs(); len(ids) != len(chain) {
+		t.Errorf("%d blocks stored, want %d", len(ids), len(chain))
+	}
+	if _, ok := n.Mempool.GetTx(txID); !ok {
+		t.Error("transaction removed from the mempool")
+	}
+}
@@ -0,0 +1,239 @@
+package networking
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Misbehavior-based peer scoring.
+// Every peer starts at 0. Offenses deduct points; scores decay back towards 0 over time so an
+// occasional fault is forgiven. Below DisconnectThreshold the peer is dropped from the peer table,
+// below BanThreshold it is banned. Peers are scored and banned by node identity (their Ed25519 key)
+// when known, so changing IP does not reset a bad record; unauthenticated senders fall back to IP.
+
+// Offense types
+type Offense string
+
+const (
+	OffenseInvalidBlock     Offense = "invalid_block"     // Block that fails ID, linkage or acceptance checks
+	OffenseBadSignature     Offense = "bad_signature"     // Block signature does not verify
+	OffenseOversizedPayload Offense = "oversized_payload" // Message over the size limit for its endpoint
+	OffenseFalseHeight      Offense = "false_height"      // Advertised ChainHeight the peer cannot serve
+	OffenseMalformedMessage Offense = "malformed_message" // Undecodable message
+)
+
+// Size limits for block propagation messages
+const (
+	maxAnnounceBytes     = 64 << 10
+	maxBlockMessageBytes = 8 << 20 // Block bytes are base64 in the JSON body; genesis maxBlockSize is 2 MiB
+)
+
+// decodeOffense classifies a request body decode error
+func decodeOffense(err error) Offense {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return OffenseOversizedPayload
+	}
+	return OffenseMalformedMessage
+}
+
+// ScoreConfig sets penalties, decay and thresholds
+type ScoreConfig struct {
+	Penalties           map[Offense]float64
+	DecayPerMinute      float64 // Points recovered per minute, up to 0
+	DisconnectThreshold float64 // Score at or below which the peer is dropped
+	BanThreshold        float64 // Score at or below which the peer is banned (progressive durations)
+}
+
+// DefaultScoreConfig returns the settings used by the node
+func DefaultScoreConfig() ScoreConfig {
+	return ScoreConfig{
+		Penalties: map[Offense]float64{
+			OffenseInvalidBlock:     40,
+			OffenseBadSignature:     60,
+			OffenseOversizedPayload: 30,
+			OffenseFalseHeight:      20,
+			OffenseMalformedMessage: 10,
+		},
+		DecayPerMinute:      1,
+		DisconnectThreshold: -50,
+		BanThreshold:        -100,
+	}
+}
+
+// Actions taken after an offense
+const (
+	ScoreActionNone       = "none"
+	ScoreActionDisconnect = "disconnect"
+	ScoreActionBan        = "ban"
+)
+
+// PeerScore is one identity's record
+type PeerScore struct {
+	Identity    string          `json:"identity"`
+	Score       float64         `json:"score"`
+	Offenses    map[Offense]int `json:"offenses"`
+	LastOffense time.Time       `json:"lastOffense"`
+	LastReason  string          `json:"lastReason,omitempty"`
+	updated     time.Time
+}
+
+// PeerScoreManager tracks misbehavior scores
+type PeerScoreManager struct {
+	mu     sync.Mutex
+	scores map[string]*PeerScore
+	Config ScoreConfig
+	now    func() time.Time
+}
+
+// NewPeerScoreManager creates a manager with cfg
+func NewPeerScoreManager(cfg ScoreConfig) *PeerScoreManager {
+	return &PeerScoreManager{scores: make(map[string]*PeerScore), Config: cfg, now: time.Now}
+}
+
+// NodeIdentity is the score and ban key for an authenticated node
+func NodeIdentity(pubKey []byte) string {
+	return "node:" + hex.EncodeToString(pubKey)
+}
+
+// decayLocked applies recovery since the last update. Caller must hold m.mu.
+func (m *PeerScoreManager) decayLocked(ps *PeerScore, now time.Time) {
+	if ps.Score < 0 && m.Config.DecayPerMinute > 0 {
+		ps.Score += now.Sub(ps.updated).Minutes() * m.Config.DecayPerMinute
+		if ps.Score > 0 {
+			ps.Score = 0
+		}
+	}
+	ps.updated = now
+}
+
+// Penalize deducts the penalty for offense and returns the new score and the action to take
+func (m *PeerScoreManager) Penalize(identity string, offense Offense, reason string) (float64, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	ps, ok := m.scores[identity]
+	if !ok {
+		ps = &PeerScore{Identity: identity, Offenses: make(map[Offense]int), updated: now}
+		m.scores[identity] = ps
+	}
+	m.decayLocked(ps, now)
+	ps.Score -= m.Config.Penalties[offense]
+	ps.Offenses[offense]++
+	ps.LastOffense = now
+	ps.LastReason = reason
+	switch {
+	case ps.Score <= m.Config.BanThreshold:
+		ps.Score = 0 // The ban is the punishment; start clean when it expires
+		return m.Config.BanThreshold, ScoreActionBan
+	case ps.Score <= m.Config.DisconnectThreshold:
+		return ps.Score, ScoreActionDisconnect
+	}
+	return ps.Score, ScoreActionNone
+}
+
+// Get returns the decayed score for identity (0 if it has no record)
+func (m *PeerScoreManager) Get(identity string) PeerScore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps, ok := m.scores[identity]
+	if !ok {
+		return PeerScore{Identity: identity, Offenses: map[Offense]int{}}
+	}
+	m.decayLocked(ps, m.now())
+	out := *ps
+	out.Offenses = make(map[Offense]int, len(ps.Offenses))
+	for k, v := range ps.Offenses {
+		out.Offenses[k] = v
+	}
+	return out
+}
+
+// List returns all records, worst score first
+func (m *PeerScoreManager) List() []PeerScore {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.scores))
+	for id := range m.scores {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	out := make([]PeerScore, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, m.Get(id))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Score < out[j].Score })
+	return out
+}
+
+// peerIdentity returns the score/ban key for a peer: its node key when known, else its IP
+func peerIdentity(address string, pubKey []byte) string {
+	if len(pubKey) > 0 {
+		return NodeIdentity(pubKey)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return host
+}
+
+// requestIdentity resolves the sender of a peer RPC request
+func (n *Network) requestIdentity(r *http.Request) (string, []byte) {
+	var pub []byte
+	if r.TLS != nil {
+		pub = PeerKey(*r.TLS)
+	}
+	return n.peerAddressFor(r), pub
+}
+
+// PenalizePeer records misbehavior by the peer at address (pubKey may be nil; it is looked up in
+// the peer table) and disconnects or bans it when its score falls below the thresholds.
+func (n *Network) PenalizePeer(address string, pubKey []byte, offense Offense, reason string) {
+	if n.Scores == nil {
+		return
+	}
+	if len(pubKey) == 0 {
+		for _, p := range n.Peers() {
+			if p.Address == address {
+				pubKey = p.PubKey
+				break
+			}
+		}
+	}
+	identity := peerIdentity(address, pubKey)
+	score, action := n.Scores.Penalize(identity, offense, reason)
+	fmt.Printf("[SCORE] %s (%s) %s: %s, score now %.0f\n", identity, address, offense, reason, score)
+	switch action {
+	case ScoreActionDisconnect:
+		fmt.Printf("[SCORE] Disconnecting %s (score %.0f)\n", address, score)
+		n.removePeer(address)
+	case ScoreActionBan:
+		if n.Bans != nil {
+			dur, banCount := n.Bans.BanProgressive(identity, fmt.Sprintf("misbehavior score %.0f: %s", score, offense), "score")
+			fmt.Printf("[SCORE] Banned %s for %s after misbehavior (violation #%d)\n", identity, dur, banCount)
+		}
+		n.removePeer(address)
+	}
+}
+
+// IsNodeBanned reports whether the node key is banned
+func (n *Network) IsNodeBanned(pubKey []byte) bool {
+	if len(pubKey) == 0 {
+		return false
+	}
+	return n.IsPeerBanned(NodeIdentity(pubKey))
+}
+
+// PeerScores returns all misbehavior records, worst first
+func (n *Network) PeerScores() []PeerScore {
+	if n.Scores == nil {
+		return []PeerScore{}
+	}
+	return n.Scores.List()
+}
@@ -0,0 +1,90 @@
+package networking
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPeerScoreDecayAndThresholds(t *testing.T) {
+	m := NewPeerScoreManager(DefaultScoreConfig())
+	clock := time.Now()
+	m.now = func() time.Time { return clock }
+
+	if score, action := m.Penalize("node:aa", OffenseInvalidBlock, "x"); score != -40 || action != ScoreActionNone {
+		t.Fatalf("unexpected first penalty result: %.0f %s", score, action)
+	}
+	clock = clock.Add(30 * time.Minute) // recovers 30 points
+	if got := m.Get("node:aa").Score; got != -10 {
+		t.Fatalf("expected decay to -10, got %.1f", got)
+	}
+	if _, action := m.Penalize("node:aa", OffenseInvalidBlock, "x"); action != ScoreActionDisconnect {
+		t.Errorf("expected disconnect at -50, got %s", action)
+	}
+	if _, action := m.Penalize("node:aa", OffenseBadSignature, "x"); action != ScoreActionBan {
+		t.Errorf("expected ban at -110, got %s", action)
+	}
+	if s := m.Get("node:aa"); s.Offenses[OffenseInvalidBlock] != 2 || s.Offenses[OffenseBadSignature] != 1 {
+		t.Errorf("offense counts not tracked: %+v", s.Offenses)
+	}
+}
+
+func TestBadSignatureBlocksLeadToIdentityBan(t *testing.T) {
+	_, producer, _ := ed25519.GenerateKey(nil)
+	sender, _, _ := ed25519.GenerateKey(nil)
+	n := &Network{
+		Transport:    newTestTransport(t, NewPeerKeySet(producer.Public().(ed25519.PublicKey))),
+		Scores:       NewPeerScoreManager(DefaultScoreConfig()),
+		Bans:         NewBanManager(nil),
+		recentBlocks: make(map[string]struct{}),
+		peers:        []Peer{{Address: "10.0.0.9:3000", PubKey: sender}},
+	}
+
+	// Each forged block costs 60 points: disconnect after the first, ban after the second
+	for i := 0; i < 2; i++ {
+		blk := buildTestChain(t, i+1, producer)[i]
+		blk.Signature[0] ^= 0xff
+		raw, _ := json.Marshal(blk)
+		body, _ := json.Marshal(BlockBroadcastMessage{BlockBytes: raw, BlockID: "forged-" + string(rune('a'+i))})
+		req := httptest.NewRequest(http.MethodPost, "/broadcast_block", bytes.NewReader(body))
+		req.RemoteAddr = "10.0.0.9:51000"
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{PublicKey: sender}}}
+		rec := httptest.NewRecorder()
+		n.HandleBroadcastBlock(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("forged block accepted: %d", rec.Code)
+		}
+	}
+	if len(n.Peers()) != 0 {
+		t.Error("misbehaving peer still in the peer table")
+	}
+	// The ban follows the node key, not the IP
+	if !n.IsNodeBanned(sender) {
+		t.Error("node identity was not banned")
+	}
+	if n.IsPeerBanned("10.0.0.9") {
+		t.Error("IP should not be banned when the node identity is known")
+	}
+}
+
+func TestBannedNodeCannotConnect(t *testing.T) {
+	server := newHandshakeNode(t, "unicare-devnet")
+	client := newHandshakeNode(t, "unicare-devnet")
+	server.Transport.Keys.Add(client.Transport.PubKey)
+	client.Transport.Keys.Add(server.Transport.PubKey)
+	addr := serveTransport(t, server)
+
+	server.BanPeer(NodeIdentity(client.Transport.PubKey), time.Hour)
+	if err := client.ConnectToPeer(addr); err == nil {
+		t.Fatal("banned node completed a handshake")
+	}
+	if len(server.Peers()) != 0 {
+		t.Error("banned node added to the peer table")
+	}
+}
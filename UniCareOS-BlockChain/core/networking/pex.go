@@ -0,0 +1,190 @@
+package networking
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Peer exchange (PEX) and outbound peer management.
+// Nodes share the validator/full-node addresses in their address book over the
+// authenticated transport; a background loop keeps TargetOutbound peers connected,
+// reconnects with backoff and ages out peers that stop responding.
+
+// PeerManagerConfig controls discovery and reconnection
+type PeerManagerConfig struct {
+	TargetOutbound int           // Outbound peers to maintain
+	Interval       time.Duration // How often peers are polled and dials are attempted
+	BaseBackoff    time.Duration // Redial delay after the first failure
+	MaxBackoff     time.Duration // Upper bound for the redial delay
+	MaxFailures    int           // Consecutive failures before a connected peer is dropped
+	PruneAfter     time.Duration // Failing addresses without a success for this long are forgotten
+	PEXMaxAddrs    int           // Addresses returned per PEX response
+}
+
+// DefaultPeerManagerConfig returns the settings used by the node
+func DefaultPeerManagerConfig() PeerManagerConfig {
+	return PeerManagerConfig{
+		TargetOutbound: 8,
+		Interval:       30 * time.Second,
+		BaseBackoff:    30 * time.Second,
+		MaxBackoff:     30 * time.Minute,
+		MaxFailures:    3,
+		PruneAfter:     7 * 24 * time.Hour,
+		PEXMaxAddrs:    50,
+	}
+}
+
+// PEXAddr is one shared address
+type PEXAddr struct {
+	Address string `json:"address"`
+	PubKey  []byte `json:"pubKey"`
+}
+
+// PEXMessage is the response of GET /pex/addrs
+type PEXMessage struct {
+	Addrs []PEXAddr `json:"addrs"`
+}
+
+// HandlePEX serves a sample of known-good peer addresses (peer RPC only)
+func (n *Network) HandlePEX(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if n.IsPeerBanned(host) {
+		http.Error(w, "forbidden: banned", http.StatusForbidden)
+		fmt.Printf("[BAN] Blocked PEX from banned peer: %s\n", host)
+		return
+	}
+	if !n.AllowPeerRequest(host) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		fmt.Printf("[RATE LIMIT] Blocked PEX from %s\n", host)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	requester := n.peerAddressFor(r)
+	msg := PEXMessage{Addrs: []PEXAddr{}}
+	for _, ka := range n.AddrBook.List() {
+		if len(msg.Addrs) >= n.PeerConfig.PEXMaxAddrs {
+			break
+		}
+		// Only share addresses we have reached ourselves and whose key is in the node set
+		if ka.Address == requester || ka.LastSuccess.IsZero() || !n.peerKeyAllowed(ka.PubKey) {
+			continue
+		}
+		msg.Addrs = append(msg.Addrs, PEXAddr{Address: ka.Address, PubKey: ka.PubKey})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+func (n *Network) peerKeyAllowed(pub []byte) bool {
+	return n.Transport != nil && n.Transport.Keys.Allowed(pub)
+}
+
+// requestPEX asks a peer for addresses. A successful response also proves the peer is alive.
+func (n *Network) requestPEX(address string) ([]PEXAddr, error) {
+	resp, err := n.peerHTTP().Get(PeerURL(address, "/pex/addrs"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	var msg PEXMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, err
+	}
+	return msg.Addrs, nil
+}
+
+// removePeer drops a peer from the live peer table (the address book keeps it for redialing)
+func (n *Network) removePeer(address string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for i, p := range n.peers {
+		if p.Address == address {
+			n.peers = append(n.peers[:i], n.peers[i+1:]...)
+			return
+		}
+	}
+}
+
+// StartPeerManager runs discovery and reconnection in the background
+func (n *Network) StartPeerManager(cfg PeerManagerConfig) {
+	n.PeerConfig = cfg
+	go func() {
+		n.peerManagerTick()
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n.peerManagerTick()
+		}
+	}()
+}
+
+// peerManagerTick polls connected peers via PEX, drops dead ones and dials new ones up to the target
+func (n *Network) peerManagerTick() {
+	cfg := n.PeerConfig
+
+	// 1. Exchange addresses with every connected peer that supports PEX; failures age the peer out
+	for _, p := range n.Peers() {
+		if !p.Supports(FeaturePEX) {
+			continue // Older peer without /pex/addrs
+		}
+		addrs, err := n.requestPEX(p.Address)
+		if err != nil {
+			failures := n.AddrBook.MarkFailed(p.Address)
+			fmt.Printf("[PEX] Peer %s unresponsive (%d/%d): %v\n", p.Address, failures, cfg.MaxFailures, err)
+			if failures >= cfg.MaxFailures {
+				fmt.Printf("[PEX] Dropping unresponsive peer %s\n", p.Address)
+				n.removePeer(p.Address)
+			}
+			continue
+		}
+		n.AddrBook.MarkGood(p.Address, p.PubKey)
+		for _, a := range addrs {
+			if a.Address == "" || bytes.Equal(a.PubKey, n.PubKey) || !n.peerKeyAllowed(a.PubKey) {
+				continue
+			}
+			n.AddrBook.Add(a.Address, a.PubKey, AddrSourcePEX)
+		}
+	}
+
+	// 2. Dial address book candidates until we reach the outbound target
+	connected := map[string]bool{}
+	outbound := 0
+	for _, p := range n.Peers() {
+		connected[p.Address] = true
+		if p.Outbound {
+			outbound++
+		}
+	}
+	if missing := cfg.TargetOutbound - outbound; missing > 0 {
+		for _, ka := range n.AddrBook.DialCandidates(missing, connected, cfg.BaseBackoff, cfg.MaxBackoff) {
+			if bytes.Equal(ka.PubKey, n.PubKey) {
+				continue // our own address, learned from a peer
+			}
+			n.AddrBook.MarkAttempt(ka.Address)
+			if err := n.ConnectToPeer(ka.Address); err != nil {
+				failures := n.AddrBook.MarkFailed(ka.Address)
+				fmt.Printf("[PEX] Dial %s failed (%d consecutive): %v\n", ka.Address, failures, err)
+				continue
+			}
+			fmt.Printf("[PEX] Connected to %s (source: %s)\n", ka.Address, ka.Source)
+		}
+	}
+
+	// 3. Forget addresses that have been failing for a long time
+	if removed := n.AddrBook.Prune(cfg.MaxFailures, cfg.PruneAfter); removed > 0 {
+		fmt.Printf("[PEX] Pruned %d dead address(es)\n", removed)
+	}
+}
@@ -20,16 +20,12 @@ const permabanDuration = 100 * 365 * 24 * time.Hour // effectively permanent
 
 // AllowPeerRequest checks and updates the rate limit for a peer
 func (n *Network) AllowPeerRequest(address string) bool {
-	if n.banCounts == nil {
-		n.banCounts = make(map[string]int)
-	}
-
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	if n.peerRequestCounts == nil {
 		n.peerRequestCounts = make(map[string][]time.Time)
 	}
-	now := time.Now()
+	now := n.Now()
 	times := n.peerRequestCounts[address]
 	// Keep only recent requests
 	var recent []time.Time
@@ -44,16 +40,12 @@ func (n *Network) AllowPeerRequest(address string) bool {
 	if len(recent) > maxRequestsPerWindow {
 		fmt.Printf("[RATE LIMIT] Would block request from %s (over limit)\n", address)
 		// Only ban if not already banned
-		if !n.IsPeerBanned(address) {
+		if n.Bans != nil && !n.Bans.IsBanned(address) {
 			// Progressive ban logic
-			n.banCounts[address]++
-			banCount := n.banCounts[address]
-			if banCount > len(banDurations) {
-				n.BanPeer(address, permabanDuration)
+			dur, banCount := n.Bans.BanProgressive(address, "rate limit exceeded", "ratelimit")
+			if dur == permabanDuration {
 				fmt.Printf("[PERMABAN] Permanently banned %s after %d violations\n", address, banCount)
 			} else {
-				dur := banDurations[banCount-1]
-				n.BanPeer(address, dur)
 				fmt.Printf("[BAN] %s banned for %s (violation #%d)\n", address, dur, banCount)
 			}
 		}
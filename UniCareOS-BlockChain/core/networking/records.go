@@ -0,0 +1,62 @@
+package networking
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"unicareos/core/block"
+	"unicareos/core/mempool"
+	"unicareos/core/storage"
+)
+
+// SubmitMedicalRecord adds a signed record submission to the mempool, gossips it and queues its
+// finalization, returning its TxID and the ID its medical_record event will have. Ingestion adapters
+// submit through it; the wallet signature and schema are checked again when a block includes the record.
+// A record naming a stored payload that was stored for another record is refused.
+func (n *Network) SubmitMedicalRecord(submission block.MedicalRecordSubmission) (string, string, error) {
+	recs, _, err := n.SubmitMedicalRecords([]block.MedicalRecordSubmission{submission})
+	if err != nil {
+		return "", "", err
+	}
+	return recs[0].TxID, recs[0].EventID, nil
+}
+
+// SubmittedRecord identifies a submission in the mempool: its TxID and the ID its medical_record event
+// will have
+type SubmittedRecord struct {
+	TxID    string
+	EventID string
+}
+
+// SubmitMedicalRecords submits submissions together, as SubmitMedicalRecord does one: either all reach the
+// mempool or none does. On error failed is the index of the refused submission, or -1.
+func (n *Network) SubmitMedicalRecords(submissions []block.MedicalRecordSubmission) (recs []SubmittedRecord, failed int, err error) {
+	if n.Mempool == nil {
+		return nil, -1, fmt.Errorf("no mempool")
+	}
+	txs := make([]mempool.Transaction, len(submissions))
+	for i, submission := range submissions {
+		if n.store != nil {
+			owner := storage.PayloadOwner{PatientDID: submission.PatientDID(), RecordID: submission.RecordID()}
+			if err := n.store.CheckPayloadOwner(submission.DocHash(), owner); err != nil {
+				return nil, i, err
+			}
+		}
+		payload, err := json.Marshal(submission)
+		if err != nil {
+			return nil, i, err
+		}
+		txs[i] = mempool.Transaction{TxID: mempool.PayloadTxID(payload), Payload: payload, Timestamp: n.Now().Unix(), Sender: submission.WalletAddress}
+	}
+	if i, res := n.Mempool.AdmitAll(txs); !res.Accepted {
+		return nil, i, fmt.Errorf("%s: %s", res.Class, res.Reason)
+	}
+	for _, tx := range txs {
+		if n.Gossip != nil {
+			n.Gossip.BroadcastTx(tx)
+		}
+		eventID, _ := n.QueueEventFinalization(tx.Payload)
+		recs = append(recs, SubmittedRecord{TxID: tx.TxID, EventID: eventID})
+	}
+	return recs, -1, nil
+}
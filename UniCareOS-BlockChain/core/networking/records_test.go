@@ -0,0 +1,42 @@
+package networking
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"unicareos/core/mempool"
+	"unicareos/core/storage"
+)
+
+func TestSubmitMedicalRecordRefusesAnotherRecordsPayload(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	n := &Network{Mempool: mempool.NewMempool(10), store: newTestStore(t, nil)}
+
+	// A payload stored for another patient's record cannot be attached by reusing its docHash
+	victim, err := n.store.PutPayload([]byte("victim PHI"), storage.PayloadOwner{PatientDID: "did:example:victim", RecordID: "victim-record"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := testSubmission()
+	sub.Record["docHash"] = victim.DocHash
+	if _, _, err := n.SubmitMedicalRecord(sub); !errors.Is(err, storage.ErrPayloadNotOwned) {
+		t.Fatalf("submission reusing another record's payload: %v", err)
+	}
+	if len(n.Mempool.GetAllTxs()) != 0 {
+		t.Fatal("refused submission reached the mempool")
+	}
+
+	// The record the payload was stored for, or one naming no stored payload, is submitted
+	own, err := n.store.PutPayload([]byte("own PHI"), storage.PayloadOwner{PatientDID: sub.PatientDID(), RecordID: sub.RecordID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Record["docHash"] = own.DocHash
+	if _, _, err := n.SubmitMedicalRecord(sub); err != nil {
+		t.Fatalf("submission with its own payload refused: %v", err)
+	}
+	if _, _, err := n.SubmitMedicalRecord(testSubmission()); err != nil {
+		t.Fatalf("submission without a stored payload refused: %v", err)
+	}
+}
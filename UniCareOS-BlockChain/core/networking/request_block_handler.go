@@ -2,10 +2,16 @@ package networking
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"unicareos/core/block"
 	"unicareos/core/storage"
 )
 
+// maxHeadersPerRequest caps a single /headers response
+const maxHeadersPerRequest = 2000
+
 // RequestBlockHandler serves block bytes for a given block ID as a HTTP endpoint
 func RequestBlockHandler(store *storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -29,3 +35,41 @@ func RequestBlockHandler(store *storage.Storage) http.HandlerFunc {
 		w.Write(blkBytes)
 	}
 }
+
+// RequestHeadersHandler serves block headers (events stripped) for heights start..end, stopping at the first missing height
+func RequestHeadersHandler(store *storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, err := strconv.Atoi(q.Get("start"))
+		if err != nil || start < 0 {
+			http.Error(w, "invalid start height", http.StatusBadRequest)
+			return
+		}
+		end, err := strconv.Atoi(q.Get("end"))
+		if err != nil || end < start {
+			http.Error(w, "invalid end height", http.StatusBadRequest)
+			return
+		}
+		if end-start+1 > maxHeadersPerRequest {
+			end = start + maxHeadersPerRequest - 1
+		}
+		headers := []block.Block{}
+		for h := start; h <= end; h++ {
+			blockID, err := store.GetBlockIDByHeight(h)
+			if err != nil {
+				break
+			}
+			blkBytes, err := store.GetBlock(blockID)
+			if err != nil {
+				break
+			}
+			blk, err := block.Deserialize(blkBytes)
+			if err != nil {
+				break
+			}
+			headers = append(headers, HeaderOf(*blk))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(headers)
+	}
+}
@@ -0,0 +1,134 @@
+package networking
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/mempool"
+	"unicareos/types/ids"
+)
+
+// Schema registry governance.
+// A SchemaRegistration signed by GovernanceQuorum of GovernanceKeys enters the mempool through
+// SubmitSchemaRegistration. The producer writes it as a schema_register event (committed to by
+// Block.SchemaRoot) once blockchain.VerifySchemaRegistration accepts it; every node verifies it again
+// before accepting the block and registers the schema when the block is committed. Records are then
+// validated against it from its activation height on.
+
+// governanceQuorum returns the governance signatures a schema registration needs
+func (n *Network) governanceQuorum() int {
+	if n.GovernanceQuorum > 0 {
+		return n.GovernanceQuorum
+	}
+	return blockchain.FinalizerQuorum(len(n.GovernanceKeys))
+}
+
+// SubmitSchemaRegistration verifies a schema registration against the next block, adds it to the
+// mempool and gossips it
+func (n *Network) SubmitSchemaRegistration(r *block.SchemaRegistration) (string, error) {
+	if n.Mempool == nil {
+		return "", fmt.Errorf("no mempool")
+	}
+	height := blockchain.NewSchemaRegistry(n.store, n.ChainState).NextHeight()
+	if err := blockchain.VerifySchemaRegistration(n.store, r, n.GovernanceKeys, n.governanceQuorum(), height); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(block.SchemaRegisterPayload{Type: block.SchemaRegisterType, Registration: r})
+	if err != nil {
+		return "", err
+	}
+	tx := mempool.Transaction{TxID: r.TxID(), Payload: payload, Timestamp: n.Now().Unix(), Sender: "governance"}
+	if res := n.Mempool.Admit(tx); !res.Accepted {
+		return "", fmt.Errorf("%s: %s", res.Class, res.Reason)
+	}
+	if n.Gossip != nil {
+		n.Gossip.BroadcastTx(tx)
+	}
+	fmt.Printf("[SCHEMA] Submitted registration of schema v%s %s activating at height %d\n", r.Version, r.SchemaHash, r.ActivationHeight)
+	return tx.TxID, nil
+}
+
+// schemaKey identifies the version and activation height a registration claims, so a block claims it once
+func schemaKey(r *block.SchemaRegistration) string {
+	return fmt.Sprintf("%s:%d", r.Version, r.ActivationHeight)
+}
+
+// schemaRegistrationResult classifies a schema registration that could not be included
+func schemaRegistrationResult(err error) mempool.AdmissionResult {
+	if errors.Is(err, blockchain.ErrSchemaDuplicate) {
+		return mempool.Rejected(mempool.ErrorClassDuplicate, err.Error())
+	}
+	return mempool.Rejected(mempool.ErrorClassPermanent, err.Error())
+}
+
+// verifySchemaRegistrations checks a block's schema_register events before it is accepted
+func (n *Network) verifySchemaRegistrations(blk block.Block) error {
+	if root := block.SchemaRoot(blk.Events); root != blk.SchemaRoot {
+		return fmt.Errorf("block %d: schema registrations do not match SchemaRoot", blk.Height)
+	}
+	seen := make(map[string]bool)
+	for _, evt := range blk.Events {
+		if evt.EventType != block.SchemaRegisterType {
+			continue
+		}
+		r := evt.SchemaRegistration
+		if r == nil {
+			return fmt.Errorf("block %d: schema event %s carries no registration", blk.Height, evt.EventID)
+		}
+		if evt.EventID != ids.NewID([]byte(r.TxID())) {
+			return fmt.Errorf("block %d: schema event %s does not match its registration", blk.Height, evt.EventID)
+		}
+		if seen[schemaKey(r)] {
+			return fmt.Errorf("block %d: repeated schema v%s activation at height %d", blk.Height, r.Version, r.ActivationHeight)
+		}
+		seen[schemaKey(r)] = true
+		if err := blockchain.VerifySchemaRegistration(n.store, r, n.GovernanceKeys, n.governanceQuorum(), blk.Height); err != nil {
+			return fmt.Errorf("block %d: %v", blk.Height, err)
+		}
+	}
+	return nil
+}
+
+// recordSchemaRegistrations registers the schemas of a committed block
+func (n *Network) recordSchemaRegistrations(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for _, evt := range blk.Events {
+		r := evt.SchemaRegistration
+		if evt.EventType != block.SchemaRegisterType || r == nil {
+			continue
+		}
+		if n.Mempool != nil {
+			n.Mempool.RemoveTx(r.TxID())
+		}
+		if err := blockchain.VerifySchemaRegistration(n.store, r, n.GovernanceKeys, n.governanceQuorum(), blk.Height); err != nil {
+			fmt.Printf("[SCHEMA] Not registering schema v%s from block %d: %v\n", r.Version, blk.Height, err)
+			continue
+		}
+		if err := blockchain.ApplySchemaRegistration(n.store, r, blockID, blk.Height); err != nil {
+			fmt.Printf("[SCHEMA] Failed to register schema v%s from block %d: %v\n", r.Version, blk.Height, err)
+			continue
+		}
+		fmt.Printf("[SCHEMA] Registered schema v%s %s in block %d; active from height %d\n", r.Version, r.SchemaHash, blk.Height, r.ActivationHeight)
+	}
+}
+
+// revertSchemaRegistrations undoes recordSchemaRegistrations for a rolled-back block and returns its
+// registrations to the mempool
+func (n *Network) revertSchemaRegistrations(blk block.Block) {
+	blockID := fmt.Sprintf("%x", blk.BlockID[:])
+	for i := len(blk.Events) - 1; i >= 0; i-- {
+		r := blk.Events[i].SchemaRegistration
+		if blk.Events[i].EventType != block.SchemaRegisterType || r == nil {
+			continue
+		}
+		if err := blockchain.RevertSchemaRegistration(n.store, r, blockID); err != nil {
+			fmt.Printf("[SCHEMA] Failed to roll back schema v%s from block %d: %v\n", r.Version, blk.Height, err)
+			continue
+		}
+		n.returnToMempool(r.TxID(), block.SchemaRegisterPayload{Type: block.SchemaRegisterType, Registration: r}, "governance")
+		fmt.Printf("[SCHEMA] Registration of schema v%s rolled back with block %d\n", r.Version, blk.Height)
+	}
+}
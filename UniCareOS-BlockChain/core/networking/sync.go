@@ -0,0 +1,457 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"unicareos/core/block"
+)
+
+// Headers-first sync.
+// 1. Download the header chain from a peer that is ahead and validate it (ID, linkage, producer signature).
+// 2. Fetch block bodies in parallel batches from every peer that is ahead via /blocks?raw=true,
+//    retrying a failed batch on the next peer.
+// 3. Commit bodies in height order, checking each against its validated header.
+
+// SyncConfig tunes headers-first sync
+type SyncConfig struct {
+	HeaderBatch int // Headers per /headers request
+	BodyBatch   int // Blocks per /blocks request (the endpoint caps this at 100)
+	MaxParallel int // Concurrent body requests
+	MaxRetries  int // Attempts per body batch, each on the next peer
+}
+
+// DefaultSyncConfig returns the settings used by the node
+func DefaultSyncConfig() SyncConfig {
+	return SyncConfig{
+		HeaderBatch: 500,
+		BodyBatch:   100,
+		MaxParallel: 8,
+		MaxRetries:  4,
+	}
+}
+
+// Sync phases reported in SyncProgress
+const (
+	SyncPhaseIdle    = "idle"
+	SyncPhaseHeaders = "headers"
+	SyncPhaseBodies  = "bodies"
+)
+
+// SyncProgress is reported in /status while a sync runs
+type SyncProgress struct {
+	Active           bool      `json:"active"`
+	Phase            string    `json:"phase"`
+	StartHeight      int       `json:"start_height"`
+	TargetHeight     int       `json:"target_height"`
+	HeadersValidated int       `json:"headers_validated"`
+	BodiesCommitted  int       `json:"bodies_committed"`
+	Peers            []string  `json:"peers"`
+	StartedAt        time.Time `json:"started_at,omitempty"`
+	LastError        string    `json:"last_error,omitempty"`
+}
+
+// syncState guards the single active sync and its progress
+type syncState struct {
+	mu       sync.Mutex
+	running  bool
+	progress SyncProgress
+}
+
+func (ss *syncState) update(fn func(p *SyncProgress)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	fn(&ss.progress)
+}
+
+// SyncStatus returns a snapshot of the current (or last) sync
+func (n *Network) SyncStatus() SyncProgress {
+	n.syncer.mu.Lock()
+	defer n.syncer.mu.Unlock()
+	p := n.syncer.progress
+	if p.Phase == "" {
+		p.Phase = SyncPhaseIdle
+	}
+	p.Peers = append([]string(nil), p.Peers...)
+	return p
+}
+
+// HeaderOf strips a block down to the fields covered by its BlockID and signature
+func HeaderOf(b block.Block) block.Block {
+	b.Events = nil
+	b.AuditLog = nil
+	b.BanEvents = nil
+	return b
+}
+
+// ValidateHeader checks that h hashes to its BlockID, extends parent and is signed by its producer.
+func (n *Network) ValidateHeader(h block.Block, parentID [32]byte, parentHeight uint64) error {
+	if h.Height != parentHeight+1 {
+		return fmt.Errorf("header height %d does not follow %d", h.Height, parentHeight)
+	}
+	if h.PrevHash != fmt.Sprintf("%x", parentID[:]) {
+		return fmt.Errorf("header %d does not link to parent %x", h.Height, parentID[:])
+	}
+	return n.VerifyBlockSeal(h)
+}
+
+// errBadSignature marks seal failures caused by the producer signature (scored as OffenseBadSignature)
+var errBadSignature = errors.New("invalid producer signature")
+
+// VerifyBlockSeal checks that a block hashes to its BlockID and is signed by a producer in the node set
+func (n *Network) VerifyBlockSeal(h block.Block) error {
+	if h.ComputeID() != h.BlockID {
+		return fmt.Errorf("header %d: BlockID does not match header hash", h.Height)
+	}
+	pub, err := producerKey(h.ValidatorDID)
+	if err != nil {
+		return fmt.Errorf("header %d: %v", h.Height, err)
+	}
+	if !ed25519.Verify(pub, h.BlockID[:], h.Signature) {
+		return fmt.Errorf("header %d: %w", h.Height, errBadSignature)
+	}
+	if n.Transport != nil && !n.Transport.Keys.SealAllowed(pub, h.Timestamp) {
+		return fmt.Errorf("header %d: producer %x is not in the node set", h.Height, []byte(pub))
+	}
+	return nil
+}
+
+// sealOffense maps a VerifyBlockSeal/ValidateHeader error to the offense it is scored as
+func sealOffense(err error) Offense {
+	if errors.Is(err, errBadSignature) {
+		return OffenseBadSignature
+	}
+	return OffenseInvalidBlock
+}
+
+// producerKey extracts the Ed25519 key from a ValidatorDID of the form "ed25519:<hex>"
+func producerKey(did string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(did, "ed25519:") {
+		return nil, fmt.Errorf("unsupported validator DID %q", did)
+	}
+	k, err := hex.DecodeString(strings.TrimPrefix(did, "ed25519:"))
+	if err != nil || len(k) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid validator key in DID %q", did)
+	}
+	return ed25519.PublicKey(k), nil
+}
+
+// fetchHeaders downloads headers [start, end] from a peer
+func (n *Network) fetchHeaders(address string, start, end int) ([]block.Block, error) {
+	resp, err := n.peerHTTP().Get(PeerURL(address, fmt.Sprintf("/headers?start=%d&end=%d", start, end)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	var headers []block.Block
+	if err := json.NewDecoder(resp.Body).Decode(&headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// fetchBodies downloads raw blocks [start, end] from a peer via the /blocks range endpoint
+func (n *Network) fetchBodies(address string, start, end int) ([]json.RawMessage, error) {
+	url := PeerURL(address, fmt.Sprintf("/blocks?start=%d&end=%d&limit=%d&raw=true", start, end, end-start+1))
+	resp, err := n.peerHTTP().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	var bodies []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&bodies); err != nil {
+		return nil, err
+	}
+	return bodies, nil
+}
+
+// syncPeersAhead returns peers that serve headers-first sync and whose advertised height exceeds ours, preferred first
+func (n *Network) syncPeersAhead(myHeight int, preferred string) ([]string, int) {
+	peers := []string{}
+	target := myHeight
+	for _, p := range n.Peers() {
+		if p.ChainHeight <= myHeight || !p.Supports(FeatureHeadersSync) {
+			continue
+		}
+		if p.Address == preferred {
+			peers = append([]string{p.Address}, peers...)
+		} else {
+			peers = append(peers, p.Address)
+		}
+		if p.ChainHeight > target {
+			target = p.ChainHeight
+		}
+	}
+	return peers, target
+}
+
+// HeadersFirstSync catches up to the best peer height. preferred, if set, is tried first for headers.
+// Only one sync runs at a time; concurrent calls return immediately.
+func (n *Network) HeadersFirstSync(preferred string, cfg SyncConfig) error {
+	if cfg.HeaderBatch <= 0 || cfg.BodyBatch <= 0 || cfg.MaxParallel <= 0 || cfg.MaxRetries <= 0 {
+		cfg = DefaultSyncConfig()
+	}
+	n.syncer.mu.Lock()
+	if n.syncer.running {
+		n.syncer.mu.Unlock()
+		return nil
+	}
+	n.syncer.running = true
+	n.syncer.mu.Unlock()
+	defer func() {
+		n.syncer.mu.Lock()
+		n.syncer.running = false
+		n.syncer.progress.Active = false
+		n.syncer.progress.Phase = SyncPhaseIdle
+		n.syncer.mu.Unlock()
+	}()
+
+	myHeight := n.getChainHeight()
+	tipID := n.GetLatestBlockID()
+	peers, target := n.syncPeersAhead(myHeight, preferred)
+	if len(peers) == 0 {
+		return nil
+	}
+	n.syncer.update(func(p *SyncProgress) {
+		*p = SyncProgress{Active: true, Phase: SyncPhaseHeaders, StartHeight: myHeight, TargetHeight: target, Peers: peers, StartedAt: n.Now().UTC()}
+	})
+	fmt.Printf("[SYNC] Headers-first sync from height %d to %d using %d peer(s)\n", myHeight, target, len(peers))
+
+	headers, err := n.downloadHeaders(peers, myHeight, tipID, target, cfg)
+	if err != nil && len(headers) == 0 {
+		n.syncer.update(func(p *SyncProgress) { p.LastError = err.Error() })
+		return err
+	}
+	if err != nil {
+		// Keep the validated prefix; the rest is picked up by the next sync
+		fmt.Printf("[SYNC] Header download stopped early at %d: %v\n", myHeight+len(headers), err)
+	}
+
+	n.syncer.update(func(p *SyncProgress) { p.Phase = SyncPhaseBodies })
+	committed, err := n.downloadBodies(peers, headers, cfg)
+	fmt.Printf("[SYNC] Committed %d/%d block(s)\n", committed, len(headers))
+	if err != nil {
+		n.syncer.update(func(p *SyncProgress) { p.LastError = err.Error() })
+	}
+	return err
+}
+
+// downloadHeaders fetches and validates headers above our tip, rotating peers on failure
+func (n *Network) downloadHeaders(peers []string, myHeight int, tipID [32]byte, target int, cfg SyncConfig) ([]block.Block, error) {
+	headers := []block.Block{}
+	parentID, parentHeight := tipID, uint64(myHeight)
+	peerIdx := 0
+	failures := 0
+	for int(parentHeight) < target {
+		if failures >= len(peers)*cfg.MaxRetries {
+			return headers, errors.New("no peer served a valid header chain")
+		}
+		peer := peers[peerIdx%len(peers)]
+		start := int(parentHeight) + 1
+		end := start + cfg.HeaderBatch - 1
+		if end > target {
+			end = target
+		}
+		batch, err := n.fetchHeaders(peer, start, end)
+		if err == nil && len(batch) == 0 {
+			err = errors.New("empty header batch")
+			n.PenalizePeer(peer, nil, OffenseFalseHeight, fmt.Sprintf("advertised height %d but served no header at %d", n.getPeerHeightFromTable(peer), start))
+		}
+		if err == nil {
+			for _, h := range batch {
+				if verr := n.ValidateHeader(h, parentID, parentHeight); verr != nil {
+					err = verr
+					n.PenalizePeer(peer, nil, sealOffense(verr), verr.Error())
+					break
+				}
+				headers = append(headers, h)
+				parentID, parentHeight = [32]byte(h.BlockID), h.Height
+			}
+		}
+		if err != nil {
+			fmt.Printf("[SYNC] Header batch %d-%d from %s failed: %v\n", start, end, peer, err)
+			failures++
+			peerIdx++ // rotate
+			continue
+		}
+		count := len(headers)
+		n.syncer.update(func(p *SyncProgress) { p.HeadersValidated = count })
+	}
+	return headers, nil
+}
+
+type bodyBatch struct {
+	index   int
+	headers []block.Block
+	blocks  [][]byte
+	err     error
+}
+
+// downloadBodies fetches bodies for validated headers in parallel and commits them in order.
+// It returns the number of blocks committed.
+func (n *Network) downloadBodies(peers []string, headers []block.Block, cfg SyncConfig) (int, error) {
+	var batches []bodyBatch
+	for i := 0; i < len(headers); i += cfg.BodyBatch {
+		end := i + cfg.BodyBatch
+		if end > len(headers) {
+			end = len(headers)
+		}
+		batches = append(batches, bodyBatch{index: len(batches), headers: headers[i:end]})
+	}
+
+	jobs := make(chan bodyBatch)
+	results := make(chan bodyBatch)
+	workers := cfg.MaxParallel
+	if workers > len(batches) {
+		workers = len(batches)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				results <- n.fetchBodyBatch(peers, b, cfg)
+			}
+		}()
+	}
+	go func() {
+		for _, b := range batches {
+			jobs <- b
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Commit contiguous batches as they arrive
+	pending := map[int]bodyBatch{}
+	next, committed := 0, 0
+	var firstErr error
+	for res := range results {
+		pending[res.index] = res
+		for {
+			b, ok := pending[next]
+			if !ok || firstErr != nil {
+				break
+			}
+			delete(pending, next)
+			if b.err != nil {
+				firstErr = b.err
+				break
+			}
+			if err := n.commitSyncedBlocks(b); err != nil {
+				firstErr = err
+				break
+			}
+			committed += len(b.blocks)
+			next++
+			c := committed
+			n.syncer.update(func(p *SyncProgress) { p.BodiesCommitted = c })
+		}
+	}
+	return committed, firstErr
+}
+
+// fetchBodyBatch tries each peer in turn (starting at a batch-dependent offset) until one serves valid bodies
+func (n *Network) fetchBodyBatch(peers []string, b bodyBatch, cfg SyncConfig) bodyBatch {
+	start := int(b.headers[0].Height)
+	end := int(b.headers[len(b.headers)-1].Height)
+	for attempt := 0; attempt < cfg.MaxRetries; attempt++ {
+		peer := peers[(b.index+attempt)%len(peers)]
+		raw, err := n.fetchBodies(peer, start, end)
+		if err == nil {
+			if b.blocks, err = matchBodies(b.headers, raw); err != nil {
+				n.PenalizePeer(peer, nil, OffenseInvalidBlock, err.Error())
+			}
+		}
+		if err == nil {
+			b.err = nil
+			return b
+		}
+		fmt.Printf("[SYNC] Body batch %d-%d from %s failed (attempt %d): %v\n", start, end, peer, attempt+1, err)
+		b.err = err
+	}
+	b.err = fmt.Errorf("body batch %d-%d: %v", start, end, b.err)
+	return b
+}
+
+// verifyEventsRoot checks a non-genesis block's events against its MerkleRoot
+func verifyEventsRoot(blk block.Block) error {
+	if blk.Height > 0 && block.EventsRoot(blk.Events) != blk.MerkleRoot {
+		return fmt.Errorf("block at height %d: events do not match MerkleRoot", blk.Height)
+	}
+	return nil
+}
+
+// matchBodies checks each raw block against its validated header
+func matchBodies(headers []block.Block, raw []json.RawMessage) ([][]byte, error) {
+	if len(raw) != len(headers) {
+		return nil, fmt.Errorf("expected %d blocks, got %d", len(headers), len(raw))
+	}
+	out := make([][]byte, len(raw))
+	for i, r := range raw {
+		blk, err := block.Deserialize(r)
+		if err != nil {
+			return nil, err
+		}
+		if blk.BlockID != headers[i].BlockID || blk.ComputeID() != headers[i].BlockID {
+			return nil, fmt.Errorf("block at height %d does not match its header", headers[i].Height)
+		}
+		if err := verifyEventsRoot(*blk); err != nil {
+			return nil, err
+		}
+		if block.BanEventsRoot(blk.BanEvents) != blk.BanRoot {
+			return nil, fmt.Errorf("block at height %d: ban events do not match BanRoot", headers[i].Height)
+		}
+		if block.EpochFinalizationsRoot(blk.EpochFinalizations) != blk.FinalizationRoot {
+			return nil, fmt.Errorf("block at height %d: epoch finalizations do not match FinalizationRoot", headers[i].Height)
+		}
+		if block.EventFinalizationsRoot(blk.Events) != blk.EventFinalizationRoot {
+			return nil, fmt.Errorf("block at height %d: finalize events do not match EventFinalizationRoot", headers[i].Height)
+		}
+		if block.ConsentRoot(blk.Events) != blk.ConsentRoot {
+			return nil, fmt.Errorf("block at height %d: consent events do not match ConsentRoot", headers[i].Height)
+		}
+		if block.EmergencyAccessRoot(blk.Events) != blk.EmergencyAccessRoot {
+			return nil, fmt.Errorf("block at height %d: emergency access events do not match EmergencyAccessRoot", headers[i].Height)
+		}
+		if block.SchemaRoot(blk.Events) != blk.SchemaRoot {
+			return nil, fmt.Errorf("block at height %d: schema registrations do not match SchemaRoot", headers[i].Height)
+		}
+		out[i] = r
+	}
+	return out, nil
+}
+
+// commitSyncedBlocks commits a batch block by block through commitBlock, like SaveNewBlock. Blocks already
+// committed (by gossip meanwhile) are skipped; the first block that fails, or no longer extends the tip
+// because it moved during the sync, is rejected whole and stops the sync, keeping the blocks before it.
+func (n *Network) commitSyncedBlocks(b bodyBatch) error {
+	for i, raw := range b.blocks {
+		h := b.headers[i]
+		blk, err := block.Deserialize(raw)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", h.Height, err)
+		}
+		if _, err := n.commitBlock(*blk, raw); errors.Is(err, errNotOnTip) {
+			return fmt.Errorf("sync stopped at block %d: %v", h.Height, err)
+		} else if err != nil {
+			return fmt.Errorf("rejected synced block: %v", err)
+		}
+	}
+	return nil
+}
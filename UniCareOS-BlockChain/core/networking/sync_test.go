@@ -0,0 +1,250 @@
+package networking
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/state"
+	"unicareos/core/storage"
+)
+
+// buildTestChain returns n signed blocks (heights 0..n-1) linked by PrevHash
+func buildTestChain(t *testing.T, n int, priv ed25519.PrivateKey) []block.Block {
+	did := fmt.Sprintf("ed25519:%x", []byte(priv.Public().(ed25519.PublicKey)))
+	chain := make([]block.Block, 0, n)
+	prev := ""
+	for h := 0; h < n; h++ {
+		b := block.Block{
+			Version:      "1.0",
+			Height:       uint64(h),
+			PrevHash:     prev,
+			Timestamp:    time.Unix(int64(1700000000+h), 0).UTC(),
+			ValidatorDID: did,
+			Events:       []block.ChainedEvent{},
+		}
+		b.BlockID = b.ComputeID()
+		b.Signature = ed25519.Sign(priv, b.BlockID[:])
+		chain = append(chain, b)
+		prev = fmt.Sprintf("%x", b.BlockID[:])
+	}
+	return chain
+}
+
+func newTestStore(t *testing.T, blocks []block.Block) *storage.Storage {
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, b := range blocks {
+		data, _ := json.Marshal(b)
+		if err := store.SaveBlock(b.BlockID[:], data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// serveChain exposes /headers and a raw-only /blocks over the peer transport.
+// corrupt, if set, rewrites a body before it is served.
+func serveChain(t *testing.T, tr *Transport, store *storage.Storage, corrupt func(b *block.Block)) string {
+	n := &Network{Transport: tr, PeerMux: http.NewServeMux(), store: store}
+	n.PeerMux.HandleFunc("/headers", RequestHeadersHandler(store))
+	n.PeerMux.HandleFunc("/blocks", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		end, _ := strconv.Atoi(r.URL.Query().Get("end"))
+		raw := []json.RawMessage{}
+		for h := start; h <= end; h++ {
+			id, err := store.GetBlockIDByHeight(h)
+			if err != nil {
+				break
+			}
+			data, _ := store.GetBlock(id)
+			if corrupt != nil {
+				b, _ := block.Deserialize(data)
+				corrupt(b)
+				data, _ = json.Marshal(b)
+			}
+			raw = append(raw, data)
+		}
+		json.NewEncoder(w).Encode(raw)
+	})
+	return serveTransport(t, n)
+}
+
+func TestHeadersFirstSyncRotatesAwayFromBadPeer(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 250, producer)
+
+	good := newTestTransport(t, nil)
+	bad := newTestTransport(t, nil)
+	client := newTestTransport(t, NewPeerKeySet(good.PubKey, bad.PubKey, producer.Public().(ed25519.PublicKey)))
+	good.Keys.Add(client.PubKey)
+	bad.Keys.Add(client.PubKey)
+
+	goodAddr := serveChain(t, good, newTestStore(t, chain), nil)
+	badAddr := serveChain(t, bad, newTestStore(t, chain), func(b *block.Block) { b.Timestamp = b.Timestamp.Add(time.Second) })
+
+	n := &Network{Transport: client, store: newTestStore(t, chain[:1])}
+	n.SetLatestBlockID(chain[0].BlockID)
+	features := []string{FeatureHeadersSync}
+	n.peers = []Peer{{Address: badAddr, ChainHeight: 249, Features: features}, {Address: goodAddr, ChainHeight: 249, Features: features}}
+
+	cfg := SyncConfig{HeaderBatch: 100, BodyBatch: 40, MaxParallel: 3, MaxRetries: 2}
+	if err := n.HeadersFirstSync(badAddr, cfg); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if got := n.getChainHeight(); got != 249 {
+		t.Fatalf("expected height 249 after sync, got %d", got)
+	}
+	if n.GetLatestBlockID() != [32]byte(chain[249].BlockID) {
+		t.Error("tip does not match the source chain")
+	}
+	status := n.SyncStatus()
+	if status.Active || status.HeadersValidated != 249 || status.BodiesCommitted != 249 {
+		t.Errorf("unexpected progress after sync: %+v", status)
+	}
+}
+
+func TestValidateHeaderRejectsForgedChain(t *testing.T) {
+	_, producer, _ := ed25519.GenerateKey(nil)
+	_, stranger, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 3, producer)
+	n := &Network{Transport: newTestTransport(t, NewPeerKeySet(producer.Public().(ed25519.PublicKey)))}
+	parent := [32]byte(chain[0].BlockID)
+
+	if err := n.ValidateHeader(chain[1], parent, 0); err != nil {
+		t.Fatalf("valid header rejected: %v", err)
+	}
+	if err := n.ValidateHeader(chain[2], parent, 0); err == nil {
+		t.Error("header that skips a height was accepted")
+	}
+	tampered := chain[1]
+	tampered.Epoch = 7
+	if err := n.ValidateHeader(tampered, parent, 0); err == nil {
+		t.Error("header with mismatched BlockID was accepted")
+	}
+	forged := buildTestChain(t, 2, stranger)[1]
+	forged.PrevHash = chain[1].PrevHash
+	forged.BlockID = forged.ComputeID()
+	forged.Signature = ed25519.Sign(stranger, forged.BlockID[:])
+	if err := n.ValidateHeader(forged, parent, 0); err == nil {
+		t.Error("header signed by a key outside the node set was accepted")
+	}
+}
+
+func TestMatchBodiesRejectsAlteredEvents(t *testing.T) {
+	_, producer, _ := ed25519.GenerateKey(nil)
+	parent := buildTestChain(t, 1, producer)[0]
+	blk := block.Block{
+		Version:   "1.0",
+		Height:    1,
+		PrevHash:  fmt.Sprintf("%x", parent.BlockID[:]),
+		Timestamp: parent.Timestamp.Add(time.Second),
+		Events:    []block.ChainedEvent{{EventType: "medical_record", PatientID: "did:key:z6Mkpatient", Timestamp: parent.Timestamp}},
+	}
+	blk.MerkleRoot = block.EventsRoot(blk.Events)
+	blk.BlockID = blk.ComputeID()
+	raw, _ := json.Marshal(blk)
+	if _, err := matchBodies([]block.Block{blk}, []json.RawMessage{raw}); err != nil {
+		t.Fatalf("matching body rejected: %v", err)
+	}
+
+	// Same header, different events: the BlockID still matches, the MerkleRoot does not
+	blk.Events[0].PatientID = "did:key:z6Mkother"
+	raw, _ = json.Marshal(blk)
+	if _, err := matchBodies([]block.Block{blk}, []json.RawMessage{raw}); err == nil {
+		t.Error("body with altered events was accepted")
+	}
+}
+
+func TestHeadersFirstSyncRejectsBlockFailingConsensusChecks(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, producer, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 10, producer)
+
+	// Block 6 carries a ban no validator quorum approved; its header and BanRoot are consistent
+	bans := []block.BanEvent{{Address: "10.0.0.9", Expiry: time.Now().Add(time.Hour).Format(time.RFC3339), Reason: "spam", Origin: chain[0].ValidatorDID}}
+	for h := 6; h < len(chain); h++ {
+		b := chain[h]
+		b.PrevHash = fmt.Sprintf("%x", chain[h-1].BlockID[:])
+		if h == 6 {
+			b.BanEvents = bans
+			b.BanRoot = block.BanEventsRoot(bans)
+		}
+		b.BlockID = b.ComputeID()
+		b.Signature = ed25519.Sign(producer, b.BlockID[:])
+		chain[h] = b
+	}
+
+	src := newTestTransport(t, nil)
+	client := newTestTransport(t, NewPeerKeySet(src.PubKey, producer.Public().(ed25519.PublicKey)))
+	src.Keys.Add(client.PubKey)
+	addr := serveChain(t, src, newTestStore(t, chain), nil)
+
+	n := &Network{Transport: client, Bans: NewBanManager(nil), store: newTestStore(t, chain[:1])}
+	n.SetLatestBlockID(chain[0].BlockID)
+	n.peers = []Peer{{Address: addr, ChainHeight: 9, Features: []string{FeatureHeadersSync}}}
+
+	cfg := SyncConfig{HeaderBatch: 100, BodyBatch: 4, MaxParallel: 2, MaxRetries: 1}
+	if err := n.HeadersFirstSync(addr, cfg); err == nil {
+		t.Fatal("sync accepted a block carrying an unapproved ban")
+	}
+	if n.GetLatestBlockID() != [32]byte(chain[5].BlockID) {
+		t.Errorf("expected the tip to stop before the rejected block, got height %d", n.getChainHeight())
+	}
+	if stored, err := n.store.GetBlock(chain[6].BlockID[:]); err == nil && stored != nil {
+		t.Error("rejected block was stored")
+	}
+	if n.IsPeerBanned("10.0.0.9") {
+		t.Error("ban from a rejected block was applied")
+	}
+}
+
+func TestCommitSyncedBlocksRespectsTheTip(t *testing.T) {
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, priv, _ := ed25519.GenerateKey(nil)
+	chain := buildTestChain(t, 5, priv)
+	n := &Network{Bans: NewBanManager(nil), ChainState: &state.ChainState{}, EpochBlockCount: 10}
+	n.store = newTestStore(t, chain[:3])
+	n.SetLatestBlockID(chain[2].BlockID)
+	batch := func(blocks ...block.Block) bodyBatch {
+		b := bodyBatch{}
+		for _, blk := range blocks {
+			raw, _ := json.Marshal(blk)
+			b.headers, b.blocks = append(b.headers, blk), append(b.blocks, raw)
+		}
+		return b
+	}
+
+	// Gossip commits height 3 while the sync is downloading it: the synced copy is skipped, not applied again
+	if err := n.SaveNewBlock(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.commitSyncedBlocks(batch(chain[3], chain[4])); err != nil {
+		t.Fatal(err)
+	}
+	if n.GetLatestBlockID() != chain[4].BlockID || n.ChainState.BlocksInEpoch != 2 {
+		t.Fatalf("tip %x, blocks in epoch %d; want height 4 counted once", n.GetLatestBlockID(), n.ChainState.BlocksInEpoch)
+	}
+
+	// A synced block that no longer extends the tip stops the sync and leaves the tip alone
+	stale := chain[2]
+	stale.Timestamp = stale.Timestamp.Add(time.Second)
+	stale.PrevHash = fmt.Sprintf("%x", chain[1].BlockID[:])
+	stale.BlockID = stale.ComputeID()
+	if err := n.commitSyncedBlocks(batch(stale)); err == nil {
+		t.Fatal("synced block off the tip committed")
+	}
+	if n.GetLatestBlockID() != chain[4].BlockID || n.ChainState.BlocksInEpoch != 2 {
+		t.Error("synced block off the tip moved the tip or was counted")
+	}
+}
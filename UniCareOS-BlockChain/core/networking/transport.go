@@ -0,0 +1,360 @@
+package networking
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"unicareos/core/signer"
+)
+
+// P2P transport: every peer connection is TLS 1.3 with mutual authentication.
+// Each node presents a self-signed certificate over its Ed25519 node key; the TLS
+// CertificateVerify message proves possession of that key, and the key must be in
+// the PeerKeySet. ALPN selects what runs over the connection: the JSON hello
+// handshake, or HTTP peer RPC (blocks, sync, gossip) served from Network.PeerMux.
+// The key-rotation protocol is the one exception to the allowlist: a node that has just rotated its key
+// connects with the new key and may only deliver a rotation to that key signed by an allowed one.
+const (
+	ALPNHandshake   = "unicare-hello/1"
+	ALPNPeerRPC     = "http/1.1" // net/http only serves HTTP/1.x for the standard protocol IDs
+	ALPNKeyRotation = "unicare-keyrotation/1"
+
+	handshakeTimeout = 10 * time.Second
+)
+
+// PeerKeySet is the set of node public keys (validators and full nodes) allowed to connect.
+type PeerKeySet struct {
+	mu       sync.RWMutex
+	keys     map[string]struct{}  // hex pubkey -> present
+	retired  map[string]time.Time // hex pubkey -> rotation time; never admitted again
+	AllowAny bool                 // Dev only: admit any key that proves possession
+}
+
+// NewPeerKeySet returns a set containing the given Ed25519 public keys
+func NewPeerKeySet(keys ...[]byte) *PeerKeySet {
+	s := &PeerKeySet{keys: make(map[string]struct{}), retired: make(map[string]time.Time)}
+	for _, k := range keys {
+		s.Add(k)
+	}
+	return s
+}
+
+// LoadPeerKeySet reads a JSON array of hex-encoded Ed25519 public keys (same format as producers.json)
+func LoadPeerKeySet(path string) (*PeerKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hexKeys []string
+	if err := json.Unmarshal(data, &hexKeys); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	s := NewPeerKeySet()
+	for _, h := range hexKeys {
+		k, err := hex.DecodeString(strings.TrimSpace(h))
+		if err != nil || len(k) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid peer key %q in %s", h, path)
+		}
+		s.Add(k)
+	}
+	return s, nil
+}
+
+// Add admits a public key
+func (s *PeerKeySet) Add(pub []byte) {
+	if len(pub) != ed25519.PublicKeySize {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[hex.EncodeToString(pub)] = struct{}{}
+}
+
+// Remove revokes a public key
+func (s *PeerKeySet) Remove(pub []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, hex.EncodeToString(pub))
+}
+
+// Allowed reports whether pub may connect
+func (s *PeerKeySet) Allowed(pub []byte) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, retired := s.retired[hex.EncodeToString(pub)]; retired {
+		return false
+	}
+	if s.AllowAny {
+		return true
+	}
+	_, ok := s.keys[hex.EncodeToString(pub)]
+	return ok
+}
+
+// Retire revokes a key replaced by a rotation at time at. Blocks it sealed before then stay valid.
+func (s *PeerKeySet) Retire(pub []byte, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, hex.EncodeToString(pub))
+	if s.retired == nil {
+		s.retired = make(map[string]time.Time)
+	}
+	s.retired[hex.EncodeToString(pub)] = at
+}
+
+// Reinstate undoes Retire when the rotation that retired pub is rolled back
+func (s *PeerKeySet) Reinstate(pub []byte) {
+	if len(pub) != ed25519.PublicKeySize {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.retired, hex.EncodeToString(pub))
+	s.keys[hex.EncodeToString(pub)] = struct{}{}
+}
+
+// SealAllowed reports whether pub may seal a block timestamped ts: an allowed key, or a retired key for
+// blocks from before its rotation
+func (s *PeerKeySet) SealAllowed(pub []byte, ts time.Time) bool {
+	if s.Allowed(pub) {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	at, ok := s.retired[hex.EncodeToString(pub)]
+	return ok && ts.Before(at)
+}
+
+// Len returns the number of admitted keys
+func (s *PeerKeySet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys)
+}
+
+// Transport builds TLS configs and peer clients bound to this node's Ed25519 identity.
+type Transport struct {
+	PubKey ed25519.PublicKey
+	Keys   *PeerKeySet
+
+	cert   tls.Certificate
+	client *http.Client
+}
+
+// NewTransport creates a transport for the node keypair. keys decides which peers are admitted;
+// our own key is always added so a node can talk to itself in local setups.
+func NewTransport(pubKey, privKey []byte, keys *PeerKeySet) (*Transport, error) {
+	if len(privKey) != ed25519.PrivateKeySize || len(pubKey) != ed25519.PublicKeySize {
+		return nil, errors.New("transport requires an Ed25519 node keypair")
+	}
+	priv := ed25519.PrivateKey(privKey)
+	if !priv.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(pubKey)) {
+		return nil, errors.New("node public key does not match private key")
+	}
+	return NewSignerTransport(priv, keys)
+}
+
+// NewSignerTransport is NewTransport for a node key that may live on a token; the TLS handshake signs with it
+func NewSignerTransport(key signer.Signer, keys *PeerKeySet) (*Transport, error) {
+	pubKey, ok := signer.PublicKey(key)
+	if !ok {
+		return nil, errors.New("transport requires an Ed25519 node key")
+	}
+	cert, err := selfSignedNodeCert(key)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = NewPeerKeySet()
+	}
+	keys.Add(pubKey)
+	t := &Transport{PubKey: ed25519.PublicKey(pubKey), Keys: keys, cert: cert}
+	t.client = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return t.DialContext(ctx, addr, ALPNPeerRPC)
+			},
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	return t, nil
+}
+
+// selfSignedNodeCert wraps the node key in a certificate; only the key matters to peers.
+func selfSignedNodeCert(priv signer.Signer) (tls.Certificate, error) {
+	pub, _ := signer.PublicKey(priv)
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hex.EncodeToString(pub)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create node certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}, nil
+}
+
+// verifyPeerCert checks that the peer presented an Ed25519 node key in the allowed set.
+// Chain validation is skipped on purpose: certificates are self-signed and trust is pinned to the key.
+func (t *Transport) verifyPeerCert(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("peer presented no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("parse peer certificate: %w", err)
+	}
+	pub, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return errors.New("peer certificate is not an Ed25519 node key")
+	}
+	if !t.Keys.Allowed(pub) {
+		return fmt.Errorf("peer key %x is not in the validator/full-node set", []byte(pub))
+	}
+	return nil
+}
+
+// ServerTLSConfig is used by the P2P listener
+func (t *Transport) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS13,
+		Certificates:     []tls.Certificate{t.cert},
+		ClientAuth:       tls.RequireAnyClientCert,
+		VerifyConnection: t.verifyInbound,
+		NextProtos:       []string{ALPNHandshake, ALPNPeerRPC, ALPNKeyRotation},
+	}
+}
+
+// verifyInbound checks a client key against the allowed set, except on the key-rotation protocol,
+// whose handler only accepts a rotation to the key the client proved it holds
+func (t *Transport) verifyInbound(cs tls.ConnectionState) error {
+	if cs.NegotiatedProtocol == ALPNKeyRotation {
+		if PeerKey(cs) == nil {
+			return errors.New("peer certificate is not an Ed25519 node key")
+		}
+		return nil
+	}
+	raw := make([][]byte, len(cs.PeerCertificates))
+	for i, c := range cs.PeerCertificates {
+		raw[i] = c.Raw
+	}
+	return t.verifyPeerCert(raw, nil)
+}
+
+// ClientTLSConfig is used when dialing a peer for the given ALPN protocol
+func (t *Transport) ClientTLSConfig(proto string) *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS13,
+		Certificates:          []tls.Certificate{t.cert},
+		InsecureSkipVerify:    true, // replaced by verifyPeerCert (key pinning)
+		VerifyPeerCertificate: t.verifyPeerCert,
+		NextProtos:            []string{proto},
+	}
+}
+
+// DialContext opens an authenticated connection to a peer's P2P address
+func (t *Transport) DialContext(ctx context.Context, address, proto string) (*tls.Conn, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: handshakeTimeout},
+		Config:    t.ClientTLSConfig(proto),
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := conn.(*tls.Conn)
+	if tlsConn.ConnectionState().NegotiatedProtocol != proto {
+		tlsConn.Close()
+		return nil, fmt.Errorf("peer %s does not speak %s", address, proto)
+	}
+	return tlsConn, nil
+}
+
+// Dial opens an authenticated handshake connection to a peer
+func (t *Transport) Dial(address string) (*tls.Conn, error) {
+	return t.DialContext(context.Background(), address, ALPNHandshake)
+}
+
+// HTTPClient returns a client whose requests run over authenticated peer connections.
+// Use it with PeerURL; plain http:// URLs to other hosts are not supported.
+func (t *Transport) HTTPClient() *http.Client {
+	return t.client
+}
+
+// PeerURL builds the URL for an RPC path on a peer's P2P address
+func PeerURL(address, path string) string {
+	return "https://" + address + path
+}
+
+// PeerKey returns the authenticated Ed25519 key of the remote side of conn
+func PeerKey(state tls.ConnectionState) ed25519.PublicKey {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	pub, _ := state.PeerCertificates[0].PublicKey.(ed25519.PublicKey)
+	return pub
+}
+
+// rpcListener hands accepted peer RPC connections to an http.Server
+type rpcListener struct {
+	conns  chan net.Conn
+	addr   net.Addr
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newRPCListener(addr net.Addr) *rpcListener {
+	return &rpcListener{conns: make(chan net.Conn), addr: addr, closed: make(chan struct{})}
+}
+
+func (l *rpcListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *rpcListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *rpcListener) Addr() net.Addr { return l.addr }
+
+func (l *rpcListener) deliver(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.closed:
+		c.Close()
+	}
+}
@@ -0,0 +1,152 @@
+package networking
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"unicareos/core/block"
+)
+
+// tokenKey stands in for a key on a PKCS#11 token: the network only sees crypto.Signer
+type tokenKey struct {
+	priv  ed25519.PrivateKey
+	signs int
+}
+
+func (k *tokenKey) Public() crypto.PublicKey { return k.priv.Public() }
+
+func (k *tokenKey) Sign(r io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	k.signs++
+	return k.priv.Sign(r, msg, opts)
+}
+
+func newTestTransport(t *testing.T, keys *PeerKeySet) *Transport {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTransport(pub, priv, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// serveTransport accepts connections the way Network.Start does and returns the listen address
+func serveTransport(t *testing.T, n *Network) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpc := newRPCListener(ln.Addr())
+	srv := &http.Server{Handler: n.PeerMux}
+	go srv.Serve(rpc)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go n.acceptConnection(conn, rpc)
+		}
+	}()
+	t.Cleanup(func() { ln.Close(); srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestTransportMutualAuth(t *testing.T) {
+	server := newTestTransport(t, nil)
+	client := newTestTransport(t, NewPeerKeySet(server.PubKey))
+	server.Keys.Add(client.PubKey)
+
+	n := &Network{Transport: server, PeerMux: http.NewServeMux()}
+	n.PeerMux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(PeerKey(*r.TLS))
+	})
+	addr := serveTransport(t, n)
+
+	resp, err := client.HTTPClient().Get(PeerURL(addr, "/whoami"))
+	if err != nil {
+		t.Fatalf("authenticated RPC failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !ed25519.PublicKey(body).Equal(client.PubKey) {
+		t.Errorf("server saw key %x, want %x", body, []byte(client.PubKey))
+	}
+}
+
+func TestTransportRejectsUnknownKey(t *testing.T) {
+	server := newTestTransport(t, nil)
+	stranger := newTestTransport(t, NewPeerKeySet(server.PubKey))
+
+	n := &Network{Transport: server, PeerMux: http.NewServeMux()}
+	n.PeerMux.HandleFunc("/chain_height", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"height":1}`))
+	})
+	addr := serveTransport(t, n)
+
+	if resp, err := stranger.HTTPClient().Get(PeerURL(addr, "/chain_height")); err == nil {
+		resp.Body.Close()
+		t.Fatal("server admitted a key outside the peer set")
+	}
+
+	// A client that does not know the server's key refuses it too
+	unknownServer := newTestTransport(t, nil)
+	if _, err := unknownServer.Dial(addr); err == nil {
+		t.Fatal("client accepted a server key outside its peer set")
+	}
+}
+
+func TestTransportRequiresClientCert(t *testing.T) {
+	server := newTestTransport(t, nil)
+	n := &Network{Transport: server, PeerMux: http.NewServeMux()}
+	addr := serveTransport(t, n)
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{ALPNPeerRPC}})
+	if err == nil {
+		// TLS 1.3 reports a missing client certificate on first read
+		conn.Write([]byte("GET /chain_height HTTP/1.1\r\nHost: x\r\n\r\n"))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("connection without a client certificate was accepted")
+	}
+}
+
+func TestNodeKeyOnToken(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	key := &tokenKey{priv: priv}
+	server := &Network{PeerMux: http.NewServeMux(), ProducersDynamic: map[string]struct{}{}}
+	if err := server.UseSigner(key); err != nil {
+		t.Fatal(err)
+	}
+	if server.PrivKey != nil || !ed25519.PublicKey(server.PubKey).Equal(priv.Public()) {
+		t.Fatal("node key material not taken from the signer")
+	}
+	client := newTestTransport(t, NewPeerKeySet(server.PubKey))
+	server.Transport.Keys.Add(client.PubKey)
+	addr := serveTransport(t, server)
+	conn, err := client.Dial(addr)
+	if err != nil {
+		t.Fatalf("handshake with a token-held node key failed: %v", err)
+	}
+	conn.Close()
+	if key.signs == 0 {
+		t.Error("TLS handshake did not sign through the token")
+	}
+
+	e := &block.BanEvent{ProposalID: "proposal"}
+	if err := server.signBanApproval(e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Approvals) != 1 || !ed25519.Verify(server.PubKey, []byte("proposal"), e.Approvals[0].Signature) {
+		t.Error("ban approval not signed with the token key")
+	}
+}
@@ -0,0 +1,25 @@
+package networking
+
+import (
+	"unicareos/core/block"
+	"unicareos/core/mempool"
+)
+
+// TxIDOf derives the mempool TxID of a transaction payload: the type's own TxID for governance, consent,
+// emergency access and event finalization transactions, the payload hash for record and memory
+// submissions. Gossip drops bodies announced under any other TxID.
+func TxIDOf(payload []byte) string {
+	if r, ok := block.ParseSchemaRegisterPayload(payload); ok {
+		return r.TxID()
+	}
+	if a, ok := block.ParseEmergencyAccessPayload(payload); ok {
+		return a.TxID()
+	}
+	if c, ok := block.ParseConsentPayload(payload); ok {
+		return c.TxID()
+	}
+	if fin, ok := block.ParseFinalizeEventPayload(payload); ok {
+		return block.HashFinalizeEventTx(fin)
+	}
+	return mempool.PayloadTxID(payload)
+}
@@ -10,15 +10,20 @@ import (
 	"errors"
 	"time"
 	"crypto/x509"
+	"fmt"
 	"math/big"
+
+	"unicareos/core/keystore"
+	"unicareos/core/signer"
 )
 
 // Wallet represents a signing wallet (private key should be protected)
 type Wallet struct {
 	Address    string
 	PublicKey  []byte
-	PrivateKey []byte // Never expose outside secure enclave
-	Algorithm  string // "ECDSA" or "Ed25519"
+	PrivateKey []byte        // Never expose outside secure enclave
+	Signer     signer.Signer // Ed25519 key held by a token; used instead of PrivateKey when set
+	Algorithm  string        // "ECDSA" or "Ed25519"
 }
 
 // Signature contains all signature metadata
@@ -38,6 +43,13 @@ func SignTransaction(wallet Wallet, payload []byte) (Signature, error) {
 
 	switch wallet.Algorithm {
 	case "Ed25519":
+		if wallet.Signer != nil {
+			var err error
+			if sig, err = signer.Sign(wallet.Signer, hash[:]); err != nil {
+				return Signature{}, err
+			}
+			break
+		}
 		if len(wallet.PrivateKey) != ed25519.PrivateKeySize {
 			return Signature{}, errors.New("invalid Ed25519 private key size")
 		}
@@ -89,10 +101,53 @@ func IsWhitelistedSigner(pubKey []byte) bool {
 	return true
 }
 
-// LoadWalletFromSecretsManager is a placeholder for secure key retrieval
+// WalletKeys is the token holding wallet keys, labelled by wallet address (nil if none is configured)
+var WalletKeys signer.Token
+
+// LoadWalletFromSecretsManager returns the wallet whose Ed25519 key is labelled address on WalletKeys.
+// The private key stays on the token; the wallet signs through it.
 func LoadWalletFromSecretsManager(address string) (Wallet, error) {
-	// TODO: implement secure key retrieval
-	return Wallet{}, errors.New("not implemented")
+	if WalletKeys == nil {
+		return Wallet{}, errors.New("no wallet key store configured")
+	}
+	key, err := WalletKeys.Signer(address)
+	if err != nil {
+		return Wallet{}, fmt.Errorf("wallet %s: %w", address, err)
+	}
+	pub, ok := signer.PublicKey(key)
+	if !ok {
+		return Wallet{}, fmt.Errorf("wallet %s: %w", address, signer.ErrNoKey)
+	}
+	return Wallet{Address: address, PublicKey: pub, Signer: key, Algorithm: "Ed25519"}, nil
+}
+
+// LoadWalletFromKeystore decrypts a wallet keystore file; the keystore label is the wallet address
+func LoadWalletFromKeystore(path string, passphrase []byte) (Wallet, error) {
+	f, err := keystore.Load(path)
+	if err != nil {
+		return Wallet{}, err
+	}
+	if f.Kind != keystore.KindWallet {
+		return Wallet{}, fmt.Errorf("keystore %s holds a %s key, not a wallet key", path, f.Kind)
+	}
+	key, err := f.Decrypt(passphrase)
+	if err != nil {
+		return Wallet{}, err
+	}
+	w := Wallet{Address: f.Label, PrivateKey: key, Algorithm: f.Algorithm}
+	switch f.Algorithm {
+	case "Ed25519":
+		w.PublicKey, _ = hex.DecodeString(f.PublicKey)
+	case "ECDSA":
+		priv, err := BytesToECDSA(key)
+		if err != nil {
+			return Wallet{}, err
+		}
+		if w.PublicKey, err = x509.MarshalPKIXPublicKey(&priv.PublicKey); err != nil {
+			return Wallet{}, err
+		}
+	}
+	return w, nil
 }
 
 // Helpers (implementations for key conversion and signature decoding)
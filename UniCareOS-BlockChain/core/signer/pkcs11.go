@@ -0,0 +1,233 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 v3.0 Edwards-curve identifiers, not defined by the v2.40 headers the binding ships
+const (
+	ckkECEdwards           = 0x40
+	ckmECEdwardsKeyPairGen = 0x1055
+	ckmEdDSA               = 0x1057
+)
+
+// oidEd25519 is the curve named in CKA_EC_PARAMS of Ed25519 keys (RFC 8410)
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// PKCS11Config locates a token and logs in to it
+type PKCS11Config struct {
+	Module     string // Path to the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	TokenLabel string // Label of the token holding the node's keys
+	PIN        string // User PIN
+}
+
+// PKCS11Token is a logged-in session on a PKCS#11 token. Token operations are serialized on the session.
+type PKCS11Token struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	mu      sync.Mutex
+}
+
+// OpenPKCS11 loads the module, finds the token labelled cfg.TokenLabel and logs in as user
+func OpenPKCS11(cfg PKCS11Config) (*PKCS11Token, error) {
+	ctx := pkcs11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("cannot load PKCS#11 module %q", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil && !isCKR(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("initialize PKCS#11 module: %w", err)
+	}
+	t := &PKCS11Token{ctx: ctx}
+	slot, err := t.findSlot(cfg.TokenLabel)
+	if err == nil {
+		t.session, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err == nil {
+			if err = ctx.Login(t.session, pkcs11.CKU_USER, cfg.PIN); isCKR(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+				err = nil
+			}
+			if err != nil {
+				ctx.CloseSession(t.session)
+				err = fmt.Errorf("log in to token %q: %w", cfg.TokenLabel, err)
+			}
+		}
+	}
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *PKCS11Token) findSlot(label string) (uint, error) {
+	slots, err := t.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := t.ctx.GetTokenInfo(slot)
+		if err == nil && strings.TrimRight(info.Label, " \x00") == label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no PKCS#11 token labelled %q", label)
+}
+
+// Close logs out and unloads the module
+func (t *PKCS11Token) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ctx.Logout(t.session)
+	t.ctx.CloseSession(t.session)
+	err := t.ctx.Finalize()
+	t.ctx.Destroy()
+	return err
+}
+
+// Signer returns the Ed25519 key pair labelled label on the token
+func (t *PKCS11Token) Signer(label string) (Signer, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	priv, err := t.findObject(pkcs11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+	pubObj, err := t.findObject(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := t.publicKey(pubObj)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", label, err)
+	}
+	return &PKCS11Signer{Label: label, token: t, key: priv, pub: pub}, nil
+}
+
+// GenerateKey creates an Ed25519 key pair labelled label whose private half is sensitive and cannot be
+// extracted from the token. It is used to provision node and finalizer keys.
+func (t *PKCS11Token) GenerateKey(label string) (Signer, error) {
+	params, err := asn1.Marshal(oidEd25519)
+	if err != nil {
+		return nil, err
+	}
+	pubTmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, ckkECEdwards),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	privTmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, ckkECEdwards),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pubObj, priv, err := t.ctx.GenerateKeyPair(t.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(ckmECEdwardsKeyPairGen, nil)}, pubTmpl, privTmpl)
+	if err != nil {
+		return nil, fmt.Errorf("generate key %q: %w", label, err)
+	}
+	pub, err := t.publicKey(pubObj)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", label, err)
+	}
+	return &PKCS11Signer{Label: label, token: t, key: priv, pub: pub}, nil
+}
+
+// findObject returns the single object of class labelled label. Caller holds t.mu.
+func (t *PKCS11Token) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, ckkECEdwards),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := t.ctx.FindObjectsInit(t.session, tmpl); err != nil {
+		return 0, err
+	}
+	objs, _, err := t.ctx.FindObjects(t.session, 2)
+	t.ctx.FindObjectsFinal(t.session)
+	switch {
+	case err != nil:
+		return 0, err
+	case len(objs) == 0:
+		return 0, fmt.Errorf("no Ed25519 key labelled %q on the token", label)
+	case len(objs) > 1:
+		return 0, fmt.Errorf("several Ed25519 keys labelled %q on the token", label)
+	}
+	return objs[0], nil
+}
+
+// publicKey reads the Ed25519 point of a public key object. Caller holds t.mu.
+func (t *PKCS11Token) publicKey(obj pkcs11.ObjectHandle) (ed25519.PublicKey, error) {
+	attrs, err := t.ctx.GetAttributeValue(t.session, obj, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) == 0 {
+		return nil, errors.New("no CKA_EC_POINT")
+	}
+	point := attrs[0].Value
+	// The point is a DER OCTET STRING; some tokens return the raw 32 bytes
+	var inner []byte
+	if rest, err := asn1.Unmarshal(point, &inner); err == nil && len(rest) == 0 {
+		point = inner
+	}
+	if len(point) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("CKA_EC_POINT of %d bytes is not an Ed25519 key", len(point))
+	}
+	return ed25519.PublicKey(point), nil
+}
+
+// PKCS11Signer is an Ed25519 key held by a token; signing happens inside the token
+type PKCS11Signer struct {
+	Label string
+	token *PKCS11Token
+	key   pkcs11.ObjectHandle
+	pub   ed25519.PublicKey
+}
+
+// Public implements crypto.Signer
+func (s *PKCS11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer. Only pure Ed25519 is supported, so opts must not name a hash.
+func (s *PKCS11Signer) Sign(_ io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil && opts.HashFunc() != crypto.Hash(0) {
+		return nil, errors.New("PKCS#11 Ed25519 keys sign unhashed messages only")
+	}
+	s.token.mu.Lock()
+	defer s.token.mu.Unlock()
+	if err := s.token.ctx.SignInit(s.token.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(ckmEdDSA, nil)}, s.key); err != nil {
+		return nil, fmt.Errorf("sign with key %q: %w", s.Label, err)
+	}
+	sig, err := s.token.ctx.Sign(s.token.session, msg)
+	if err != nil {
+		return nil, fmt.Errorf("sign with key %q: %w", s.Label, err)
+	}
+	return sig, nil
+}
+
+func isCKR(err error, code uint) bool {
+	var e pkcs11.Error
+	return errors.As(err, &e) && uint(e) == code
+}
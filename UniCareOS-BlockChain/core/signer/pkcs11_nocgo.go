@@ -0,0 +1,33 @@
+//go:build !cgo
+
+package signer
+
+import "errors"
+
+// PKCS11Config locates a token and logs in to it
+type PKCS11Config struct {
+	Module     string
+	TokenLabel string
+	PIN        string
+}
+
+// PKCS11Token is unavailable without cgo
+type PKCS11Token struct{}
+
+// OpenPKCS11 always fails: the PKCS#11 binding needs cgo
+func OpenPKCS11(cfg PKCS11Config) (*PKCS11Token, error) {
+	return nil, errors.New("PKCS#11 support requires a cgo build")
+}
+
+// Close implements the cgo API
+func (t *PKCS11Token) Close() error { return nil }
+
+// Signer implements Token
+func (t *PKCS11Token) Signer(label string) (Signer, error) {
+	return nil, errors.New("PKCS#11 support requires a cgo build")
+}
+
+// GenerateKey implements the cgo API
+func (t *PKCS11Token) GenerateKey(label string) (Signer, error) {
+	return nil, errors.New("PKCS#11 support requires a cgo build")
+}
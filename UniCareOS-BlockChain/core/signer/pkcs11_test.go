@@ -0,0 +1,122 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+// softHSM returns the SoftHSM module (SOFTHSM2_MODULE or a standard install path), skipping the test if
+// it is not installed
+func softHSM(t *testing.T) string {
+	candidates := []string{
+		os.Getenv("SOFTHSM2_MODULE"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	t.Skip("SoftHSM not installed; set SOFTHSM2_MODULE to run the PKCS#11 tests")
+	return ""
+}
+
+// initSoftHSMToken creates an empty token labelled label with user PIN pin in a fresh token directory
+func initSoftHSMToken(t *testing.T, module, label, pin string) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+dir+"\nobjectstore.backend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		t.Fatalf("cannot load %s", module)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize()
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no SoftHSM slot: %v", err)
+	}
+	if err := ctx.InitToken(slots[0], "so-pin", label); err != nil {
+		t.Fatal(err)
+	}
+	slots, _ = ctx.GetSlotList(true) // SoftHSM moves the initialized token to a new slot
+	for _, slot := range slots {
+		if info, err := ctx.GetTokenInfo(slot); err != nil || info.Label != label {
+			continue
+		}
+		sh, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.CloseSession(sh)
+		if err := ctx.Login(sh, pkcs11.CKU_SO, "so-pin"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.InitPIN(sh, pin); err != nil {
+			t.Fatal(err)
+		}
+		ctx.Logout(sh)
+		return
+	}
+	t.Fatalf("token %q not found after initialization", label)
+}
+
+func TestPKCS11SignerWithSoftHSM(t *testing.T) {
+	module := softHSM(t)
+	initSoftHSMToken(t, module, "unicare-test", "1234")
+
+	if _, err := OpenPKCS11(PKCS11Config{Module: module, TokenLabel: "unicare-test", PIN: "wrong"}); err == nil {
+		t.Fatal("logged in with a wrong PIN")
+	}
+	token, err := OpenPKCS11(PKCS11Config{Module: module, TokenLabel: "unicare-test", PIN: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer token.Close()
+
+	generated, err := token.GenerateKey("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := token.Signer("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, ok := PublicKey(key)
+	if !ok || !pub.Equal(generated.Public()) {
+		t.Fatal("key found by label differs from the generated key")
+	}
+	sig, err := Sign(key, []byte("block header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, []byte("block header"), sig) {
+		t.Error("token signature does not verify with the Ed25519 public key")
+	}
+	if _, err := key.Sign(nil, []byte("digest"), crypto.SHA256); err == nil {
+		t.Error("pre-hashed signing accepted")
+	}
+	if _, err := token.Signer("missing"); err == nil {
+		t.Error("unknown key label resolved")
+	}
+}
@@ -0,0 +1,52 @@
+// Package signer abstracts the Ed25519 keys a node signs with: blocks, ban approvals, epoch and event
+// finalizations, notary tokens and wallet transactions. A key is either held in process memory
+// (ed25519.PrivateKey, for development) or in a PKCS#11 token such as an HSM, in which case the private
+// key never leaves the token and only signatures cross into the process.
+package signer
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+)
+
+// Signer is an Ed25519 signing key. It is a crypto.Signer, so an ed25519.PrivateKey is one, a token key
+// is one, and either can back a TLS certificate.
+type Signer interface {
+	crypto.Signer
+}
+
+// Token is a store of signing keys addressed by label
+type Token interface {
+	Signer(label string) (Signer, error)
+}
+
+// ErrNoKey is returned when signing with a missing or malformed key
+var ErrNoKey = errors.New("no Ed25519 signing key loaded")
+
+// PublicKey returns the Ed25519 public key of s; ok is false for a nil, malformed or non-Ed25519 signer
+func PublicKey(s Signer) (ed25519.PublicKey, bool) {
+	if s == nil {
+		return nil, false
+	}
+	if k, isKey := s.(ed25519.PrivateKey); isKey && len(k) != ed25519.PrivateKeySize {
+		return nil, false
+	}
+	pub, ok := s.Public().(ed25519.PublicKey)
+	return pub, ok && len(pub) == ed25519.PublicKeySize
+}
+
+// Usable reports whether s is an Ed25519 key that can sign
+func Usable(s Signer) bool {
+	_, ok := PublicKey(s)
+	return ok
+}
+
+// Sign signs msg with s as pure Ed25519 (no pre-hashing)
+func Sign(s Signer, msg []byte) ([]byte, error) {
+	if !Usable(s) {
+		return nil, ErrNoKey
+	}
+	return s.Sign(rand.Reader, msg, crypto.Hash(0))
+}
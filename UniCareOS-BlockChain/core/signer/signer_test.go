@@ -0,0 +1,28 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestInMemoryKey(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	got, ok := PublicKey(priv)
+	if !ok || !got.Equal(pub) {
+		t.Fatal("public key of an in-memory key")
+	}
+	sig, err := Sign(priv, []byte("block"))
+	if err != nil || !ed25519.Verify(pub, []byte("block"), sig) {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	for name, s := range map[string]Signer{"nil": nil, "empty": ed25519.PrivateKey(nil), "short": priv[:32]} {
+		if Usable(s) {
+			t.Errorf("%s key reported usable", name)
+		}
+		if _, err := Sign(s, []byte("block")); !errors.Is(err, ErrNoKey) {
+			t.Errorf("%s key: got %v, want ErrNoKey", name, err)
+		}
+	}
+}
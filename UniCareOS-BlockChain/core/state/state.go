@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -62,6 +63,7 @@ func (cs *ChainState) SaveEpochState() error {
 
 // ChainState represents the persistent blockchain state.
 type ChainState struct {
+	headMu        sync.RWMutex // Guards ChainHead and Height, which are read outside block processing
 	ChainHead     string
 	Height        uint64
 	Epoch         uint64
@@ -75,6 +77,7 @@ type ChainIndexes struct {
 	ByPatientID  map[string][]string
 	ByProviderID map[string][]string
 	ByEpoch      map[uint64][]string
+	Finalized    map[string]string // Medical record event ID → ID of the FinalizeEventTx that finalized it
 }
 
 type StateUpdateReceipt struct {
@@ -136,13 +139,26 @@ func WriteBlockToState(state *ChainState, blk *block.Block, updatedBy string) (S
 
 // SetChainHead updates the canonical chain head pointer.
 func SetChainHead(state *ChainState, blk *block.Block) {
-	state.ChainHead = blk.BlockID.String()
-	state.Height = blk.Height
+	state.SetHead(blk.BlockID.String(), blk.Height)
 	state.Epoch = blk.Epoch
 	// Optionally persist chain head pointer
 	_ = state.StateDB.Put("chain_head", []byte(blk.BlockID.String()))
 }
 
+// SetHead records the tip the node builds on
+func (cs *ChainState) SetHead(blockID string, height uint64) {
+	cs.headMu.Lock()
+	defer cs.headMu.Unlock()
+	cs.ChainHead, cs.Height = blockID, height
+}
+
+// Head returns the tip's block ID ("" before one is recorded) and height
+func (cs *ChainState) Head() (string, uint64) {
+	cs.headMu.RLock()
+	defer cs.headMu.RUnlock()
+	return cs.ChainHead, cs.Height
+}
+
 // IndexEventsByPatientAndType indexes block events for fast lookup.
 func IndexEventsByPatientAndType(state *ChainState, events []block.ChainedEvent) {
 	for _, evt := range events {
@@ -158,6 +174,25 @@ func IndexEventsByPatientAndType(state *ChainState, events []block.ChainedEvent)
 	}
 }
 
+// MarkEventFinalized indexes eventID as finalized by the FinalizeEventTx txID.
+func (cs *ChainState) MarkEventFinalized(eventID, txID string) {
+	if cs == nil {
+		return
+	}
+	if cs.Indexes.Finalized == nil {
+		cs.Indexes.Finalized = make(map[string]string)
+	}
+	cs.Indexes.Finalized[eventID] = txID
+}
+
+// UnmarkEventFinalized drops eventID from the finalized index when the block finalizing it is rolled back.
+func (cs *ChainState) UnmarkEventFinalized(eventID string) {
+	if cs == nil {
+		return
+	}
+	delete(cs.Indexes.Finalized, eventID)
+}
+
 // GetBlockMetadata retrieves metadata for a block by hash.
 func GetBlockMetadata(state *ChainState, blockHash string) (*block.Block, error) {
 	blockKey := fmt.Sprintf("block:%s", blockHash)
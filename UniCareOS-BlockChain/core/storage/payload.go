@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Encrypted payload store.
+// Record bodies carry PHI and never go on chain: PutPayload encrypts them under UNICARE_DEK and keeps the
+// ciphertext keyed by its SHA-256, which the record carries as docHash. docHash is public on chain, so each
+// payload also records the patient and record it was stored for, and is only handed out for that record.
+
+const (
+	payloadPrefix      = "payload:"
+	payloadOwnerPrefix = "payloadowner:"
+)
+
+var (
+	// ErrPayloadTampered is returned when a stored payload no longer matches its docHash
+	ErrPayloadTampered = errors.New("stored payload does not match its docHash")
+	// ErrPayloadNotOwned is returned when a payload is asked for by a record it was not stored for
+	ErrPayloadNotOwned = errors.New("payload belongs to another record")
+)
+
+// PayloadOwner is the record a payload was stored for
+type PayloadOwner struct {
+	PatientDID string `json:"patientDID"`
+	RecordID   string `json:"recordId"`
+}
+
+// EncryptedPayload describes a stored payload the way records reference it
+type EncryptedPayload struct {
+	DocHash   string // Hex SHA-256 of the ciphertext
+	Algorithm string // Always "AES-GCM"
+	IV        string // Base64 GCM nonce
+	Tag       string // Base64 GCM tag
+}
+
+// PutPayload encrypts plaintext and stores it, for owner, under the hash of its ciphertext
+func (s *Storage) PutPayload(plaintext []byte, owner PayloadOwner) (*EncryptedPayload, error) {
+	if owner.PatientDID == "" || owner.RecordID == "" {
+		return nil, errors.New("payload owner needs a patient DID and record ID")
+	}
+	ownerData, err := json.Marshal(owner)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	const nonceSize, tagSize = 12, 16
+	if len(ciphertext) < nonceSize+tagSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	sum := sha256.Sum256(ciphertext)
+	p := &EncryptedPayload{
+		DocHash:   hex.EncodeToString(sum[:]),
+		Algorithm: "AES-GCM",
+		IV:        base64.StdEncoding.EncodeToString(ciphertext[:nonceSize]),
+		Tag:       base64.StdEncoding.EncodeToString(ciphertext[len(ciphertext)-tagSize:]),
+	}
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(payloadPrefix+p.DocHash), ciphertext)
+	batch.Put([]byte(payloadOwnerPrefix+p.DocHash), ownerData)
+	if err := s.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CheckPayloadOwner returns ErrPayloadNotOwned unless the payload stored under docHash was stored for owner.
+// A docHash with no payload stored passes: there is nothing to attach.
+func (s *Storage) CheckPayloadOwner(docHash string, owner PayloadOwner) error {
+	if !s.HasPayload(docHash) {
+		return nil
+	}
+	data, err := s.db.Get([]byte(payloadOwnerPrefix+docHash), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return fmt.Errorf("%w: %s has no recorded owner", ErrPayloadNotOwned, docHash)
+	}
+	if err != nil {
+		return fmt.Errorf("payload %s owner: %w", docHash, err)
+	}
+	var stored PayloadOwner
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("payload %s owner: %w", docHash, err)
+	}
+	if stored != owner {
+		return fmt.Errorf("%w: %s is not the payload of record %s of %s", ErrPayloadNotOwned, docHash, owner.RecordID, owner.PatientDID)
+	}
+	return nil
+}
+
+// GetPayload returns the decrypted payload stored under docHash, if it was stored for owner
+func (s *Storage) GetPayload(docHash string, owner PayloadOwner) ([]byte, error) {
+	if err := s.CheckPayloadOwner(docHash, owner); err != nil {
+		return nil, err
+	}
+	ciphertext, err := s.db.Get([]byte(payloadPrefix+docHash), nil)
+	if err != nil {
+		return nil, fmt.Errorf("payload %s: %w", docHash, err)
+	}
+	if sum := sha256.Sum256(ciphertext); hex.EncodeToString(sum[:]) != docHash {
+		return nil, fmt.Errorf("%w: %s", ErrPayloadTampered, docHash)
+	}
+	return Decrypt(ciphertext)
+}
+
+// HasPayload reports whether a payload is stored under docHash
+func (s *Storage) HasPayload(docHash string) bool {
+	ok, _ := s.db.Has([]byte(payloadPrefix+docHash), nil)
+	return ok
+}
+
+// DeletePayload removes the payload stored under docHash and its owner
+func (s *Storage) DeletePayload(docHash string) error {
+	batch := new(leveldb.Batch)
+	batch.Delete([]byte(payloadPrefix + docHash))
+	batch.Delete([]byte(payloadOwnerPrefix + docHash))
+	return s.db.Write(batch, nil)
+}
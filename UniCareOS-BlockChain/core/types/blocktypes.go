@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"time"
 	"unicareos/types/ids"
 )
@@ -18,6 +19,13 @@ type Block struct {
 	OpUnitsUsed     uint64         `json:"opUnitsUsed"`
 	Events          []Event        `json:"events"`
 	BanEvents       []BanEvent     `json:"banEvents,omitempty"`
+	BanRoot         string         `json:"banRoot,omitempty"`
+	EpochFinalizations []FinalizeEpochTx `json:"epochFinalizations,omitempty"`
+	FinalizationRoot string        `json:"finalizationRoot,omitempty"`
+	EventFinalizationRoot string   `json:"eventFinalizationRoot,omitempty"`
+	ConsentRoot     string         `json:"consentRoot,omitempty"`
+	EmergencyAccessRoot string     `json:"emergencyAccessRoot,omitempty"`
+	SchemaRoot      string         `json:"schemaRoot,omitempty"`
 	ExtraData       []byte         `json:"extraData,omitempty"`
 	ParentGasUsed   uint64         `json:"parentGasUsed,omitempty"`
 	StateRoot       string         `json:"stateRoot,omitempty"`
@@ -35,6 +43,8 @@ type Event struct {
 	Memories        []interface{} `json:"memories,omitempty"`
 	PatientID       string     `json:"patientId,omitempty"`
 	ProviderID      string     `json:"providerId,omitempty"`
+	RecordType      string     `json:"recordType,omitempty"`
+	Priority        string     `json:"priority,omitempty"`
 	Epoch           uint64     `json:"epoch,omitempty"`
 	PayloadHash     string     `json:"payloadHash,omitempty"`
 	PayloadRef      string     `json:"payloadRef,omitempty"`
@@ -42,13 +52,26 @@ type Event struct {
 	RevisionOf      string     `json:"revisionOf,omitempty"`
 	DocLineage      []string   `json:"docLineage,omitempty"`
 	Finalized       bool       `json:"finalized,omitempty"`
+	FinalizeTx      json.RawMessage `json:"finalizeTx,omitempty"` // block.FinalizeEventTx on finalize_event events
+	Consent         json.RawMessage `json:"consent,omitempty"`    // block.ConsentPayload on consent events
+	EmergencyAccess json.RawMessage `json:"emergencyAccess,omitempty"` // block.EmergencyAccess on emergency_access events
+	EmergencyReview json.RawMessage `json:"emergencyReview,omitempty"` // block.EmergencyReviewResolution on emergency_review events
+	SchemaRegistration json.RawMessage `json:"schemaRegistration,omitempty"` // block.SchemaRegistration on schema_register events
 }
 
 type BanEvent struct {
-	Address   string    `json:"address"`
-	Expiry    string    `json:"expiry"`
-	Reason    string    `json:"reason"`
-	Origin    string    `json:"origin"`
-	BanCount  int       `json:"ban_count"`
-	Timestamp time.Time `json:"timestamp"`
+	Address    string        `json:"address"`
+	Expiry     string        `json:"expiry"`
+	Reason     string        `json:"reason"`
+	Evidence   string        `json:"evidence,omitempty"`
+	Origin     string        `json:"origin"`
+	BanCount   int           `json:"ban_count"`
+	Timestamp  time.Time     `json:"timestamp"`
+	ProposalID string        `json:"proposal_id,omitempty"`
+	Approvals  []BanApproval `json:"approvals,omitempty"`
+}
+
+type BanApproval struct {
+	Validator string `json:"validator"`
+	Signature []byte `json:"signature"`
 }
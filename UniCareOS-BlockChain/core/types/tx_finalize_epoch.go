@@ -1,47 +1,73 @@
 package types
 
 import (
-	"time"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // FinalizeEpochTx represents a transaction to finalize an epoch
 // and make all blocks/events within it immutable.
+// It is included in a block once a quorum of finalizers has signed the epoch Merkle root.
 type FinalizeEpochTx struct {
-	TxID               string    `json:"txID"`
-	EpochNumber        uint64    `json:"epochNumber"`
-	FinalizerSignature string    `json:"finalizerSignature"`
-	EpochSummaryHash   string    `json:"epochSummaryHash,omitempty"`
-	Timestamp          time.Time `json:"timestamp"`
-	Status             string    `json:"status"` // finalized|failed|duplicate|unauthorized
-	AuditLogID         string    `json:"auditLogID,omitempty"`
+	TxID             string               `json:"txID"` // ComputeTxID(): identical on every node for the same epoch and root
+	EpochNumber      uint64               `json:"epochNumber"`
+	EpochSummaryHash string               `json:"epochSummaryHash"` // Epoch Merkle root ("" for an epoch with no finalized events)
+	Signatures       []FinalizerSignature `json:"signatures"`       // Finalizer signatures over SigningBytes()
+	Timestamp        time.Time            `json:"timestamp"`
+	Status           string               `json:"status"` // pending|finalized|failed|duplicate
+	AuditLogID       string               `json:"auditLogID,omitempty"`
+	IncludedIn       string               `json:"includedIn,omitempty"` // Block ID (hex) that carried it on chain
+}
+
+// FinalizerSignature is one finalizer's Ed25519 signature over a FinalizeEpochTx
+type FinalizerSignature struct {
+	PubKey    string `json:"pubKey"`    // Base64 Ed25519 public key, as in FINALIZER_PUBKEY
+	Signature string `json:"signature"` // Base64 signature over SigningBytes()
 }
 
 // NewFinalizeEpochTx creates a new FinalizeEpochTx instance
-func NewFinalizeEpochTx(epochNumber uint64, finalizerSignature, epochSummaryHash string) *FinalizeEpochTx {
-	return &FinalizeEpochTx{
-		TxID:               "", // Should be set by the caller or assigned after hashing
-		EpochNumber:        epochNumber,
-		FinalizerSignature: finalizerSignature,
-		EpochSummaryHash:   epochSummaryHash,
-		Timestamp:          time.Now().UTC(),
-		Status:             "pending",
-		AuditLogID:         "",
+func NewFinalizeEpochTx(epochNumber uint64, epochSummaryHash string) *FinalizeEpochTx {
+	tx := &FinalizeEpochTx{
+		EpochNumber:      epochNumber,
+		EpochSummaryHash: epochSummaryHash,
+		Timestamp:        time.Now().UTC(),
+		Status:           "pending",
 	}
+	tx.TxID = tx.ComputeTxID()
+	return tx
 }
 
-// Validate checks the validity of the FinalizeEpochTx fields
+// SigningBytes is what finalizers sign: the epoch number and its Merkle root
+func (tx *FinalizeEpochTx) SigningBytes() []byte {
+	data, _ := json.Marshal(struct {
+		Type        string `json:"type"`
+		EpochNumber uint64 `json:"epochNumber"`
+		Root        string `json:"epochSummaryHash"`
+	}{"finalize_epoch", tx.EpochNumber, tx.EpochSummaryHash})
+	return data
+}
+
+// ComputeTxID hashes SigningBytes, so signatures for the same epoch and root merge under one ID
+func (tx *FinalizeEpochTx) ComputeTxID() string {
+	sum := sha256.Sum256(tx.SigningBytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate checks the validity of the FinalizeEpochTx fields.
+// Signatures are checked against the finalizer set by blockchain.VerifyEpochFinalization.
 func (tx *FinalizeEpochTx) Validate() error {
-	if tx.EpochNumber == 0 {
-		return fmt.Errorf("epochNumber must be non-zero")
+	if tx.TxID != tx.ComputeTxID() {
+		return fmt.Errorf("txID does not match epoch %d and its summary hash", tx.EpochNumber)
 	}
-	if tx.FinalizerSignature == "" {
-		return fmt.Errorf("finalizerSignature is required")
+	if len(tx.Signatures) == 0 {
+		return fmt.Errorf("at least one finalizer signature is required")
 	}
-	// TODO: Add cryptographic signature validation here
-	// Example: verifySignature(tx.FinalizerSignature, ...)
 	return nil
 }
+
 // TransactionReceipt for epoch finalization
 // (could be reused from your existing receipt type, but included here for clarity)
 type EpochFinalizationReceipt struct {
@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// FieldError is one reason a record failed validation
+type FieldError struct {
+	Field   string `json:"field"` // Dotted path of the offending field, "(root)" for the record as a whole
+	Rule    string `json:"rule"`  // Schema keyword ("required", "pattern", ...) or check ("base64", "max_length", ...)
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError reports every field a record failed validation on
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.String()
+	}
+	return "record failed validation: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, rule, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// addSchemaErrors adds JSON Schema errors, reporting a missing or unexpected property under its own path
+func (e *ValidationError) addSchemaErrors(errs []gojsonschema.ResultError) {
+	for _, re := range errs {
+		field := re.Field()
+		if prop, ok := re.Details()["property"].(string); ok && (re.Type() == "required" || re.Type() == "additional_property_not_allowed") {
+			if field == "(root)" {
+				field = prop
+			} else {
+				field += "." + prop
+			}
+		}
+		e.add(field, re.Type(), re.Description())
+	}
+}
+
+// FieldErrors returns the per-field errors of a validation failure, nil for other errors
+func FieldErrors(err error) []FieldError {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Errors
+	}
+	return nil
+}
@@ -4,80 +4,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
-	"os"
-	"path/filepath"
 	"time"
 	"encoding/base64"
 	"unicode/utf8"
 	"github.com/xeipuuv/gojsonschema"
 )
 
+var didPattern = regexp.MustCompile(`^did:[a-z0-9]+:[a-zA-Z0-9.-]+$`)
 
-func getSchemaPath(schemaVersion string) string {
-	if env := os.Getenv("MEDICAL_SCHEMA_PATH"); env != "" {
-		return env
-	}
-	switch schemaVersion {
-	case "1.0", "1":
-		return filepath.Join("core", "validation", "schemas", "medical_record_schema_v1.json")
-	case "2.0", "2":
-		return filepath.Join("core", "validation", "schemas", "medical_record_schema_v2.json")
-	default:
-		return filepath.Join("core", "validation", "schemas", "medical_record_schema_v1.json")
-	}
+// ValidateMedicalPayload validates a raw JSON payload against the schema and additional logic. With a
+// SchemaSource in use, the schema is the one active for the next block. A payload that fails is
+// reported as a *ValidationError listing every offending field.
+func ValidateMedicalPayload(payload []byte) error {
+	return validateMedicalPayload(payload, nil)
 }
 
+// ValidateMedicalPayloadAt validates a payload against the schema active at a block height
+func ValidateMedicalPayloadAt(payload []byte, height uint64) error {
+	return validateMedicalPayload(payload, &height)
+}
 
-
-// ValidateMedicalPayload validates a raw JSON payload against the schema and additional logic
-func ValidateMedicalPayload(payload []byte) error {
+func validateMedicalPayload(payload []byte, height *uint64) error {
 	// Unmarshal for schemaVersion
 	var rec map[string]interface{}
 	if err := json.Unmarshal(payload, &rec); err != nil {
 		return fmt.Errorf("invalid JSON: %w", err)
 	}
 	schemaVersion, _ := rec["schemaVersion"].(string)
-	schemaPath := getSchemaPath(schemaVersion)
-	schemaLoader := gojsonschema.NewReferenceLoader("file://" + schemaPath)
+	schema, err := schemaFor(schemaVersion, height)
+	if err != nil {
+		return err
+	}
 
-	// Validate against JSON Schema
-	documentLoader := gojsonschema.NewBytesLoader(payload)
-	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	// Validate against the compiled JSON Schema
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(payload))
 	if err != nil {
 		return fmt.Errorf("schema validation error: %w", err)
 	}
-	if !result.Valid() {
-		// Aggregate schema validation errors
-		errStr := ""
-		for _, e := range result.Errors() {
-			errStr += e.String() + "; "
+	verr := &ValidationError{}
+	verr.addSchemaErrors(result.Errors())
+	if result.Valid() {
+		if err := validateRecordType(payload, rec, verr); err != nil {
+			return err
 		}
-		return fmt.Errorf("payload failed schema validation: %s", errStr)
 	}
 
 	// Security/privacy checks: base64 validation and maxLength
-	base64Fields := []string{"patientId", "providerID", "payloadSignature", "notes"}
+	base64Fields := []string{"patientId", "payloadSignature", "notes"}
 	for _, field := range base64Fields {
 		if val, ok := rec[field].(string); ok && val != "" {
 			if _, err := base64.StdEncoding.DecodeString(val); err != nil {
 				AuditValidationError("base64_check", fmt.Sprintf("%s is not valid base64", field))
-				return fmt.Errorf("%s is not valid base64", field)
+				verr.add(field, "base64", "not valid base64")
 			}
 		}
 	}
 
 	// Explicit regex check for patientDID (if not already enforced by schema)
-	if did, ok := rec["patientDID"].(string); ok && did != "" {
-		// Regex: ^did:[a-z0-9]+:[a-zA-Z0-9.-]+$
-		matched := false
-		if len(did) > 0 {
-			re := `^did:[a-z0-9]+:[a-zA-Z0-9.-]+$`
-			matched, _ = regexp.MatchString(re, did)
-		}
-		if !matched {
-			AuditValidationError("regex_check", "patientDID does not match DID pattern")
-			return fmt.Errorf("patientDID does not match DID pattern")
-		}
+	if did, ok := rec["patientDID"].(string); ok && did != "" && !didPattern.MatchString(did) {
+		AuditValidationError("regex_check", "patientDID does not match DID pattern")
+		verr.add("patientDID", "did", "does not match DID pattern")
 	}
 
 	// encryptionContext.iv and tag
@@ -86,47 +72,51 @@ func ValidateMedicalPayload(payload []byte) error {
 			if sval, ok := ctx[sub].(string); ok && sval != "" {
 				if _, err := base64.StdEncoding.DecodeString(sval); err != nil {
 					AuditValidationError("base64_check", fmt.Sprintf("encryptionContext.%s is not valid base64", sub))
-					return fmt.Errorf("encryptionContext.%s is not valid base64", sub)
+					verr.add("encryptionContext."+sub, "base64", "not valid base64")
 				}
 			}
 		}
 	}
 	// maxLength checks
-	if docHash, ok := rec["docHash"].(string); ok && utf8.RuneCountInString(docHash) > 64 {
-		AuditValidationError("length_check", "docHash exceeds 64 characters")
-		return fmt.Errorf("docHash exceeds 64 characters")
-	}
-	if ps, ok := rec["payloadSignature"].(string); ok && utf8.RuneCountInString(ps) > 512 {
-		AuditValidationError("length_check", "payloadSignature exceeds 512 characters")
-		return fmt.Errorf("payloadSignature exceeds 512 characters")
-	}
-	if notes, ok := rec["notes"].(string); ok && utf8.RuneCountInString(notes) > 1024 {
-		AuditValidationError("length_check", "notes exceeds 1024 characters")
-		return fmt.Errorf("notes exceeds 1024 characters")
+	for _, limit := range []struct {
+		field string
+		max   int
+	}{{"docHash", 64}, {"payloadSignature", 512}, {"notes", 1024}} {
+		if val, ok := rec[limit.field].(string); ok && utf8.RuneCountInString(val) > limit.max {
+			AuditValidationError("length_check", fmt.Sprintf("%s exceeds %d characters", limit.field, limit.max))
+			verr.add(limit.field, "max_length", fmt.Sprintf("exceeds %d characters", limit.max))
+		}
 	}
 
 	// Check issuedAt format
 	issuedAt, _ := rec["issuedAt"].(string)
 	if err := EnforceTimestampFormat(issuedAt); err != nil {
-		return err
+		verr.add("issuedAt", "timestamp", err.Error())
 	}
 
+	if len(verr.Errors) > 0 {
+		return verr
+	}
 	return nil
 }
 
-// IsValidRecordType checks if the recordType is allowed
-func IsValidRecordType(recordType string) bool {
-	switch recordType {
-	case "lab_result", "imaging", "discharge_summary":
-		return true
-	default:
+// IsValidRecordType checks if the schema of schemaVersion active for the next block allows recordType
+func IsValidRecordType(schemaVersion, recordType string) bool {
+	enabled, err := EnabledRecordTypes(schemaVersion)
+	if err != nil {
 		return false
 	}
+	for _, t := range enabled {
+		if t == recordType {
+			return true
+		}
+	}
+	return false
 }
 
 // CheckRequiredFields can be extended for conditional logic
 func CheckRequiredFields(rec map[string]interface{}) error {
-	required := []string{"recordId", "patientDID", "providerID", "schemaVersion", "recordType", "docHash", "issuedAt", "signedBy", "consentStatus", "dataProvenance", "retentionPolicy", "encryptionContext", "payloadSignature"}
+	required := []string{"recordId", "patientDID", "providerId", "schemaVersion", "recordType", "docHash", "issuedAt", "signedBy", "consentStatus", "dataProvenance", "retentionPolicy", "encryptionContext", "payloadSignature"}
 	for _, k := range required {
 		if _, ok := rec[k]; !ok {
 			return fmt.Errorf("missing required field: %s", k)
@@ -1,15 +1,19 @@
 package validation
 
 import (
+	"encoding/json"
+	"strings"
+	"sync"
 	"testing"
 )
 
+// validPayload conforms to the bundled v1 schema; patientId is the base64 of the encrypted source identifier
 func validPayload() []byte {
 	return []byte(`{
   "recordId": "123e4567-e89b-12d3-a456-426614174000",
-  "patientId": "HOSP12345",
+  "patientId": "SE9TUDEyMzQ1",
   "patientDID": "did:example:123456abcdef",
-  "providerID": "PROV123",
+  "providerId": "PROV123",
   "schemaVersion": "1.0",
   "recordType": "lab_result",
   "docHash": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
@@ -45,55 +49,102 @@ func TestValidateMedicalPayload_MissingField(t *testing.T) {
 }
 
 func TestValidateMedicalPayload_InvalidDocHash(t *testing.T) {
-	payload := []byte(`{
-  "recordId": "123e4567-e89b-12d3-a456-426614174000",
-  "patientId": "HOSP12345",
-  "patientDID": "did:example:123456abcdef",
-  "providerID": "PROV123",
-  "schemaVersion": "1.0",
-  "recordType": "lab_result",
-  "docHash": "notavalidhexhash",
-  "issuedAt": "2025-05-22T18:00:00Z",
-  "signedBy": "PROV123",
-  "consentStatus": "granted",
-  "dataProvenance": "hospital-system",
-  "retentionPolicy": "7 years",
-  "encryptionContext": {
-    "algorithm": "AES-GCM",
-    "iv": "YWJjZGVmZ2hpamtsbW5vcA==",
-    "tag": "YWJjZGVmZ2hpamtsbW5vcA=="
-  },
-  "payloadSignature": "YWJjZGVmZ2hpamtsbW5vcA=="
-}`)
-	err := ValidateMedicalPayload(payload)
+	payload := strings.Replace(string(validPayload()), `"docHash": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"`, `"docHash": "notavalidhexhash"`, 1)
+	err := ValidateMedicalPayload([]byte(payload))
 	if err == nil {
 		t.Errorf("Expected error for invalid docHash, got nil")
 	}
 }
 
 func TestValidateMedicalPayload_InvalidTimestamp(t *testing.T) {
-	payload := []byte(`{
-  "recordId": "123e4567-e89b-12d3-a456-426614174000",
-  "patientId": "HOSP12345",
-  "patientDID": "did:example:123456abcdef",
-  "providerID": "PROV123",
-  "schemaVersion": "1.0",
-  "recordType": "lab_result",
-  "docHash": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
-  "issuedAt": "not-a-date",
-  "signedBy": "PROV123",
-  "consentStatus": "granted",
-  "dataProvenance": "hospital-system",
-  "retentionPolicy": "7 years",
-  "encryptionContext": {
-    "algorithm": "AES-GCM",
-    "iv": "YWJjZGVmZ2hpamtsbW5vcA==",
-    "tag": "YWJjZGVmZ2hpamtsbW5vcA=="
-  },
-  "payloadSignature": "YWJjZGVmZ2hpamtsbW5vcA=="
-}`)
-	err := ValidateMedicalPayload(payload)
+	payload := strings.Replace(string(validPayload()), `"issuedAt": "2025-05-22T18:00:00Z"`, `"issuedAt": "not-a-date"`, 1)
+	err := ValidateMedicalPayload([]byte(payload))
 	if err == nil {
 		t.Errorf("Expected error for invalid issuedAt, got nil")
 	}
 }
+
+func TestCheckRequiredFields(t *testing.T) {
+	var rec map[string]interface{}
+	if err := json.Unmarshal(validPayload(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRequiredFields(rec); err != nil {
+		t.Errorf("Expected schema-valid record to have every required field, got error: %v", err)
+	}
+	delete(rec, "providerId")
+	if err := CheckRequiredFields(rec); err == nil {
+		t.Error("Expected error for missing providerId, got nil")
+	}
+}
+
+// heightSchemas serves a permissive v1 schema below height 10 and one requiring "urgency" from 10 on
+type heightSchemas struct{}
+
+func (heightSchemas) SchemaAt(version string, height uint64) ([]byte, error) {
+	if height < 10 {
+		return []byte(`{"type":"object"}`), nil
+	}
+	return []byte(`{"type":"object","required":["urgency"]}`), nil
+}
+
+func (heightSchemas) NextHeight() uint64 { return 10 }
+
+func TestValidateMedicalPayloadAt_SchemaActiveAtHeight(t *testing.T) {
+	UseSchemaSource(heightSchemas{})
+	defer UseSchemaSource(nil)
+	payload := validPayload()
+	if err := ValidateMedicalPayloadAt(payload, 9); err != nil {
+		t.Errorf("Expected valid payload before the new schema activates, got error: %v", err)
+	}
+	if err := ValidateMedicalPayloadAt(payload, 10); err == nil {
+		t.Error("Expected payload without urgency to fail the schema active at height 10")
+	}
+	if err := ValidateMedicalPayload(payload); err == nil {
+		t.Error("Expected payload to be validated against the schema of the next block")
+	}
+}
+
+func TestValidateMedicalPayload_FieldErrors(t *testing.T) {
+	payload := strings.NewReplacer(
+		`"docHash": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"`, `"docHash": "nothex"`,
+		`"issuedAt": "2025-05-22T18:00:00Z"`, `"issuedAt": "yesterday"`,
+	).Replace(string(validPayload()))
+	fieldErrs := FieldErrors(ValidateMedicalPayload([]byte(payload)))
+	rules := make(map[string]string)
+	for _, fe := range fieldErrs {
+		rules[fe.Field] = fe.Rule
+	}
+	if rules["docHash"] != "pattern" || rules["issuedAt"] != "timestamp" {
+		t.Errorf("Expected docHash pattern and issuedAt timestamp errors, got %+v", fieldErrs)
+	}
+}
+
+func TestValidateMedicalPayload_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := ValidateMedicalPayload(validPayload()); err != nil {
+					t.Errorf("Unexpected validation failure: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkValidateMedicalPayload(b *testing.B) {
+	payload := validPayload()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := ValidateMedicalPayload(payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package validation
+
+import (
+	"time"
+)
+
+// Built-in record type validators. Type-specific fields live in the record's typeDetails object
+// (schema v2 on); the v1 types keep it optional so v1 records, which cannot carry it, still pass.
+
+// recordTypeSpec is a RecordTypeValidator made of a schema fragment and a check over typeDetails
+type recordTypeSpec struct {
+	recordType string
+	fragment   string
+	check      func(details, rec map[string]interface{}) []FieldError
+}
+
+func (s recordTypeSpec) RecordType() string     { return s.recordType }
+func (s recordTypeSpec) SchemaFragment() []byte { return []byte(s.fragment) }
+
+func (s recordTypeSpec) Check(rec map[string]interface{}) []FieldError {
+	if s.check == nil {
+		return nil
+	}
+	details, _ := rec["typeDetails"].(map[string]interface{})
+	return s.check(details, rec)
+}
+
+var builtinRecordTypes = []recordTypeSpec{
+	{
+		recordType: "lab_result",
+		fragment: `{"properties": {"typeDetails": {"properties": {
+			"loincCode": {"type": "string", "pattern": "^[0-9]{1,5}-[0-9]$"}
+		}}}}`,
+	},
+	{
+		recordType: "imaging",
+		fragment: `{"properties": {"typeDetails": {"properties": {
+			"modality": {"enum": ["CR", "CT", "DX", "MG", "MR", "NM", "PT", "US", "XA"]}
+		}}}}`,
+	},
+	{
+		recordType: "discharge_summary",
+		fragment: `{"properties": {"typeDetails": {"properties": {
+			"admittedAt": {"type": "string", "format": "date-time"},
+			"dischargedAt": {"type": "string", "format": "date-time"}
+		}}}}`,
+		check: func(details, _ map[string]interface{}) []FieldError {
+			return notBefore(details, "dischargedAt", "admittedAt")
+		},
+	},
+	{
+		recordType: "prescription",
+		fragment: `{"required": ["typeDetails"], "properties": {"typeDetails": {
+			"required": ["medication", "dosage"],
+			"properties": {
+				"medication": {"type": "string", "minLength": 1},
+				"dosage": {"type": "string", "minLength": 1},
+				"quantity": {"type": "number", "exclusiveMinimum": 0},
+				"refills": {"type": "integer", "minimum": 0},
+				"validUntil": {"type": "string", "format": "date-time"}
+			}
+		}}}`,
+		check: func(details, rec map[string]interface{}) []FieldError {
+			return afterIssued(details, rec, "validUntil")
+		},
+	},
+	{
+		recordType: "immunization",
+		fragment: `{"required": ["typeDetails"], "properties": {"typeDetails": {
+			"required": ["vaccineCode", "lotNumber", "administeredAt"],
+			"properties": {
+				"vaccineCode": {"type": "string", "pattern": "^[0-9]{1,3}$"},
+				"lotNumber": {"type": "string", "minLength": 1},
+				"doseNumber": {"type": "integer", "minimum": 1},
+				"administeredAt": {"type": "string", "format": "date-time"}
+			}
+		}}}`,
+		check: func(details, rec map[string]interface{}) []FieldError {
+			return notAfterIssued(details, rec, "administeredAt")
+		},
+	},
+	{
+		recordType: "allergy",
+		fragment: `{"required": ["typeDetails"], "properties": {"typeDetails": {
+			"required": ["substance"],
+			"properties": {
+				"substance": {"type": "string", "minLength": 1},
+				"criticality": {"enum": ["low", "high", "unable-to-assess"]},
+				"reactions": {"type": "array", "items": {"type": "string"}, "maxItems": 50}
+			}
+		}}}`,
+	},
+	{
+		recordType: "referral",
+		fragment: `{"required": ["typeDetails"], "properties": {"typeDetails": {
+			"required": ["referredTo", "reason"],
+			"properties": {
+				"referredTo": {"type": "string", "minLength": 1},
+				"reason": {"type": "string", "minLength": 1},
+				"priority": {"enum": ["routine", "urgent", "asap", "stat"]}
+			}
+		}}}`,
+		check: func(details, rec map[string]interface{}) []FieldError {
+			if stringField(details, "referredTo") == stringField(rec, "providerId") {
+				return []FieldError{{Field: "typeDetails.referredTo", Rule: "referral", Message: "a provider cannot refer to itself"}}
+			}
+			return nil
+		},
+	},
+	{
+		recordType: "pathology_report",
+		fragment: `{"required": ["typeDetails"], "properties": {"typeDetails": {
+			"required": ["specimen", "collectedAt"],
+			"properties": {
+				"specimen": {"type": "string", "minLength": 1},
+				"collectedAt": {"type": "string", "format": "date-time"},
+				"diagnosisCode": {"type": "string", "pattern": "^[A-TV-Z][0-9][0-9AB](\\.[0-9A-TV-Z]{1,4})?$"}
+			}
+		}}}`,
+		check: func(details, rec map[string]interface{}) []FieldError {
+			return notAfterIssued(details, rec, "collectedAt")
+		},
+	},
+	{
+		// The signed consent document; access itself is governed by consent grant transactions
+		recordType: "consent_form",
+		fragment: `{"required": ["typeDetails"], "properties": {"typeDetails": {
+			"required": ["scope", "effectiveFrom"],
+			"properties": {
+				"scope": {"type": "array", "items": {"type": "string", "minLength": 1}, "minItems": 1},
+				"grantee": {"type": "string"},
+				"effectiveFrom": {"type": "string", "format": "date-time"},
+				"expiresAt": {"type": "string", "format": "date-time"}
+			}
+		}}}`,
+		check: func(details, _ map[string]interface{}) []FieldError {
+			return notBefore(details, "expiresAt", "effectiveFrom")
+		},
+	},
+}
+
+func init() {
+	for _, spec := range builtinRecordTypes {
+		if err := RegisterRecordType(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// detailTime parses the typeDetails timestamp at key, if present
+func detailTime(details map[string]interface{}, key string) (time.Time, bool) {
+	s, _ := details[key].(string)
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
+
+// notBefore reports typeDetails.later preceding typeDetails.earlier
+func notBefore(details map[string]interface{}, later, earlier string) []FieldError {
+	l, ok1 := detailTime(details, later)
+	e, ok2 := detailTime(details, earlier)
+	if ok1 && ok2 && l.Before(e) {
+		return []FieldError{{Field: "typeDetails." + later, Rule: "chronology", Message: "is before " + earlier}}
+	}
+	return nil
+}
+
+// afterIssued reports typeDetails.key not falling after the record's issuedAt
+func afterIssued(details, rec map[string]interface{}, key string) []FieldError {
+	t, ok := detailTime(details, key)
+	issued, err := time.Parse(time.RFC3339, stringField(rec, "issuedAt"))
+	if ok && err == nil && !t.After(issued) {
+		return []FieldError{{Field: "typeDetails." + key, Rule: "chronology", Message: "must be after issuedAt"}}
+	}
+	return nil
+}
+
+// notAfterIssued reports typeDetails.key falling after the record's issuedAt
+func notAfterIssued(details, rec map[string]interface{}, key string) []FieldError {
+	t, ok := detailTime(details, key)
+	issued, err := time.Parse(time.RFC3339, stringField(rec, "issuedAt"))
+	if ok && err == nil && t.After(issued) {
+		return []FieldError{{Field: "typeDetails." + key, Rule: "chronology", Message: "is after issuedAt"}}
+	}
+	return nil
+}
+
+func stringField(rec map[string]interface{}, key string) string {
+	s, _ := rec[key].(string)
+	return s
+}
@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Record types.
+// Which recordTypes a record may have is decided by the enum of the record schema active at its height,
+// so a type is enabled by registering a schema version listing it in the schema registry. A
+// RecordTypeValidator registered for a type adds its own schema fragment and semantic checks, run once
+// a record has passed the envelope schema; enabled types without one get the envelope checks only.
+
+// RecordTypeValidator validates the records of one recordType
+type RecordTypeValidator interface {
+	RecordType() string
+	// SchemaFragment is a JSON Schema applied to the whole record, typically constraining typeDetails
+	SchemaFragment() []byte
+	// Check runs the type's semantic checks on a record that satisfies its schema fragment
+	Check(rec map[string]interface{}) []FieldError
+}
+
+var (
+	recordTypesMu        sync.RWMutex
+	recordTypeValidators = make(map[string]RecordTypeValidator)
+)
+
+// RegisterRecordType registers v for its recordType, replacing any validator registered before
+func RegisterRecordType(v RecordTypeValidator) error {
+	if v.RecordType() == "" {
+		return errors.New("record type validator has no record type")
+	}
+	if _, err := compileSchema(v.SchemaFragment()); err != nil {
+		return fmt.Errorf("record type %s: %w", v.RecordType(), err)
+	}
+	recordTypesMu.Lock()
+	defer recordTypesMu.Unlock()
+	recordTypeValidators[v.RecordType()] = v
+	return nil
+}
+
+// RecordTypeValidatorFor returns the validator registered for recordType
+func RecordTypeValidatorFor(recordType string) (RecordTypeValidator, bool) {
+	recordTypesMu.RLock()
+	defer recordTypesMu.RUnlock()
+	v, ok := recordTypeValidators[recordType]
+	return v, ok
+}
+
+// RecordTypes returns the record types with a registered validator, sorted
+func RecordTypes() []string {
+	recordTypesMu.RLock()
+	defer recordTypesMu.RUnlock()
+	out := make([]string, 0, len(recordTypeValidators))
+	for t := range recordTypeValidators {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// EnabledRecordTypes returns the recordTypes the schema of schemaVersion active for the next block allows
+func EnabledRecordTypes(schemaVersion string) ([]string, error) {
+	schema, err := schemaDocument(schemaVersion, nil)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Properties struct {
+			RecordType struct {
+				Enum []string `json:"enum"`
+			} `json:"recordType"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Properties.RecordType.Enum, nil
+}
+
+// validateRecordType runs the validator of the record's recordType, if one is registered
+func validateRecordType(payload []byte, rec map[string]interface{}, verr *ValidationError) error {
+	recordType, _ := rec["recordType"].(string)
+	v, ok := RecordTypeValidatorFor(recordType)
+	if !ok {
+		return nil
+	}
+	fragment, err := compileSchema(v.SchemaFragment())
+	if err != nil {
+		return fmt.Errorf("record type %s: %w", recordType, err)
+	}
+	result, err := fragment.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return fmt.Errorf("record type %s: %w", recordType, err)
+	}
+	verr.addSchemaErrors(result.Errors())
+	if result.Valid() {
+		verr.Errors = append(verr.Errors, v.Check(rec)...)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// v2Record is a v2 record of recordType with the given typeDetails JSON
+func v2Record(recordType, typeDetails string) []byte {
+	payload := strings.NewReplacer(
+		`"schemaVersion": "1.0"`, `"schemaVersion": "2.0"`,
+		`"recordType": "lab_result"`, `"recordType": "`+recordType+`"`,
+	).Replace(string(validPayload()))
+	if typeDetails != "" {
+		payload = strings.Replace(payload, `"payloadSignature"`, `"typeDetails": `+typeDetails+`, "payloadSignature"`, 1)
+	}
+	return []byte(payload)
+}
+
+func fieldRules(err error) map[string]string {
+	rules := make(map[string]string)
+	for _, fe := range FieldErrors(err) {
+		rules[fe.Field] = fe.Rule
+	}
+	return rules
+}
+
+func TestRecordTypeValidators(t *testing.T) {
+	cases := []struct {
+		name, recordType, details string
+		wantField, wantRule       string
+	}{
+		{"prescription", "prescription", `{"medication": "amoxicillin 500mg", "dosage": "1 capsule every 8 hours", "refills": 1, "validUntil": "2025-06-22T00:00:00Z"}`, "", ""},
+		{"prescription without details", "prescription", "", "typeDetails", "required"},
+		{"prescription expired at issue", "prescription", `{"medication": "amoxicillin", "dosage": "1 capsule", "validUntil": "2025-05-01T00:00:00Z"}`, "typeDetails.validUntil", "chronology"},
+		{"immunization", "immunization", `{"vaccineCode": "208", "lotNumber": "EW0182", "administeredAt": "2025-05-22T09:00:00Z"}`, "", ""},
+		{"immunization bad CVX code", "immunization", `{"vaccineCode": "COVID", "lotNumber": "EW0182", "administeredAt": "2025-05-22T09:00:00Z"}`, "typeDetails.vaccineCode", "pattern"},
+		{"allergy", "allergy", `{"substance": "penicillin", "criticality": "high"}`, "", ""},
+		{"allergy unknown criticality", "allergy", `{"substance": "penicillin", "criticality": "severe"}`, "typeDetails.criticality", "enum"},
+		{"referral to self", "referral", `{"referredTo": "PROV123", "reason": "cardiology review"}`, "typeDetails.referredTo", "referral"},
+		{"pathology collected after report", "pathology_report", `{"specimen": "skin biopsy", "collectedAt": "2025-05-23T00:00:00Z", "diagnosisCode": "C43.9"}`, "typeDetails.collectedAt", "chronology"},
+		{"consent form", "consent_form", `{"scope": ["lab_result"], "effectiveFrom": "2025-05-22T00:00:00Z", "expiresAt": "2026-05-22T00:00:00Z"}`, "", ""},
+		{"consent form expiring before effective", "consent_form", `{"scope": ["lab_result"], "effectiveFrom": "2025-05-22T00:00:00Z", "expiresAt": "2025-01-01T00:00:00Z"}`, "typeDetails.expiresAt", "chronology"},
+	}
+	for _, tc := range cases {
+		err := ValidateMedicalPayload(v2Record(tc.recordType, tc.details))
+		if tc.wantField == "" {
+			if err != nil {
+				t.Errorf("%s: expected valid record, got %v", tc.name, err)
+			}
+			continue
+		}
+		if rule := fieldRules(err)[tc.wantField]; rule != tc.wantRule {
+			t.Errorf("%s: expected %s error on %s, got %v", tc.name, tc.wantRule, tc.wantField, err)
+		}
+	}
+}
+
+// enablingSchemas serves the bundled v1 schema, plus the bundled v2 schema from height 10 on
+type enablingSchemas struct{}
+
+func (enablingSchemas) SchemaAt(version string, height uint64) ([]byte, error) {
+	if version == "2" && height < 10 {
+		return nil, errors.New("no schema active")
+	}
+	return BundledSchema(version)
+}
+
+func (enablingSchemas) NextHeight() uint64 { return 10 }
+
+func TestRecordTypesEnabledBySchemaRegistry(t *testing.T) {
+	UseSchemaSource(enablingSchemas{})
+	defer UseSchemaSource(nil)
+	if IsValidRecordType("1.0", "prescription") || !IsValidRecordType("2.0", "prescription") {
+		t.Error("Expected prescriptions to be enabled by the v2 schema only")
+	}
+	record := v2Record("prescription", `{"medication": "amoxicillin", "dosage": "1 capsule"}`)
+	if err := ValidateMedicalPayloadAt(record, 9); err == nil {
+		t.Error("Expected prescription to be rejected before the v2 schema activates")
+	}
+	if err := ValidateMedicalPayloadAt(record, 10); err != nil {
+		t.Errorf("Expected prescription to be accepted once the v2 schema activates, got %v", err)
+	}
+	v1 := strings.Replace(string(validPayload()), `"recordType": "lab_result"`, `"recordType": "prescription"`, 1)
+	if rules := fieldRules(ValidateMedicalPayloadAt([]byte(v1), 10)); rules["recordType"] != "enum" {
+		t.Errorf("Expected a v1 prescription to fail the recordType enum, got %v", rules)
+	}
+}
+
+type vitalSigns struct{}
+
+func (vitalSigns) RecordType() string { return "vital_signs" }
+func (vitalSigns) SchemaFragment() []byte {
+	return []byte(`{"required": ["typeDetails"], "properties": {"typeDetails": {"required": ["heartRate"]}}}`)
+}
+func (vitalSigns) Check(rec map[string]interface{}) []FieldError { return nil }
+
+func TestRegisterRecordType(t *testing.T) {
+	if err := RegisterRecordType(vitalSigns{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := RecordTypeValidatorFor("vital_signs"); !ok {
+		t.Fatal("Expected vital_signs validator to be registered")
+	}
+	defer func() {
+		recordTypesMu.Lock()
+		delete(recordTypeValidators, "vital_signs")
+		recordTypesMu.Unlock()
+	}()
+	// Registered but not in the v2 enum: the schema still decides whether the type is accepted
+	if rules := fieldRules(ValidateMedicalPayload(v2Record("vital_signs", `{"heartRate": 72}`))); rules["recordType"] != "enum" {
+		t.Errorf("Expected vital_signs to be rejected until a schema enables it, got %v", rules)
+	}
+}
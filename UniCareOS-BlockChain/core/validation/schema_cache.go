@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Schema loading.
+// The bundled schemas are embedded in the binary, so validation does not depend on the working
+// directory. Every schema document, bundled or served by a SchemaSource, is compiled once and cached
+// by its hash; validating a record then only runs the compiled schema.
+
+//go:embed schemas/*.json
+var bundledSchemas embed.FS
+
+// BundledSchema returns the schema document of a major version shipped with the binary
+func BundledSchema(version string) ([]byte, error) {
+	data, err := bundledSchemas.ReadFile(path.Join("schemas", "medical_record_schema_v"+version+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no bundled v%s record schema", version)
+	}
+	return data, nil
+}
+
+// DefaultSchema returns the schema of a major version used without a SchemaSource: the file named by
+// MEDICAL_SCHEMA_PATH when set, otherwise the bundled schema
+func DefaultSchema(version string) ([]byte, error) {
+	if p := os.Getenv("MEDICAL_SCHEMA_PATH"); p != "" {
+		return readSchemaFile(p)
+	}
+	return BundledSchema(version)
+}
+
+var (
+	schemaFilesMu sync.RWMutex
+	schemaFiles   = make(map[string][]byte) // MEDICAL_SCHEMA_PATH contents by path, read once
+)
+
+func readSchemaFile(p string) ([]byte, error) {
+	schemaFilesMu.RLock()
+	data, ok := schemaFiles[p]
+	schemaFilesMu.RUnlock()
+	if ok {
+		return data, nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	schemaFilesMu.Lock()
+	schemaFiles[p] = data
+	schemaFilesMu.Unlock()
+	return data, nil
+}
+
+var (
+	compiledMu sync.RWMutex
+	compiled   = make(map[string]*gojsonschema.Schema) // By SchemaHash; there is one entry per registered schema
+)
+
+// compileSchema returns the compiled form of a schema document, compiling it on first use
+func compileSchema(schema []byte) (*gojsonschema.Schema, error) {
+	hash := SchemaHash(schema)
+	compiledMu.RLock()
+	s, ok := compiled[hash]
+	compiledMu.RUnlock()
+	if ok {
+		return s, nil
+	}
+	s, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	compiledMu.Lock()
+	compiled[hash] = s
+	compiledMu.Unlock()
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Versioned record schemas.
+// A record's schemaVersion ("2.1") selects a schema line by its major version ("2"). Without a
+// SchemaSource every record is validated against the bundled v1 schema; with one (the on-chain schema
+// registry, see blockchain.SchemaRegistry) the schema is the one active at the block height, so every
+// node validates a record identically.
+
+// SchemaSource returns the schema records of a major version are validated against at a block height
+type SchemaSource interface {
+	SchemaAt(version string, height uint64) ([]byte, error)
+	NextHeight() uint64 // Height of the next block, used when no height is given
+}
+
+var (
+	schemaSourceMu sync.RWMutex
+	schemaSource   SchemaSource
+)
+
+// UseSchemaSource makes validation resolve schemas through src (nil restores the bundled schemas)
+func UseSchemaSource(src SchemaSource) {
+	schemaSourceMu.Lock()
+	defer schemaSourceMu.Unlock()
+	schemaSource = src
+}
+
+// SchemaMajor returns the major version a schemaVersion selects ("1.0" → "1")
+func SchemaMajor(schemaVersion string) string {
+	major, _, _ := strings.Cut(schemaVersion, ".")
+	return major
+}
+
+// SchemaHash returns the hex SHA-256 identifying a schema document
+func SchemaHash(schema []byte) string {
+	sum := sha256.Sum256(schema)
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSchema reports whether schema is a usable JSON Schema document
+func CheckSchema(schema []byte) error {
+	_, err := compileSchema(schema)
+	return err
+}
+
+// schemaFor returns the compiled schema a record of schemaVersion is validated against, at height or,
+// when nil, at the next block
+func schemaFor(schemaVersion string, height *uint64) (*gojsonschema.Schema, error) {
+	schema, err := schemaDocument(schemaVersion, height)
+	if err != nil {
+		return nil, err
+	}
+	return compileSchema(schema)
+}
+
+// schemaDocument returns the schema document schemaFor compiles. Without a SchemaSource, versions with
+// no schema of their own fall back to v1, which rejects them.
+func schemaDocument(schemaVersion string, height *uint64) ([]byte, error) {
+	schemaSourceMu.RLock()
+	src := schemaSource
+	schemaSourceMu.RUnlock()
+	if src == nil {
+		schema, err := DefaultSchema(SchemaMajor(schemaVersion))
+		if err != nil {
+			return DefaultSchema("1")
+		}
+		return schema, nil
+	}
+	h := src.NextHeight()
+	if height != nil {
+		h = *height
+	}
+	schema, err := src.SchemaAt(SchemaMajor(schemaVersion), h)
+	if err != nil {
+		return nil, fmt.Errorf("schemaVersion %q: %w", schemaVersion, err)
+	}
+	return schema, nil
+}
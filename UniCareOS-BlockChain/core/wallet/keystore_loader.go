@@ -0,0 +1,30 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"unicareos/core/keystore"
+)
+
+// KeystoreWalletLoader loads a wallet key from an encrypted keystore file (see `UniCareOS keys`)
+type KeystoreWalletLoader struct {
+	Path       string
+	Passphrase []byte
+}
+
+// LoadWallet decrypts the keystore; PrivateKey is base64, as with EnvWalletLoader
+func (l *KeystoreWalletLoader) LoadWallet() (*Wallet, error) {
+	f, err := keystore.Load(l.Path)
+	if err != nil {
+		return nil, err
+	}
+	if f.Kind != keystore.KindWallet {
+		return nil, fmt.Errorf("keystore %s holds a %s key, not a wallet key", l.Path, f.Kind)
+	}
+	key, err := f.Decrypt(l.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{PrivateKey: base64.StdEncoding.EncodeToString(key)}, nil
+}
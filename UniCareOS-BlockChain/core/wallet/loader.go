@@ -1,7 +1,10 @@
 package wallet
 
+import "unicareos/core/signer"
+
 type Wallet struct {
     PrivateKey string
+    Signer     signer.Signer // Set instead of PrivateKey when the key is held by a token
     // Add other fields as needed (e.g., PublicKey, Metadata)
 }
 
@@ -2,17 +2,25 @@ package wallet
 
 import (
     "errors"
-    // Add cloud/vault/HSM SDK imports here when ready
+
+    "unicareos/core/signer"
 )
 
-// SecretsManagerWalletLoader is a placeholder for future secure key retrieval (e.g., AWS Secrets Manager, HashiCorp Vault, HSM)
+// SecretsManagerWalletLoader loads a wallet whose key is held by a key store such as a PKCS#11 HSM.
+// The private key never leaves the store; the returned wallet signs through it.
 type SecretsManagerWalletLoader struct {
-    // Add config fields as needed (e.g., secret name, region, credentials)
+    Token signer.Token // Key store, e.g. a *signer.PKCS11Token
+    Label string       // Label of the wallet's key
 }
 
-// LoadWallet fetches the private key from a secrets manager or HSM (not yet implemented)
+// LoadWallet returns the wallet backed by the key labelled l.Label
 func (l *SecretsManagerWalletLoader) LoadWallet() (*Wallet, error) {
-    // TODO: Implement integration with your secrets manager or HSM
-    // Example: Fetch secret, decode base64, return Wallet struct
-    return nil, errors.New("SecretsManagerWalletLoader is not yet implemented")
+    if l.Token == nil {
+        return nil, errors.New("no key store configured")
+    }
+    key, err := l.Token.Signer(l.Label)
+    if err != nil {
+        return nil, err
+    }
+    return &Wallet{Signer: key}, nil
 }
@@ -0,0 +1,51 @@
+// Package worker runs the node's periodic background jobs (mempool expiry, review escalation, anchoring).
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// Periodic runs a job on a ticker in its own goroutine. The zero value is stopped and ready to Start.
+type Periodic struct {
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// Start calls job every interval, and once straight away if immediate is set, until Stop is called.
+// Starting a running Periodic does nothing.
+func (p *Periodic) Start(interval time.Duration, immediate bool, job func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	p.stop = stop
+
+	go func() {
+		if immediate {
+			job()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				job()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the loop. A job already running finishes; none starts afterwards.
+func (p *Periodic) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeriodicRunsUntilStopped(t *testing.T) {
+	var p Periodic
+	var runs atomic.Int32
+	p.Start(time.Millisecond, true, func() { runs.Add(1) })
+	p.Start(time.Millisecond, true, func() { t.Error("second Start ran its job") })
+
+	deadline := time.Now().Add(time.Second)
+	for runs.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if runs.Load() < 3 {
+		t.Fatalf("job ran %d times", runs.Load())
+	}
+	p.Stop()
+	time.Sleep(5 * time.Millisecond) // Let a tick already in flight finish
+	after := runs.Load()
+	time.Sleep(10 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("job kept running after Stop")
+	}
+	p.Stop() // Stopping a stopped Periodic is harmless
+}
@@ -6,6 +6,9 @@ import (
 	"io/ioutil"
 	"bytes"
 	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func main() {
@@ -16,7 +19,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Read API JWT secret from environment (optional, for Authorization header)
+	// Read API JWT secret from environment; it signs the provider token sent in the Authorization header
 	apiJwtSecret := os.Getenv("API_JWT_SECRET")
 	if apiJwtSecret == "" {
 		fmt.Println("API_JWT_SECRET not set in environment")
@@ -36,7 +39,16 @@ func main() {
 		panic(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiJwtSecret)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "lightnode",
+		"role":  "provider",
+		"scope": "records:write",
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}).SignedString([]byte(apiJwtSecret))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("X-Ethos-Token", ethosToken)
 
 	client := &http.Client{}
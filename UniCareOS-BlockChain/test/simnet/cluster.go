@@ -0,0 +1,318 @@
+package simnet
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"unicareos/api/server"
+	"unicareos/core/block"
+	"unicareos/core/chain"
+	"unicareos/core/mempool"
+	"unicareos/core/networking"
+	"unicareos/core/storage"
+)
+
+// P2P port every simulated node listens on; gossip INVs advertise it
+const nodePort = 3000
+
+// ClusterConfig describes a simulated network of full UniCareOS nodes
+type ClusterConfig struct {
+	Validators      int       // Nodes in the producer table (take turns producing blocks)
+	FullNodes       int       // Nodes that only follow the chain
+	Seed            int64     // Node keys and message drops are derived from it
+	Dir             string    // Per-node LevelDB directories are created under it (UNICARE_DEK must be set)
+	Start           time.Time // Simulated start time (zero means 2025-01-01 UTC)
+	EpochBlockCount int       // Blocks per epoch (zero means 10)
+}
+
+// Node is one simulated node with its real networking, storage, mempool and peer RPC handlers
+type Node struct {
+	Addr      string
+	PubKey    ed25519.PublicKey
+	Validator bool
+	Net       *networking.Network
+	Store     *storage.Storage
+	Mempool   *mempool.Mempool
+	Gossip    *mempool.GossipEngine
+}
+
+// Cluster is a set of nodes wired together over a simulated Net
+type Cluster struct {
+	Net   *Net
+	Nodes []*Node
+}
+
+// NodeKey derives the deterministic Ed25519 key for node i
+func NodeKey(seed int64, i int) (ed25519.PublicKey, ed25519.PrivateKey) {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(seed))
+	binary.BigEndian.PutUint64(buf[8:], uint64(i))
+	s := sha256.Sum256(buf[:])
+	priv := ed25519.NewKeyFromSeed(s[:])
+	return priv.Public().(ed25519.PublicKey), priv
+}
+
+// NewCluster builds the nodes and connects every node to every other one
+func NewCluster(cfg ClusterConfig) (*Cluster, error) {
+	if cfg.Start.IsZero() {
+		cfg.Start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if cfg.EpochBlockCount <= 0 {
+		cfg.EpochBlockCount = 10
+	}
+	c := &Cluster{Net: New(cfg.Seed, cfg.Start)}
+	genesis := genesisBlock(cfg.Start)
+	genesisBytes, err := genesis.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("genesis: %v", err)
+	}
+	total := cfg.Validators + cfg.FullNodes
+	for i := 0; i < total; i++ {
+		addr := fmt.Sprintf("10.0.0.%d:%d", i+1, nodePort)
+		pub, priv := NodeKey(cfg.Seed, i)
+		store, err := storage.NewStorage(filepath.Join(cfg.Dir, fmt.Sprintf("node%d", i)))
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("node %d storage: %v", i, err)
+		}
+		// Every node starts from the same genesis block, as cmd/UniCareOS does on first start
+		if err := store.SaveBlock(genesis.BlockID[:], genesisBytes); err != nil {
+			store.Close()
+			c.Close()
+			return nil, fmt.Errorf("node %d genesis: %v", i, err)
+		}
+		n := networking.NewNetwork(addr, store, 8080, pub, priv, nil, cfg.EpochBlockCount)
+		if err := n.SetLatestBlockID(genesis.BlockID); err != nil {
+			store.Close()
+			c.Close()
+			return nil, fmt.Errorf("node %d genesis tip: %v", i, err)
+		}
+		n.SetClock(c.Net.Clock.Now)
+		n.SetSpawner(c.Net.Spawn)
+		mp := mempool.NewMempool(1000)
+		ge := mempool.NewGossipEngine(nil, mp)
+		ge.SetClock(c.Net.Clock.Now)
+		ge.SetSpawner(c.Net.Spawn)
+		ge.ListenPort = nodePort
+		ge.PeerSource = n.GossipPeers
+		ge.TxIDOf = networking.TxIDOf
+		n.Mempool = mp
+		n.Gossip = ge
+		srv := server.NewServer(store, n, "", ge, chain.NewForkChoice(store), nil)
+		srv.RegisterPeerRPC(n.PeerMux)
+		client := c.Net.Attach(addr, pub, n.PeerMux)
+		n.PeerClient = client
+		ge.Client = client
+		node := &Node{Addr: addr, PubKey: pub, Validator: i < cfg.Validators, Net: n, Store: store, Mempool: mp, Gossip: ge}
+		if !node.Validator {
+			n.RemoveProducer(pub)
+			n.Handshake.Role = networking.RoleFullNode
+		} else {
+			n.Handshake.Role = networking.RoleValidator
+		}
+		c.Nodes = append(c.Nodes, node)
+	}
+	// Validators double as epoch finalizers; every node checks finalizations against their keys
+	var finalizers []string
+	for _, b := range c.Nodes {
+		if b.Validator {
+			finalizers = append(finalizers, base64.StdEncoding.EncodeToString(b.PubKey))
+		}
+	}
+	for i, a := range c.Nodes {
+		a.Net.FinalizerKeys = finalizers
+		if a.Validator {
+			_, a.Net.FinalizerKey = NodeKey(cfg.Seed, i)
+		}
+		for _, b := range c.Nodes {
+			if a == b {
+				continue
+			}
+			a.Net.Transport.Keys.Add(b.PubKey)
+			if b.Validator {
+				a.Net.AddProducer(b.PubKey)
+			}
+		}
+	}
+	c.RefreshPeerTables()
+	return c, nil
+}
+
+// genesisBlock is the height-0 block every simulated chain starts from
+func genesisBlock(start time.Time) block.Block {
+	g := block.Block{Height: 0, Timestamp: start, ValidatorDID: "simnet-genesis"}
+	g.BlockID = g.ComputeID()
+	return g
+}
+
+// Close releases node storage
+func (c *Cluster) Close() {
+	for _, n := range c.Nodes {
+		n.Store.Close()
+	}
+}
+
+// Advance moves simulated time forward, delivering messages as they come due
+func (c *Cluster) Advance(d time.Duration) {
+	c.Net.Advance(d)
+}
+
+// Live returns the nodes that are not crashed
+func (c *Cluster) Live() []*Node {
+	var out []*Node
+	for _, n := range c.Nodes {
+		if !c.Net.Crashed(n.Addr) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// RefreshPeerTables updates every live node's peer table with the heights and tips of the peers it can
+// reach, the way the status poll does in a running node
+func (c *Cluster) RefreshPeerTables() {
+	now := c.Net.Clock.Now()
+	for _, a := range c.Live() {
+		for _, b := range c.Nodes {
+			if a == b {
+				continue
+			}
+			c.Net.mu.Lock()
+			reachable := c.Net.reachableLocked(a.Addr, b.Addr)
+			c.Net.mu.Unlock()
+			if !reachable {
+				continue // The node keeps what it last knew about an unreachable peer
+			}
+			tip := b.Net.GetLatestBlockID()
+			role := networking.RoleFullNode
+			if b.Validator {
+				role = networking.RoleValidator
+			}
+			p := networking.Peer{
+				Address:         b.Addr,
+				PubKey:          b.PubKey,
+				ChainHeight:     b.Height(),
+				TipBlockID:      hex.EncodeToString(tip[:]),
+				LastSeen:        now,
+				ProtocolVersion: networking.ProtocolVersion,
+				Role:            role,
+				Features:        networking.SupportedFeatures(),
+			}
+			a.Net.AddPeer(p)
+		}
+	}
+}
+
+// ProduceRound lets every live validator try to produce the next block (only the scheduled leader
+// does) and then advances the clock by interval. It returns the number of blocks produced.
+func (c *Cluster) ProduceRound(interval time.Duration) int {
+	produced := 0
+	for _, n := range c.Live() {
+		if !n.Validator {
+			continue
+		}
+		before := n.Net.GetLatestBlockID()
+		if err := n.Net.ProduceBlock(); err != nil {
+			continue
+		}
+		if n.Net.GetLatestBlockID() != before {
+			produced++
+		}
+	}
+	c.Advance(interval)
+	return produced
+}
+
+// Sync runs a headers-first sync on node i against the peers it can reach
+func (c *Cluster) Sync(i int) error {
+	c.RefreshPeerTables()
+	var err error
+	c.Net.Run(10*time.Millisecond, func() {
+		err = c.Nodes[i].Net.HeadersFirstSync("", c.Nodes[i].Net.SyncConfig)
+	})
+	return err
+}
+
+// Height returns the height of the node's tip (0 at genesis)
+func (n *Node) Height() int {
+	tip := n.Net.GetLatestBlockID()
+	if tip == [32]byte{} {
+		return 0
+	}
+	data, err := n.Store.GetBlock(tip[:])
+	if err != nil {
+		return 0
+	}
+	blk, err := block.Deserialize(data)
+	if err != nil {
+		return 0
+	}
+	return int(blk.Height)
+}
+
+// Chain returns the node's main chain block IDs (hex), indexed by height, walking back from the tip to genesis
+func (n *Node) Chain() []string {
+	var rev []string
+	id := n.Net.GetLatestBlockID()
+	for id != [32]byte{} {
+		data, err := n.Store.GetBlock(id[:])
+		if err != nil {
+			break
+		}
+		blk, err := block.Deserialize(data)
+		if err != nil {
+			break
+		}
+		rev = append(rev, hex.EncodeToString(id[:]))
+		parent, err := hex.DecodeString(blk.PrevHash)
+		if err != nil || len(parent) != 32 {
+			break
+		}
+		copy(id[:], parent)
+	}
+	out := make([]string, len(rev))
+	for i, h := range rev {
+		out[len(rev)-1-i] = h
+	}
+	return out
+}
+
+// Converged reports whether every live node has the same tip
+func (c *Cluster) Converged() bool {
+	live := c.Live()
+	for _, n := range live[1:] {
+		if n.Net.GetLatestBlockID() != live[0].Net.GetLatestBlockID() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckSafety verifies that no two nodes hold different blocks at the same height: every chain is a
+// prefix of the longest one, so blocks below any node's tip are final everywhere they exist
+func (c *Cluster) CheckSafety() error {
+	var longest []string
+	var owner string
+	chains := make(map[string][]string)
+	for _, n := range c.Nodes {
+		ch := n.Chain()
+		chains[n.Addr] = ch
+		if len(ch) > len(longest) {
+			longest, owner = ch, n.Addr
+		}
+	}
+	for addr, ch := range chains {
+		for h, id := range ch {
+			if longest[h] != id {
+				return fmt.Errorf("%s and %s disagree at height %d: %s vs %s", addr, owner, h, id, longest[h])
+			}
+		}
+	}
+	return nil
+}
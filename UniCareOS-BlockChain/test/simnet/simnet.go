@@ -0,0 +1,423 @@
+// Package simnet runs many UniCareOS nodes in one process on a simulated network and clock.
+//
+// Every node's peer RPC client is an http.Client whose RoundTripper hands the request straight to the
+// destination node's handler, so no ports are opened. The network can be partitioned, given latency,
+// made to drop messages and have nodes crash and restart. Time only moves when the test calls Advance.
+//
+// Determinism: drop decisions are a hash of (seed, message, attempt), not a shared random stream, and
+// delayed messages are delivered one at a time in (delivery time, message) order, each after the network
+// has gone quiet. Quiet is judged on counters, not timing: no request is being handled and every piece of
+// background node work (started through Spawn) has finished or is parked waiting for a delivery. Runs with the same seed therefore see the same deliveries in the same order, provided
+// nodes only start work from Advance or from the test goroutine.
+package simnet
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Clock is a simulated clock shared by every node on a Net
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at start
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the simulated time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) set(t time.Time) {
+	c.mu.Lock()
+	if t.After(c.now) {
+		c.now = t
+	}
+	c.mu.Unlock()
+}
+
+// Stats counts what happened to messages
+type Stats struct {
+	Sent        int // Requests issued
+	Delivered   int // Requests handled by their destination
+	Dropped     int // Lost to the drop rate
+	Unreachable int // Blocked by a partition or a crashed node
+}
+
+// ErrUnreachable is returned for requests across a partition or to/from a crashed node
+var ErrUnreachable = errors.New("simnet: destination unreachable")
+
+// ErrDropped is returned for requests lost to the drop rate
+var ErrDropped = errors.New("simnet: message dropped")
+
+type link struct{ from, to string }
+
+type endpoint struct {
+	handler http.Handler
+	pubKey  ed25519.PublicKey
+	crashed bool
+}
+
+// Net is the simulated network
+type Net struct {
+	Clock *Clock
+
+	mu          sync.Mutex
+	seed        int64
+	nodes       map[string]*endpoint
+	partition   map[string]int // Address -> group; nil means fully connected
+	latency     time.Duration
+	linkLatency map[link]time.Duration
+	dropRate    float64
+	linkDrop    map[link]float64
+	attempts    map[string]int // Message key -> sends so far, so a resend gets a fresh drop decision
+	queue       deliveryQueue
+	seq         uint64
+	active      int // Requests being handled (not parked in the queue)
+	tasks       int // Background work started through Spawn and not yet finished
+	idle        *sync.Cond
+	stats       Stats
+}
+
+// New creates an empty network whose clock starts at start
+func New(seed int64, start time.Time) *Net {
+	n := &Net{
+		Clock:       NewClock(start),
+		seed:        seed,
+		nodes:       make(map[string]*endpoint),
+		linkLatency: make(map[link]time.Duration),
+		linkDrop:    make(map[link]float64),
+		attempts:    make(map[string]int),
+	}
+	n.idle = sync.NewCond(&n.mu)
+	return n
+}
+
+// Attach registers a node at address and returns the client it must use to reach its peers.
+// Requests it receives appear to come over an authenticated connection from the sender's pubKey.
+func (n *Net) Attach(address string, pubKey ed25519.PublicKey, handler http.Handler) *http.Client {
+	n.mu.Lock()
+	n.nodes[address] = &endpoint{handler: handler, pubKey: pubKey}
+	n.mu.Unlock()
+	return &http.Client{Transport: roundTripper{net: n, from: address}}
+}
+
+// Partition splits the network into groups; nodes can only reach nodes in their own group.
+// Nodes not listed are isolated.
+func (n *Net) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partition = make(map[string]int)
+	for i, g := range groups {
+		for _, addr := range g {
+			n.partition[addr] = i + 1
+		}
+	}
+}
+
+// Heal removes any partition
+func (n *Net) Heal() {
+	n.mu.Lock()
+	n.partition = nil
+	n.mu.Unlock()
+}
+
+// SetLatency sets the one-way delivery delay for every link without its own setting
+func (n *Net) SetLatency(d time.Duration) {
+	n.mu.Lock()
+	n.latency = d
+	n.mu.Unlock()
+}
+
+// SetLinkLatency sets the delay for messages from one node to another
+func (n *Net) SetLinkLatency(from, to string, d time.Duration) {
+	n.mu.Lock()
+	n.linkLatency[link{from, to}] = d
+	n.mu.Unlock()
+}
+
+// SetDropRate sets the fraction of messages lost on every link without its own setting
+func (n *Net) SetDropRate(p float64) {
+	n.mu.Lock()
+	n.dropRate = p
+	n.mu.Unlock()
+}
+
+// SetLinkDropRate sets the loss rate for messages from one node to another
+func (n *Net) SetLinkDropRate(from, to string, p float64) {
+	n.mu.Lock()
+	n.linkDrop[link{from, to}] = p
+	n.mu.Unlock()
+}
+
+// Crash stops a node from sending or receiving; its state is kept for Restart
+func (n *Net) Crash(address string) {
+	n.mu.Lock()
+	if ep, ok := n.nodes[address]; ok {
+		ep.crashed = true
+	}
+	n.mu.Unlock()
+}
+
+// Restart brings a crashed node back
+func (n *Net) Restart(address string) {
+	n.mu.Lock()
+	if ep, ok := n.nodes[address]; ok {
+		ep.crashed = false
+	}
+	n.mu.Unlock()
+}
+
+// Crashed reports whether a node is down
+func (n *Net) Crashed(address string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ep, ok := n.nodes[address]
+	return ok && ep.crashed
+}
+
+// Stats returns message counters
+func (n *Net) Stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// reachableLocked reports whether from can currently talk to to. Caller must hold n.mu.
+func (n *Net) reachableLocked(from, to string) bool {
+	src, dst := n.nodes[from], n.nodes[to]
+	if src == nil || dst == nil || src.crashed || dst.crashed {
+		return false
+	}
+	if n.partition != nil && (n.partition[from] == 0 || n.partition[from] != n.partition[to]) {
+		return false
+	}
+	return true
+}
+
+// droppedLocked decides deterministically whether this send of key is lost. Caller must hold n.mu.
+func (n *Net) droppedLocked(l link, key string, attempt int) bool {
+	rate, ok := n.linkDrop[l]
+	if !ok {
+		rate = n.dropRate
+	}
+	if rate <= 0 {
+		return false
+	}
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, n.seed)
+	binary.Write(h, binary.BigEndian, int64(attempt))
+	h.Write([]byte(key))
+	v := binary.BigEndian.Uint64(h.Sum(nil)[:8])
+	return float64(v)/float64(^uint64(0)) < rate
+}
+
+func (n *Net) latencyLocked(l link) time.Duration {
+	if d, ok := n.linkLatency[l]; ok {
+		return d
+	}
+	return n.latency
+}
+
+// delivery is a delayed message waiting for the clock
+type delivery struct {
+	at      time.Time
+	key     string
+	attempt int
+	seq     uint64
+	link    link
+	ready   chan error
+}
+
+type deliveryQueue []*delivery
+
+func (q deliveryQueue) Len() int { return len(q) }
+func (q deliveryQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	if q[i].key != q[j].key {
+		return q[i].key < q[j].key
+	}
+	if q[i].attempt != q[j].attempt {
+		return q[i].attempt < q[j].attempt
+	}
+	return q[i].seq < q[j].seq
+}
+func (q deliveryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *deliveryQueue) Push(x interface{}) { *q = append(*q, x.(*delivery)) }
+func (q *deliveryQueue) Pop() interface{} {
+	old := *q
+	d := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return d
+}
+
+// Spawn runs fn in the background as node work the network waits for before it counts as quiet.
+// Nodes start their peer relays, broadcasts and fetches through it (see Network.SetSpawner).
+func (n *Net) Spawn(fn func()) {
+	n.mu.Lock()
+	n.tasks++
+	n.mu.Unlock()
+	go func() {
+		defer func() {
+			n.mu.Lock()
+			n.tasks--
+			n.idle.Broadcast()
+			n.mu.Unlock()
+		}()
+		fn()
+	}()
+}
+
+// quietLocked reports whether no request is being handled and all background work is done or parked in
+// the delivery queue. Caller must hold n.mu.
+func (n *Net) quietLocked() bool {
+	return n.active == 0 && n.tasks <= len(n.queue)
+}
+
+// Settle waits until the network is quiet
+func (n *Net) Settle() {
+	n.mu.Lock()
+	for !n.quietLocked() {
+		n.idle.Wait()
+	}
+	n.mu.Unlock()
+}
+
+// Advance moves the clock forward by d, delivering delayed messages in order as their time comes
+func (n *Net) Advance(d time.Duration) {
+	target := n.Clock.Now().Add(d)
+	for {
+		n.Settle()
+		n.mu.Lock()
+		if len(n.queue) == 0 || n.queue[0].at.After(target) {
+			n.mu.Unlock()
+			break
+		}
+		next := heap.Pop(&n.queue).(*delivery)
+		n.Clock.set(next.at)
+		if !n.reachableLocked(next.link.from, next.link.to) {
+			n.stats.Unreachable++
+			n.mu.Unlock()
+			next.ready <- ErrUnreachable
+			continue
+		}
+		n.active++
+		n.mu.Unlock()
+		next.ready <- nil
+	}
+	n.Clock.set(target)
+	n.Settle()
+}
+
+// Run calls fn (which may block on peer requests) and advances the clock in steps until it returns
+func (n *Net) Run(step time.Duration, fn func()) {
+	done := make(chan struct{})
+	n.Spawn(func() {
+		defer close(done)
+		fn()
+	})
+	for {
+		select {
+		case <-done:
+			n.Settle()
+			return
+		default:
+			n.Advance(step)
+		}
+	}
+}
+
+// Pending returns the number of delayed messages not yet delivered
+func (n *Net) Pending() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.queue)
+}
+
+type roundTripper struct {
+	net  *Net
+	from string
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := rt.net
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	to := req.URL.Host
+	l := link{rt.from, to}
+	sum := sha256.Sum256(body)
+	key := fmt.Sprintf("%s>%s %s %s %x", rt.from, to, req.Method, req.URL.RequestURI(), sum[:8])
+
+	n.mu.Lock()
+	n.stats.Sent++
+	if !n.reachableLocked(rt.from, to) {
+		n.stats.Unreachable++
+		n.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s from %s", ErrUnreachable, to, rt.from)
+	}
+	attempt := n.attempts[key]
+	n.attempts[key]++
+	if n.droppedLocked(l, key, attempt) {
+		n.stats.Dropped++
+		n.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrDropped, key)
+	}
+	if lat := n.latencyLocked(l); lat > 0 {
+		n.seq++
+		d := &delivery{at: n.Clock.Now().Add(lat), key: key, attempt: attempt, seq: n.seq, link: l, ready: make(chan error, 1)}
+		heap.Push(&n.queue, d)
+		n.idle.Broadcast()
+		n.mu.Unlock()
+		if err := <-d.ready; err != nil {
+			return nil, fmt.Errorf("%w: %s from %s", err, to, rt.from)
+		}
+		// Advance counted us as active before releasing the delivery
+	} else {
+		n.active++
+		n.mu.Unlock()
+	}
+	defer func() {
+		n.mu.Lock()
+		n.active--
+		n.idle.Broadcast()
+		n.mu.Unlock()
+	}()
+
+	n.mu.Lock()
+	dst, src := n.nodes[to], n.nodes[rt.from]
+	n.stats.Delivered++
+	n.mu.Unlock()
+
+	in := httptest.NewRequest(req.Method, req.URL.RequestURI(), bytes.NewReader(body))
+	in.Header = req.Header.Clone()
+	in.RemoteAddr = rt.from
+	in.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{PublicKey: src.pubKey}}}
+	rec := httptest.NewRecorder()
+	dst.handler.ServeHTTP(rec, in)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,324 @@
+package simnet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"unicareos/core/block"
+	"unicareos/core/blockchain"
+	"unicareos/core/did"
+	"unicareos/core/mempool"
+	"unicareos/core/types"
+)
+
+func newTestCluster(t *testing.T, validators, fullNodes int, seed int64) *Cluster {
+	t.Helper()
+	return newConfiguredCluster(t, ClusterConfig{Validators: validators, FullNodes: fullNodes, Seed: seed})
+}
+
+func newConfiguredCluster(t *testing.T, cfg ClusterConfig) *Cluster {
+	t.Helper()
+	dek := make([]byte, 32)
+	rand.Read(dek)
+	t.Setenv("UNICARE_DEK", base64.StdEncoding.EncodeToString(dek))
+	cfg.Dir = t.TempDir()
+	c, err := NewCluster(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestBlocksConvergeWithLatency(t *testing.T) {
+	c := newTestCluster(t, 4, 1, 1)
+	c.Net.SetLatency(40 * time.Millisecond)
+	for round := 0; round < 8; round++ {
+		if c.ProduceRound(time.Second) != 1 {
+			t.Fatalf("round %d: expected exactly one leader to produce", round)
+		}
+		if !c.Converged() {
+			t.Fatalf("round %d: nodes did not converge", round)
+		}
+	}
+	if h := c.Nodes[4].Height(); h != 8 {
+		t.Errorf("full node at height %d, want 8", h)
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPartitionedNodeCatchesUpAfterHeal(t *testing.T) {
+	c := newTestCluster(t, 4, 1, 2)
+	c.Net.SetLatency(20 * time.Millisecond)
+	validators := []string{c.Nodes[0].Addr, c.Nodes[1].Addr, c.Nodes[2].Addr, c.Nodes[3].Addr}
+	follower := c.Nodes[4]
+	c.Net.Partition(validators, []string{follower.Addr})
+	for round := 0; round < 5; round++ {
+		c.ProduceRound(time.Second)
+	}
+	if follower.Height() != 0 || c.Nodes[0].Height() != 5 {
+		t.Fatalf("partition leaked blocks: follower %d, validator %d", follower.Height(), c.Nodes[0].Height())
+	}
+	c.Net.Heal()
+	if err := c.Sync(4); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Converged() {
+		t.Fatalf("follower did not catch up: height %d", follower.Height())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCrashedLeaderHaltsProgressUntilRestart(t *testing.T) {
+	c := newTestCluster(t, 3, 0, 3)
+	c.Net.SetLatency(10 * time.Millisecond)
+	for round := 0; round < 2; round++ {
+		c.ProduceRound(time.Second)
+	}
+	height := c.Nodes[0].Height()
+	leader := leaderAt(c, height)
+	c.Net.Crash(leader.Addr)
+	if c.ProduceRound(time.Second) != 0 {
+		t.Fatal("a block was produced while the scheduled leader was down")
+	}
+	c.Net.Restart(leader.Addr)
+	if c.ProduceRound(time.Second) != 1 || !c.Converged() || c.Nodes[0].Height() != height+1 {
+		t.Fatalf("chain did not resume after restart (height %d)", c.Nodes[0].Height())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Error(err)
+	}
+}
+
+// leaderAt returns the validator scheduled to build on a tip at height (round robin over the sorted producer table)
+func leaderAt(c *Cluster, height int) *Node {
+	producers := c.Nodes[0].Net.GetSortedDynamicProducers()
+	key := producers[height%len(producers)]
+	for _, n := range c.Nodes {
+		if fmt.Sprintf("%x", []byte(n.PubKey)) == key {
+			return n
+		}
+	}
+	return nil
+}
+
+func TestSameSeedReplaysIdentically(t *testing.T) {
+	run := func() (Stats, [][]string) {
+		c := newTestCluster(t, 4, 2, 7)
+		c.Net.SetLatency(30 * time.Millisecond)
+		c.Net.SetDropRate(0.3)
+		for round := 0; round < 6; round++ {
+			c.ProduceRound(time.Second)
+		}
+		var chains [][]string
+		for _, n := range c.Nodes {
+			chains = append(chains, n.Chain())
+		}
+		if err := c.CheckSafety(); err != nil {
+			t.Error(err)
+		}
+		return c.Net.Stats(), chains
+	}
+	stats1, chains1 := run()
+	stats2, chains2 := run()
+	if stats1 != stats2 {
+		t.Fatalf("stats differ between runs: %+v vs %+v", stats1, stats2)
+	}
+	if stats1.Dropped == 0 {
+		t.Fatal("expected some messages to be dropped")
+	}
+	for i := range chains1 {
+		if fmt.Sprint(chains1[i]) != fmt.Sprint(chains2[i]) {
+			t.Errorf("node %d ended on a different chain in the replay", i)
+		}
+	}
+}
+
+func TestTxGossipReachesEveryMempool(t *testing.T) {
+	c := newTestCluster(t, 3, 2, 4)
+	c.Net.SetLatency(15 * time.Millisecond)
+	payload := []byte(`{"type":"test"}`)
+	tx := mempool.Transaction{TxID: mempool.PayloadTxID(payload), Payload: payload, Timestamp: c.Net.Clock.Now().Unix()}
+	c.Nodes[0].Gossip.BroadcastTx(tx)
+	c.Advance(time.Second)
+	for i, n := range c.Nodes {
+		if _, ok := n.Mempool.GetTx(tx.TxID); !ok {
+			t.Errorf("node %d never received the transaction", i)
+		}
+	}
+}
+
+func TestEpochsFinalizedOnChainByValidatorQuorum(t *testing.T) {
+	c := newConfiguredCluster(t, ClusterConfig{Validators: 4, FullNodes: 1, Seed: 11, EpochBlockCount: 3})
+	c.Net.SetLatency(20 * time.Millisecond)
+	for round := 0; round < 8; round++ {
+		c.ProduceRound(time.Second)
+	}
+	if !c.Converged() {
+		t.Fatal("nodes did not converge")
+	}
+	for epoch := uint64(0); epoch < 2; epoch++ {
+		var first *types.FinalizeEpochTx
+		for i, n := range c.Nodes {
+			rec, err := blockchain.GetEpochFinalization(n.Store, epoch)
+			if err != nil {
+				t.Fatalf("node %d: epoch %d not finalized: %v", i, epoch, err)
+			}
+			if len(rec.Signatures) < blockchain.FinalizerQuorum(4) {
+				t.Errorf("node %d: epoch %d finalized with %d signatures", i, epoch, len(rec.Signatures))
+			}
+			if first == nil {
+				first = rec
+			} else if rec.TxID != first.TxID || rec.IncludedIn != first.IncludedIn {
+				t.Errorf("node %d recorded epoch %d differently: %s in %s vs %s in %s", i, epoch, rec.TxID, rec.IncludedIn, first.TxID, first.IncludedIn)
+			}
+		}
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForkChoiceSwitchesToLongerChainAfterHeal(t *testing.T) {
+	c := newTestCluster(t, 4, 1, 5)
+	c.Net.SetLatency(10 * time.Millisecond)
+	follower := c.Nodes[4]
+	var majority []string
+	for _, n := range c.Nodes[:4] {
+		majority = append(majority, n.Addr)
+	}
+	c.Net.Partition(majority, []string{follower.Addr})
+
+	// Cut off, the follower accepts a block at height 1 that the majority never sees
+	leader := leaderAt(c, 0)
+	for i, n := range c.Nodes {
+		if n == leader {
+			_, priv := NodeKey(5, i)
+			fork := sealedBlock(c.Nodes[0].Chain()[0], 1, c.Net.Clock.Now().Add(time.Millisecond), priv)
+			if err := follower.Net.SaveNewBlock(fork); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for round := 0; round < 3; round++ {
+		c.ProduceRound(time.Second)
+	}
+	if follower.Height() != 1 || c.Nodes[0].Height() != 3 || follower.Chain()[1] == c.Nodes[0].Chain()[1] {
+		t.Fatalf("expected competing forks: follower %v, majority %v", follower.Chain(), c.Nodes[0].Chain())
+	}
+
+	c.Net.Heal()
+	c.RefreshPeerTables()
+	var err error
+	c.Net.Run(10*time.Millisecond, func() { err = follower.Net.HandleForkChoiceReorg("", 0, "") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Converged() || fmt.Sprint(follower.Chain()) != fmt.Sprint(c.Nodes[0].Chain()) {
+		t.Fatalf("follower stayed on its fork: %v vs %v", follower.Chain(), c.Nodes[0].Chain())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReorgRevertsStateOfAbandonedBlocks(t *testing.T) {
+	c := newTestCluster(t, 4, 1, 6)
+	c.Net.SetLatency(10 * time.Millisecond)
+	follower := c.Nodes[4]
+	var majority []string
+	for _, n := range c.Nodes[:4] {
+		majority = append(majority, n.Addr)
+	}
+	c.Net.Partition(majority, []string{follower.Addr})
+
+	// A patient's grant reaches both sides of the partition
+	_, patient, _ := ed25519.GenerateKey(rand.Reader)
+	now := c.Net.Clock.Now().UTC()
+	g := &block.ConsentGrant{
+		PatientDID: did.FromEd25519(patient.Public().(ed25519.PublicKey)),
+		Grantee:    block.Grantee{Type: block.GranteeOrganization, ID: "clinic-a"},
+		Scope:      []string{"lab_result"},
+		Purpose:    "treatment",
+		Expiry:     now.Add(time.Hour),
+		Timestamp:  now,
+	}
+	if err := g.Sign(patient); err != nil {
+		t.Fatal(err)
+	}
+	grant := &block.ConsentPayload{Type: block.ConsentGrantType, Grant: g}
+
+	// Cut off, the follower accepts a block at height 1 carrying the grant
+	leader := leaderAt(c, 0)
+	for i, n := range c.Nodes {
+		if n == leader {
+			_, priv := NodeKey(6, i)
+			fork := sealedBlock(c.Nodes[0].Chain()[0], 1, c.Net.Clock.Now().Add(time.Millisecond), priv, block.ConsentEvent(grant))
+			if err := follower.Net.SaveNewBlock(fork); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if rec, err := blockchain.GetConsent(follower.Store, g.ConsentID); err != nil || rec.IncludedIn != follower.Chain()[1] {
+		t.Fatalf("follower did not apply the grant from its fork: %v", err)
+	}
+
+	// The majority includes the same grant in its own, longer chain
+	if _, err := c.Nodes[0].Net.SubmitConsent(grant); err != nil {
+		t.Fatal(err)
+	}
+	for round := 0; round < 3; round++ {
+		c.ProduceRound(time.Second)
+	}
+	want, err := blockchain.GetConsent(c.Nodes[0].Store, g.ConsentID)
+	if err != nil {
+		t.Fatalf("majority did not include the grant: %v", err)
+	}
+	if follower.Height() != 1 || c.Nodes[0].Height() != 3 || want.IncludedIn == follower.Chain()[1] {
+		t.Fatalf("expected competing forks: follower %v, majority %v", follower.Chain(), c.Nodes[0].Chain())
+	}
+
+	// The follower's grant must be reverted with its block for the majority's block to apply it again
+	c.Net.Heal()
+	c.RefreshPeerTables()
+	c.Net.Run(10*time.Millisecond, func() { err = follower.Net.HandleForkChoiceReorg("", 0, "") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Converged() || fmt.Sprint(follower.Chain()) != fmt.Sprint(c.Nodes[0].Chain()) {
+		t.Fatalf("follower stayed on its fork: %v vs %v", follower.Chain(), c.Nodes[0].Chain())
+	}
+	got, err := blockchain.GetConsent(follower.Store, g.ConsentID)
+	if err != nil || got.IncludedIn != want.IncludedIn || got.Height != want.Height {
+		t.Fatalf("follower holds the grant from %+v, majority from block %s at height %d (%v)", got, want.IncludedIn, want.Height, err)
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Error(err)
+	}
+}
+
+// sealedBlock builds a block of events on parentHex signed by priv
+func sealedBlock(parentHex string, height uint64, ts time.Time, priv ed25519.PrivateKey, events ...block.ChainedEvent) block.Block {
+	b := block.Block{
+		Height:       height,
+		PrevHash:     parentHex,
+		Timestamp:    ts,
+		ValidatorDID: fmt.Sprintf("ed25519:%x", []byte(priv.Public().(ed25519.PublicKey))),
+		Events:       events,
+	}
+	if len(events) > 0 {
+		b.MerkleRoot = block.EventsRoot(events)
+		b.ConsentRoot = block.ConsentRoot(events)
+	}
+	b.BlockID = b.ComputeID()
+	b.Signature = ed25519.Sign(priv, b.BlockID[:])
+	return b
+}
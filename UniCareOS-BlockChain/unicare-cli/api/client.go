@@ -6,8 +6,20 @@ import (
     "net/http"
     "io/ioutil"
     "bytes"
+    "os"
 )
 
+// authorize adds node credentials from the environment: UNICARE_API_TOKEN (a provider JWT) or
+// UNICARE_API_KEY (the node operator key). Submitting and listing the mempool require one of them.
+func authorize(req *http.Request) {
+    if tok := os.Getenv("UNICARE_API_TOKEN"); tok != "" {
+        req.Header.Set("Authorization", "Bearer "+tok)
+    }
+    if key := os.Getenv("UNICARE_API_KEY"); key != "" {
+        req.Header.Set("X-API-Key", key)
+    }
+}
+
 type Status struct {
     Name   string `json:"name"`
     Status string `json:"status"`
@@ -51,7 +63,13 @@ func SubmitMemory(description, author, emotion, parentID string) error {
         "parent_id": parentID,
     }
     b, _ := json.Marshal(payload)
-    resp, err := http.Post("http://localhost:8080/submit_memory", "application/json", bytes.NewReader(b))
+    req, err := http.NewRequest("POST", "http://localhost:8080/submit_memory", bytes.NewReader(b))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    authorize(req)
+    resp, err := http.DefaultClient.Do(req)
     if err != nil {
         return err
     }
@@ -65,12 +83,20 @@ func SubmitMemory(description, author, emotion, parentID string) error {
 
 // GetMempool fetches the list of transactions in the mempool.
 func GetMempool() ([]MemoryTx, error) {
-    resp, err := http.Get("http://localhost:8080/api/cli/mempool")
+    req, err := http.NewRequest("GET", "http://localhost:8080/api/cli/mempool", nil)
+    if err != nil {
+        return nil, err
+    }
+    authorize(req)
+    resp, err := http.DefaultClient.Do(req)
     if err != nil {
         return nil, err
     }
     defer resp.Body.Close()
     body, _ := ioutil.ReadAll(resp.Body)
+    if resp.StatusCode != 200 {
+        return nil, fmt.Errorf("Error: %s", string(body))
+    }
     var txs []MemoryTx
     if err := json.Unmarshal(body, &txs); err != nil {
         return nil, err
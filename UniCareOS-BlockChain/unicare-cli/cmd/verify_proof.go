@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"unicare-cli/proof"
+)
+
+var verifyProofCmd = &cobra.Command{
+	Use:   "verify-proof",
+	Short: "Verify an epoch inclusion proof offline",
+	Long: `Verify, without contacting any node, that a finalized event is part of an epoch whose Merkle root
+was signed on chain by a quorum of finalizers.
+
+Get the proof from any node with GET /epochs/{N}/proof/{eventID}. The finalized epoch record is taken
+from the proof unless --record names a separately obtained FinalizeEpochTx (e.g. from /epochs/{N} on
+another node or a court exhibit). Trust comes only from the finalizer public keys you pass.`,
+	Example: `  unicare verify-proof --proof proof.json --finalizers <key1>,<key2>,<key3>
+  curl -s https://node:8080/epochs/4/proof/<eventID> | unicare verify-proof --proof - --finalizers-file finalizers.txt
+  unicare verify-proof --proof proof.json --record epoch4.json --finalizers <key1> --quorum 1 --output json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		proofPath, _ := cmd.Flags().GetString("proof")
+		recordPath, _ := cmd.Flags().GetString("record")
+		keys, _ := cmd.Flags().GetStringSlice("finalizers")
+		keysFile, _ := cmd.Flags().GetString("finalizers-file")
+		quorum, _ := cmd.Flags().GetInt("quorum")
+		output, _ := cmd.Flags().GetString("output")
+		if proofPath == "" {
+			fmt.Println("Error: --proof is required.")
+			os.Exit(1)
+		}
+		var p proof.EpochProof
+		if err := readJSON(proofPath, &p); err != nil {
+			fmt.Printf("Error reading proof: %v\n", err)
+			os.Exit(1)
+		}
+		var record *proof.EpochRecord
+		if recordPath != "" {
+			// Accept a bare FinalizeEpochTx or a /epochs/{N} response
+			var wrapped struct {
+				Finalization *proof.EpochRecord `json:"finalization"`
+				proof.EpochRecord
+			}
+			if err := readJSON(recordPath, &wrapped); err != nil {
+				fmt.Printf("Error reading record: %v\n", err)
+				os.Exit(1)
+			}
+			record = &wrapped.EpochRecord
+			if wrapped.Finalization != nil {
+				record = wrapped.Finalization
+			}
+		}
+		if keysFile != "" {
+			data, err := os.ReadFile(keysFile)
+			if err != nil {
+				fmt.Printf("Error reading finalizer keys: %v\n", err)
+				os.Exit(1)
+			}
+			keys = append(keys, strings.Fields(strings.ReplaceAll(string(data), ",", " "))...)
+		}
+		res, err := proof.Verify(&p, record, keys, quorum)
+		if output == "json" {
+			out := map[string]interface{}{"valid": err == nil, "epoch": p.Epoch, "eventId": p.EventID}
+			if err != nil {
+				out["error"] = err.Error()
+			} else {
+				out["root"], out["signers"], out["quorum"], out["includedIn"] = res.Root, res.Signers, res.Quorum, res.IncludedIn
+			}
+			b, _ := json.MarshalIndent(out, "", "  ")
+			fmt.Println(string(b))
+		} else if err != nil {
+			fmt.Printf("INVALID: %v\n", err)
+		} else {
+			fmt.Printf("VALID: event %s is in epoch %d\nRoot: %s\nSigned by %d of %d required finalizers\n", res.EventID, res.Epoch, res.Root, len(res.Signers), res.Quorum)
+			if res.IncludedIn != "" {
+				fmt.Printf("Finalized on chain in block %s\n", res.IncludedIn)
+			}
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// readJSON decodes a file ("-" for stdin)
+func readJSON(path string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	return json.NewDecoder(r).Decode(v)
+}
+
+func init() {
+	rootCmd.AddCommand(verifyProofCmd)
+	verifyProofCmd.Flags().String("proof", "", "Proof JSON file from /epochs/{N}/proof/{eventID}, or - for stdin (required)")
+	verifyProofCmd.Flags().String("record", "", "Finalized epoch record (FinalizeEpochTx or /epochs/{N} response); defaults to the one in the proof")
+	verifyProofCmd.Flags().StringSlice("finalizers", nil, "Trusted finalizer public keys (base64 Ed25519), comma-separated")
+	verifyProofCmd.Flags().String("finalizers-file", "", "File of trusted finalizer public keys, one per line")
+	verifyProofCmd.Flags().Int("quorum", 0, "Signatures required (default: more than two thirds of the finalizers)")
+	verifyProofCmd.Flags().StringP("output", "o", "plain", "Output format: plain|json")
+}
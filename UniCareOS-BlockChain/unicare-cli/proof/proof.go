@@ -0,0 +1,204 @@
+// Package proof verifies UniCareOS epoch inclusion proofs offline.
+//
+// A proof (GET /epochs/{N}/proof/{eventID} on a node) carries a finalized event, its Merkle path to the
+// epoch root, and the quorum-signed FinalizeEpochTx that put that root on chain. Verify needs nothing
+// but the proof, the finalized epoch record and the finalizer public keys: no node access and no
+// dependency on the node's code. It follows the node's hashing rules exactly:
+//   - leaf = sha256(canonical FinalizeEventTx JSON), hex
+//   - parent = sha256(leftHex || rightHex), hex; an odd last node is paired with itself
+//   - a single-leaf epoch's root is the leaf itself
+//   - the proof's eventId is the finalized medical record (the event's eventID) or the finalize_event
+//     itself (sha256 of the event's txID, hex)
+//   - finalizers sign {"type":"finalize_epoch","epochNumber":N,"epochSummaryHash":root} with Ed25519
+package proof
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Step is one sibling on the path from the leaf to the root
+type Step struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+// FinalizerSignature is one finalizer's signature over the epoch root
+type FinalizerSignature struct {
+	PubKey    string `json:"pubKey"`
+	Signature string `json:"signature"`
+}
+
+// EpochRecord is the on-chain finalization of an epoch (a node's FinalizeEpochTx)
+type EpochRecord struct {
+	TxID             string               `json:"txID"`
+	EpochNumber      uint64               `json:"epochNumber"`
+	EpochSummaryHash string               `json:"epochSummaryHash"`
+	Signatures       []FinalizerSignature `json:"signatures"`
+	Status           string               `json:"status"`
+	IncludedIn       string               `json:"includedIn,omitempty"`
+}
+
+// EpochProof is the response of GET /epochs/{N}/proof/{eventID}
+type EpochProof struct {
+	Epoch        uint64          `json:"epoch"`
+	EventID      string          `json:"eventId"`
+	BlockHeight  int             `json:"blockHeight"`
+	Event        json.RawMessage `json:"event"`
+	LeafHash     string          `json:"leafHash"`
+	LeafIndex    int             `json:"leafIndex"`
+	LeafCount    int             `json:"leafCount"`
+	Path         []Step          `json:"path"`
+	Root         string          `json:"root"`
+	Finalization *EpochRecord    `json:"finalization,omitempty"`
+}
+
+// Result summarizes a successful verification
+type Result struct {
+	Epoch      uint64
+	EventID    string
+	Root       string
+	Signers    []string // Finalizer keys whose signatures checked out
+	Quorum     int
+	IncludedIn string
+}
+
+// Quorum is the default number of finalizer signatures required out of finalizers (more than two thirds)
+func Quorum(finalizers int) int {
+	return finalizers*2/3 + 1
+}
+
+// Verify checks p against record (p.Finalization if record is nil) and the trusted finalizer keys
+// (base64 Ed25519). quorum <= 0 means Quorum(len(finalizers)).
+func Verify(p *EpochProof, record *EpochRecord, finalizers []string, quorum int) (*Result, error) {
+	if p == nil {
+		return nil, errors.New("no proof")
+	}
+	if record == nil {
+		record = p.Finalization
+	}
+	if record == nil {
+		return nil, fmt.Errorf("epoch %d has no finalization record; it may not be finalized on chain yet", p.Epoch)
+	}
+	if len(finalizers) == 0 {
+		return nil, errors.New("no trusted finalizer keys given")
+	}
+	if quorum <= 0 {
+		quorum = Quorum(len(finalizers))
+	}
+
+	// Event -> leaf
+	if len(p.Event) == 0 {
+		return nil, errors.New("proof carries no event")
+	}
+	var canonical bytes.Buffer
+	if err := json.Compact(&canonical, p.Event); err != nil {
+		return nil, fmt.Errorf("event is not valid JSON: %v", err)
+	}
+	if leaf := sha256Hex(canonical.Bytes()); leaf != p.LeafHash {
+		return nil, fmt.Errorf("event hashes to %s, not leaf %s", leaf, p.LeafHash)
+	}
+	var evt struct {
+		TxID    string `json:"txID"`
+		EventID string `json:"eventID"`
+	}
+	if err := json.Unmarshal(p.Event, &evt); err != nil {
+		return nil, fmt.Errorf("event is not a finalization: %v", err)
+	}
+	if evt.TxID == "" {
+		return nil, fmt.Errorf("event carries no txID, so it cannot be bound to event %s", p.EventID)
+	}
+	if !strings.EqualFold(p.EventID, evt.EventID) && !strings.EqualFold(p.EventID, sha256Hex([]byte(evt.TxID))) {
+		return nil, fmt.Errorf("proof is for event %s, but its event finalizes %s (tx %s)", p.EventID, evt.EventID, evt.TxID)
+	}
+
+	// Leaf -> root, with the sibling sides implied by the leaf position
+	if p.LeafCount < 1 || p.LeafIndex < 0 || p.LeafIndex >= p.LeafCount {
+		return nil, fmt.Errorf("leaf index %d out of range for %d leaves", p.LeafIndex, p.LeafCount)
+	}
+	h, index, width := p.LeafHash, p.LeafIndex, p.LeafCount
+	for i, s := range p.Path {
+		if width <= 1 {
+			return nil, fmt.Errorf("path has %d steps, more than %d leaves need", len(p.Path), p.LeafCount)
+		}
+		left := index%2 == 1
+		if s.Left != left || (!left && index+1 == width && s.Hash != h) {
+			return nil, fmt.Errorf("path step %d does not match leaf position %d of %d", i, p.LeafIndex, p.LeafCount)
+		}
+		if left {
+			h = hashPair(s.Hash, h)
+		} else {
+			h = hashPair(h, s.Hash)
+		}
+		index, width = index/2, (width+1)/2
+	}
+	if width != 1 {
+		return nil, fmt.Errorf("path has %d steps, too few for %d leaves", len(p.Path), p.LeafCount)
+	}
+	if h != p.Root {
+		return nil, fmt.Errorf("path leads to root %s, not %s", h, p.Root)
+	}
+
+	// Root -> signed epoch record
+	if record.EpochNumber != p.Epoch {
+		return nil, fmt.Errorf("record finalizes epoch %d, proof is for epoch %d", record.EpochNumber, p.Epoch)
+	}
+	if record.EpochSummaryHash != p.Root {
+		return nil, fmt.Errorf("record root %s does not match proof root %s", record.EpochSummaryHash, p.Root)
+	}
+	msg := signingBytes(record.EpochNumber, record.EpochSummaryHash)
+	if record.TxID != sha256Hex(msg) {
+		return nil, errors.New("record txID does not match its epoch and root")
+	}
+	trusted := make(map[string]bool, len(finalizers))
+	for _, f := range finalizers {
+		trusted[f] = true
+	}
+	res := &Result{Epoch: p.Epoch, EventID: p.EventID, Root: p.Root, Quorum: quorum, IncludedIn: record.IncludedIn}
+	seen := make(map[string]bool)
+	for _, s := range record.Signatures {
+		if !trusted[s.PubKey] || seen[s.PubKey] {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(s.PubKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Signature)
+		if err != nil || !ed25519.Verify(pub, msg, sig) {
+			continue
+		}
+		seen[s.PubKey] = true
+		res.Signers = append(res.Signers, s.PubKey)
+	}
+	if len(res.Signers) < quorum {
+		return nil, fmt.Errorf("record has %d valid signatures from trusted finalizers, %d required", len(res.Signers), quorum)
+	}
+	return res, nil
+}
+
+// signingBytes must match FinalizeEpochTx.SigningBytes on the node
+func signingBytes(epoch uint64, root string) []byte {
+	data, _ := json.Marshal(struct {
+		Type        string `json:"type"`
+		EpochNumber uint64 `json:"epochNumber"`
+		Root        string `json:"epochSummaryHash"`
+	}{"finalize_epoch", epoch, root})
+	return data
+}
+
+func hashPair(left, right string) string {
+	return sha256Hex([]byte(left + right))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package proof
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testdata/proof.json was served by a node for the last of five finalized events (an odd leaf paired
+// with itself), with the epoch signed by the three keys in testdata/finalizers.txt.
+func loadFixture(t *testing.T) (*EpochProof, []string) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/proof.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p EpochProof
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := os.ReadFile("testdata/finalizers.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &p, strings.Fields(string(keys))
+}
+
+func TestVerifyNodeProof(t *testing.T) {
+	p, keys := loadFixture(t)
+	res, err := Verify(p, nil, keys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Signers) != 3 || res.Quorum != 3 || res.Root != p.Root || res.IncludedIn == "" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if _, err := Verify(p, nil, keys[:1], 1); err != nil {
+		t.Errorf("one trusted key with quorum 1: %v", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	cases := map[string]func(p *EpochProof, keys *[]string, quorum *int){
+		"event edited": func(p *EpochProof, _ *[]string, _ *int) {
+			p.Event = json.RawMessage(strings.Replace(string(p.Event), "2023", "2024", 1))
+		},
+		"eventId swapped":    func(p *EpochProof, _ *[]string, _ *int) { p.EventID = strings.Repeat("c", 64) },
+		"sibling edited":     func(p *EpochProof, _ *[]string, _ *int) { p.Path[1].Hash = strings.Repeat("0", 64) },
+		"side flipped":       func(p *EpochProof, _ *[]string, _ *int) { p.Path[2].Left = false },
+		"step dropped":       func(p *EpochProof, _ *[]string, _ *int) { p.Path = p.Path[:2] },
+		"step added":         func(p *EpochProof, _ *[]string, _ *int) { p.Path = append(p.Path, Step{Hash: p.Root}) },
+		"position forged":    func(p *EpochProof, _ *[]string, _ *int) { p.LeafIndex = 2 },
+		"root swapped":       func(p *EpochProof, _ *[]string, _ *int) { p.Root = p.Path[1].Hash },
+		"record other epoch": func(p *EpochProof, _ *[]string, _ *int) { p.Finalization.EpochNumber = 1 },
+		"record txID edited": func(p *EpochProof, _ *[]string, _ *int) { p.Finalization.TxID = strings.Repeat("a", 64) },
+		"signature dropped":  func(p *EpochProof, _ *[]string, _ *int) { p.Finalization.Signatures = p.Finalization.Signatures[1:] },
+		"untrusted keys":     func(p *EpochProof, keys *[]string, _ *int) { *keys = []string{"bm90LWEta2V5"} },
+		"quorum unreachable": func(_ *EpochProof, _ *[]string, quorum *int) { *quorum = 4 },
+		"no finalizer keys":  func(_ *EpochProof, keys *[]string, _ *int) { *keys = nil },
+		"no finalization":    func(p *EpochProof, _ *[]string, _ *int) { p.Finalization = nil },
+		"signature duplicate": func(p *EpochProof, _ *[]string, _ *int) {
+			p.Finalization.Signatures = append(p.Finalization.Signatures[:1], p.Finalization.Signatures[0], p.Finalization.Signatures[0])
+		},
+	}
+	for name, tamper := range cases {
+		p, keys := loadFixture(t)
+		quorum := 0
+		tamper(p, &keys, &quorum)
+		if _, err := Verify(p, nil, keys, quorum); err == nil {
+			t.Errorf("%s: proof accepted", name)
+		}
+	}
+}
+
+func TestVerifyBindsEventID(t *testing.T) {
+	p, keys := loadFixture(t)
+	var evt struct {
+		EventID string `json:"eventID"`
+	}
+	if err := json.Unmarshal(p.Event, &evt); err != nil {
+		t.Fatal(err)
+	}
+	// A proof may name the finalized medical record instead of the finalize_event
+	p.EventID = evt.EventID
+	if _, err := Verify(p, nil, keys, 0); err != nil {
+		t.Errorf("proof naming the finalized record rejected: %v", err)
+	}
+}
+
+func TestVerifyAgainstSeparateRecord(t *testing.T) {
+	p, keys := loadFixture(t)
+	record := *p.Finalization
+	p.Finalization = nil
+	if _, err := Verify(p, &record, keys, 0); err != nil {
+		t.Fatal(err)
+	}
+	other := record
+	other.EpochSummaryHash = strings.Repeat("b", 64)
+	if _, err := Verify(p, &other, keys, 0); err == nil {
+		t.Error("record for a different root accepted")
+	}
+}